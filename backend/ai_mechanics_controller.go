@@ -124,5 +124,28 @@ func (a *AIMechanicsController) GenerateMechanics(c *gin.Context) {
 		return
 	}
 
+	// Модель регулярно выдумывает kind-ы и поля: ответ вне схемы не уходит в
+	// редактор, иначе он всплывёт только при сохранении.
+	if problems := validateMechanicsSchema(mechanics, generatedMechanicsKind(req.Kind)); len(problems) > 0 {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":     "Модель вернула механику вне схемы",
+			"details":   problems[0].Error(),
+			"errors":    problems,
+			"mechanics": mechanics,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"mechanics": mechanics, "model": model})
 }
+
+// generatedMechanicsKind переводит вид сущности запроса в kind MechanicCard:
+// у предметов своего вида в схеме нет.
+func generatedMechanicsKind(kind string) string {
+	switch kind {
+	case mechanicsKindAction, mechanicsKindSpell, "trait":
+		return kind
+	default:
+		return mechanicsKindPassiveEffect
+	}
+}
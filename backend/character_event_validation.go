@@ -246,6 +246,48 @@ func validateCharacterEvent(eventType string, payload JSONMap) error {
 		}
 		return optionalString(normalized, "targetActorId", "payload.targetActorId", false)
 
+	case "level_up":
+		if err := exactKeys(normalized, "payload", []string{"type", "level", "hpGained", "method"}, []string{"roll", "classId", "classLevel"}); err != nil {
+			return err
+		}
+		if err := requiredPositiveInteger(normalized, "level", "payload.level"); err != nil {
+			return err
+		}
+		if err := optionalString(normalized, "classId", "payload.classId", false); err != nil {
+			return err
+		}
+		if _, exists := normalized["classLevel"]; exists {
+			if err := requiredPositiveInteger(normalized, "classLevel", "payload.classLevel"); err != nil {
+				return err
+			}
+		}
+		if err := requiredNonNegativeInteger(normalized, "hpGained", "payload.hpGained"); err != nil {
+			return err
+		}
+		method, err := requiredString(normalized, "method", "payload.method", false)
+		if err != nil {
+			return err
+		}
+		if !oneOf(method, "average", "roll") {
+			return invalidCharacterEvent("payload.method", "is unsupported")
+		}
+		if _, exists := normalized["roll"]; !exists {
+			return nil
+		}
+		return requiredRoll(normalized, "roll", "payload.roll")
+
+	case "xp_gained":
+		if err := exactKeys(normalized, "payload", []string{"type", "amount", "total"}, []string{"source"}); err != nil {
+			return err
+		}
+		if err := requiredNonNegativeInteger(normalized, "amount", "payload.amount"); err != nil {
+			return err
+		}
+		if err := requiredNonNegativeInteger(normalized, "total", "payload.total"); err != nil {
+			return err
+		}
+		return optionalString(normalized, "source", "payload.source", false)
+
 	case "turn_started", "turn_ended", "short_rest", "long_rest":
 		return exactKeys(normalized, "payload", []string{"type"}, nil)
 
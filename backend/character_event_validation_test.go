@@ -47,6 +47,8 @@ func TestValidateCharacterEventAcceptsCurrentEngineEventUnion(t *testing.T) {
 		{"type": "turn_ended"},
 		{"type": "short_rest"},
 		{"type": "long_rest"},
+		{"type": "level_up", "level": float64(4), "hpGained": float64(7), "method": "average", "classId": "CLASS-wizard", "classLevel": float64(1)},
+		{"type": "xp_gained", "amount": float64(150), "total": float64(450), "source": "Засада у моста"},
 		{"type": "narrative", "text": "Fire resistance", "damageAdjustment": map[string]any{
 			"damageType": "fire", "adjustment": "resistance", "before": float64(9), "after": float64(4), "sourceEntityIds": []any{"effect:dwarf"},
 		}},
@@ -79,6 +81,8 @@ func TestValidateCharacterEventRejectsMalformedOrAmbiguousPayloads(t *testing.T)
 		{name: "null optional source", eventType: "healing", payload: JSONMap{"type": "healing", "amount": float64(1), "source": nil}, want: "bounded string"},
 		{name: "empty condition", eventType: "condition_applied", payload: JSONMap{"type": "condition_applied", "condition": "  "}, want: "bounded string"},
 		{name: "empty item quantity", eventType: "item_added", payload: JSONMap{"type": "item_added", "cardId": "arrow", "qty": float64(0), "total": float64(0)}, want: "positive safe integer"},
+		{name: "negative experience", eventType: "xp_gained", payload: JSONMap{"type": "xp_gained", "amount": float64(-50), "total": float64(0)}, want: "non-negative safe integer"},
+		{name: "level up method is closed", eventType: "level_up", payload: JSONMap{"type": "level_up", "level": float64(2), "hpGained": float64(6), "method": "max"}, want: "is unsupported"},
 		{name: "turn payload injection", eventType: "turn_started", payload: JSONMap{"type": "turn_started", "actor": "other"}, want: "is not allowed"},
 		{name: "world interaction parameters are required object", eventType: "world_interaction", payload: JSONMap{"type": "world_interaction", "operation": "beckon_water", "parameters": []any{}}, want: "must be a JSON object"},
 		{name: "communication must remain private", eventType: "communication", payload: JSONMap{"type": "communication", "mode": "message", "private": false}, want: "must be true"},
@@ -384,10 +384,10 @@ func runtimeCommandUpdates(character CharacterV3, patch CharacterRuntimeCommandP
 		updates["current_hp"] = *patch.CurrentHP
 	}
 	if patch.InventoryItems != nil {
-		if err := validateRuntimeInventoryConsumption(character.InventoryItems, patch.InventoryItems); err != nil {
+		if err := validateRuntimeInventoryConsumption(characterInventoryWithoutBonds(character.InventoryItems), patch.InventoryItems); err != nil {
 			return nil, err
 		}
-		updates["inventory_items"] = patch.InventoryItems
+		updates["inventory_items"] = carryCharacterAttunement(character, character.Equipment, patch.InventoryItems)
 	}
 	if patch.Resources != nil {
 		updates["resources"] = patch.Resources
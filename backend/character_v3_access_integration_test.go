@@ -204,6 +204,17 @@ func TestCharacterV3RoutesRequireStrictJWT(t *testing.T) {
 		{http.MethodGet, "/api/characters-v3/" + id + "/events"},
 		{http.MethodPost, "/api/characters-v3/" + id + "/events"},
 		{http.MethodPatch, "/api/characters-v3/" + id + "/runtime"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/evaluate"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/recompute"},
+		{http.MethodGet, "/api/characters-v3/" + id + "/level-up"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/level-up"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/rest"},
+		{http.MethodGet, "/api/characters-v3/" + id + "/spellcasting"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/spellcasting/cast"},
+		{http.MethodGet, "/api/characters-v3/" + id + "/encumbrance"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/attune"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/unattune"},
+		{http.MethodPost, "/api/characters-v3/" + id + "/equip"},
 	} {
 		response := performCharacterV3Request(t, router, route.method, route.path, "", nil)
 		if response.Code != http.StatusUnauthorized {
@@ -238,7 +249,7 @@ func TestCharacterV3OwnerAndLegacyPublicAccessPolicy(t *testing.T) {
 	created := performCharacterV3Request(t, fixture.router, http.MethodPost, "/api/characters-v3", ownerToken, map[string]any{
 		"name":            "Authenticated creation",
 		"equipment":       map[string]any{"main_hand": "card-sword"},
-		"inventory_items": []any{map[string]any{"card_id": "card-rope", "qty": 2}},
+		"inventory_items": []any{map[string]any{"card_id": "card-rope", "qty": 2, "attuned": true}},
 		"resources":       map[string]any{"spell_slot_1": 1},
 		"max_resources":   map[string]any{"spell_slot_1": 2},
 		"active_effects": []any{map[string]any{
@@ -268,6 +279,16 @@ func TestCharacterV3OwnerAndLegacyPublicAccessPolicy(t *testing.T) {
 		createdCharacter.Currency == nil || (*createdCharacter.Currency)["gp"] != float64(12) {
 		t.Fatalf("initial runtime was not returned by atomic create: %#v", createdCharacter)
 	}
+	if (*createdCharacter.InventoryItems)[0].Attuned {
+		t.Fatalf("client attunement flag must be dropped on create: %#v", *createdCharacter.InventoryItems)
+	}
+	var storedCharacter CharacterV3
+	if err := fixture.db.First(&storedCharacter, "id = ?", createdCharacter.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(characterAttunedCardIDs(storedCharacter)) != 0 {
+		t.Fatalf("created character must not be attuned: %#v", storedCharacter.InventoryItems)
+	}
 
 	list := performCharacterV3Request(t, fixture.router, http.MethodGet, "/api/characters-v3", ownerToken, nil)
 	if list.Code != http.StatusOK {
@@ -508,6 +529,19 @@ func TestCharacterV3LinkedRuntimeIsEncounterOwnedButOtherEditsPersist(t *testing
 		t.Fatalf("linked PUT: got %d: %s", update.Code, update.Body.String())
 	}
 
+	var linked CharacterV3
+	if err := fixture.db.First(&linked, "id = ?", fixture.ownerCharacter.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	equip := performCharacterV3Request(
+		t, fixture.router, http.MethodPost,
+		"/api/characters-v3/"+fixture.ownerCharacter.ID.String()+"/equip", token,
+		map[string]any{"card_id": uuid.NewString(), "expected_runtime_revision": linked.RuntimeRevision},
+	)
+	if equip.Code != http.StatusConflict || !strings.Contains(equip.Body.String(), "character_in_encounter") {
+		t.Fatalf("linked equip must be rejected: got %d: %s", equip.Code, equip.Body.String())
+	}
+
 	patch := performCharacterV3Request(
 		t, fixture.router, http.MethodPatch,
 		"/api/characters-v3/"+fixture.ownerCharacter.ID.String()+"/runtime", token,
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// characterMaxAttuned — настроиться можно максимум на 3 предмета (PHB);
+// модификаторы attunement_slots меняют лимит (например, у изобретателя).
+const characterMaxAttuned = 3
+
+const maxCharacterAttunementBodyBytes = 1 << 10
+
+// cardAttunementRequirements — структурированные требования настройки
+// (cards.attunement_requirements); текст Card.Attunement остаётся описанием.
+// Classes и Races — card_number или id класса/подкласса и вида/подвида,
+// достаточно одного совпадения; Spellcaster — нужен класс с колдовством.
+type cardAttunementRequirements struct {
+	Classes     []string
+	Races       []string
+	Spellcaster bool
+}
+
+// parseCardAttunementRequirements разбирает декларацию требований
+// настройки. ok=false — требований нет.
+func parseCardAttunementRequirements(raw *JSONMap) (cardAttunementRequirements, bool, error) {
+	var requirements cardAttunementRequirements
+	if raw == nil || len(*raw) == 0 {
+		return requirements, false, nil
+	}
+	for key, value := range *raw {
+		var err error
+		switch key {
+		case "classes":
+			requirements.Classes, err = cardAttunementList(value, key)
+		case "races":
+			requirements.Races, err = cardAttunementList(value, key)
+		case "spellcaster":
+			spellcaster, isBool := value.(bool)
+			if !isBool {
+				err = fmt.Errorf("attunement_requirements.spellcaster должен быть булевым")
+			}
+			requirements.Spellcaster = spellcaster
+		default:
+			err = fmt.Errorf("attunement_requirements: неизвестное поле %q", key)
+		}
+		if err != nil {
+			return requirements, false, err
+		}
+	}
+	return requirements, true, nil
+}
+
+func cardAttunementList(raw interface{}, field string) ([]string, error) {
+	items, isList := raw.([]interface{})
+	if !isList || len(items) == 0 {
+		return nil, fmt.Errorf("attunement_requirements.%s должен быть непустым списком", field)
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("attunement_requirements.%s содержит пустой или нестроковый элемент", field)
+		}
+		result = append(result, strings.TrimSpace(value))
+	}
+	return result, nil
+}
+
+// unmet — первое невыполненное требование (пустая строка — все выполнены).
+func (r cardAttunementRequirements) unmet(bundle characterFeatureBundle, level int) string {
+	if len(r.Classes) > 0 {
+		var identities []string
+		for _, entry := range bundle.classLevels(level) {
+			identities = append(identities, entry.Class.CardNumber, entry.Class.ID.String())
+			if entry.Subclass != nil {
+				identities = append(identities, entry.Subclass.CardNumber, entry.Subclass.ID.String())
+			}
+		}
+		if !cardAttunementMatches(r.Classes, identities) {
+			return "нужен класс: " + strings.Join(r.Classes, ", ")
+		}
+	}
+	if len(r.Races) > 0 {
+		var identities []string
+		for _, race := range []*Race{bundle.Race, bundle.Subrace} {
+			if race != nil {
+				identities = append(identities, race.CardNumber, race.ID.String())
+			}
+		}
+		if !cardAttunementMatches(r.Races, identities) {
+			return "нужен вид: " + strings.Join(r.Races, ", ")
+		}
+	}
+	if r.Spellcaster && len(characterCasterClasses(bundle, level)) == 0 {
+		return "нужен заклинатель"
+	}
+	return ""
+}
+
+func cardAttunementMatches(required, identities []string) bool {
+	for _, want := range required {
+		for _, have := range identities {
+			if have != "" && strings.EqualFold(want, have) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// characterAttunedCardIDs — предметы, на которые персонаж настроен: строки
+// инвентаря с attuned, чей предмет по-прежнему у персонажа (в сумке или
+// надет), без повторов.
+func characterAttunedCardIDs(character CharacterV3) []string {
+	if character.InventoryItems == nil {
+		return nil
+	}
+	present := map[string]bool{}
+	for _, id := range characterEquippedCardIDs(character) {
+		present[id] = true
+	}
+	for _, row := range *character.InventoryItems {
+		if row.Qty > 0 {
+			present[row.CardID] = true
+		}
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, row := range *character.InventoryItems {
+		if row.Attuned && present[row.CardID] && !seen[row.CardID] {
+			seen[row.CardID] = true
+			ids = append(ids, row.CardID)
+		}
+	}
+	return ids
+}
+
+// withCharacterAttunement переносит настройку attuned на новый снимок
+// инвентаря: флаг ставит только сервер, поэтому присланные флаги и строки без
+// количества отбрасываются. Настройка ставится на первую строку предмета
+// (верхний уровень важнее контейнера); надетый предмет без строки получает
+// строку-привязку с qty 0. Предмет, которого больше нет, настройку теряет.
+func withCharacterAttunement(equipment *JSONMap, rows *InventoryItemRows, attuned []string) *InventoryItemRows {
+	result := InventoryItemRows{}
+	if rows != nil {
+		for _, row := range *rows {
+			if row.Qty > 0 {
+				row.Attuned = false
+				result = append(result, row)
+			}
+		}
+	}
+	equipped := map[string]bool{}
+	for _, id := range characterEquippedCardIDs(CharacterV3{Equipment: equipment}) {
+		equipped[id] = true
+	}
+	for _, id := range attuned {
+		index := -1
+		for candidate, row := range result {
+			if row.CardID == id && (index < 0 || (row.ContainerID == "" && result[index].ContainerID != "")) {
+				index = candidate
+			}
+		}
+		switch {
+		case index >= 0:
+			result[index].Attuned = true
+		case equipped[id]:
+			result = append(result, InventoryItemRow{CardID: id, Qty: 0, Attuned: true})
+		}
+	}
+	return &result
+}
+
+// carryCharacterAttunement — withCharacterAttunement с настройкой, уже
+// записанной у персонажа.
+func carryCharacterAttunement(character CharacterV3, equipment *JSONMap, rows *InventoryItemRows) *InventoryItemRows {
+	return withCharacterAttunement(equipment, rows, characterAttunedCardIDs(character))
+}
+
+// characterInventoryWithoutBonds — инвентарь без строк-привязок настройки
+// (qty 0): снимок, который видит и присылает клиент.
+func characterInventoryWithoutBonds(rows *InventoryItemRows) *InventoryItemRows {
+	if rows == nil {
+		return nil
+	}
+	result := InventoryItemRows{}
+	for _, row := range *rows {
+		if row.Qty > 0 {
+			result = append(result, row)
+		}
+	}
+	return &result
+}
+
+// characterAttunementSlots — лимит настроенных предметов с модификаторами
+// attunement_slots.
+func characterAttunementSlots(derivation CharacterDerivation) int {
+	return max(0, foldCharacterModifiers(characterMaxAttuned, "attunement_slots", nil,
+		derivation.passive, derivation.runtime, derivation.formula))
+}
+
+// CharacterAttunementRequest — настройка на предмет или её прекращение.
+type CharacterAttunementRequest struct {
+	CardID                  string `json:"card_id" binding:"required"`
+	ExpectedRuntimeRevision *int64 `json:"expected_runtime_revision" binding:"required"`
+}
+
+// CharacterAttunementResponse — настроенные предметы, лимит и лист после
+// изменения.
+type CharacterAttunementResponse struct {
+	Attuned   []string    `json:"attuned"`
+	Slots     int         `json:"slots"`
+	Character CharacterV3 `json:"character"`
+}
+
+func attunementCommandError(characterID uuid.UUID, code, message string) error {
+	return &characterRuntimeCommandError{
+		Status: http.StatusUnprocessableEntity, Code: code,
+		Message: message, CharacterID: characterID.String(),
+	}
+}
+
+// AttuneCharacterV3 — POST /api/characters-v3/:id/attune.
+func (cc *CharacterV3Controller) AttuneCharacterV3(c *gin.Context) {
+	cc.changeCharacterV3Attunement(c, true)
+}
+
+// UnattuneCharacterV3 — POST /api/characters-v3/:id/unattune.
+func (cc *CharacterV3Controller) UnattuneCharacterV3(c *gin.Context) {
+	cc.changeCharacterV3Attunement(c, false)
+}
+
+// changeCharacterV3Attunement настраивает персонажа на предмет или прерывает
+// настройку. Сервер проверяет, что предмет у персонажа и требует настройки,
+// лимит слотов и требования attunement_requirements; повтор уже выполненного
+// действия ничего не меняет. Запись идёт под проверкой runtime_revision.
+func (cc *CharacterV3Controller) changeCharacterV3Attunement(c *gin.Context, attune bool) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	if _, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Write); !allowed {
+		return
+	}
+
+	var req CharacterAttunementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+		return
+	}
+	cardID, err := uuid.Parse(req.CardID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID предмета"})
+		return
+	}
+
+	var response CharacterAttunementResponse
+	txErr := cc.db.Transaction(func(tx *gorm.DB) error {
+		var locked CharacterV3
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCharacterV3OwnerChanged
+			}
+			return err
+		}
+		if locked.RuntimeRevision != *req.ExpectedRuntimeRevision {
+			expected := *req.ExpectedRuntimeRevision
+			actual := locked.RuntimeRevision
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "runtime_revision_conflict",
+				Message: "character runtime revision is stale", CharacterID: characterID.String(),
+				ExpectedRuntimeRevision: &expected, ActualRuntimeRevision: &actual,
+			}
+		}
+		if locked.CurrentEncounterID != nil {
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "character_in_encounter",
+				Message: "character is linked to an active encounter", CharacterID: characterID.String(),
+			}
+		}
+
+		bundle, err := loadCharacterFeatureBundle(tx, locked)
+		if err != nil {
+			return err
+		}
+		derivationInput, err := characterBundleDerivationInput(tx, locked, bundle)
+		if err != nil {
+			return err
+		}
+		response.Slots = characterAttunementSlots(deriveCharacterStats(derivationInput))
+
+		id := cardID.String()
+		attuned := characterAttunedCardIDs(locked)
+		index := -1
+		for candidate, existing := range attuned {
+			if existing == id {
+				index = candidate
+			}
+		}
+		switch {
+		case attune && index < 0:
+			var card Card
+			if err := tx.First(&card, "id = ?", cardID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return attunementCommandError(characterID, "item_not_found", "предмет не найден")
+				}
+				return err
+			}
+			if card.RequiresAttunement == nil || !*card.RequiresAttunement {
+				return attunementCommandError(characterID, "attunement_not_required", "предмет не требует настройки")
+			}
+			if !newCharacterItemGate(locked).carried[id] {
+				return attunementCommandError(characterID, "item_not_carried", "предмета нет у персонажа")
+			}
+			if len(attuned) >= response.Slots {
+				return attunementCommandError(characterID, "attunement_limit",
+					fmt.Sprintf("настроиться можно максимум на %d предмета", response.Slots))
+			}
+			requirements, _, err := parseCardAttunementRequirements(card.AttunementRequirements)
+			if err != nil {
+				return attunementCommandError(characterID, "attunement_requirements_invalid", err.Error())
+			}
+			if reason := requirements.unmet(bundle, locked.Level); reason != "" {
+				return attunementCommandError(characterID, "attunement_prerequisites", reason)
+			}
+			attuned = append(attuned, id)
+		case !attune && index >= 0:
+			attuned = append(attuned[:index], attuned[index+1:]...)
+		default:
+			response.Attuned = attuned
+			return tx.Preload("User").Preload("Group").First(&response.Character, locked.ID).Error
+		}
+
+		result := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ? AND runtime_revision = ?", characterID, userID, locked.RuntimeRevision).
+			Updates(map[string]interface{}{
+				"inventory_items":  withCharacterAttunement(locked.Equipment, locked.InventoryItems, attuned),
+				"runtime_revision": locked.RuntimeRevision + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCharacterV3OwnerChanged
+		}
+		response.Attuned = attuned
+		return tx.Preload("User").Preload("Group").First(&response.Character, locked.ID).Error
+	})
+	if errors.Is(txErr, errCharacterV3OwnerChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
+		return
+	}
+	var commandErr *characterRuntimeCommandError
+	if errors.As(txErr, &commandErr) {
+		writeCharacterRuntimeCommandError(c, txErr)
+		return
+	}
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка настройки на предмет", "details": txErr.Error()})
+		return
+	}
+	if response.Attuned == nil {
+		response.Attuned = []string{}
+	}
+	response.Character.AccessMode = characterV3AccessOwner
+	c.JSON(http.StatusOK, response)
+}
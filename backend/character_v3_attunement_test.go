@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseCardAttunementRequirements(t *testing.T) {
+	raw := JSONMap(mustMechanicsJSON(t, `{"classes":["CLASS-wizard","CLASS-sorcerer"],"spellcaster":true}`))
+	requirements, ok, err := parseCardAttunementRequirements(&raw)
+	if err != nil || !ok || len(requirements.Classes) != 2 || !requirements.Spellcaster {
+		t.Fatalf("declaration must parse: %+v %v", requirements, err)
+	}
+	if _, ok, err := parseCardAttunementRequirements(&JSONMap{}); ok || err != nil {
+		t.Fatal("empty declaration means no requirements")
+	}
+	for _, invalid := range []string{
+		`{"classes":"CLASS-wizard"}`,
+		`{"classes":[]}`,
+		`{"races":[""]}`,
+		`{"spellcaster":"yes"}`,
+		`{"alignment":["good"]}`,
+	} {
+		raw := JSONMap(mustMechanicsJSON(t, invalid))
+		if _, _, err := parseCardAttunementRequirements(&raw); err == nil {
+			t.Fatalf("declaration %s must be rejected", invalid)
+		}
+	}
+}
+
+func TestCardAttunementRequirementsUnmet(t *testing.T) {
+	wizardSpellcasting := JSONMap(mustMechanicsJSON(t, `{"progression":"full","ability":"int"}`))
+	wizard := Class{ID: uuid.New(), CardNumber: "CLASS-wizard", Spellcasting: &wizardSpellcasting}
+	fighter := Class{ID: uuid.New(), CardNumber: "CLASS-warrior"}
+	elf := Race{ID: uuid.New(), CardNumber: "RACE-elf"}
+
+	wizardBundle := characterFeatureBundle{Class: &wizard, Race: &elf}
+	fighterBundle := characterFeatureBundle{Class: &fighter, Race: &elf}
+	staff := cardAttunementRequirements{Classes: []string{"class-wizard"}}
+	if staff.unmet(wizardBundle, 3) != "" || staff.unmet(fighterBundle, 3) == "" {
+		t.Fatal("class requirement matches card_number case-insensitively")
+	}
+	caster := cardAttunementRequirements{Spellcaster: true}
+	if caster.unmet(wizardBundle, 3) != "" || caster.unmet(fighterBundle, 3) == "" {
+		t.Fatal("spellcaster requirement needs a class with spellcasting")
+	}
+	dwarven := cardAttunementRequirements{Races: []string{"RACE-dwarf"}}
+	if dwarven.unmet(fighterBundle, 3) == "" || (cardAttunementRequirements{Races: []string{elf.ID.String()}}).unmet(fighterBundle, 3) != "" {
+		t.Fatal("race requirement matches card_number or id")
+	}
+}
+
+func TestCarryCharacterAttunement(t *testing.T) {
+	ring, cloak, bag, potion := uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+	equipment := JSONMap{"ring_1": ring}
+	inventory := InventoryItemRows{
+		{CardID: bag, Qty: 1},
+		{CardID: cloak, Qty: 1, ContainerID: bag},
+		{CardID: cloak, Qty: 1},
+		{CardID: potion, Qty: 2, Attuned: true},
+	}
+	rows := withCharacterAttunement(&equipment, &inventory, []string{cloak, ring, potion})
+	character := CharacterV3{Equipment: &equipment, InventoryItems: rows}
+	if attuned := characterAttunedCardIDs(character); len(attuned) != 3 {
+		t.Fatalf("want three attuned items, got %v", attuned)
+	}
+	if (*rows)[1].Attuned || !(*rows)[2].Attuned || (*rows)[4] != (InventoryItemRow{CardID: ring, Attuned: true}) {
+		t.Fatalf("attunement must go to the top-level row and an equipped bond row: %+v", *rows)
+	}
+
+	// Клиент снимает кольцо в сумку и присылает снимок без флагов: настройка
+	// переезжает на строку, потерянный плащ её теряет, чужие флаги сброшены.
+	next := InventoryItemRows{{CardID: bag, Qty: 1}, {CardID: ring, Qty: 1}, {CardID: potion, Qty: 1, Attuned: true}}
+	carried := carryCharacterAttunement(character, &JSONMap{}, &next)
+	character = CharacterV3{Equipment: &JSONMap{}, InventoryItems: carried}
+	if attuned := characterAttunedCardIDs(character); len(attuned) != 2 || attuned[0] != ring || attuned[1] != potion {
+		t.Fatalf("attunement must follow present items: %v", attuned)
+	}
+	if len(*carried) != 3 || len(*characterInventoryWithoutBonds(rows)) != 4 {
+		t.Fatalf("unexpected rows: %+v", *carried)
+	}
+
+	forged := InventoryItemRows{{CardID: cloak, Qty: 1, Attuned: true}}
+	if attuned := characterAttunedCardIDs(CharacterV3{InventoryItems: carryCharacterAttunement(CharacterV3{}, nil, &forged)}); len(attuned) != 0 {
+		t.Fatalf("client-sent attuned flags must be dropped: %v", attuned)
+	}
+}
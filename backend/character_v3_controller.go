@@ -60,8 +60,15 @@ func runtimeUpdatesForLockedCharacter(character CharacterV3, req PatchCharacterR
 	if req.Equipment != nil {
 		updates["equipment"] = req.Equipment
 	}
-	if req.InventoryItems != nil {
-		updates["inventory_items"] = req.InventoryItems
+	if req.InventoryItems != nil || (req.Equipment != nil && len(characterAttunedCardIDs(character)) > 0) {
+		equipment, rows := character.Equipment, character.InventoryItems
+		if req.Equipment != nil {
+			equipment = req.Equipment
+		}
+		if req.InventoryItems != nil {
+			rows = req.InventoryItems
+		}
+		updates["inventory_items"] = carryCharacterAttunement(character, equipment, rows)
 	}
 	if req.Resources != nil {
 		updates["resources"] = req.Resources
@@ -262,7 +269,25 @@ func (cc *CharacterV3Controller) CreateCharacterV3(c *gin.Context) {
 		TurnState:                req.TurnState,
 		Currency:                 req.Currency,
 	}
+	// Настройку ставит только сервер (changeCharacterV3Attunement), поэтому
+	// присланные при создании флаги attuned отбрасываются.
+	if req.InventoryItems != nil {
+		character.InventoryItems = withCharacterAttunement(req.Equipment, req.InventoryItems, nil)
+	}
 	applyCharacterV3Defaults(&character)
+	reconcileCharacterClasses(&character, req.Classes)
+	if req.Classes != nil && character.Classes != nil {
+		err := validateCharacterClasses(cc.db, *character.Classes, nil, characterBaseAbilities(character))
+		var classesErr *characterLevelUpError
+		if errors.As(err, &classesErr) {
+			writeCharacterLevelUpError(c, classesErr)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка проверки классов персонажа", "details": err.Error()})
+			return
+		}
+	}
 
 	tx := cc.db.Begin()
 	if tx.Error != nil {
@@ -369,6 +394,7 @@ func (cc *CharacterV3Controller) UpdateCharacterV3(c *gin.Context) {
 			return err
 		}
 
+		previousClasses := characterClassEntries(locked)
 		if req.Name != "" {
 			locked.Name = req.Name
 		}
@@ -404,6 +430,12 @@ func (cc *CharacterV3Controller) UpdateCharacterV3(c *gin.Context) {
 		locked.InitiativeBonus = req.InitiativeBonus
 		locked.PassivePerception = req.PassivePerception
 		applyCharacterV3Defaults(&locked)
+		reconcileCharacterClasses(&locked, req.Classes)
+		if req.Classes != nil && locked.Classes != nil {
+			if err := validateCharacterClasses(tx, *locked.Classes, previousClasses, characterBaseAbilities(locked)); err != nil {
+				return err
+			}
+		}
 
 		result := tx.Model(&CharacterV3{}).
 			Where("id = ? AND user_id = ?", characterID, userID).
@@ -417,6 +449,7 @@ func (cc *CharacterV3Controller) UpdateCharacterV3(c *gin.Context) {
 				"class_id":                   locked.ClassID,
 				"background_id":              locked.BackgroundID,
 				"level":                      locked.Level,
+				"classes":                    locked.Classes,
 				"feat_ids":                   locked.FeatIDs,
 				"spell_ids":                  locked.SpellIDs,
 				"action_ids":                 locked.ActionIDs,
@@ -452,6 +485,11 @@ func (cc *CharacterV3Controller) UpdateCharacterV3(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
 		return
 	}
+	var classesErr *characterLevelUpError
+	if errors.As(txErr, &classesErr) {
+		writeCharacterLevelUpError(c, classesErr)
+		return
+	}
 	if txErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка обновления персонажа", "details": txErr.Error()})
 		return
@@ -0,0 +1,1020 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCharacterRecomputeBodyBytes = 1 << 10
+
+// characterChoiceMaxDepth — предел вложенности choice (MAX_CHOICE_DEPTH в
+// frontend/src/mechanics/expandChoices.ts).
+const characterChoiceMaxDepth = 6
+
+// CharacterDerivedStats — снимок вычисляемых колонок CharacterV3. JSON-ключи
+// совпадают с колонками, чтобы отчёт о расхождениях читался как сам лист.
+type CharacterDerivedStats struct {
+	MaxHP             int `json:"max_hp"`
+	ArmorClass        int `json:"armor_class"`
+	InitiativeBonus   int `json:"initiative_bonus"`
+	PassivePerception int `json:"passive_perception"`
+	ProficiencyBonus  int `json:"proficiency_bonus"`
+	Speed             int `json:"speed"`
+}
+
+// CharacterStatDrift — колонка, хранимое значение которой не совпало с выведенным.
+type CharacterStatDrift struct {
+	Field   string `json:"field"`
+	Stored  int    `json:"stored"`
+	Derived int    `json:"derived"`
+}
+
+func storedCharacterStats(character CharacterV3) CharacterDerivedStats {
+	return CharacterDerivedStats{
+		MaxHP:             character.MaxHP,
+		ArmorClass:        character.ArmorClass,
+		InitiativeBonus:   character.InitiativeBonus,
+		PassivePerception: character.PassivePerception,
+		ProficiencyBonus:  character.ProficiencyBonus,
+		Speed:             character.Speed,
+	}
+}
+
+// drift сравнивает колонки в порядке листа; пустой срез — лист согласован.
+func (s CharacterDerivedStats) drift(derived CharacterDerivedStats) []CharacterStatDrift {
+	pairs := []struct {
+		field           string
+		stored, derived int
+	}{
+		{"max_hp", s.MaxHP, derived.MaxHP},
+		{"armor_class", s.ArmorClass, derived.ArmorClass},
+		{"initiative_bonus", s.InitiativeBonus, derived.InitiativeBonus},
+		{"passive_perception", s.PassivePerception, derived.PassivePerception},
+		{"proficiency_bonus", s.ProficiencyBonus, derived.ProficiencyBonus},
+		{"speed", s.Speed, derived.Speed},
+	}
+	result := []CharacterStatDrift{}
+	for _, pair := range pairs {
+		if pair.stored != pair.derived {
+			result = append(result, CharacterStatDrift{Field: pair.field, Stored: pair.stored, Derived: pair.derived})
+		}
+	}
+	return result
+}
+
+// characterMechanicsSource — механика, участвующая в выводе снимка. Key —
+// префикс ключей resolved_choices источника (пусто — только голые id выборов).
+type characterMechanicsSource struct {
+	Key       string
+	Name      string
+	Mechanics JSONMap
+}
+
+// characterDerivationInput — всё, из чего выводится снимок: Passive — эффекты
+// и действия сборки плюс механики надетых/носимых предметов, Runtime —
+// active_effects листа и раскрытые из них состояния. HitDie — кость первого
+// класса, ClassHitDice — кости всех классов по порядку взятия.
+type characterDerivationInput struct {
+	Character    CharacterV3
+	Actor        mechanicsActor
+	HitDie       string
+	ClassHitDice []characterClassHitDie
+	RaceSpeed    int
+	Passive      []characterMechanicsSource
+	Runtime      []characterMechanicsSource
+	Armor        *Card
+	Shield       *Card
+}
+
+// CharacterDerivation — выведенный снимок и итоговые характеристики, от
+// которых он считался (база + прибавки + value_method).
+type CharacterDerivation struct {
+	Stats     CharacterDerivedStats `json:"stats"`
+	Abilities map[string]int        `json:"abilities"`
+
+	// formula, passive и runtime — контекст формул и раскрытые пассивные и
+	// временные payload-ы вывода: по ним считаются пулы ресурсов и груз.
+	formula formulaContext
+	passive []map[string]interface{}
+	runtime []map[string]interface{}
+}
+
+// deriveCharacterStats пересчитывает снимок по алгоритму клиента
+// (resolveCharacterRules + armorClassValue): характеристики, бонус
+// мастерства, хиты, КЗ, скорость, инициатива и пассивное Восприятие. В отличие
+// от снимка сборки, предметы и активные эффекты входят во все значения —
+// так их видит лист.
+func deriveCharacterStats(input characterDerivationInput) CharacterDerivation {
+	character := input.Character
+	level := character.Level
+	if level < 1 {
+		level = 1
+	}
+	proficiency := 2 + (level-1)/4
+	choices := characterResolvedChoices(character)
+
+	passive := expandCharacterSources(input.Passive, choices, level, true)
+	runtime := expandCharacterSources(input.Runtime, choices, level, false)
+	all := append(append([]map[string]interface{}{}, passive...), runtime...)
+
+	// Характеристики считаются до модификаторов: value_method не видит их
+	// значения (цикл), как и preFctx клиента.
+	preContext := input.Actor.formulaContext()
+	preContext.AbilityMods = map[string]int{}
+	preContext.ProfBonus = proficiency
+	preContext.SelfLevel = level
+	abilities := deriveCharacterAbilities(character.Abilities, all, preContext)
+
+	actor := input.Actor
+	actor.Level = level
+	actor.ProficiencyBonus = proficiency
+	actor.Abilities = abilities
+	ctx := actor.formulaContext()
+	ctx.SelfLevel = level
+	ctx.ProfBonus = proficiency
+
+	stats := CharacterDerivedStats{ProficiencyBonus: proficiency}
+	stats.MaxHP = characterBaseMaxHP(input.HitDie, abilities["con"], level)
+	if len(input.ClassHitDice) > 1 {
+		stats.MaxHP = characterClassesMaxHP(input.ClassHitDice, abilities["con"])
+	}
+	stats.MaxHP = foldCharacterModifiers(stats.MaxHP, "max_hp", nil, passive, runtime, ctx)
+	if stats.MaxHP < 1 {
+		stats.MaxHP = 1
+	}
+
+	wearingArmor := input.Armor != nil
+	stats.ArmorClass = characterBaseArmorClass(input, all, ctx)
+	stats.ArmorClass = foldCharacterModifiers(stats.ArmorClass, "ac", map[string]interface{}{"wearingArmor": wearingArmor}, passive, runtime, ctx)
+
+	speed := input.RaceSpeed
+	for _, payload := range all {
+		if payload["kind"] != "grant_speed" || strings.ToLower(stringFieldOr(payload, "mode", "walk")) != "walk" {
+			continue
+		}
+		raw, exists := payload["value"]
+		if !exists {
+			raw = payload["amount"]
+		}
+		if value, ok := characterFormulaInt(raw, ctx); ok {
+			speed += value
+		}
+	}
+	stats.Speed = foldCharacterModifiers(speed, "speed", nil, passive, runtime, ctx)
+	if stats.Speed < 0 {
+		stats.Speed = 0
+	}
+
+	stats.InitiativeBonus = foldCharacterModifiers(abilityScoreModifier(abilities["dex"]), "initiative", nil, passive, runtime, ctx)
+
+	perception := abilityScoreModifier(abilities["wis"])
+	if characterHasSkill(character.SkillProficiencies, "perception") {
+		perception += proficiency
+		if characterHasSkill(character.SkillExpertise, "perception") {
+			perception += proficiency
+		}
+	}
+	stats.PassivePerception = 10 + perception
+
+	return CharacterDerivation{Stats: stats, Abilities: abilities, formula: ctx, passive: passive, runtime: runtime}
+}
+
+// characterBaseMaxHP — computeMaxHP клиента: макс. кость на 1 уровне, далее
+// среднее (кость/2+1) + мод. ТЕЛ, но не меньше 1 хита за уровень.
+func characterBaseMaxHP(hitDie string, con, level int) int {
+	die := characterHitDieSides(hitDie)
+	conMod := abilityScoreModifier(con)
+	perLevel := die/2 + 1 + conMod
+	if perLevel < 1 {
+		perLevel = 1
+	}
+	total := die + conMod + (level-1)*perLevel
+	if total < 1 {
+		return 1
+	}
+	return total
+}
+
+// characterClassHitDie — кость хитов класса и число уровней в нём.
+type characterClassHitDie struct {
+	HitDie string
+	Levels int
+}
+
+// characterClassesMaxHP — characterBaseMaxHP мультикласса: максимум кости
+// первого класса на 1-м уровне, дальше среднее кости того класса, в котором
+// взят уровень.
+func characterClassesMaxHP(dice []characterClassHitDie, con int) int {
+	conMod := abilityScoreModifier(con)
+	total := 0
+	for index, class := range dice {
+		die := characterHitDieSides(class.HitDie)
+		perLevel := die/2 + 1 + conMod
+		if perLevel < 1 {
+			perLevel = 1
+		}
+		levels := class.Levels
+		if index == 0 && levels > 0 {
+			total += die + conMod
+			levels--
+		}
+		total += levels * perLevel
+	}
+	if total < 1 {
+		return 1
+	}
+	return total
+}
+
+var characterHitDiePattern = regexp.MustCompile(`(?i)d(\d+)`)
+
+// characterHitDieSides — грани кости хитов класса, d8 по умолчанию.
+func characterHitDieSides(hitDie string) int {
+	if match := characterHitDiePattern.FindStringSubmatch(hitDie); match != nil {
+		if value, err := strconv.Atoi(match[1]); err == nil && value > 0 {
+			return value
+		}
+	}
+	return 8
+}
+
+// deriveCharacterAbilities складывает базу (колонка abilities уже включает
+// бонус предыстории) с grant_ability_score; положительная прибавка не
+// поднимает выше max(база, 20). value_method даёт кандидатов, берётся максимум.
+func deriveCharacterAbilities(base *JSONMap, payloads []map[string]interface{}, ctx formulaContext) map[string]int {
+	deltas := map[string]int{}
+	methods := map[string][]int{}
+	for _, payload := range payloads {
+		switch payload["kind"] {
+		case "grant_ability_score":
+			// Выбор характеристики кладёт id в value, поэтому прибавка тогда
+			// берётся только из amount.
+			ability := strings.ToLower(stringField(payload, "ability"))
+			raw := payload["amount"]
+			if ability == "" {
+				ability = strings.ToLower(stringField(payload, "value"))
+			} else if raw == nil {
+				raw = payload["value"]
+			}
+			if amount, ok := mechanicsNumber(raw); ok && isAbilityKey(ability) {
+				deltas[ability] += int(amount)
+			}
+		case "value_method":
+			target := strings.ToLower(stringField(payload, "target"))
+			raw, exists := payload["formula"]
+			if !exists {
+				raw = payload["value"]
+			}
+			if !isAbilityKey(target) {
+				continue
+			}
+			if value, ok := characterFormulaInt(raw, ctx); ok {
+				methods[target] = append(methods[target], value)
+			}
+		}
+	}
+
+	result := make(map[string]int, len(abilityKeys))
+	for _, key := range abilityKeys {
+		score := 10
+		if base != nil {
+			if value, ok := mechanicsNumber((*base)[key]); ok {
+				score = int(value)
+			}
+		}
+		final := score + deltas[key]
+		if deltas[key] > 0 {
+			ceiling := score
+			if ceiling < 20 {
+				ceiling = 20
+			}
+			if final > ceiling {
+				final = ceiling
+			}
+		}
+		for _, candidate := range methods[key] {
+			if candidate > final {
+				final = candidate
+			}
+		}
+		if final < 1 {
+			final = 1
+		}
+		result[key] = final
+	}
+	return result
+}
+
+func isAbilityKey(value string) bool {
+	for _, key := range abilityKeys {
+		if key == value {
+			return true
+		}
+	}
+	return false
+}
+
+// characterBaseArmorClass выбирает лучший метод базового КЗ (computeAC
+// клиента): доспех (формула или значение защиты с ЛВК по типу доспеха) либо
+// 10+ЛВК и set_value ac_base (Защита без доспехов, Доспех мага); щит
+// прибавляется сверху.
+func characterBaseArmorClass(input characterDerivationInput, payloads []map[string]interface{}, ctx formulaContext) int {
+	dex := ctx.AbilityMods["dex"]
+	best := 10 + dex
+	if input.Armor != nil {
+		raw := "10"
+		if input.Armor.BonusValue != nil && strings.TrimSpace(*input.Armor.BonusValue) != "" {
+			raw = *input.Armor.BonusValue
+		}
+		// Нераспознанная формула доспеха не роняет лист: остаётся 10+ЛВК.
+		if value, ok := characterFormulaInt(raw, ctx); ok {
+			best = value
+			// Формула без ЛВК — значение защиты: ЛВК добавляется по типу доспеха
+			// (средний — не больше +2, тяжёлый — без ЛВК).
+			if !strings.Contains(strings.ToLower(raw), "dex") {
+				if bonus, known := armorDexterityBonus(cardArmorDefenseType(*input.Armor), dex); known {
+					best += bonus
+				}
+			}
+		}
+	} else {
+		for _, payload := range payloads {
+			if payload["kind"] != "set_value" || payload["target"] != "ac_base" {
+				continue
+			}
+			raw, exists := payload["formula"]
+			if !exists || raw == "" {
+				raw = payload["value"]
+			}
+			if value, ok := characterFormulaInt(raw, ctx); ok && value > best {
+				best = value
+			}
+		}
+	}
+	if input.Shield != nil && input.Shield.BonusValue != nil {
+		best += characterFlatBonus(*input.Shield.BonusValue)
+	}
+	return best
+}
+
+var characterFlatBonusPattern = regexp.MustCompile(`^\+?(-?\d+)`)
+
+func characterFlatBonus(raw string) int {
+	match := characterFlatBonusPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if match == nil {
+		return 0
+	}
+	value, _ := strconv.Atoi(match[1])
+	return value
+}
+
+// characterModifierOrder — порядок не-аддитивных операций (OP_ORDER в
+// frontend/src/engine/modifiers.ts): ×, «не выше», «не ниже», затем set.
+var characterModifierOrder = map[string]int{"multiply": 0, "downgrade": 1, "upgrade": 2, "set": 3}
+
+// foldCharacterModifiers применяет modifier-payload-ы роли к базе:
+// аддитивы, затем set/multiply/upgrade/downgrade по порядку и priority.
+// Пассивные модификаторы с duration — временные и учитываются, только когда
+// пришли активным эффектом. Модификаторы с when требуют обстоятельств боя и
+// здесь не применяются.
+func foldCharacterModifiers(base int, role string, filter map[string]interface{}, passive, runtime []map[string]interface{}, ctx formulaContext) int {
+	type modifierOp struct {
+		op       string
+		value    float64
+		priority float64
+	}
+	value := float64(base)
+	var ops []modifierOp
+	collect := func(payload map[string]interface{}, temporary bool) {
+		if payload["kind"] != "modifier" || stringFieldOr(payload, "scope", "self") == "target" {
+			return
+		}
+		if !temporary && payload["duration"] != nil {
+			return
+		}
+		if when, ok := payload["when"].([]interface{}); ok && len(when) > 0 {
+			return
+		}
+		applies, _ := payload["applies_to"].(map[string]interface{})
+		roll, _ := applies["roll"].(string)
+		if roll != role && !(roll == "d20" && role == "initiative") {
+			return
+		}
+		if wanted, ok := applies["filter"].(map[string]interface{}); ok {
+			for key, expected := range wanted {
+				if filter[key] != expected {
+					return
+				}
+			}
+		}
+		op := stringFieldOr(payload, "op", "add")
+		if _, known := characterModifierOrder[op]; !known && op != "add" {
+			return
+		}
+		raw := payload["value"]
+		if text, ok := raw.(string); ok {
+			raw = strings.TrimPrefix(strings.TrimSpace(text), "+")
+		}
+		amount, ok := characterFormulaNumber(raw, ctx)
+		if !ok {
+			return
+		}
+		if op == "add" {
+			value += amount
+			return
+		}
+		priority, _ := mechanicsNumber(payload["priority"])
+		ops = append(ops, modifierOp{op: op, value: amount, priority: priority})
+	}
+	for _, payload := range passive {
+		collect(payload, false)
+	}
+	for _, payload := range runtime {
+		collect(payload, true)
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		if characterModifierOrder[ops[i].op] != characterModifierOrder[ops[j].op] {
+			return characterModifierOrder[ops[i].op] < characterModifierOrder[ops[j].op]
+		}
+		return ops[i].priority < ops[j].priority
+	})
+	for _, op := range ops {
+		switch op.op {
+		case "multiply":
+			value = math.Trunc(value * op.value)
+		case "downgrade":
+			value = math.Min(value, op.value)
+		case "upgrade":
+			value = math.Max(value, op.value)
+		default:
+			value = op.value
+		}
+	}
+	return int(math.Floor(value))
+}
+
+// characterFormulaNumber вычисляет числовую формулу снимка. Формулы с костями
+// и маркеры weapon/auto для снимка бессмысленны и пропускаются.
+func characterFormulaNumber(raw interface{}, ctx formulaContext) (float64, bool) {
+	if raw == nil || raw == "" {
+		return 0, false
+	}
+	evaluation, err := evaluateFormula(raw, ctx)
+	if err != nil || evaluation.Marker != "" || len(evaluation.Dice) > 0 {
+		return 0, false
+	}
+	return evaluation.Value, true
+}
+
+func characterFormulaInt(raw interface{}, ctx formulaContext) (int, bool) {
+	value, ok := characterFormulaNumber(raw, ctx)
+	return int(math.Floor(value)), ok
+}
+
+func characterHasSkill(skills *Properties, skill string) bool {
+	if skills == nil {
+		return false
+	}
+	label := strings.ToLower(getSkillName(skill))
+	for _, raw := range *skills {
+		value := strings.ToLower(strings.TrimSpace(raw))
+		if value == skill || value == label {
+			return true
+		}
+	}
+	return false
+}
+
+func characterResolvedChoices(character CharacterV3) map[string][]string {
+	choices := map[string][]string{}
+	if character.ResolvedChoices == nil {
+		return choices
+	}
+	for key, raw := range *character.ResolvedChoices {
+		choices[key] = stringList(raw)
+	}
+	return choices
+}
+
+// expandCharacterSources раскрывает механики источников в плоский список
+// payload-ов: выбранные пункты choice подставляются (ключ
+// `${source}:${choiceId}`, иначе голый id), уровневый гейт отсекает payload-ы
+// выше уровня. Для пассивных источников активируемые способности (active,
+// reaction, …) пропускаются — они действуют только после применения.
+func expandCharacterSources(sources []characterMechanicsSource, choices map[string][]string, level int, passiveOnly bool) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, source := range sources {
+		if passiveOnly {
+			activation, _ := source.Mechanics["activation"].(map[string]interface{})
+			if mode := stringFieldOr(activation, "mode", "passive"); mode != "passive" {
+				continue
+			}
+		}
+		for _, payload := range characterSourcePayloads(source.Mechanics) {
+			result = expandCharacterPayload(result, payload, source.Key, choices, level, 0)
+		}
+	}
+	return result
+}
+
+// characterSourcePayloads — payload-ы механики: сама механика-payload (строка
+// active_effects), kind-узлы интеракций и результаты auto-интеракций.
+func characterSourcePayloads(mechanics JSONMap) []map[string]interface{} {
+	if mechanics == nil {
+		return nil
+	}
+	if kind, ok := mechanics["kind"].(string); ok && kind != "" {
+		return []map[string]interface{}{mechanics}
+	}
+	var result []map[string]interface{}
+	for _, interaction := range mechanicsInteractions(mechanics) {
+		if _, ok := interaction["kind"].(string); ok {
+			result = append(result, interaction)
+			continue
+		}
+		if resolution := stringFieldOr(interaction, "resolution", "auto"); resolution != "auto" {
+			continue
+		}
+		raw, exists := interaction["result"]
+		if !exists {
+			raw = interaction["results"]
+		}
+		result = append(result, mechanicsPayloadList(raw)...)
+	}
+	return result
+}
+
+func expandCharacterPayload(result []map[string]interface{}, payload map[string]interface{}, sourceKey string, choices map[string][]string, level, depth int) []map[string]interface{} {
+	if payload["kind"] != "choice" {
+		if gate, exists := payload["level_gate"]; exists || payload["min_level"] != nil {
+			if !exists {
+				gate = payload["min_level"]
+			}
+			if required, ok := mechanicsNumber(gate); ok && level < int(required) {
+				return result
+			}
+		}
+		return append(result, payload)
+	}
+	if depth >= characterChoiceMaxDepth {
+		return result
+	}
+	choiceID := stringFieldOr(payload, "id", "choice")
+	selected, ok := choices[sourceKey+":"+choiceID]
+	if !ok || sourceKey == "" {
+		selected = choices[choiceID]
+	}
+	for _, selectedPayload := range selectedCharacterChoicePayloads(payload, selected) {
+		result = expandCharacterPayload(result, selectedPayload, sourceKey, choices, level, depth+1)
+	}
+	return result
+}
+
+// selectedCharacterChoicePayloads — selectedChoicePayloads клиента: пункт с
+// grants отдаёт их, иначе выбранное значение подставляется в шаблон
+// apply/grant (в поле value_into, по умолчанию value).
+func selectedCharacterChoicePayloads(choice map[string]interface{}, selected []string) []map[string]interface{} {
+	options, _ := choice["options"].(map[string]interface{})
+	items := mechanicsPayloadList(options["items"])
+	template, _ := choice["apply"].(map[string]interface{})
+	if template == nil {
+		template, _ = choice["grant"].(map[string]interface{})
+	}
+	var result []map[string]interface{}
+	for _, value := range selected {
+		var grants []map[string]interface{}
+		found := false
+		for _, item := range items {
+			if id, _ := item["id"].(string); id == value {
+				if _, ok := item["grants"].([]interface{}); ok {
+					grants = mechanicsPayloadList(item["grants"])
+					found = true
+				}
+				break
+			}
+		}
+		if found {
+			result = append(result, grants...)
+			continue
+		}
+		if template == nil || template["kind"] == nil {
+			continue
+		}
+		field := stringFieldOr(template, "value_into", "value")
+		projected := make(map[string]interface{}, len(template))
+		for key, raw := range template {
+			if key != "value_into" {
+				projected[key] = raw
+			}
+		}
+		projected[field] = value
+		result = append(result, projected)
+	}
+	return result
+}
+
+// characterItemGate — itemGate клиента (frontend/src/character/attunement.ts):
+// механика предмета действует, пока он надет (по умолчанию), носится
+// (while: carried) или настроен (while: attuned); requires_attunement без
+// настройки глушит предмет в любом случае.
+type characterItemGate struct {
+	equipped map[string]bool
+	carried  map[string]bool
+	attuned  map[string]bool
+}
+
+func newCharacterItemGate(character CharacterV3) characterItemGate {
+	gate := characterItemGate{equipped: map[string]bool{}, carried: map[string]bool{}, attuned: map[string]bool{}}
+	for _, id := range characterEquippedCardIDs(character) {
+		gate.equipped[id] = true
+		gate.carried[id] = true
+	}
+	if character.InventoryItems != nil {
+		for _, row := range *character.InventoryItems {
+			if row.Qty > 0 {
+				gate.carried[row.CardID] = true
+			}
+		}
+	}
+	for _, id := range characterAttunedCardIDs(character) {
+		gate.attuned[id] = true
+	}
+	return gate
+}
+
+func (g characterItemGate) applies(card Card) bool {
+	if card.Mechanics == nil {
+		return false
+	}
+	id := card.ID.String()
+	if card.RequiresAttunement != nil && *card.RequiresAttunement && !g.attuned[id] {
+		return false
+	}
+	mechanics := *card.Mechanics
+	activation, _ := mechanics["activation"].(map[string]interface{})
+	while := stringField(activation, "while")
+	if while == "" {
+		while = stringField(mechanics, "while")
+	}
+	switch strings.ToLower(while) {
+	case "carried":
+		return g.carried[id]
+	case "attuned":
+		return g.attuned[id]
+	default:
+		return g.equipped[id]
+	}
+}
+
+// characterEquippedCardIDs — id карточек в слотах экипировки, по слотам в
+// алфавитном порядке (порядок источников не должен зависеть от map).
+func characterEquippedCardIDs(character CharacterV3) []string {
+	if character.Equipment == nil {
+		return nil
+	}
+	slots := make([]string, 0, len(*character.Equipment))
+	for slot := range *character.Equipment {
+		slots = append(slots, slot)
+	}
+	sort.Strings(slots)
+	var ids []string
+	for _, slot := range slots {
+		if id, ok := (*character.Equipment)[slot].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// characterWornDefense находит доспех (слот body) и щит (off_hand, затем
+// main_hand). Одежда — не доспех: тег cloth/clothing или защита без ЛВК
+// не выше 10 (isNonArmorBody клиента).
+func characterWornDefense(character CharacterV3, cards map[string]Card) (armor, shield *Card) {
+	if character.Equipment == nil {
+		return nil, nil
+	}
+	equipment := *character.Equipment
+	if id, ok := equipment["body"].(string); ok {
+		if card, found := cards[id]; found && !characterIsNonArmorBody(card) {
+			armor = &card
+		}
+	}
+	for _, slot := range []string{"off_hand", "main_hand"} {
+		id, _ := equipment[slot].(string)
+		card, found := cards[id]
+		if !found {
+			continue
+		}
+		if cardIsShield(card) {
+			shield = &card
+			break
+		}
+	}
+	return armor, shield
+}
+
+func characterIsNonArmorBody(card Card) bool {
+	if card.Properties != nil {
+		for _, property := range *card.Properties {
+			if value := strings.ToLower(property); value == "cloth" || value == "clothing" {
+				return true
+			}
+		}
+	}
+	if card.BonusValue == nil || strings.TrimSpace(*card.BonusValue) == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(*card.BonusValue), "dex") {
+		return false
+	}
+	return characterFlatBonus(*card.BonusValue) <= 10
+}
+
+// loadCharacterDerivationInput собирает источники вывода: сущности сборки,
+// предметы экипировки и инвентаря, active_effects и состояния из них
+// (эффекты COND-<id> с раскрытием includes).
+func loadCharacterDerivationInput(db *gorm.DB, character CharacterV3) (characterDerivationInput, error) {
+	bundle, err := loadCharacterFeatureBundle(db, character)
+	if err != nil {
+		return characterDerivationInput{Character: character}, err
+	}
+	return characterBundleDerivationInput(db, character, bundle)
+}
+
+// characterBundleDerivationInput — loadCharacterDerivationInput по уже
+// загруженным сущностям сборки.
+func characterBundleDerivationInput(db *gorm.DB, character CharacterV3, bundle characterFeatureBundle) (characterDerivationInput, error) {
+	input := characterDerivationInput{Character: character, RaceSpeed: 30}
+	var err error
+	if input.Actor, err = characterBundleFormulaActor(db, character, bundle); err != nil {
+		return input, err
+	}
+	if bundle.Race != nil && bundle.Race.Speed != nil {
+		input.RaceSpeed = *bundle.Race.Speed
+	}
+	if bundle.Class != nil && bundle.Class.HitDie != nil {
+		input.HitDie = *bundle.Class.HitDie
+	}
+	for _, entry := range bundle.Classes {
+		die := ""
+		if entry.Class.HitDie != nil {
+			die = *entry.Class.HitDie
+		}
+		input.ClassHitDice = append(input.ClassHitDice, characterClassHitDie{HitDie: die, Levels: entry.Level})
+	}
+	for index, effect := range bundle.Effects {
+		if effect.Mechanics != nil {
+			key := bundle.EffectOrigins[index].sourceKey(effect.ID.String())
+			input.Passive = append(input.Passive, characterMechanicsSource{Key: key, Name: effect.Name, Mechanics: *effect.Mechanics})
+		}
+	}
+	for index, action := range bundle.Actions {
+		if action.Mechanics != nil {
+			key := bundle.ActionOrigins[index].sourceKey(action.ID.String())
+			input.Passive = append(input.Passive, characterMechanicsSource{Key: key, Name: action.Name, Mechanics: *action.Mechanics})
+		}
+	}
+
+	cardIDs := characterEquippedCardIDs(character)
+	if character.InventoryItems != nil {
+		for _, row := range *character.InventoryItems {
+			cardIDs = append(cardIDs, row.CardID)
+		}
+	}
+	ids := Properties(cardIDs)
+	cards := map[string]Card{}
+	if parsed := validUUIDs(&ids); len(parsed) > 0 {
+		var rows []Card
+		if err := db.Where("id IN ?", parsed).Find(&rows).Error; err != nil {
+			return input, err
+		}
+		for _, card := range rows {
+			cards[card.ID.String()] = card
+		}
+	}
+	gate := newCharacterItemGate(character)
+	seen := map[string]bool{}
+	for _, id := range cardIDs {
+		card, ok := cards[id]
+		if !ok || seen[id] || !gate.applies(card) {
+			continue
+		}
+		seen[id] = true
+		input.Passive = append(input.Passive, characterMechanicsSource{Key: id, Name: card.Name, Mechanics: *card.Mechanics})
+	}
+	input.Armor, input.Shield = characterWornDefense(character, cards)
+
+	var conditions []string
+	if character.ActiveEffects != nil {
+		for _, row := range *character.ActiveEffects {
+			input.Runtime = append(input.Runtime, characterMechanicsSource{Name: row.Name, Mechanics: row.Mechanics})
+			for _, payload := range characterSourcePayloads(row.Mechanics) {
+				if value, ok := payload["value"].(string); ok && payload["kind"] == "condition" && payload["op"] != "remove" && value != "" {
+					conditions = append(conditions, value)
+				}
+			}
+		}
+	}
+	conditionSources, err := loadCharacterConditionSources(db, conditions)
+	if err != nil {
+		return input, err
+	}
+	input.Runtime = append(input.Runtime, conditionSources...)
+	return input, nil
+}
+
+// loadCharacterConditionSources загружает механики состояний: каждое
+// состояние — эффект COND-<id>, его includes раскрываются транзитивно (без
+// циклов). Экземпляр состояния — один источник: повторы (уровни истощения)
+// складываются.
+func loadCharacterConditionSources(db *gorm.DB, conditions []string) ([]characterMechanicsSource, error) {
+	definitions := map[string]*Effect{}
+	pending := append([]string{}, conditions...)
+	for len(pending) > 0 {
+		var missing []string
+		for _, id := range pending {
+			if _, known := definitions[id]; !known {
+				definitions[id] = nil
+				missing = append(missing, "COND-"+id)
+			}
+		}
+		pending = nil
+		if len(missing) == 0 {
+			break
+		}
+		var effects []Effect
+		if err := db.Where("card_number IN ?", missing).Find(&effects).Error; err != nil {
+			return nil, err
+		}
+		for index := range effects {
+			id := strings.TrimPrefix(effects[index].CardNumber, "COND-")
+			definitions[id] = &effects[index]
+			if effects[index].Mechanics != nil {
+				pending = append(pending, stringList((*effects[index].Mechanics)["includes"])...)
+			}
+		}
+	}
+
+	var result []characterMechanicsSource
+	var expand func(id string, seen map[string]bool)
+	expand = func(id string, seen map[string]bool) {
+		definition := definitions[id]
+		if seen[id] || definition == nil || definition.Mechanics == nil {
+			return
+		}
+		seen[id] = true
+		result = append(result, characterMechanicsSource{Name: definition.Name, Mechanics: *definition.Mechanics})
+		for _, included := range stringList((*definition.Mechanics)["includes"]) {
+			expand(included, seen)
+		}
+	}
+	for _, id := range conditions {
+		expand(id, map[string]bool{})
+	}
+	return result, nil
+}
+
+// RecomputeCharacterV3Request — dry_run только сверяет снимок, не записывая.
+type RecomputeCharacterV3Request struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// RecomputeCharacterV3Response — выведенный и хранимый снимки, расхождения
+// между ними и итоговые характеристики вывода. Character — лист после записи
+// (без dry_run).
+type RecomputeCharacterV3Response struct {
+	DryRun    bool                  `json:"dry_run"`
+	Derived   CharacterDerivedStats `json:"derived"`
+	Stored    CharacterDerivedStats `json:"stored"`
+	Drift     []CharacterStatDrift  `json:"drift"`
+	Abilities map[string]int        `json:"abilities"`
+	Character *CharacterV3          `json:"character,omitempty"`
+
+	// WeaponMasteries — виды оружия, выбранные для искусности.
+	WeaponMasteries []string `json:"weapon_masteries"`
+}
+
+// RecomputeCharacterV3 пересчитывает снимок листа на сервере. dry_run
+// (читатель листа) только сообщает о расхождениях — так ловятся устаревшие и
+// подправленные вручную листы; без dry_run (владелец) снимок перезаписывается,
+// текущие хиты обрезаются новым максимумом.
+func (cc *CharacterV3Controller) RecomputeCharacterV3(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	var req RecomputeCharacterV3Request
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+			return
+		}
+	}
+	if c.Query("dry_run") == "true" || c.Query("dry_run") == "1" {
+		req.DryRun = true
+	}
+
+	access := characterV3Write
+	if req.DryRun {
+		access = characterV3Read
+	}
+	character, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, access)
+	if !allowed {
+		return
+	}
+
+	if req.DryRun {
+		input, err := loadCharacterDerivationInput(cc.db, *character)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки сущностей персонажа", "details": err.Error()})
+			return
+		}
+		derivation := deriveCharacterStats(input)
+		stored := storedCharacterStats(*character)
+		c.JSON(http.StatusOK, RecomputeCharacterV3Response{
+			DryRun: true, Derived: derivation.Stats, Stored: stored,
+			Drift: stored.drift(derivation.Stats), Abilities: derivation.Abilities,
+			WeaponMasteries: characterWeaponMasteries(derivation),
+		})
+		return
+	}
+
+	var response RecomputeCharacterV3Response
+	var full CharacterV3
+	txErr := cc.db.Transaction(func(tx *gorm.DB) error {
+		var locked CharacterV3
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCharacterV3OwnerChanged
+			}
+			return err
+		}
+		input, err := loadCharacterDerivationInput(tx, locked)
+		if err != nil {
+			return err
+		}
+		derivation := deriveCharacterStats(input)
+		stored := storedCharacterStats(locked)
+		response = RecomputeCharacterV3Response{
+			Derived: derivation.Stats, Stored: stored,
+			Drift: stored.drift(derivation.Stats), Abilities: derivation.Abilities,
+			WeaponMasteries: characterWeaponMasteries(derivation),
+		}
+		if len(response.Drift) == 0 {
+			return tx.Preload("User").Preload("Group").First(&full, locked.ID).Error
+		}
+		currentHP := locked.CurrentHP
+		if currentHP > derivation.Stats.MaxHP {
+			currentHP = derivation.Stats.MaxHP
+		}
+		result := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			Updates(map[string]interface{}{
+				"max_hp":             derivation.Stats.MaxHP,
+				"current_hp":         currentHP,
+				"speed":              derivation.Stats.Speed,
+				"proficiency_bonus":  derivation.Stats.ProficiencyBonus,
+				"armor_class":        derivation.Stats.ArmorClass,
+				"initiative_bonus":   derivation.Stats.InitiativeBonus,
+				"passive_perception": derivation.Stats.PassivePerception,
+				"runtime_revision":   locked.RuntimeRevision + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCharacterV3OwnerChanged
+		}
+		return tx.Preload("User").Preload("Group").First(&full, locked.ID).Error
+	})
+	if errors.Is(txErr, errCharacterV3OwnerChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
+		return
+	}
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка пересчёта персонажа", "details": txErr.Error()})
+		return
+	}
+	full.AccessMode = characterV3AccessOwner
+	response.Character = &full
+	c.JSON(http.StatusOK, response)
+}
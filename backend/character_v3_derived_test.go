@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func derivationTestCharacter(t *testing.T, level int, abilities, choices string) CharacterV3 {
+	t.Helper()
+	scores := JSONMap(mustMechanicsJSON(t, abilities))
+	resolved := JSONMap(mustMechanicsJSON(t, choices))
+	character := CharacterV3{ID: uuid.New(), Name: "Тест", Level: level, Abilities: &scores, ResolvedChoices: &resolved}
+	return character
+}
+
+func derivationTestInput(character CharacterV3) characterDerivationInput {
+	return characterDerivationInput{
+		Character: character,
+		Actor:     mechanicsActorFromCharacter(character),
+		RaceSpeed: 30,
+	}
+}
+
+func TestDeriveCharacterStatsArmoredFighter(t *testing.T) {
+	featID := uuid.New().String()
+	effectID := uuid.New().String()
+	character := derivationTestCharacter(t, 5,
+		`{"str":16,"dex":14,"con":14,"int":10,"wis":12,"cha":8}`,
+		`{"feat:`+featID+`:`+effectID+`:asi":["con"]}`)
+	proficiencies := Properties{"Восприятие", "athletics"}
+	character.SkillProficiencies = &proficiencies
+
+	input := derivationTestInput(character)
+	input.HitDie = "d10"
+	input.Passive = []characterMechanicsSource{
+		{Key: "feat:" + featID + ":" + effectID, Mechanics: mustMechanicsJSON(t,
+			`{"activation":{"mode":"passive"},"effects":[{"resolution":"auto","result":[{"kind":"choice","id":"asi","apply":{"kind":"grant_ability_score","amount":2}}]}]}`)},
+		{Mechanics: mustMechanicsJSON(t,
+			`{"effects":[{"resolution":"auto","result":[{"kind":"modifier","applies_to":{"roll":"max_hp"},"value":"2*self_level"}]}]}`)},
+		{Mechanics: mustMechanicsJSON(t,
+			`{"effects":[{"resolution":"auto","result":[{"kind":"modifier","applies_to":{"roll":"ac","filter":{"wearingArmor":true}},"value":"+1"},{"kind":"grant_speed","mode":"walk","value":5},{"kind":"grant_speed","mode":"fly","value":60}]}]}`)},
+		// Активируемая способность не входит в снимок, пока её не применили.
+		{Mechanics: mustMechanicsJSON(t,
+			`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"modifier","applies_to":{"roll":"speed"},"value":"10"}]}]}`)},
+	}
+	armor := "16"
+	shield := "+2"
+	input.Armor = &Card{Name: "Кольчуга", BonusValue: &armor}
+	input.Shield = &Card{Name: "Щит", BonusValue: &shield}
+
+	derivation := deriveCharacterStats(input)
+	want := CharacterDerivedStats{
+		MaxHP: 59, ArmorClass: 19, InitiativeBonus: 2,
+		PassivePerception: 14, ProficiencyBonus: 3, Speed: 35,
+	}
+	if derivation.Stats != want {
+		t.Fatalf("want %+v, got %+v", want, derivation.Stats)
+	}
+	if derivation.Abilities["con"] != 16 {
+		t.Fatalf("ability choice must apply, got %v", derivation.Abilities)
+	}
+
+	input.Runtime = []characterMechanicsSource{{Mechanics: mustMechanicsJSON(t,
+		`{"kind":"modifier","applies_to":{"roll":"speed"},"op":"set","value":"0"}`)}}
+	if speed := deriveCharacterStats(input).Stats.Speed; speed != 0 {
+		t.Fatalf("runtime set must zero the speed, got %d", speed)
+	}
+}
+
+func TestDeriveCharacterStatsUnarmoredMethods(t *testing.T) {
+	character := derivationTestCharacter(t, 2,
+		`{"str":10,"dex":16,"con":12,"int":10,"wis":14,"cha":10}`, `{}`)
+	input := derivationTestInput(character)
+	input.HitDie = "1d8"
+	input.Passive = []characterMechanicsSource{
+		{Mechanics: mustMechanicsJSON(t,
+			`{"effects":[{"resolution":"auto","result":[{"kind":"set_value","target":"ac_base","formula":"10 + dex + wis"},{"kind":"modifier","applies_to":{"roll":"ac","filter":{"wearingArmor":true}},"value":"1"},{"kind":"value_method","target":"str","formula":"19"},{"kind":"grant_ability_score","ability":"dex","amount":2,"level_gate":10}]}]}`)},
+	}
+
+	derivation := deriveCharacterStats(input)
+	if derivation.Stats.ArmorClass != 15 || derivation.Abilities["str"] != 19 || derivation.Abilities["dex"] != 16 {
+		t.Fatalf("unexpected derivation: %+v", derivation)
+	}
+	if derivation.Stats.MaxHP != 15 || derivation.Stats.PassivePerception != 12 {
+		t.Fatalf("unexpected hp/perception: %+v", derivation.Stats)
+	}
+
+	clothing := "10"
+	if !characterIsNonArmorBody(Card{BonusValue: &clothing}) {
+		t.Fatal("flat 10 body item must not count as armor")
+	}
+	leather := "11 + dex"
+	if characterIsNonArmorBody(Card{BonusValue: &leather}) {
+		t.Fatal("dex-scaled body item is armor")
+	}
+}
+
+func TestCharacterDerivedStatsDrift(t *testing.T) {
+	stored := CharacterDerivedStats{MaxHP: 40, ArmorClass: 18, InitiativeBonus: 2, PassivePerception: 14, ProficiencyBonus: 3, Speed: 30}
+	derived := stored
+	if drift := stored.drift(derived); drift == nil || len(drift) != 0 {
+		t.Fatalf("consistent sheet must report an empty drift list, got %v", drift)
+	}
+	derived.MaxHP = 44
+	derived.Speed = 35
+	drift := stored.drift(derived)
+	if len(drift) != 2 || drift[0] != (CharacterStatDrift{Field: "max_hp", Stored: 40, Derived: 44}) || drift[1].Field != "speed" {
+		t.Fatalf("unexpected drift: %v", drift)
+	}
+}
+
+func TestCharacterItemGate(t *testing.T) {
+	ring, cloak, boots := uuid.New(), uuid.New(), uuid.New()
+	equipment := JSONMap{"ring_1": ring.String(), "cloak": cloak.String()}
+	inventory := InventoryItemRows{{CardID: boots.String(), Qty: 1}, {CardID: ring.String(), Attuned: true}}
+	turnState := JSONMap{"attuned_ids": []interface{}{cloak.String()}}
+	gate := newCharacterItemGate(CharacterV3{Equipment: &equipment, InventoryItems: &inventory, TurnState: &turnState})
+
+	required := true
+	passive := JSONMap(map[string]interface{}{"activation": map[string]interface{}{"mode": "passive"}})
+	carried := JSONMap(map[string]interface{}{"while": "carried"})
+	if !gate.applies(Card{ID: ring, RequiresAttunement: &required, Mechanics: &passive}) {
+		t.Fatal("attuned equipped ring must apply")
+	}
+	if gate.applies(Card{ID: cloak, RequiresAttunement: &required, Mechanics: &passive}) {
+		t.Fatal("item requiring attunement must stay silent without it")
+	}
+	if gate.applies(Card{ID: boots, Mechanics: &passive}) || !gate.applies(Card{ID: boots, Mechanics: &carried}) {
+		t.Fatal("carried items apply only with while: carried")
+	}
+}
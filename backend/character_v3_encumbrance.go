@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Состояния нагрузки. Вариантные encumbered/heavily_encumbered считаются
+// только в группах с variant_encumbrance; сверх грузоподъёмности предмет
+// можно лишь толкать или тащить (скорость 5 фт.), сверх удвоенной — нельзя
+// сдвинуться.
+const (
+	encumbranceNone         = "unencumbered"
+	encumbranceEncumbered   = "encumbered"
+	encumbranceHeavily      = "heavily_encumbered"
+	encumbranceOverCapacity = "over_capacity"
+	encumbranceImmobile     = "immobile"
+)
+
+// characterCoinsPerPound — 50 монет любого номинала весят фунт.
+const characterCoinsPerPound = 50
+
+// CharacterCarriedContainer — контейнер инвентаря и вес его содержимого
+// вместе с вложенными контейнерами.
+type CharacterCarriedContainer struct {
+	CardID         string  `json:"card_id"`
+	Name           string  `json:"name"`
+	ContentsWeight float64 `json:"contents_weight"`
+}
+
+// CharacterEncumbrance — переносимый вес и нагрузка персонажа. Пороги
+// EncumberedAt/HeavilyEncumberedAt есть только у вариантных правил;
+// Disadvantage — помеха на проверки, атаки и спасброски Силы, Ловкости и
+// Телосложения у сильно нагруженного.
+type CharacterEncumbrance struct {
+	CharacterID         string                      `json:"character_id"`
+	Rules               string                      `json:"rules"`
+	ItemsWeight         float64                     `json:"items_weight"`
+	EquippedWeight      float64                     `json:"equipped_weight"`
+	CurrencyWeight      float64                     `json:"currency_weight"`
+	CarriedWeight       float64                     `json:"carried_weight"`
+	Strength            int                         `json:"strength"`
+	CarrySize           int                         `json:"carry_size"`
+	Capacity            int                         `json:"capacity"`
+	PushDragLift        int                         `json:"push_drag_lift"`
+	EncumberedAt        *int                        `json:"encumbered_at,omitempty"`
+	HeavilyEncumberedAt *int                        `json:"heavily_encumbered_at,omitempty"`
+	Status              string                      `json:"status"`
+	BaseSpeed           int                         `json:"base_speed"`
+	SpeedPenalty        int                         `json:"speed_penalty"`
+	Speed               int                         `json:"speed"`
+	Disadvantage        bool                        `json:"disadvantage"`
+	Containers          []CharacterCarriedContainer `json:"containers"`
+}
+
+// characterSizeCategory — sizeToNumber клиента: Крошечный 0 … Громадный 5,
+// «Средний или Маленький» и неизвестное — Средний.
+func characterSizeCategory(size string) int {
+	value := strings.ToLower(size)
+	switch {
+	case strings.Contains(value, "громадн") || strings.Contains(value, "gargantuan"):
+		return 5
+	case strings.Contains(value, "огромн") || strings.Contains(value, "huge"):
+		return 4
+	case strings.Contains(value, "больш") || strings.Contains(value, "large"):
+		return 3
+	case strings.Contains(value, "средн") || strings.Contains(value, "medium"):
+		return 2
+	case strings.Contains(value, "мал") || strings.Contains(value, "small"):
+		return 1
+	case strings.Contains(value, "крошечн") || strings.Contains(value, "tiny"):
+		return 0
+	}
+	return 2
+}
+
+// characterCarrySizeMultiplier — carrySizeMultiplier клиента: Крошечный ×0.5,
+// Маленький и Средний ×1, дальше ×2 за категорию.
+func characterCarrySizeMultiplier(size int) float64 {
+	if size <= 0 {
+		return 0.5
+	}
+	if size <= 2 {
+		return 1
+	}
+	return math.Pow(2, float64(size-2))
+}
+
+// characterCarrySize — категория размера для груза: размер вида (подвид
+// важнее), модификаторы size и поверх — carry (Мощное телосложение считает
+// груз на категорию больше, не меняя боевой размер).
+func characterCarrySize(bundle characterFeatureBundle, derivation CharacterDerivation) int {
+	size := 2
+	for _, race := range []*Race{bundle.Race, bundle.Subrace} {
+		if race != nil && race.Size != nil && strings.TrimSpace(*race.Size) != "" {
+			size = characterSizeCategory(*race.Size)
+		}
+	}
+	size = foldCharacterModifiers(size, "size", nil, derivation.passive, derivation.runtime, derivation.formula)
+	size = foldCharacterModifiers(size, "carry", nil, derivation.passive, derivation.runtime, derivation.formula)
+	if size < 0 {
+		return 0
+	}
+	return size
+}
+
+// characterCurrencyCoins — число монет всех номиналов в кошельке.
+func characterCurrencyCoins(currency *JSONMap) int {
+	if currency == nil {
+		return 0
+	}
+	coins := 0
+	for _, raw := range *currency {
+		if count, ok := mechanicsNumber(raw); ok && count > 0 {
+			coins += int(count)
+		}
+	}
+	return coins
+}
+
+func roundCharacterWeight(weight float64) float64 {
+	return math.Round(weight*100) / 100
+}
+
+// characterEncumbrance считает переносимый вес — строки инвентаря (включая
+// содержимое контейнеров на любой глубине), надетые предметы и монеты — и
+// сравнивает его с грузоподъёмностью Сила × 15 × множитель размера груза.
+// variant — вариантные правила группы: сверх 5 × Сила × множитель скорость
+// −10 фт., сверх 10 × — −20 фт. и помеха. cards — карточки по id; предметы
+// без карточки или веса ничего не весят.
+func characterEncumbrance(character CharacterV3, cards map[string]Card, strength, carrySize, speed int, variant bool) CharacterEncumbrance {
+	weightOf := func(cardID string) float64 {
+		if card, ok := cards[cardID]; ok && card.Weight != nil && *card.Weight > 0 {
+			return *card.Weight
+		}
+		return 0
+	}
+	result := CharacterEncumbrance{
+		CharacterID: character.ID.String(), Rules: "standard",
+		Strength: strength, CarrySize: carrySize, BaseSpeed: speed,
+		Status: encumbranceNone, Containers: []CharacterCarriedContainer{},
+	}
+
+	var rows InventoryItemRows
+	if character.InventoryItems != nil {
+		rows = *character.InventoryItems
+	}
+	contents := map[string][]InventoryItemRow{}
+	carried := map[string]bool{}
+	for _, row := range rows {
+		if row.Qty <= 0 {
+			continue
+		}
+		carried[row.CardID] = true
+		result.ItemsWeight += weightOf(row.CardID) * float64(row.Qty)
+		if row.ContainerID != "" {
+			contents[row.ContainerID] = append(contents[row.ContainerID], row)
+		}
+	}
+	// Двуручное оружие занимает обе руки, но весит один раз. Надетое, у которого
+	// есть строка инвентаря, уже посчитано в ней (totalWeight клиента).
+	equipped := map[string]bool{}
+	for _, id := range characterEquippedCardIDs(character) {
+		if !equipped[id] && !carried[id] {
+			equipped[id] = true
+			result.EquippedWeight += weightOf(id)
+		}
+	}
+	result.CurrencyWeight = float64(characterCurrencyCoins(character.Currency)) / characterCoinsPerPound
+
+	// Вес контейнера с вложенными — containerWeight клиента, с защитой от циклов.
+	var containerWeight func(containerID string, seen map[string]bool) float64
+	containerWeight = func(containerID string, seen map[string]bool) float64 {
+		if seen[containerID] {
+			return 0
+		}
+		seen[containerID] = true
+		total := 0.0
+		for _, row := range contents[containerID] {
+			total += weightOf(row.CardID)*float64(row.Qty) + containerWeight(row.CardID, seen)
+		}
+		return total
+	}
+	containerIDs := make([]string, 0, len(contents))
+	for id := range contents {
+		containerIDs = append(containerIDs, id)
+	}
+	sort.Strings(containerIDs)
+	for _, id := range containerIDs {
+		container := CharacterCarriedContainer{CardID: id, ContentsWeight: roundCharacterWeight(containerWeight(id, map[string]bool{}))}
+		if card, ok := cards[id]; ok {
+			container.Name = card.Name
+		}
+		result.Containers = append(result.Containers, container)
+	}
+
+	result.ItemsWeight = roundCharacterWeight(result.ItemsWeight)
+	result.EquippedWeight = roundCharacterWeight(result.EquippedWeight)
+	result.CurrencyWeight = roundCharacterWeight(result.CurrencyWeight)
+	result.CarriedWeight = roundCharacterWeight(result.ItemsWeight + result.EquippedWeight + result.CurrencyWeight)
+
+	multiplier := characterCarrySizeMultiplier(carrySize)
+	result.Capacity = int(math.Floor(float64(strength) * 15 * multiplier))
+	result.PushDragLift = result.Capacity * 2
+	weight := result.CarriedWeight
+	if variant {
+		result.Rules = "variant"
+		encumbered := int(math.Floor(float64(strength) * 5 * multiplier))
+		heavily := int(math.Floor(float64(strength) * 10 * multiplier))
+		result.EncumberedAt, result.HeavilyEncumberedAt = &encumbered, &heavily
+		switch {
+		case weight > float64(heavily):
+			result.Status, result.SpeedPenalty, result.Disadvantage = encumbranceHeavily, 20, true
+		case weight > float64(encumbered):
+			result.Status, result.SpeedPenalty = encumbranceEncumbered, 10
+		}
+	}
+	switch {
+	case weight > float64(result.PushDragLift):
+		result.Status, result.SpeedPenalty = encumbranceImmobile, speed
+	case weight > float64(result.Capacity):
+		result.Status, result.SpeedPenalty = encumbranceOverCapacity, max(0, speed-5)
+	}
+	result.SpeedPenalty = min(result.SpeedPenalty, speed)
+	result.Speed = max(0, speed-result.SpeedPenalty)
+	return result
+}
+
+// GetCharacterV3Encumbrance отдаёт переносимый вес и нагрузку персонажа по
+// правилам его группы.
+func (cc *CharacterV3Controller) GetCharacterV3Encumbrance(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	character, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Read)
+	if !allowed {
+		return
+	}
+
+	bundle, err := loadCharacterFeatureBundle(cc.db, *character)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки сущностей персонажа", "details": err.Error()})
+		return
+	}
+	input, err := characterBundleDerivationInput(cc.db, *character, bundle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки сущностей персонажа", "details": err.Error()})
+		return
+	}
+	derivation := deriveCharacterStats(input)
+
+	ids := characterEquippedCardIDs(*character)
+	if character.InventoryItems != nil {
+		for _, row := range *character.InventoryItems {
+			ids = append(ids, row.CardID)
+			if row.ContainerID != "" {
+				ids = append(ids, row.ContainerID)
+			}
+		}
+	}
+	cards := map[string]Card{}
+	raw := Properties(ids)
+	if parsed := validUUIDs(&raw); len(parsed) > 0 {
+		var rows []Card
+		if err := cc.db.Where("id IN ?", parsed).Find(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки предметов", "details": err.Error()})
+			return
+		}
+		for _, card := range rows {
+			cards[card.ID.String()] = card
+		}
+	}
+
+	variant := false
+	if character.GroupID != nil {
+		var group Group
+		err := cc.db.Select("id", "variant_encumbrance").First(&group, "id = ?", *character.GroupID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки группы", "details": err.Error()})
+			return
+		}
+		variant = err == nil && group.VariantEncumbrance
+	}
+
+	c.JSON(http.StatusOK, characterEncumbrance(*character, cards, derivation.Abilities["str"],
+		characterCarrySize(bundle, derivation), derivation.Stats.Speed, variant))
+}
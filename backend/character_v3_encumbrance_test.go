@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCharacterSizeCategory(t *testing.T) {
+	for size, want := range map[string]int{
+		"Крошечный": 0, "Маленький": 1, "Средний": 2, "Средний или Маленький": 2,
+		"Большой": 3, "Огромный": 4, "Громадный": 5, "": 2, "Large": 3,
+	} {
+		if got := characterSizeCategory(size); got != want {
+			t.Fatalf("characterSizeCategory(%q) = %d, want %d", size, got, want)
+		}
+	}
+	if characterCarrySizeMultiplier(0) != 0.5 || characterCarrySizeMultiplier(1) != 1 || characterCarrySizeMultiplier(4) != 4 {
+		t.Fatal("unexpected carry size multipliers")
+	}
+}
+
+func TestCharacterEncumbranceWeight(t *testing.T) {
+	backpack, pouch, rope, gem, sword := uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+	weight := func(value float64) *float64 { return &value }
+	cards := map[string]Card{
+		backpack: {Name: "Рюкзак", Weight: weight(5)},
+		pouch:    {Name: "Кошель", Weight: weight(1)},
+		rope:     {Name: "Верёвка", Weight: weight(10)},
+		gem:      {Name: "Самоцвет"},
+		sword:    {Name: "Двуручный меч", Weight: weight(6)},
+	}
+	items := InventoryItemRows{
+		{CardID: backpack, Qty: 1},
+		{CardID: rope, Qty: 2, ContainerID: backpack},
+		{CardID: pouch, Qty: 1, ContainerID: backpack},
+		{CardID: gem, Qty: 3, ContainerID: pouch},
+		{CardID: rope, Qty: 0},
+	}
+	equipment := JSONMap{"main_hand": sword, "off_hand": sword}
+	currency := JSONMap{"gp": float64(120), "sp": float64(30)}
+	character := CharacterV3{ID: uuid.New(), InventoryItems: &items, Equipment: &equipment, Currency: &currency}
+
+	result := characterEncumbrance(character, cards, 10, 2, 30, false)
+	if result.ItemsWeight != 26 || result.EquippedWeight != 6 || result.CurrencyWeight != 3 || result.CarriedWeight != 35 {
+		t.Fatalf("unexpected weights: %+v", result)
+	}
+	if result.Capacity != 150 || result.PushDragLift != 300 || result.Status != encumbranceNone || result.Speed != 30 {
+		t.Fatalf("standard rules must leave the character unencumbered: %+v", result)
+	}
+	if len(result.Containers) != 2 {
+		t.Fatalf("want backpack and pouch, got %+v", result.Containers)
+	}
+	for _, container := range result.Containers {
+		if container.CardID == backpack && container.ContentsWeight != 21 {
+			t.Fatalf("backpack contents must include the nested pouch: %+v", container)
+		}
+	}
+
+	// Надетый меч, который лежит и строкой инвентаря, весит один раз.
+	carried := append(append(InventoryItemRows{}, items...), InventoryItemRow{CardID: sword, Qty: 1})
+	character = CharacterV3{ID: uuid.New(), InventoryItems: &carried, Equipment: &equipment, Currency: &currency}
+	if result := characterEncumbrance(character, cards, 10, 2, 30, false); result.ItemsWeight != 32 || result.EquippedWeight != 0 || result.CarriedWeight != 35 {
+		t.Fatalf("equipped inventory row counted twice: %+v", result)
+	}
+
+	// Цикл контейнеров не зацикливает подсчёт.
+	cyclic := InventoryItemRows{{CardID: backpack, Qty: 1, ContainerID: pouch}, {CardID: pouch, Qty: 1, ContainerID: backpack}}
+	character = CharacterV3{ID: uuid.New(), InventoryItems: &cyclic}
+	if result := characterEncumbrance(character, cards, 10, 2, 30, false); result.CarriedWeight != 6 {
+		t.Fatalf("cyclic containers: %+v", result)
+	}
+}
+
+func TestCharacterEncumbranceStatus(t *testing.T) {
+	anvil := uuid.NewString()
+	carry := func(pounds float64, strength, size int, variant bool) CharacterEncumbrance {
+		items := InventoryItemRows{{CardID: anvil, Qty: 1}}
+		character := CharacterV3{ID: uuid.New(), InventoryItems: &items}
+		return characterEncumbrance(character, map[string]Card{anvil: {Weight: &pounds}}, strength, size, 30, variant)
+	}
+
+	for _, tc := range []struct {
+		pounds       float64
+		variant      bool
+		status       string
+		speed        int
+		disadvantage bool
+	}{
+		{50, false, encumbranceNone, 30, false},
+		{51, true, encumbranceEncumbered, 20, false},
+		{101, true, encumbranceHeavily, 10, true},
+		{151, false, encumbranceOverCapacity, 5, false},
+		{151, true, encumbranceOverCapacity, 5, true},
+		{301, false, encumbranceImmobile, 0, false},
+	} {
+		result := carry(tc.pounds, 10, 2, tc.variant)
+		if result.Status != tc.status || result.Speed != tc.speed || result.Disadvantage != tc.disadvantage {
+			t.Fatalf("%v lb (variant %v): %+v", tc.pounds, tc.variant, result)
+		}
+	}
+
+	if result := carry(151, 10, 3, false); result.Capacity != 300 || result.Status != encumbranceNone {
+		t.Fatalf("large carry size doubles capacity: %+v", result)
+	}
+	if result := carry(10, 10, 2, false); result.EncumberedAt != nil || result.Rules != "standard" {
+		t.Fatalf("standard rules have no variant thresholds: %+v", result)
+	}
+}
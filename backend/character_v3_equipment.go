@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCharacterEquipBodyBytes = 1 << 10
+
+// CharacterEquipRequest — надеть предмет из сумки (card_id; slot — целевой
+// слот, пусто — подходящий свободный; two_handed — хват универсального
+// оружия двумя руками) или снять предмет из слота unequip_slot.
+type CharacterEquipRequest struct {
+	CardID                  string `json:"card_id"`
+	Slot                    string `json:"slot"`
+	TwoHanded               bool   `json:"two_handed"`
+	UnequipSlot             string `json:"unequip_slot"`
+	ExpectedRuntimeRevision *int64 `json:"expected_runtime_revision" binding:"required"`
+}
+
+// CharacterEquipResponse — экипировка после команды, снятые в сумку
+// предметы, пересчитанный КЗ и лист.
+type CharacterEquipResponse struct {
+	Equipment  JSONMap     `json:"equipment"`
+	Displaced  []string    `json:"displaced"`
+	ArmorClass int         `json:"armor_class"`
+	Character  CharacterV3 `json:"character"`
+}
+
+// takeCharacterInventoryItem снимает один предмет из сумки: верхний уровень
+// важнее контейнера (removeFromInventory клиента). ok=false — предмета нет.
+func takeCharacterInventoryItem(rows InventoryItemRows, cardID string) (InventoryItemRows, bool) {
+	index := -1
+	for candidate, row := range rows {
+		if row.CardID == cardID && row.Qty > 0 && (index < 0 || (row.ContainerID == "" && rows[index].ContainerID != "")) {
+			index = candidate
+		}
+	}
+	if index < 0 {
+		return rows, false
+	}
+	result := InventoryItemRows{}
+	for candidate, row := range rows {
+		if candidate == index {
+			row.Qty--
+		}
+		if row.Qty > 0 {
+			result = append(result, row)
+		}
+	}
+	return result, true
+}
+
+// putCharacterInventoryItem кладёт предмет в сумку на верхний уровень
+// (addToInventory клиента).
+func putCharacterInventoryItem(rows InventoryItemRows, cardID string) InventoryItemRows {
+	result := append(InventoryItemRows{}, rows...)
+	for index, row := range result {
+		if row.CardID == cardID && row.ContainerID == "" {
+			result[index].Qty++
+			return result
+		}
+	}
+	return append(result, InventoryItemRow{CardID: cardID, Qty: 1})
+}
+
+// equipmentCommandError превращает отказ правил экипировки в ошибку команды
+// 422 с кодом правила.
+func equipmentCommandError(characterID uuid.UUID, err error) error {
+	var equipErr *characterEquipmentError
+	if errors.As(err, &equipErr) {
+		return &characterRuntimeCommandError{
+			Status: http.StatusUnprocessableEntity, Code: equipErr.Code,
+			Message: equipErr.Message, CharacterID: characterID.String(),
+		}
+	}
+	return err
+}
+
+// EquipCharacterV3 — POST /api/characters-v3/:id/equip. Надевает предмет из
+// сумки или снимает его в сумку по общим правилам экипировки: совместимость
+// слота, хват оружия, конфликт щита с двуручным хватом. Снятые предметы
+// возвращаются в сумку, настройка сохраняется, КЗ пересчитывается по
+// доспеху и щиту; всё пишется одной записью под проверкой runtime_revision.
+func (cc *CharacterV3Controller) EquipCharacterV3(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	if _, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Write); !allowed {
+		return
+	}
+
+	var req CharacterEquipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+		return
+	}
+	if (req.CardID == "") == (req.UnequipSlot == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "укажите либо card_id, либо unequip_slot"})
+		return
+	}
+	for _, slot := range []string{req.Slot, req.UnequipSlot} {
+		if slot != "" && !containsString(characterEquipmentSlots, slot) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неизвестный слот экипировки", "details": slot})
+			return
+		}
+	}
+	var cardID uuid.UUID
+	if req.CardID != "" {
+		if cardID, err = uuid.Parse(req.CardID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID предмета"})
+			return
+		}
+	}
+
+	var response CharacterEquipResponse
+	txErr := cc.db.Transaction(func(tx *gorm.DB) error {
+		var locked CharacterV3
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCharacterV3OwnerChanged
+			}
+			return err
+		}
+		if locked.RuntimeRevision != *req.ExpectedRuntimeRevision {
+			expected := *req.ExpectedRuntimeRevision
+			actual := locked.RuntimeRevision
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "runtime_revision_conflict",
+				Message: "character runtime revision is stale", CharacterID: characterID.String(),
+				ExpectedRuntimeRevision: &expected, ActualRuntimeRevision: &actual,
+			}
+		}
+		// Пока персонаж в бою, его КЗ читает бой: смена доспеха или щита идёт
+		// после боя, как и настройка.
+		if locked.CurrentEncounterID != nil {
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "character_in_encounter",
+				Message: "character is linked to an active encounter", CharacterID: characterID.String(),
+			}
+		}
+
+		current := JSONMap{}
+		if locked.Equipment != nil {
+			current = *locked.Equipment
+		}
+		var rows InventoryItemRows
+		if stored := characterInventoryWithoutBonds(locked.InventoryItems); stored != nil {
+			rows = *stored
+		}
+
+		var equipment JSONMap
+		if req.UnequipSlot != "" {
+			var removed string
+			equipment, removed = characterUnequipSlot(current, req.UnequipSlot)
+			if removed == "" {
+				return &characterEquipmentError{Code: "slot_empty", Message: "слот уже свободен"}
+			}
+			rows = putCharacterInventoryItem(rows, removed)
+			response.Displaced = []string{removed}
+		} else {
+			var card Card
+			if err := tx.First(&card, "id = ?", cardID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &characterEquipmentError{Code: "item_not_found", Message: "предмет не найден"}
+				}
+				return err
+			}
+			worn := map[string]Card{}
+			ids := Properties(characterEquippedCardIDs(locked))
+			if parsed := validUUIDs(&ids); len(parsed) > 0 {
+				var cards []Card
+				if err := tx.Where("id IN ?", parsed).Find(&cards).Error; err != nil {
+					return err
+				}
+				for _, occupant := range cards {
+					worn[occupant.ID.String()] = occupant
+				}
+			}
+			plan, err := planCharacterEquip(current, worn, card, req.Slot, req.TwoHanded)
+			if err != nil {
+				return err
+			}
+			var carried bool
+			if rows, carried = takeCharacterInventoryItem(rows, card.ID.String()); !carried {
+				return &characterEquipmentError{Code: "item_not_carried", Message: "предмета нет в сумке"}
+			}
+			for _, id := range plan.Displaced {
+				rows = putCharacterInventoryItem(rows, id)
+			}
+			equipment = plan.Equipment
+			response.Displaced = plan.Displaced
+		}
+
+		next := locked
+		next.Equipment = &equipment
+		next.InventoryItems = carryCharacterAttunement(locked, &equipment, &rows)
+		input, err := loadCharacterDerivationInput(tx, next)
+		if err != nil {
+			return err
+		}
+		response.ArmorClass = deriveCharacterStats(input).Stats.ArmorClass
+
+		result := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ? AND runtime_revision = ?", characterID, userID, locked.RuntimeRevision).
+			Updates(map[string]interface{}{
+				"equipment":        &equipment,
+				"inventory_items":  next.InventoryItems,
+				"armor_class":      response.ArmorClass,
+				"runtime_revision": locked.RuntimeRevision + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCharacterV3OwnerChanged
+		}
+		response.Equipment = equipment
+		return tx.Preload("User").Preload("Group").First(&response.Character, locked.ID).Error
+	})
+	txErr = equipmentCommandError(characterID, txErr)
+	if errors.Is(txErr, errCharacterV3OwnerChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
+		return
+	}
+	var commandErr *characterRuntimeCommandError
+	if errors.As(txErr, &commandErr) {
+		writeCharacterRuntimeCommandError(c, txErr)
+		return
+	}
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка смены экипировки", "details": txErr.Error()})
+		return
+	}
+	if response.Displaced == nil {
+		response.Displaced = []string{}
+	}
+	response.Character.AccessMode = characterV3AccessOwner
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// characterSubclassChoiceKey — ключ resolved_choices, под которым конструктор
+// хранит выбранный подкласс (frontend/src/character/forgeHelpers.ts, SUBCLASS_KEY).
+const characterSubclassChoiceKey = "builder:subclass"
+
+// characterFeatureBundle — сущности каталога, из которых собран персонаж v3.
+// Effects/Actions идут в порядке сборки клиента (gatherFeatureRefs в
+// frontend/src/character/assemble.ts): вид, подвид, каждый класс с подклассом
+// по возрастанию уровня в этом классе, черты, затем вручную добавленные
+// effect_ids/action_ids. Эффекты сохраняют кратность (repeatable), действия —
+// без повторов. EffectOrigins/ActionOrigins идут параллельно Effects/Actions.
+// Class/Subclass — первый класс персонажа, Classes — все классы по порядку.
+type characterFeatureBundle struct {
+	Race          *Race
+	Subrace       *Race
+	Class         *Class
+	Subclass      *Class
+	Classes       []characterClassLevel
+	Feats         []Feat
+	Effects       []Effect
+	Actions       []Action
+	EffectOrigins []characterFeatureOrigin
+	ActionOrigins []characterFeatureOrigin
+}
+
+// characterClassLevel — класс сборки, его подкласс и уровень в этом классе.
+type characterClassLevel struct {
+	Class    Class
+	Subclass *Class
+	Level    int
+}
+
+// classLevels — классы сборки с уровнями в них. Сборка без записей классов
+// (собранная вручную, как в тестах) — единственный Class на уровне level.
+func (b characterFeatureBundle) classLevels(level int) []characterClassLevel {
+	if len(b.Classes) > 0 || b.Class == nil {
+		return b.Classes
+	}
+	return []characterClassLevel{{Class: *b.Class, Subclass: b.Subclass, Level: level}}
+}
+
+// characterFeatureOrigin — сущность, через которую эффект или действие попали
+// в лист (ChoiceOrigin в frontend/src/character/assemble.ts). Вручную
+// добавленные effect_ids/action_ids происхождения не имеют.
+type characterFeatureOrigin struct {
+	Kind string
+	ID   string
+}
+
+// sourceKey — префикс ключей resolved_choices особенности:
+// `${kind}:${entityId}:${featureId}` (sourceKey в mechanics/choiceKey.ts).
+// Без происхождения ключ пуст, и выборы ищутся по голому id.
+func (o characterFeatureOrigin) sourceKey(featureID string) string {
+	if o.Kind == "" {
+		return ""
+	}
+	if featureID == "" {
+		featureID = "base"
+	}
+	return o.Kind + ":" + o.ID + ":" + featureID
+}
+
+// classLevelKey — ключ класса в class_level:<id>: хвост card_number после
+// CLASS- в нижнем регистре (CLASS-MONK → monk), иначе uuid класса.
+func classLevelKey(class Class) string {
+	cardNumber := strings.ToLower(class.CardNumber)
+	for _, prefix := range []string{"class-", "class_"} {
+		if index := strings.Index(cardNumber, prefix); index >= 0 && len(cardNumber) > index+len(prefix) {
+			return strings.ReplaceAll(cardNumber[index+len(prefix):], "-", "_")
+		}
+	}
+	return class.ID.String()
+}
+
+type characterFeatureRefs struct {
+	level         int
+	origin        characterFeatureOrigin
+	effectIDs     []string
+	effectOrigins []characterFeatureOrigin
+	actionIDs     []string
+	actionOrigins []characterFeatureOrigin
+	seenActions   map[string]bool
+}
+
+func (r *characterFeatureRefs) addEffects(ids *Properties) {
+	if ids == nil {
+		return
+	}
+	for _, id := range *ids {
+		r.effectIDs = append(r.effectIDs, id)
+		r.effectOrigins = append(r.effectOrigins, r.origin)
+	}
+}
+
+func (r *characterFeatureRefs) addActions(ids *Properties) {
+	if ids == nil {
+		return
+	}
+	for _, id := range *ids {
+		if !r.seenActions[id] {
+			r.seenActions[id] = true
+			r.actionIDs = append(r.actionIDs, id)
+			r.actionOrigins = append(r.actionOrigins, r.origin)
+		}
+	}
+}
+
+// addLevelProgression добавляет эффекты и действия уровней ≤ уровня персонажа
+// в порядке возрастания уровня.
+func (r *characterFeatureRefs) addLevelProgression(progression *JSONMap) {
+	if progression == nil {
+		return
+	}
+	levels := make([]int, 0, len(*progression))
+	byLevel := map[int]map[string]interface{}{}
+	for key, raw := range *progression {
+		level, err := strconv.Atoi(key)
+		entry, ok := raw.(map[string]interface{})
+		if err != nil || !ok || level > r.level {
+			continue
+		}
+		levels = append(levels, level)
+		byLevel[level] = entry
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		effects := stringList(byLevel[level]["effects"])
+		actions := stringList(byLevel[level]["actions"])
+		r.addEffects(&effects)
+		r.addActions(&actions)
+	}
+}
+
+func stringList(raw interface{}) Properties {
+	items, _ := raw.([]interface{})
+	result := make(Properties, 0, len(items))
+	for _, item := range items {
+		if value, ok := item.(string); ok && value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// loadCharacterFeatureBundle загружает вид, класс, подкласс, черты и все
+// эффекты/действия персонажа. Отсутствующие в каталоге ссылки пропускаются:
+// лист мог пережить удаление сущности.
+func loadCharacterFeatureBundle(db *gorm.DB, character CharacterV3) (characterFeatureBundle, error) {
+	var bundle characterFeatureBundle
+	refs := &characterFeatureRefs{level: character.Level, seenActions: map[string]bool{}}
+	if refs.level <= 0 {
+		refs.level = 1
+	}
+
+	if character.RaceID != nil {
+		var race Race
+		if err := db.First(&race, "id = ?", *character.RaceID).Error; err == nil {
+			bundle.Race = &race
+			refs.origin = characterFeatureOrigin{Kind: "race", ID: race.ID.String()}
+			refs.addEffects(race.RelatedEffects)
+			refs.addActions(race.RelatedActions)
+			refs.addLevelProgression(race.LevelProgression)
+		} else if err != gorm.ErrRecordNotFound {
+			return bundle, err
+		}
+	}
+	if character.LineageID != nil {
+		if lineageID, err := uuid.Parse(*character.LineageID); err == nil {
+			var subrace Race
+			if err := db.First(&subrace, "id = ?", lineageID).Error; err == nil {
+				bundle.Subrace = &subrace
+				refs.origin = characterFeatureOrigin{Kind: "race", ID: subrace.ID.String()}
+				refs.addEffects(subrace.RelatedEffects)
+				refs.addActions(subrace.RelatedActions)
+				refs.addLevelProgression(subrace.LevelProgression)
+			} else if err != gorm.ErrRecordNotFound {
+				return bundle, err
+			}
+		}
+	}
+	// Прогрессия каждого класса собирается до уровня в этом классе; вид
+	// выше — до суммарного уровня.
+	for _, entry := range characterClassEntries(character) {
+		var class Class
+		if err := db.First(&class, "id = ?", entry.ClassID).Error; err == gorm.ErrRecordNotFound {
+			continue
+		} else if err != nil {
+			return bundle, err
+		}
+		classLevel := characterClassLevel{Class: class, Level: entry.Level}
+		refs.level = entry.Level
+		refs.origin = characterFeatureOrigin{Kind: "class", ID: class.ID.String()}
+		refs.addLevelProgression(class.LevelProgression)
+		if entry.SubclassID != nil {
+			var subclass Class
+			if err := db.First(&subclass, "id = ?", *entry.SubclassID).Error; err == nil {
+				classLevel.Subclass = &subclass
+				refs.origin = characterFeatureOrigin{Kind: "class", ID: subclass.ID.String()}
+				refs.addEffects(subclass.RelatedEffects)
+				refs.addActions(subclass.RelatedActions)
+				refs.addLevelProgression(subclass.LevelProgression)
+			} else if err != gorm.ErrRecordNotFound {
+				return bundle, err
+			}
+		}
+		bundle.Classes = append(bundle.Classes, classLevel)
+	}
+	if len(bundle.Classes) > 0 {
+		bundle.Class = &bundle.Classes[0].Class
+		bundle.Subclass = bundle.Classes[0].Subclass
+	}
+	if featIDs := validUUIDs(character.FeatIDs); len(featIDs) > 0 {
+		var feats []Feat
+		if err := db.Where("id IN ?", featIDs).Find(&feats).Error; err != nil {
+			return bundle, err
+		}
+		byID := make(map[uuid.UUID]Feat, len(feats))
+		for _, feat := range feats {
+			byID[feat.ID] = feat
+		}
+		for _, id := range featIDs {
+			if feat, ok := byID[id]; ok {
+				bundle.Feats = append(bundle.Feats, feat)
+				refs.origin = characterFeatureOrigin{Kind: "feat", ID: feat.ID.String()}
+				refs.addEffects(feat.RelatedEffects)
+				refs.addActions(feat.RelatedActions)
+			}
+		}
+	}
+	refs.origin = characterFeatureOrigin{}
+	refs.addEffects(character.EffectIDs)
+	refs.addActions(character.ActionIDs)
+
+	if ids, origins := validFeatureUUIDs(refs.effectIDs, refs.effectOrigins); len(ids) > 0 {
+		var effects []Effect
+		if err := db.Where("id IN ?", ids).Find(&effects).Error; err != nil {
+			return bundle, err
+		}
+		byID := make(map[uuid.UUID]Effect, len(effects))
+		for _, effect := range effects {
+			byID[effect.ID] = effect
+		}
+		for index, id := range ids {
+			if effect, ok := byID[id]; ok {
+				bundle.Effects = append(bundle.Effects, effect)
+				bundle.EffectOrigins = append(bundle.EffectOrigins, origins[index])
+			}
+		}
+	}
+	if ids, origins := validFeatureUUIDs(refs.actionIDs, refs.actionOrigins); len(ids) > 0 {
+		var actions []Action
+		if err := db.Where("id IN ?", ids).Find(&actions).Error; err != nil {
+			return bundle, err
+		}
+		byID := make(map[uuid.UUID]Action, len(actions))
+		for _, action := range actions {
+			byID[action.ID] = action
+		}
+		for index, id := range ids {
+			if action, ok := byID[id]; ok {
+				bundle.Actions = append(bundle.Actions, action)
+				bundle.ActionOrigins = append(bundle.ActionOrigins, origins[index])
+			}
+		}
+	}
+	return bundle, nil
+}
+
+func characterSubclassID(character CharacterV3) (uuid.UUID, bool) {
+	if character.ResolvedChoices == nil {
+		return uuid.Nil, false
+	}
+	selected := stringList((*character.ResolvedChoices)[characterSubclassChoiceKey])
+	if len(selected) == 0 {
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(selected[0])
+	return id, err == nil
+}
+
+// validUUIDs оставляет только разбираемые uuid, сохраняя порядок и повторы.
+func validUUIDs(ids *Properties) []uuid.UUID {
+	if ids == nil {
+		return nil
+	}
+	result := make([]uuid.UUID, 0, len(*ids))
+	for _, raw := range *ids {
+		if id, err := uuid.Parse(strings.TrimSpace(raw)); err == nil {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// validFeatureUUIDs — validUUIDs для ссылок с происхождением: неразбираемые id
+// отбрасываются вместе со своим происхождением.
+func validFeatureUUIDs(raw []string, origins []characterFeatureOrigin) ([]uuid.UUID, []characterFeatureOrigin) {
+	ids := make([]uuid.UUID, 0, len(raw))
+	kept := make([]characterFeatureOrigin, 0, len(raw))
+	for index, value := range raw {
+		if id, err := uuid.Parse(strings.TrimSpace(value)); err == nil {
+			ids = append(ids, id)
+			kept = append(kept, origins[index])
+		}
+	}
+	return ids, kept
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxCharacterFormulaBodyBytes = 16 << 10
+
+// variablePayloads извлекает payload-ы kind:"variable" из механики эффекта
+// или действия: сама механика может быть payload-ом, иначе берутся result
+// интеракций (как payloadsOf в frontend/src/engine/mechanicsView.ts).
+func variablePayloads(mechanics JSONMap) []map[string]interface{} {
+	if mechanics == nil {
+		return nil
+	}
+	if kind, ok := mechanics["kind"].(string); ok {
+		if kind == "variable" {
+			return []map[string]interface{}{mechanics}
+		}
+		return nil
+	}
+	var result []map[string]interface{}
+	for _, interaction := range mechanicsInteractions(mechanics) {
+		raw, exists := interaction["result"]
+		if !exists {
+			raw = interaction["results"]
+		}
+		for _, payload := range mechanicsPayloadList(raw) {
+			if payload["kind"] == "variable" {
+				result = append(result, payload)
+			}
+		}
+	}
+	return result
+}
+
+// foldFormulaVariables сворачивает variable-payload-ы механик по порядку
+// (= по возрастанию уровня: старший уровень перекрывает младший). Без value
+// берётся default_value справочника. Возвращает и множество затронутых id,
+// чтобы вызывающий мог наложить результат на снимок rule_state.variables.
+func foldFormulaVariables(mechanics []JSONMap, defs map[string]Variable) (map[string]formulaVariable, map[string]bool) {
+	values := map[string]formulaVariable{}
+	touched := map[string]bool{}
+	for _, item := range mechanics {
+		for _, payload := range variablePayloads(item) {
+			id := stringField(payload, "id")
+			if id == "" {
+				id = stringField(payload, "variable")
+			}
+			if id == "" {
+				continue
+			}
+			touched[id] = true
+			def, hasDef := defs[id]
+			op := stringFieldOr(payload, "op", "set")
+			if op == "remove" {
+				delete(values, id)
+				continue
+			}
+			raw, exists := payload["value"]
+			if (!exists || raw == nil || raw == "") && hasDef {
+				raw = def.DefaultValue
+			}
+			varType := ""
+			if hasDef {
+				varType = def.VarType
+			}
+			value, ok := parseFormulaVariable(raw, varType)
+			if !ok {
+				continue
+			}
+			previous, hadPrevious := values[id]
+			if op == "add" && hadPrevious && !previous.Dice && !value.Dice {
+				value.Number += previous.Number
+			}
+			values[id] = value
+		}
+	}
+	return values, touched
+}
+
+// characterFormulaActor собирает участника для формул персонажа: снимок
+// rule_state, уровень класса для class_level:<id> и переменные, заново
+// свёрнутые из эффектов и действий каталога и активных эффектов листа.
+func characterFormulaActor(db *gorm.DB, character CharacterV3) (mechanicsActor, error) {
+	bundle, err := loadCharacterFeatureBundle(db, character)
+	if err != nil {
+		return mechanicsActorFromCharacter(character), err
+	}
+	return characterBundleFormulaActor(db, character, bundle)
+}
+
+// characterBundleFormulaActor — characterFormulaActor для уже загруженных
+// сущностей персонажа.
+func characterBundleFormulaActor(db *gorm.DB, character CharacterV3, bundle characterFeatureBundle) (mechanicsActor, error) {
+	actor := mechanicsActorFromCharacter(character)
+	for _, entry := range bundle.classLevels(actor.Level) {
+		actor.ClassLevels[classLevelKey(entry.Class)] = entry.Level
+	}
+
+	var variables []Variable
+	if err := db.Where("deleted_at IS NULL").Find(&variables).Error; err != nil {
+		return actor, err
+	}
+	defs := make(map[string]Variable, len(variables))
+	for _, variable := range variables {
+		defs[variable.VariableID] = variable
+	}
+
+	mechanics := make([]JSONMap, 0, len(bundle.Effects)+len(bundle.Actions))
+	for _, effect := range bundle.Effects {
+		if effect.Mechanics != nil {
+			mechanics = append(mechanics, *effect.Mechanics)
+		}
+	}
+	for _, action := range bundle.Actions {
+		if action.Mechanics != nil {
+			mechanics = append(mechanics, *action.Mechanics)
+		}
+	}
+	if character.ActiveEffects != nil {
+		for _, row := range *character.ActiveEffects {
+			mechanics = append(mechanics, row.Mechanics)
+		}
+	}
+	folded, touched := foldFormulaVariables(mechanics, defs)
+	for id := range touched {
+		if value, ok := folded[id]; ok {
+			actor.Variables[id] = value
+		} else {
+			delete(actor.Variables, id)
+		}
+	}
+	return actor, nil
+}
+
+// EvaluateCharacterFormula вычисляет формулу механики против конкретного
+// персонажа и возвращает значение с разбивкой по слагаемым.
+func (cc *CharacterV3Controller) EvaluateCharacterFormula(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	var req EvaluateCharacterFormulaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+		return
+	}
+
+	character, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Read)
+	if !allowed {
+		return
+	}
+
+	actor, err := characterFormulaActor(cc.db, *character)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки сущностей персонажа"})
+		return
+	}
+	ctx := actor.formulaContext()
+	ctx.SpellSlotAbove = req.SpellSlotAbove
+	ctx.CritDice = req.Crit
+	if req.WeaponMod != nil {
+		ctx.WeaponMod = *req.WeaponMod
+	}
+	ctx.RNG = newDiceRNG(req.Seed)
+
+	evaluation, err := evaluateFormula(req.Formula, ctx)
+	if err != nil {
+		response := gin.H{"error": "не удалось вычислить формулу", "details": err.Error()}
+		var missing *formulaMissingVariableError
+		if errors.As(err, &missing) {
+			response["variable"] = missing.Variable
+		}
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+	c.JSON(http.StatusOK, CharacterFormulaEvaluation{
+		FormulaEvaluation: evaluation,
+		Variables:         actor.Variables,
+	})
+}
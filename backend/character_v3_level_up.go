@@ -0,0 +1,834 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxCharacterLevelUpBodyBytes ограничивает тело POST /level-up: выборы
+// одного уровня — единицы ключей.
+const maxCharacterLevelUpBodyBytes = 64 << 10
+
+// maxCharacterLevel — потолок уровня персонажа.
+const maxCharacterLevel = 20
+
+// CharacterLevelUpOption — вариант выбора или подкласс.
+type CharacterLevelUpOption struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CharacterLevelUpFeature — эффект или действие, которое даёт новый уровень.
+type CharacterLevelUpFeature struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CharacterLevelUpChoice — выбор нового уровня. Key — полный ключ
+// resolved_choices; Options пуст для выборов из каталога (навык, заклинание,
+// черта…), тогда значение проверяется только по Source.
+type CharacterLevelUpChoice struct {
+	Key      string                   `json:"key"`
+	ID       string                   `json:"id"`
+	Prompt   string                   `json:"prompt,omitempty"`
+	Count    int                      `json:"count"`
+	Source   string                   `json:"source,omitempty"`
+	Options  []CharacterLevelUpOption `json:"options,omitempty"`
+	Feature  string                   `json:"feature"`
+	Selected []string                 `json:"selected"`
+}
+
+// CharacterResourceChange — изменение максимума пула при повышении уровня.
+type CharacterResourceChange struct {
+	Resource string `json:"resource"`
+	Before   int    `json:"before"`
+	After    int    `json:"after"`
+}
+
+// CharacterLevelUpPlan — что даёт следующий уровень. ClassID — класс,
+// в котором берётся уровень, ClassLevel — новый уровень в нём; Multiclass —
+// класс новый, тогда Proficiencies — его ограниченный список владений.
+// Missing — ключи обязательных, но ещё не сделанных выборов (builder:subclass
+// для подкласса); Derived — снимок листа после повышения со средним
+// значением хитов.
+type CharacterLevelUpPlan struct {
+	CharacterID      string                       `json:"character_id"`
+	RuntimeRevision  int64                        `json:"runtime_revision"`
+	Level            int                          `json:"level"`
+	NewLevel         int                          `json:"new_level"`
+	ClassID          string                       `json:"class_id"`
+	ClassLevel       int                          `json:"class_level"`
+	Multiclass       bool                         `json:"multiclass"`
+	Proficiencies    *CharacterClassProficiencies `json:"proficiencies,omitempty"`
+	HitDie           string                       `json:"hit_die"`
+	AverageHP        int                          `json:"average_hp"`
+	SubclassRequired bool                         `json:"subclass_required"`
+	SubclassOptions  []CharacterLevelUpOption     `json:"subclass_options,omitempty"`
+	Effects          []CharacterLevelUpFeature    `json:"effects"`
+	Actions          []CharacterLevelUpFeature    `json:"actions"`
+	Choices          []CharacterLevelUpChoice     `json:"choices"`
+	Missing          []string                     `json:"missing"`
+	Resources        []CharacterResourceChange    `json:"resources"`
+	Derived          CharacterDerivedStats        `json:"derived"`
+}
+
+// LevelUpCharacterV3Request — повышение уровня. ClassID — класс, в котором
+// берётся уровень (по умолчанию первый класс персонажа; новый класс —
+// мультикласс). Choices — выборы нового уровня по полным ключам плана;
+// hp_method: average (по умолчанию) или roll — кость хитов бросает сервер
+// своим генератором: результат записывается в лист, поэтому seed клиента
+// не принимается.
+type LevelUpCharacterV3Request struct {
+	ExpectedRuntimeRevision *int64              `json:"expected_runtime_revision" binding:"required"`
+	ClassID                 string              `json:"class_id"`
+	HPMethod                string              `json:"hp_method"`
+	SubclassID              string              `json:"subclass_id"`
+	Choices                 map[string][]string `json:"choices"`
+}
+
+// LevelUpCharacterV3Response — применённый план, прибавка хитов и лист после записи.
+type LevelUpCharacterV3Response struct {
+	LevelUp   CharacterLevelUpPlan `json:"level_up"`
+	HPMethod  string               `json:"hp_method"`
+	HPGained  int                  `json:"hp_gained"`
+	Roll      *EngineRoll          `json:"roll,omitempty"`
+	Character CharacterV3          `json:"character"`
+}
+
+// characterLevelUpError — отказ в повышении уровня или в наборе классов (422).
+type characterLevelUpError struct {
+	Status  int
+	Message string
+	Details string
+}
+
+func (e *characterLevelUpError) Error() string { return e.Message }
+
+func invalidCharacterLevelUp(message, details string) error {
+	return &characterLevelUpError{Status: http.StatusUnprocessableEntity, Message: message, Details: details}
+}
+
+// characterLevelUpState — план и всё, из чего он посчитан: лист до и после
+// повышения и выводы их снимков.
+type characterLevelUpState struct {
+	Plan   CharacterLevelUpPlan
+	Next   CharacterV3
+	Before CharacterDerivation
+	After  CharacterDerivation
+	HitDie int
+}
+
+// planCharacterLevelUp строит план перехода на следующий уровень в классе
+// classID (пусто — первый класс персонажа; класса ещё нет — мультикласс с
+// проверкой требований): новые эффекты и действия классов, подклассов и вида
+// по level_progression, выборы из их механик (с раскрытием вложенных по уже
+// выбранному), подкласс на SubclassLevel класса и изменения пулов ресурсов.
+// submitted — выборы клиента; ключи вне плана и недопустимые значения
+// отклоняются.
+func planCharacterLevelUp(db *gorm.DB, character CharacterV3, classID, subclassID string, submitted map[string][]string) (characterLevelUpState, error) {
+	var state characterLevelUpState
+	level := character.Level
+	if level < 1 {
+		level = 1
+	}
+	if level >= maxCharacterLevel {
+		return state, invalidCharacterLevelUp("персонаж уже достиг максимального уровня", "")
+	}
+
+	before, err := loadCharacterFeatureBundle(db, character)
+	if err != nil {
+		return state, err
+	}
+	if before.Class == nil {
+		return state, invalidCharacterLevelUp("у персонажа не выбран класс", "")
+	}
+
+	previous := characterClassEntries(character)
+	entries := append([]CharacterClassEntry(nil), previous...)
+	target, multiclass := 0, false
+	if classID = strings.TrimSpace(classID); classID != "" {
+		parsed, err := uuid.Parse(classID)
+		if err != nil {
+			return state, invalidCharacterLevelUp("неверный ID класса", classID)
+		}
+		target = -1
+		for index, entry := range entries {
+			if entry.ClassID == parsed {
+				target = index
+			}
+		}
+		if target < 0 {
+			entries = append(entries, CharacterClassEntry{ClassID: parsed})
+			target, multiclass = len(entries)-1, true
+		}
+	}
+	entries[target].Level++
+	var advanced Class
+	if multiclass {
+		if err := validateCharacterClasses(db, entries, previous, characterBaseAbilities(character)); err != nil {
+			return state, err
+		}
+		if err := db.First(&advanced, "id = ?", entries[target].ClassID).Error; err != nil {
+			return state, err
+		}
+	} else {
+		found := false
+		for _, class := range before.Classes {
+			if class.Class.ID == entries[target].ClassID {
+				advanced, found = class.Class, true
+			}
+		}
+		if !found {
+			return state, invalidCharacterLevelUp("класс персонажа не найден в каталоге", entries[target].ClassID.String())
+		}
+	}
+
+	next := character
+	next.Level = level + 1
+	choices := characterResolvedChoices(character)
+	plan := CharacterLevelUpPlan{
+		CharacterID: character.ID.String(), RuntimeRevision: character.RuntimeRevision,
+		Level: level, NewLevel: next.Level,
+		ClassID: advanced.ID.String(), ClassLevel: entries[target].Level, Multiclass: multiclass,
+		Effects: []CharacterLevelUpFeature{}, Actions: []CharacterLevelUpFeature{},
+		Missing: []string{}, Resources: []CharacterResourceChange{},
+	}
+	if advanced.HitDie != nil {
+		plan.HitDie = *advanced.HitDie
+	}
+	if multiclass {
+		proficiencies := characterClassProficiencies(advanced, false)
+		plan.Proficiencies = &proficiencies
+	}
+
+	subclassLevel := advanced.SubclassLevel
+	if entries[target].SubclassID == nil && subclassLevel != nil && entries[target].Level >= *subclassLevel {
+		var subclasses []Class
+		if err := db.Where("parent_class_id = ? AND is_subclass = ?", advanced.ID, true).
+			Order("name").Find(&subclasses).Error; err != nil {
+			return state, err
+		}
+		for _, subclass := range subclasses {
+			plan.SubclassOptions = append(plan.SubclassOptions, CharacterLevelUpOption{ID: subclass.ID.String(), Name: subclass.Name})
+		}
+		plan.SubclassRequired = len(subclasses) > 0
+	}
+	if subclassID = strings.TrimSpace(subclassID); subclassID != "" {
+		if !plan.SubclassRequired {
+			return state, invalidCharacterLevelUp("подкласс на этом уровне не выбирается", "")
+		}
+		if !characterLevelUpOptionExists(plan.SubclassOptions, subclassID) {
+			return state, invalidCharacterLevelUp("неизвестный подкласс", subclassID)
+		}
+		selected := uuid.MustParse(subclassID)
+		entries[target].SubclassID = &selected
+		// Подкласс первого класса конструктор хранит в выборе builder:subclass.
+		if target == 0 {
+			choices[characterSubclassChoiceKey] = []string{subclassID}
+		}
+	} else if plan.SubclassRequired {
+		plan.Missing = append(plan.Missing, characterSubclassChoiceKey)
+	}
+	nextEntries := CharacterClassEntries(entries)
+	next.Classes = &nextEntries
+	for key, values := range submitted {
+		choices[key] = values
+	}
+	resolved := characterChoicesJSONMap(choices)
+	next.ResolvedChoices = &resolved
+
+	after, err := loadCharacterFeatureBundle(db, next)
+	if err != nil {
+		return state, err
+	}
+	var sources []characterMechanicsSource
+	plan.Effects, plan.Actions, sources = characterLevelUpGains(before, after)
+	plan.Choices = collectCharacterLevelUpChoices(sources, choices)
+	if plan.Proficiencies != nil && plan.Proficiencies.Skills > 0 {
+		skills := CharacterLevelUpChoice{
+			Key: characterMulticlassSkillsKey(advanced.ID), ID: "skills", Prompt: "Навыки мультикласса",
+			Count: plan.Proficiencies.Skills, Source: "skill", Feature: advanced.Name, Selected: []string{},
+		}
+		for _, skill := range plan.Proficiencies.SkillOptions {
+			skills.Options = append(skills.Options, CharacterLevelUpOption{ID: skill, Name: skill})
+		}
+		if selected, ok := choices[skills.Key]; ok {
+			skills.Selected = selected
+		}
+		plan.Choices = append([]CharacterLevelUpChoice{skills}, plan.Choices...)
+	}
+
+	known := make(map[string]CharacterLevelUpChoice, len(plan.Choices))
+	for _, choice := range plan.Choices {
+		known[choice.Key] = choice
+	}
+	for key, values := range submitted {
+		choice, ok := known[key]
+		if !ok {
+			return state, invalidCharacterLevelUp("выбор не относится к новому уровню", key)
+		}
+		if err := validateCharacterLevelUpChoice(choice, values); err != nil {
+			return state, err
+		}
+	}
+	for _, choice := range plan.Choices {
+		if len(choice.Selected) < choice.Count {
+			plan.Missing = append(plan.Missing, choice.Key)
+		}
+	}
+
+	beforeInput, err := characterBundleDerivationInput(db, character, before)
+	if err != nil {
+		return state, err
+	}
+	afterInput, err := characterBundleDerivationInput(db, next, after)
+	if err != nil {
+		return state, err
+	}
+	state.Before = deriveCharacterStats(beforeInput)
+	state.After = deriveCharacterStats(afterInput)
+	plan.Derived = state.After.Stats
+
+	state.HitDie = characterHitDieSides(plan.HitDie)
+	plan.AverageHP = characterLevelUpHitPoints(state.HitDie/2+1, state.After.Abilities["con"])
+
+	plan.Resources = characterResourceChanges(
+		characterResourceMaxima(before, plan.HitDie, level, state.Before),
+		characterResourceMaxima(after, plan.HitDie, next.Level, state.After),
+	)
+
+	state.Plan = plan
+	state.Next = next
+	return state, nil
+}
+
+func characterLevelUpOptionExists(options []CharacterLevelUpOption, id string) bool {
+	for _, option := range options {
+		if option.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func characterChoicesJSONMap(choices map[string][]string) JSONMap {
+	result := make(JSONMap, len(choices))
+	for key, values := range choices {
+		list := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			list = append(list, value)
+		}
+		result[key] = list
+	}
+	return result
+}
+
+// characterLevelUpGains — эффекты и действия, которых не было до повышения.
+// Сравнение идёт по (происхождение, id) с кратностью: повторный эффект
+// уровня (вторая «Прибавка характеристик») тоже считается новым.
+func characterLevelUpGains(before, after characterFeatureBundle) ([]CharacterLevelUpFeature, []CharacterLevelUpFeature, []characterMechanicsSource) {
+	effects := []CharacterLevelUpFeature{}
+	actions := []CharacterLevelUpFeature{}
+	var sources []characterMechanicsSource
+
+	known := map[string]int{}
+	for index, effect := range before.Effects {
+		known["effect|"+characterLevelUpFeatureKey(before.EffectOrigins[index], effect.ID)]++
+	}
+	for index, action := range before.Actions {
+		known["action|"+characterLevelUpFeatureKey(before.ActionOrigins[index], action.ID)]++
+	}
+
+	for index, effect := range after.Effects {
+		key := "effect|" + characterLevelUpFeatureKey(after.EffectOrigins[index], effect.ID)
+		if known[key] > 0 {
+			known[key]--
+			continue
+		}
+		effects = append(effects, CharacterLevelUpFeature{ID: effect.ID.String(), Name: effect.Name})
+		if effect.Mechanics != nil {
+			sources = append(sources, characterMechanicsSource{
+				Key: after.EffectOrigins[index].sourceKey(effect.ID.String()), Name: effect.Name, Mechanics: *effect.Mechanics,
+			})
+		}
+	}
+	for index, action := range after.Actions {
+		key := "action|" + characterLevelUpFeatureKey(after.ActionOrigins[index], action.ID)
+		if known[key] > 0 {
+			known[key]--
+			continue
+		}
+		actions = append(actions, CharacterLevelUpFeature{ID: action.ID.String(), Name: action.Name})
+		if action.Mechanics != nil {
+			sources = append(sources, characterMechanicsSource{
+				Key: after.ActionOrigins[index].sourceKey(action.ID.String()), Name: action.Name, Mechanics: *action.Mechanics,
+			})
+		}
+	}
+	return effects, actions, sources
+}
+
+func characterLevelUpFeatureKey(origin characterFeatureOrigin, id uuid.UUID) string {
+	return origin.Kind + ":" + origin.ID + ":" + id.String()
+}
+
+// collectCharacterLevelUpChoices собирает choice-узлы механик новых
+// особенностей. Выборы in_play делаются на листе во время игры и в план не
+// входят; вложенные выборы раскрываются по уже выбранным пунктам.
+func collectCharacterLevelUpChoices(sources []characterMechanicsSource, choices map[string][]string) []CharacterLevelUpChoice {
+	result := []CharacterLevelUpChoice{}
+	seen := map[string]bool{}
+	var walk func(payload map[string]interface{}, source characterMechanicsSource, depth int)
+	walk = func(payload map[string]interface{}, source characterMechanicsSource, depth int) {
+		if payload["kind"] != "choice" || depth >= characterChoiceMaxDepth {
+			return
+		}
+		if stringField(payload, "context") == "in_play" {
+			return
+		}
+		choiceID := stringFieldOr(payload, "id", "choice")
+		key := choiceID
+		if source.Key != "" {
+			key = source.Key + ":" + choiceID
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		choice := CharacterLevelUpChoice{
+			Key: key, ID: choiceID, Prompt: stringField(payload, "prompt"),
+			Count: 1, Feature: source.Name, Selected: []string{},
+		}
+		if count, ok := mechanicsNumber(payload["count"]); ok && count >= 1 {
+			choice.Count = int(count)
+		}
+		options, _ := payload["options"].(map[string]interface{})
+		choice.Source = stringFieldOr(options, "source", stringField(payload, "source"))
+		for _, item := range mechanicsPayloadList(options["items"]) {
+			if id := stringField(item, "id"); id != "" {
+				choice.Options = append(choice.Options, CharacterLevelUpOption{ID: id, Name: stringFieldOr(item, "name", id)})
+			}
+		}
+		if selected, ok := choices[key]; ok {
+			choice.Selected = selected
+		}
+		result = append(result, choice)
+
+		for _, nested := range selectedCharacterChoicePayloads(payload, choice.Selected) {
+			walk(nested, source, depth+1)
+		}
+	}
+	for _, source := range sources {
+		for _, payload := range characterSourcePayloads(source.Mechanics) {
+			walk(payload, source, 0)
+		}
+	}
+	return result
+}
+
+// validateCharacterLevelUpChoice проверяет присланные значения выбора: не
+// больше count, без повторов, из options.items, а для характеристик и
+// спасбросков — ключи характеристик.
+func validateCharacterLevelUpChoice(choice CharacterLevelUpChoice, values []string) error {
+	if len(values) > choice.Count {
+		return invalidCharacterLevelUp("выбрано больше вариантов, чем разрешено", choice.Key)
+	}
+	seen := map[string]bool{}
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" || seen[value] {
+			return invalidCharacterLevelUp("пустой или повторный вариант выбора", choice.Key)
+		}
+		seen[value] = true
+		if len(choice.Options) > 0 && !characterLevelUpOptionExists(choice.Options, value) {
+			return invalidCharacterLevelUp("вариант не входит в выбор", choice.Key+": "+value)
+		}
+		if (choice.Source == "ability" || choice.Source == "saving_throw") && !isAbilityKey(value) {
+			return invalidCharacterLevelUp("вариант не является характеристикой", choice.Key+": "+value)
+		}
+	}
+	return nil
+}
+
+// characterLevelUpHitPoints — прибавка хитов за уровень: значение кости плюс
+// мод. ТЕЛ, но не меньше 1.
+func characterLevelUpHitPoints(die, con int) int {
+	gained := die + abilityScoreModifier(con)
+	if gained < 1 {
+		return 1
+	}
+	return gained
+}
+
+// rollCharacterHitDie бросает кость хитов уровня с модификатором ТЕЛ.
+func rollCharacterHitDie(rng diceRNG, sides, con int) EngineRoll {
+	result := rollDie(rng, sides)
+	roll := EngineRoll{
+		Kind: "other", Dice: []EngineRollDie{{Sides: sides, Result: result}},
+		Advantage: "none", Modifiers: []EngineRollModifier{}, Total: result,
+	}
+	if modifier := abilityScoreModifier(con); modifier != 0 {
+		roll.Modifiers = append(roll.Modifiers, EngineRollModifier{Value: modifier, Source: "ТЕЛ", Reason: "модификатор Телосложения"})
+		roll.Total += modifier
+	}
+	roll.Text = describeEngineRoll(roll)
+	return roll
+}
+
+var characterHitDiceKeyPattern = regexp.MustCompile(`(?i)^d(\d+)$`)
+
+// characterResourceMaxima — максимумы пулов по initResources клиента: кости
+// хитов (hit_dice_dN — уровни классов с этой костью; у сборки без записей
+// классов — hitDie на level), ячейки заклинаний по прогрессии классов,
+// ресурсы каждого класса с ресурсами подкласса поверх по уровню в этом классе
+// (by_level — ступень ≤ уровня, иначе count/max с self_level = уровень
+// класса) и гранты resource из пассивных механик. Пулы хода от уровня не
+// зависят и не считаются.
+func characterResourceMaxima(bundle characterFeatureBundle, hitDie string, level int, derivation CharacterDerivation) map[string]int {
+	maxima := map[string]int{}
+	hitDice := map[string]int{}
+	if len(bundle.Classes) == 0 {
+		hitDice[hitDie] = level
+	}
+	for _, entry := range bundle.Classes {
+		if entry.Class.HitDie != nil {
+			hitDice[*entry.Class.HitDie] += entry.Level
+		}
+	}
+	for die, count := range hitDice {
+		if match := characterHitDiceKeyPattern.FindStringSubmatch(strings.TrimSpace(die)); match != nil {
+			if sides, err := strconv.Atoi(match[1]); err == nil && sides >= 2 {
+				maxima[fmt.Sprintf("hit_dice_d%d", sides)] += count
+			}
+		}
+	}
+
+	// Ячейки колдующих классов считаются по таблицам прогрессии; ячейки
+	// из resources таких классов — устаревшая копия и пропускаются.
+	casters := characterCasterClasses(bundle, level)
+	for id, count := range characterSpellSlotMaxima(casters) {
+		maxima[id] = count
+	}
+	for _, entry := range bundle.classLevels(level) {
+		definitions := map[string]interface{}{}
+		for _, class := range []*Class{&entry.Class, entry.Subclass} {
+			if class != nil && class.Resources != nil {
+				for id, definition := range *class.Resources {
+					if len(casters) > 0 && characterSpellSlotKeyPattern.MatchString(id) {
+						continue
+					}
+					definitions[id] = definition
+				}
+			}
+		}
+		ctx := derivation.formula
+		ctx.SelfLevel = entry.Level
+		for id, raw := range definitions {
+			definition, _ := raw.(map[string]interface{})
+			count, ok := characterResourceByLevel(definition["by_level"], entry.Level)
+			if !ok {
+				countRaw, exists := definition["count"]
+				if !exists {
+					countRaw = definition["max"]
+				}
+				count, _ = characterFormulaInt(countRaw, ctx)
+			}
+			if count > 0 {
+				maxima[id] = count
+			}
+		}
+	}
+
+	for _, payload := range derivation.passive {
+		if payload["kind"] != "resource" || payload["op"] != "grant" {
+			continue
+		}
+		id := stringField(payload, "id")
+		amountRaw, exists := payload["amount"]
+		if !exists {
+			amountRaw = 1.0
+		}
+		amount, _ := characterFormulaInt(amountRaw, derivation.formula)
+		if id != "" && amount > 0 {
+			maxima[id] += amount
+		}
+	}
+	return maxima
+}
+
+// characterResourceByLevel — resolveByLevel клиента: значение с наибольшим
+// уровнем ≤ level.
+func characterResourceByLevel(raw interface{}, level int) (int, bool) {
+	byLevel, _ := raw.(map[string]interface{})
+	best, bestLevel := 0, -1
+	for key, value := range byLevel {
+		step, err := strconv.Atoi(key)
+		count, ok := mechanicsNumber(value)
+		if err != nil || !ok || step > level || step <= bestLevel {
+			continue
+		}
+		best, bestLevel = int(count), step
+	}
+	return best, bestLevel >= 0
+}
+
+func characterResourceChanges(before, after map[string]int) []CharacterResourceChange {
+	changes := []CharacterResourceChange{}
+	for id, value := range after {
+		if before[id] != value {
+			changes = append(changes, CharacterResourceChange{Resource: id, Before: before[id], After: value})
+		}
+	}
+	for id, value := range before {
+		if _, ok := after[id]; !ok {
+			changes = append(changes, CharacterResourceChange{Resource: id, Before: value, After: 0})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Resource < changes[j].Resource })
+	return changes
+}
+
+// applyCharacterResourceChanges переносит изменения максимумов в runtime:
+// текущее значение сдвигается на прирост максимума (как syncRuntimeResources
+// клиента) и обрезается новым максимумом; новый пул приходит полным.
+func applyCharacterResourceChanges(resources, maxResources *JSONMap, changes []CharacterResourceChange) (JSONMap, JSONMap) {
+	current := cloneJSONMapValue(resources)
+	maxima := cloneJSONMapValue(maxResources)
+	for _, change := range changes {
+		if change.After <= 0 {
+			delete(current, change.Resource)
+			delete(maxima, change.Resource)
+			continue
+		}
+		value := change.After
+		if stored, ok := mechanicsNumber(current[change.Resource]); ok {
+			value = int(stored) + change.After - change.Before
+		}
+		if value > change.After {
+			value = change.After
+		}
+		if value < 0 {
+			value = 0
+		}
+		current[change.Resource] = value
+		maxima[change.Resource] = change.After
+	}
+	return current, maxima
+}
+
+func writeCharacterLevelUpError(c *gin.Context, err *characterLevelUpError) {
+	payload := gin.H{"error": err.Message}
+	if err.Details != "" {
+		payload["details"] = err.Details
+	}
+	c.JSON(err.Status, payload)
+}
+
+// GetCharacterV3LevelUp отдаёт план следующего уровня: новые особенности,
+// обязательные выборы, подклассы и прирост ресурсов. ?subclass_id= показывает
+// план с выбранным подклассом.
+func (cc *CharacterV3Controller) GetCharacterV3LevelUp(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	character, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Read)
+	if !allowed {
+		return
+	}
+
+	state, err := planCharacterLevelUp(cc.db, *character, c.Query("class_id"), c.Query("subclass_id"), nil)
+	var levelUpErr *characterLevelUpError
+	if errors.As(err, &levelUpErr) {
+		writeCharacterLevelUpError(c, levelUpErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка расчёта нового уровня", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, state.Plan)
+}
+
+// LevelUpCharacterV3 повышает уровень персонажа на один. Все выборы плана
+// должны быть сделаны; хиты растут на кость (среднее или бросок сервера) плюс
+// изменение прочих источников максимума, снимок и пулы ресурсов
+// пересчитываются, в журнал пишется событие level_up. Запись идёт под
+// проверкой runtime_revision, как у runtime-команд.
+func (cc *CharacterV3Controller) LevelUpCharacterV3(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	if _, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Write); !allowed {
+		return
+	}
+
+	var req LevelUpCharacterV3Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+		return
+	}
+	if req.HPMethod == "" {
+		req.HPMethod = "average"
+	}
+	if req.HPMethod != "average" && req.HPMethod != "roll" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hp_method должен быть average или roll"})
+		return
+	}
+
+	var response LevelUpCharacterV3Response
+	txErr := cc.db.Transaction(func(tx *gorm.DB) error {
+		var locked CharacterV3
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCharacterV3OwnerChanged
+			}
+			return err
+		}
+		if locked.RuntimeRevision != *req.ExpectedRuntimeRevision {
+			expected := *req.ExpectedRuntimeRevision
+			actual := locked.RuntimeRevision
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "runtime_revision_conflict",
+				Message: "character runtime revision is stale", CharacterID: characterID.String(),
+				ExpectedRuntimeRevision: &expected, ActualRuntimeRevision: &actual,
+			}
+		}
+		if locked.CurrentEncounterID != nil {
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "character_in_encounter",
+				Message: "character is linked to an active encounter", CharacterID: characterID.String(),
+			}
+		}
+
+		state, err := planCharacterLevelUp(tx, locked, req.ClassID, req.SubclassID, req.Choices)
+		if err != nil {
+			return err
+		}
+		if len(state.Plan.Missing) > 0 {
+			return invalidCharacterLevelUp("не все выборы уровня сделаны", strings.Join(state.Plan.Missing, ", "))
+		}
+
+		// Кость уровня заменяет среднее, которое заложено в вывод; остальная
+		// разница выводов — Стойкость, ретроактивный рост ТЕЛ и т.п.
+		con := state.After.Abilities["con"]
+		gained := state.Plan.AverageHP
+		if req.HPMethod == "roll" {
+			roll := rollCharacterHitDie(newDiceRNG(0), state.HitDie, con)
+			response.Roll = &roll
+			gained = characterLevelUpHitPoints(roll.Dice[0].Result, con)
+		}
+		maxHP := locked.MaxHP + gained + state.After.Stats.MaxHP - state.Before.Stats.MaxHP - state.Plan.AverageHP
+		if maxHP < 1 {
+			maxHP = 1
+		}
+		currentHP := locked.CurrentHP + maxHP - locked.MaxHP
+		if currentHP > maxHP {
+			currentHP = maxHP
+		}
+		if currentHP < 0 {
+			currentHP = 0
+		}
+		resources, maxResources := applyCharacterResourceChanges(locked.Resources, locked.MaxResources, state.Plan.Resources)
+
+		stats := state.After.Stats
+		updates := map[string]interface{}{
+			"level":              state.Next.Level,
+			"classes":            *state.Next.Classes,
+			"resolved_choices":   *state.Next.ResolvedChoices,
+			"max_hp":             maxHP,
+			"current_hp":         currentHP,
+			"speed":              stats.Speed,
+			"proficiency_bonus":  stats.ProficiencyBonus,
+			"armor_class":        stats.ArmorClass,
+			"initiative_bonus":   stats.InitiativeBonus,
+			"passive_perception": stats.PassivePerception,
+			"resources":          resources,
+			"max_resources":      maxResources,
+			"runtime_revision":   locked.RuntimeRevision + 1,
+		}
+		if granted := state.Plan.Proficiencies; granted != nil {
+			sheet := locked
+			skills := req.Choices[characterMulticlassSkillsKey(uuid.MustParse(state.Plan.ClassID))]
+			applyCharacterClassProficiencies(&sheet, *granted, skills)
+			updates["tool_proficiencies"] = sheet.ToolProficiencies
+			updates["skill_proficiencies"] = sheet.SkillProficiencies
+			updates["rule_state"] = sheet.RuleState
+		}
+		result := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ? AND runtime_revision = ?", characterID, userID, locked.RuntimeRevision).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCharacterV3OwnerChanged
+		}
+
+		payload := JSONMap{
+			"type": "level_up", "level": state.Next.Level,
+			"hpGained": maxHP - locked.MaxHP, "method": req.HPMethod,
+			"classId": state.Plan.ClassID, "classLevel": state.Plan.ClassLevel,
+		}
+		if response.Roll != nil {
+			payload["roll"] = response.Roll.toJSONMap()
+		}
+		event := CharacterEvent{CharacterID: locked.ID, Ts: time.Now(), Type: "level_up", Payload: payload}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		response.LevelUp = state.Plan
+		response.HPMethod = req.HPMethod
+		response.HPGained = maxHP - locked.MaxHP
+		return tx.Preload("User").Preload("Group").First(&response.Character, locked.ID).Error
+	})
+	if errors.Is(txErr, errCharacterV3OwnerChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
+		return
+	}
+	var runtimeConflict *characterRuntimeCommandError
+	if errors.As(txErr, &runtimeConflict) {
+		writeCharacterRuntimeCommandError(c, txErr)
+		return
+	}
+	var levelUpErr *characterLevelUpError
+	if errors.As(txErr, &levelUpErr) {
+		writeCharacterLevelUpError(c, levelUpErr)
+		return
+	}
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка повышения уровня", "details": txErr.Error()})
+		return
+	}
+	response.Character.AccessMode = characterV3AccessOwner
+	c.JSON(http.StatusOK, response)
+}
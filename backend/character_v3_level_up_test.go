@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCollectCharacterLevelUpChoices(t *testing.T) {
+	source := characterMechanicsSource{
+		Key: "class:c1:e1", Name: "Прибавка характеристик",
+		Mechanics: mustMechanicsJSON(t, `{"effects":[{"resolution":"auto","result":[
+			{"kind":"choice","id":"path","options":{"source":"explicit","items":[
+				{"id":"asi","name":"Характеристики","grants":[{"kind":"choice","id":"asi_ability","count":2,"options":{"source":"ability"},"apply":{"kind":"grant_ability_score","amount":1}}]},
+				{"id":"feat","name":"Черта"}]}},
+			{"kind":"choice","id":"target","context":"in_play","options":{"source":"explicit"}}
+		]}]}`),
+	}
+
+	choices := collectCharacterLevelUpChoices([]characterMechanicsSource{source}, map[string][]string{})
+	if len(choices) != 1 || choices[0].Key != "class:c1:e1:path" || len(choices[0].Options) != 2 {
+		t.Fatalf("only the build-time top choice is expected, got %+v", choices)
+	}
+
+	choices = collectCharacterLevelUpChoices([]characterMechanicsSource{source}, map[string][]string{"class:c1:e1:path": {"asi"}})
+	if len(choices) != 2 || choices[1].Key != "class:c1:e1:asi_ability" || choices[1].Count != 2 || choices[1].Source != "ability" {
+		t.Fatalf("selected option must expose the nested choice, got %+v", choices)
+	}
+
+	if err := validateCharacterLevelUpChoice(choices[1], []string{"str", "con"}); err != nil {
+		t.Fatalf("valid abilities rejected: %v", err)
+	}
+	for _, values := range [][]string{{"str", "con", "dex"}, {"str", "str"}, {"luck"}} {
+		if err := validateCharacterLevelUpChoice(choices[1], values); err == nil {
+			t.Fatalf("invalid selection %v accepted", values)
+		}
+	}
+	if err := validateCharacterLevelUpChoice(choices[0], []string{"skill"}); err == nil {
+		t.Fatal("value outside options.items accepted")
+	}
+}
+
+func TestCharacterLevelUpGainsKeepMultiplicity(t *testing.T) {
+	asi := Effect{ID: uuid.New(), Name: "Прибавка характеристик"}
+	extra := Action{ID: uuid.New(), Name: "Дополнительная атака"}
+	origin := characterFeatureOrigin{Kind: "class", ID: uuid.New().String()}
+	before := characterFeatureBundle{Effects: []Effect{asi}, EffectOrigins: []characterFeatureOrigin{origin}}
+	after := characterFeatureBundle{
+		Effects: []Effect{asi, asi}, EffectOrigins: []characterFeatureOrigin{origin, origin},
+		Actions: []Action{extra}, ActionOrigins: []characterFeatureOrigin{origin},
+	}
+
+	effects, actions, _ := characterLevelUpGains(before, after)
+	if len(effects) != 1 || effects[0].ID != asi.ID.String() || len(actions) != 1 {
+		t.Fatalf("unexpected gains: effects=%v actions=%v", effects, actions)
+	}
+}
+
+func TestCharacterLevelUpHitPointsAndResources(t *testing.T) {
+	if hp := characterLevelUpHitPoints(6, 14); hp != 8 {
+		t.Fatalf("d10 average with CON 14 must give 8, got %d", hp)
+	}
+	if hp := characterLevelUpHitPoints(1, 6); hp != 1 {
+		t.Fatalf("level must give at least 1 HP, got %d", hp)
+	}
+	roll := rollCharacterHitDie(newDiceRNG(7), 10, 14)
+	if len(roll.Dice) != 1 || roll.Total != roll.Dice[0].Result+2 || roll.Dice[0].Result < 1 || roll.Dice[0].Result > 10 {
+		t.Fatalf("unexpected hit die roll: %+v", roll)
+	}
+
+	resources := JSONMap(mustMechanicsJSON(t, `{"rage":{"by_level":{"1":2,"3":3,"6":4},"per":"long_rest"},"ki":{"count":"self_level"}}`))
+	class := &Class{Resources: &resources}
+	derivation := CharacterDerivation{formula: formulaContext{SelfLevel: 3}, passive: []map[string]interface{}{
+		{"kind": "resource", "op": "grant", "id": "luck", "amount": 3.0},
+	}}
+	maxima := characterResourceMaxima(characterFeatureBundle{Class: class}, "d12", 3, derivation)
+	if maxima["rage"] != 3 || maxima["ki"] != 3 || maxima["hit_dice_d12"] != 3 || maxima["luck"] != 3 {
+		t.Fatalf("unexpected maxima: %v", maxima)
+	}
+
+	changes := characterResourceChanges(map[string]int{"rage": 2, "hit_dice_d12": 2, "luck": 3}, maxima)
+	current := JSONMap{"rage": 0.0, "hit_dice_d12": 2.0, "luck": 3.0}
+	maximum := JSONMap{"rage": 2.0, "hit_dice_d12": 2.0, "luck": 3.0}
+	updated, updatedMax := applyCharacterResourceChanges(&current, &maximum, changes)
+	if updated["rage"] != 1 || updated["hit_dice_d12"] != 3 || updated["ki"] != 3 || updated["luck"] != 3.0 {
+		t.Fatalf("unexpected runtime pools: %v", updated)
+	}
+	if updatedMax["rage"] != 3 || updatedMax["ki"] != 3 {
+		t.Fatalf("unexpected maxima: %v", updatedMax)
+	}
+	if current["rage"] != 0.0 {
+		t.Fatal("source runtime map must stay untouched")
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// classMulticlassMinScore — порог характеристики для мультикласса по умолчанию.
+const classMulticlassMinScore = 13
+
+// classMulticlass — декларация classes.multiclass:
+//
+//	{"prerequisites": {"all": ["str", "cha"], "min_score": 13},
+//	 "proficiencies": {"armor": ["light"], "weapons": ["martial"],
+//	                   "tools": ["thieves_tools"], "skills": 1}}
+//
+// prerequisites — all (каждая характеристика) или any (хотя бы одна) не ниже
+// min_score; proficiencies — ограниченный список владений класса, взятого не
+// первым (skills — сколько навыков выбрать из skill_choices класса).
+type classMulticlass struct {
+	Mode      string
+	Abilities []string
+	MinScore  int
+	Armor     []string
+	Weapons   []string
+	Tools     []string
+	Skills    int
+}
+
+// parseClassMulticlass разбирает и проверяет декларацию. ok == false —
+// декларации нет.
+func parseClassMulticlass(raw *JSONMap) (classMulticlass, bool, error) {
+	multiclass := classMulticlass{Mode: "all", MinScore: classMulticlassMinScore}
+	if raw == nil || len(*raw) == 0 {
+		return multiclass, false, nil
+	}
+	definition := *raw
+	if rawPrerequisites, exists := definition["prerequisites"]; exists {
+		prerequisites, isMap := rawPrerequisites.(map[string]interface{})
+		if !isMap {
+			return multiclass, false, fmt.Errorf("multiclass.prerequisites должен быть объектом")
+		}
+		_, hasAll := prerequisites["all"]
+		_, hasAny := prerequisites["any"]
+		if hasAll == hasAny {
+			return multiclass, false, fmt.Errorf("multiclass.prerequisites задаёт ровно одно из all или any")
+		}
+		if hasAny {
+			multiclass.Mode = "any"
+		}
+		abilities, err := classMulticlassList(prerequisites[multiclass.Mode], "prerequisites."+multiclass.Mode)
+		if err != nil {
+			return multiclass, false, err
+		}
+		for _, ability := range abilities {
+			if !isAbilityKey(ability) {
+				return multiclass, false, fmt.Errorf("multiclass.prerequisites.%s: %q не является характеристикой", multiclass.Mode, ability)
+			}
+		}
+		multiclass.Abilities = abilities
+		if rawScore, exists := prerequisites["min_score"]; exists {
+			score, ok := mechanicsNumber(rawScore)
+			if !ok || score < 1 || score > 30 || score != float64(int(score)) {
+				return multiclass, false, fmt.Errorf("multiclass.prerequisites.min_score должен быть значением 1–30")
+			}
+			multiclass.MinScore = int(score)
+		}
+	}
+	if rawProficiencies, exists := definition["proficiencies"]; exists {
+		proficiencies, isMap := rawProficiencies.(map[string]interface{})
+		if !isMap {
+			return multiclass, false, fmt.Errorf("multiclass.proficiencies должен быть объектом")
+		}
+		var err error
+		if multiclass.Armor, err = classMulticlassList(proficiencies["armor"], "proficiencies.armor"); err != nil {
+			return multiclass, false, err
+		}
+		if multiclass.Weapons, err = classMulticlassList(proficiencies["weapons"], "proficiencies.weapons"); err != nil {
+			return multiclass, false, err
+		}
+		if multiclass.Tools, err = classMulticlassList(proficiencies["tools"], "proficiencies.tools"); err != nil {
+			return multiclass, false, err
+		}
+		if rawSkills, exists := proficiencies["skills"]; exists {
+			skills, ok := mechanicsNumber(rawSkills)
+			if !ok || skills < 0 || skills > 18 || skills != float64(int(skills)) {
+				return multiclass, false, fmt.Errorf("multiclass.proficiencies.skills должен быть числом навыков")
+			}
+			multiclass.Skills = int(skills)
+		}
+	}
+	return multiclass, true, nil
+}
+
+// classMulticlassList — список непустых строк; отсутствие поля — пустой список.
+func classMulticlassList(raw interface{}, field string) ([]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	items, isList := raw.([]interface{})
+	if !isList {
+		return nil, fmt.Errorf("multiclass.%s должен быть списком", field)
+	}
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("multiclass.%s содержит пустой или нестроковый элемент", field)
+		}
+		result = append(result, strings.TrimSpace(value))
+	}
+	return result, nil
+}
+
+// characterClassMulticlass — правила мультикласса класса. Без декларации
+// требуются все основные характеристики класса (primary_abilities) не ниже
+// 13, а владений мультикласс не даёт.
+func characterClassMulticlass(class Class) classMulticlass {
+	if multiclass, ok, err := parseClassMulticlass(class.Multiclass); err == nil && ok {
+		return multiclass
+	}
+	multiclass := classMulticlass{Mode: "all", MinScore: classMulticlassMinScore}
+	if class.PrimaryAbilities != nil {
+		for _, ability := range *class.PrimaryAbilities {
+			if ability = strings.ToLower(strings.TrimSpace(ability)); isAbilityKey(ability) {
+				multiclass.Abilities = append(multiclass.Abilities, ability)
+			}
+		}
+	}
+	return multiclass
+}
+
+// satisfied — базовые характеристики удовлетворяют требованию класса.
+func (m classMulticlass) satisfied(abilities map[string]int) bool {
+	if len(m.Abilities) == 0 {
+		return true
+	}
+	for _, ability := range m.Abilities {
+		met := abilities[ability] >= m.MinScore
+		if m.Mode == "any" && met {
+			return true
+		}
+		if m.Mode != "any" && !met {
+			return false
+		}
+	}
+	return m.Mode != "any"
+}
+
+// describe — требование для сообщения об ошибке: «str ≥ 13 и cha ≥ 13».
+func (m classMulticlass) describe() string {
+	parts := make([]string, 0, len(m.Abilities))
+	for _, ability := range m.Abilities {
+		parts = append(parts, fmt.Sprintf("%s ≥ %d", ability, m.MinScore))
+	}
+	separator := " и "
+	if m.Mode == "any" {
+		separator = " или "
+	}
+	return strings.Join(parts, separator)
+}
+
+// characterBaseAbilities — введённые характеристики листа (колонка abilities).
+func characterBaseAbilities(character CharacterV3) map[string]int {
+	abilities := map[string]int{}
+	if character.Abilities == nil {
+		return abilities
+	}
+	for _, key := range abilityKeys {
+		if value, ok := mechanicsNumber((*character.Abilities)[key]); ok {
+			abilities[key] = int(value)
+		}
+	}
+	return abilities
+}
+
+// characterClassEntries — классы персонажа по порядку взятия. Лист без
+// списка классов (до миграции или от старого клиента) — один класс class_id
+// на уровне level. Подкласс первого класса без явного subclass_id берётся из
+// выбора конструктора builder:subclass.
+func characterClassEntries(character CharacterV3) []CharacterClassEntry {
+	var entries []CharacterClassEntry
+	if character.Classes != nil && len(*character.Classes) > 0 {
+		entries = append(entries, (*character.Classes)...)
+	} else if character.ClassID != nil {
+		level := character.Level
+		if level < 1 {
+			level = 1
+		}
+		entries = []CharacterClassEntry{{ClassID: *character.ClassID, Level: level}}
+	}
+	if len(entries) > 0 && entries[0].SubclassID == nil {
+		if subclassID, ok := characterSubclassID(character); ok {
+			entries[0].SubclassID = &subclassID
+		}
+	}
+	return entries
+}
+
+// characterClassEntriesLevel — суммарный уровень по классам.
+func characterClassEntriesLevel(entries []CharacterClassEntry) int {
+	total := 0
+	for _, entry := range entries {
+		total += entry.Level
+	}
+	return total
+}
+
+// reconcileCharacterClasses сводит classes, class_id и level к одному виду:
+// присланный список классов задаёт class_id (первый класс) и level (сумму
+// уровней). Без списка класс правится через class_id/level, как раньше:
+// мультикласс с тем же первым классом сохраняет свои записи и суммарный
+// уровень, иначе список пересобирается из class_id и level.
+func reconcileCharacterClasses(character *CharacterV3, requested *CharacterClassEntries) {
+	if requested != nil && len(*requested) > 0 {
+		entries := append(CharacterClassEntries(nil), (*requested)...)
+		classID := entries[0].ClassID
+		character.Classes = &entries
+		character.ClassID = &classID
+		character.Level = characterClassEntriesLevel(entries)
+		return
+	}
+	if stored := character.Classes; stored != nil && len(*stored) > 1 &&
+		character.ClassID != nil && (*stored)[0].ClassID == *character.ClassID {
+		entries := append(CharacterClassEntries(nil), (*stored)...)
+		if subclassID, ok := characterSubclassID(*character); ok {
+			entries[0].SubclassID = &subclassID
+		}
+		character.Classes = &entries
+		character.Level = characterClassEntriesLevel(entries)
+		return
+	}
+	character.Classes = nil
+	if character.ClassID == nil {
+		return
+	}
+	entries := CharacterClassEntries(characterClassEntries(*character))
+	character.Classes = &entries
+}
+
+func invalidCharacterClasses(message, details string) error {
+	return &characterLevelUpError{Status: http.StatusUnprocessableEntity, Message: message, Details: details}
+}
+
+// validateCharacterClasses проверяет список классов: классы есть в каталоге
+// и не являются подклассами, не повторяются, подкласс принадлежит своему
+// классу, уровни не ниже 1 и в сумме не выше maxCharacterLevel. Если список
+// пополнился новым классом, базовые характеристики должны удовлетворять
+// требованиям мультикласса всех его классов — и прежних, и нового.
+func validateCharacterClasses(db *gorm.DB, entries, previous []CharacterClassEntry, abilities map[string]int) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	seen := map[uuid.UUID]bool{}
+	ids := make([]uuid.UUID, 0, len(entries)*2)
+	for _, entry := range entries {
+		if entry.Level < 1 {
+			return invalidCharacterClasses("уровень в классе должен быть не ниже 1", entry.ClassID.String())
+		}
+		if seen[entry.ClassID] {
+			return invalidCharacterClasses("класс указан дважды", entry.ClassID.String())
+		}
+		seen[entry.ClassID] = true
+		ids = append(ids, entry.ClassID)
+		if entry.SubclassID != nil {
+			ids = append(ids, *entry.SubclassID)
+		}
+	}
+	if total := characterClassEntriesLevel(entries); total > maxCharacterLevel {
+		return invalidCharacterClasses("суммарный уровень выше максимального", fmt.Sprintf("%d > %d", total, maxCharacterLevel))
+	}
+
+	var rows []Class
+	if err := db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]Class, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+	for _, entry := range entries {
+		class, ok := byID[entry.ClassID]
+		if !ok {
+			return invalidCharacterClasses("класс не найден", entry.ClassID.String())
+		}
+		if class.IsSubclass != nil && *class.IsSubclass {
+			return invalidCharacterClasses("подкласс указан как класс", class.Name)
+		}
+		if entry.SubclassID != nil {
+			subclass, ok := byID[*entry.SubclassID]
+			if !ok || subclass.ParentClassID == nil || *subclass.ParentClassID != entry.ClassID {
+				return invalidCharacterClasses("подкласс не принадлежит классу", class.Name+": "+entry.SubclassID.String())
+			}
+		}
+	}
+
+	known := map[uuid.UUID]bool{}
+	for _, entry := range previous {
+		known[entry.ClassID] = true
+	}
+	added := false
+	for _, entry := range entries {
+		added = added || !known[entry.ClassID]
+	}
+	if len(entries) < 2 || !added {
+		return nil
+	}
+	var unmet []string
+	for _, entry := range entries {
+		class := byID[entry.ClassID]
+		if multiclass := characterClassMulticlass(class); !multiclass.satisfied(abilities) {
+			unmet = append(unmet, class.Name+": "+multiclass.describe())
+		}
+	}
+	if len(unmet) > 0 {
+		return invalidCharacterClasses("не выполнены требования мультикласса", strings.Join(unmet, "; "))
+	}
+	return nil
+}
+
+// CharacterClassProficiencies — владения, которые даёт класс: полный набор
+// для первого класса персонажа, ограниченный список мультикласса — для
+// остальных. Skills — сколько навыков выбрать из SkillOptions.
+type CharacterClassProficiencies struct {
+	Armor        []string `json:"armor"`
+	Weapons      []string `json:"weapons"`
+	Tools        []string `json:"tools"`
+	SavingThrows []string `json:"saving_throws"`
+	Skills       int      `json:"skills"`
+	SkillOptions []string `json:"skill_options,omitempty"`
+}
+
+// characterClassProficiencies — владения класса. Спасброски даёт только
+// первый класс.
+func characterClassProficiencies(class Class, first bool) CharacterClassProficiencies {
+	proficiencies := CharacterClassProficiencies{Armor: []string{}, Weapons: []string{}, Tools: []string{}, SavingThrows: []string{}}
+	if class.SkillChoices != nil {
+		proficiencies.SkillOptions = stringList((*class.SkillChoices)["options"])
+	}
+	if !first {
+		multiclass := characterClassMulticlass(class)
+		proficiencies.Armor = append(proficiencies.Armor, multiclass.Armor...)
+		proficiencies.Weapons = append(proficiencies.Weapons, multiclass.Weapons...)
+		proficiencies.Tools = append(proficiencies.Tools, multiclass.Tools...)
+		proficiencies.Skills = multiclass.Skills
+		return proficiencies
+	}
+	for _, list := range []struct {
+		target *[]string
+		source *Properties
+	}{
+		{&proficiencies.Armor, class.ArmorTraining},
+		{&proficiencies.Weapons, class.WeaponProficiencies},
+		{&proficiencies.Tools, class.ToolProficiencies},
+		{&proficiencies.SavingThrows, class.SavingThrows},
+	} {
+		if list.source != nil {
+			*list.target = append(*list.target, *list.source...)
+		}
+	}
+	if class.SkillChoices != nil {
+		if count, ok := mechanicsNumber((*class.SkillChoices)["count"]); ok && count > 0 {
+			proficiencies.Skills = int(count)
+		}
+	}
+	return proficiencies
+}
+
+// characterMulticlassSkillsKey — ключ resolved_choices для навыков мультикласса.
+func characterMulticlassSkillsKey(classID uuid.UUID) string {
+	return "multiclass:" + classID.String() + ":skills"
+}
+
+// applyCharacterClassProficiencies добавляет владения класса и выбранные
+// навыки к листу: инструменты и навыки — в колонки, всё вместе — в
+// rule_state.proficiencies, откуда их берёт лист.
+func applyCharacterClassProficiencies(character *CharacterV3, granted CharacterClassProficiencies, skills []string) {
+	character.ToolProficiencies = mergeCharacterProficiencies(character.ToolProficiencies, granted.Tools)
+	character.SkillProficiencies = mergeCharacterProficiencies(character.SkillProficiencies, skills)
+
+	state := cloneJSONMapValue(character.RuleState)
+	proficiencies, _ := state["proficiencies"].(map[string]interface{})
+	merged := make(map[string]interface{}, len(proficiencies)+4)
+	for key, value := range proficiencies {
+		merged[key] = value
+	}
+	for key, values := range map[string][]string{
+		"armor": granted.Armor, "weapons": granted.Weapons, "tools": granted.Tools, "skills": skills,
+	} {
+		current := Properties(stringList(merged[key]))
+		list := []interface{}{}
+		for _, value := range *mergeCharacterProficiencies(&current, values) {
+			list = append(list, value)
+		}
+		merged[key] = list
+	}
+	state["proficiencies"] = merged
+	character.RuleState = &state
+}
+
+// mergeCharacterProficiencies дописывает недостающие владения, сохраняя порядок.
+func mergeCharacterProficiencies(current *Properties, added []string) *Properties {
+	merged := Properties{}
+	seen := map[string]bool{}
+	if current != nil {
+		for _, value := range *current {
+			if !seen[value] {
+				seen[value] = true
+				merged = append(merged, value)
+			}
+		}
+	}
+	for _, value := range added {
+		if !seen[value] {
+			seen[value] = true
+			merged = append(merged, value)
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseClassMulticlass(t *testing.T) {
+	raw := JSONMap(mustMechanicsJSON(t, `{"prerequisites":{"any":["str","dex"]},"proficiencies":{"armor":["light"],"tools":["thieves_tools"],"skills":1}}`))
+	multiclass, ok, err := parseClassMulticlass(&raw)
+	if err != nil || !ok || multiclass.Mode != "any" || multiclass.MinScore != 13 || multiclass.Skills != 1 {
+		t.Fatalf("declaration must parse: %+v %v", multiclass, err)
+	}
+	if !multiclass.satisfied(map[string]int{"str": 8, "dex": 13}) || multiclass.satisfied(map[string]int{"str": 12, "dex": 12}) {
+		t.Fatal("any requires one ability at the threshold")
+	}
+	for _, invalid := range []string{
+		`{"prerequisites":{"all":["str"],"any":["dex"]}}`,
+		`{"prerequisites":{"all":["luck"]}}`,
+		`{"prerequisites":{"all":["str"],"min_score":13.5}}`,
+		`{"proficiencies":{"armor":"light"}}`,
+		`{"proficiencies":{"skills":-1}}`,
+	} {
+		raw := JSONMap(mustMechanicsJSON(t, invalid))
+		if _, _, err := parseClassMulticlass(&raw); err == nil {
+			t.Fatalf("declaration %s must be rejected", invalid)
+		}
+	}
+
+	primary := Properties{"str", "cha"}
+	paladin := characterClassMulticlass(Class{PrimaryAbilities: &primary})
+	if paladin.satisfied(map[string]int{"str": 15, "cha": 12}) || !paladin.satisfied(map[string]int{"str": 13, "cha": 13}) {
+		t.Fatal("without declaration every primary ability must reach 13")
+	}
+	if paladin.describe() != "str ≥ 13 и cha ≥ 13" {
+		t.Fatalf("unexpected requirement text: %q", paladin.describe())
+	}
+}
+
+func TestReconcileCharacterClasses(t *testing.T) {
+	fighter, wizard, champion := uuid.New(), uuid.New(), uuid.New()
+	choices := JSONMap{characterSubclassChoiceKey: []interface{}{champion.String()}}
+
+	character := CharacterV3{ClassID: &fighter, Level: 4, ResolvedChoices: &choices}
+	reconcileCharacterClasses(&character, nil)
+	if entries := *character.Classes; len(entries) != 1 || entries[0].Level != 4 || *entries[0].SubclassID != champion {
+		t.Fatalf("legacy class must become a single entry with the builder subclass: %+v", entries)
+	}
+
+	requested := CharacterClassEntries{{ClassID: wizard, Level: 2}, {ClassID: fighter, Level: 3}}
+	reconcileCharacterClasses(&character, &requested)
+	if *character.ClassID != wizard || character.Level != 5 || len(*character.Classes) != 2 {
+		t.Fatalf("entries define class_id and total level: %+v", character)
+	}
+
+	// Старый клиент присылает прежний class_id и свой level — записи остаются.
+	character.Level = 2
+	reconcileCharacterClasses(&character, nil)
+	if character.Level != 5 || len(*character.Classes) != 2 {
+		t.Fatalf("multiclass entries must survive a legacy update: %+v", character)
+	}
+	character.ClassID = &fighter
+	reconcileCharacterClasses(&character, nil)
+	if entries := *character.Classes; len(entries) != 1 || entries[0].ClassID != fighter || character.Level != 5 {
+		t.Fatalf("changing the first class resets to a single class: %+v", entries)
+	}
+}
+
+func TestCharacterMulticlassDerivation(t *testing.T) {
+	d10, d6 := "d10", "d6"
+	fighterResources := JSONMap(mustMechanicsJSON(t, `{"second_wind":{"by_level":{"1":2,"4":3}},"surge":{"count":"self_level"}}`))
+	wizardSpellcasting := JSONMap(mustMechanicsJSON(t, `{"progression":"full","ability":"int"}`))
+	bundle := characterFeatureBundle{Classes: []characterClassLevel{
+		{Class: Class{ID: uuid.New(), HitDie: &d10, Resources: &fighterResources}, Level: 3},
+		{Class: Class{ID: uuid.New(), HitDie: &d6, Spellcasting: &wizardSpellcasting}, Level: 2},
+	}}
+	bundle.Class = &bundle.Classes[0].Class
+
+	maxima := characterResourceMaxima(bundle, d10, 5, CharacterDerivation{formula: formulaContext{SelfLevel: 5}})
+	want := map[string]int{"hit_dice_d10": 3, "hit_dice_d6": 2, "second_wind": 2, "surge": 3, "spell_slot_1": 3}
+	if len(maxima) != len(want) {
+		t.Fatalf("got %v, want %v", maxima, want)
+	}
+	for key, value := range want {
+		if maxima[key] != value {
+			t.Fatalf("got %v, want %v", maxima, want)
+		}
+	}
+
+	// Воин 3 + волшебник 2, ТЕЛ 14: 10+2, 2×(6+2), 2×(4+2).
+	dice := []characterClassHitDie{{HitDie: d10, Levels: 3}, {HitDie: d6, Levels: 2}}
+	if hp := characterClassesMaxHP(dice, 14); hp != 40 {
+		t.Fatalf("multiclass max HP = %d, want 40", hp)
+	}
+	if characterClassesMaxHP(dice[:1], 14) != characterBaseMaxHP(d10, 14, 3) {
+		t.Fatal("single class must match the base formula")
+	}
+}
+
+func TestCharacterClassProficiencies(t *testing.T) {
+	armor, weapons, saves := Properties{"light", "medium", "heavy", "shields"}, Properties{"simple", "martial"}, Properties{"str", "con"}
+	skills := JSONMap(mustMechanicsJSON(t, `{"count":2,"options":["athletics","survival"]}`))
+	multiclass := JSONMap(mustMechanicsJSON(t, `{"prerequisites":{"any":["str","dex"]},"proficiencies":{"armor":["light","medium","shields"],"weapons":["martial"]}}`))
+	fighter := Class{ArmorTraining: &armor, WeaponProficiencies: &weapons, SavingThrows: &saves, SkillChoices: &skills, Multiclass: &multiclass}
+
+	first := characterClassProficiencies(fighter, true)
+	if len(first.Armor) != 4 || len(first.SavingThrows) != 2 || first.Skills != 2 {
+		t.Fatalf("first class grants its full list: %+v", first)
+	}
+	later := characterClassProficiencies(fighter, false)
+	if len(later.Armor) != 3 || len(later.Weapons) != 1 || len(later.SavingThrows) != 0 || later.Skills != 0 {
+		t.Fatalf("multiclass grants only the restricted list: %+v", later)
+	}
+
+	tools := Properties{"thieves_tools"}
+	state := JSONMap(mustMechanicsJSON(t, `{"proficiencies":{"armor":["light"],"skills":["stealth"],"languages":["common"]}}`))
+	character := CharacterV3{ToolProficiencies: &tools, RuleState: &state}
+	applyCharacterClassProficiencies(&character, later, []string{"athletics"})
+	proficiencies := (*character.RuleState)["proficiencies"].(map[string]interface{})
+	if len(stringList(proficiencies["armor"])) != 3 || len(stringList(proficiencies["skills"])) != 2 || len(stringList(proficiencies["languages"])) != 1 {
+		t.Fatalf("rule state proficiencies must be merged: %v", proficiencies)
+	}
+	if len(*character.SkillProficiencies) != 1 || len(*character.ToolProficiencies) != 1 {
+		t.Fatalf("columns must be merged: %v %v", *character.SkillProficiencies, *character.ToolProficiencies)
+	}
+	if len(stringList(state["proficiencies"].(map[string]interface{})["armor"])) != 1 {
+		t.Fatal("source rule state must stay untouched")
+	}
+}
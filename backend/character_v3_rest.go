@@ -0,0 +1,521 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCharacterRestBodyBytes = 1 << 10
+
+// Короткий отдых — час (600 раундов), длинный — восемь часов (4800 раундов).
+const (
+	characterShortRestRounds = 600
+	characterLongRestRounds  = 4800
+)
+
+// characterTurnResources — пулы экономики хода: их восстанавливает начало хода, не отдых.
+var characterTurnResources = map[string]bool{"action": true, "bonus_action": true, "reaction": true}
+
+// characterConditionLongRestDefaults — встроенные правила состояний для
+// длинного отдыха (registry в frontend/src/engine/conditions.ts): сколько
+// уровней снимается. Механика COND-<id> с long_rest.remove_levels важнее.
+var characterConditionLongRestDefaults = map[string]int{"exhaustion": 1}
+
+// characterRestRecovery — явная политика mechanics.uses.recovery: короткий
+// отдых возвращает ShortRest зарядов, длинный — все. Невалидная политика
+// (Valid == false) не восстанавливает ничего.
+type characterRestRecovery struct {
+	Valid     bool
+	ShortRest int
+}
+
+// characterRestPolicy — когда перезаряжается каждый пул: recharge
+// (short_rest | long_rest | day | never …) и явные политики восстановления.
+type characterRestPolicy struct {
+	Recharge map[string]string
+	Recovery map[string]characterRestRecovery
+}
+
+// characterRestInput — всё, что нужно отдыху кроме самого листа.
+type characterRestInput struct {
+	Mode          string
+	Policy        characterRestPolicy
+	HitDie        string
+	Con           int
+	HitDice       int
+	RNG           diceRNG
+	ConditionRest map[string]int
+}
+
+// characterRestOutcome — runtime-поля листа после отдыха и события журнала
+// в порядке их возникновения.
+type characterRestOutcome struct {
+	CurrentHP     int
+	Resources     JSONMap
+	ActiveEffects ActiveEffectRows
+	TurnState     JSONMap
+	Events        []JSONMap
+}
+
+// parseCharacterRestRecovery — resolveActionUsesRecovery клиента: ровно
+// {short_rest: {mode: fixed, amount}, long_rest: {mode: full}}. ok == false —
+// политики нет (legacy uses.per).
+func parseCharacterRestRecovery(mechanics JSONMap) (characterRestRecovery, bool) {
+	uses, _ := mechanics["uses"].(map[string]interface{})
+	raw, exists := uses["recovery"]
+	if !exists {
+		return characterRestRecovery{}, false
+	}
+	recovery, _ := raw.(map[string]interface{})
+	shortRest, _ := recovery["short_rest"].(map[string]interface{})
+	longRest, _ := recovery["long_rest"].(map[string]interface{})
+	if len(recovery) != 2 || len(shortRest) != 2 || len(longRest) != 1 ||
+		shortRest["mode"] != "fixed" || longRest["mode"] != "full" {
+		return characterRestRecovery{}, true
+	}
+	amount, ok := mechanicsNumber(shortRest["amount"])
+	if !ok || amount <= 0 || amount != float64(int(amount)) {
+		return characterRestRecovery{}, true
+	}
+	return characterRestRecovery{Valid: true, ShortRest: int(amount)}, true
+}
+
+// characterUsesPoolKey — ключ виртуального пула использований
+// uses_<card_number|id> (actionUsesKey в frontend/src/engine/actionUses.ts).
+func characterUsesPoolKey(cardNumber string, id uuid.UUID) string {
+	if cardNumber != "" {
+		return "uses_" + cardNumber
+	}
+	return "uses_" + id.String()
+}
+
+// buildCharacterRestPolicy собирает recharge-карту как лист
+// (SheetRestButtons): справочник ресурсов, ресурсы классов и подклассов, пулы
+// uses_ активных способностей и freeuse- заклинаний — каждый следующий
+// источник важнее предыдущего.
+func buildCharacterRestPolicy(catalog []ResourceDefinition, bundle characterFeatureBundle, passive []map[string]interface{}) characterRestPolicy {
+	policy := characterRestPolicy{Recharge: map[string]string{}, Recovery: map[string]characterRestRecovery{}}
+	for _, resource := range catalog {
+		if resource.Recharge != "" {
+			policy.Recharge[resource.ResourceID] = resource.Recharge
+		}
+	}
+	for _, entry := range bundle.classLevels(0) {
+		for _, class := range []*Class{&entry.Class, entry.Subclass} {
+			if class == nil || class.Resources == nil {
+				continue
+			}
+			for id, raw := range *class.Resources {
+				definition, _ := raw.(map[string]interface{})
+				if per := stringFieldOr(definition, "per", stringField(definition, "recharge")); per != "" {
+					policy.Recharge[id] = per
+				}
+			}
+		}
+	}
+
+	addUses := func(key string, mechanics *JSONMap) {
+		if mechanics == nil {
+			return
+		}
+		activation, _ := (*mechanics)["activation"].(map[string]interface{})
+		uses, _ := (*mechanics)["uses"].(map[string]interface{})
+		if uses == nil || stringField(activation, "mode") != "active" {
+			return
+		}
+		if _, known := policy.Recovery[key]; known {
+			return
+		}
+		if recovery, declared := parseCharacterRestRecovery(*mechanics); declared {
+			policy.Recovery[key] = recovery
+			if !recovery.Valid {
+				policy.Recharge[key] = "never"
+			} else {
+				policy.Recharge[key] = "short_rest"
+			}
+			return
+		}
+		if per := stringField(uses, "per"); per != "" {
+			policy.Recharge[key] = per
+		}
+	}
+	for _, action := range bundle.Actions {
+		addUses(characterUsesPoolKey(action.CardNumber, action.ID), action.Mechanics)
+	}
+	for _, effect := range bundle.Effects {
+		addUses(characterUsesPoolKey(effect.CardNumber, effect.ID), effect.Mechanics)
+	}
+
+	for _, payload := range passive {
+		raw, exists := payload["freeuse"]
+		spell := stringField(payload, "value")
+		if payload["kind"] != "grant_spell" || !exists || raw == nil || raw == false || spell == "" {
+			continue
+		}
+		recharge := "long_rest"
+		if spec, ok := raw.(map[string]interface{}); ok {
+			recharge = stringFieldOr(spec, "recharge", recharge)
+		}
+		policy.Recharge["freeuse-"+spell] = recharge
+	}
+	return policy
+}
+
+// restCharacter применяет отдых к runtime-полям листа (shortRest/longRest в
+// frontend/src/engine/turn.ts). Короткий отдых тратит до HitDice костей хитов
+// (по одной, пока хиты не полны) и возвращает пулы short_rest; длинный
+// восстанавливает хиты, кости хитов и все пулы, кроме never, снимает
+// временные хиты и уровни состояний по их правилам. Эффекты с истёкшей за
+// отдых длительностью и expiry отдыха снимаются.
+func restCharacter(character CharacterV3, input characterRestInput) characterRestOutcome {
+	long := input.Mode == "long"
+	outcome := characterRestOutcome{
+		CurrentHP: character.CurrentHP,
+		Resources: cloneJSONMapValue(character.Resources),
+		TurnState: cloneJSONMapValue(character.TurnState),
+	}
+	maxima := cloneJSONMapValue(character.MaxResources)
+	if long {
+		outcome.Events = append(outcome.Events, JSONMap{"type": "long_rest"})
+	} else {
+		outcome.Events = append(outcome.Events, JSONMap{"type": "short_rest"})
+	}
+	current := func(key string) int {
+		value, _ := mechanicsNumber(outcome.Resources[key])
+		return int(value)
+	}
+	restore := func(key string, amount int) {
+		if amount <= 0 {
+			return
+		}
+		value := current(key) + amount
+		outcome.Resources[key] = value
+		outcome.Events = append(outcome.Events, JSONMap{"type": "resource_restored", "resource": key, "amount": amount, "current": value})
+	}
+
+	hitDiceKey := ""
+	sides := 0
+	if match := characterHitDiceKeyPattern.FindStringSubmatch(strings.TrimSpace(input.HitDie)); match != nil {
+		hitDiceKey = "hit_dice_d" + match[1]
+		sides = characterHitDieSides(input.HitDie)
+	}
+	if !long && hitDiceKey != "" && input.RNG != nil {
+		conMod := abilityScoreModifier(input.Con)
+		for spent := 0; spent < input.HitDice && outcome.CurrentHP < character.MaxHP && current(hitDiceKey) > 0; spent++ {
+			remaining := current(hitDiceKey) - 1
+			outcome.Resources[hitDiceKey] = remaining
+			roll := rollCharacterHitDie(input.RNG, sides, input.Con)
+			roll.Kind = "healing"
+			healing := roll.Dice[0].Result + conMod
+			if healing < 1 {
+				healing = 1
+			}
+			before := outcome.CurrentHP
+			outcome.CurrentHP = min(character.MaxHP, outcome.CurrentHP+healing)
+			outcome.Events = append(outcome.Events,
+				JSONMap{"type": "resource_spent", "resource": hitDiceKey, "amount": 1, "remaining": remaining},
+				JSONMap{"type": "healing", "amount": outcome.CurrentHP - before, "roll": roll.toJSONMap()},
+			)
+		}
+	}
+
+	keys := make([]string, 0, len(maxima))
+	for key := range maxima {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		maxValue, _ := mechanicsNumber(maxima[key])
+		missing := int(maxValue) - current(key)
+		if characterTurnResources[key] || missing <= 0 {
+			continue
+		}
+		recovery, declared := input.Policy.Recovery[key]
+		recharge := input.Policy.Recharge[key]
+		switch {
+		case long && recharge == "never":
+		case long && declared && !recovery.Valid:
+		case long:
+			restore(key, missing)
+		case strings.HasPrefix(key, "hit_dice_"):
+		case declared:
+			if recovery.Valid {
+				restore(key, min(missing, recovery.ShortRest))
+			}
+		case recharge == "short_rest":
+			restore(key, missing)
+		}
+	}
+
+	rounds := characterShortRestRounds
+	if long {
+		rounds = characterLongRestRounds
+	}
+	expired := func(row ActiveEffectRow) bool {
+		expiry := ""
+		if row.Expiry != nil {
+			expiry = *row.Expiry
+		}
+		if expiry == "short_rest" || (long && (expiry == "long_rest" || expiry == "until_rest")) {
+			return true
+		}
+		return row.RoundsLeft != nil && *row.RoundsLeft <= rounds
+	}
+	conditionLevels := map[string]int{}
+	if character.ActiveEffects != nil {
+		for _, row := range *character.ActiveEffects {
+			if expired(row) {
+				outcome.Events = append(outcome.Events, JSONMap{"type": "effect_expired", "name": row.Name})
+				continue
+			}
+			if row.RoundsLeft != nil {
+				left := *row.RoundsLeft - rounds
+				row.RoundsLeft = &left
+			}
+			if long && row.Mechanics["kind"] == "condition" {
+				condition := stringField(row.Mechanics, "value")
+				if conditionLevels[condition] < input.ConditionRest[condition] {
+					conditionLevels[condition]++
+					outcome.Events = append(outcome.Events, JSONMap{"type": "effect_expired", "name": row.Name})
+					continue
+				}
+			}
+			outcome.ActiveEffects = append(outcome.ActiveEffects, row)
+		}
+	}
+	if outcome.ActiveEffects == nil {
+		outcome.ActiveEffects = ActiveEffectRows{}
+	}
+
+	if long {
+		outcome.CurrentHP = character.MaxHP
+		outcome.TurnState["temp_hp"] = 0
+		if envelope, ok := outcome.TurnState["rules_engine_runtime_v1"].(map[string]interface{}); ok {
+			reset := make(map[string]interface{}, len(envelope))
+			for key, value := range envelope {
+				reset[key] = value
+			}
+			reset["firedThisRest"] = []interface{}{}
+			outcome.TurnState["rules_engine_runtime_v1"] = reset
+		}
+	}
+	return outcome
+}
+
+// loadCharacterConditionLongRest читает правила длинного отдыха состояний
+// листа: long_rest.remove_levels механики COND-<id> либо встроенное правило.
+func loadCharacterConditionLongRest(db *gorm.DB, character CharacterV3) (map[string]int, error) {
+	levels := map[string]int{}
+	var cardNumbers []string
+	if character.ActiveEffects != nil {
+		for _, row := range *character.ActiveEffects {
+			if value := stringField(row.Mechanics, "value"); row.Mechanics["kind"] == "condition" && value != "" {
+				if _, known := levels[value]; !known {
+					levels[value] = characterConditionLongRestDefaults[value]
+					cardNumbers = append(cardNumbers, "COND-"+value)
+				}
+			}
+		}
+	}
+	if len(cardNumbers) == 0 {
+		return levels, nil
+	}
+	var effects []Effect
+	if err := db.Where("card_number IN ?", cardNumbers).Find(&effects).Error; err != nil {
+		return nil, err
+	}
+	for _, effect := range effects {
+		if effect.Mechanics == nil {
+			continue
+		}
+		rule, _ := (*effect.Mechanics)["long_rest"].(map[string]interface{})
+		if removeLevels, ok := mechanicsNumber(rule["remove_levels"]); ok && removeLevels >= 0 {
+			levels[strings.TrimPrefix(effect.CardNumber, "COND-")] = int(removeLevels)
+		}
+	}
+	return levels, nil
+}
+
+// RestCharacterV3Request — отдых персонажа. hit_dice — сколько костей хитов
+// потратить на коротком отдыхе, hit_die — из какого пула («d6»; у мультикласса
+// пул hit_dice_dN у каждого размера кости, по умолчанию — кость первого класса).
+// Кости бросает сервер своим генератором: лечение записывается в лист, поэтому
+// seed клиента не принимается.
+type RestCharacterV3Request struct {
+	Mode                    string `json:"mode" binding:"required"`
+	ExpectedRuntimeRevision *int64 `json:"expected_runtime_revision" binding:"required"`
+	HitDice                 int    `json:"hit_dice" binding:"min=0,max=20"`
+	HitDie                  string `json:"hit_die" binding:"max=8"`
+}
+
+// characterRestHitDie — кость хитов, которую тратит короткий отдых: запрошенная,
+// если у персонажа есть её пул, иначе кость первого класса. ok == false — пула
+// запрошенной кости у персонажа нет.
+func characterRestHitDie(requested, fallback string, maxResources *JSONMap) (string, bool) {
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if requested == "" {
+		return fallback, true
+	}
+	match := characterHitDiceKeyPattern.FindStringSubmatch(requested)
+	if match == nil || maxResources == nil {
+		return "", false
+	}
+	if _, exists := (*maxResources)["hit_dice_d"+match[1]]; !exists {
+		return "", false
+	}
+	return "d" + match[1], true
+}
+
+// RestCharacterV3Response — записанные события отдыха и лист после него.
+type RestCharacterV3Response struct {
+	Mode      string           `json:"mode"`
+	Events    []CharacterEvent `json:"events"`
+	Character CharacterV3      `json:"character"`
+}
+
+// RestCharacterV3 проводит короткий или длинный отдых на сервере: пулы
+// восстанавливаются по recharge, эффекты истекают, каждое изменение пишется
+// в журнал (resource_restored, effect_expired, трата костей хитов — как
+// resource_spent + healing). Запись идёт под проверкой runtime_revision.
+func (cc *CharacterV3Controller) RestCharacterV3(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	if _, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Write); !allowed {
+		return
+	}
+
+	var req RestCharacterV3Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+		return
+	}
+	if req.Mode != "short" && req.Mode != "long" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode должен быть short или long"})
+		return
+	}
+
+	response := RestCharacterV3Response{Mode: req.Mode, Events: []CharacterEvent{}}
+	txErr := cc.db.Transaction(func(tx *gorm.DB) error {
+		var locked CharacterV3
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCharacterV3OwnerChanged
+			}
+			return err
+		}
+		if locked.RuntimeRevision != *req.ExpectedRuntimeRevision {
+			expected := *req.ExpectedRuntimeRevision
+			actual := locked.RuntimeRevision
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "runtime_revision_conflict",
+				Message: "character runtime revision is stale", CharacterID: characterID.String(),
+				ExpectedRuntimeRevision: &expected, ActualRuntimeRevision: &actual,
+			}
+		}
+		if locked.CurrentEncounterID != nil {
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "character_in_encounter",
+				Message: "character is linked to an active encounter", CharacterID: characterID.String(),
+			}
+		}
+
+		bundle, err := loadCharacterFeatureBundle(tx, locked)
+		if err != nil {
+			return err
+		}
+		derivationInput, err := characterBundleDerivationInput(tx, locked, bundle)
+		if err != nil {
+			return err
+		}
+		derivation := deriveCharacterStats(derivationInput)
+		var catalog []ResourceDefinition
+		if locked.MaxResources != nil && len(*locked.MaxResources) > 0 {
+			keys := make([]string, 0, len(*locked.MaxResources))
+			for key := range *locked.MaxResources {
+				keys = append(keys, key)
+			}
+			if err := tx.Where("resource_id IN ?", keys).Find(&catalog).Error; err != nil {
+				return err
+			}
+		}
+		hitDie, ok := characterRestHitDie(req.HitDie, derivationInput.HitDie, locked.MaxResources)
+		if !ok {
+			return &characterRuntimeCommandError{
+				Status: http.StatusUnprocessableEntity, Code: "hit_die_unavailable",
+				Message: "character has no hit dice pool of this size", CharacterID: characterID.String(),
+			}
+		}
+		input := characterRestInput{
+			Mode: req.Mode, Policy: buildCharacterRestPolicy(catalog, bundle, derivation.passive),
+			HitDie: hitDie, Con: derivation.Abilities["con"],
+			HitDice: req.HitDice, RNG: newDiceRNG(0),
+		}
+		if req.Mode == "long" {
+			if input.ConditionRest, err = loadCharacterConditionLongRest(tx, locked); err != nil {
+				return err
+			}
+		}
+		outcome := restCharacter(locked, input)
+
+		result := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ? AND runtime_revision = ?", characterID, userID, locked.RuntimeRevision).
+			Updates(map[string]interface{}{
+				"current_hp":       outcome.CurrentHP,
+				"resources":        outcome.Resources,
+				"active_effects":   outcome.ActiveEffects,
+				"turn_state":       outcome.TurnState,
+				"runtime_revision": locked.RuntimeRevision + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCharacterV3OwnerChanged
+		}
+
+		now := time.Now()
+		for _, payload := range outcome.Events {
+			row := CharacterEvent{CharacterID: locked.ID, Ts: now, Type: fmt.Sprint(payload["type"]), Payload: payload}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+			response.Events = append(response.Events, row)
+		}
+		return tx.Preload("User").Preload("Group").First(&response.Character, locked.ID).Error
+	})
+	if errors.Is(txErr, errCharacterV3OwnerChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
+		return
+	}
+	var runtimeConflict *characterRuntimeCommandError
+	if errors.As(txErr, &runtimeConflict) {
+		writeCharacterRuntimeCommandError(c, txErr)
+		return
+	}
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка отдыха персонажа", "details": txErr.Error()})
+		return
+	}
+	response.Character.AccessMode = characterV3AccessOwner
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func restTestCharacter(t *testing.T) CharacterV3 {
+	t.Helper()
+	resources := JSONMap(mustMechanicsJSON(t, `{"action":0,"hit_dice_d10":3,"uses_ACT-WIND":0,"uses_ACT-SURGE":0,"rage":1,"slot_material":0,"heroic_inspiration":0}`))
+	maxima := JSONMap(mustMechanicsJSON(t, `{"action":1,"hit_dice_d10":5,"uses_ACT-WIND":3,"uses_ACT-SURGE":1,"rage":3,"slot_material":2,"heroic_inspiration":1}`))
+	turnState := JSONMap(mustMechanicsJSON(t, `{"temp_hp":5,"rules_engine_runtime_v1":{"schemaVersion":1,"firedThisTurn":[],"firedThisRest":["relentless"]}}`))
+	short, long, manual := 300, 3000, "manual"
+	effects := ActiveEffectRows{
+		{ID: "1", Name: "Большая форма", RoundsLeft: &short},
+		{ID: "2", Name: "Доспех мага", RoundsLeft: &long},
+		{ID: "3", Name: "Проклятие", Expiry: &manual},
+		{ID: "4", Name: "Истощение", Mechanics: JSONMap{"kind": "condition", "value": "exhaustion"}},
+		{ID: "5", Name: "Истощение", Mechanics: JSONMap{"kind": "condition", "value": "exhaustion"}},
+	}
+	return CharacterV3{
+		ID: uuid.New(), Level: 5, MaxHP: 44, CurrentHP: 20,
+		Resources: &resources, MaxResources: &maxima, TurnState: &turnState, ActiveEffects: &effects,
+	}
+}
+
+func restTestPolicy(t *testing.T) characterRestPolicy {
+	t.Helper()
+	classResources := JSONMap(mustMechanicsJSON(t, `{"rage":{"by_level":{"1":2,"3":3},"per":"long_rest"}}`))
+	surge := JSONMap(mustMechanicsJSON(t, `{"activation":{"mode":"active"},"uses":{"count":1,"per":"short_rest"}}`))
+	wind := JSONMap(mustMechanicsJSON(t, `{"activation":{"mode":"active"},"uses":{"count":3,"per":"long_rest","recovery":{"short_rest":{"mode":"fixed","amount":1},"long_rest":{"mode":"full"}}}}`))
+	bundle := characterFeatureBundle{
+		Class: &Class{Resources: &classResources},
+		Actions: []Action{
+			{ID: uuid.New(), CardNumber: "ACT-SURGE", Mechanics: &surge},
+			{ID: uuid.New(), CardNumber: "ACT-WIND", Mechanics: &wind},
+		},
+	}
+	return buildCharacterRestPolicy(
+		[]ResourceDefinition{{ResourceID: "slot_material", Recharge: "never"}, {ResourceID: "rage", Recharge: "short_rest"}},
+		bundle,
+		[]map[string]interface{}{{"kind": "grant_spell", "value": "misty-step", "freeuse": true}},
+	)
+}
+
+func TestBuildCharacterRestPolicy(t *testing.T) {
+	policy := restTestPolicy(t)
+	if policy.Recharge["rage"] != "long_rest" {
+		t.Fatalf("class resources must override the catalog, got %q", policy.Recharge["rage"])
+	}
+	if policy.Recharge["uses_ACT-SURGE"] != "short_rest" || policy.Recharge["freeuse-misty-step"] != "long_rest" || policy.Recharge["slot_material"] != "never" {
+		t.Fatalf("unexpected recharge map: %v", policy.Recharge)
+	}
+	if recovery := policy.Recovery["uses_ACT-WIND"]; !recovery.Valid || recovery.ShortRest != 1 {
+		t.Fatalf("declared recovery must be parsed, got %+v", recovery)
+	}
+
+	broken := JSONMap(mustMechanicsJSON(t, `{"uses":{"count":1,"recovery":{"short_rest":{"mode":"full"}}}}`))
+	if recovery, declared := parseCharacterRestRecovery(broken); !declared || recovery.Valid {
+		t.Fatalf("malformed recovery must fail closed, got %+v declared=%v", recovery, declared)
+	}
+}
+
+func TestRestCharacterShortRest(t *testing.T) {
+	character := restTestCharacter(t)
+	outcome := restCharacter(character, characterRestInput{
+		Mode: "short", Policy: restTestPolicy(t), HitDie: "d10", Con: 14, HitDice: 2, RNG: newDiceRNG(3),
+	})
+
+	if outcome.Resources["hit_dice_d10"] != 1 || outcome.CurrentHP <= character.CurrentHP {
+		t.Fatalf("two hit dice must be spent for healing: hp=%d resources=%v", outcome.CurrentHP, outcome.Resources)
+	}
+	if outcome.Resources["uses_ACT-SURGE"] != 1 || outcome.Resources["uses_ACT-WIND"] != 1 {
+		t.Fatalf("short rest pools must recover by policy: %v", outcome.Resources)
+	}
+	if outcome.Resources["rage"] != 1.0 || outcome.Resources["heroic_inspiration"] != 0.0 || outcome.Resources["action"] != 0.0 {
+		t.Fatalf("long rest and turn pools must stay untouched: %v", outcome.Resources)
+	}
+	if len(outcome.ActiveEffects) != 4 || *outcome.ActiveEffects[0].RoundsLeft != 2400 {
+		t.Fatalf("only the hour-long effect expires: %+v", outcome.ActiveEffects)
+	}
+	if outcome.Events[0]["type"] != "short_rest" || outcome.Events[1]["type"] != "resource_spent" || outcome.Events[2]["type"] != "healing" {
+		t.Fatalf("unexpected event order: %v", outcome.Events)
+	}
+	for _, event := range outcome.Events {
+		if err := validateCharacterEvent(event["type"].(string), event); err != nil {
+			t.Fatalf("rest event %v rejected: %v", event, err)
+		}
+	}
+	if (*character.Resources)["hit_dice_d10"] != 3.0 {
+		t.Fatal("source character must stay untouched")
+	}
+}
+
+func TestRestCharacterShortRestSpendsChosenClassPool(t *testing.T) {
+	character := restTestCharacter(t)
+	(*character.Resources)["hit_dice_d6"] = 3.0
+	(*character.MaxResources)["hit_dice_d6"] = 3.0
+
+	hitDie, ok := characterRestHitDie("D6", "d10", character.MaxResources)
+	if !ok || hitDie != "d6" {
+		t.Fatalf("the wizard pool must be selectable: %q %v", hitDie, ok)
+	}
+	if fallback, ok := characterRestHitDie("", "d10", character.MaxResources); !ok || fallback != "d10" {
+		t.Fatalf("no choice falls back to the first class die: %q %v", fallback, ok)
+	}
+	for _, missing := range []string{"d8", "6", "d"} {
+		if _, ok := characterRestHitDie(missing, "d10", character.MaxResources); ok {
+			t.Fatalf("%q is not a pool of this character", missing)
+		}
+	}
+
+	outcome := restCharacter(character, characterRestInput{
+		Mode: "short", Policy: restTestPolicy(t), HitDie: hitDie, Con: 14, HitDice: 2, RNG: newDiceRNG(3),
+	})
+	if outcome.Resources["hit_dice_d6"] != 1 || outcome.Resources["hit_dice_d10"] != 3.0 {
+		t.Fatalf("only the d6 pool must be spent: %v", outcome.Resources)
+	}
+	healing := outcome.Events[2]["roll"].(JSONMap)["dice"].([]interface{})[0].(map[string]interface{})
+	if outcome.Events[1]["resource"] != "hit_dice_d6" || healing["sides"] != 6 {
+		t.Fatalf("spent die must be a d6: %v", outcome.Events)
+	}
+}
+
+func TestRestCharacterLongRest(t *testing.T) {
+	character := restTestCharacter(t)
+	outcome := restCharacter(character, characterRestInput{
+		Mode: "long", Policy: restTestPolicy(t), HitDie: "d10", Con: 14,
+		ConditionRest: map[string]int{"exhaustion": 1},
+	})
+
+	if outcome.CurrentHP != 44 || outcome.TurnState["temp_hp"] != 0 {
+		t.Fatalf("long rest must restore hp and drop temp hp: %d %v", outcome.CurrentHP, outcome.TurnState)
+	}
+	if outcome.Resources["hit_dice_d10"] != 5 || outcome.Resources["rage"] != 3 || outcome.Resources["heroic_inspiration"] != 1 {
+		t.Fatalf("unexpected pools after long rest: %v", outcome.Resources)
+	}
+	if outcome.Resources["slot_material"] != 0.0 {
+		t.Fatal("never-recharging pool must not regenerate")
+	}
+	names := []string{}
+	for _, row := range outcome.ActiveEffects {
+		names = append(names, row.Name)
+	}
+	if len(names) != 2 || names[0] != "Проклятие" || names[1] != "Истощение" {
+		t.Fatalf("long rest must end timed effects and one exhaustion level, kept %v", names)
+	}
+	envelope := outcome.TurnState["rules_engine_runtime_v1"].(map[string]interface{})
+	if fired := envelope["firedThisRest"].([]interface{}); len(fired) != 0 {
+		t.Fatalf("per-rest trigger ledger must reset, got %v", fired)
+	}
+}
@@ -31,4 +31,55 @@ func registerCharacterV3Routes(
 		controller.PostCharacterEvents,
 	)
 	routes.PATCH("/:id/runtime", controller.PatchCharacterRuntime)
+	routes.POST(
+		"/:id/evaluate",
+		JSONBodyLimitMiddleware(maxCharacterFormulaBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterFormulaBodyBytes),
+		controller.EvaluateCharacterFormula,
+	)
+	routes.POST(
+		"/:id/recompute",
+		JSONBodyLimitMiddleware(maxCharacterRecomputeBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterRecomputeBodyBytes),
+		controller.RecomputeCharacterV3,
+	)
+	routes.GET("/:id/level-up", controller.GetCharacterV3LevelUp)
+	routes.POST(
+		"/:id/level-up",
+		JSONBodyLimitMiddleware(maxCharacterLevelUpBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterLevelUpBodyBytes),
+		controller.LevelUpCharacterV3,
+	)
+	routes.POST(
+		"/:id/rest",
+		JSONBodyLimitMiddleware(maxCharacterRestBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterRestBodyBytes),
+		controller.RestCharacterV3,
+	)
+	routes.GET("/:id/spellcasting", controller.GetCharacterV3Spellcasting)
+	routes.POST(
+		"/:id/spellcasting/cast",
+		JSONBodyLimitMiddleware(maxCharacterSpellcastingBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterSpellcastingBodyBytes),
+		controller.CastSpellCharacterV3,
+	)
+	routes.GET("/:id/encumbrance", controller.GetCharacterV3Encumbrance)
+	routes.POST(
+		"/:id/attune",
+		JSONBodyLimitMiddleware(maxCharacterAttunementBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterAttunementBodyBytes),
+		controller.AttuneCharacterV3,
+	)
+	routes.POST(
+		"/:id/unattune",
+		JSONBodyLimitMiddleware(maxCharacterAttunementBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterAttunementBodyBytes),
+		controller.UnattuneCharacterV3,
+	)
+	routes.POST(
+		"/:id/equip",
+		JSONBodyLimitMiddleware(maxCharacterEquipBodyBytes),
+		RequestBodyLimitMiddleware(maxCharacterEquipBodyBytes),
+		controller.EquipCharacterV3,
+	)
 }
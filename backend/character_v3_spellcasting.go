@@ -0,0 +1,644 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxCharacterSpellcastingBodyBytes = 1 << 10
+
+// Прогрессии ячеек класса. Полные, половинные и третичные заклинатели
+// складываются в один уровень заклинателя; магия договора считается отдельно
+// и ячейки у неё свои.
+const (
+	spellcastingFull  = "full"
+	spellcastingHalf  = "half"
+	spellcastingThird = "third"
+	spellcastingPact  = "pact"
+)
+
+// fullCasterSpellSlots — ячейки 1–9 кругов по уровню заклинателя (индекс).
+var fullCasterSpellSlots = [...][]int{
+	{},
+	{2},
+	{3},
+	{4, 2},
+	{4, 3},
+	{4, 3, 2},
+	{4, 3, 3},
+	{4, 3, 3, 1},
+	{4, 3, 3, 2},
+	{4, 3, 3, 3, 1},
+	{4, 3, 3, 3, 2},
+	{4, 3, 3, 3, 2, 1},
+	{4, 3, 3, 3, 2, 1},
+	{4, 3, 3, 3, 2, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1, 1, 1},
+	{4, 3, 3, 3, 3, 1, 1, 1, 1},
+	{4, 3, 3, 3, 3, 2, 1, 1, 1},
+	{4, 3, 3, 3, 3, 2, 2, 1, 1},
+}
+
+// pactMagicSlots — магия договора по уровню колдуна: число ячеек и их круг.
+var pactMagicSlots = [...]struct{ Count, Level int }{
+	{0, 0},
+	{1, 1}, {2, 1}, {2, 2}, {2, 2}, {2, 3},
+	{2, 3}, {2, 4}, {2, 4}, {2, 5}, {2, 5},
+	{3, 5}, {3, 5}, {3, 5}, {3, 5}, {3, 5},
+	{3, 5}, {4, 5}, {4, 5}, {4, 5}, {4, 5},
+}
+
+// characterSpellSlotKeyPattern — ключи ячеек в resources/max_resources:
+// spell_slot_N — общие, warlock_spell_slot_N — магия договора (как на листе).
+var characterSpellSlotKeyPattern = regexp.MustCompile(`^(?:warlock_)?spell_slot_([1-9])$`)
+
+// classSpellcasting — декларация classes.spellcasting:
+//
+//	{"progression": "full"|"half"|"third"|"pact", "ability": "int",
+//	 "from_level": 3, "preparation": "prepared"|"known",
+//	 "prepared": "int + self_level" | {"1": 4, "5": 9}, "cantrips": {"1": 3, "4": 4}}
+//
+// from_level — уровень класса, с которого он колдует (подклассы-третичные
+// заклинатели получают ячейки с 3-го). prepared — предел подготовленных
+// (для known — известных) заклинаний: формула от уровня класса (self_level)
+// или ступени by_level.
+type classSpellcasting struct {
+	Progression string
+	Ability     string
+	FromLevel   int
+	Preparation string
+	Prepared    interface{}
+	Cantrips    interface{}
+}
+
+// parseClassSpellcasting разбирает и проверяет декларацию. ok == false —
+// класс не колдует.
+func parseClassSpellcasting(raw *JSONMap) (classSpellcasting, bool, error) {
+	if raw == nil || len(*raw) == 0 {
+		return classSpellcasting{}, false, nil
+	}
+	definition := *raw
+	spellcasting := classSpellcasting{
+		Progression: stringField(definition, "progression"),
+		Ability:     strings.ToLower(stringField(definition, "ability")),
+		FromLevel:   1,
+		Preparation: stringFieldOr(definition, "preparation", "prepared"),
+		Prepared:    definition["prepared"],
+		Cantrips:    definition["cantrips"],
+	}
+	if !oneOf(spellcasting.Progression, spellcastingFull, spellcastingHalf, spellcastingThird, spellcastingPact) {
+		return spellcasting, false, fmt.Errorf("spellcasting.progression должен быть full, half, third или pact")
+	}
+	if !oneOf(spellcasting.Ability, abilityKeys...) {
+		return spellcasting, false, fmt.Errorf("spellcasting.ability должен быть характеристикой")
+	}
+	if raw, exists := definition["from_level"]; exists {
+		level, ok := mechanicsNumber(raw)
+		if !ok || level < 1 || level > 20 || level != float64(int(level)) {
+			return spellcasting, false, fmt.Errorf("spellcasting.from_level должен быть уровнем 1–20")
+		}
+		spellcasting.FromLevel = int(level)
+	}
+	if !oneOf(spellcasting.Preparation, "prepared", "known") {
+		return spellcasting, false, fmt.Errorf("spellcasting.preparation должен быть prepared или known")
+	}
+	for field, value := range map[string]interface{}{"prepared": spellcasting.Prepared, "cantrips": spellcasting.Cantrips} {
+		if err := validateClassSpellcastingCount(value); err != nil {
+			return spellcasting, false, fmt.Errorf("spellcasting.%s: %w", field, err)
+		}
+	}
+	return spellcasting, true, nil
+}
+
+// validateClassSpellcastingCount — предел задан числом, формулой без костей
+// или ступенями by_level {"<уровень>": число}.
+func validateClassSpellcastingCount(raw interface{}) error {
+	switch value := raw.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		for key, count := range value {
+			level, err := strconv.Atoi(key)
+			number, ok := mechanicsNumber(count)
+			if err != nil || level < 1 || level > 20 || !ok || number < 0 {
+				return fmt.Errorf("ступень %q должна быть уровнем 1–20 с неотрицательным числом", key)
+			}
+		}
+		return nil
+	default:
+		evaluation, err := evaluateFormula(value, formulaContext{AbilityMods: map[string]int{}, ClassLevels: map[string]int{}})
+		if err != nil {
+			return err
+		}
+		if evaluation.Marker != "" || len(evaluation.Dice) > 0 {
+			return fmt.Errorf("предел не может содержать кости")
+		}
+		return nil
+	}
+}
+
+// count вычисляет предел на уровне класса; ok == false — предел не задан.
+func (s classSpellcasting) count(raw interface{}, level int, ctx formulaContext) (int, bool) {
+	if byLevel, isTable := raw.(map[string]interface{}); isTable {
+		return characterResourceByLevel(byLevel, level)
+	}
+	ctx.SelfLevel = level
+	return characterFormulaInt(raw, ctx)
+}
+
+// characterCasterClass — колдующий класс персонажа и уровень в нём.
+type characterCasterClass struct {
+	Class        Class
+	Level        int
+	Spellcasting classSpellcasting
+}
+
+// active — класс уже колдует на своём уровне.
+func (c characterCasterClass) active() bool {
+	return c.Level >= c.Spellcasting.FromLevel
+}
+
+// characterCasterClasses — колдующие классы сборки. Декларация подкласса
+// действует, только если базовый класс сам не колдует (Мистический рыцарь
+// у воина), и берёт уровень класса.
+func characterCasterClasses(bundle characterFeatureBundle, level int) []characterCasterClass {
+	var casters []characterCasterClass
+	for _, entry := range bundle.classLevels(level) {
+		for _, class := range []*Class{&entry.Class, entry.Subclass} {
+			if class == nil {
+				continue
+			}
+			if spellcasting, ok, err := parseClassSpellcasting(class.Spellcasting); err == nil && ok {
+				casters = append(casters, characterCasterClass{Class: *class, Level: entry.Level, Spellcasting: spellcasting})
+				break
+			}
+		}
+	}
+	return casters
+}
+
+// characterCasterLevel — уровень заклинателя для общей таблицы ячеек.
+// Единственный класс с ячейками использует свою прогрессию (половина и треть
+// с округлением вверх, как в таблицах классов); при нескольких — правило
+// мультикласса: все уровни полных, половина (вверх) половинных и треть
+// (вниз) третичных. Магия договора не входит.
+func characterCasterLevel(casters []characterCasterClass) int {
+	var slotCasters []characterCasterClass
+	for _, caster := range casters {
+		if caster.active() && caster.Spellcasting.Progression != spellcastingPact {
+			slotCasters = append(slotCasters, caster)
+		}
+	}
+	total := 0
+	for _, caster := range slotCasters {
+		switch caster.Spellcasting.Progression {
+		case spellcastingFull:
+			total += caster.Level
+		case spellcastingHalf:
+			total += (caster.Level + 1) / 2
+		case spellcastingThird:
+			if len(slotCasters) == 1 {
+				total += (caster.Level + 2) / 3
+			} else {
+				total += caster.Level / 3
+			}
+		}
+	}
+	if total >= len(fullCasterSpellSlots) {
+		total = len(fullCasterSpellSlots) - 1
+	}
+	return total
+}
+
+// characterSpellSlotMaxima — максимумы ячеек: spell_slot_N по уровню
+// заклинателя и warlock_spell_slot_N магии договора.
+func characterSpellSlotMaxima(casters []characterCasterClass) map[string]int {
+	maxima := map[string]int{}
+	for index, count := range fullCasterSpellSlots[characterCasterLevel(casters)] {
+		maxima[fmt.Sprintf("spell_slot_%d", index+1)] = count
+	}
+	pactLevel := 0
+	for _, caster := range casters {
+		if caster.active() && caster.Spellcasting.Progression == spellcastingPact {
+			pactLevel += caster.Level
+		}
+	}
+	if pactLevel >= len(pactMagicSlots) {
+		pactLevel = len(pactMagicSlots) - 1
+	}
+	if pact := pactMagicSlots[pactLevel]; pact.Count > 0 {
+		maxima[fmt.Sprintf("warlock_spell_slot_%d", pact.Level)] = pact.Count
+	}
+	return maxima
+}
+
+// characterSpellSlotToSpend — ячейка круга level, которую тратит заклинание:
+// сначала общая, затем ячейка договора того же круга. Повышенный круг
+// оплачивается ячейкой этого круга, а не базового.
+func characterSpellSlotToSpend(resources *JSONMap, level int) (string, int, bool) {
+	for _, key := range []string{fmt.Sprintf("spell_slot_%d", level), fmt.Sprintf("warlock_spell_slot_%d", level)} {
+		if resources == nil {
+			break
+		}
+		if current, ok := mechanicsNumber((*resources)[key]); ok && current >= 1 {
+			return key, int(current), true
+		}
+	}
+	return "", 0, false
+}
+
+// CharacterSpellSlot — ячейки одного круга: максимум и остаток.
+type CharacterSpellSlot struct {
+	Level   int `json:"level"`
+	Max     int `json:"max"`
+	Current int `json:"current"`
+}
+
+// CharacterSpellcastingClass — заклинательство одного класса.
+type CharacterSpellcastingClass struct {
+	ClassID          uuid.UUID `json:"class_id"`
+	Name             string    `json:"name"`
+	Level            int       `json:"level"`
+	Progression      string    `json:"progression"`
+	Ability          string    `json:"ability"`
+	SpellSaveDC      int       `json:"spell_save_dc"`
+	SpellAttackBonus int       `json:"spell_attack_bonus"`
+	Preparation      string    `json:"preparation"`
+	MaxSpells        *int      `json:"max_spells,omitempty"`
+	MaxCantrips      *int      `json:"max_cantrips,omitempty"`
+}
+
+// CharacterSpellCounts — заклинания листа. Known — все доступные (выбранные
+// и выданные особенностями), Prepared — выбранные заклинания 1+ круга: они
+// занимают предел подготовки (MaxPrepared) или известных (MaxKnown).
+// Выданные особенностями всегда подготовлены и предел не занимают.
+type CharacterSpellCounts struct {
+	Known       int `json:"known"`
+	Cantrips    int `json:"cantrips"`
+	Prepared    int `json:"prepared"`
+	MaxPrepared int `json:"max_prepared"`
+	MaxKnown    int `json:"max_known"`
+	MaxCantrips int `json:"max_cantrips"`
+}
+
+// CharacterSpellcastingSummary — сводка заклинательства персонажа.
+type CharacterSpellcastingSummary struct {
+	CharacterID      uuid.UUID                    `json:"character_id"`
+	CasterLevel      int                          `json:"caster_level"`
+	Ability          string                       `json:"ability,omitempty"`
+	SpellSaveDC      int                          `json:"spell_save_dc"`
+	SpellAttackBonus int                          `json:"spell_attack_bonus"`
+	Classes          []CharacterSpellcastingClass `json:"classes"`
+	Slots            []CharacterSpellSlot         `json:"slots"`
+	PactSlots        *CharacterSpellSlot          `json:"pact_slots"`
+	Spells           CharacterSpellCounts         `json:"spells"`
+}
+
+// characterSpellcastingSummary собирает сводку: СЛ и бонус атаки по
+// характеристике каждого класса (основная — у первого), ячейки из таблиц
+// с остатком из resources и счётчики заклинаний. spells — каталог
+// заклинаний листа по id.
+func characterSpellcastingSummary(character CharacterV3, casters []characterCasterClass, derivation CharacterDerivation, spells map[string]Spell) CharacterSpellcastingSummary {
+	proficiency := derivation.Stats.ProficiencyBonus
+	summary := CharacterSpellcastingSummary{
+		CharacterID: character.ID,
+		CasterLevel: characterCasterLevel(casters),
+		Classes:     []CharacterSpellcastingClass{},
+		Slots:       []CharacterSpellSlot{},
+	}
+	ctx := derivation.formula
+	for _, caster := range casters {
+		modifier := abilityScoreModifier(derivation.Abilities[caster.Spellcasting.Ability])
+		entry := CharacterSpellcastingClass{
+			ClassID: caster.Class.ID, Name: caster.Class.Name, Level: caster.Level,
+			Progression: caster.Spellcasting.Progression, Ability: caster.Spellcasting.Ability,
+			SpellSaveDC: 8 + proficiency + modifier, SpellAttackBonus: proficiency + modifier,
+			Preparation: caster.Spellcasting.Preparation,
+		}
+		ctx.SpellcastingMod = modifier
+		if caster.active() {
+			if count, ok := caster.Spellcasting.count(caster.Spellcasting.Prepared, caster.Level, ctx); ok {
+				if count < 0 {
+					count = 0
+				}
+				entry.MaxSpells = &count
+				if caster.Spellcasting.Preparation == "known" {
+					summary.Spells.MaxKnown += count
+				} else {
+					summary.Spells.MaxPrepared += count
+				}
+			}
+			if count, ok := caster.Spellcasting.count(caster.Spellcasting.Cantrips, caster.Level, ctx); ok {
+				entry.MaxCantrips = &count
+				summary.Spells.MaxCantrips += count
+			}
+		}
+		summary.Classes = append(summary.Classes, entry)
+	}
+	if len(summary.Classes) > 0 {
+		first := summary.Classes[0]
+		summary.Ability, summary.SpellSaveDC, summary.SpellAttackBonus = first.Ability, first.SpellSaveDC, first.SpellAttackBonus
+	} else if character.RuleState != nil {
+		// Без декларации класса — заклинательная характеристика снимка листа.
+		if state, ok := (*character.RuleState)["spellcasting"].(map[string]interface{}); ok {
+			if name, ok := state["ability"].(string); ok && oneOf(name, abilityKeys...) {
+				modifier := abilityScoreModifier(derivation.Abilities[name])
+				summary.Ability, summary.SpellSaveDC, summary.SpellAttackBonus = name, 8+proficiency+modifier, proficiency+modifier
+			}
+		}
+	}
+
+	maxima := characterSpellSlotMaxima(casters)
+	for key, maximum := range maxima {
+		match := characterSpellSlotKeyPattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		level, _ := strconv.Atoi(match[1])
+		slot := CharacterSpellSlot{Level: level, Max: maximum, Current: maximum}
+		if character.Resources != nil {
+			if current, ok := mechanicsNumber((*character.Resources)[key]); ok && int(current) < maximum {
+				slot.Current = int(current)
+				if slot.Current < 0 {
+					slot.Current = 0
+				}
+			}
+		}
+		if strings.HasPrefix(key, "warlock_") {
+			summary.PactSlots = &slot
+		} else {
+			summary.Slots = append(summary.Slots, slot)
+		}
+	}
+	sort.Slice(summary.Slots, func(i, j int) bool { return summary.Slots[i].Level < summary.Slots[j].Level })
+
+	chosen := map[string]bool{}
+	if character.SpellIDs != nil {
+		for _, id := range *character.SpellIDs {
+			chosen[id] = true
+		}
+	}
+	known := map[string]bool{}
+	for id := range chosen {
+		known[id] = true
+	}
+	for _, id := range characterGrantedSpellIDs(character) {
+		known[id] = true
+	}
+	for id := range known {
+		spell, ok := spells[id]
+		if !ok {
+			continue
+		}
+		summary.Spells.Known++
+		if spell.Level == 0 {
+			summary.Spells.Cantrips++
+		} else if chosen[id] {
+			summary.Spells.Prepared++
+		}
+	}
+	return summary
+}
+
+// characterGrantedSpellIDs — заклинания, выданные особенностями
+// (rule_state.spells.known снимка листа).
+func characterGrantedSpellIDs(character CharacterV3) []string {
+	if character.RuleState == nil {
+		return nil
+	}
+	spells, _ := (*character.RuleState)["spells"].(map[string]interface{})
+	known, _ := spells["known"].([]interface{})
+	ids := make([]string, 0, len(known))
+	for _, raw := range known {
+		if id, ok := raw.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// characterKnowsSpell — заклинание выбрано на листе или выдано особенностью.
+func characterKnowsSpell(character CharacterV3, spellID uuid.UUID) bool {
+	id := spellID.String()
+	if character.SpellIDs != nil {
+		for _, candidate := range *character.SpellIDs {
+			if candidate == id {
+				return true
+			}
+		}
+	}
+	for _, candidate := range characterGrantedSpellIDs(character) {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCharacterV3Spellcasting отдаёт сводку заклинательства: СЛ спасброска,
+// бонус атаки, ячейки по кругам и счётчики подготовленных и известных
+// заклинаний.
+func (cc *CharacterV3Controller) GetCharacterV3Spellcasting(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	character, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Read)
+	if !allowed {
+		return
+	}
+
+	bundle, err := loadCharacterFeatureBundle(cc.db, *character)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки сущностей персонажа", "details": err.Error()})
+		return
+	}
+	input, err := characterBundleDerivationInput(cc.db, *character, bundle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки сущностей персонажа", "details": err.Error()})
+		return
+	}
+	derivation := deriveCharacterStats(input)
+
+	ids := Properties(append(characterGrantedSpellIDs(*character), characterSpellIDs(*character)...))
+	spells := map[string]Spell{}
+	if parsed := validUUIDs(&ids); len(parsed) > 0 {
+		var rows []Spell
+		if err := cc.db.Where("id IN ?", parsed).Find(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки заклинаний", "details": err.Error()})
+			return
+		}
+		for _, spell := range rows {
+			spells[spell.ID.String()] = spell
+		}
+	}
+
+	casters := characterCasterClasses(bundle, derivation.formula.SelfLevel)
+	c.JSON(http.StatusOK, characterSpellcastingSummary(*character, casters, derivation, spells))
+}
+
+func characterSpellIDs(character CharacterV3) []string {
+	if character.SpellIDs == nil {
+		return nil
+	}
+	return []string(*character.SpellIDs)
+}
+
+// CastSpellCharacterV3Request — трата ячейки на заклинание. slot_level —
+// круг ячейки (по умолчанию круг заклинания); выше круга — повышенная ячейка.
+type CastSpellCharacterV3Request struct {
+	SpellID                 uuid.UUID `json:"spell_id" binding:"required"`
+	SlotLevel               int       `json:"slot_level" binding:"omitempty,min=1,max=9"`
+	ExpectedRuntimeRevision *int64    `json:"expected_runtime_revision" binding:"required"`
+}
+
+// CastSpellCharacterV3Response — событие траты и лист после неё.
+type CastSpellCharacterV3Response struct {
+	Resource  string         `json:"resource"`
+	SlotLevel int            `json:"slot_level"`
+	Event     CharacterEvent `json:"event"`
+	Character CharacterV3    `json:"character"`
+}
+
+// CastSpellCharacterV3 списывает ячейку за сотворение известного
+// заклинания: круг ячейки не ниже круга заклинания, повышенный круг тратит
+// ячейку этого круга. Запись идёт под проверкой runtime_revision и пишет
+// resource_spent в журнал.
+func (cc *CharacterV3Controller) CastSpellCharacterV3(c *gin.Context) {
+	userID, ok := requireCharacterV3UserID(c)
+	if !ok {
+		return
+	}
+
+	characterID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID персонажа"})
+		return
+	}
+
+	if _, allowed := cc.loadCharacterV3ForAccess(c, characterID, userID, characterV3Write); !allowed {
+		return
+	}
+
+	var req CastSpellCharacterV3Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса", "details": err.Error()})
+		return
+	}
+
+	var spell Spell
+	if err := cc.db.First(&spell, "id = ?", req.SpellID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "заклинание не найдено"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки заклинания", "details": err.Error()})
+		return
+	}
+	if spell.Level == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "заговор не тратит ячейку"})
+		return
+	}
+	slotLevel := spell.Level
+	if req.SlotLevel > 0 {
+		if req.SlotLevel < spell.Level {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ячейка %d-го круга ниже круга заклинания (%d)", req.SlotLevel, spell.Level)})
+			return
+		}
+		slotLevel = req.SlotLevel
+	}
+
+	response := CastSpellCharacterV3Response{SlotLevel: slotLevel}
+	txErr := cc.db.Transaction(func(tx *gorm.DB) error {
+		var locked CharacterV3
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", characterID, userID).
+			First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errCharacterV3OwnerChanged
+			}
+			return err
+		}
+		if locked.RuntimeRevision != *req.ExpectedRuntimeRevision {
+			expected := *req.ExpectedRuntimeRevision
+			actual := locked.RuntimeRevision
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "runtime_revision_conflict",
+				Message: "character runtime revision is stale", CharacterID: characterID.String(),
+				ExpectedRuntimeRevision: &expected, ActualRuntimeRevision: &actual,
+			}
+		}
+		if !characterKnowsSpell(locked, spell.ID) {
+			return &characterRuntimeCommandError{
+				Status: http.StatusForbidden, Code: "spell_not_known",
+				Message: "персонаж не знает этого заклинания", CharacterID: characterID.String(),
+			}
+		}
+		key, current, ok := characterSpellSlotToSpend(locked.Resources, slotLevel)
+		if !ok {
+			return &characterRuntimeCommandError{
+				Status: http.StatusConflict, Code: "spell_slot_unavailable",
+				Message: fmt.Sprintf("нет свободной ячейки %d-го круга", slotLevel), CharacterID: characterID.String(),
+			}
+		}
+
+		resources := cloneJSONMapValue(locked.Resources)
+		resources[key] = current - 1
+		result := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ? AND runtime_revision = ?", characterID, userID, locked.RuntimeRevision).
+			Updates(map[string]interface{}{
+				"resources":        resources,
+				"runtime_revision": locked.RuntimeRevision + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errCharacterV3OwnerChanged
+		}
+
+		payload := JSONMap{"type": "resource_spent", "resource": key, "amount": 1, "remaining": current - 1}
+		response.Resource = key
+		response.Event = CharacterEvent{CharacterID: locked.ID, Ts: time.Now(), Type: "resource_spent", Payload: payload}
+		if err := tx.Create(&response.Event).Error; err != nil {
+			return err
+		}
+		return tx.Preload("User").Preload("Group").First(&response.Character, locked.ID).Error
+	})
+	if errors.Is(txErr, errCharacterV3OwnerChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "владелец персонажа изменился; повторите запрос"})
+		return
+	}
+	var runtimeConflict *characterRuntimeCommandError
+	if errors.As(txErr, &runtimeConflict) {
+		writeCharacterRuntimeCommandError(c, txErr)
+		return
+	}
+	if txErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка траты ячейки", "details": txErr.Error()})
+		return
+	}
+	response.Character.AccessMode = characterV3AccessOwner
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func casterClass(t *testing.T, name, spellcasting string, level int) characterCasterClass {
+	t.Helper()
+	raw := JSONMap(mustMechanicsJSON(t, spellcasting))
+	parsed, ok, err := parseClassSpellcasting(&raw)
+	if err != nil || !ok {
+		t.Fatalf("%s: spellcasting must parse: %v", name, err)
+	}
+	return characterCasterClass{Class: Class{ID: uuid.New(), Name: name}, Level: level, Spellcasting: parsed}
+}
+
+func TestParseClassSpellcasting(t *testing.T) {
+	if _, ok, err := parseClassSpellcasting(nil); ok || err != nil {
+		t.Fatal("class without declaration does not cast")
+	}
+	for _, invalid := range []string{
+		`{"progression":"quarter","ability":"int"}`,
+		`{"progression":"full","ability":"luck"}`,
+		`{"progression":"full","ability":"int","from_level":0}`,
+		`{"progression":"full","ability":"int","preparation":"spontaneous"}`,
+		`{"progression":"full","ability":"int","prepared":"1d4 + int"}`,
+		`{"progression":"full","ability":"int","cantrips":{"first":3}}`,
+	} {
+		raw := JSONMap(mustMechanicsJSON(t, invalid))
+		if _, _, err := parseClassSpellcasting(&raw); err == nil {
+			t.Fatalf("declaration %s must be rejected", invalid)
+		}
+	}
+}
+
+func TestCharacterSpellSlotMaxima(t *testing.T) {
+	wizard := casterClass(t, "Волшебник", `{"progression":"full","ability":"int"}`, 5)
+	paladin := casterClass(t, "Паладин", `{"progression":"half","ability":"cha"}`, 5)
+	knight := casterClass(t, "Мистический рыцарь", `{"progression":"third","ability":"int","from_level":3}`, 7)
+	warlock := casterClass(t, "Колдун", `{"progression":"pact","ability":"cha"}`, 3)
+
+	for _, tc := range []struct {
+		name    string
+		casters []characterCasterClass
+		want    map[string]int
+	}{
+		{"full", []characterCasterClass{wizard}, map[string]int{"spell_slot_1": 4, "spell_slot_2": 3, "spell_slot_3": 2}},
+		{"half rounds up", []characterCasterClass{paladin}, map[string]int{"spell_slot_1": 4, "spell_slot_2": 2}},
+		{"single third rounds up", []characterCasterClass{knight}, map[string]int{"spell_slot_1": 4, "spell_slot_2": 2}},
+		{"pact", []characterCasterClass{warlock}, map[string]int{"warlock_spell_slot_2": 2}},
+		// Волшебник 5 + паладин 5 (3) + рыцарь 7 (2) = уровень заклинателя 10.
+		{"multiclass", []characterCasterClass{wizard, paladin, knight, warlock}, map[string]int{
+			"spell_slot_1": 4, "spell_slot_2": 3, "spell_slot_3": 3, "spell_slot_4": 3, "spell_slot_5": 2,
+			"warlock_spell_slot_2": 2,
+		}},
+	} {
+		got := characterSpellSlotMaxima(tc.casters)
+		if len(got) != len(tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+		for key, value := range tc.want {
+			if got[key] != value {
+				t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+			}
+		}
+	}
+
+	knight.Level = 2
+	if got := characterSpellSlotMaxima([]characterCasterClass{knight}); len(got) != 0 {
+		t.Fatalf("third caster below from_level has no slots: %v", got)
+	}
+
+	resources := JSONMap(mustMechanicsJSON(t, `{"spell_slot_1":{"by_level":{"1":2},"per":"long_rest"},"rage":{"count":2}}`))
+	spellcasting := JSONMap(mustMechanicsJSON(t, `{"progression":"full","ability":"wis"}`))
+	class := &Class{Resources: &resources, Spellcasting: &spellcasting}
+	maxima := characterResourceMaxima(characterFeatureBundle{Class: class}, "d8", 3, CharacterDerivation{})
+	if maxima["spell_slot_1"] != 4 || maxima["spell_slot_2"] != 2 || maxima["rage"] != 2 {
+		t.Fatalf("slots must come from the progression table: %v", maxima)
+	}
+}
+
+func TestCharacterSpellcastingSummaryAndSlotSpend(t *testing.T) {
+	cleric := casterClass(t, "Жрец", `{"progression":"full","ability":"wis","prepared":{"1":4,"3":6},"cantrips":"3"}`, 3)
+	warlock := casterClass(t, "Колдун", `{"progression":"pact","ability":"cha","preparation":"known","prepared":"self_level + 1"}`, 1)
+
+	bless, light, shield := uuid.New(), uuid.New(), uuid.New()
+	spellIDs := Properties{bless.String(), light.String()}
+	resources := JSONMap{"spell_slot_1": 1.0, "warlock_spell_slot_1": 1.0}
+	state := JSONMap{"spells": map[string]interface{}{"known": []interface{}{shield.String()}}}
+	character := CharacterV3{ID: uuid.New(), SpellIDs: &spellIDs, Resources: &resources, RuleState: &state}
+	derivation := CharacterDerivation{
+		Stats:     CharacterDerivedStats{ProficiencyBonus: 2},
+		Abilities: map[string]int{"wis": 16, "cha": 12},
+	}
+	spells := map[string]Spell{
+		bless.String():  {ID: bless, Level: 1},
+		light.String():  {ID: light, Level: 0},
+		shield.String(): {ID: shield, Level: 1},
+	}
+
+	summary := characterSpellcastingSummary(character, []characterCasterClass{cleric, warlock}, derivation, spells)
+	if summary.Ability != "wis" || summary.SpellSaveDC != 13 || summary.SpellAttackBonus != 5 || summary.CasterLevel != 3 {
+		t.Fatalf("primary class must define DC and attack: %+v", summary)
+	}
+	if len(summary.Classes) != 2 || summary.Classes[1].SpellSaveDC != 11 {
+		t.Fatalf("each class uses its own ability: %+v", summary.Classes)
+	}
+	if len(summary.Slots) != 2 || summary.Slots[0] != (CharacterSpellSlot{Level: 1, Max: 4, Current: 1}) || summary.Slots[1].Current != 2 {
+		t.Fatalf("slot maxima with stored remainders expected: %+v", summary.Slots)
+	}
+	if summary.PactSlots == nil || *summary.PactSlots != (CharacterSpellSlot{Level: 1, Max: 1, Current: 1}) {
+		t.Fatalf("pact slots must be reported apart: %+v", summary.PactSlots)
+	}
+	if counts := summary.Spells; counts != (CharacterSpellCounts{Known: 3, Cantrips: 1, Prepared: 1, MaxPrepared: 6, MaxKnown: 2, MaxCantrips: 3}) {
+		t.Fatalf("unexpected spell counts: %+v", counts)
+	}
+	if !characterKnowsSpell(character, shield) || characterKnowsSpell(character, uuid.New()) {
+		t.Fatal("granted spells are known, foreign ones are not")
+	}
+
+	if key, current, ok := characterSpellSlotToSpend(&resources, 1); !ok || key != "spell_slot_1" || current != 1 {
+		t.Fatalf("shared slot is spent first: %s %d", key, current)
+	}
+	resources["spell_slot_1"] = 0.0
+	if key, _, ok := characterSpellSlotToSpend(&resources, 1); !ok || key != "warlock_spell_slot_1" {
+		t.Fatalf("pact slot of the same level is the fallback: %s", key)
+	}
+	if _, _, ok := characterSpellSlotToSpend(&resources, 2); ok {
+		t.Fatal("upcasting needs a slot of the requested level")
+	}
+}
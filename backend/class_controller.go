@@ -110,6 +110,14 @@ func (cc *ClassController) CreateClass(c *gin.Context) {
 	if req.Rarity == "" {
 		req.Rarity = RarityCommon
 	}
+	if _, _, err := parseClassSpellcasting(req.Spellcasting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное заклинательство класса", "details": err.Error()})
+		return
+	}
+	if _, _, err := parseClassMulticlass(req.Multiclass); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные правила мультикласса", "details": err.Error()})
+		return
+	}
 
 	cardNumber := req.CardNumber
 	if cardNumber == "" {
@@ -134,7 +142,8 @@ func (cc *ClassController) CreateClass(c *gin.Context) {
 		WeaponProficiencies: req.WeaponProficiencies, ToolProficiencies: req.ToolProficiencies,
 		SkillChoices: req.SkillChoices, StartingEquipment: req.StartingEquipment,
 		EquipmentOptions: req.EquipmentOptions,
-		LevelProgression: req.LevelProgression, Resources: req.Resources,
+		LevelProgression: req.LevelProgression, Resources: req.Resources, Spellcasting: req.Spellcasting,
+		Multiclass: req.Multiclass,
 		IsSubclass: req.IsSubclass, ParentClassID: req.ParentClassID, SubclassLevel: req.SubclassLevel,
 		RelatedEffects: req.RelatedEffects, RelatedActions: req.RelatedActions,
 		Type: req.Type, Author: req.Author, Source: req.Source, Tags: req.Tags, IsExtended: req.IsExtended,
@@ -165,6 +174,14 @@ func (cc *ClassController) UpdateClass(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса"})
 		return
 	}
+	if _, _, err := parseClassSpellcasting(req.Spellcasting); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное заклинательство класса", "details": err.Error()})
+		return
+	}
+	if _, _, err := parseClassMulticlass(req.Multiclass); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные правила мультикласса", "details": err.Error()})
+		return
+	}
 	var cl Class
 	if err := cc.db.Where("id = ?", id).First(&cl).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -227,6 +244,12 @@ func (cc *ClassController) UpdateClass(c *gin.Context) {
 	if req.Resources != nil {
 		cl.Resources = req.Resources
 	}
+	if req.Spellcasting != nil {
+		cl.Spellcasting = req.Spellcasting
+	}
+	if req.Multiclass != nil {
+		cl.Multiclass = req.Multiclass
+	}
 	if req.IsSubclass != nil {
 		cl.IsSubclass = req.IsSubclass
 		if !*req.IsSubclass {
@@ -219,6 +219,11 @@ func validateContentMigrationEffectCreate(request ContentMigrationEffectCreateRe
 		!ValidateWeight(request.Entity.Weight) {
 		return errors.New("invalid effect properties, price or weight")
 	}
+	if request.Entity.Mechanics != nil {
+		if problems := validateMechanicsSchema(*request.Entity.Mechanics, mechanicsKindPassiveEffect); len(problems) > 0 {
+			return &problems[0]
+		}
+	}
 	return nil
 }
 
@@ -265,6 +270,11 @@ func validateContentMigrationActionCreate(request ContentMigrationActionCreateRe
 		!ValidateWeight(request.Entity.Weight) {
 		return errors.New("invalid action rarity, properties, price or weight")
 	}
+	if request.Entity.Mechanics != nil {
+		if problems := validateMechanicsSchema(*request.Entity.Mechanics, mechanicsKindAction); len(problems) > 0 {
+			return &problems[0]
+		}
+	}
 	return nil
 }
 
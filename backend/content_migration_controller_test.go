@@ -149,8 +149,8 @@ func TestExactUpdateHandlerRequiresCertificationKeyAndCoversFixedAdapters(t *tes
 	fieldByType := map[string]map[string]any{
 		"card":       {"mastery": "mastery-id"},
 		"effect":     {"mechanics": map[string]any{"activation": map[string]any{"mode": "passive"}}},
-		"action":     {"mechanics": map[string]any{"activation": map[string]any{"mode": "action"}}},
-		"spell":      {"mechanics": map[string]any{"activation": map[string]any{"mode": "action"}}},
+		"action":     {"mechanics": map[string]any{"activation": map[string]any{"mode": "active"}}},
+		"spell":      {"mechanics": map[string]any{"activation": map[string]any{"mode": "active"}}},
 		"race":       {"level_progression": map[string]any{"1": map[string]any{}}},
 		"class":      {"equipment_options": map[string]any{"option_b": map[string]any{"gold": 50}}},
 		"feat":       {"repeatable": true},
@@ -205,6 +205,21 @@ func TestExactUpdateHandlerRequiresCertificationKeyAndCoversFixedAdapters(t *tes
 	if forbidden.Code != http.StatusBadRequest || called != len(fieldByType) {
 		t.Fatalf("identity field reached exact update: status=%d calls=%d", forbidden.Code, called)
 	}
+	invalidMechanicsBody := map[string]any{
+		"schema_version": 1, "plan_hash": planHash,
+		"operation_id": "effect:ROW-001:update", "card_number": "ROW-001",
+		"expected_current": map[string]any{
+			"id": entityID.String(), "card_number": "ROW-001", "support": nil,
+			"mechanics": nil,
+		},
+		"fields": map[string]any{"mechanics": map[string]any{"activation": map[string]any{"mode": "telepathy"}}},
+	}
+	invalidMechanics := migrationRequest(
+		t, router, http.MethodPost, protectedPath, invalidMechanicsBody, "migration-secret",
+	)
+	if invalidMechanics.Code != http.StatusBadRequest || called != len(fieldByType) {
+		t.Fatalf("schema-invalid mechanics reached exact update: status=%d calls=%d", invalidMechanics.Code, called)
+	}
 	unknown := strings.TrimSuffix(string(mustJSON(t, protectedBody)), "}") + `,"purge_all":true}`
 	request := httptest.NewRequest(http.MethodPost, protectedPath, strings.NewReader(unknown))
 	request.Header.Set("Content-Type", "application/json")
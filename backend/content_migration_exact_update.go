@@ -206,6 +206,34 @@ func decodeContentMigrationExactObject(raw json.RawMessage) (JSONMap, error) {
 	return JSONMap(object), nil
 }
 
+// contentMigrationMechanicsKinds maps exact-update entity types with a
+// mechanics column to the schema kind their create paths validate against.
+var contentMigrationMechanicsKinds = map[string]string{
+	"card":   mechanicsKindPassiveEffect,
+	"effect": mechanicsKindPassiveEffect,
+	"action": mechanicsKindAction,
+	"spell":  mechanicsKindSpell,
+}
+
+// contentMigrationExactMechanicsProblems applies the insert-path schema check
+// to a mechanics replacement. Clearing mechanics with null stays allowed; a
+// non-object value is left to the patch-model type validation.
+func contentMigrationExactMechanicsProblems(
+	entityType string,
+	fields map[string]json.RawMessage,
+) []mechanicsSchemaError {
+	raw, present := fields["mechanics"]
+	kind, hasMechanics := contentMigrationMechanicsKinds[entityType]
+	if !present || !hasMechanics {
+		return nil
+	}
+	var mechanics JSONMap
+	if err := json.Unmarshal(raw, &mechanics); err != nil || mechanics == nil {
+		return nil
+	}
+	return validateMechanicsSchema(mechanics, kind)
+}
+
 func contentMigrationDesiredUpdate(
 	expected JSONMap,
 	fields map[string]json.RawMessage,
@@ -392,6 +420,10 @@ func (cc *ContentMigrationController) ExactUpdate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "fields содержат неразрешённую или неявную команду"})
 		return
 	}
+	if problems := contentMigrationExactMechanicsProblems(entityType, request.Fields); len(problems) > 0 {
+		writeMechanicsSchemaErrors(c, http.StatusBadRequest, "Ошибка схемы механики", problems)
+		return
+	}
 	if cc.exactUpdate == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Exact update API не настроен"})
 		return
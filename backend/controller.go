@@ -464,6 +464,14 @@ func (cc *CardController) CreateCard(c *gin.Context) {
 		fmt.Printf("✅ [CREATE CARD] Эффекты прошли валидацию\n")
 	}
 
+	if rejectInvalidMechanics(c, req.Mechanics, mechanicsKindPassiveEffect) {
+		return
+	}
+	if _, _, err := parseCardAttunementRequirements(req.AttunementRequirements); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные требования настройки", "details": err.Error()})
+		return
+	}
+
 	// Генерация уникального номера карточки
 	cardNumber := generateCardNumber(cc.db)
 
@@ -504,6 +512,7 @@ func (cc *CardController) CreateCard(c *gin.Context) {
 		RelatedEffects:               NormalizeProperties(req.RelatedEffects),
 		Attunement:                   req.Attunement,
 		RequiresAttunement:           req.RequiresAttunement,
+		AttunementRequirements:       req.AttunementRequirements,
 		Range:                        req.Range,
 		Tags:                         NormalizeProperties(req.Tags),
 		IsTemplate:                   req.IsTemplate,
@@ -613,6 +622,13 @@ func (cc *CardController) UpdateCard(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения карточки"})
 		return
 	}
+	if rejectInvalidMechanicsUpdate(c, card.Mechanics, req.Mechanics, mechanicsKindPassiveEffect) {
+		return
+	}
+	if _, _, err := parseCardAttunementRequirements(req.AttunementRequirements); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные требования настройки", "details": err.Error()})
+		return
+	}
 
 	// Обновление полей
 	if req.Name != "" {
@@ -717,6 +733,14 @@ func (cc *CardController) UpdateCard(c *gin.Context) {
 	if req.RequiresAttunement != nil {
 		card.RequiresAttunement = req.RequiresAttunement
 	}
+	if req.AttunementRequirements != nil {
+		// Пустой объект {} — сброс требований.
+		if len(*req.AttunementRequirements) == 0 {
+			card.AttunementRequirements = nil
+		} else {
+			card.AttunementRequirements = req.AttunementRequirements
+		}
+	}
 	if req.Mechanics != nil {
 		// Пустой объект {} — явный сброс механики.
 		if len(*req.Mechanics) == 0 {
@@ -1066,6 +1090,11 @@ func (ac *ActionController) CreateAction(c *gin.Context) {
 	}
 	log.Printf("✅ [CREATE_ACTION] Вес валиден: %v", req.Weight)
 
+	if rejectInvalidMechanics(c, req.Mechanics, mechanicsKindAction) {
+		log.Printf("❌ [CREATE_ACTION] Механика не прошла схему")
+		return
+	}
+
 	// Проверка уникальности card_number (ID действия)
 	log.Printf("🔍 [CREATE_ACTION] Проверка card_number: %s", req.CardNumber)
 	cardNumber := req.CardNumber
@@ -1202,6 +1231,9 @@ func (ac *ActionController) UpdateAction(c *gin.Context) {
 	if rejectLockedMechanicsMutation(c, action.Support, action.Mechanics, req.Mechanics) {
 		return
 	}
+	if rejectInvalidMechanicsUpdate(c, action.Mechanics, req.Mechanics, mechanicsKindAction) {
+		return
+	}
 
 	// Обновление полей
 	if req.Name != "" {
@@ -1508,6 +1540,10 @@ func (ec *EffectController) CreateEffect(c *gin.Context) {
 		return
 	}
 
+	if rejectInvalidMechanics(c, req.Mechanics, mechanicsKindPassiveEffect) {
+		return
+	}
+
 	// Проверка уникальности card_number (ID эффекта)
 	cardNumber := req.CardNumber
 	if cardNumber == "" {
@@ -1605,6 +1641,9 @@ func (ec *EffectController) UpdateEffect(c *gin.Context) {
 	if rejectLockedMechanicsMutation(c, effect.Support, effect.Mechanics, req.Mechanics) {
 		return
 	}
+	if rejectInvalidMechanicsUpdate(c, effect.Mechanics, req.Mechanics, mechanicsKindPassiveEffect) {
+		return
+	}
 
 	// Обновление полей
 	if req.Name != "" {
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Движок кубовых выражений: «2d6+1d4+3», «4d6kh3», «2d20kl1», «2d6r2»,
+// «1d8mi2», «d%». В отличие от формул механик (mechanics_formula.go) здесь нет
+// идентификаторов персонажа — только кости и числа, зато есть модификаторы
+// кости и точное распределение суммы.
+//
+// Модификаторы терма (в любом порядке, каждый не больше одного раза):
+//
+//	khN / klN — оставить N старших / младших костей (kh = kh1);
+//	rN        — один раз перебросить кость с результатом ≤ N (новый результат остаётся);
+//	miN       — результат кости меньше N считается равным N.
+
+const (
+	// maxDiceExpressionDice — сколько костей выражение может бросить с учётом
+	// перебросов: столько же кубиков принимает payload.roll журнала.
+	maxDiceExpressionDice = maxCharacterEventListItems
+	maxDiceSides          = 1000
+	maxDiceTerms          = 32
+	// maxDiceDistributionWork ограничивает число шагов точного распределения.
+	maxDiceDistributionWork = 20_000_000
+)
+
+// diceExpressionError — выражение не разбирается или не может быть брошено.
+type diceExpressionError struct {
+	Expression string
+	Problem    string
+}
+
+func (e *diceExpressionError) Error() string {
+	return fmt.Sprintf("кубовое выражение «%s»: %s", e.Expression, e.Problem)
+}
+
+// diceTerm — одно слагаемое выражения: константа (Sides == 0) или группа костей.
+type diceTerm struct {
+	Text        string
+	Sign        int
+	Constant    int
+	Count       int
+	Sides       int
+	KeepHighest int
+	KeepLowest  int
+	RerollBelow int
+	Minimum     int
+}
+
+func (t diceTerm) isDice() bool { return t.Sides > 0 }
+
+// rolledDice — сколько костей терм может бросить в худшем случае.
+func (t diceTerm) rolledDice() int {
+	if !t.isDice() {
+		return 0
+	}
+	if t.RerollBelow > 0 {
+		return t.Count * 2
+	}
+	return t.Count
+}
+
+// DiceExpression — разобранное выражение.
+type DiceExpression struct {
+	Source    string
+	Advantage string
+	Terms     []diceTerm
+}
+
+var (
+	diceTermPattern     = regexp.MustCompile(`^(\d*)d(\d+|%)((?:kh|kl|mi|r)\d*)*$`)
+	diceModifierPattern = regexp.MustCompile(`(kh|kl|mi|r)(\d*)`)
+	diceNumberPattern   = regexp.MustCompile(`^\d+$`)
+)
+
+// parseDiceExpression разбирает выражение; пробелы и регистр не важны,
+// русская «к» читается как d.
+func parseDiceExpression(source string) (DiceExpression, error) {
+	expression := DiceExpression{Source: strings.TrimSpace(source), Advantage: "none"}
+	fail := func(format string, args ...interface{}) (DiceExpression, error) {
+		return DiceExpression{}, &diceExpressionError{Expression: expression.Source, Problem: fmt.Sprintf(format, args...)}
+	}
+	normalized := strings.ToLower(expression.Source)
+	normalized = strings.ReplaceAll(normalized, "к", "d")
+	normalized = strings.Join(strings.Fields(normalized), "")
+	if normalized == "" {
+		return fail("пустое выражение")
+	}
+
+	totalDice := 0
+	for position := 0; position < len(normalized); {
+		sign := 1
+		switch normalized[position] {
+		case '+':
+			position++
+		case '-':
+			sign = -1
+			position++
+		default:
+			if position > 0 {
+				return fail("ожидался знак + или - на позиции %d", position)
+			}
+		}
+		end := position
+		for end < len(normalized) && normalized[end] != '+' && normalized[end] != '-' {
+			end++
+		}
+		text := normalized[position:end]
+		position = end
+		if text == "" {
+			return fail("пропущено слагаемое")
+		}
+		if len(expression.Terms) == maxDiceTerms {
+			return fail("больше %d слагаемых", maxDiceTerms)
+		}
+		term, err := parseDiceTerm(text, sign)
+		if err != nil {
+			return fail("%s", err.Error())
+		}
+		totalDice += term.rolledDice()
+		if totalDice > maxDiceExpressionDice {
+			return fail("больше %d костей с учётом перебросов", maxDiceExpressionDice)
+		}
+		expression.Terms = append(expression.Terms, term)
+	}
+	return expression, nil
+}
+
+func parseDiceTerm(text string, sign int) (diceTerm, error) {
+	term := diceTerm{Text: text, Sign: sign}
+	if diceNumberPattern.MatchString(text) {
+		value, err := strconv.Atoi(text)
+		if err != nil || value > 1_000_000 {
+			return term, fmt.Errorf("слишком большое число %s", text)
+		}
+		term.Constant = value
+		return term, nil
+	}
+	match := diceTermPattern.FindStringSubmatch(text)
+	if match == nil {
+		return term, fmt.Errorf("не понимаю слагаемое %s", text)
+	}
+	term.Count = 1
+	if match[1] != "" {
+		term.Count, _ = strconv.Atoi(match[1])
+	}
+	if match[2] == "%" {
+		term.Sides = 100
+	} else {
+		term.Sides, _ = strconv.Atoi(match[2])
+	}
+	if term.Count < 1 || term.Count > maxDiceExpressionDice {
+		return term, fmt.Errorf("количество костей в %s должно быть от 1 до %d", text, maxDiceExpressionDice)
+	}
+	if term.Sides < 1 || term.Sides > maxDiceSides {
+		return term, fmt.Errorf("у кости в %s должно быть от 1 до %d граней", text, maxDiceSides)
+	}
+	suffix := text[strings.Index(text, "d")+1:]
+	suffix = strings.TrimLeft(suffix, "0123456789%")
+	seen := map[string]bool{}
+	for _, modifier := range diceModifierPattern.FindAllStringSubmatch(suffix, -1) {
+		name := modifier[1]
+		if seen[name] {
+			return term, fmt.Errorf("модификатор %s повторяется в %s", name, text)
+		}
+		seen[name] = true
+		value := 1
+		if modifier[2] != "" {
+			value, _ = strconv.Atoi(modifier[2])
+		} else if name == "r" || name == "mi" {
+			return term, fmt.Errorf("модификатору %s в %s нужно число", name, text)
+		}
+		switch name {
+		case "kh":
+			term.KeepHighest = value
+		case "kl":
+			term.KeepLowest = value
+		case "r":
+			term.RerollBelow = value
+		case "mi":
+			term.Minimum = value
+		}
+	}
+	if term.KeepHighest > 0 && term.KeepLowest > 0 {
+		return term, fmt.Errorf("kh и kl нельзя сочетать в %s", text)
+	}
+	if keep := term.KeepHighest + term.KeepLowest; seen["kh"] || seen["kl"] {
+		if keep < 1 || keep > term.Count {
+			return term, fmt.Errorf("оставить можно от 1 до %d костей в %s", term.Count, text)
+		}
+	}
+	if seen["r"] && (term.RerollBelow < 1 || term.RerollBelow >= term.Sides) {
+		return term, fmt.Errorf("переброс в %s должен быть от 1 до %d", text, term.Sides-1)
+	}
+	if seen["mi"] && (term.Minimum < 1 || term.Minimum > term.Sides) {
+		return term, fmt.Errorf("минимум в %s должен быть от 1 до %d", text, term.Sides)
+	}
+	return term, nil
+}
+
+// withAdvantage превращает первый одиночный d20 в 2d20kh1 (преимущество) или
+// 2d20kl1 (помеха). "none" возвращает выражение без изменений.
+func (e DiceExpression) withAdvantage(advantage string) (DiceExpression, error) {
+	advantage = combineAdvantage(advantage)
+	if advantage == "none" {
+		return e, nil
+	}
+	terms := append([]diceTerm(nil), e.Terms...)
+	for i, term := range terms {
+		if term.Sides != 20 || term.Count != 1 || term.KeepHighest > 0 || term.KeepLowest > 0 {
+			continue
+		}
+		term.Count = 2
+		if advantage == "advantage" {
+			term.KeepHighest = 1
+		} else {
+			term.KeepLowest = 1
+		}
+		terms[i] = term
+		e.Terms = terms
+		e.Advantage = advantage
+		total := 0
+		for _, term := range terms {
+			total += term.rolledDice()
+		}
+		if total > maxDiceExpressionDice {
+			return e, &diceExpressionError{Expression: e.Source, Problem: fmt.Sprintf("больше %d костей с учётом перебросов", maxDiceExpressionDice)}
+		}
+		return e, nil
+	}
+	return e, &diceExpressionError{Expression: e.Source, Problem: "преимущество и помеха применимы только к одиночному d20"}
+}
+
+// Roll бросает выражение. Переброшенные и неоставленные кости остаются в
+// разбивке с discarded, поднятые minimum-ом результаты — отдельным модификатором.
+func (e DiceExpression) Roll(rng diceRNG, kind string) EngineRoll {
+	roll := EngineRoll{
+		Kind: kind, Dice: []EngineRollDie{}, Advantage: e.Advantage, Modifiers: []EngineRollModifier{},
+	}
+	for _, term := range e.Terms {
+		if !term.isDice() {
+			roll.Total += term.Sign * term.Constant
+			roll.Modifiers = append(roll.Modifiers, EngineRollModifier{Value: term.Sign * term.Constant, Source: "число"})
+			continue
+		}
+		start := len(roll.Dice)
+		var active []int
+		for i := 0; i < term.Count; i++ {
+			result := rollDie(rng, term.Sides)
+			if term.RerollBelow > 0 && result <= term.RerollBelow {
+				roll.Dice = append(roll.Dice, EngineRollDie{Sides: term.Sides, Result: result, Discarded: true})
+				result = rollDie(rng, term.Sides)
+				roll.Dice = append(roll.Dice, EngineRollDie{Sides: term.Sides, Result: result, Source: "reroll"})
+			} else {
+				roll.Dice = append(roll.Dice, EngineRollDie{Sides: term.Sides, Result: result})
+			}
+			active = append(active, len(roll.Dice)-1)
+		}
+		if keep := term.KeepHighest + term.KeepLowest; keep > 0 {
+			sort.SliceStable(active, func(a, b int) bool {
+				if term.KeepHighest > 0 {
+					return roll.Dice[active[a]].Result > roll.Dice[active[b]].Result
+				}
+				return roll.Dice[active[a]].Result < roll.Dice[active[b]].Result
+			})
+			for _, index := range active[keep:] {
+				roll.Dice[index].Discarded = true
+			}
+			active = active[:keep]
+		}
+		raised := 0
+		for _, index := range active {
+			result := roll.Dice[index].Result
+			if result < term.Minimum {
+				raised += term.Minimum - result
+				result = term.Minimum
+			}
+			roll.Total += term.Sign * result
+		}
+		if term.Sign < 0 {
+			for i := start; i < len(roll.Dice); i++ {
+				roll.Dice[i].Sign = -1
+			}
+		}
+		if raised > 0 {
+			roll.Modifiers = append(roll.Modifiers, EngineRollModifier{
+				Value: term.Sign * raised, Source: "минимум",
+				Reason: fmt.Sprintf("%s: результат кости не ниже %d", term.Text, term.Minimum),
+			})
+		}
+	}
+	roll.Text = describeEngineRoll(roll)
+	return roll
+}
+
+// DiceOutcome — вероятность одного значения суммы.
+type DiceOutcome struct {
+	Total       int     `json:"total"`
+	Probability float64 `json:"probability"`
+}
+
+// DiceDistribution — точное распределение суммы выражения.
+type DiceDistribution struct {
+	Min      int           `json:"min"`
+	Max      int           `json:"max"`
+	Mean     float64       `json:"mean"`
+	Outcomes []DiceOutcome `json:"outcomes"`
+}
+
+// Distribution считает точное распределение суммы: свёрткой независимых
+// костей, а для kh/kl — перебором мультимножеств граней по убыванию
+// (возрастанию) с мультиномиальными весами.
+func (e DiceExpression) Distribution() (DiceDistribution, error) {
+	budget := maxDiceDistributionWork
+	total := map[int]float64{0: 1}
+	for _, term := range e.Terms {
+		var termPMF map[int]float64
+		if !term.isDice() {
+			termPMF = map[int]float64{term.Constant: 1}
+		} else {
+			die := diePMF(term)
+			var err error
+			if term.KeepHighest+term.KeepLowest > 0 {
+				termPMF, err = keptDicePMF(die, term, &budget)
+			} else {
+				termPMF = map[int]float64{0: 1}
+				for i := 0; i < term.Count && err == nil; i++ {
+					termPMF, err = convolvePMF(termPMF, die, 1, &budget)
+				}
+			}
+			if err != nil {
+				return DiceDistribution{}, &diceExpressionError{Expression: e.Source, Problem: err.Error()}
+			}
+		}
+		var err error
+		total, err = convolvePMF(total, termPMF, term.Sign, &budget)
+		if err != nil {
+			return DiceDistribution{}, &diceExpressionError{Expression: e.Source, Problem: err.Error()}
+		}
+	}
+
+	distribution := DiceDistribution{Outcomes: make([]DiceOutcome, 0, len(total))}
+	for value, probability := range total {
+		distribution.Outcomes = append(distribution.Outcomes, DiceOutcome{Total: value, Probability: probability})
+		distribution.Mean += float64(value) * probability
+	}
+	sort.Slice(distribution.Outcomes, func(a, b int) bool {
+		return distribution.Outcomes[a].Total < distribution.Outcomes[b].Total
+	})
+	distribution.Min = distribution.Outcomes[0].Total
+	distribution.Max = distribution.Outcomes[len(distribution.Outcomes)-1].Total
+	return distribution, nil
+}
+
+// diePMF — распределение одной кости терма с учётом переброса и минимума.
+func diePMF(term diceTerm) map[int]float64 {
+	sides := float64(term.Sides)
+	rerollShare := float64(term.RerollBelow) / sides
+	pmf := make(map[int]float64, term.Sides)
+	for face := 1; face <= term.Sides; face++ {
+		probability := rerollShare / sides
+		if face > term.RerollBelow {
+			probability += 1 / sides
+		}
+		value := face
+		if value < term.Minimum {
+			value = term.Minimum
+		}
+		pmf[value] += probability
+	}
+	return pmf
+}
+
+func convolvePMF(left, right map[int]float64, sign int, budget *int) (map[int]float64, error) {
+	*budget -= len(left) * len(right)
+	if *budget < 0 {
+		return nil, fmt.Errorf("распределение слишком сложное для точного расчёта")
+	}
+	result := make(map[int]float64, len(left)+len(right))
+	for a, pa := range left {
+		for b, pb := range right {
+			result[a+sign*b] += pa * pb
+		}
+	}
+	return result, nil
+}
+
+// keptDicePMF — распределение суммы k старших (младших) из n костей. Грани
+// перебираются от лучшей к худшей; на каждой выбирается, сколько из
+// оставшихся костей её показали (вес C(r, j)·p^j), и первые k попавших в
+// «лучшие» кости идут в сумму.
+func keptDicePMF(die map[int]float64, term diceTerm, budget *int) (map[int]float64, error) {
+	faces := make([]int, 0, len(die))
+	for value := range die {
+		faces = append(faces, value)
+	}
+	keep := term.KeepHighest
+	if keep > 0 {
+		sort.Sort(sort.Reverse(sort.IntSlice(faces)))
+	} else {
+		keep = term.KeepLowest
+		sort.Ints(faces)
+	}
+	type state struct{ remaining, kept, sum int }
+	states := map[state]float64{{remaining: term.Count, kept: 0, sum: 0}: 1}
+	for _, face := range faces {
+		probability := die[face]
+		next := make(map[state]float64, len(states))
+		for current, weight := range states {
+			*budget -= current.remaining + 1
+			if *budget < 0 {
+				return nil, fmt.Errorf("распределение слишком сложное для точного расчёта")
+			}
+			power := 1.0
+			for j := 0; j <= current.remaining; j++ {
+				taken := j
+				if current.kept+taken > keep {
+					taken = keep - current.kept
+				}
+				key := state{remaining: current.remaining - j, kept: current.kept + taken, sum: current.sum + taken*face}
+				next[key] += weight * binomial(current.remaining, j) * power
+				power *= probability
+			}
+		}
+		states = next
+	}
+	result := map[int]float64{}
+	for current, weight := range states {
+		if current.remaining == 0 {
+			result[current.sum] += weight
+		}
+	}
+	return result, nil
+}
+
+func binomial(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+// rollDiceTotal — короткий путь для серверного кода, которому нужна только сумма.
+func rollDiceTotal(rng diceRNG, source string) (int, error) {
+	expression, err := parseDiceExpression(source)
+	if err != nil {
+		return 0, err
+	}
+	return expression.Roll(rng, "other").Total, nil
+}
+
+// shuffleWithDice — перемешивание Фишера–Йетса на серверном генераторе.
+func shuffleWithDice(rng diceRNG, n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, rng.Intn(i+1))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxDiceRollBodyBytes = 8 << 10
+
+// DiceRollRequest — выражение для броска. Seed != 0 делает бросок повторяемым,
+// Advantage ("advantage" | "disadvantage") превращает одиночный d20 в 2d20kh1/kl1,
+// "none" оставляет бросок обычным; прочие значения отклоняются.
+type DiceRollRequest struct {
+	Expression   string `json:"expression" binding:"required"`
+	Kind         string `json:"kind"`
+	Advantage    string `json:"advantage" binding:"omitempty,oneof=none advantage disadvantage"`
+	Seed         int64  `json:"seed"`
+	Distribution bool   `json:"distribution"`
+}
+
+// DiceController — серверный бросок кубовых выражений (dice.go).
+type DiceController struct{}
+
+func NewDiceController() *DiceController {
+	return &DiceController{}
+}
+
+// Roll бросает выражение и возвращает разбивку в форме payload.roll журнала
+// персонажа; по запросу — ещё и точное распределение суммы.
+func (dc *DiceController) Roll(c *gin.Context) {
+	var req DiceRollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса", "details": err.Error()})
+		return
+	}
+	kind := req.Kind
+	if kind == "" {
+		kind = "other"
+	}
+	if !oneOf(kind, "d20", "damage", "healing", "check", "save", "other") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестный вид броска", "details": kind})
+		return
+	}
+
+	expression, err := parseDiceExpression(req.Expression)
+	if err == nil && req.Advantage != "" {
+		expression, err = expression.withAdvantage(req.Advantage)
+	}
+	var expressionErr *diceExpressionError
+	if errors.As(err, &expressionErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное кубовое выражение", "details": expressionErr.Error()})
+		return
+	}
+
+	response := gin.H{
+		"expression": expression.Source,
+		"roll":       expression.Roll(newDiceRNG(req.Seed), kind),
+	}
+	if req.Distribution {
+		distribution, err := expression.Distribution()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось посчитать распределение", "details": err.Error()})
+			return
+		}
+		response["distribution"] = distribution
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func mustDiceExpression(t *testing.T, source string) DiceExpression {
+	t.Helper()
+	expression, err := parseDiceExpression(source)
+	if err != nil {
+		t.Fatalf("parse %q: %v", source, err)
+	}
+	return expression
+}
+
+func TestParseDiceExpression(t *testing.T) {
+	expression := mustDiceExpression(t, " 2d6 + 1к4 - 3 + 4d6kh3 + 2d6r2 + d8mi2 + d% ")
+	if len(expression.Terms) != 7 {
+		t.Fatalf("want 7 terms, got %+v", expression.Terms)
+	}
+	if expression.Terms[1].Sides != 4 || expression.Terms[2].Sign != -1 || expression.Terms[2].Constant != 3 {
+		t.Fatalf("unexpected terms: %+v", expression.Terms[:3])
+	}
+	if term := expression.Terms[3]; term.Count != 4 || term.KeepHighest != 3 {
+		t.Fatalf("kh not parsed: %+v", term)
+	}
+	if expression.Terms[4].RerollBelow != 2 || expression.Terms[5].Minimum != 2 || expression.Terms[6].Sides != 100 {
+		t.Fatalf("modifiers not parsed: %+v", expression.Terms[4:])
+	}
+	for _, source := range []string{"", "2d", "d0", "1d6+", "2x6", "4d6kh5", "2d6khkl", "1d6r6", "1d6mi7", "1d6r", "300d6", "129d6r1", "1d6kh1kh1"} {
+		var expressionErr *diceExpressionError
+		if _, err := parseDiceExpression(source); !errors.As(err, &expressionErr) {
+			t.Fatalf("%q must be rejected, got %v", source, err)
+		}
+	}
+}
+
+func TestDiceRollBreakdown(t *testing.T) {
+	roll := mustDiceExpression(t, "4d6kh3 + 2").Roll(scripted(t, 3, 1, 6, 5), "other")
+	if roll.Total != 16 || len(roll.Dice) != 4 || !roll.Dice[1].Discarded {
+		t.Fatalf("kh3 must drop the lowest die: %+v", roll)
+	}
+	rerolled := mustDiceExpression(t, "2d6r2").Roll(scripted(t, 1, 1, 5), "damage")
+	if rerolled.Total != 6 || len(rerolled.Dice) != 3 || !rerolled.Dice[0].Discarded || rerolled.Dice[1].Source != "reroll" {
+		t.Fatalf("reroll must happen once and keep the new result: %+v", rerolled)
+	}
+	minimum := mustDiceExpression(t, "2d8mi3 - 1d4").Roll(scripted(t, 1, 7, 2), "damage")
+	if minimum.Total != 8 || minimum.Modifiers[0].Value != 2 || minimum.Dice[2].Sign != -1 {
+		t.Fatalf("minimum must raise low dice: %+v", minimum)
+	}
+}
+
+func TestDiceRollAdvantage(t *testing.T) {
+	expression, err := mustDiceExpression(t, "1d20+5").withAdvantage("disadvantage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roll := expression.Roll(scripted(t, 17, 4), "d20")
+	if roll.Total != 9 || roll.Advantage != "disadvantage" || !roll.Dice[0].Discarded {
+		t.Fatalf("disadvantage must keep the lower d20: %+v", roll)
+	}
+	if _, err := mustDiceExpression(t, "2d6").withAdvantage("advantage"); err == nil {
+		t.Fatal("advantage without a d20 must be rejected")
+	}
+}
+
+func TestDiceRollMatchesEventPayload(t *testing.T) {
+	roll := mustDiceExpression(t, "2d20kh1 + 1d4r1 - 2").Roll(newDiceRNG(42), "d20")
+	raw, err := json.Marshal(map[string]interface{}{"type": "roll", "label": "Проверка", "roll": roll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCharacterEvent("roll", payload); err != nil {
+		t.Fatalf("dice roll must be a valid roll payload: %v", err)
+	}
+}
+
+func TestDiceRollIsReproducibleWithSeed(t *testing.T) {
+	expression := mustDiceExpression(t, "8d6 + 4d6kh3")
+	first := expression.Roll(newDiceRNG(7), "other")
+	second := expression.Roll(newDiceRNG(7), "other")
+	if first.Text != second.Text {
+		t.Fatalf("same seed must give the same roll: %q vs %q", first.Text, second.Text)
+	}
+}
+
+func probabilityOf(distribution DiceDistribution, total int) float64 {
+	for _, outcome := range distribution.Outcomes {
+		if outcome.Total == total {
+			return outcome.Probability
+		}
+	}
+	return 0
+}
+
+func TestDiceDistribution(t *testing.T) {
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	twoD6, err := mustDiceExpression(t, "2d6+1").Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if twoD6.Min != 3 || twoD6.Max != 13 || !near(twoD6.Mean, 8) || !near(probabilityOf(twoD6, 8), 6.0/36) {
+		t.Fatalf("unexpected 2d6+1: %+v", twoD6)
+	}
+	advantage, err := mustDiceExpression(t, "2d20kh1").Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(probabilityOf(advantage, 20), 39.0/400) || !near(advantage.Mean, 13.825) {
+		t.Fatalf("unexpected advantage: mean %v p20 %v", advantage.Mean, probabilityOf(advantage, 20))
+	}
+	stats, err := mustDiceExpression(t, "4d6kh3").Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(probabilityOf(stats, 18), 21.0/1296) || !near(probabilityOf(stats, 3), 1.0/1296) {
+		t.Fatalf("unexpected 4d6kh3: %+v", stats)
+	}
+	// Great Weapon Fighting: 2d6r2, среднее 8⅓.
+	gwf, err := mustDiceExpression(t, "2d6r2").Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(gwf.Mean, 25.0/3) {
+		t.Fatalf("unexpected reroll mean %v", gwf.Mean)
+	}
+	minimum, err := mustDiceExpression(t, "1d4mi2 - 1").Distribution()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if minimum.Min != 1 || !near(probabilityOf(minimum, 1), 0.5) {
+		t.Fatalf("unexpected minimum: %+v", minimum)
+	}
+	total := 0.0
+	for _, outcome := range stats.Outcomes {
+		total += outcome.Probability
+	}
+	if !near(total, 1) {
+		t.Fatalf("probabilities must sum to 1, got %v", total)
+	}
+}
+
+func TestDiceRollRejectsUnknownAdvantage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/dice/roll", NewDiceController().Roll)
+	for advantage, want := range map[string]int{
+		"advantage":    http.StatusOK,
+		"none":         http.StatusOK,
+		"":             http.StatusOK,
+		"adv":          http.StatusBadRequest,
+		"Disadvantage": http.StatusBadRequest,
+	} {
+		body := `{"expression": "1d20+3", "seed": 7, "advantage": "` + advantage + `"}`
+		request := httptest.NewRequest(http.MethodPost, "/dice/roll", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != want {
+			t.Fatalf("advantage=%q: status %d, want %d: %s", advantage, response.Code, want, response.Body.String())
+		}
+	}
+}
@@ -23,6 +23,7 @@ func validateEncounterApplyEnvelope(req ApplyRequest) error {
 		{name: "patches", count: len(req.Patches)},
 		{name: "add", count: len(req.Add)},
 		{name: "remove", count: len(req.Remove)},
+		{name: "order", count: len(req.Order)},
 		{name: "events", count: len(req.Events)},
 		{name: "log", count: len(req.Log)},
 	} {
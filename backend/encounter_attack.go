@@ -0,0 +1,701 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Серверная атака в онлайн-бою: бросок атаки, сравнение с КД цели, урон с
+// поправками сопротивлений и состояния из исходов — одной операцией боя.
+// Клиент называет атакующего, цель и источник (оружие или действие), бросает
+// сервер; результат уходит подписчикам так же, как операция /apply.
+
+const maxEncounterAttackBodyBytes = 4 << 10
+
+// EncounterAttackRequest — атака участника боя. Источник — ровно одно из
+// card_id (экипированное оружие) или action_id (действие с attack_roll).
+type EncounterAttackRequest struct {
+	ExpectedSeq *int64     `json:"expected_seq"`
+	AttackerID  string     `json:"attacker_id" binding:"required"`
+	TargetID    string     `json:"target_id" binding:"required"`
+	CardID      *uuid.UUID `json:"card_id"`
+	ActionID    *uuid.UUID `json:"action_id"`
+	// Advantage — внешнее преимущество/помеха (выбор игрока или мастера);
+	// состояния участников и отметки искусности сервер учитывает сам.
+	Advantage string `json:"advantage" binding:"omitempty,oneof=none advantage disadvantage"`
+	// UseMastery — false отказывается от свойства искусности оружия в этой
+	// атаке (Опрокидывающее, Отталкивающее и др. применяются по желанию).
+	UseMastery *bool `json:"use_mastery"`
+}
+
+// encounterWeaponDamage — одна строка урона оружия.
+type encounterWeaponDamage struct {
+	Dice string
+	Type string
+}
+
+// encounterWeapon — оружейные факты карточки, нужные атаке: характеристика,
+// дальность, строки урона, магические бонусы и id эффекта искусности.
+type encounterWeapon struct {
+	Name        string
+	WeaponType  string
+	Category    string
+	Ability     string
+	Ranged      bool
+	Damage      []encounterWeaponDamage
+	AttackBonus int
+	DamageBonus int
+	Mastery     string
+}
+
+// encounterWeaponFromCard читает оружие из боевых статов карточки
+// (buildBattleStats): структурный battle_profile, а без него — damage_dice,
+// damage_type, to_hit_bonus и EnchantBonus. false — карточка не оружие или
+// у неё нет урона.
+func encounterWeaponFromCard(card Card) (encounterWeapon, bool) {
+	stats := (&CardController{}).buildBattleStats(card)
+	if stats["kind"] != "weapon" {
+		return encounterWeapon{}, false
+	}
+	profile, _ := stats["battle_profile"].(map[string]interface{})
+	weapon := encounterWeapon{Name: card.Name, Ability: "str"}
+	if card.WeaponType != nil {
+		weapon.WeaponType = *card.WeaponType
+	}
+	weapon.WeaponType = stringFieldOr(profile, "weapon_type", weapon.WeaponType)
+	weapon.Category = stringField(profile, "proficiency_category")
+	if card.Mastery != nil {
+		weapon.Mastery = *card.Mastery
+	}
+	weapon.Mastery = stringFieldOr(profile, "mastery_effect_id", weapon.Mastery)
+
+	properties := map[string]bool{}
+	if card.Properties != nil {
+		for _, property := range *card.Properties {
+			properties[strings.ToLower(strings.TrimSpace(property))] = true
+		}
+	}
+	switch ability := stringField(profile, "attack_ability"); ability {
+	case "str", "dex", "finesse":
+		weapon.Ability = ability
+	default:
+		if properties[PropertyFinesse] {
+			weapon.Ability = "finesse"
+		}
+	}
+	if mode := stringField(profile, "default_attack_mode"); mode != "" {
+		weapon.Ranged = mode == "ranged"
+	} else {
+		weapon.Ranged = properties[PropertyAmmunition]
+	}
+	if weapon.Ranged && weapon.Ability == "str" && stringField(profile, "attack_ability") == "" {
+		weapon.Ability = "dex"
+	}
+
+	lines, _ := profile["damage_lines"].([]interface{})
+	for _, raw := range lines {
+		line, ok := raw.(map[string]interface{})
+		if !ok || stringField(line, "dice") == "" || stringField(line, "type") == "" {
+			continue
+		}
+		weapon.Damage = append(weapon.Damage, encounterWeaponDamage{Dice: stringField(line, "dice"), Type: stringField(line, "type")})
+	}
+	if len(weapon.Damage) == 0 {
+		dice, _ := stats["damage_dice"].(string)
+		damageType, _ := stats["damage_type"].(string)
+		if dice == "" || damageType == "" {
+			return encounterWeapon{}, false
+		}
+		weapon.Damage = []encounterWeaponDamage{{Dice: dice, Type: damageType}}
+	}
+
+	if enchantment, ok := profile["enchantment"].(map[string]interface{}); ok {
+		if value, ok := mechanicsNumber(enchantment["attack_bonus"]); ok {
+			weapon.AttackBonus = int(value)
+		}
+		if value, ok := mechanicsNumber(enchantment["damage_bonus"]); ok {
+			weapon.DamageBonus = int(value)
+		}
+	} else if card.EnchantBonus != nil {
+		weapon.AttackBonus, weapon.DamageBonus = *card.EnchantBonus, *card.EnchantBonus
+	}
+	if toHit, ok := stats["to_hit_bonus"].(*int); ok && toHit != nil {
+		weapon.AttackBonus += *toHit
+	}
+	return weapon, true
+}
+
+// attackAbility — характеристика атаки оружием: фехтовальное берёт лучшую из
+// СИЛ и ЛВК атакующего.
+func (w encounterWeapon) attackAbility(attacker mechanicsActor) string {
+	if w.Ability != "finesse" {
+		return w.Ability
+	}
+	if attacker.abilityModifier("dex") > attacker.abilityModifier("str") {
+		return "dex"
+	}
+	return "str"
+}
+
+// mechanics синтезирует механику атаки оружием для атакующего: attack_roll с
+// характеристикой оружия, основная строка урона получает модификатор
+// характеристики и магический бонус, дополнительные — только кости.
+func (w encounterWeapon) mechanics(attacker mechanicsActor) JSONMap {
+	ability := w.attackAbility(attacker)
+	kind := "weapon_melee"
+	if w.Ranged {
+		kind = "weapon_ranged"
+	}
+	onHit := make([]interface{}, 0, len(w.Damage))
+	for i, line := range w.Damage {
+		formula := line.Dice
+		if i == 0 {
+			formula = fmt.Sprintf("%s + %s", formula, ability)
+			if w.DamageBonus != 0 {
+				formula = fmt.Sprintf("%s %+d", formula, w.DamageBonus)
+			}
+		}
+		onHit = append(onHit, map[string]interface{}{"kind": "damage", "dice": formula, "type": line.Type})
+	}
+	return JSONMap{"effects": []interface{}{map[string]interface{}{
+		"resolution": "attack_roll", "attack_kind": kind, "ability": ability, "on_hit": onHit,
+	}}}
+}
+
+func normalizeWeaponProficiency(value string) string {
+	normalized := strings.Join(strings.FieldsFunc(strings.ToLower(strings.TrimSpace(value)), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	}), "_")
+	switch normalized {
+	case "all_weapon", "all_weapons", "weapon", "weapons":
+		return "all"
+	case "simple_weapon", "simple_weapons":
+		return "simple"
+	case "martial_weapon", "martial_weapons":
+		return "martial"
+	}
+	return normalized
+}
+
+// characterWeaponProficient — владеет ли персонаж оружием (зеркало
+// isWeaponProficient клиента): rule_state.proficiencies.weapons содержит «все»,
+// точный тип, категорию или группу категория_дальность. Без списка владение не
+// ограничено — так же, как у листов, собранных до проекции владений.
+func characterWeaponProficient(character CharacterV3, weapon encounterWeapon) bool {
+	if character.RuleState == nil {
+		return true
+	}
+	proficiencies, _ := (*character.RuleState)["proficiencies"].(map[string]interface{})
+	grants, listed := proficiencies["weapons"].([]interface{})
+	if !listed {
+		return true
+	}
+	weaponType := normalizeWeaponProficiency(weapon.WeaponType)
+	category := normalizeWeaponProficiency(weapon.Category)
+	group := ""
+	if category != "" {
+		group = category + "_melee"
+		if weapon.Ranged {
+			group = category + "_ranged"
+		}
+	}
+	for _, raw := range grants {
+		grant, _ := raw.(string)
+		switch normalizeWeaponProficiency(grant) {
+		case "":
+		case "all", weaponType, category, group:
+			return true
+		}
+	}
+	return false
+}
+
+// encounterCombatantActor собирает проекцию участника боя. Персонаж — лист с
+// особенностями и переменными; существо мастера — статблок monsterId, если он
+// указан, иначе пустая проекция. Поверх идут КД и хиты из состояния боя,
+// damageResistances существа и активные эффекты участника.
+func encounterCombatantActor(tx *gorm.DB, combatant map[string]interface{}, characters map[uuid.UUID]CharacterV3) (mechanicsActor, *Monster, error) {
+	actorID := stringField(combatant, "actorId")
+	name := stringFieldOr(combatant, "name", actorID)
+	var actor mechanicsActor
+	var monster *Monster
+	if characterID, err := uuid.Parse(stringField(combatant, "characterId")); err == nil {
+		character, exists := characters[characterID]
+		if !exists {
+			return actor, nil, &encounterAccessError{Status: http.StatusNotFound, Message: "персонаж-участник не найден"}
+		}
+		built, err := characterFormulaActor(tx, character)
+		if err != nil {
+			return actor, nil, err
+		}
+		actor = built
+	} else if monsterID, err := uuid.Parse(stringField(combatant, "monsterId")); err == nil {
+		var loaded Monster
+		if err := tx.First(&loaded, "id = ?", monsterID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return actor, nil, &encounterAccessError{Status: http.StatusNotFound, Message: "статблок существа не найден"}
+			}
+			return actor, nil, err
+		}
+		var passives []JSONMap
+		if loaded.EffectIDs != nil && len(*loaded.EffectIDs) > 0 {
+			var effects []Effect
+			if err := tx.Where("id IN ?", []string(*loaded.EffectIDs)).Find(&effects).Error; err != nil {
+				return actor, nil, err
+			}
+			for _, effect := range effects {
+				if effect.Mechanics != nil {
+					passives = append(passives, *effect.Mechanics)
+				}
+			}
+		}
+		actor = mechanicsActorFromMonster(loaded, passives...)
+		monster = &loaded
+	} else {
+		actor = newMechanicsActor(actorID, name)
+		actor.IsMonster = true
+	}
+	actor.ID, actor.Name = actorID, name
+
+	if value, ok := mechanicsNumber(combatant["ac"]); ok {
+		actor.ArmorClass = int(value)
+	}
+	if value, ok := mechanicsNumber(combatant["hp"]); ok {
+		actor.HP = int(value)
+	}
+	if value, ok := mechanicsNumber(combatant["maxHp"]); ok {
+		actor.MaxHP = int(value)
+	}
+	if value, ok := mechanicsNumber(combatant["temp"]); ok {
+		actor.TempHP = int(value)
+	}
+	if resistances, ok := combatant["damageResistances"].(map[string]interface{}); ok {
+		declared := DamageResistances{}
+		for damageType, raw := range resistances {
+			if value, ok := raw.(string); ok {
+				declared[damageType] = value
+			}
+		}
+		actor.absorbDamageResistances(declared)
+	}
+	for _, effect := range encounterCombatantEffects(combatant) {
+		if mechanics, ok := effect["mechanics"].(map[string]interface{}); ok {
+			actor.absorbActiveEffect(JSONMap(mechanics))
+		}
+	}
+	return actor, monster, nil
+}
+
+// encounterActorHasAction — может ли участник исполнить действие: персонажу оно
+// должно достаться от особенностей, существу со статблоком — быть в его
+// ActionIDs; существо мастера без статблока исполняет любое действие.
+func encounterActorHasAction(tx *gorm.DB, access encounterActorAccess, characters map[uuid.UUID]CharacterV3, monster *Monster, action Action) (bool, error) {
+	if access.IsCharacter {
+		bundle, err := loadCharacterFeatureBundle(tx, characters[access.CharacterID])
+		if err != nil {
+			return false, err
+		}
+		for _, granted := range bundle.Actions {
+			if granted.ID == action.ID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if monster == nil {
+		return true, nil
+	}
+	if monster.ActionIDs != nil {
+		for _, actionID := range *monster.ActionIDs {
+			if actionID == action.ID.String() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func hasAttackRollInteraction(mechanics JSONMap) bool {
+	for _, interaction := range mechanicsInteractions(mechanics) {
+		if interaction["resolution"] == "attack_roll" {
+			return true
+		}
+	}
+	return false
+}
+
+var attackOutcomeLabels = map[string]string{"crit": "критическое попадание", "hit": "попадание", "miss": "промах"}
+
+// resolveEncounterAttack переводит результат механики атаки в патчи участников и
+// журнал. Урон сначала снимает временные хиты, затем хиты; лечение не выше
+// максимума; наложенные состояния становятся активными эффектами. Записи урона
+// адресованы персонажам — commitEncounterOp по ним откроет спасброски концентрации.
+func resolveEncounterAttack(state map[string]interface{}, attacker mechanicsActor, source string, result MechanicsResult) ([]CombatantPatch, []BattleLogEntry) {
+	byID := map[string]map[string]interface{}{}
+	combatants, _ := state["combatants"].([]interface{})
+	for _, item := range combatants {
+		if combatant, ok := item.(map[string]interface{}); ok {
+			byID[stringField(combatant, "actorId")] = combatant
+		}
+	}
+	characterOf := func(actorID string) string {
+		characterID, _ := byID[actorID]["characterId"].(string)
+		return characterID
+	}
+	nameOf := func(actorID string) string {
+		return stringFieldOr(byID[actorID], "name", actorID)
+	}
+
+	var log []BattleLogEntry
+	for _, check := range result.Checks {
+		if check.Resolution != "attack_roll" {
+			continue
+		}
+		label := fmt.Sprintf("Атака: %s → %s — %s", source, nameOf(check.TargetID), attackOutcomeLabels[check.Branch])
+		entry := BattleLogEntry{Message: fmt.Sprintf("%s: %s, %s", attacker.Name, label, check.Roll.Text)}
+		if characterID := characterOf(attacker.ID); characterID != "" {
+			entry.TargetCharacterID, entry.Type = characterID, "roll"
+			entry.Payload = JSONMap{"type": "roll", "label": label, "roll": map[string]interface{}(check.Roll.toJSONMap())}
+		}
+		log = append(log, entry)
+	}
+
+	type runtime struct {
+		hp, maxHP, temp int
+		effects         []interface{}
+		touched         bool
+	}
+	runtimes := map[string]*runtime{}
+	var order []string
+	runtimeOf := func(actorID string) *runtime {
+		if current, ok := runtimes[actorID]; ok {
+			return current
+		}
+		combatant := byID[actorID]
+		current := &runtime{}
+		if value, ok := mechanicsNumber(combatant["hp"]); ok {
+			current.hp = int(value)
+		}
+		if value, ok := mechanicsNumber(combatant["maxHp"]); ok {
+			current.maxHP = int(value)
+		}
+		if value, ok := mechanicsNumber(combatant["temp"]); ok {
+			current.temp = int(value)
+		}
+		existing, _ := combatant["activeEffects"].([]interface{})
+		current.effects = append([]interface{}{}, existing...)
+		runtimes[actorID] = current
+		order = append(order, actorID)
+		return current
+	}
+
+	for _, outcome := range result.Outcomes {
+		if _, known := byID[outcome.TargetID]; !known {
+			continue
+		}
+		characterID := characterOf(outcome.TargetID)
+		name := nameOf(outcome.TargetID)
+		switch outcome.Kind {
+		case "damage":
+			current := runtimeOf(outcome.TargetID)
+			current.touched = true
+			absorbed := outcome.Amount
+			if absorbed > current.temp {
+				absorbed = current.temp
+			}
+			current.temp -= absorbed
+			current.hp -= outcome.Amount - absorbed
+			if current.hp < 0 {
+				current.hp = 0
+			}
+			entry := BattleLogEntry{
+				Message:           fmt.Sprintf("%s получает %d урона (%s) от %s", name, outcome.Amount, outcome.DamageType, attacker.Name),
+				TargetCharacterID: characterID,
+			}
+			if characterID != "" {
+				entry.Type = "damage"
+				entry.Payload = JSONMap{"type": "damage", "amount": outcome.Amount, "damageType": outcome.DamageType, "source": attacker.Name}
+				if outcome.Roll != nil {
+					entry.Payload["roll"] = map[string]interface{}(outcome.Roll.toJSONMap())
+				}
+			}
+			log = append(log, entry)
+			if characterID != "" && oneOf(outcome.Adjustment, "resistance", "immunity", "vulnerability") {
+				log = append(log, BattleLogEntry{
+					Message:           fmt.Sprintf("%s: %s к урону (%s), %d → %d", name, outcome.Adjustment, outcome.DamageType, outcome.RawAmount, outcome.Amount),
+					TargetCharacterID: characterID,
+					Type:              "narrative",
+					Payload: JSONMap{"type": "narrative", "text": fmt.Sprintf("Урон %s: %d → %d", outcome.DamageType, outcome.RawAmount, outcome.Amount), "damageAdjustment": map[string]interface{}{
+						"damageType": outcome.DamageType, "adjustment": outcome.Adjustment,
+						"before": outcome.RawAmount, "after": outcome.Amount, "sourceEntityIds": []string{},
+					}},
+				})
+			}
+		case "healing":
+			current := runtimeOf(outcome.TargetID)
+			current.touched = true
+			current.hp += outcome.Amount
+			if current.maxHP > 0 && current.hp > current.maxHP {
+				current.hp = current.maxHP
+			}
+			entry := BattleLogEntry{Message: fmt.Sprintf("%s восстанавливает %d хитов", name, outcome.Amount), TargetCharacterID: characterID}
+			if characterID != "" {
+				entry.Type = "healing"
+				entry.Payload = JSONMap{"type": "healing", "amount": outcome.Amount, "source": attacker.Name}
+			}
+			log = append(log, entry)
+		case "condition":
+			if outcome.Op != "apply" {
+				continue
+			}
+			current := runtimeOf(outcome.TargetID)
+			current.touched = true
+			effect := map[string]interface{}{
+				"id": "attack-" + uuid.NewString(), "name": outcome.Value, "source": source,
+				"mechanics": map[string]interface{}{"kind": "condition", "value": outcome.Value},
+			}
+			if outcome.RoundsLeft != nil {
+				effect["roundsLeft"] = float64(*outcome.RoundsLeft)
+			}
+			current.effects = append(current.effects, effect)
+			entry := BattleLogEntry{Message: fmt.Sprintf("%s: состояние «%s» (%s)", name, outcome.Value, source), TargetCharacterID: characterID}
+			if characterID != "" {
+				entry.Type = "condition_applied"
+				entry.Payload = JSONMap{"type": "condition_applied", "condition": outcome.Value, "source": source}
+			}
+			log = append(log, entry)
+		case "condition_immune":
+			log = append(log, BattleLogEntry{Message: fmt.Sprintf("%s невосприимчив к состоянию «%s»", name, outcome.Value)})
+		}
+	}
+
+	patches := make([]CombatantPatch, 0, len(order))
+	for _, actorID := range order {
+		current := runtimes[actorID]
+		if !current.touched {
+			continue
+		}
+		patches = append(patches, CombatantPatch{ActorID: actorID, Set: JSONMap{
+			"hp": current.hp, "temp": current.temp, "activeEffects": current.effects,
+		}})
+	}
+	return patches, log
+}
+
+// Attack — POST /api/encounters/:id/attack. Атакует мастер боя (любым участником)
+// или контроллер персонажа (своим персонажем). Оружие персонажа должно быть
+// экипировано, действие — принадлежать персонажу или статблоку существа. Отметки
+// атакующего на бросок атаки (Ослабляющее, Отвлекающее) учитываются и снимаются,
+// свойство искусности оружия исполняется на исходе броска. Бросок атаки, урон и
+// записи журнала коммитятся одной операцией боя.
+func (ec *EncounterController) Attack(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req EncounterAttackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if req.ExpectedSeq == nil || *req.ExpectedSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	if (req.CardID == nil) == (req.ActionID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "укажите ровно одно из card_id или action_id"})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	var newState JSONMap
+	var newSeq int64
+	var result MechanicsResult
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, true)
+		if err != nil {
+			return err
+		}
+		actors, accessErr := actorAccessFromCombatants(combatants, characters)
+		if accessErr != nil {
+			return accessErr
+		}
+		access, attackerExists := actors[req.AttackerID]
+		if _, targetExists := actors[req.TargetID]; !attackerExists || !targetExists {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "участник боя не найден"}
+		}
+		if caller != enc.OwnerUserID && (!access.IsCharacter || access.ControllerUserID != caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "атаковать может мастер боя или контроллер персонажа"}
+		}
+		var attackerCombatant, targetCombatant map[string]interface{}
+		for _, combatant := range combatants {
+			if combatant["actorId"] == req.AttackerID {
+				attackerCombatant = combatant
+			}
+			if combatant["actorId"] == req.TargetID {
+				targetCombatant = combatant
+			}
+		}
+		attacker, monster, err := encounterCombatantActor(tx, attackerCombatant, characters)
+		if err != nil {
+			return err
+		}
+		target, targetMonster, err := encounterCombatantActor(tx, targetCombatant, characters)
+		if err != nil {
+			return err
+		}
+
+		markAdvantage, markPatches, markLog := consumeEncounterAttackMarks(state, attacker.ID, target.ID)
+		invocation := mechanicsInvocation{
+			Actor: attacker, Targets: []mechanicsActor{target},
+			Advantage: combineAdvantage(req.Advantage, markAdvantage), RNG: newDiceRNG(0),
+		}
+		var weapon encounterWeapon
+		var mastery *Effect
+		if req.CardID != nil {
+			var card Card
+			if err := tx.First(&card, "id = ?", *req.CardID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &encounterAccessError{Status: http.StatusNotFound, Message: "оружие не найдено"}
+				}
+				return err
+			}
+			var ok bool
+			weapon, ok = encounterWeaponFromCard(card)
+			if !ok {
+				return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "карточка не является оружием с уроном"}
+			}
+			if access.IsCharacter {
+				character := characters[access.CharacterID]
+				equipped := false
+				for _, cardID := range characterEquippedCardIDs(character) {
+					equipped = equipped || cardID == card.ID.String()
+				}
+				if !equipped {
+					return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "атаковать можно только экипированным оружием"}
+				}
+				invocation.WithoutProficiency = !characterWeaponProficient(character, weapon)
+				if req.UseMastery == nil || *req.UseMastery {
+					if mastery, err = loadCharacterWeaponMastery(tx, character, weapon); err != nil {
+						return err
+					}
+				}
+			}
+			invocation.Source = weapon.Name
+			invocation.Mechanics = weapon.mechanics(attacker)
+			invocation.WeaponMod = attacker.abilityModifier(weapon.attackAbility(attacker))
+			if weapon.AttackBonus != 0 {
+				invocation.AttackModifiers = []EngineRollModifier{{Value: weapon.AttackBonus, Source: "магия"}}
+			}
+		} else {
+			var action Action
+			if err := tx.First(&action, "id = ?", *req.ActionID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &encounterAccessError{Status: http.StatusNotFound, Message: "действие не найдено"}
+				}
+				return err
+			}
+			owned, err := encounterActorHasAction(tx, access, characters, monster, action)
+			if err != nil {
+				return err
+			}
+			if !owned {
+				return &encounterAccessError{Status: http.StatusForbidden, Message: "у атакующего нет этого действия"}
+			}
+			if action.Mechanics == nil || !hasAttackRollInteraction(*action.Mechanics) {
+				return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "действие не содержит броска атаки"}
+			}
+			invocation.Source = action.Name
+			invocation.Mechanics = *action.Mechanics
+		}
+
+		result, err = interpretMechanics(invocation)
+		if err != nil {
+			var mechanicsErr *mechanicsInterpretError
+			if errors.As(err, &mechanicsErr) {
+				return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "механика атаки неисполнима: " + mechanicsErr.Error()}
+			}
+			return err
+		}
+		patches, log := resolveEncounterAttack(encounterStateAfter(state, markPatches), attacker, invocation.Source, result)
+		patches, log = append(markPatches, patches...), append(markLog, log...)
+		if mastery != nil {
+			facts := encounterMasteryFacts{Weapon: weapon, TargetID: target.ID, TargetSize: characterSizeCategory(stringField(targetCombatant, "size"))}
+			if targetMonster != nil {
+				facts.TargetSize = characterSizeCategory(targetMonster.Size)
+			}
+			branch := ""
+			for _, check := range result.Checks {
+				if check.Resolution == "attack_roll" && check.TargetID == target.ID {
+					branch = "miss"
+					if check.Branch == "hit" || check.Branch == "crit" {
+						branch = "hit"
+					}
+				}
+			}
+			for _, outcome := range result.Outcomes {
+				facts.DealtDamage = facts.DealtDamage || (outcome.Kind == "damage" && outcome.TargetID == target.ID && outcome.Amount > 0)
+			}
+			if compiled := compileEncounterWeaponMastery(*mastery, facts); compiled.Event != "" && compiled.Event == branch {
+				masteryPatches, masteryLog, err := runEncounterWeaponMastery(encounterStateAfter(state, patches), attacker, target, invocation.WeaponMod, compiled, invocation.RNG)
+				if err != nil {
+					var mechanicsErr *mechanicsInterpretError
+					if errors.As(err, &mechanicsErr) {
+						return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "механика искусности неисполнима: " + mechanicsErr.Error()}
+					}
+					return err
+				}
+				patches, log = append(patches, masteryPatches...), append(log, masteryLog...)
+			}
+		}
+		committed, err := commitEncounterOp(tx, &enc, state, ApplyRequest{Patches: patches, Log: log}, characters)
+		if err != nil {
+			return err
+		}
+		newState, newSeq = committed, enc.Seq
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось выполнить атаку")
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), newSeq)
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": newSeq, "state": &newState, "result": result})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEncounterWeaponFromCard(t *testing.T) {
+	profile := JSONMap(mustMechanicsJSON(t, `{"kind":"weapon","weapon_type":"dagger","proficiency_category":"simple","attack_ability":"finesse","default_attack_mode":"melee","damage_lines":[{"dice":"1d4","type":"piercing"},{"dice":"1d6","type":"fire"}],"enchantment":{"attack_bonus":1,"damage_bonus":1}}`))
+	weapon, ok := encounterWeaponFromCard(Card{ID: uuid.New(), Name: "Кинжал", BattleProfile: &profile})
+	if !ok || weapon.Ability != "finesse" || weapon.Ranged || len(weapon.Damage) != 2 || weapon.AttackBonus != 1 || weapon.DamageBonus != 1 {
+		t.Fatalf("unexpected weapon from profile: %+v", weapon)
+	}
+	rogue := newMechanicsActor("rogue", "Плут")
+	rogue.Abilities["dex"], rogue.Abilities["str"] = 16, 10
+	effects := weapon.mechanics(rogue)["effects"].([]interface{})
+	attack := effects[0].(map[string]interface{})
+	onHit := attack["on_hit"].([]interface{})
+	if attack["ability"] != "dex" || onHit[0].(map[string]interface{})["dice"] != "1d4 + dex +1" || onHit[1].(map[string]interface{})["dice"] != "1d6" {
+		t.Fatalf("finesse must pick dex and only the main line gets bonuses: %+v", attack)
+	}
+
+	weaponType, damage, enchant := "weapon", "1d8", 2
+	damageType := "slashing"
+	bonus := BonusDamage
+	legacy, ok := encounterWeaponFromCard(Card{Name: "Меч", Type: &weaponType, BonusType: &bonus, BonusValue: &damage, DamageType: &damageType, EnchantBonus: &enchant})
+	if !ok || legacy.Damage[0].Dice != "1d8" || legacy.AttackBonus != 2 || legacy.DamageBonus != 2 || legacy.Ability != "str" {
+		t.Fatalf("legacy battle stats must be read: %+v", legacy)
+	}
+	if _, ok := encounterWeaponFromCard(Card{Name: "Кольцо"}); ok {
+		t.Fatal("non-weapon card must be rejected")
+	}
+}
+
+func TestCharacterWeaponProficient(t *testing.T) {
+	weapon := encounterWeapon{WeaponType: "longsword", Category: "martial", Ability: "str", Damage: []encounterWeaponDamage{{Dice: "1d8", Type: "slashing"}}}
+	if !characterWeaponProficient(CharacterV3{}, weapon) {
+		t.Fatal("sheets without projected proficiencies stay proficient")
+	}
+	for grants, expected := range map[string]bool{
+		`["simple"]`:                 false,
+		`["martial_weapons"]`:        true,
+		`["Longsword"]`:              true,
+		`["martial_ranged"]`:         false,
+		`["martial_melee","simple"]`: true,
+		`["all weapons"]`:            true,
+	} {
+		state := JSONMap(mustMechanicsJSON(t, `{"proficiencies":{"weapons":`+grants+`}}`))
+		if got := characterWeaponProficient(CharacterV3{RuleState: &state}, weapon); got != expected {
+			t.Fatalf("grants %s: got %v, want %v", grants, got, expected)
+		}
+	}
+
+	actor := newMechanicsActor("fighter", "Воин")
+	target := newMechanicsActor("goblin", "Гоблин")
+	result, err := interpretMechanics(mechanicsInvocation{
+		Actor: actor, Targets: []mechanicsActor{target}, WithoutProficiency: true, RNG: newDiceRNG(7),
+		Mechanics: weapon.mechanics(actor),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, modifier := range result.Checks[0].Roll.Modifiers {
+		if modifier.Source == "БМ" {
+			t.Fatal("unproficient attack must not add the proficiency bonus")
+		}
+	}
+}
+
+func TestResolveEncounterAttack(t *testing.T) {
+	fighter := combatant("fighter", 30)
+	fighter["characterId"] = uuid.NewString()
+	fighter["temp"] = float64(5)
+	goblin := combatant("goblin", 7)
+	state := map[string]interface{}{"combatants": []interface{}{goblin, fighter}}
+
+	roll := EngineRoll{Kind: "damage", Dice: []EngineRollDie{{Sides: 6, Result: 6}}, Advantage: "none", Modifiers: []EngineRollModifier{}, Total: 18, Text: "1d6 = 18"}
+	hit := EngineRoll{Kind: "d20", Dice: []EngineRollDie{{Sides: 20, Result: 15}}, Advantage: "none", Modifiers: []EngineRollModifier{}, Total: 17, Outcome: "hit", Text: "d20 = 17"}
+	rounds := 10
+	result := MechanicsResult{
+		Checks: []MechanicsCheck{{Resolution: "attack_roll", RollerID: "goblin", TargetID: "fighter", Branch: "hit", Roll: hit}},
+		Outcomes: []MechanicsOutcome{
+			{Kind: "damage", TargetID: "fighter", Amount: 9, RawAmount: 18, DamageType: "fire", Adjustment: "resistance", Roll: &roll},
+			{Kind: "condition", Op: "apply", Value: "poisoned", TargetID: "fighter", RoundsLeft: &rounds},
+		},
+	}
+	attacker := newMechanicsActor("goblin", "goblin")
+	patches, log := resolveEncounterAttack(state, attacker, "Скимитар", result)
+	if len(patches) != 1 || patches[0].ActorID != "fighter" {
+		t.Fatalf("only the target must be patched: %+v", patches)
+	}
+	set := patches[0].Set
+	if set["temp"] != 0 || set["hp"] != 26 {
+		t.Fatalf("temp hp must absorb damage first: %+v", set)
+	}
+	effects := set["activeEffects"].([]interface{})
+	if len(effects) != 1 || !validActiveEffectValue(effects[0]) {
+		t.Fatalf("condition must become a valid active effect: %+v", effects)
+	}
+	if !validEncounterPatchValue("activeEffects", jsonCompatible(effects)) {
+		t.Fatal("patched effects must pass the board validator")
+	}
+	if len(log) != 4 || log[0].Type != "" || log[1].Type != "damage" || log[2].Type != "narrative" || log[3].Type != "condition_applied" {
+		t.Fatalf("unexpected journal: %+v", log)
+	}
+	if !strings.Contains(log[0].Message, "попадание") {
+		t.Fatalf("attack outcome must be logged: %q", log[0].Message)
+	}
+	for _, entry := range log[1:] {
+		if err := validateCharacterEvent(entry.Type, entry.Payload); err != nil {
+			t.Fatalf("journal entry %+v rejected: %v", entry, err)
+		}
+	}
+	if saves := openEncounterConcentrationSaves(state, log); len(saves) != 0 {
+		t.Fatalf("no concentration, no save: %+v", saves)
+	}
+
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	if upd, temp, hasTemp := encounterPatchSheetUpdates(state, patches[0]); upd["current_hp"] != 26 || !hasTemp || temp != 0 || upd["active_effects"] == nil {
+		t.Fatalf("server-resolved hit must reach the character sheet: %+v temp=%d/%v", upd, temp, hasTemp)
+	}
+}
+
+// encounterPatchSheetUpdates — то, что syncCombatantsToCharacters запишет в
+// лист персонажа после применения патча.
+func encounterPatchSheetUpdates(state map[string]interface{}, patch CombatantPatch) (map[string]interface{}, int, bool) {
+	fields := map[string]bool{}
+	for field := range patch.Set {
+		fields[field] = true
+	}
+	for _, raw := range state["combatants"].([]interface{}) {
+		if combatant := raw.(map[string]interface{}); combatant["actorId"] == patch.ActorID {
+			return encounterCharacterSheetUpdates(combatant, fields)
+		}
+	}
+	return nil, 0, false
+}
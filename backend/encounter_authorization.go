@@ -313,6 +313,20 @@ func validActiveEffectValue(value interface{}) bool {
 	if rounds, exists := row["roundsLeft"]; exists && rounds != nil && !boundedJSONInteger(rounds, 0, maxEncounterRuntimeValue) {
 		return false
 	}
+	if link, exists := row["concentration"]; exists && link != nil && !validConcentrationLinkValue(link) {
+		return false
+	}
+	return true
+}
+
+func validConcentrationLinkValue(value interface{}) bool {
+	link, ok := value.(map[string]interface{})
+	if !ok || !boundedString(link["casterActorId"], true, 255) || !boundedString(link["spell"], true, 500) {
+		return false
+	}
+	if spellID, exists := link["spellId"]; exists && spellID != nil && !boundedString(spellID, false, 255) {
+		return false
+	}
 	return true
 }
 
@@ -346,6 +360,14 @@ func validPendingSaveValue(value interface{}) bool {
 		!boundedJSONInteger(row["dc"], 0, 1000) || !validSaveOutcome(row["onFail"]) || !validSaveOutcome(row["onSuccess"]) {
 		return false
 	}
+	if link, exists := row["concentration"]; exists && link != nil && !validConcentrationLinkValue(link) {
+		return false
+	}
+	if serverRolled, exists := row["serverRolled"]; exists && serverRolled != nil {
+		if _, ok := serverRolled.(bool); !ok {
+			return false
+		}
+	}
 	if conditions, exists := row["avoidsConditions"]; exists && conditions != nil {
 		items, ok := conditions.([]interface{})
 		if !ok || len(items) > maxEncounterRuntimeRows {
@@ -384,6 +406,30 @@ func validPendingAttackValue(value interface{}) bool {
 	return true
 }
 
+// validManualCreatureStatblock проверяет необязательные ссылку существа на
+// статблок (monsterId) и его поправки урона (damageResistances).
+func validManualCreatureStatblock(added map[string]interface{}) bool {
+	if raw, exists := added["monsterId"]; exists && raw != nil {
+		text, ok := raw.(string)
+		if _, err := uuid.Parse(text); !ok || err != nil {
+			return false
+		}
+	}
+	if raw, exists := added["damageResistances"]; exists && raw != nil {
+		resistances, ok := raw.(map[string]interface{})
+		if !ok || len(resistances) > maxEncounterRuntimeRows {
+			return false
+		}
+		for damageType, raw := range resistances {
+			value, _ := raw.(string)
+			if len(damageType) == 0 || len(damageType) > 100 || !oneOf(value, "resistance", "immune", "immunity", "vulnerability") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func validEncounterRuntimeRows(field string, value interface{}) bool {
 	if value == nil {
 		return false
@@ -453,6 +499,10 @@ func validateEncounterApplyPolicy(
 			return &encounterAccessError{Status: http.StatusForbidden, Message: "изменить участника может мастер боя или контроллер персонажа"}
 		}
 		for field, value := range patch.Set {
+			// Существ заготовки, скрытых до раскрытия, раскрывает мастер боя.
+			if _, isFlag := value.(bool); field == "hidden" && isFlag && caller == enc.OwnerUserID {
+				continue
+			}
 			if _, allowed := encounterInteractionPatchFields[field]; !allowed || !validEncounterPatchValue(field, value) {
 				return &encounterAccessError{Status: http.StatusBadRequest, Message: fmt.Sprintf("поле %q нельзя изменять боевой операцией", field)}
 			}
@@ -478,6 +528,9 @@ func validateEncounterApplyPolicy(
 	if req.ActiveIndex != nil && *req.ActiveIndex < 0 {
 		return &encounterAccessError{Status: http.StatusBadRequest, Message: "индекс хода не может быть отрицательным"}
 	}
+	if len(req.Order) > 0 && caller != enc.OwnerUserID {
+		return &encounterAccessError{Status: http.StatusForbidden, Message: "менять порядок хода может только мастер боя"}
+	}
 
 	knownActorIDs := make(map[string]struct{}, len(actors)+len(req.Add))
 	knownCharacterIDs := make(map[uuid.UUID]struct{})
@@ -504,6 +557,9 @@ func validateEncounterApplyPolicy(
 			if caller != enc.OwnerUserID {
 				return &encounterAccessError{Status: http.StatusForbidden, Message: "добавлять существ может только мастер боя"}
 			}
+			if !validManualCreatureStatblock(added) {
+				return &encounterAccessError{Status: http.StatusBadRequest, Message: "неверный статблок существа"}
+			}
 			continue
 		}
 		characterID, err := uuid.Parse(characterIDText)
@@ -523,6 +579,17 @@ func validateEncounterApplyPolicy(
 		knownCharacterIDs[characterID] = struct{}{}
 	}
 
+	ordered := make(map[string]struct{}, len(req.Order))
+	for _, actorID := range req.Order {
+		if _, known := knownActorIDs[actorID]; !known {
+			return &encounterAccessError{Status: http.StatusBadRequest, Message: "порядок хода ссылается на неизвестного участника"}
+		}
+		if _, duplicate := ordered[actorID]; duplicate {
+			return &encounterAccessError{Status: http.StatusBadRequest, Message: "участник дважды указан в порядке хода"}
+		}
+		ordered[actorID] = struct{}{}
+	}
+
 	for _, entry := range req.Log {
 		if strings.TrimSpace(entry.TargetCharacterID) == "" {
 			continue
@@ -607,7 +674,7 @@ func normalizeEncounterAdds(req ApplyRequest, characters map[uuid.UUID]Character
 		// A manual creature is encounter-owned data. Keep only the declared
 		// combatant schema and never accept character/controller identity fields.
 		combatant := map[string]interface{}{"actorId": strings.TrimSpace(actorID), "isMonster": true}
-		for _, key := range []string{"name", "hp", "maxHp", "ac", "temp", "activeEffects", "pendingSaves", "pendingAttacks", "avatarUrl", "initiative"} {
+		for _, key := range []string{"name", "hp", "maxHp", "ac", "temp", "activeEffects", "pendingSaves", "pendingAttacks", "avatarUrl", "initiative", "monsterId", "damageResistances"} {
 			if value, exists := added[key]; exists {
 				combatant[key] = value
 			}
@@ -239,13 +239,29 @@ func TestEncounterRoutesRequireStrictJWTIncludingStream(t *testing.T) {
 	for _, route := range []struct{ method, path string }{
 		{"POST", "/encounters"},
 		{"GET", "/encounters"},
+		{"POST", "/encounters/difficulty"},
+		{"POST", "/encounters/generate"},
 		{"GET", "/encounters/:id"},
 		{"DELETE", "/encounters/:id"},
 		{"GET", "/encounters/:id/events"},
+		{"GET", "/encounters/:id/statblocks"},
 		{"POST", "/encounters/:id/invite"},
 		{"POST", "/encounters/:id/join"},
 		{"POST", "/encounters/:id/apply"},
+		{"POST", "/encounters/:id/concentration-save"},
+		{"POST", "/encounters/:id/attack"},
+		{"POST", "/encounters/:id/initiative"},
+		{"POST", "/encounters/:id/monster-turn"},
+		{"POST", "/encounters/:id/saves"},
+		{"POST", "/encounters/:id/saves/resolve"},
 		{"GET", "/encounters/:id/stream"},
+		{"POST", "/encounters/:id/conclude"},
+		{"GET", "/encounter-templates"},
+		{"POST", "/encounter-templates"},
+		{"GET", "/encounter-templates/:id"},
+		{"PUT", "/encounter-templates/:id"},
+		{"DELETE", "/encounter-templates/:id"},
+		{"POST", "/encounter-templates/:id/spawn"},
 	} {
 		pattern := regexp.MustCompile(`api\.` + route.method + `\("` + regexp.QuoteMeta(route.path) + `",\s*encounterAuth,`)
 		if !pattern.MatchString(text) {
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Концентрация в онлайн-бою (PHB 2024): заклинатель держит одно концентрируемое
+// заклинание; каст нового прерывает прежнее, урон открывает спасбросок ТЕЛ
+// СЛ max(10, урон/2) (не выше 30), провал снимает все эффекты заклинания со всех участников.
+// Персонажу спасбросок открывается, монстру сервер бросает его сразу.
+// Связь эффекта с концентрацией — поле concentration строки активного эффекта;
+// чип клиента (mechanics.kind:"concentration") на самом заклинателе — тоже связь.
+
+const maxEncounterConcentrationSaveBodyBytes = 4 << 10
+
+// encounterConcentrationLink читает связь эффекта с концентрацией. holder —
+// actorId участника, на котором висит эффект.
+func encounterConcentrationLink(effect map[string]interface{}, holder string) (ActiveEffectConcentration, bool) {
+	if link, ok := effect["concentration"].(map[string]interface{}); ok {
+		caster := strings.TrimSpace(stringField(link, "casterActorId"))
+		spell := strings.TrimSpace(stringField(link, "spell"))
+		if caster != "" && spell != "" {
+			return ActiveEffectConcentration{CasterActorID: caster, Spell: spell, SpellID: stringField(link, "spellId")}, true
+		}
+	}
+	if mechanics, ok := effect["mechanics"].(map[string]interface{}); ok && mechanics["kind"] == "concentration" {
+		spell := strings.TrimSpace(stringField(mechanics, "spell"))
+		if spell != "" && holder != "" {
+			return ActiveEffectConcentration{CasterActorID: holder, Spell: spell}, true
+		}
+	}
+	return ActiveEffectConcentration{}, false
+}
+
+func encounterCombatantEffects(combatant map[string]interface{}) []map[string]interface{} {
+	raw, _ := combatant["activeEffects"].([]interface{})
+	effects := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if effect, ok := item.(map[string]interface{}); ok {
+			effects = append(effects, effect)
+		}
+	}
+	return effects
+}
+
+// encounterConcentrations — на каких заклинаниях концентрируется каждый
+// заклинатель боя: casterActorId → spell → связь.
+func encounterConcentrations(state map[string]interface{}) map[string]map[string]ActiveEffectConcentration {
+	out := map[string]map[string]ActiveEffectConcentration{}
+	raw, _ := state["combatants"].([]interface{})
+	for _, item := range raw {
+		combatant, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		holder, _ := combatant["actorId"].(string)
+		for _, effect := range encounterCombatantEffects(combatant) {
+			link, ok := encounterConcentrationLink(effect, holder)
+			if !ok {
+				continue
+			}
+			if out[link.CasterActorID] == nil {
+				out[link.CasterActorID] = map[string]ActiveEffectConcentration{}
+			}
+			if known, exists := out[link.CasterActorID][link.Spell]; !exists || known.SpellID == "" {
+				out[link.CasterActorID][link.Spell] = link
+			}
+		}
+	}
+	return out
+}
+
+// supersedeEncounterConcentration — новое концентрируемое заклинание вытесняет
+// прежнее: для каждого заклинателя, у которого после op появилось заклинание,
+// которого не было в previous, снимаются эффекты всех остальных его заклинаний.
+// Возвращает патчи, записи журнала и появившиеся связи (их заклинания сверяются
+// с каталогом). Два новых заклинания одного заклинателя в одном op — ошибка.
+func supersedeEncounterConcentration(state map[string]interface{}, previous map[string]map[string]ActiveEffectConcentration) ([]CombatantPatch, []BattleLogEntry, []ActiveEffectConcentration, *encounterAccessError) {
+	current := encounterConcentrations(state)
+	casters := make([]string, 0, len(current))
+	for caster := range current {
+		casters = append(casters, caster)
+	}
+	sort.Strings(casters)
+
+	var fresh []ActiveEffectConcentration
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	for _, caster := range casters {
+		var cast []ActiveEffectConcentration
+		for spell, link := range current[caster] {
+			if _, known := previous[caster][spell]; !known {
+				cast = append(cast, link)
+			}
+		}
+		if len(cast) == 0 {
+			continue
+		}
+		if len(cast) > 1 {
+			return nil, nil, nil, &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "заклинатель не может концентрироваться на двух заклинаниях сразу"}
+		}
+		fresh = append(fresh, cast[0])
+		stale := map[string]bool{}
+		for spell := range current[caster] {
+			if spell != cast[0].Spell {
+				stale[spell] = true
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		removed, ended := removeEncounterConcentration(state, caster, stale,
+			fmt.Sprintf("Концентрация прервана: «%s» вытесняет прежнее заклинание", cast[0].Spell))
+		state = applyOps(state, ApplyRequest{Patches: removed})
+		patches = append(patches, removed...)
+		log = append(log, ended...)
+	}
+	return patches, log, fresh, nil
+}
+
+// removeEncounterConcentration снимает со всех участников эффекты заклинаний
+// spells заклинателя caster и открытые по ним спасброски концентрации. Состояние
+// не мутируется; reason уходит в журнал боя и журнал заклинателя.
+func removeEncounterConcentration(state map[string]interface{}, caster string, spells map[string]bool, reason string) ([]CombatantPatch, []BattleLogEntry) {
+	raw, _ := state["combatants"].([]interface{})
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	for _, item := range raw {
+		combatant, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		holder, _ := combatant["actorId"].(string)
+		characterID, _ := combatant["characterId"].(string)
+		set := JSONMap{}
+
+		if effects, ok := combatant["activeEffects"].([]interface{}); ok {
+			kept := make([]interface{}, 0, len(effects))
+			for _, rawEffect := range effects {
+				effect, ok := rawEffect.(map[string]interface{})
+				if ok {
+					if link, linked := encounterConcentrationLink(effect, holder); linked && link.CasterActorID == caster && spells[link.Spell] {
+						name := stringField(effect, "name")
+						log = append(log, BattleLogEntry{
+							Message:           fmt.Sprintf("Эффект «%s» закончился: %s", name, stringFieldOr(combatant, "name", holder)),
+							TargetCharacterID: characterID,
+							Type:              "effect_expired",
+							Payload:           JSONMap{"type": "effect_expired", "name": name},
+						})
+						continue
+					}
+				}
+				kept = append(kept, rawEffect)
+			}
+			if len(kept) != len(effects) {
+				set["activeEffects"] = kept
+			}
+		}
+		if saves, ok := combatant["pendingSaves"].([]interface{}); ok {
+			kept := make([]interface{}, 0, len(saves))
+			for _, rawSave := range saves {
+				if save, ok := rawSave.(map[string]interface{}); ok {
+					if link, linked := encounterConcentrationLink(save, ""); linked && link.CasterActorID == caster && spells[link.Spell] {
+						continue
+					}
+				}
+				kept = append(kept, rawSave)
+			}
+			if len(kept) != len(saves) {
+				set["pendingSaves"] = kept
+			}
+		}
+		if len(set) > 0 {
+			patches = append(patches, CombatantPatch{ActorID: holder, Set: set})
+		}
+		if holder == caster {
+			log = append(log, BattleLogEntry{
+				Message:           fmt.Sprintf("%s: %s", stringFieldOr(combatant, "name", holder), reason),
+				TargetCharacterID: characterID,
+				Type:              "narrative",
+				Payload:           JSONMap{"type": "narrative", "text": reason},
+			})
+		}
+	}
+	return patches, log
+}
+
+// validateEncounterConcentrationSpells сверяет новые связи с каталогом: связь со
+// spellId допустима только для заклинания с концентрацией.
+func validateEncounterConcentrationSpells(tx *gorm.DB, links []ActiveEffectConcentration) error {
+	ids := make([]uuid.UUID, 0, len(links))
+	for _, link := range links {
+		if link.SpellID == "" {
+			continue
+		}
+		id, err := uuid.Parse(link.SpellID)
+		if err != nil {
+			return &encounterAccessError{Status: http.StatusBadRequest, Message: "неверный spellId в связи концентрации"}
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var spells []Spell
+	if err := tx.Where("id IN ?", ids).Find(&spells).Error; err != nil {
+		return err
+	}
+	concentration := make(map[uuid.UUID]bool, len(spells))
+	for _, spell := range spells {
+		concentration[spell.ID] = spell.Concentration
+	}
+	for _, id := range ids {
+		if !concentration[id] {
+			return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "заклинание не требует концентрации или не найдено"}
+		}
+	}
+	return nil
+}
+
+// concentrationSaveDC — СЛ спасброска концентрации от урона: max(10, урон/2), но не
+// выше 30 — потолок из правила Concentration PHB 2024 («up to a maximum DC of 30»);
+// клиентский concentrationDC ограничивает СЛ так же.
+func concentrationSaveDC(damage int) int {
+	return min(30, max(10, damage/2))
+}
+
+// newEncounterConcentrationSave — открытый спасбросок концентрации на spell
+// участника actorID после damage урона от source.
+func newEncounterConcentrationSave(actorID, spell, source string, damage int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         "concentration-" + uuid.NewString(),
+		"sourceName": source,
+		"actionName": "Концентрация: " + spell,
+		"ability":    "con",
+		"dc":         concentrationSaveDC(damage),
+		"onFail":     map[string]interface{}{"hpDelta": 0, "tempDelta": 0},
+		"onSuccess":  map[string]interface{}{"hpDelta": 0, "tempDelta": 0},
+		"concentration": map[string]interface{}{
+			"casterActorId": actorID,
+			"spell":         spell,
+		},
+	}
+}
+
+func sortedConcentrationSpells(spells map[string]ActiveEffectConcentration) []string {
+	out := make([]string, 0, len(spells))
+	for spell := range spells {
+		out = append(out, spell)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// openEncounterConcentrationSaves открывает спасбросок концентрации на каждую
+// запись журнала damage, адресованную концентрирующемуся персонажу.
+func openEncounterConcentrationSaves(state map[string]interface{}, log []BattleLogEntry) []CombatantPatch {
+	concentrations := encounterConcentrations(state)
+	combatants, _ := state["combatants"].([]interface{})
+	byCharacter := map[string]map[string]interface{}{}
+	for _, item := range combatants {
+		if combatant, ok := item.(map[string]interface{}); ok {
+			if characterID, ok := combatant["characterId"].(string); ok && characterID != "" {
+				byCharacter[characterID] = combatant
+			}
+		}
+	}
+
+	opened := map[string][]interface{}{}
+	var order []string
+	for _, entry := range log {
+		if entry.Type != "damage" || entry.TargetCharacterID == "" || entry.Payload == nil {
+			continue
+		}
+		amount, ok := mechanicsNumber(entry.Payload["amount"])
+		combatant := byCharacter[entry.TargetCharacterID]
+		if !ok || amount <= 0 || combatant == nil {
+			continue
+		}
+		actorID, _ := combatant["actorId"].(string)
+		for _, spell := range sortedConcentrationSpells(concentrations[actorID]) {
+			if _, seen := opened[actorID]; !seen {
+				order = append(order, actorID)
+			}
+			source := stringFieldOr(entry.Payload, "source", "Урон")
+			opened[actorID] = append(opened[actorID], newEncounterConcentrationSave(actorID, spell, source, int(amount)))
+		}
+	}
+
+	patches := make([]CombatantPatch, 0, len(order))
+	for _, actorID := range order {
+		for _, item := range combatants {
+			combatant, ok := item.(map[string]interface{})
+			if !ok || combatant["actorId"] != actorID {
+				continue
+			}
+			existing, _ := combatant["pendingSaves"].([]interface{})
+			saves := append(append([]interface{}{}, existing...), opened[actorID]...)
+			patches = append(patches, CombatantPatch{ActorID: actorID, Set: JSONMap{"pendingSaves": saves}})
+		}
+	}
+	return patches
+}
+
+// encounterMonsterHitPoints — hp+temp участников без персонажа. Урон монстрам не
+// журналируется записями damage, поэтому его видно только по убыли хитов за op.
+func encounterMonsterHitPoints(state map[string]interface{}) map[string]int {
+	out := map[string]int{}
+	combatants, _ := state["combatants"].([]interface{})
+	for _, item := range combatants {
+		combatant, ok := item.(map[string]interface{})
+		if !ok || stringField(combatant, "characterId") != "" {
+			continue
+		}
+		hp, _ := encounterStateInt(combatant["hp"])
+		temp, _ := encounterStateInt(combatant["temp"])
+		if actorID := stringField(combatant, "actorId"); actorID != "" {
+			out[actorID] = hp + temp
+		}
+	}
+	return out
+}
+
+// encounterMonsterConcentrationSave — спасбросок концентрации монстра, которому
+// op нанёс урон.
+type encounterMonsterConcentrationSave struct {
+	ActorID string
+	Save    map[string]interface{}
+}
+
+// monsterConcentrationSaves — спасброски концентрирующихся монстров, чьи хиты
+// убыли относительно previous (encounterMonsterHitPoints до op).
+func monsterConcentrationSaves(state map[string]interface{}, previous map[string]int) []encounterMonsterConcentrationSave {
+	concentrations := encounterConcentrations(state)
+	current := encounterMonsterHitPoints(state)
+	combatants, _ := state["combatants"].([]interface{})
+	var out []encounterMonsterConcentrationSave
+	for _, item := range combatants {
+		combatant, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		actorID := stringField(combatant, "actorId")
+		before, known := previous[actorID]
+		after, monster := current[actorID]
+		if !known || !monster || after >= before || len(concentrations[actorID]) == 0 {
+			continue
+		}
+		for _, spell := range sortedConcentrationSpells(concentrations[actorID]) {
+			out = append(out, encounterMonsterConcentrationSave{
+				ActorID: actorID,
+				Save:    newEncounterConcentrationSave(actorID, spell, "Урон", before-after),
+			})
+		}
+	}
+	return out
+}
+
+// resolveEncounterMonsterConcentration сразу бросает спасброски концентрации
+// монстров со спасброском ТЕЛ их статблока: отвечать на них некому, кроме
+// мастера, а мастер и так управляет монстром. Без статблока — чистый d20.
+func resolveEncounterMonsterConcentration(tx *gorm.DB, state map[string]interface{}, previous map[string]int, characters map[uuid.UUID]CharacterV3) ([]CombatantPatch, []BattleLogEntry, error) {
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	for _, pending := range monsterConcentrationSaves(state, previous) {
+		combatant := encounterCombatantByID(state, pending.ActorID)
+		roller, _, err := encounterCombatantActor(tx, combatant, characters)
+		var accessErr *encounterAccessError
+		if errors.As(err, &accessErr) {
+			roller = newMechanicsActor(pending.ActorID, stringFieldOr(combatant, "name", pending.ActorID))
+			roller.IsMonster = true
+		} else if err != nil {
+			return nil, nil, err
+		}
+		dc, _ := mechanicsNumber(pending.Save["dc"])
+		roll := rollActorSave(newDiceRNG(0), roller, "con", int(dc))
+		resolved, entries := resolveEncounterConcentrationSave(state, pending.ActorID, pending.Save, roll)
+		state = applyOps(state, ApplyRequest{Patches: resolved})
+		patches = append(patches, resolved...)
+		log = append(log, entries...)
+	}
+	return patches, log, nil
+}
+
+// resolveEncounterConcentrationSave разрешает спасбросок концентрации броском roll:
+// снимает сам спасбросок, если он был открыт, а при провале — все эффекты заклинания.
+func resolveEncounterConcentrationSave(state map[string]interface{}, actorID string, save map[string]interface{}, roll EngineRoll) ([]CombatantPatch, []BattleLogEntry) {
+	link, _ := encounterConcentrationLink(save, "")
+	saveID := stringField(save, "id")
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	combatants, _ := state["combatants"].([]interface{})
+	for _, item := range combatants {
+		combatant, ok := item.(map[string]interface{})
+		if !ok || combatant["actorId"] != actorID {
+			continue
+		}
+		existing, _ := combatant["pendingSaves"].([]interface{})
+		kept := make([]interface{}, 0, len(existing))
+		for _, raw := range existing {
+			if row, ok := raw.(map[string]interface{}); ok && stringField(row, "id") == saveID {
+				continue
+			}
+			kept = append(kept, raw)
+		}
+		if len(kept) != len(existing) {
+			patches = append(patches, CombatantPatch{ActorID: actorID, Set: JSONMap{"pendingSaves": kept}})
+		}
+		outcome := "провал"
+		if roll.Outcome == "success" {
+			outcome = "успех"
+		}
+		label := fmt.Sprintf("Спасбросок концентрации (%s) — %s", link.Spell, outcome)
+		characterID, _ := combatant["characterId"].(string)
+		log = append(log, BattleLogEntry{
+			Message:           fmt.Sprintf("%s: %s, %s", stringFieldOr(combatant, "name", actorID), label, roll.Text),
+			TargetCharacterID: characterID,
+			Type:              "roll",
+			Payload:           JSONMap{"type": "roll", "label": label, "roll": map[string]interface{}(roll.toJSONMap())},
+		})
+	}
+	if roll.Outcome == "success" || link.Spell == "" {
+		return patches, log
+	}
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	removed, ended := removeEncounterConcentration(state, link.CasterActorID, map[string]bool{link.Spell: true},
+		fmt.Sprintf("Концентрация на «%s» потеряна (провал спасброска)", link.Spell))
+	return append(patches, removed...), append(log, ended...)
+}
+
+// ResolveConcentrationSaveRequest — разрешить открытый спасбросок концентрации
+// участника. Бросает сервер, клиент только указывает, какой спасбросок.
+type ResolveConcentrationSaveRequest struct {
+	ExpectedSeq *int64 `json:"expected_seq"`
+	ActorID     string `json:"actor_id" binding:"required"`
+	SaveID      string `json:"save_id" binding:"required"`
+}
+
+// ResolveConcentrationSave — POST /api/encounters/:id/concentration-save. Спасбросок
+// разрешает мастер боя или контроллер персонажа; бросок ТЕЛ идёт с модификатором и
+// владением спасброском персонажа, исход уходит подписчикам обычной операцией боя.
+func (ec *EncounterController) ResolveConcentrationSave(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req ResolveConcentrationSaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if req.ExpectedSeq == nil || *req.ExpectedSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	var newState JSONMap
+	var newSeq int64
+	var roll EngineRoll
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, true)
+		if err != nil {
+			return err
+		}
+		actors, accessErr := actorAccessFromCombatants(combatants, characters)
+		if accessErr != nil {
+			return accessErr
+		}
+		actor, exists := actors[req.ActorID]
+		if !exists || !actor.IsCharacter {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "персонаж-участник не найден"}
+		}
+		if caller != enc.OwnerUserID && actor.ControllerUserID != caller {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "спасбросок разрешает мастер боя или контроллер персонажа"}
+		}
+
+		var save map[string]interface{}
+		for _, combatant := range combatants {
+			if combatant["actorId"] != req.ActorID {
+				continue
+			}
+			saves, _ := combatant["pendingSaves"].([]interface{})
+			for _, raw := range saves {
+				row, ok := raw.(map[string]interface{})
+				if _, linked := encounterConcentrationLink(row, ""); ok && linked && stringField(row, "id") == req.SaveID {
+					save = row
+				}
+			}
+		}
+		if save == nil {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "спасбросок концентрации не найден"}
+		}
+		dc, ok := mechanicsNumber(save["dc"])
+		if !ok {
+			return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "у спасброска концентрации нет СЛ"}
+		}
+
+		roller, err := characterFormulaActor(tx, characters[actor.CharacterID])
+		if err != nil {
+			return err
+		}
+		roll = rollActorSave(newDiceRNG(0), roller, "con", int(dc))
+		patches, log := resolveEncounterConcentrationSave(state, req.ActorID, save, roll)
+		committed, err := commitEncounterOp(tx, &enc, state, ApplyRequest{Patches: patches, Log: log}, characters)
+		if err != nil {
+			return err
+		}
+		newState, newSeq = committed, enc.Seq
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось разрешить спасбросок")
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), newSeq)
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": newSeq, "state": &newState, "roll": roll, "maintained": roll.Outcome == "success"})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"testing"
+)
+
+func concentrationEffect(id, name, caster, spell string) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "name": name,
+		"concentration": map[string]interface{}{"casterActorId": caster, "spell": spell},
+	}
+}
+
+func concentrationTestState() map[string]interface{} {
+	wizard := combatant("wizard", 20)
+	wizard["characterId"] = "c1"
+	wizard["activeEffects"] = []interface{}{
+		map[string]interface{}{"id": "chip", "name": "Концентрация: Благословение", "mechanics": map[string]interface{}{"kind": "concentration", "spell": "Благословение"}},
+		concentrationEffect("b1", "Благословение", "wizard", "Благословение"),
+	}
+	fighter := combatant("fighter", 30)
+	fighter["characterId"] = "c2"
+	fighter["activeEffects"] = []interface{}{
+		concentrationEffect("b2", "Благословение", "wizard", "Благословение"),
+		map[string]interface{}{"id": "x", "name": "Ярость"},
+	}
+	return map[string]interface{}{"combatants": []interface{}{wizard, fighter}}
+}
+
+func TestEncounterConcentrationSupersedesPreviousSpell(t *testing.T) {
+	state := concentrationTestState()
+	previous := encounterConcentrations(state)
+	if _, ok := previous["wizard"]["Благословение"]; !ok || len(previous) != 1 {
+		t.Fatalf("chip and links must resolve to the caster: %+v", previous)
+	}
+
+	haste := concentrationEffect("h1", "Ускорение", "wizard", "Ускорение")
+	state = applyOps(state, ApplyRequest{Patches: []CombatantPatch{{ActorID: "fighter", Set: JSONMap{"activeEffects": append(
+		append([]interface{}{}, combatantsOf(state)[1]["activeEffects"].([]interface{})...), haste)}}}})
+	patches, log, fresh, err := supersedeEncounterConcentration(state, previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fresh) != 1 || fresh[0].Spell != "Ускорение" {
+		t.Fatalf("new cast must be reported, got %+v", fresh)
+	}
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	wizardEffects := combatantsOf(state)[0]["activeEffects"].([]interface{})
+	fighterEffects := combatantsOf(state)[1]["activeEffects"].([]interface{})
+	if len(wizardEffects) != 0 || len(fighterEffects) != 2 {
+		t.Fatalf("old spell must end on every combatant: %+v / %+v", wizardEffects, fighterEffects)
+	}
+	if len(log) != 4 || log[2].TargetCharacterID != "c1" || log[2].Type != "narrative" {
+		t.Fatalf("unexpected journal: %+v", log)
+	}
+	for _, entry := range log {
+		if err := validateCharacterEvent(entry.Type, entry.Payload); err != nil {
+			t.Fatalf("journal entry %+v rejected: %v", entry, err)
+		}
+	}
+
+	twice := concentrationTestState()
+	twice = applyOps(twice, ApplyRequest{Patches: []CombatantPatch{{ActorID: "fighter", Set: JSONMap{"activeEffects": []interface{}{
+		concentrationEffect("h1", "Ускорение", "wizard", "Ускорение"),
+		concentrationEffect("f1", "Полёт", "wizard", "Полёт"),
+	}}}}})
+	if _, _, _, err := supersedeEncounterConcentration(twice, previous); err == nil {
+		t.Fatal("two new concentration spells in one op must be rejected")
+	}
+}
+
+func TestEncounterConcentrationSaveOnDamage(t *testing.T) {
+	state := concentrationTestState()
+	patches := openEncounterConcentrationSaves(state, []BattleLogEntry{
+		{TargetCharacterID: "c1", Type: "damage", Payload: JSONMap{"type": "damage", "amount": float64(24), "damageType": "fire", "source": "Огр"}},
+		{TargetCharacterID: "c2", Type: "damage", Payload: JSONMap{"type": "damage", "amount": float64(30), "damageType": "fire"}},
+		{Message: "без адресата"},
+	})
+	if len(patches) != 1 || patches[0].ActorID != "wizard" {
+		t.Fatalf("only the concentrating character gets a save: %+v", patches)
+	}
+	saves := patches[0].Set["pendingSaves"].([]interface{})
+	save := saves[0].(map[string]interface{})
+	if len(saves) != 1 || save["dc"] != 12 || save["ability"] != "con" || save["sourceName"] != "Огр" {
+		t.Fatalf("unexpected pending save: %+v", save)
+	}
+	if !validPendingSaveValue(save) {
+		t.Fatal("server pending save must pass the board validator")
+	}
+	if concentrationSaveDC(4) != 10 || concentrationSaveDC(50) != 25 || concentrationSaveDC(90) != 30 {
+		t.Fatal("DC must be max(10, half damage) up to the 2024 maximum of 30")
+	}
+
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	failed := EngineRoll{Kind: "save", Dice: []EngineRollDie{{Sides: 20, Result: 3}}, Advantage: "none", Modifiers: []EngineRollModifier{}, Total: 3, Outcome: "fail"}
+	resolved, log := resolveEncounterConcentrationSave(state, "wizard", save, failed)
+	state = applyOps(state, ApplyRequest{Patches: resolved})
+	wizard, fighter := combatantsOf(state)[0], combatantsOf(state)[1]
+	if len(wizard["pendingSaves"].([]interface{})) != 0 || len(wizard["activeEffects"].([]interface{})) != 0 {
+		t.Fatalf("failed save must close the save and end concentration: %+v", wizard)
+	}
+	if effects := fighter["activeEffects"].([]interface{}); len(effects) != 1 {
+		t.Fatalf("linked effects on allies must end too: %+v", effects)
+	}
+	if log[0].Type != "roll" || log[0].TargetCharacterID != "c1" {
+		t.Fatalf("save roll must be journaled first: %+v", log)
+	}
+
+	roll := rollActorSave(newDiceRNG(5), newMechanicsActor("wizard", "Маг"), "con", 12)
+	_, log = resolveEncounterConcentrationSave(concentrationTestState(), "wizard", save, roll)
+	if err := validateCharacterEvent(log[0].Type, log[0].Payload); err != nil {
+		t.Fatalf("save roll journal entry rejected: %v", err)
+	}
+
+	state = concentrationTestState()
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	passed := failed
+	passed.Outcome = "success"
+	resolved, _ = resolveEncounterConcentrationSave(state, "wizard", save, passed)
+	if len(resolved) != 1 {
+		t.Fatalf("successful save only closes the save: %+v", resolved)
+	}
+}
+
+func TestEncounterMonsterConcentrationSaveOnHitPointLoss(t *testing.T) {
+	state := concentrationTestState()
+	mage := combatant("mage", 15)
+	mage["hp"], mage["temp"] = float64(40), float64(0)
+	mage["activeEffects"] = []interface{}{concentrationEffect("m1", "Паутина", "mage", "Паутина")}
+	state["combatants"] = append(state["combatants"].([]interface{}), mage)
+	fighter := combatantsOf(state)[1]
+	fighter["activeEffects"] = append(fighter["activeEffects"].([]interface{}), concentrationEffect("w1", "Опутан", "mage", "Паутина"))
+
+	previous := encounterMonsterHitPoints(state)
+	if _, character := previous["wizard"]; character || previous["mage"] != 40 {
+		t.Fatalf("only monsters are tracked by hit points: %+v", previous)
+	}
+	state = applyOps(state, ApplyRequest{Patches: []CombatantPatch{{ActorID: "mage", Set: JSONMap{"hp": float64(16)}}}})
+	saves := monsterConcentrationSaves(state, previous)
+	if len(saves) != 1 || saves[0].ActorID != "mage" || saves[0].Save["dc"] != 12 {
+		t.Fatalf("24 damage opens a DC 12 save for the concentrating monster: %+v", saves)
+	}
+	if healed := monsterConcentrationSaves(state, encounterMonsterHitPoints(state)); len(healed) != 0 {
+		t.Fatalf("no hit point loss, no save: %+v", healed)
+	}
+
+	failed := EngineRoll{Kind: "save", Dice: []EngineRollDie{{Sides: 20, Result: 2}}, Advantage: "none", Modifiers: []EngineRollModifier{}, Total: 2, Outcome: "fail"}
+	resolved, log := resolveEncounterConcentrationSave(state, "mage", saves[0].Save, failed)
+	state = applyOps(state, ApplyRequest{Patches: resolved})
+	if effects := combatantsOf(state)[1]["activeEffects"].([]interface{}); len(effects) != 2 {
+		t.Fatalf("the monster's failed save ends its spell on its targets: %+v", effects)
+	}
+	if _, pending := combatantsOf(state)[2]["pendingSaves"]; pending || log[0].Type != "roll" || log[0].TargetCharacterID != "" {
+		t.Fatalf("a monster save is rolled at once, never left pending: %+v / %+v", combatantsOf(state)[2], log)
+	}
+
+	patches, rolled, err := resolveEncounterMonsterConcentration(nil, concentrationTestState(), previous, nil)
+	if err != nil || len(patches) != 0 || len(rolled) != 0 {
+		t.Fatalf("no concentrating monster, nothing to roll: %+v %+v %v", patches, rolled, err)
+	}
+}
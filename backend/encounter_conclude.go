@@ -0,0 +1,478 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Завершение боя мастером: опыт за побеждённых существ делится поровну между
+// персонажами боя, добыча по желанию подбирается из каталога карточек по
+// ступени опасности, а выданные мастером предметы попадают в инвентарь.
+// Каждая награда пишется в журнал персонажа (xp_gained, item_added), бой
+// помечается завершённым и больше не принимает операций.
+
+const (
+	maxEncounterConcludeBodyBytes = 16 << 10
+	maxEncounterItemAwardQty      = 999
+)
+
+// encounterTreasureRules — число предметов каждой редкости по ступени
+// опасности (ПО 0–4, 5–10, 11–16, 17+), в духе таблиц добычи DMG.
+var encounterTreasureRules = [4]map[Rarity]string{
+	{RarityCommon: "1d3", RarityUncommon: "1d2-1"},
+	{RarityCommon: "1d2", RarityUncommon: "1d3", RarityRare: "1d2-1"},
+	{RarityUncommon: "1d2", RarityRare: "1d3", RarityVeryRare: "1d2-1"},
+	{RarityRare: "1d2", RarityVeryRare: "1d3", RarityArtifact: "1d2-1"},
+}
+
+var encounterTreasureRarities = []Rarity{RarityCommon, RarityUncommon, RarityRare, RarityVeryRare, RarityArtifact}
+
+// EncounterItemAward — предмет каталога, который мастер выдаёт персонажу.
+type EncounterItemAward struct {
+	CharacterID uuid.UUID `json:"character_id" binding:"required"`
+	CardID      uuid.UUID `json:"card_id" binding:"required"`
+	Qty         int       `json:"qty" binding:"omitempty,min=1,max=999"`
+	Name        string    `json:"name,omitempty"`
+}
+
+// EncounterConcludeRequest — завершение боя. Preview только считает опыт и
+// подбирает добычу, ничего не записывая: мастер смотрит итог и повторяет
+// запрос с тем же seed и распределёнными awards. DefeatedActorIDs заменяет
+// правило «побеждён — хиты на нуле»; CharacterIDs сужает круг получателей опыта.
+type EncounterConcludeRequest struct {
+	ExpectedSeq      *int64               `json:"expected_seq"`
+	Preview          bool                 `json:"preview"`
+	DefeatedActorIDs []string             `json:"defeated_actor_ids" binding:"max=100"`
+	CharacterIDs     []uuid.UUID          `json:"character_ids" binding:"max=20"`
+	Treasure         bool                 `json:"treasure"`
+	Seed             *int64               `json:"seed"`
+	Awards           []EncounterItemAward `json:"awards" binding:"max=100,dive"`
+}
+
+// EncounterDefeatedMonster — побеждённое существо и опыт за него.
+type EncounterDefeatedMonster struct {
+	ActorID         string `json:"actor_id"`
+	Name            string `json:"name"`
+	ChallengeRating string `json:"challenge_rating"`
+	XP              int    `json:"xp"`
+}
+
+// EncounterXPAward — доля опыта персонажа; Total — его опыт после награды.
+type EncounterXPAward struct {
+	CharacterID uuid.UUID `json:"character_id"`
+	Name        string    `json:"name"`
+	XP          int       `json:"xp"`
+	Total       int       `json:"total"`
+}
+
+// EncounterTreasureItem — предмет подобранной добычи.
+type EncounterTreasureItem struct {
+	CardID uuid.UUID `json:"card_id"`
+	Name   string    `json:"name"`
+	Rarity Rarity    `json:"rarity"`
+}
+
+// EncounterConclusion — итог боя; сохраняется в Encounter.Conclusion.
+type EncounterConclusion struct {
+	Defeated   []EncounterDefeatedMonster `json:"defeated"`
+	TotalXP    int                        `json:"total_xp"`
+	XPAwards   []EncounterXPAward         `json:"xp_awards"`
+	Seed       int64                      `json:"seed,omitempty"`
+	Treasure   []EncounterTreasureItem    `json:"treasure"`
+	ItemAwards []EncounterItemAward       `json:"item_awards"`
+}
+
+// encounterDefeatedMonsters — побеждённые существа боя: названные мастером
+// или все не-персонажи с нулём хитов. Опыт — по ПО статблока; существа без
+// статблока опыта не дают.
+func encounterDefeatedMonsters(combatants []map[string]interface{}, ratings map[string]string, named []string) ([]EncounterDefeatedMonster, *encounterAccessError) {
+	byID := make(map[string]map[string]interface{}, len(combatants))
+	for _, combatant := range combatants {
+		byID[stringField(combatant, "actorId")] = combatant
+	}
+	var picked []map[string]interface{}
+	if len(named) > 0 {
+		seen := map[string]bool{}
+		for _, actorID := range named {
+			combatant, ok := byID[actorID]
+			if !ok {
+				return nil, &encounterAccessError{Status: http.StatusNotFound, Message: "участник боя не найден"}
+			}
+			if stringField(combatant, "characterId") != "" {
+				return nil, &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "персонаж не может быть побеждённым существом"}
+			}
+			if !seen[actorID] {
+				seen[actorID] = true
+				picked = append(picked, combatant)
+			}
+		}
+	} else {
+		for _, combatant := range combatants {
+			if stringField(combatant, "characterId") != "" {
+				continue
+			}
+			if hp, ok := mechanicsNumber(combatant["hp"]); ok && hp <= 0 {
+				picked = append(picked, combatant)
+			}
+		}
+	}
+	defeated := make([]EncounterDefeatedMonster, 0, len(picked))
+	for _, combatant := range picked {
+		rating := ratings[stringField(combatant, "monsterId")]
+		key, _ := challengeRatingKey(rating)
+		defeated = append(defeated, EncounterDefeatedMonster{
+			ActorID:         stringField(combatant, "actorId"),
+			Name:            stringFieldOr(combatant, "name", stringField(combatant, "actorId")),
+			ChallengeRating: rating,
+			XP:              challengeRatingXP[key],
+		})
+	}
+	return defeated, nil
+}
+
+// splitEncounterXP делит опыт поровну; остаток от деления теряется, как в
+// правилах. Total — опыт персонажа после награды.
+func splitEncounterXP(total int, recipients []CharacterV3) []EncounterXPAward {
+	awards := make([]EncounterXPAward, 0, len(recipients))
+	if len(recipients) == 0 {
+		return awards
+	}
+	share := total / len(recipients)
+	for _, character := range recipients {
+		awards = append(awards, EncounterXPAward{
+			CharacterID: character.ID, Name: character.Name, XP: share,
+			Total: character.ExperiencePoints + share,
+		})
+	}
+	return awards
+}
+
+// encounterTreasureTier — ступень добычи по самому опасному побеждённому.
+func encounterTreasureTier(defeated []EncounterDefeatedMonster) int {
+	highest := 0
+	for _, monster := range defeated {
+		key, _ := challengeRatingKey(monster.ChallengeRating)
+		if cr, err := strconv.Atoi(key); err == nil && cr > highest {
+			highest = cr
+		}
+	}
+	switch {
+	case highest >= 17:
+		return 3
+	case highest >= 11:
+		return 2
+	case highest >= 5:
+		return 1
+	}
+	return 0
+}
+
+// generateEncounterTreasure — случайные карточки каталога по правилам
+// ступени, без повторов. Каталог сортируется по id, так что зерно
+// воспроизводит ту же добычу.
+func generateEncounterTreasure(cards []Card, tier int, rng diceRNG) []EncounterTreasureItem {
+	sort.Slice(cards, func(i, j int) bool { return cards[i].ID.String() < cards[j].ID.String() })
+	treasure := []EncounterTreasureItem{}
+	for _, rarity := range encounterTreasureRarities {
+		expr, ok := encounterTreasureRules[tier][rarity]
+		if !ok {
+			continue
+		}
+		count := rollShopCount(rng, expr)
+		var candidates []Card
+		for _, card := range cards {
+			if card.Rarity == rarity {
+				candidates = append(candidates, card)
+			}
+		}
+		shuffleWithDice(rng, len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		for i := 0; i < count && i < len(candidates); i++ {
+			treasure = append(treasure, EncounterTreasureItem{CardID: candidates[i].ID, Name: candidates[i].Name, Rarity: rarity})
+		}
+	}
+	return treasure
+}
+
+// addInventoryItem добавляет предмет в строку инвентаря вне контейнеров и
+// возвращает, сколько таких предметов у персонажа всего.
+func addInventoryItem(rows InventoryItemRows, cardID string, qty int) (InventoryItemRows, int) {
+	next := append(InventoryItemRows{}, rows...)
+	added := false
+	for i := range next {
+		if next[i].CardID == cardID && next[i].ContainerID == "" && !added {
+			next[i].Qty += qty
+			added = true
+		}
+	}
+	if !added {
+		next = append(next, InventoryItemRow{CardID: cardID, Qty: qty})
+	}
+	total := 0
+	for _, row := range next {
+		if row.CardID == cardID {
+			total += row.Qty
+		}
+	}
+	return next, total
+}
+
+// encounterConclusionCharacterUpdates — запись итога боя в лист персонажа:
+// опыт и добыча. Любая такая запись повышает runtime_revision, чтобы клиент со
+// старой ревизией не перезаписал лист; пустой итог — nil.
+func encounterConclusionCharacterUpdates(experience map[uuid.UUID]int, inventories map[uuid.UUID]InventoryItemRows, characterID uuid.UUID) map[string]interface{} {
+	updates := map[string]interface{}{}
+	if total, ok := experience[characterID]; ok {
+		updates["experience_points"] = total
+	}
+	if rows, ok := inventories[characterID]; ok {
+		updates["inventory_items"] = &rows
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	updates["runtime_revision"] = gorm.Expr("runtime_revision + 1")
+	return updates
+}
+
+// Conclude — POST /api/encounters/:id/conclude (только мастер боя).
+func (ec *EncounterController) Conclude(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req EncounterConcludeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if !req.Preview && (req.ExpectedSeq == nil || *req.ExpectedSeq < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	var conclusion EncounterConclusion
+	var concluded Encounter
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if caller != enc.OwnerUserID {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "завершить бой может только мастер боя"}
+		}
+		if enc.ConcludedAt != nil {
+			return &encounterAccessError{Status: http.StatusConflict, Message: "бой уже завершён"}
+		}
+		if !req.Preview && enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, !req.Preview)
+		if err != nil {
+			return err
+		}
+		var monsterIDs []string
+		for _, combatant := range combatants {
+			if _, err := uuid.Parse(stringField(combatant, "monsterId")); err == nil {
+				monsterIDs = append(monsterIDs, stringField(combatant, "monsterId"))
+			}
+		}
+		ratings := map[string]string{}
+		if len(monsterIDs) > 0 {
+			var rows []Monster
+			if err := tx.Select("id", "challenge_rating").Where("id IN ?", monsterIDs).Find(&rows).Error; err != nil {
+				return err
+			}
+			for _, monster := range rows {
+				ratings[monster.ID.String()] = monster.ChallengeRating
+			}
+		}
+		defeated, accessErr := encounterDefeatedMonsters(combatants, ratings, req.DefeatedActorIDs)
+		if accessErr != nil {
+			return accessErr
+		}
+		conclusion.Defeated = defeated
+		for _, monster := range defeated {
+			conclusion.TotalXP += monster.XP
+		}
+
+		recipientIDs := characterIDs
+		if len(req.CharacterIDs) > 0 {
+			recipientIDs = req.CharacterIDs
+		}
+		recipients := make([]CharacterV3, 0, len(recipientIDs))
+		seen := map[uuid.UUID]bool{}
+		for _, characterID := range recipientIDs {
+			character, ok := characters[characterID]
+			if !ok {
+				return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "опыт получают только персонажи этого боя"}
+			}
+			if !seen[characterID] {
+				seen[characterID] = true
+				recipients = append(recipients, character)
+			}
+		}
+		conclusion.XPAwards = splitEncounterXP(conclusion.TotalXP, recipients)
+
+		conclusion.Treasure = []EncounterTreasureItem{}
+		if req.Treasure {
+			seed := time.Now().UnixNano()&(1<<53-1) | 1
+			if req.Seed != nil && *req.Seed != 0 {
+				seed = *req.Seed
+			}
+			var cards []Card
+			if err := tx.Select("id", "name", "rarity").
+				Where("is_template != ? OR is_template IS NULL", "only_template").
+				Find(&cards).Error; err != nil {
+				return err
+			}
+			conclusion.Seed = seed
+			conclusion.Treasure = generateEncounterTreasure(cards, encounterTreasureTier(defeated), newDiceRNG(seed))
+		}
+
+		conclusion.ItemAwards = []EncounterItemAward{}
+		if len(req.Awards) > 0 {
+			cardIDs := make([]uuid.UUID, 0, len(req.Awards))
+			for _, award := range req.Awards {
+				if _, ok := characters[award.CharacterID]; !ok {
+					return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "предметы получают только персонажи этого боя"}
+				}
+				cardIDs = append(cardIDs, award.CardID)
+			}
+			var cards []Card
+			if err := tx.Select("id", "name").Where("id IN ?", cardIDs).Find(&cards).Error; err != nil {
+				return err
+			}
+			names := make(map[uuid.UUID]string, len(cards))
+			for _, card := range cards {
+				names[card.ID] = card.Name
+			}
+			for _, award := range req.Awards {
+				name, ok := names[award.CardID]
+				if !ok {
+					return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "карточка предмета не найдена"}
+				}
+				if award.Qty == 0 {
+					award.Qty = 1
+				}
+				award.Name = name
+				conclusion.ItemAwards = append(conclusion.ItemAwards, award)
+			}
+		}
+		if req.Preview {
+			return nil
+		}
+
+		// Награды — в журналы персонажей через тот же op, что закрывает бой:
+		// общий журнал боя и листы персонажей видят одно и то же.
+		op := ApplyRequest{}
+		experience := map[uuid.UUID]int{}
+		for _, award := range conclusion.XPAwards {
+			experience[award.CharacterID] = award.Total
+			op.Log = append(op.Log, BattleLogEntry{
+				Message:           fmt.Sprintf("%s: опыт +%d", award.Name, award.XP),
+				TargetCharacterID: award.CharacterID.String(),
+				Type:              "xp_gained",
+				Payload:           JSONMap{"type": "xp_gained", "amount": award.XP, "total": award.Total, "source": enc.Name},
+			})
+		}
+		inventories := map[uuid.UUID]InventoryItemRows{}
+		for _, award := range conclusion.ItemAwards {
+			rows, ok := inventories[award.CharacterID]
+			if !ok && characters[award.CharacterID].InventoryItems != nil {
+				rows = *characters[award.CharacterID].InventoryItems
+			}
+			rows, total := addInventoryItem(rows, award.CardID.String(), award.Qty)
+			inventories[award.CharacterID] = rows
+			op.Log = append(op.Log, BattleLogEntry{
+				Message:           fmt.Sprintf("%s получает «%s» ×%d", characters[award.CharacterID].Name, award.Name, award.Qty),
+				TargetCharacterID: award.CharacterID.String(),
+				Type:              "item_added",
+				Payload:           JSONMap{"type": "item_added", "cardId": award.CardID.String(), "qty": award.Qty, "total": total, "name": award.Name},
+			})
+		}
+		names := make([]string, 0, len(defeated))
+		for _, monster := range defeated {
+			names = append(names, monster.Name)
+		}
+		summary := fmt.Sprintf("Бой завершён. Опыт: %d", conclusion.TotalXP)
+		if len(names) > 0 {
+			summary += " (" + strings.Join(names, ", ") + ")"
+		}
+		op.Log = append(op.Log, BattleLogEntry{Message: summary})
+
+		for characterID, character := range characters {
+			updates := encounterConclusionCharacterUpdates(experience, inventories, characterID)
+			if len(updates) == 0 {
+				continue
+			}
+			result := tx.Model(&CharacterV3{}).Where("id = ? AND user_id = ? AND runtime_revision = ?", characterID, character.UserID, character.RuntimeRevision).Updates(updates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return &encounterAccessError{Status: http.StatusConflict, Message: "персонаж изменился; повторите операцию"}
+			}
+		}
+		if _, err := commitEncounterOp(tx, &enc, state, op, characters); err != nil {
+			return err
+		}
+		// Завершённый бой больше не держит персонажей.
+		if err := tx.Model(&CharacterV3{}).Where("current_encounter_id = ?", enc.ID).Update("current_encounter_id", nil).Error; err != nil {
+			return err
+		}
+		stored, err := apiResponseAsJSONMap(conclusion)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		enc.ConcludedAt, enc.Conclusion = &now, &stored
+		if err := tx.Model(&enc).Updates(map[string]interface{}{"concluded_at": now, "conclusion": &stored}).Error; err != nil {
+			return err
+		}
+		concluded = enc
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось завершить бой")
+		return
+	}
+	if req.Preview {
+		c.JSON(http.StatusOK, gin.H{"preview": true, "conclusion": conclusion})
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), concluded.Seq)
+	}
+	c.JSON(http.StatusOK, gin.H{"encounter": concluded, "conclusion": conclusion})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+func TestEncounterDefeatedMonstersAndXPSplit(t *testing.T) {
+	goblin, ogre := uuid.NewString(), uuid.NewString()
+	hero := uuid.NewString()
+	combatants := []map[string]interface{}{
+		{"actorId": "g1", "name": "Гоблин 1", "monsterId": goblin, "hp": float64(0)},
+		{"actorId": "g2", "name": "Гоблин 2", "monsterId": goblin, "hp": float64(3)},
+		{"actorId": "o", "name": "Огр", "monsterId": ogre, "hp": float64(-4)},
+		{"actorId": "h", "name": "Герой", "characterId": hero, "hp": float64(0)},
+		{"actorId": "x", "name": "Тень", "hp": float64(0)},
+	}
+	ratings := map[string]string{goblin: "1/4", ogre: "2"}
+	defeated, err := encounterDefeatedMonsters(combatants, ratings, nil)
+	if err != nil || len(defeated) != 3 || defeated[0].XP != 50 || defeated[1].XP != 450 || defeated[2].XP != 0 {
+		t.Fatalf("побеждены существа с нулём хитов; персонаж не в счёт, без статблока — без опыта: %+v %v", defeated, err)
+	}
+	named, err := encounterDefeatedMonsters(combatants, ratings, []string{"g2", "g2"})
+	if err != nil || len(named) != 1 || named[0].ActorID != "g2" {
+		t.Fatalf("мастер называет побеждённых сам: %+v %v", named, err)
+	}
+	if _, err := encounterDefeatedMonsters(combatants, ratings, []string{"h"}); err == nil {
+		t.Fatal("персонаж не может быть побеждённым существом")
+	}
+
+	party := []CharacterV3{{ID: uuid.New(), Name: "Ария", ExperiencePoints: 300}, {ID: uuid.New(), Name: "Борин"}, {ID: uuid.New(), Name: "Вил"}}
+	awards := splitEncounterXP(500, party)
+	if len(awards) != 3 || awards[0].XP != 166 || awards[0].Total != 466 || awards[2].Total != 166 {
+		t.Fatalf("опыт делится поровну, остаток теряется: %+v", awards)
+	}
+}
+
+func TestGenerateEncounterTreasureByTier(t *testing.T) {
+	if tier := encounterTreasureTier([]EncounterDefeatedMonster{{ChallengeRating: "1/2"}, {ChallengeRating: "11"}}); tier != 2 {
+		t.Fatalf("ступень по самому опасному: %d", tier)
+	}
+	var cards []Card
+	for i := 0; i < 6; i++ {
+		cards = append(cards, Card{ID: uuid.New(), Name: "Обычный", Rarity: RarityCommon}, Card{ID: uuid.New(), Name: "Необычный", Rarity: RarityUncommon}, Card{ID: uuid.New(), Name: "Редкий", Rarity: RarityRare})
+	}
+	treasure := generateEncounterTreasure(cards, 0, newDiceRNG(7))
+	if len(treasure) == 0 {
+		t.Fatal("на первой ступени выпадает хотя бы один обычный предмет")
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, item := range treasure {
+		if item.Rarity == RarityRare || seen[item.CardID] {
+			t.Fatalf("первая ступень без редких предметов и без повторов: %+v", treasure)
+		}
+		seen[item.CardID] = true
+	}
+	again := generateEncounterTreasure(cards, 0, newDiceRNG(7))
+	if len(again) != len(treasure) || again[0].CardID != treasure[0].CardID {
+		t.Fatalf("то же зерно — та же добыча: %+v / %+v", treasure, again)
+	}
+}
+
+func TestAddInventoryItemStacksOutsideContainers(t *testing.T) {
+	rows := InventoryItemRows{{CardID: "arrow", Qty: 10, ContainerID: "quiver"}, {CardID: "arrow", Qty: 5}}
+	next, total := addInventoryItem(rows, "arrow", 20)
+	if len(next) != 2 || next[1].Qty != 25 || next[0].Qty != 10 || total != 35 || rows[1].Qty != 5 {
+		t.Fatalf("стопка вне контейнера, исходные строки не тронуты: %+v total=%d", next, total)
+	}
+	next, total = addInventoryItem(next, "potion", 1)
+	if len(next) != 3 || total != 1 {
+		t.Fatalf("новая строка для нового предмета: %+v", next)
+	}
+}
+
+func TestEncounterConclusionCharacterUpdatesBumpRevision(t *testing.T) {
+	fighter, rogue, bystander := uuid.New(), uuid.New(), uuid.New()
+	experience := map[uuid.UUID]int{fighter: 450, rogue: 450}
+	inventories := map[uuid.UUID]InventoryItemRows{rogue: {{CardID: uuid.NewString(), Qty: 1}}}
+
+	xpOnly := encounterConclusionCharacterUpdates(experience, inventories, fighter)
+	if xpOnly["experience_points"] != 450 || xpOnly["inventory_items"] != nil || xpOnly["runtime_revision"] == nil {
+		t.Fatalf("опыт без добычи тоже повышает ревизию: %+v", xpOnly)
+	}
+	if revision, ok := xpOnly["runtime_revision"].(clause.Expr); !ok || revision.SQL != "runtime_revision + 1" {
+		t.Fatalf("ревизия растёт в самой записи: %#v", xpOnly["runtime_revision"])
+	}
+	withLoot := encounterConclusionCharacterUpdates(experience, inventories, rogue)
+	if withLoot["inventory_items"] == nil || withLoot["runtime_revision"] == nil {
+		t.Fatalf("добыча повышает ревизию: %+v", withLoot)
+	}
+	if none := encounterConclusionCharacterUpdates(experience, inventories, bystander); none != nil {
+		t.Fatalf("без итога лист не трогается: %+v", none)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -71,6 +72,9 @@ func applyOps(state map[string]interface{}, req ApplyRequest) map[string]interfa
 	for _, a := range req.Add {
 		combatants = append(combatants, a)
 	}
+	if len(req.Order) > 0 {
+		combatants = orderCombatants(combatants, req.Order)
+	}
 	arr := make([]interface{}, len(combatants))
 	for i, c := range combatants {
 		arr[i] = c
@@ -85,6 +89,30 @@ func applyOps(state map[string]interface{}, req ApplyRequest) map[string]interfa
 	return state
 }
 
+// orderCombatants переставляет участников по order (actorId); не названные
+// в нём остаются после названных в прежнем порядке.
+func orderCombatants(combatants []map[string]interface{}, order []string) []map[string]interface{} {
+	position := make(map[string]int, len(order))
+	for i, actorID := range order {
+		if _, seen := position[actorID]; !seen {
+			position[actorID] = i
+		}
+	}
+	ordered := make([]map[string]interface{}, 0, len(combatants))
+	rest := make([]map[string]interface{}, 0, len(combatants))
+	for _, c := range combatants {
+		if _, listed := position[fmt.Sprint(c["actorId"])]; listed {
+			ordered = append(ordered, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return position[fmt.Sprint(ordered[i]["actorId"])] < position[fmt.Sprint(ordered[j]["actorId"])]
+	})
+	return append(ordered, rest...)
+}
+
 func opPayload(req ApplyRequest) JSONMap {
 	b, _ := json.Marshal(req)
 	var m JSONMap
@@ -142,6 +170,33 @@ func encounterConflict(db *gorm.DB, cid string, thisEnc uuid.UUID) (string, bool
 	return "", false // персонажа там уже нет — ссылка устарела
 }
 
+// encounterCharacterSheetUpdates — поля characters_v3, которые op поменял у
+// персонажа-комбатанта: current_hp и active_effects; временные хиты
+// возвращаются отдельно — они мержатся в turn_state. Числа читаются через
+// encounterStateInt: патчи клиента приходят из JSON (float64), а патчи,
+// разрешённые сервером (атака, спасбросок), несут int.
+func encounterCharacterSheetUpdates(m map[string]interface{}, fields map[string]bool) (map[string]interface{}, int, bool) {
+	upd := map[string]interface{}{}
+	if fields["hp"] {
+		if hp, ok := encounterStateInt(m["hp"]); ok {
+			upd["current_hp"] = hp
+		}
+	}
+	if fields["activeEffects"] {
+		if ae, ok := m["activeEffects"].([]interface{}); ok {
+			var eff ActiveEffectRows
+			b, _ := json.Marshal(ae)
+			_ = json.Unmarshal(b, &eff)
+			upd["active_effects"] = &eff
+		}
+	}
+	if !fields["temp"] {
+		return upd, 0, false
+	}
+	temp, ok := encounterStateInt(m["temp"])
+	return upd, temp, ok
+}
+
 // syncCombatantsToCharacters — write-through боевого состояния персонажей-комбатантов в их запись
 // characters_v3: current_hp (из hp), turn_state.temp_hp (из temp, merge), active_effects (из
 // activeEffects). ПОЛЕВОЙ write-through: пишем только те поля, что этот op реально менял (changed
@@ -175,34 +230,19 @@ func syncCombatantsToCharacters(tx *gorm.DB, state map[string]interface{}, chang
 		if !authorized || ownerID == uuid.Nil {
 			continue
 		}
-		upd := map[string]interface{}{}
-		if fields["hp"] {
-			if hp, ok := m["hp"].(float64); ok {
-				upd["current_hp"] = int(hp)
+		upd, temp, hasTemp := encounterCharacterSheetUpdates(m, fields)
+		if hasTemp {
+			// turn_state — read-merge-write только ключа temp_hp (не затираем death_saves/attuned_ids).
+			var cur CharacterV3
+			if e := tx.Select("turn_state").First(&cur, "id = ? AND user_id = ?", u, ownerID).Error; e != nil {
+				return fmt.Errorf("load encounter character %s turn state: %w", cid, e)
 			}
-		}
-		if fields["activeEffects"] {
-			if ae, ok := m["activeEffects"].([]interface{}); ok {
-				var eff ActiveEffectRows
-				b, _ := json.Marshal(ae)
-				_ = json.Unmarshal(b, &eff)
-				upd["active_effects"] = &eff
-			}
-		}
-		if fields["temp"] {
-			if t, ok := m["temp"].(float64); ok {
-				// turn_state — read-merge-write только ключа temp_hp (не затираем death_saves/attuned_ids).
-				var cur CharacterV3
-				if e := tx.Select("turn_state").First(&cur, "id = ? AND user_id = ?", u, ownerID).Error; e != nil {
-					return fmt.Errorf("load encounter character %s turn state: %w", cid, e)
-				}
-				ts := JSONMap{}
-				if cur.TurnState != nil {
-					ts = *cur.TurnState
-				}
-				ts["temp_hp"] = int(t)
-				upd["turn_state"] = &ts
+			ts := JSONMap{}
+			if cur.TurnState != nil {
+				ts = *cur.TurnState
 			}
+			ts["temp_hp"] = temp
+			upd["turn_state"] = &ts
 		}
 		if len(upd) == 0 {
 			continue
@@ -254,6 +294,172 @@ func writeCharacterJournal(tx *gorm.DB, entries []BattleLogEntry, allowedCharact
 	return nil
 }
 
+// commitEncounterOp — общий хвост любой операции боя внутри транзакции, когда строка боя и
+// персонажи уже заблокированы, а op разрешён: применяет op и серверные следствия (тик
+// длительностей на смене хода, концентрация), бампит seq, пишет состояние и событие,
+// связи персонажей с боем, write-through в листы и журналы персонажей. Серверные
+// следствия дописываются в сам op, поэтому подписчики SSE воспроизводят то же состояние.
+// Завершённый бой (Conclude) операций больше не принимает.
+func commitEncounterOp(tx *gorm.DB, enc *Encounter, state map[string]interface{}, req ApplyRequest, characters map[uuid.UUID]CharacterV3) (JSONMap, error) {
+	if enc.ConcludedAt != nil {
+		return nil, &encounterAccessError{Status: http.StatusConflict, Message: "бой завершён"}
+	}
+	id := enc.ID
+	before := characterIDsInState(state)
+	previousTurn := encounterTurnOf(state)
+	previousConcentration := encounterConcentrations(state)
+	previousMonsterHP := encounterMonsterHitPoints(state)
+	clientLog := req.Log
+	newState := applyOps(state, req)
+	after := characterIDsInState(newState)
+
+	turnPatches, turnExpired := expireEncounterTurnChange(newState, previousTurn, req)
+	newState = appendEncounterDerivedOps(newState, &req, turnPatches, turnExpired)
+	patches, ended, fresh, accessErr := supersedeEncounterConcentration(newState, previousConcentration)
+	if accessErr != nil {
+		return nil, accessErr
+	}
+	if err := validateEncounterConcentrationSpells(tx, fresh); err != nil {
+		return nil, err
+	}
+	newState = appendEncounterDerivedOps(newState, &req, patches, ended)
+	newState = appendEncounterDerivedOps(newState, &req, openEncounterConcentrationSaves(newState, clientLog), nil)
+	monsterPatches, monsterLog, err := resolveEncounterMonsterConcentration(tx, newState, previousMonsterHP, characters)
+	if err != nil {
+		return nil, err
+	}
+	newState = appendEncounterDerivedOps(newState, &req, monsterPatches, monsterLog)
+
+	// A locked CharacterV3 row makes this invariant safe even when two
+	// different encounters concurrently try to add the same character.
+	for characterID := range after {
+		if !before[characterID] {
+			if otherName, conflict := encounterConflict(tx, characterID, id); conflict {
+				return nil, &encounterAccessError{Status: http.StatusConflict, Message: fmt.Sprintf("Персонаж уже участвует в бою «%s»", otherName)}
+			}
+		}
+	}
+
+	characterOwners := map[string]uuid.UUID{}
+	journalCharacters := map[string]uuid.UUID{}
+	for characterID, character := range characters {
+		canonical := characterID.String()
+		characterOwners[canonical] = character.UserID
+		journalCharacters[canonical] = characterID
+	}
+
+	changed := map[string]map[string]bool{}
+	mark := func(actorID, field string) {
+		if changed[actorID] == nil {
+			changed[actorID] = map[string]bool{}
+		}
+		changed[actorID][field] = true
+	}
+	for _, patch := range req.Patches {
+		for field := range patch.Set {
+			mark(patch.ActorID, field)
+		}
+	}
+	for _, added := range req.Add {
+		if actorID, ok := added["actorId"].(string); ok {
+			for field := range added {
+				mark(actorID, field)
+			}
+		}
+	}
+
+	result := JSONMap(newState)
+	enc.State = &result
+	enc.Seq++
+	payload := opPayload(req)
+	event := EncounterEvent{EncounterID: id, Seq: enc.Seq, Payload: &payload}
+	if err := tx.Save(enc).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return nil, err
+	}
+
+	// Character links are always qualified by their authoritative owner.
+	for characterID := range after {
+		if before[characterID] {
+			continue
+		}
+		u, parseErr := uuid.Parse(characterID)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		character := characters[u]
+		update := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ?", u, character.UserID).
+			Update("current_encounter_id", id)
+		if update.Error != nil {
+			return nil, update.Error
+		}
+		if update.RowsAffected != 1 {
+			return nil, &encounterAccessError{Status: http.StatusConflict, Message: "контроллер персонажа изменился; повторите операцию"}
+		}
+	}
+	for characterID := range before {
+		if after[characterID] {
+			continue
+		}
+		u, parseErr := uuid.Parse(characterID)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		character := characters[u]
+		if err := tx.Model(&CharacterV3{}).
+			Where("id = ? AND user_id = ? AND current_encounter_id = ?", u, character.UserID, id).
+			Update("current_encounter_id", nil).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := syncCombatantsToCharacters(tx, result, changed, characterOwners); err != nil {
+		return nil, err
+	}
+	if err := writeCharacterJournal(tx, req.Log, journalCharacters); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// appendEncounterDerivedOps применяет серверные патчи к состоянию и дописывает их вместе с
+// записями журнала в op. Патч участника, добавленного этим же op, вливается в его add:
+// applyOps применяет патчи до добавлений, и реплей иначе потерял бы изменение.
+func appendEncounterDerivedOps(state map[string]interface{}, req *ApplyRequest, patches []CombatantPatch, log []BattleLogEntry) map[string]interface{} {
+	if len(patches) > 0 {
+		state = applyOps(state, ApplyRequest{Patches: patches})
+		adds := append([]map[string]interface{}{}, req.Add...)
+		merged := append([]CombatantPatch{}, req.Patches...)
+		for _, patch := range patches {
+			added := -1
+			for i, combatant := range adds {
+				if actorID, _ := combatant["actorId"].(string); actorID == patch.ActorID {
+					added = i
+				}
+			}
+			if added < 0 {
+				merged = append(merged, patch)
+				continue
+			}
+			combatant := make(map[string]interface{}, len(adds[added])+len(patch.Set))
+			for key, value := range adds[added] {
+				combatant[key] = value
+			}
+			for key, value := range patch.Set {
+				combatant[key] = value
+			}
+			adds[added] = combatant
+		}
+		req.Add, req.Patches = adds, merged
+	}
+	if len(log) > 0 {
+		req.Log = append(append([]BattleLogEntry{}, req.Log...), log...)
+	}
+	return state
+}
+
 func stateOfEncounter(enc *Encounter) map[string]interface{} {
 	if enc == nil || enc.State == nil {
 		return map[string]interface{}{}
@@ -312,6 +518,20 @@ func (ec *EncounterController) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, enc)
 }
 
+// spawnEncounter создаёт пустой бой владельца и первым op добавляет в него
+// существ обычным путём commitEncounterOp: seq, журнал боя и связи персонажей
+// идут так же, как у любой другой операции.
+func spawnEncounter(tx *gorm.DB, owner uuid.UUID, name string, combatants []map[string]interface{}, message string) (Encounter, error) {
+	empty := JSONMap{"combatants": []interface{}{}, "round": 1, "activeIndex": 0}
+	enc := Encounter{Name: name, OwnerUserID: owner, MemberUserIDs: Properties{owner.String()}, State: &empty, Seq: 0}
+	if err := tx.Create(&enc).Error; err != nil {
+		return enc, err
+	}
+	op := ApplyRequest{Add: combatants, Log: []BattleLogEntry{{Message: message}}}
+	_, err := commitEncounterOp(tx, &enc, stateOfEncounter(&enc), op, nil)
+	return enc, err
+}
+
 func (ec *EncounterController) List(c *gin.Context) {
 	userID, err := GetCurrentUserID(c)
 	if err != nil || userID == uuid.Nil {
@@ -334,6 +554,11 @@ func (ec *EncounterController) Get(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
 		return
 	}
+	method := c.Query("difficulty_method")
+	if method != "" && !oneOf(method, "2024", "2014") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "difficulty_method должен быть 2024 или 2014", "details": method})
+		return
+	}
 	var enc Encounter
 	if err := ec.db.First(&enc, "id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "бой не найден"})
@@ -342,7 +567,22 @@ func (ec *EncounterController) Get(c *gin.Context) {
 	if _, ok := requireEncounterParticipant(c, &enc); !ok {
 		return
 	}
-	c.JSON(http.StatusOK, enc)
+	response := encounterResponse{Encounter: enc}
+	// Сложность — производная подсказка: сломанный статблок или CR не должен
+	// делать сам бой нечитаемым, поэтому при ошибке поле просто не отдаётся.
+	if difficulty, err := encounterStateDifficulty(ec.db, stateOfEncounter(&enc), method); err != nil {
+		log.Printf("encounter %s difficulty: %v", enc.ID, err)
+	} else {
+		response.Difficulty = &difficulty
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// encounterResponse — бой с оценкой сложности по текущим участникам; без
+// оценки, если её не удалось посчитать.
+type encounterResponse struct {
+	Encounter
+	Difficulty *EncounterDifficulty `json:"difficulty,omitempty"`
 }
 
 // Delete removes an encounter owned by the caller. Encounter and linked
@@ -576,9 +816,6 @@ func (ec *EncounterController) Apply(c *gin.Context) {
 
 	var newState JSONMap
 	var newSeq int64
-	changed := map[string]map[string]bool{}
-	characterOwners := map[string]uuid.UUID{}
-	journalCharacters := map[string]uuid.UUID{}
 
 	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
 		var enc Encounter
@@ -649,98 +886,11 @@ func (ec *EncounterController) Apply(c *gin.Context) {
 		}
 
 		normalizedReq := normalizeEncounterAdds(req, characters)
-		before := characterIDsInState(state)
-		newState = JSONMap(applyOps(state, normalizedReq))
-		after := characterIDsInState(newState)
-
-		// A locked CharacterV3 row makes this invariant safe even when two
-		// different encounters concurrently try to add the same character.
-		for characterID := range after {
-			if !before[characterID] {
-				if otherName, conflict := encounterConflict(tx, characterID, id); conflict {
-					return &encounterAccessError{Status: http.StatusConflict, Message: fmt.Sprintf("Персонаж уже участвует в бою «%s»", otherName)}
-				}
-			}
-		}
-
-		for characterID, character := range characters {
-			canonical := characterID.String()
-			characterOwners[canonical] = character.UserID
-			journalCharacters[canonical] = characterID
-		}
-
-		mark := func(actorID, field string) {
-			if changed[actorID] == nil {
-				changed[actorID] = map[string]bool{}
-			}
-			changed[actorID][field] = true
-		}
-		for _, patch := range normalizedReq.Patches {
-			for field := range patch.Set {
-				mark(patch.ActorID, field)
-			}
-		}
-		for _, added := range normalizedReq.Add {
-			if actorID, ok := added["actorId"].(string); ok {
-				for field := range added {
-					mark(actorID, field)
-				}
-			}
-		}
-
-		newSeq = enc.Seq + 1
-		enc.State = &newState
-		enc.Seq = newSeq
-		payload := opPayload(normalizedReq)
-		event := EncounterEvent{EncounterID: id, Seq: newSeq, Payload: &payload}
-		if err := tx.Save(&enc).Error; err != nil {
-			return err
-		}
-		if err := tx.Create(&event).Error; err != nil {
-			return err
-		}
-
-		// Character links are always qualified by their authoritative owner.
-		for characterID := range after {
-			if before[characterID] {
-				continue
-			}
-			u, parseErr := uuid.Parse(characterID)
-			if parseErr != nil {
-				return parseErr
-			}
-			character := characters[u]
-			result := tx.Model(&CharacterV3{}).
-				Where("id = ? AND user_id = ?", u, character.UserID).
-				Update("current_encounter_id", id)
-			if result.Error != nil {
-				return result.Error
-			}
-			if result.RowsAffected != 1 {
-				return &encounterAccessError{Status: http.StatusConflict, Message: "контроллер персонажа изменился; повторите операцию"}
-			}
-		}
-		for characterID := range before {
-			if after[characterID] {
-				continue
-			}
-			u, parseErr := uuid.Parse(characterID)
-			if parseErr != nil {
-				return parseErr
-			}
-			character := characters[u]
-			if err := tx.Model(&CharacterV3{}).
-				Where("id = ? AND user_id = ? AND current_encounter_id = ?", u, character.UserID, id).
-				Update("current_encounter_id", nil).Error; err != nil {
-				return err
-			}
-		}
-		if err := syncCombatantsToCharacters(tx, newState, changed, characterOwners); err != nil {
-			return err
-		}
-		if err := writeCharacterJournal(tx, req.Log, journalCharacters); err != nil {
-			return err
+		committed, commitErr := commitEncounterOp(tx, &enc, state, normalizedReq, characters)
+		if commitErr != nil {
+			return commitErr
 		}
+		newState, newSeq = committed, enc.Seq
 		return nil
 	})
 	if txErr != nil {
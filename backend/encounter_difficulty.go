@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Сложность столкновения по опыту существ и уровням отряда. Метод 2024 года
+// сравнивает сумму опыта с бюджетом отряда (низкая/умеренная/высокая),
+// метод 2014 года — скорректированный множителем за число существ опыт с
+// порогами отряда.
+
+const maxEncounterDifficultyBodyBytes = 8 << 10
+
+// challengeRatingXP — опыт за существо по показателю опасности.
+var challengeRatingXP = map[string]int{
+	"0": 10, "1/8": 25, "1/4": 50, "1/2": 100,
+	"1": 200, "2": 450, "3": 700, "4": 1100, "5": 1800,
+	"6": 2300, "7": 2900, "8": 3900, "9": 5000, "10": 5900,
+	"11": 7200, "12": 8400, "13": 10000, "14": 11500, "15": 13000,
+	"16": 15000, "17": 18000, "18": 20000, "19": 22000, "20": 25000,
+	"21": 33000, "22": 41000, "23": 50000, "24": 62000, "25": 75000,
+	"26": 90000, "27": 105000, "28": 120000, "29": 135000, "30": 155000,
+}
+
+// encounterXPBudget2024 — бюджет опыта на персонажа по уровню: низкая,
+// умеренная и высокая сложность (DMG 2024).
+var encounterXPBudget2024 = [21][3]int{
+	{},
+	{50, 75, 100}, {100, 150, 200}, {150, 225, 400}, {250, 375, 500}, {500, 750, 1100},
+	{600, 1000, 1400}, {750, 1300, 1700}, {1000, 1700, 2100}, {1300, 2000, 2600}, {1600, 2300, 3100},
+	{1900, 2900, 4100}, {2200, 3700, 4700}, {2600, 4200, 5400}, {2900, 4900, 6200}, {3300, 5400, 7800},
+	{3800, 6100, 9800}, {4500, 7200, 11700}, {5000, 8700, 14200}, {5500, 10700, 17200}, {6400, 13200, 22000},
+}
+
+// encounterXPThresholds2014 — пороги опыта на персонажа по уровню: лёгкая,
+// средняя, трудная и смертельная сложность (DMG 2014).
+var encounterXPThresholds2014 = [21][4]int{
+	{},
+	{25, 50, 75, 100}, {50, 100, 150, 200}, {75, 150, 225, 400}, {125, 250, 375, 500}, {250, 500, 750, 1100},
+	{300, 600, 900, 1400}, {350, 750, 1100, 1700}, {450, 900, 1400, 2100}, {550, 1100, 1600, 2400}, {600, 1200, 1900, 2800},
+	{800, 1600, 2400, 3600}, {1000, 2000, 3000, 4500}, {1100, 2200, 3400, 5100}, {1250, 2500, 3800, 5700}, {1400, 2800, 4300, 6400},
+	{1600, 3200, 4800, 7200}, {2000, 3900, 5900, 8800}, {2100, 4200, 6300, 9500}, {2400, 4900, 7300, 10900}, {2800, 5700, 8500, 12700},
+}
+
+// encounterXPMultipliers2014 — ступени множителя за число существ; отряд
+// меньше трёх сдвигает ступень вверх, от шести — вниз.
+var encounterXPMultipliers2014 = []float64{0.5, 1, 1.5, 2, 2.5, 3, 4, 5}
+
+// challengeRatingKey приводит показатель опасности к ключу таблицы опыта:
+// «1/4», «0.25» и «¼» — одно и то же. false — показатель не распознан.
+func challengeRatingKey(raw string) (string, bool) {
+	value := strings.TrimSpace(strings.ToLower(raw))
+	value = strings.TrimSpace(strings.TrimPrefix(value, "cr"))
+	switch value {
+	case "⅛", "0.125":
+		value = "1/8"
+	case "¼", "0.25":
+		value = "1/4"
+	case "½", "0.5":
+		value = "1/2"
+	}
+	if _, ok := challengeRatingXP[value]; ok {
+		return value, true
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil && number == float64(int(number)) {
+		key := strconv.Itoa(int(number))
+		_, ok := challengeRatingXP[key]
+		return key, ok
+	}
+	return "", false
+}
+
+// EncounterDifficulty — оценка сложности столкновения.
+type EncounterDifficulty struct {
+	Method       string `json:"method"`
+	Rating       string `json:"rating"`
+	TotalXP      int    `json:"total_xp"`
+	PartySize    int    `json:"party_size"`
+	MonsterCount int    `json:"monster_count"`
+	// Budget — бюджет (2024) или пороги (2014) всего отряда по сложностям.
+	Budget map[string]int `json:"budget"`
+	// OverBudget — опыт больше бюджета высокой сложности (2024).
+	OverBudget bool `json:"over_budget,omitempty"`
+	// AdjustedXP и Multiplier — скорректированный опыт метода 2014 года.
+	AdjustedXP int     `json:"adjusted_xp,omitempty"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Unrated — существа без распознанного показателя опасности (не в сумме).
+	Unrated []string `json:"unrated,omitempty"`
+}
+
+// encounterDifficultyMonster — существо в оценке: имя и показатель опасности.
+type encounterDifficultyMonster struct {
+	Name            string
+	ChallengeRating string
+}
+
+// rateEncounterDifficulty оценивает столкновение методом "2024" (по
+// умолчанию) или "2014". Уровни персонажей приводятся к 1–20.
+func rateEncounterDifficulty(method string, monsters []encounterDifficultyMonster, levels []int) EncounterDifficulty {
+	if method != "2014" {
+		method = "2024"
+	}
+	result := EncounterDifficulty{Method: method, PartySize: len(levels), Budget: map[string]int{}}
+	for _, monster := range monsters {
+		key, ok := challengeRatingKey(monster.ChallengeRating)
+		if !ok {
+			result.Unrated = append(result.Unrated, monster.Name)
+			continue
+		}
+		result.TotalXP += challengeRatingXP[key]
+		result.MonsterCount++
+	}
+	for _, level := range levels {
+		if level < 1 {
+			level = 1
+		}
+		if level > 20 {
+			level = 20
+		}
+		if method == "2024" {
+			for i, tier := range []string{"low", "moderate", "high"} {
+				result.Budget[tier] += encounterXPBudget2024[level][i]
+			}
+		} else {
+			for i, tier := range []string{"easy", "medium", "hard", "deadly"} {
+				result.Budget[tier] += encounterXPThresholds2014[level][i]
+			}
+		}
+	}
+
+	if method == "2024" {
+		switch {
+		case result.TotalXP <= result.Budget["low"]:
+			result.Rating = "low"
+		case result.TotalXP <= result.Budget["moderate"]:
+			result.Rating = "moderate"
+		default:
+			result.Rating = "high"
+			result.OverBudget = result.TotalXP > result.Budget["high"]
+		}
+		return result
+	}
+
+	step := 1
+	switch count := result.MonsterCount; {
+	case count <= 1:
+		step = 1
+	case count == 2:
+		step = 2
+	case count <= 6:
+		step = 3
+	case count <= 10:
+		step = 4
+	case count <= 14:
+		step = 5
+	default:
+		step = 6
+	}
+	switch {
+	case result.PartySize > 0 && result.PartySize < 3:
+		step++
+	case result.PartySize >= 6:
+		step--
+	}
+	result.Multiplier = encounterXPMultipliers2014[step]
+	result.AdjustedXP = int(float64(result.TotalXP) * result.Multiplier)
+	result.Rating = "trivial"
+	for _, tier := range []string{"easy", "medium", "hard", "deadly"} {
+		if result.AdjustedXP >= result.Budget[tier] {
+			result.Rating = tier
+		}
+	}
+	return result
+}
+
+// EncounterDifficultyRequest — оценка планируемого столкновения: существа
+// статблоков с количеством и отряд — персонажи или группа.
+type EncounterDifficultyRequest struct {
+	Monsters []struct {
+		MonsterID uuid.UUID `json:"monster_id" binding:"required"`
+		Count     int       `json:"count" binding:"omitempty,min=1,max=100"`
+	} `json:"monsters" binding:"required,min=1,max=50,dive"`
+	CharacterIDs []uuid.UUID `json:"character_ids" binding:"max=20"`
+	GroupID      *uuid.UUID  `json:"group_id"`
+	Method       string      `json:"method" binding:"omitempty,oneof=2024 2014"`
+}
+
+// Difficulty — POST /api/encounters/difficulty. Персонажи отряда должны
+// принадлежать вызывающему или состоять в его группе; группа — та, где он
+// участник.
+func (ec *EncounterController) Difficulty(c *gin.Context) {
+	var req EncounterDifficultyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	levels, err := encounterPartyLevels(ec.db, caller, req.CharacterIDs, req.GroupID)
+	if err != nil {
+		writeEncounterError(c, err, "не удалось оценить сложность")
+		return
+	}
+
+	var monsters []encounterDifficultyMonster
+	for _, entry := range req.Monsters {
+		var monster Monster
+		if err := ec.db.Select("id", "name", "challenge_rating").First(&monster, "id = ?", entry.MonsterID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "монстр не найден"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось оценить сложность"})
+			return
+		}
+		count := entry.Count
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			monsters = append(monsters, encounterDifficultyMonster{Name: monster.Name, ChallengeRating: monster.ChallengeRating})
+		}
+	}
+	c.JSON(http.StatusOK, rateEncounterDifficulty(req.Method, monsters, levels))
+}
+
+// encounterPartyLevels — уровни отряда для оценки и подбора столкновений.
+// Ровно одно из characterIDs и groupID: персонажи должны принадлежать
+// вызывающему или состоять в его группе, группа — та, где он участник.
+func encounterPartyLevels(db *gorm.DB, caller uuid.UUID, characterIDs []uuid.UUID, groupID *uuid.UUID) ([]int, error) {
+	if (len(characterIDs) == 0) == (groupID == nil) {
+		return nil, &encounterAccessError{Status: http.StatusBadRequest, Message: "укажите ровно одно из character_ids или group_id"}
+	}
+	var memberships []GroupMember
+	if err := db.Where("user_id = ?", caller).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	groups := make(map[uuid.UUID]bool, len(memberships))
+	for _, membership := range memberships {
+		groups[membership.GroupID] = true
+	}
+
+	var characters []CharacterV3
+	if groupID != nil {
+		if !groups[*groupID] {
+			return nil, &encounterAccessError{Status: http.StatusForbidden, Message: "вы не являетесь участником этой группы"}
+		}
+		if err := db.Select("id", "level", "user_id", "group_id").Where("group_id = ?", *groupID).Find(&characters).Error; err != nil {
+			return nil, err
+		}
+		if len(characters) == 0 {
+			return nil, &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "в группе нет персонажей"}
+		}
+	} else {
+		if err := db.Select("id", "level", "user_id", "group_id").Where("id IN ?", characterIDs).Find(&characters).Error; err != nil {
+			return nil, err
+		}
+		found := make(map[uuid.UUID]bool, len(characters))
+		for _, character := range characters {
+			found[character.ID] = true
+			if character.UserID != caller && (character.GroupID == nil || !groups[*character.GroupID]) {
+				return nil, &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к персонажу"}
+			}
+		}
+		for _, characterID := range characterIDs {
+			if !found[characterID] {
+				return nil, &encounterAccessError{Status: http.StatusNotFound, Message: "персонаж не найден"}
+			}
+		}
+	}
+	levels := make([]int, len(characters))
+	for i, character := range characters {
+		levels[i] = character.Level
+	}
+	return levels, nil
+}
+
+// encounterStateDifficulty оценивает идущий бой: существа со статблоком
+// против персонажей-участников; существа мастера без статблока не оценены.
+func encounterStateDifficulty(db *gorm.DB, state map[string]interface{}, method string) (EncounterDifficulty, error) {
+	combatants, accessErr := combatantMaps(state)
+	if accessErr != nil {
+		return EncounterDifficulty{}, accessErr
+	}
+	characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+	if accessErr != nil {
+		return EncounterDifficulty{}, accessErr
+	}
+	var characters []CharacterV3
+	if len(characterIDs) > 0 {
+		if err := db.Select("id", "level").Where("id IN ?", characterIDs).Find(&characters).Error; err != nil {
+			return EncounterDifficulty{}, err
+		}
+	}
+	var monsterIDs []string
+	for _, combatant := range combatants {
+		if _, err := uuid.Parse(stringField(combatant, "monsterId")); err == nil {
+			monsterIDs = append(monsterIDs, stringField(combatant, "monsterId"))
+		}
+	}
+	ratings := map[string]string{}
+	if len(monsterIDs) > 0 {
+		var rows []Monster
+		if err := db.Select("id", "challenge_rating").Where("id IN ?", monsterIDs).Find(&rows).Error; err != nil {
+			return EncounterDifficulty{}, err
+		}
+		for _, monster := range rows {
+			ratings[monster.ID.String()] = monster.ChallengeRating
+		}
+	}
+	var monsters []encounterDifficultyMonster
+	for _, combatant := range combatants {
+		if stringField(combatant, "characterId") != "" {
+			continue
+		}
+		monsterID, _ := uuid.Parse(stringField(combatant, "monsterId"))
+		monsters = append(monsters, encounterDifficultyMonster{
+			Name:            stringFieldOr(combatant, "name", stringField(combatant, "actorId")),
+			ChallengeRating: ratings[monsterID.String()],
+		})
+	}
+	levels := make([]int, len(characters))
+	for i, character := range characters {
+		levels[i] = character.Level
+	}
+	return rateEncounterDifficulty(method, monsters, levels), nil
+}
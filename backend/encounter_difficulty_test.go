@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChallengeRatingKey(t *testing.T) {
+	for raw, want := range map[string]string{"1/4": "1/4", " 0.5 ": "1/2", "CR 3": "3", "½": "1/2", "10.0": "10"} {
+		if key, ok := challengeRatingKey(raw); !ok || key != want {
+			t.Fatalf("%q: got %q %v, want %q", raw, key, ok, want)
+		}
+	}
+	for _, raw := range []string{"", "31", "2.5", "один"} {
+		if _, ok := challengeRatingKey(raw); ok {
+			t.Fatalf("%q must not be a challenge rating", raw)
+		}
+	}
+}
+
+func TestRateEncounterDifficulty2024(t *testing.T) {
+	goblins := []encounterDifficultyMonster{{Name: "Гоблин", ChallengeRating: "1/4"}, {Name: "Гоблин", ChallengeRating: "1/4"}, {Name: "Багбир", ChallengeRating: "1"}}
+	result := rateEncounterDifficulty("", goblins, []int{3, 3, 3, 3})
+	if result.Method != "2024" || result.TotalXP != 300 || result.Budget["low"] != 600 || result.Rating != "low" {
+		t.Fatalf("300 XP против бюджета 600 — низкая сложность: %+v", result)
+	}
+	ogre := append(goblins, encounterDifficultyMonster{Name: "Огр", ChallengeRating: "2"}, encounterDifficultyMonster{Name: "Тень", ChallengeRating: "?"})
+	result = rateEncounterDifficulty("2024", ogre, []int{3, 3, 3, 3})
+	if result.TotalXP != 750 || result.Rating != "moderate" || len(result.Unrated) != 1 {
+		t.Fatalf("750 XP из 900 — умеренная, нераспознанный CR отмечен: %+v", result)
+	}
+	result = rateEncounterDifficulty("2024", []encounterDifficultyMonster{{Name: "Молодой дракон", ChallengeRating: "9"}}, []int{3, 3, 3, 3})
+	if result.Rating != "high" || !result.OverBudget {
+		t.Fatalf("5000 XP больше высокого бюджета 1600: %+v", result)
+	}
+}
+
+func TestRateEncounterDifficulty2014(t *testing.T) {
+	goblins := []encounterDifficultyMonster{{ChallengeRating: "1/4"}, {ChallengeRating: "1/4"}, {ChallengeRating: "1/4"}, {ChallengeRating: "1/4"}}
+	result := rateEncounterDifficulty("2014", goblins, []int{2, 2, 2, 2})
+	if result.Multiplier != 2 || result.AdjustedXP != 400 || result.Rating != "medium" {
+		t.Fatalf("4 гоблина ×2 = 400 против порогов 200/400/600/800: %+v", result)
+	}
+	result = rateEncounterDifficulty("2014", goblins[:1], []int{1, 1})
+	if result.Multiplier != 1.5 || result.AdjustedXP != 75 || result.Rating != "easy" {
+		t.Fatalf("маленький отряд сдвигает множитель вверх: %+v", result)
+	}
+	result = rateEncounterDifficulty("2014", goblins[:1], []int{1, 1, 1, 1, 1, 1})
+	if result.Multiplier != 0.5 || result.Rating != "trivial" {
+		t.Fatalf("большой отряд сдвигает множитель вниз: %+v", result)
+	}
+}
+
+func TestEncounterGetRejectsUnknownDifficultyMethod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/encounters/:id", (&EncounterController{}).Get)
+	for _, method := range []string{"2030", "dmg", "2024%20"} {
+		request := httptest.NewRequest(http.MethodGet, "/encounters/00000000-0000-4000-8000-000000000001?difficulty_method="+method, nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("difficulty_method=%q: status %d, want 400", method, response.Code)
+		}
+	}
+}
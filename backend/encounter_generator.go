@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Случайный подбор столкновения из каталога статблоков. Бюджет опыта берётся
+// по методу 2024 года: состав должен уложиться в бюджет выбранной сложности и
+// быть не легче предыдущей ступени. Генерация детерминирована зерном —
+// одно и то же зерно с тем же каталогом даёт те же составы.
+
+const maxEncounterGenerateBodyBytes = 8 << 10
+
+const (
+	defaultEncounterLineups     = 3
+	defaultEncounterMaxMonsters = 8
+	encounterGenerateAttempts   = 20
+)
+
+// EncounterGenerateRequest — отряд (персонажи или группа), целевая сложность,
+// фильтры каталога и зерно. Spawn — номер состава, который сразу
+// превращается в новый бой.
+type EncounterGenerateRequest struct {
+	CharacterIDs  []uuid.UUID `json:"character_ids" binding:"max=20"`
+	GroupID       *uuid.UUID  `json:"group_id"`
+	Difficulty    string      `json:"difficulty" binding:"required,oneof=low moderate high"`
+	CreatureTypes []string    `json:"creature_types" binding:"max=20"`
+	Tags          []string    `json:"tags" binding:"max=20"`
+	Seed          *int64      `json:"seed"`
+	Count         int         `json:"count" binding:"omitempty,min=1,max=10"`
+	MaxMonsters   int         `json:"max_monsters" binding:"omitempty,min=1,max=20"`
+	Spawn         *int        `json:"spawn" binding:"omitempty,min=0"`
+	Name          string      `json:"name" binding:"max=255"`
+	HP            string      `json:"hp" binding:"omitempty,oneof=average rolled"`
+}
+
+// EncounterLineupMonster — одна позиция состава: статблок и число копий.
+type EncounterLineupMonster struct {
+	MonsterID       uuid.UUID `json:"monster_id"`
+	Name            string    `json:"name"`
+	ChallengeRating string    `json:"challenge_rating"`
+	XP              int       `json:"xp"`
+	Count           int       `json:"count"`
+}
+
+// EncounterLineup — подобранный состав с оценкой сложности.
+type EncounterLineup struct {
+	Monsters   []EncounterLineupMonster `json:"monsters"`
+	TotalXP    int                      `json:"total_xp"`
+	Difficulty EncounterDifficulty      `json:"difficulty"`
+}
+
+// encounterXPWindow — допустимый опыт состава: не больше бюджета выбранной
+// ступени и больше бюджета предыдущей (для низкой — не меньше половины её
+// бюджета), чтобы оценка состава совпала с запрошенной.
+func encounterXPWindow(budget map[string]int, difficulty string) (int, int) {
+	switch difficulty {
+	case "high":
+		return budget["moderate"] + 1, budget["high"]
+	case "moderate":
+		return budget["low"] + 1, budget["moderate"]
+	default:
+		return budget["low"] / 2, budget["low"]
+	}
+}
+
+// generateEncounterLineups собирает до count различных составов: случайный
+// «вожак», затем добор существ, пока остаётся бюджет. Попытки, не
+// дотянувшие до нижней границы, и повторы отбрасываются.
+func generateEncounterLineups(candidates []Monster, levels []int, difficulty string, count, maxMonsters int, rng diceRNG) []EncounterLineup {
+	floor, ceiling := encounterXPWindow(rateEncounterDifficulty("2024", nil, levels).Budget, difficulty)
+	type candidate struct {
+		monster Monster
+		xp      int
+	}
+	var pool []candidate
+	for _, monster := range candidates {
+		key, ok := challengeRatingKey(monster.ChallengeRating)
+		if xp := challengeRatingXP[key]; ok && xp > 0 && xp <= ceiling {
+			pool = append(pool, candidate{monster: monster, xp: xp})
+		}
+	}
+	sort.Slice(pool, func(i, j int) bool { return pool[i].monster.ID.String() < pool[j].monster.ID.String() })
+
+	lineups := []EncounterLineup{}
+	seen := map[string]bool{}
+	for attempt := 0; attempt < count*encounterGenerateAttempts && len(lineups) < count && len(pool) > 0; attempt++ {
+		leader := pool[rng.Intn(len(pool))]
+		picked := []candidate{leader}
+		total := leader.xp
+		for len(picked) < maxMonsters {
+			if total >= floor && rng.Intn(3) == 0 {
+				break
+			}
+			var fits []candidate
+			for _, option := range pool {
+				if total+option.xp <= ceiling {
+					fits = append(fits, option)
+				}
+			}
+			if len(fits) == 0 {
+				break
+			}
+			// Половина добора — копии уже выбранных существ, чтобы составы
+			// выглядели как стая, а не как случайная выборка каталога.
+			next := fits[rng.Intn(len(fits))]
+			if rng.Intn(2) == 0 {
+				if kin := picked[rng.Intn(len(picked))]; total+kin.xp <= ceiling {
+					next = kin
+				}
+			}
+			picked = append(picked, next)
+			total += next.xp
+		}
+		if total < floor {
+			continue
+		}
+
+		counts := map[uuid.UUID]int{}
+		var order []candidate
+		var rated []encounterDifficultyMonster
+		for _, entry := range picked {
+			if counts[entry.monster.ID] == 0 {
+				order = append(order, entry)
+			}
+			counts[entry.monster.ID]++
+			rated = append(rated, encounterDifficultyMonster{Name: entry.monster.Name, ChallengeRating: entry.monster.ChallengeRating})
+		}
+		sort.SliceStable(order, func(i, j int) bool { return order[i].xp > order[j].xp })
+		lineup := EncounterLineup{TotalXP: total, Difficulty: rateEncounterDifficulty("2024", rated, levels)}
+		keys := make([]string, 0, len(order))
+		for _, entry := range order {
+			lineup.Monsters = append(lineup.Monsters, EncounterLineupMonster{
+				MonsterID:       entry.monster.ID,
+				Name:            entry.monster.Name,
+				ChallengeRating: entry.monster.ChallengeRating,
+				XP:              entry.xp,
+				Count:           counts[entry.monster.ID],
+			})
+			keys = append(keys, fmt.Sprintf("%s×%d", entry.monster.ID, counts[entry.monster.ID]))
+		}
+		sort.Strings(keys)
+		if key := strings.Join(keys, ","); !seen[key] {
+			seen[key] = true
+			lineups = append(lineups, lineup)
+		}
+	}
+	return lineups
+}
+
+// monsterInstanceHP — хиты экземпляра: средние статблока или брошенные по
+// кости хитов (без кости хитов — средние).
+func monsterInstanceHP(monster Monster, rolled bool, rng diceRNG) int {
+	hp := monster.MaxHP
+	if rolled && monster.HitDice != "" {
+		if total, err := rollDiceTotal(rng, monster.HitDice); err == nil {
+			hp = total
+		}
+	}
+	if hp < 1 {
+		hp = 1
+	}
+	return hp
+}
+
+// encounterMonsterSpawn — одна позиция выставляемых существ: статблок,
+// число копий, способ хитов, скрытность и начальные состояния с источником.
+type encounterMonsterSpawn struct {
+	MonsterID  uuid.UUID
+	Count      int
+	RolledHP   bool
+	Hidden     bool
+	Conditions []string
+	Source     string
+}
+
+// encounterCopyNumber разбирает имя участника: «Гоблин» — номер 0,
+// «Гоблин 3» — номер 3; чужое имя — false.
+func encounterCopyNumber(name, base string) (int, bool) {
+	if name == base {
+		return 0, true
+	}
+	suffix := strings.TrimPrefix(name, base+" ")
+	if suffix == name || suffix == "" {
+		return 0, false
+	}
+	number := 0
+	for _, digit := range suffix {
+		if digit < '0' || digit > '9' {
+			return 0, false
+		}
+		number = number*10 + int(digit-'0')
+	}
+	return number, number > 0
+}
+
+// encounterMonsterCombatants — существа как участники боя: КЗ, хиты,
+// скорость и действия берутся из статблока. Копии нумеруются по имени
+// через весь бой: номера продолжают уже стоящих в нём участников, а
+// единственное существо с таким именем остаётся без номера. Уже стоящие
+// участники не переименовываются.
+func encounterMonsterCombatants(spawns []encounterMonsterSpawn, monsters map[uuid.UUID]Monster, existing []map[string]interface{}, rng diceRNG) []map[string]interface{} {
+	added := map[string]int{}
+	for _, spawn := range spawns {
+		added[monsters[spawn.MonsterID].Name] += spawn.Count
+	}
+	present := map[string]int{}
+	next := map[string]int{}
+	for name := range added {
+		for _, combatant := range existing {
+			current, _ := combatant["name"].(string)
+			if number, ok := encounterCopyNumber(current, name); ok {
+				present[name]++
+				if number == 0 {
+					number = 1
+				}
+				if number > next[name] {
+					next[name] = number
+				}
+			}
+		}
+	}
+
+	combatants := []map[string]interface{}{}
+	for _, spawn := range spawns {
+		monster := monsters[spawn.MonsterID]
+		actionIDs := []interface{}{}
+		if monster.ActionIDs != nil {
+			for _, actionID := range *monster.ActionIDs {
+				actionIDs = append(actionIDs, actionID)
+			}
+		}
+		for i := 0; i < spawn.Count; i++ {
+			name := monster.Name
+			if added[name]+present[name] > 1 {
+				next[name]++
+				name = fmt.Sprintf("%s %d", monster.Name, next[name])
+			}
+			effects := []interface{}{}
+			for _, condition := range spawn.Conditions {
+				effects = append(effects, map[string]interface{}{
+					"id": "template-" + uuid.NewString(), "name": condition, "source": spawn.Source,
+					"mechanics": map[string]interface{}{"kind": "condition", "value": condition},
+				})
+			}
+			hp := monsterInstanceHP(monster, spawn.RolledHP, rng)
+			combatant := map[string]interface{}{
+				"actorId":       uuid.NewString(),
+				"name":          name,
+				"isMonster":     true,
+				"monsterId":     monster.ID.String(),
+				"hp":            hp,
+				"maxHp":         hp,
+				"ac":            monster.ArmorClass,
+				"speed":         monster.Speed,
+				"actionIds":     actionIDs,
+				"temp":          0,
+				"activeEffects": effects,
+				"avatarUrl":     monster.TokenURL,
+			}
+			if spawn.Hidden {
+				combatant["hidden"] = true
+			}
+			combatants = append(combatants, combatant)
+		}
+	}
+	return combatants
+}
+
+// encounterLineupSpawns — позиции подобранного состава для
+// encounterMonsterCombatants.
+func encounterLineupSpawns(lineup EncounterLineup, rolled bool) []encounterMonsterSpawn {
+	spawns := make([]encounterMonsterSpawn, 0, len(lineup.Monsters))
+	for _, entry := range lineup.Monsters {
+		spawns = append(spawns, encounterMonsterSpawn{MonsterID: entry.MonsterID, Count: entry.Count, RolledHP: rolled})
+	}
+	return spawns
+}
+
+// Generate — POST /api/encounters/generate. Без spawn возвращает составы и
+// зерно; со spawn создаёт новый бой вызывающего с выбранным составом.
+func (ec *EncounterController) Generate(c *gin.Context) {
+	var req EncounterGenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	levels, err := encounterPartyLevels(ec.db, caller, req.CharacterIDs, req.GroupID)
+	if err != nil {
+		writeEncounterError(c, err, "не удалось подобрать столкновение")
+		return
+	}
+
+	query := ec.db.Model(&Monster{})
+	if len(req.CreatureTypes) > 0 {
+		types := make([]string, 0, len(req.CreatureTypes))
+		for _, creatureType := range req.CreatureTypes {
+			types = append(types, strings.ToLower(strings.TrimSpace(creatureType)))
+		}
+		query = query.Where("LOWER(creature_type) IN ?", types)
+	}
+	if len(req.Tags) > 0 {
+		// Существо должно нести все перечисленные метки.
+		for _, tag := range req.Tags {
+			query = query.Where("tags @> jsonb_build_array(?::text)", strings.ToLower(strings.TrimSpace(tag)))
+		}
+	}
+	var candidates []Monster
+	if err := query.Find(&candidates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось подобрать столкновение"})
+		return
+	}
+
+	seed := time.Now().UnixNano()&(1<<53-1) | 1
+	if req.Seed != nil && *req.Seed != 0 {
+		seed = *req.Seed
+	}
+	count, maxMonsters := req.Count, req.MaxMonsters
+	if count == 0 {
+		count = defaultEncounterLineups
+	}
+	if maxMonsters == 0 {
+		maxMonsters = defaultEncounterMaxMonsters
+	}
+	rng := newDiceRNG(seed)
+	lineups := generateEncounterLineups(candidates, levels, req.Difficulty, count, maxMonsters, rng)
+	if len(lineups) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "в каталоге нет существ под этот бюджет", "details": fmt.Sprintf("подходящих статблоков: %d", len(candidates))})
+		return
+	}
+	if req.Spawn == nil {
+		c.JSON(http.StatusOK, gin.H{"seed": seed, "lineups": lineups})
+		return
+	}
+	if *req.Spawn >= len(lineups) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "нет состава с таким номером", "details": fmt.Sprintf("составов: %d", len(lineups))})
+		return
+	}
+
+	monsters := make(map[uuid.UUID]Monster, len(candidates))
+	for _, monster := range candidates {
+		monsters[monster.ID] = monster
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Бой"
+	}
+	lineup := lineups[*req.Spawn]
+	combatants := encounterMonsterCombatants(encounterLineupSpawns(lineup, req.HP == "rolled"), monsters, nil, rng)
+	var enc Encounter
+	err = ec.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		enc, err = spawnEncounter(tx, caller, name, combatants, fmt.Sprintf("Сгенерированный бой: %d опыта, существ — %d", lineup.TotalXP, len(combatants)))
+		return err
+	})
+	if err != nil {
+		writeEncounterError(c, err, "не удалось создать бой")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"seed": seed, "lineups": lineups, "encounter": enc})
+}
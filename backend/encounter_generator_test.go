@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerateEncounterLineupsFitBudget(t *testing.T) {
+	catalog := []Monster{
+		{ID: uuid.New(), Name: "Гоблин", ChallengeRating: "1/4"},
+		{ID: uuid.New(), Name: "Волк", ChallengeRating: "1/4"},
+		{ID: uuid.New(), Name: "Багбир", ChallengeRating: "1"},
+		{ID: uuid.New(), Name: "Молодой дракон", ChallengeRating: "9"},
+		{ID: uuid.New(), Name: "Тень", ChallengeRating: "?"},
+	}
+	levels := []int{3, 3, 3, 3}
+	lineups := generateEncounterLineups(catalog, levels, "moderate", 3, 8, newDiceRNG(42))
+	if len(lineups) == 0 {
+		t.Fatal("каталог позволяет собрать умеренное столкновение")
+	}
+	seen := map[string]bool{}
+	for _, lineup := range lineups {
+		if lineup.TotalXP <= 600 || lineup.TotalXP > 900 || lineup.Difficulty.Rating != "moderate" {
+			t.Fatalf("умеренный состав укладывается между бюджетами 600 и 900: %+v", lineup)
+		}
+		key := ""
+		for _, entry := range lineup.Monsters {
+			if entry.Name == "Молодой дракон" || entry.Name == "Тень" {
+				t.Fatalf("дракон дороже бюджета, тень без CR: %+v", lineup)
+			}
+			key += entry.MonsterID.String() + string(rune('0'+entry.Count))
+		}
+		if seen[key] {
+			t.Fatalf("составы не повторяются: %+v", lineups)
+		}
+		seen[key] = true
+	}
+
+	again := generateEncounterLineups(catalog, levels, "moderate", 3, 8, newDiceRNG(42))
+	if len(again) != len(lineups) || again[0].TotalXP != lineups[0].TotalXP || again[0].Monsters[0].MonsterID != lineups[0].Monsters[0].MonsterID {
+		t.Fatalf("то же зерно — те же составы: %+v / %+v", lineups, again)
+	}
+	if none := generateEncounterLineups(catalog[3:], levels, "low", 3, 8, newDiceRNG(42)); len(none) != 0 {
+		t.Fatalf("без подходящих существ составов нет: %+v", none)
+	}
+}
+
+func TestEncounterLineupCombatantsHP(t *testing.T) {
+	goblin := Monster{ID: uuid.New(), Name: "Гоблин", ChallengeRating: "1/4", ArmorClass: 15, MaxHP: 7, HitDice: "2d6"}
+	lineup := EncounterLineup{Monsters: []EncounterLineupMonster{{MonsterID: goblin.ID, Count: 2}}}
+	monsters := map[uuid.UUID]Monster{goblin.ID: goblin}
+
+	average := encounterMonsterCombatants(encounterLineupSpawns(lineup, false), monsters, nil, scripted(t))
+	first := average[0]
+	if len(average) != 2 || first["name"] != "Гоблин 1" || first["hp"] != 7 || first["ac"] != 15 || first["monsterId"] != goblin.ID.String() {
+		t.Fatalf("копии нумеруются и получают средние хиты: %+v", average)
+	}
+	if first["speed"] != goblin.Speed || first["actionIds"] == nil {
+		t.Fatalf("скорость и действия статблока, чтобы монстр мог действовать: %+v", first)
+	}
+	rolled := encounterMonsterCombatants(encounterLineupSpawns(lineup, true), monsters, nil, scripted(t, 1, 2, 6, 6))
+	if rolled[0]["hp"] != 3 || rolled[1]["maxHp"] != 12 {
+		t.Fatalf("хиты брошены по кости хитов: %+v", rolled)
+	}
+}
+
+func TestEncounterMonsterCombatantsNumberAcrossEncounter(t *testing.T) {
+	goblin := Monster{ID: uuid.New(), Name: "Гоблин", MaxHP: 7}
+	wolf := Monster{ID: uuid.New(), Name: "Волк", MaxHP: 11}
+	monsters := map[uuid.UUID]Monster{goblin.ID: goblin, wolf.ID: wolf}
+	names := func(combatants []map[string]interface{}) []interface{} {
+		var out []interface{}
+		for _, combatant := range combatants {
+			out = append(out, combatant["name"])
+		}
+		return out
+	}
+
+	spawns := []encounterMonsterSpawn{{MonsterID: goblin.ID, Count: 2}, {MonsterID: wolf.ID, Count: 1}, {MonsterID: goblin.ID, Count: 1}}
+	got := names(encounterMonsterCombatants(spawns, monsters, nil, scripted(t)))
+	if fmt.Sprint(got) != "[Гоблин 1 Гоблин 2 Волк Гоблин 3]" {
+		t.Fatalf("номера сквозные по имени, одиночка без номера: %v", got)
+	}
+
+	existing := []map[string]interface{}{{"name": "Гоблин"}, {"name": "Волк 4"}, {"name": "Гоблинша"}, {"name": "Гоблин Шаман"}}
+	got = names(encounterMonsterCombatants(spawns[:2], monsters, existing, scripted(t)))
+	if fmt.Sprint(got) != "[Гоблин 2 Гоблин 3 Волк 5]" {
+		t.Fatalf("номера продолжают уже стоящих в бою участников: %v", got)
+	}
+}
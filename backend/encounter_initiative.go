@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Серверная инициатива онлайн-боя: мастер просит бросок, сервер бросает d20 +
+// бонус инициативы за каждого участника, сортирует список и начинает первый
+// раунд — одной операцией боя. Опоздавшие бросают отдельно и встают в уже
+// идущий порядок, не сбивая текущий ход.
+
+const maxEncounterInitiativeBodyBytes = 4 << 10
+
+// EncounterInitiativeRequest — бросок инициативы. Пустой actor_ids — бросок за
+// всех и начало первого раунда; иначе бросают только названные участники
+// (присоединившиеся к идущему бою).
+type EncounterInitiativeRequest struct {
+	ExpectedSeq *int64   `json:"expected_seq"`
+	ActorIDs    []string `json:"actor_ids" binding:"max=100"`
+	// Advantage — внешнее преимущество/помеха по actorId (решение мастера);
+	// особенности и состояния участников сервер учитывает сам.
+	Advantage map[string]string `json:"advantage"`
+}
+
+// initiativeConditionAdvantage — состояния, влияющие на бросок инициативы
+// (зеркало INIT в frontend/src/engine/conditions.ts).
+var initiativeConditionAdvantage = map[string]string{
+	"invisible":     "advantage",
+	"incapacitated": "disadvantage",
+	"paralyzed":     "disadvantage",
+	"petrified":     "disadvantage",
+	"stunned":       "disadvantage",
+	"unconscious":   "disadvantage",
+}
+
+// encounterInitiativeEntrant — участник, бросающий инициативу.
+type encounterInitiativeEntrant struct {
+	ActorID   string
+	Name      string
+	Bonus     int
+	Dex       int
+	Advantage string
+}
+
+// encounterInitiativeRoll — итог броска участника.
+type encounterInitiativeRoll struct {
+	ActorID string     `json:"actor_id"`
+	Name    string     `json:"name"`
+	Total   int        `json:"total"`
+	Dex     int        `json:"dex"`
+	Roll    EngineRoll `json:"roll"`
+}
+
+// rollEncounterInitiative бросает инициативу и сортирует итоги: больший итог
+// ходит раньше, при равенстве — большая Ловкость, дальше — прежний порядок.
+func rollEncounterInitiative(entrants []encounterInitiativeEntrant, rng diceRNG) []encounterInitiativeRoll {
+	rolls := make([]encounterInitiativeRoll, 0, len(entrants))
+	for _, entrant := range entrants {
+		var modifiers []EngineRollModifier
+		if entrant.Bonus != 0 {
+			modifiers = []EngineRollModifier{{Value: entrant.Bonus, Source: "инициатива"}}
+		}
+		roll, _ := rollD20Test(rng, "d20", entrant.Advantage, modifiers, nil)
+		rolls = append(rolls, encounterInitiativeRoll{ActorID: entrant.ActorID, Name: entrant.Name, Total: roll.Total, Dex: entrant.Dex, Roll: roll})
+	}
+	sort.SliceStable(rolls, func(i, j int) bool {
+		if rolls[i].Total != rolls[j].Total {
+			return rolls[i].Total > rolls[j].Total
+		}
+		return rolls[i].Dex > rolls[j].Dex
+	})
+	return rolls
+}
+
+// insertEncounterInitiative встраивает отсортированные броски опоздавших в
+// идущий порядок: каждый встаёт перед первым участником с меньшей
+// инициативой (участники без инициативы считаются последними), при равенстве —
+// после уже стоящих. Возвращает новый порядок и индекс, сохраняющий ход за
+// текущим активным участником.
+func insertEncounterInitiative(combatants []map[string]interface{}, activeIndex int, rolls []encounterInitiativeRoll) ([]string, int) {
+	joining := make(map[string]bool, len(rolls))
+	for _, roll := range rolls {
+		joining[roll.ActorID] = true
+	}
+	activeID := ""
+	if activeIndex >= 0 && activeIndex < len(combatants) {
+		activeID = stringField(combatants[activeIndex], "actorId")
+	}
+
+	type slot struct {
+		actorID    string
+		initiative int
+		rolled     bool
+	}
+	var order []slot
+	for _, combatant := range combatants {
+		actorID := stringField(combatant, "actorId")
+		if joining[actorID] {
+			continue
+		}
+		value, rolled := mechanicsNumber(combatant["initiative"])
+		order = append(order, slot{actorID: actorID, initiative: int(value), rolled: rolled})
+	}
+	for _, roll := range rolls {
+		at := len(order)
+		for i, existing := range order {
+			if !existing.rolled || existing.initiative < roll.Total {
+				at = i
+				break
+			}
+		}
+		order = append(order[:at], append([]slot{{actorID: roll.ActorID, initiative: roll.Total, rolled: true}}, order[at:]...)...)
+	}
+
+	actorIDs := make([]string, len(order))
+	nextIndex := activeIndex
+	for i, entry := range order {
+		actorIDs[i] = entry.actorID
+		if entry.actorID == activeID {
+			nextIndex = i
+		}
+	}
+	return actorIDs, nextIndex
+}
+
+// initiativeAdvantageOps собирает преимущество/помеху инициативы из
+// modifier-payload-ов (applies_to.roll initiative или d20); модификаторы с
+// when требуют обстоятельств и здесь не учитываются.
+func initiativeAdvantageOps(payloads []map[string]interface{}) []string {
+	var ops []string
+	for _, payload := range payloads {
+		if payload["kind"] != "modifier" || stringFieldOr(payload, "scope", "self") == "target" {
+			continue
+		}
+		if when, ok := payload["when"].([]interface{}); ok && len(when) > 0 {
+			continue
+		}
+		applies, _ := payload["applies_to"].(map[string]interface{})
+		if roll := stringField(applies, "roll"); roll != "initiative" && roll != "d20" {
+			continue
+		}
+		if op := stringField(payload, "op"); oneOf(op, "advantage", "disadvantage") {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// mechanicsPassivePayloads раскрывает auto-интеракции механики в payload-ы;
+// строка активного эффекта может сама быть payload-ом.
+func mechanicsPassivePayloads(mechanics JSONMap) []map[string]interface{} {
+	if mechanics == nil {
+		return nil
+	}
+	if _, ok := mechanics["kind"].(string); ok {
+		return []map[string]interface{}{mechanics}
+	}
+	var payloads []map[string]interface{}
+	for _, interaction := range mechanicsInteractions(mechanics) {
+		if interaction["resolution"] == "auto" {
+			payloads = append(payloads, mechanicsPayloadList(interaction["result"])...)
+		}
+	}
+	return payloads
+}
+
+// encounterInitiativeEntrantOf собирает бонус, Ловкость и преимущество
+// участника: персонаж — сохранённый InitiativeBonus и его особенности,
+// существо — бонус статблока (без него — модификатор ЛВК) и пассивы,
+// существо мастера без статблока — чистый d20.
+func encounterInitiativeEntrantOf(tx *gorm.DB, combatant map[string]interface{}, characters map[uuid.UUID]CharacterV3, advantage string) (encounterInitiativeEntrant, error) {
+	actor, monster, err := encounterCombatantActor(tx, combatant, characters)
+	if err != nil {
+		return encounterInitiativeEntrant{}, err
+	}
+	entrant := encounterInitiativeEntrant{ActorID: actor.ID, Name: actor.Name, Dex: 10}
+	if score, ok := actor.Abilities["dex"]; ok {
+		entrant.Dex = score
+	}
+	ops := []string{advantage}
+	var payloads []map[string]interface{}
+	if characterID, err := uuid.Parse(stringField(combatant, "characterId")); err == nil {
+		character := characters[characterID]
+		entrant.Bonus = character.InitiativeBonus
+		input, err := loadCharacterDerivationInput(tx, character)
+		if err != nil {
+			return entrant, err
+		}
+		derivation := deriveCharacterStats(input)
+		payloads = append(append(payloads, derivation.passive...), derivation.runtime...)
+	} else if monster != nil {
+		entrant.Bonus = monster.InitiativeBonus
+		if entrant.Bonus == 0 {
+			entrant.Bonus = actor.abilityModifier("dex")
+		}
+		if monster.EffectIDs != nil && len(*monster.EffectIDs) > 0 {
+			var effects []Effect
+			if err := tx.Where("id IN ?", []string(*monster.EffectIDs)).Find(&effects).Error; err != nil {
+				return entrant, err
+			}
+			for _, effect := range effects {
+				if effect.Mechanics != nil {
+					payloads = append(payloads, mechanicsPassivePayloads(*effect.Mechanics)...)
+				}
+			}
+		}
+	}
+	for _, effect := range encounterCombatantEffects(combatant) {
+		if mechanics, ok := effect["mechanics"].(map[string]interface{}); ok {
+			payloads = append(payloads, mechanicsPassivePayloads(JSONMap(mechanics))...)
+		}
+	}
+	ops = append(ops, initiativeAdvantageOps(payloads)...)
+	for condition := range actor.Conditions {
+		ops = append(ops, initiativeConditionAdvantage[condition])
+	}
+	entrant.Advantage = combineAdvantage(ops...)
+	return entrant, nil
+}
+
+// Initiative бросает инициативу участников боя (только мастер боя).
+func (ec *EncounterController) Initiative(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req EncounterInitiativeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if req.ExpectedSeq == nil || *req.ExpectedSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	for actorID, advantage := range req.Advantage {
+		if !oneOf(advantage, "none", "advantage", "disadvantage") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": "advantage." + actorID + ": ожидается none, advantage или disadvantage"})
+			return
+		}
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	var newState JSONMap
+	var newSeq int64
+	var rolls []encounterInitiativeRoll
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if caller != enc.OwnerUserID {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "бросать инициативу может только мастер боя"}
+		}
+		if enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		if len(combatants) == 0 {
+			return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "в бою нет участников"}
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, true)
+		if err != nil {
+			return err
+		}
+
+		rolling := combatants
+		if len(req.ActorIDs) > 0 {
+			byID := make(map[string]map[string]interface{}, len(combatants))
+			for _, combatant := range combatants {
+				byID[stringField(combatant, "actorId")] = combatant
+			}
+			rolling = make([]map[string]interface{}, 0, len(req.ActorIDs))
+			named := make(map[string]bool, len(req.ActorIDs))
+			for _, actorID := range req.ActorIDs {
+				combatant, exists := byID[actorID]
+				if !exists {
+					return &encounterAccessError{Status: http.StatusNotFound, Message: "участник боя не найден"}
+				}
+				if !named[actorID] {
+					named[actorID] = true
+					rolling = append(rolling, combatant)
+				}
+			}
+		}
+		entrants := make([]encounterInitiativeEntrant, 0, len(rolling))
+		for _, combatant := range rolling {
+			entrant, err := encounterInitiativeEntrantOf(tx, combatant, characters, req.Advantage[stringField(combatant, "actorId")])
+			if err != nil {
+				return err
+			}
+			entrants = append(entrants, entrant)
+		}
+		rolls = rollEncounterInitiative(entrants, newDiceRNG(0))
+
+		op := ApplyRequest{}
+		if len(req.ActorIDs) == 0 {
+			round, activeIndex := 1, 0
+			op.Round, op.ActiveIndex, op.restartsTurnOrder = &round, &activeIndex, true
+			for _, roll := range rolls {
+				op.Order = append(op.Order, roll.ActorID)
+			}
+		} else {
+			turn := encounterTurnOf(state)
+			order, activeIndex := insertEncounterInitiative(combatants, turn.ActiveIndex, rolls)
+			op.Order = order
+			if activeIndex != turn.ActiveIndex {
+				op.ActiveIndex = &activeIndex
+			}
+		}
+		names := make([]string, 0, len(rolls))
+		for _, roll := range rolls {
+			op.Patches = append(op.Patches, CombatantPatch{ActorID: roll.ActorID, Set: JSONMap{"initiative": roll.Total}})
+			entry := BattleLogEntry{Message: fmt.Sprintf("%s: Инициатива, %s", roll.Name, roll.Roll.Text)}
+			if characterID := stringField(encounterCombatantByID(state, roll.ActorID), "characterId"); characterID != "" {
+				entry.TargetCharacterID, entry.Type = characterID, "roll"
+				entry.Payload = JSONMap{"type": "roll", "label": "Инициатива", "roll": map[string]interface{}(roll.Roll.toJSONMap())}
+			}
+			op.Log = append(op.Log, entry)
+			names = append(names, fmt.Sprintf("%s (%d)", roll.Name, roll.Total))
+		}
+		if len(req.ActorIDs) == 0 {
+			op.Log = append(op.Log, BattleLogEntry{Message: "Раунд 1. Порядок хода: " + strings.Join(names, ", ")})
+		} else {
+			op.Log = append(op.Log, BattleLogEntry{Message: "В порядок хода встают: " + strings.Join(names, ", ")})
+		}
+
+		committed, err := commitEncounterOp(tx, &enc, state, op, characters)
+		if err != nil {
+			return err
+		}
+		newState, newSeq = committed, enc.Seq
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось бросить инициативу")
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), newSeq)
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": newSeq, "state": &newState, "initiative": rolls})
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestRollEncounterInitiative(t *testing.T) {
+	entrants := []encounterInitiativeEntrant{
+		{ActorID: "goblin", Name: "Гоблин", Bonus: 2, Dex: 14},
+		{ActorID: "fighter", Name: "Воин", Bonus: 1, Dex: 12},
+		{ActorID: "rogue", Name: "Плут", Bonus: 4, Dex: 18, Advantage: "advantage"},
+		{ActorID: "ogre", Name: "Огр", Bonus: -1, Dex: 8},
+	}
+	rolls := rollEncounterInitiative(entrants, scripted(t, 10, 11, 3, 9, 13))
+	order := []string{}
+	for _, roll := range rolls {
+		order = append(order, roll.ActorID)
+	}
+	if len(order) != 4 || order[0] != "rogue" || order[1] != "goblin" || order[2] != "fighter" || order[3] != "ogre" {
+		t.Fatalf("больший итог ходит раньше, ничья — по Ловкости: %v", order)
+	}
+	if rolls[0].Total != 13 || len(rolls[0].Roll.Dice) != 2 {
+		t.Fatalf("преимущество бросает два d20 и берёт больший: %+v", rolls[0])
+	}
+}
+
+func TestInsertEncounterInitiative(t *testing.T) {
+	ranked := func(id string, initiative float64) map[string]interface{} {
+		c := combatant(id, 10)
+		c["initiative"] = initiative
+		return c
+	}
+	combatants := []map[string]interface{}{ranked("a", 18), ranked("b", 12), ranked("c", 7), combatant("late", 10), combatant("summon", 10)}
+	rolls := []encounterInitiativeRoll{{ActorID: "late", Total: 15}, {ActorID: "summon", Total: 12}}
+
+	order, active := insertEncounterInitiative(combatants, 1, rolls)
+	want := []string{"a", "late", "b", "summon", "c"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("опоздавшие встают по инициативе, при равенстве — после стоящих: %v", order)
+		}
+	}
+	if active != 2 {
+		t.Fatalf("ход остаётся за b: %d", active)
+	}
+
+	state := map[string]interface{}{"combatants": []interface{}{combatants[0], combatants[1], combatants[2], combatants[3], combatants[4]}, "round": float64(2), "activeIndex": float64(1)}
+	previous := encounterTurnOf(state)
+	next := encounterTurnOf(applyOps(state, ApplyRequest{Order: order, ActiveIndex: &active}))
+	if next.ActorID != "b" || next.advancedFrom(previous) {
+		t.Fatalf("вставка не передаёт ход и не тикает эффекты: %+v", next)
+	}
+}
+
+func TestInitiativeAdvantageOps(t *testing.T) {
+	payloads := []map[string]interface{}{
+		{"kind": "modifier", "applies_to": map[string]interface{}{"roll": "initiative"}, "op": "advantage"},
+		{"kind": "modifier", "applies_to": map[string]interface{}{"roll": "initiative"}, "op": "add", "value": "+5"},
+		{"kind": "modifier", "applies_to": map[string]interface{}{"roll": "attack"}, "op": "disadvantage"},
+		{"kind": "modifier", "applies_to": map[string]interface{}{"roll": "initiative"}, "op": "disadvantage", "when": []interface{}{"surprised"}},
+	}
+	if ops := initiativeAdvantageOps(payloads); len(ops) != 1 || ops[0] != "advantage" {
+		t.Fatalf("только безусловное преимущество инициативы: %v", ops)
+	}
+}
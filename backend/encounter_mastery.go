@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Искусность оружия (Weapon Mastery, PHB 2024) в онлайн-бою. Оружие хранит id
+// эффекта-мастерства (Card.Mastery или weapon_profile.mastery_effect_id),
+// персонаж выбирает виды оружия особенностью «Искусное владение оружием»
+// (choice с grant weapon_mastery, выбор — в ResolvedChoices). Атака таким
+// оружием исполняет свойство на исходе броска тем же интерпретатором механик;
+// каждое сработавшее свойство оставляет запись журнала.
+
+// characterWeaponMasteries — виды оружия, выбранные персонажем для
+// искусности (collectWeaponMastery клиента): payload-ы weapon_mastery
+// пассивных источников с подставленными выборами.
+func characterWeaponMasteries(derivation CharacterDerivation) []string {
+	masteries := []string{}
+	for _, payload := range derivation.passive {
+		if payload["kind"] != "weapon_mastery" {
+			continue
+		}
+		value := strings.TrimSpace(stringFieldOr(payload, "value", stringField(payload, "weapon_type")))
+		if value != "" && !containsString(masteries, value) {
+			masteries = append(masteries, value)
+		}
+	}
+	return masteries
+}
+
+// loadCharacterWeaponMastery загружает эффект искусности оружия, если
+// персонаж выбрал его вид. nil — искусности нет: у оружия нет мастерства или
+// вида, вид не выбран, эффект не найден.
+func loadCharacterWeaponMastery(tx *gorm.DB, character CharacterV3, weapon encounterWeapon) (*Effect, error) {
+	effectID, err := uuid.Parse(weapon.Mastery)
+	if err != nil || weapon.WeaponType == "" {
+		return nil, nil
+	}
+	input, err := loadCharacterDerivationInput(tx, character)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(characterWeaponMasteries(deriveCharacterStats(input)), weapon.WeaponType) {
+		return nil, nil
+	}
+	var effect Effect
+	if err := tx.First(&effect, "id = ?", effectID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &effect, nil
+}
+
+// encounterMasteryFacts — факты атаки, от которых зависит свойство: оружие,
+// цель и её размер, нанесён ли урон.
+type encounterMasteryFacts struct {
+	Weapon      encounterWeapon
+	TargetID    string
+	TargetSize  int
+	DealtDamage bool
+}
+
+// encounterWeaponMastery — свойство, готовое к исполнению. Event — исход
+// броска, на котором оно срабатывает (hit или miss; пусто — правило без
+// серверного исхода, как Быстрое).
+type encounterWeaponMastery struct {
+	Name      string
+	Event     string
+	Mechanics JSONMap
+}
+
+// compileEncounterWeaponMastery переводит эффект искусности в механику.
+// Типизированный примитив weapon_mastery компилируется как
+// compileWeaponMasteryEffects клиента; механика старого вида
+// (activation.trigger.event + effects) берётся как есть. Тип урона "weapon"
+// заменяется основным типом урона оружия.
+func compileEncounterWeaponMastery(effect Effect, facts encounterMasteryFacts) encounterWeaponMastery {
+	mastery := encounterWeaponMastery{Name: effect.Name}
+	if effect.Mechanics == nil {
+		return mastery
+	}
+	mechanics := *effect.Mechanics
+	damageType := ""
+	if len(facts.Weapon.Damage) > 0 {
+		damageType = facts.Weapon.Damage[0].Type
+	}
+
+	primitive, typed := mechanics["weapon_mastery"].(map[string]interface{})
+	if !typed {
+		activation, _ := mechanics["activation"].(map[string]interface{})
+		if stringFieldOr(activation, "mode", "triggered") == "passive" {
+			return mastery
+		}
+		trigger, _ := activation["trigger"].(map[string]interface{})
+		mastery.Event = "hit"
+		if trigger["event"] == "miss" {
+			mastery.Event = "miss"
+		}
+		interactions := []interface{}{}
+		for _, interaction := range mechanicsInteractions(mechanics) {
+			interactions = append(interactions, masteryInteractionDamageType(interaction, damageType))
+		}
+		mastery.Mechanics = JSONMap{"effects": interactions}
+		return mastery
+	}
+
+	auto := func(who string, payloads ...interface{}) {
+		interaction := map[string]interface{}{"resolution": "auto", "result": payloads}
+		if who != "" {
+			interaction["who"] = who
+		}
+		mastery.Event = "hit"
+		mastery.Mechanics = JSONMap{"effects": []interface{}{interaction}}
+	}
+	requiresDamage := primitive["requiresDamage"] == true
+	switch stringField(primitive, "type") {
+	case "topple":
+		mastery.Event = "hit"
+		mastery.Mechanics = JSONMap{"effects": []interface{}{map[string]interface{}{
+			"resolution": "save", "who": "target", "ability": primitive["saveAbility"], "dc": primitive["dc"],
+			"on_fail":    []interface{}{map[string]interface{}{"kind": "condition", "value": primitive["condition"]}},
+			"on_success": []interface{}{},
+		}}}
+	case "sap":
+		auto("target", map[string]interface{}{
+			"kind": "modifier", "applies_to": map[string]interface{}{"roll": "attack"}, "op": "disadvantage",
+			"consume": primitive["consume"], "duration": masteryDeclaredDuration(primitive["expires"]),
+			"stack_id": "weapon-mastery:sap", "stack_type": "overwrite",
+		})
+	case "slow":
+		if requiresDamage && !facts.DealtDamage {
+			return mastery
+		}
+		penalty, _ := mechanicsNumber(primitive["penaltyFt"])
+		auto("target", map[string]interface{}{
+			"kind": "modifier", "applies_to": map[string]interface{}{"roll": "speed"}, "op": "add",
+			"value": fmt.Sprint(-int(math.Abs(penalty))), "duration": masteryDeclaredDuration(primitive["expires"]),
+			"stack_id": "weapon-mastery:slow", "stack_type": "overwrite",
+		})
+	case "vex":
+		if requiresDamage && !facts.DealtDamage {
+			return mastery
+		}
+		appliesTo := map[string]interface{}{"roll": "attack"}
+		stackID := "weapon-mastery:vex"
+		if primitive["targetLocked"] == true {
+			appliesTo["filter"] = map[string]interface{}{"targetActorId": facts.TargetID}
+			stackID += ":" + facts.TargetID
+		}
+		auto("", map[string]interface{}{
+			"kind": "modifier", "applies_to": appliesTo, "op": "advantage",
+			"consume": primitive["consume"], "duration": masteryDeclaredDuration(primitive["expires"]),
+			"stack_id": stackID, "stack_type": "overwrite",
+		})
+	case "push":
+		if facts.TargetSize > characterSizeCategory(stringField(primitive, "maxTargetSize")) {
+			return mastery
+		}
+		auto("target", map[string]interface{}{"kind": "movement", "value": "push", "distance": primitive["maxDistanceFt"]})
+	case "graze":
+		auto("target", map[string]interface{}{"kind": "damage", "amount": primitive["damage"], "type": damageType})
+		mastery.Event = "miss"
+	case "cleave":
+		if facts.Weapon.Ranged {
+			return mastery
+		}
+		distance, _ := mechanicsNumber(primitive["secondaryWithinPrimaryFt"])
+		auto("", map[string]interface{}{"kind": "narrative", "description": fmt.Sprintf(
+			"можно атаковать этим оружием второе существо в пределах %d фт. от цели; урон без модификатора характеристики", int(distance))})
+	}
+	return mastery
+}
+
+// masteryDeclaredDuration — declaredDuration клиента: срок примитива в
+// duration payload-а.
+func masteryDeclaredDuration(expires interface{}) map[string]interface{} {
+	switch expires {
+	case "end_of_source_next_turn":
+		return map[string]interface{}{"type": "until_end_of_source_next_turn"}
+	case "end_of_turn":
+		return map[string]interface{}{"type": "until_end_of_turn"}
+	}
+	return map[string]interface{}{"type": "until_start_of_source_next_turn"}
+}
+
+// masteryInteractionDamageType копирует интеракцию, подставляя тип урона
+// оружия вместо "weapon" в payload-ах её веток.
+func masteryInteractionDamageType(interaction map[string]interface{}, damageType string) map[string]interface{} {
+	copied := make(map[string]interface{}, len(interaction))
+	for key, value := range interaction {
+		copied[key] = value
+	}
+	for _, key := range []string{"result", "results", "on_hit", "on_miss", "on_fail", "on_success"} {
+		payloads := mechanicsPayloadList(interaction[key])
+		if payloads == nil {
+			continue
+		}
+		list := make([]interface{}, 0, len(payloads))
+		for _, payload := range payloads {
+			if payload["kind"] == "damage" && payload["type"] == "weapon" {
+				replaced := make(map[string]interface{}, len(payload))
+				for field, value := range payload {
+					replaced[field] = value
+				}
+				replaced["type"] = damageType
+				payload = replaced
+			}
+			list = append(list, payload)
+		}
+		copied[key] = list
+	}
+	return copied
+}
+
+// encounterStateAfter — копия состояния боя с применёнными патчами: по ней
+// считается следующая часть операции, чтобы её патчи не затирали списки
+// предыдущих.
+func encounterStateAfter(state map[string]interface{}, patches []CombatantPatch) map[string]interface{} {
+	copied := map[string]interface{}{}
+	if b, err := json.Marshal(state); err == nil {
+		_ = json.Unmarshal(b, &copied)
+	}
+	if len(patches) == 0 {
+		return copied
+	}
+	return applyOps(copied, ApplyRequest{Patches: patches})
+}
+
+func encounterCombatantByID(state map[string]interface{}, actorID string) map[string]interface{} {
+	combatants, _ := state["combatants"].([]interface{})
+	for _, item := range combatants {
+		if combatant, ok := item.(map[string]interface{}); ok && stringField(combatant, "actorId") == actorID {
+			return combatant
+		}
+	}
+	return nil
+}
+
+// encounterNarrativeEntry — запись журнала: персонажу она адресуется
+// событием narrative, иначе остаётся общей строкой.
+func encounterNarrativeEntry(state map[string]interface{}, actorID, message, text string) BattleLogEntry {
+	entry := BattleLogEntry{Message: message}
+	if characterID := stringField(encounterCombatantByID(state, actorID), "characterId"); characterID != "" {
+		entry.TargetCharacterID, entry.Type = characterID, "narrative"
+		entry.Payload = JSONMap{"type": "narrative", "text": text}
+	}
+	return entry
+}
+
+// attackMarkOp — op отметки на бросок атаки (modifier applies_to.roll
+// attack с op advantage/disadvantage), подходящей к цели targetID; пусто —
+// эффект не отметка или относится к другой цели.
+func attackMarkOp(effect map[string]interface{}, targetID string) string {
+	mechanics, _ := effect["mechanics"].(map[string]interface{})
+	appliesTo, _ := mechanics["applies_to"].(map[string]interface{})
+	op := stringField(mechanics, "op")
+	if mechanics["kind"] != "modifier" || appliesTo["roll"] != "attack" || !oneOf(op, "advantage", "disadvantage") {
+		return ""
+	}
+	filter, _ := appliesTo["filter"].(map[string]interface{})
+	if locked := stringField(filter, "targetActorId"); locked != "" && locked != targetID {
+		return ""
+	}
+	return op
+}
+
+// consumeEncounterAttackMarks собирает отметки атакующего на бросок атаки по
+// цели: Ослабляющее даёт помеху, Отвлекающее — преимущество по своей цели.
+// Отметки с consume:"next" снимаются этой атакой (патч и запись журнала).
+func consumeEncounterAttackMarks(state map[string]interface{}, attackerID, targetID string) (string, []CombatantPatch, []BattleLogEntry) {
+	combatant := encounterCombatantByID(state, attackerID)
+	existing, _ := combatant["activeEffects"].([]interface{})
+	kept := make([]interface{}, 0, len(existing))
+	var sources []string
+	var log []BattleLogEntry
+	for _, raw := range existing {
+		effect, ok := raw.(map[string]interface{})
+		op := ""
+		if ok {
+			op = attackMarkOp(effect, targetID)
+		}
+		if op == "" {
+			kept = append(kept, raw)
+			continue
+		}
+		sources = append(sources, op)
+		mechanics, _ := effect["mechanics"].(map[string]interface{})
+		if mechanics["consume"] != "next" {
+			kept = append(kept, raw)
+			continue
+		}
+		label := "помеха"
+		if op == "advantage" {
+			label = "преимущество"
+		}
+		text := fmt.Sprintf("«%s»: %s на этот бросок атаки, отметка снята", stringField(effect, "name"), label)
+		log = append(log, encounterNarrativeEntry(state, attackerID, fmt.Sprintf("%s: %s", stringFieldOr(combatant, "name", attackerID), text), text))
+	}
+	if len(log) == 0 {
+		return combineAdvantage(sources...), nil, nil
+	}
+	return combineAdvantage(sources...), []CombatantPatch{{ActorID: attackerID, Set: JSONMap{"activeEffects": kept}}}, log
+}
+
+// runEncounterWeaponMastery исполняет сработавшее свойство искусности.
+// Спасброски (Опрокидывающее) открываются целям отложенными, прочие
+// интеракции исполняются сразу: урон — как урон атаки, модификаторы
+// становятся активными эффектами со сроком от хода атакующего (одинаковый
+// stack_id перезаписывается), толчок остаётся указанием в журнале — позиций
+// сервер не хранит. Свойство всегда оставляет запись журнала.
+func runEncounterWeaponMastery(state map[string]interface{}, attacker, target mechanicsActor, weaponMod int, mastery encounterWeaponMastery, rng diceRNG) ([]CombatantPatch, []BattleLogEntry, error) {
+	var saves, autos []interface{}
+	for _, interaction := range mechanicsInteractions(mastery.Mechanics) {
+		if interaction["resolution"] == "save" {
+			saves = append(saves, interaction)
+		} else {
+			autos = append(autos, interaction)
+		}
+	}
+	invocation := mechanicsInvocation{
+		Source: mastery.Name, Actor: attacker, Targets: []mechanicsActor{target}, RNG: rng, WeaponMod: weaponMod,
+	}
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	var notes []string
+
+	if len(saves) > 0 {
+		invocation.Mechanics = JSONMap{"effects": saves}
+		pending, err := interpretMechanicsSaves(invocation)
+		if err != nil {
+			return nil, nil, err
+		}
+		savePatches, saveLog := openEncounterSaves(state, attacker, mastery.Name, pending)
+		patches, log = append(patches, savePatches...), append(log, saveLog...)
+		notes = append(notes, fmt.Sprintf("спасбросок %s СЛ %d", abilityLabel(pending[0].Ability), pending[0].DC))
+	}
+
+	if len(autos) > 0 {
+		invocation.Mechanics = JSONMap{"effects": autos}
+		result, err := interpretMechanics(invocation)
+		if err != nil {
+			return nil, nil, err
+		}
+		damage := MechanicsResult{}
+		for _, outcome := range result.Outcomes {
+			if (outcome.Kind == "damage" && outcome.Amount > 0) || outcome.Kind == "condition" || outcome.Kind == "condition_immune" {
+				damage.Outcomes = append(damage.Outcomes, outcome)
+			}
+			if outcome.Kind == "damage" && outcome.Amount > 0 {
+				notes = append(notes, fmt.Sprintf("%d урона (%s)", outcome.Amount, outcome.DamageType))
+			}
+		}
+		damagePatches, damageLog := resolveEncounterAttack(state, attacker, mastery.Name, damage)
+		patches, log = append(patches, damagePatches...), append(log, damageLog...)
+
+		staged := encounterStateAfter(state, patches)
+		effects := map[string][]interface{}{}
+		var order, described, narratives []string
+		for _, outcome := range result.Outcomes {
+			recipient := encounterCombatantByID(staged, outcome.TargetID)
+			if recipient == nil {
+				continue
+			}
+			name := stringFieldOr(recipient, "name", outcome.TargetID)
+			switch outcome.Kind {
+			case "modifier":
+				if _, seen := effects[outcome.TargetID]; !seen {
+					existing, _ := recipient["activeEffects"].([]interface{})
+					effects[outcome.TargetID] = append([]interface{}{}, existing...)
+					order = append(order, outcome.TargetID)
+				}
+				effects[outcome.TargetID] = masteryModifierEffects(effects[outcome.TargetID], attacker.ID, target.ID, mastery.Name, outcome)
+				described = append(described, masteryModifierNote(outcome, name, stringField(encounterCombatantByID(staged, target.ID), "name")))
+			case "movement":
+				described = append(described, fmt.Sprintf("можно оттолкнуть %s на %d фт. по прямой", name, outcome.Amount))
+			case "narrative":
+				if text := stringFieldOr(outcome.Payload, "description", outcome.Value); text != "" {
+					narratives = append(narratives, text)
+				}
+			}
+		}
+		// Описание из контента точнее собранного по исходам.
+		if len(narratives) > 0 {
+			described = narratives
+		}
+		notes = append(notes, described...)
+		for _, actorID := range order {
+			patches = append(patches, CombatantPatch{ActorID: actorID, Set: JSONMap{"activeEffects": effects[actorID]}})
+		}
+	}
+
+	if len(notes) == 0 {
+		notes = append(notes, "без эффекта")
+	}
+	text := fmt.Sprintf("Искусность «%s»: %s", mastery.Name, strings.Join(notes, "; "))
+	log = append(log, encounterNarrativeEntry(state, attacker.ID, fmt.Sprintf("%s: %s", attacker.Name, text), text))
+	return patches, log, nil
+}
+
+// masteryModifierEffects добавляет получателю модификатор свойства активным
+// эффектом. Срок «до начала/конца следующего хода» отсчитывается от хода
+// атакующего (sourceTurnExpiry), в раундах — тикает на ходу владельца.
+// Отметка преимущества на атакующем без фильтра привязывается к цели атаки.
+func masteryModifierEffects(effects []interface{}, attackerID, targetID, name string, outcome MechanicsOutcome) []interface{} {
+	mechanics := make(map[string]interface{}, len(outcome.Payload))
+	for key, value := range outcome.Payload {
+		if key != "duration" {
+			mechanics[key] = value
+		}
+	}
+	appliesTo, _ := mechanics["applies_to"].(map[string]interface{})
+	if outcome.TargetID == attackerID && appliesTo["roll"] == "attack" && mechanics["op"] == "advantage" && appliesTo["filter"] == nil {
+		locked := map[string]interface{}{"filter": map[string]interface{}{"targetActorId": targetID}}
+		for key, value := range appliesTo {
+			locked[key] = value
+		}
+		mechanics["applies_to"] = locked
+		if stackID := stringField(mechanics, "stack_id"); stackID != "" {
+			mechanics["stack_id"] = stackID + ":" + targetID
+		}
+	}
+	if appliesTo["roll"] == "attack" && mechanics["consume"] == nil {
+		mechanics["consume"] = "next"
+	}
+
+	effect := map[string]interface{}{
+		"id": "mastery-" + uuid.NewString(), "name": name, "source": name,
+		"sourceId": attackerID, "ownerId": outcome.TargetID, "mechanics": mechanics,
+	}
+	duration, _ := outcome.Payload["duration"].(map[string]interface{})
+	boundary := ""
+	switch duration["type"] {
+	case "until_start_of_next_turn", "until_start_of_source_next_turn":
+		boundary = "start"
+	case "until_end_of_source_next_turn":
+		boundary = "end"
+	case "until_end_of_turn":
+		effect["expiry"] = "end_of_turn"
+	default:
+		if rounds, ok := durationRounds(duration); ok {
+			effect["roundsLeft"] = float64(rounds)
+		}
+	}
+	if boundary != "" {
+		effect["sourceTurnExpiry"] = map[string]interface{}{
+			"sourceActorId": attackerID, "ownerActorId": outcome.TargetID, "boundary": boundary,
+		}
+	}
+
+	stackID := stringField(mechanics, "stack_id")
+	kept := make([]interface{}, 0, len(effects)+1)
+	for _, raw := range effects {
+		if existing, ok := raw.(map[string]interface{}); ok && stackID != "" {
+			if existingMechanics, _ := existing["mechanics"].(map[string]interface{}); stringField(existingMechanics, "stack_id") == stackID {
+				continue
+			}
+		}
+		kept = append(kept, raw)
+	}
+	return append(kept, effect)
+}
+
+func masteryModifierNote(outcome MechanicsOutcome, recipient, target string) string {
+	switch {
+	case outcome.Value == "attack" && outcome.Op == "disadvantage":
+		return fmt.Sprintf("%s совершает следующий бросок атаки с помехой", recipient)
+	case outcome.Value == "attack" && outcome.Op == "advantage":
+		return fmt.Sprintf("преимущество на следующий бросок атаки по %s", target)
+	case outcome.Value == "speed":
+		return fmt.Sprintf("Скорость %s %+d фт.", recipient, outcome.Amount)
+	}
+	return fmt.Sprintf("%s: модификатор %s", recipient, outcome.Value)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCharacterWeaponMasteries(t *testing.T) {
+	effectID := uuid.New().String()
+	character := derivationTestCharacter(t, 1, `{"str":16,"dex":10,"con":10,"int":10,"wis":10,"cha":10}`,
+		`{"class:fighter:`+effectID+`:weapon-mastery":["longsword","handaxe"]}`)
+	input := derivationTestInput(character)
+	input.Passive = []characterMechanicsSource{{Key: "class:fighter:" + effectID, Mechanics: mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[{"kind":"choice","id":"weapon-mastery","count":2,"options":{"source":"weapon"},"grant":{"kind":"weapon_mastery"}}]}`)}}
+	masteries := characterWeaponMasteries(deriveCharacterStats(input))
+	if len(masteries) != 2 || masteries[0] != "longsword" || masteries[1] != "handaxe" {
+		t.Fatalf("chosen weapon types must become masteries, got %v", masteries)
+	}
+}
+
+func TestCompileEncounterWeaponMastery(t *testing.T) {
+	weapon := encounterWeapon{Name: "Секира", Damage: []encounterWeaponDamage{{Dice: "1d12", Type: "slashing"}}}
+	graze := Effect{Name: "Задевающее", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"triggered","trigger":{"event":"miss"}},"effects":[{"resolution":"auto","who":"target","result":[{"kind":"damage","amount":"weapon_mod","type":"weapon"}]}]}`))}
+	compiled := compileEncounterWeaponMastery(graze, encounterMasteryFacts{Weapon: weapon})
+	payload := mechanicsPayloadList(mechanicsInteractions(compiled.Mechanics)[0]["result"])[0]
+	if compiled.Event != "miss" || payload["type"] != "slashing" {
+		t.Fatalf("legacy graze must trigger on miss with the weapon damage type: %+v", compiled)
+	}
+	if (*graze.Mechanics)["effects"].([]interface{})[0].(map[string]interface{})["result"].([]interface{})[0].(map[string]interface{})["type"] != "weapon" {
+		t.Fatal("compiling must not mutate the stored effect")
+	}
+
+	nick := Effect{Name: "Быстрое", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[{"resolution":"auto","result":[{"kind":"narrative","description":"правило"}]}]}`))}
+	if compiled := compileEncounterWeaponMastery(nick, encounterMasteryFacts{Weapon: weapon}); compiled.Event != "" {
+		t.Fatalf("passive masteries have no server rider: %+v", compiled)
+	}
+
+	vex := Effect{Name: "Отвлекающее", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"vex","consume":"next","targetLocked":true,"requiresDamage":true,"expires":"end_of_source_next_turn"}}`))}
+	if compiled := compileEncounterWeaponMastery(vex, encounterMasteryFacts{Weapon: weapon, TargetID: "goblin"}); compiled.Event != "" {
+		t.Fatal("vex requires damage")
+	}
+	compiled = compileEncounterWeaponMastery(vex, encounterMasteryFacts{Weapon: weapon, TargetID: "goblin", DealtDamage: true})
+	payload = mechanicsPayloadList(mechanicsInteractions(compiled.Mechanics)[0]["result"])[0]
+	if compiled.Event != "hit" || payload["stack_id"] != "weapon-mastery:vex:goblin" {
+		t.Fatalf("typed vex must lock onto the target: %+v", payload)
+	}
+
+	push := Effect{Name: "Отталкивающее", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"push","maxDistanceFt":10,"maxTargetSize":"large","choiceId":"push"}}`))}
+	if compiled := compileEncounterWeaponMastery(push, encounterMasteryFacts{Weapon: weapon, TargetSize: characterSizeCategory("huge")}); compiled.Event != "" {
+		t.Fatal("huge targets cannot be pushed")
+	}
+}
+
+func ptrJSONMap(value JSONMap) *JSONMap {
+	return &value
+}
+
+func TestEncounterWeaponMasteryRiders(t *testing.T) {
+	fighter := combatant("fighter", 30)
+	fighter["characterId"] = uuid.NewString()
+	goblin := combatant("goblin", 7)
+	state := map[string]interface{}{"combatants": []interface{}{fighter, goblin}}
+	attacker := newMechanicsActor("fighter", "fighter")
+	attacker.ProficiencyBonus = 2
+	target := newMechanicsActor("goblin", "goblin")
+	weapon := encounterWeapon{Name: "Секира", Damage: []encounterWeaponDamage{{Dice: "1d12", Type: "slashing"}}}
+
+	graze := compileEncounterWeaponMastery(Effect{Name: "Задевающее", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"graze","damage":"weapon_mod","choiceId":"graze"}}`))},
+		encounterMasteryFacts{Weapon: weapon})
+	patches, log, err := runEncounterWeaponMastery(state, attacker, target, 3, graze, newDiceRNG(1))
+	if err != nil || len(patches) != 1 || patches[0].Set["hp"] != 4 {
+		t.Fatalf("graze deals the weapon modifier on a miss: %+v %v", patches, err)
+	}
+	last := log[len(log)-1]
+	if last.Type != "narrative" || last.TargetCharacterID != fighter["characterId"] || !strings.Contains(last.Message, "3 урона (slashing)") {
+		t.Fatalf("every rider must leave a journal entry for the attacker: %+v", last)
+	}
+
+	sap := compileEncounterWeaponMastery(Effect{Name: "Ослабляющее", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"sap","consume":"next","expires":"start_of_source_next_turn"}}`))},
+		encounterMasteryFacts{Weapon: weapon})
+	patches, _, err = runEncounterWeaponMastery(state, attacker, target, 3, sap, newDiceRNG(1))
+	if err != nil || len(patches) != 1 || patches[0].ActorID != "goblin" {
+		t.Fatalf("sap marks the target: %+v %v", patches, err)
+	}
+	marked := encounterStateAfter(state, patches)
+	effect := encounterCombatantEffects(encounterCombatantByID(marked, "goblin"))[0]
+	lifecycle := effect["sourceTurnExpiry"].(map[string]interface{})
+	if lifecycle["sourceActorId"] != "fighter" || lifecycle["boundary"] != "start" || !validActiveEffectValue(effect) {
+		t.Fatalf("sap lasts until the start of the attacker's next turn: %+v", effect)
+	}
+	patches, _, _ = runEncounterWeaponMastery(marked, attacker, target, 3, sap, newDiceRNG(1))
+	if effects := patches[0].Set["activeEffects"].([]interface{}); len(effects) != 1 {
+		t.Fatalf("repeated sap overwrites its mark: %+v", effects)
+	}
+
+	advantage, consumed, consumeLog := consumeEncounterAttackMarks(marked, "goblin", "fighter")
+	if advantage != "disadvantage" || len(consumed) != 1 || len(consumed[0].Set["activeEffects"].([]interface{})) != 0 || len(consumeLog) != 1 {
+		t.Fatalf("the marked creature's next attack has disadvantage and spends the mark: %s %+v", advantage, consumed)
+	}
+
+	topple := compileEncounterWeaponMastery(Effect{Name: "Опрокидывающее", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"topple","saveAbility":"con","dc":"8+prof+weapon_mod","condition":"prone","choiceId":"topple"}}`))},
+		encounterMasteryFacts{Weapon: weapon})
+	patches, log, err = runEncounterWeaponMastery(state, attacker, target, 3, topple, newDiceRNG(1))
+	if err != nil || len(patches) != 1 {
+		t.Fatalf("topple opens a pending save: %+v %v", patches, err)
+	}
+	save := patches[0].Set["pendingSaves"].([]interface{})[0].(map[string]interface{})
+	if save["dc"] != float64(13) || save["ability"] != "con" || !strings.Contains(log[len(log)-1].Message, "СЛ 13") {
+		t.Fatalf("topple DC is 8 + proficiency + weapon modifier: %+v", save)
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ход существа по профилю Monster.AI: сервер перезаряжает способности,
+// выбирает цель и действие и собирает ход в операцию боя с объяснением в
+// журнале. Без execute ход только предлагается: ответ несёт план, готовую
+// операцию и seed бросков — подтверждение мастером с тем же seed и той же
+// версией боя исполняет ровно показанный ход.
+
+const maxEncounterMonsterTurnBodyBytes = 4 << 10
+
+// EncounterMonsterTurnRequest — предложить или исполнить ход существа.
+// action_id/target_id — поправки мастера к выбору планировщика.
+type EncounterMonsterTurnRequest struct {
+	ExpectedSeq *int64     `json:"expected_seq"`
+	ActorID     string     `json:"actor_id" binding:"required"`
+	Execute     bool       `json:"execute"`
+	Seed        *int64     `json:"seed"`
+	ActionID    *uuid.UUID `json:"action_id"`
+	TargetID    string     `json:"target_id"`
+}
+
+// monsterAITargetPriorities — критерии выбора цели и их подписи для журнала.
+var monsterAITargetPriorities = map[string]string{
+	"lowest_hp":     "меньше всего хитов",
+	"highest_hp":    "больше всего хитов",
+	"lowest_ac":     "самый низкий КД",
+	"highest_ac":    "самый высокий КД",
+	"bloodied":      "ранена",
+	"concentrating": "держит концентрацию",
+}
+
+// monsterAIProfile — разобранный Monster.AI:
+//
+//	{"strategy":"melee_chase","target_priority":["concentrating","lowest_hp"],
+//	 "preferred_actions":["<action id>"],"retreat_below":0.25,
+//	 "recharge":{"<action id>":5}}
+//
+// retreat_below — доля максимума хитов, ниже которой существо отступает;
+// recharge — минимальный d6 перезарядки действия (иначе берётся
+// Action.RechargeCustom вида «5–6»).
+type monsterAIProfile struct {
+	Strategy         string
+	TargetPriority   []string
+	PreferredActions []string
+	RetreatBelow     float64
+	Recharge         map[string]int
+}
+
+func parseMonsterAIProfile(ai *JSONMap) monsterAIProfile {
+	profile := monsterAIProfile{Strategy: "melee_chase", Recharge: map[string]int{}}
+	if ai == nil {
+		profile.TargetPriority = []string{"lowest_hp"}
+		return profile
+	}
+	profile.Strategy = stringFieldOr(*ai, "strategy", profile.Strategy)
+	if priorities, ok := (*ai)["target_priority"].([]interface{}); ok {
+		for _, raw := range priorities {
+			if key, ok := raw.(string); ok && monsterAITargetPriorities[key] != "" {
+				profile.TargetPriority = append(profile.TargetPriority, key)
+			}
+		}
+	}
+	if len(profile.TargetPriority) == 0 {
+		profile.TargetPriority = []string{"lowest_hp"}
+	}
+	if preferred, ok := (*ai)["preferred_actions"].([]interface{}); ok {
+		for _, raw := range preferred {
+			if actionID, ok := raw.(string); ok && actionID != "" {
+				profile.PreferredActions = append(profile.PreferredActions, actionID)
+			}
+		}
+	}
+	if value, ok := mechanicsNumber((*ai)["retreat_below"]); ok && value > 0 && value < 1 {
+		profile.RetreatBelow = value
+	}
+	if recharge, ok := (*ai)["recharge"].(map[string]interface{}); ok {
+		for actionID, raw := range recharge {
+			if value, ok := mechanicsNumber(raw); ok && value >= 2 && value <= 6 {
+				profile.Recharge[actionID] = int(value)
+			}
+		}
+	}
+	return profile
+}
+
+// monsterAIProfileIssue проверяет профиль ИИ статблока; пусто — профиль годен.
+func monsterAIProfileIssue(ai JSONMap, actionIDs Properties) string {
+	owned := map[string]bool{}
+	for _, actionID := range actionIDs {
+		owned[actionID] = true
+	}
+	if raw, exists := ai["target_priority"]; exists {
+		priorities, ok := raw.([]interface{})
+		if !ok {
+			return "target_priority должен быть списком"
+		}
+		for _, priority := range priorities {
+			key, _ := priority.(string)
+			if monsterAITargetPriorities[key] == "" {
+				return fmt.Sprintf("Неизвестный приоритет цели %v", priority)
+			}
+		}
+	}
+	if raw, exists := ai["preferred_actions"]; exists {
+		preferred, ok := raw.([]interface{})
+		if !ok {
+			return "preferred_actions должен быть списком"
+		}
+		for _, actionID := range preferred {
+			if id, _ := actionID.(string); !owned[id] {
+				return "preferred_actions может ссылаться только на действия монстра"
+			}
+		}
+	}
+	if raw, exists := ai["retreat_below"]; exists {
+		if value, ok := mechanicsNumber(raw); !ok || value < 0 || value >= 1 {
+			return "retreat_below должен быть долей хитов от 0 до 1"
+		}
+	}
+	if raw, exists := ai["recharge"]; exists {
+		recharge, ok := raw.(map[string]interface{})
+		if !ok {
+			return "recharge должен быть объектом действие → минимальный d6"
+		}
+		for actionID, value := range recharge {
+			if number, ok := mechanicsNumber(value); !owned[actionID] || !ok || number < 2 || number > 6 || number != math.Trunc(number) {
+				return "recharge: действие монстра и минимальный d6 от 2 до 6"
+			}
+		}
+	}
+	return ""
+}
+
+var actionRechargePattern = regexp.MustCompile(`^\s*(?:перезарядка|recharge)?\s*([2-6])\s*(?:[-–—]\s*6)?\s*$`)
+
+// monsterActionRecharge — как возвращается действие после использования:
+// минимальный d6 перезарядки (0 — не перезаряжается) и once — действие
+// раз за бой.
+func monsterActionRecharge(action Action, profile monsterAIProfile) (int, bool) {
+	if value, ok := profile.Recharge[action.ID.String()]; ok {
+		return value, false
+	}
+	if action.Recharge == nil {
+		return 0, false
+	}
+	switch *action.Recharge {
+	case RechargePerBattle, RechargeShortRest, RechargeLongRest:
+		return 0, true
+	case RechargeCustom:
+		if action.RechargeCustom != nil {
+			if match := actionRechargePattern.FindStringSubmatch(strings.ToLower(*action.RechargeCustom)); match != nil {
+				value, _ := strconv.Atoi(match[1])
+				return value, false
+			}
+		}
+	}
+	return 0, false
+}
+
+// monsterActionKind — чем действие разрешается на сервере: "attack" (бросок
+// атаки), "save" (спасбросок цели) или пусто, если исполнить его нельзя.
+func monsterActionKind(action Action) string {
+	if action.Mechanics == nil {
+		return ""
+	}
+	if hasAttackRollInteraction(*action.Mechanics) {
+		return "attack"
+	}
+	for _, interaction := range mechanicsInteractions(*action.Mechanics) {
+		if interaction["resolution"] == "save" {
+			return "save"
+		}
+	}
+	return ""
+}
+
+// monsterTurnPlan — решение планировщика с объяснением.
+type monsterTurnPlan struct {
+	ActorID    string   `json:"actor_id"`
+	ActionID   string   `json:"action_id,omitempty"`
+	ActionName string   `json:"action_name,omitempty"`
+	TargetID   string   `json:"target_id,omitempty"`
+	Retreat    bool     `json:"retreat"`
+	Recharged  []string `json:"recharged,omitempty"`
+	Rationale  []string `json:"rationale"`
+	Seed       int64    `json:"seed"`
+
+	action   *Action
+	spent    []string
+	recharge []BattleLogEntry
+}
+
+// planMonsterTurn выбирает ход существа: перезаряжает потраченные способности
+// бросками d6, при хитах ниже порога отступает, иначе выбирает цель по
+// приоритетам профиля и действие — предпочтённое, готовое перезаряжаемое или
+// первое исполнимое. override — поправки мастера.
+func planMonsterTurn(state map[string]interface{}, actorID string, profile monsterAIProfile, actions []Action, override EncounterMonsterTurnRequest, rng diceRNG) (monsterTurnPlan, error) {
+	self := encounterCombatantByID(state, actorID)
+	name := stringFieldOr(self, "name", actorID)
+	plan := monsterTurnPlan{ActorID: actorID, Rationale: []string{}}
+
+	spent := map[string]bool{}
+	if raw, ok := self["spentActions"].([]interface{}); ok {
+		for _, actionID := range raw {
+			if text, ok := actionID.(string); ok {
+				spent[text] = true
+			}
+		}
+	}
+	for _, action := range actions {
+		id := action.ID.String()
+		if !spent[id] {
+			continue
+		}
+		minimum, _ := monsterActionRecharge(action, profile)
+		if minimum == 0 {
+			continue
+		}
+		roll := rollDie(rng, 6)
+		verdict := "не перезарядилось"
+		if roll >= minimum {
+			delete(spent, id)
+			plan.Recharged = append(plan.Recharged, id)
+			verdict = "готово"
+		}
+		plan.recharge = append(plan.recharge, BattleLogEntry{Message: fmt.Sprintf("%s: перезарядка «%s» (%d–6), d6 = %d — %s", name, action.Name, minimum, roll, verdict)})
+	}
+	for _, action := range actions {
+		if spent[action.ID.String()] {
+			plan.spent = append(plan.spent, action.ID.String())
+		}
+	}
+
+	hp, _ := mechanicsNumber(self["hp"])
+	maxHP, _ := mechanicsNumber(self["maxHp"])
+	if profile.RetreatBelow > 0 && maxHP > 0 && hp < maxHP*profile.RetreatBelow && override.ActionID == nil {
+		plan.Retreat = true
+		plan.Rationale = append(plan.Rationale, fmt.Sprintf("хиты %d/%d ниже порога %d%% — отступает", int(hp), int(maxHP), int(math.Round(profile.RetreatBelow*100))))
+		return plan, nil
+	}
+
+	var targets []map[string]interface{}
+	combatants, _ := state["combatants"].([]interface{})
+	for _, raw := range combatants {
+		combatant, ok := raw.(map[string]interface{})
+		if !ok || stringField(combatant, "actorId") == actorID {
+			continue
+		}
+		if override.TargetID != "" {
+			if stringField(combatant, "actorId") == override.TargetID {
+				targets = append(targets, combatant)
+			}
+			continue
+		}
+		if value, _ := mechanicsNumber(combatant["hp"]); stringField(combatant, "characterId") != "" && value > 0 {
+			targets = append(targets, combatant)
+		}
+	}
+	if len(targets) == 0 {
+		if override.TargetID != "" {
+			return plan, &encounterAccessError{Status: http.StatusNotFound, Message: "цель не найдена в бою"}
+		}
+		plan.Rationale = append(plan.Rationale, "нет доступных целей — пропускает ход")
+		return plan, nil
+	}
+	concentrating := encounterConcentrations(state)
+	criterion := func(key string, combatant map[string]interface{}) float64 {
+		hp, _ := mechanicsNumber(combatant["hp"])
+		maxHP, _ := mechanicsNumber(combatant["maxHp"])
+		ac, _ := mechanicsNumber(combatant["ac"])
+		switch key {
+		case "lowest_hp":
+			return hp
+		case "highest_hp":
+			return -hp
+		case "lowest_ac":
+			return ac
+		case "highest_ac":
+			return -ac
+		case "bloodied":
+			if maxHP > 0 && hp <= maxHP/2 {
+				return 0
+			}
+			return 1
+		case "concentrating":
+			if len(concentrating[stringField(combatant, "actorId")]) > 0 {
+				return 0
+			}
+			return 1
+		}
+		return 0
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		for _, key := range profile.TargetPriority {
+			if left, right := criterion(key, targets[i]), criterion(key, targets[j]); left != right {
+				return left < right
+			}
+		}
+		return false
+	})
+	target := targets[0]
+	plan.TargetID = stringField(target, "actorId")
+	reason := "выбор мастера"
+	if override.TargetID == "" {
+		reason = "первая подходящая"
+		for _, key := range profile.TargetPriority {
+			if len(targets) == 1 || criterion(key, targets[0]) != criterion(key, targets[1]) {
+				reason = monsterAITargetPriorities[key]
+				break
+			}
+		}
+	}
+	plan.Rationale = append(plan.Rationale, fmt.Sprintf("цель — %s (%s)", stringFieldOr(target, "name", plan.TargetID), reason))
+
+	preference := make(map[string]int, len(profile.PreferredActions))
+	for i, actionID := range profile.PreferredActions {
+		preference[actionID] = i
+	}
+	type candidate struct {
+		action Action
+		rank   int
+		reason string
+	}
+	var candidates []candidate
+	for i, action := range actions {
+		id := action.ID.String()
+		if override.ActionID != nil && action.ID != *override.ActionID {
+			continue
+		}
+		if spent[id] || monsterActionKind(action) == "" {
+			continue
+		}
+		entry := candidate{action: action, rank: 2*len(actions) + i, reason: "первое исполнимое действие"}
+		if position, preferred := preference[id]; preferred {
+			entry.rank, entry.reason = position, "предпочтение профиля"
+		} else if minimum, once := monsterActionRecharge(action, profile); minimum > 0 || once {
+			entry.rank, entry.reason = len(actions)+i, "перезаряжаемая способность готова"
+		}
+		if override.ActionID != nil {
+			entry.reason = "выбор мастера"
+		}
+		candidates = append(candidates, entry)
+	}
+	if len(candidates) == 0 {
+		if override.ActionID != nil {
+			return plan, &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "действие недоступно существу: потрачено или не исполняется сервером"}
+		}
+		plan.Rationale = append(plan.Rationale, "нет исполнимых действий — пропускает ход")
+		return plan, nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].rank < candidates[j].rank })
+	chosen := candidates[0].action
+	plan.action = &chosen
+	plan.ActionID, plan.ActionName = chosen.ID.String(), chosen.Name
+	plan.Rationale = append(plan.Rationale, fmt.Sprintf("действие — «%s» (%s)", chosen.Name, candidates[0].reason))
+	if minimum, once := monsterActionRecharge(chosen, profile); minimum > 0 || once {
+		plan.spent = append(plan.spent, plan.ActionID)
+	}
+	return plan, nil
+}
+
+// monsterTurnOp собирает ход по плану в операцию боя: объяснение и
+// перезарядки в журнал, затем атака или спасбросок выбранного действия.
+func monsterTurnOp(state map[string]interface{}, plan monsterTurnPlan, actor, target mechanicsActor, rng diceRNG) (ApplyRequest, error) {
+	name := stringFieldOr(encounterCombatantByID(state, plan.ActorID), "name", plan.ActorID)
+	op := ApplyRequest{Log: []BattleLogEntry{{Message: fmt.Sprintf("%s: %s", name, strings.Join(plan.Rationale, "; "))}}}
+	op.Log = append(op.Log, plan.recharge...)
+
+	spent := make([]interface{}, len(plan.spent))
+	for i, actionID := range plan.spent {
+		spent[i] = actionID
+	}
+	previous, _ := encounterCombatantByID(state, plan.ActorID)["spentActions"].([]interface{})
+	if len(previous) != len(spent) || len(plan.Recharged) > 0 {
+		op.Patches = append(op.Patches, CombatantPatch{ActorID: plan.ActorID, Set: JSONMap{"spentActions": spent}})
+	}
+	if plan.action == nil {
+		return op, nil
+	}
+
+	invocation := mechanicsInvocation{Actor: actor, Targets: []mechanicsActor{target}, RNG: rng, Source: plan.action.Name, Mechanics: *plan.action.Mechanics}
+	switch monsterActionKind(*plan.action) {
+	case "attack":
+		advantage, markPatches, markLog := consumeEncounterAttackMarks(encounterStateAfter(state, op.Patches), actor.ID, target.ID)
+		invocation.Advantage = advantage
+		result, err := interpretMechanics(invocation)
+		if err != nil {
+			return op, err
+		}
+		patches, log := resolveEncounterAttack(encounterStateAfter(state, append(op.Patches, markPatches...)), actor, invocation.Source, result)
+		op.Patches = append(append(op.Patches, markPatches...), patches...)
+		op.Log = append(append(op.Log, markLog...), log...)
+	case "save":
+		saves, err := interpretMechanicsSaves(invocation)
+		if err != nil {
+			return op, err
+		}
+		patches, log := openEncounterSaves(encounterStateAfter(state, op.Patches), actor, invocation.Source, saves)
+		op.Patches, op.Log = append(op.Patches, patches...), append(op.Log, log...)
+	}
+	return op, nil
+}
+
+// loadMonsterActions загружает действия статблока в порядке ActionIDs.
+func loadMonsterActions(tx *gorm.DB, monster Monster) ([]Action, error) {
+	if monster.ActionIDs == nil || len(*monster.ActionIDs) == 0 {
+		return nil, nil
+	}
+	var rows []Action
+	if err := tx.Where("id IN ?", []string(*monster.ActionIDs)).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Action, len(rows))
+	for _, action := range rows {
+		byID[action.ID.String()] = action
+	}
+	actions := make([]Action, 0, len(rows))
+	for _, actionID := range *monster.ActionIDs {
+		if action, ok := byID[actionID]; ok {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+// MonsterTurn — POST /api/encounters/:id/monster-turn (только мастер боя).
+func (ec *EncounterController) MonsterTurn(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req EncounterMonsterTurnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if req.ExpectedSeq == nil || *req.ExpectedSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	// seed уходит в браузер: держим его в пределах точных чисел JavaScript.
+	seed := time.Now().UnixNano()&(1<<53-1) | 1
+	if req.Seed != nil && *req.Seed != 0 {
+		seed = *req.Seed
+	}
+
+	var newState JSONMap
+	var newSeq int64
+	var plan monsterTurnPlan
+	var op ApplyRequest
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if caller != enc.OwnerUserID {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "ходом существа управляет только мастер боя"}
+		}
+		if enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, true)
+		if err != nil {
+			return err
+		}
+		self := encounterCombatantByID(state, req.ActorID)
+		if self == nil {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "участник боя не найден"}
+		}
+		actor, monster, err := encounterCombatantActor(tx, self, characters)
+		if err != nil {
+			return err
+		}
+		if monster == nil {
+			return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "ходом без статблока существа управляет мастер"}
+		}
+		actions, err := loadMonsterActions(tx, *monster)
+		if err != nil {
+			return err
+		}
+
+		rng := newDiceRNG(seed)
+		plan, err = planMonsterTurn(state, req.ActorID, parseMonsterAIProfile(monster.AI), actions, req, rng)
+		if err != nil {
+			return err
+		}
+		plan.Seed = seed
+		var target mechanicsActor
+		if plan.action != nil {
+			if target, _, err = encounterCombatantActor(tx, encounterCombatantByID(state, plan.TargetID), characters); err != nil {
+				return err
+			}
+		}
+		if op, err = monsterTurnOp(state, plan, actor, target, rng); err != nil {
+			var mechanicsErr *mechanicsInterpretError
+			if errors.As(err, &mechanicsErr) {
+				return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "механика действия неисполнима: " + mechanicsErr.Error()}
+			}
+			return err
+		}
+		if !req.Execute {
+			newSeq = enc.Seq
+			return nil
+		}
+		committed, err := commitEncounterOp(tx, &enc, state, op, characters)
+		if err != nil {
+			return err
+		}
+		newState, newSeq = committed, enc.Seq
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось спланировать ход существа")
+		return
+	}
+	if !req.Execute {
+		c.JSON(http.StatusOK, gin.H{"seq": newSeq, "plan": plan, "op": op})
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), newSeq)
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": newSeq, "state": &newState, "plan": plan, "op": op})
+}
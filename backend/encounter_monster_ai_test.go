@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func monsterAITestActions(t *testing.T) (Action, Action) {
+	bite := Action{ID: uuid.New(), Name: "Укус", Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"effects":[{"resolution":"attack_roll","attack_kind":"weapon_melee","ability":"str","on_hit":[{"kind":"damage","dice":"1d6 + str","type":"piercing"}]}]}`))}
+	custom := ActionRecharge(RechargeCustom)
+	text := "5–6"
+	breath := Action{ID: uuid.New(), Name: "Огненное дыхание", Recharge: &custom, RechargeCustom: &text, Mechanics: ptrJSONMap(mustMechanicsJSON(t,
+		`{"effects":[{"resolution":"save","ability":"dex","dc":13,"on_fail":[{"kind":"damage","dice":"4d6","type":"fire","on_success":"half"}]}]}`))}
+	return bite, breath
+}
+
+func TestPlanMonsterTurnPicksTargetAndAction(t *testing.T) {
+	bite, breath := monsterAITestActions(t)
+	drake := combatant("drake", 30)
+	fighter, wizard := combatant("fighter", 25), combatant("wizard", 12)
+	fighter["characterId"], wizard["characterId"] = uuid.NewString(), uuid.NewString()
+	ally := combatant("wolf", 3)
+	state := map[string]interface{}{"combatants": []interface{}{drake, fighter, wizard, ally}}
+	profile := parseMonsterAIProfile(&JSONMap{"target_priority": []interface{}{"lowest_hp"}})
+
+	plan, err := planMonsterTurn(state, "drake", profile, []Action{bite, breath}, EncounterMonsterTurnRequest{}, scripted(t))
+	if err != nil || plan.TargetID != "wizard" || plan.ActionID != breath.ID.String() {
+		t.Fatalf("ready recharge ability on the weakest character: %+v %v", plan, err)
+	}
+	if len(plan.spent) != 1 || !strings.Contains(strings.Join(plan.Rationale, "; "), "меньше всего хитов") {
+		t.Fatalf("the used recharge ability is spent and the choice is explained: %+v", plan)
+	}
+
+	drake["spentActions"] = []interface{}{breath.ID.String()}
+	plan, _ = planMonsterTurn(state, "drake", profile, []Action{bite, breath}, EncounterMonsterTurnRequest{}, scripted(t, 4))
+	if plan.ActionID != bite.ID.String() || len(plan.Recharged) != 0 || len(plan.recharge) != 1 {
+		t.Fatalf("a failed recharge roll leaves the bite: %+v", plan)
+	}
+	plan, _ = planMonsterTurn(state, "drake", profile, []Action{bite, breath}, EncounterMonsterTurnRequest{}, scripted(t, 5))
+	if plan.ActionID != breath.ID.String() || len(plan.Recharged) != 1 {
+		t.Fatalf("d6 of 5 recharges the breath: %+v", plan)
+	}
+
+	preferred := parseMonsterAIProfile(&JSONMap{"preferred_actions": []interface{}{bite.ID.String()}, "target_priority": []interface{}{"highest_ac", "highest_hp"}})
+	plan, _ = planMonsterTurn(state, "drake", preferred, []Action{bite, breath}, EncounterMonsterTurnRequest{}, scripted(t, 6))
+	if plan.ActionID != bite.ID.String() || plan.TargetID != "fighter" {
+		t.Fatalf("profile preference wins over the recharged ability: %+v", plan)
+	}
+
+	drake["hp"] = float64(5)
+	coward := parseMonsterAIProfile(&JSONMap{"retreat_below": 0.25})
+	plan, _ = planMonsterTurn(state, "drake", coward, []Action{bite, breath}, EncounterMonsterTurnRequest{}, scripted(t, 1))
+	if !plan.Retreat || plan.action != nil {
+		t.Fatalf("below the threshold the creature retreats: %+v", plan)
+	}
+}
+
+func TestMonsterTurnOpExplainsAndResolves(t *testing.T) {
+	bite, _ := monsterAITestActions(t)
+	drake, fighter := combatant("drake", 30), combatant("fighter", 25)
+	fighter["characterId"] = uuid.NewString()
+	fighter["ac"] = float64(12)
+	state := map[string]interface{}{"combatants": []interface{}{drake, fighter}}
+	plan, err := planMonsterTurn(state, "drake", parseMonsterAIProfile(nil), []Action{bite}, EncounterMonsterTurnRequest{}, scripted(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker := newMechanicsActor("drake", "drake")
+	attacker.Abilities["str"] = 14
+	target := newMechanicsActor("fighter", "fighter")
+	target.ArmorClass, target.HP, target.MaxHP = 12, 25, 25
+	op, err := monsterTurnOp(state, plan, attacker, target, scripted(t, 15, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(op.Log[0].Message, "цель — fighter") || len(op.Patches) != 1 || op.Patches[0].Set["hp"] != 19 {
+		t.Fatalf("the turn explains itself and applies the bite: %+v", op)
+	}
+}
+
+func TestMonsterAIProfileIssue(t *testing.T) {
+	actions := Properties{"b1000000-0000-4000-8000-000000000001"}
+	if issue := monsterAIProfileIssue(JSONMap{"strategy": "melee_chase", "target_priority": []interface{}{"lowest_ac"}, "recharge": map[string]interface{}{actions[0]: 5.0}}, actions); issue != "" {
+		t.Fatalf("valid profile rejected: %s", issue)
+	}
+	if issue := monsterAIProfileIssue(JSONMap{"preferred_actions": []interface{}{"b1000000-0000-4000-8000-000000000002"}}, actions); issue == "" {
+		t.Fatal("preferred actions must belong to the monster")
+	}
+	if issue := monsterAIProfileIssue(JSONMap{"target_priority": []interface{}{"nearest"}}, actions); issue == "" {
+		t.Fatal("unknown target priority accepted")
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Спасброски с отложенным решением (онлайн-бой). Исполнитель save-механики
+// открывает на каждой цели pending-спасбросок: СЛ и обе ветки исходов (урон
+// бросается один раз на всех, успех — половина, где так велит механика)
+// считает сервер. Цель (её контроллер или мастер) разрешает спасбросок — бросок
+// с её модификатором и владением делает тоже сервер и применяет нужную ветку.
+// Такие строки помечены serverRolled; клиент их не разрешает сам.
+
+const maxEncounterSaveBodyBytes = 8 << 10
+
+// OpenEncounterSavesRequest — исполнить save-механику действия или заклинания
+// против целей. SlotLevel — ячейка заклинания (по умолчанию — его круг).
+type OpenEncounterSavesRequest struct {
+	ExpectedSeq *int64     `json:"expected_seq"`
+	CasterID    string     `json:"caster_id" binding:"required"`
+	TargetIDs   []string   `json:"target_ids" binding:"required,min=1,max=32,dive,required"`
+	ActionID    *uuid.UUID `json:"action_id"`
+	SpellID     *uuid.UUID `json:"spell_id"`
+	SlotLevel   int        `json:"slot_level" binding:"omitempty,min=1,max=9"`
+}
+
+// ResolveEncounterSaveRequest — разрешить открытый сервером спасбросок участника.
+type ResolveEncounterSaveRequest struct {
+	ExpectedSeq *int64 `json:"expected_seq"`
+	ActorID     string `json:"actor_id" binding:"required"`
+	SaveID      string `json:"save_id" binding:"required"`
+}
+
+// encounterSaveOutcome сворачивает исходы ветки в SaveOutcome доски: дельты
+// хитов и временных хитов от текущего состояния цели, тип основного урона и
+// наложенные состояния. Урон сначала снимает временные хиты.
+func encounterSaveOutcome(combatant map[string]interface{}, outcomes []MechanicsOutcome, source string) map[string]interface{} {
+	temp := 0
+	if value, ok := mechanicsNumber(combatant["temp"]); ok {
+		temp = int(value)
+	}
+	damage, healing, tempGain := 0, 0, 0
+	damageType := ""
+	addEffects := []interface{}{}
+	for _, outcome := range outcomes {
+		switch outcome.Kind {
+		case "damage":
+			damage += outcome.Amount
+			if damageType == "" {
+				damageType = outcome.DamageType
+			}
+		case "healing":
+			healing += outcome.Amount
+		case "temp_hp":
+			if outcome.Amount > tempGain {
+				tempGain = outcome.Amount
+			}
+		case "condition":
+			if outcome.Op != "apply" {
+				continue
+			}
+			effect := map[string]interface{}{
+				"id": "save-effect-" + uuid.NewString(), "name": outcome.Value, "source": source,
+				"mechanics": map[string]interface{}{"kind": "condition", "value": outcome.Value},
+			}
+			if outcome.RoundsLeft != nil {
+				effect["roundsLeft"] = float64(*outcome.RoundsLeft)
+			}
+			addEffects = append(addEffects, effect)
+		}
+	}
+	absorbed := damage
+	if absorbed > temp {
+		absorbed = temp
+	}
+	result := map[string]interface{}{
+		"hpDelta":   float64(healing - (damage - absorbed)),
+		"tempDelta": float64(tempGain - absorbed),
+	}
+	if damageType != "" {
+		result["damageType"] = damageType
+	}
+	if len(addEffects) > 0 {
+		result["addEffects"] = addEffects
+	}
+	return result
+}
+
+// openEncounterSaves кладёт подготовленные спасброски на цели. Несколько
+// спасбросков одной цели в одной операции сливаются в один патч.
+func openEncounterSaves(state map[string]interface{}, caster mechanicsActor, source string, saves []mechanicsPendingSave) ([]CombatantPatch, []BattleLogEntry) {
+	byID := map[string]map[string]interface{}{}
+	combatants, _ := state["combatants"].([]interface{})
+	for _, item := range combatants {
+		if combatant, ok := item.(map[string]interface{}); ok {
+			byID[stringField(combatant, "actorId")] = combatant
+		}
+	}
+	rows := map[string][]interface{}{}
+	var order []string
+	var names []string
+	for _, save := range saves {
+		combatant, exists := byID[save.TargetID]
+		if !exists {
+			continue
+		}
+		if _, seen := rows[save.TargetID]; !seen {
+			existing, _ := combatant["pendingSaves"].([]interface{})
+			rows[save.TargetID] = append([]interface{}{}, existing...)
+			order = append(order, save.TargetID)
+			names = append(names, stringFieldOr(combatant, "name", save.TargetID))
+		}
+		row := map[string]interface{}{
+			"id": "save-" + uuid.NewString(), "sourceName": caster.Name, "actionName": source,
+			"ability": save.Ability, "dc": float64(save.DC),
+			"onFail":       encounterSaveOutcome(combatant, save.OnFail, source),
+			"onSuccess":    encounterSaveOutcome(combatant, save.OnSuccess, source),
+			"serverRolled": true,
+		}
+		var avoids []interface{}
+		for _, outcome := range save.OnFail {
+			if outcome.Kind == "condition" && outcome.Op == "apply" {
+				avoids = append(avoids, outcome.Value)
+			}
+		}
+		if len(avoids) > 0 {
+			row["avoidsConditions"] = avoids
+		}
+		rows[save.TargetID] = append(rows[save.TargetID], row)
+	}
+
+	patches := make([]CombatantPatch, 0, len(order))
+	for _, actorID := range order {
+		patches = append(patches, CombatantPatch{ActorID: actorID, Set: JSONMap{"pendingSaves": rows[actorID]}})
+	}
+	var log []BattleLogEntry
+	if len(saves) > 0 && len(order) > 0 {
+		log = append(log, BattleLogEntry{Message: fmt.Sprintf("%s: «%s» — спасбросок %s СЛ %d (%s)",
+			caster.Name, source, abilityLabel(saves[0].Ability), saves[0].DC, strings.Join(names, ", "))})
+	}
+	return patches, log
+}
+
+// resolveEncounterPendingSave разрешает серверный спасбросок броском roll: снимает
+// строку и применяет ветку исхода к ТЕКУЩЕМУ состоянию цели (урон — сначала по
+// временным хитам). Записи урона адресованы персонажу — commitEncounterOp по
+// ним откроет спасбросок концентрации.
+func resolveEncounterPendingSave(state map[string]interface{}, actorID string, save map[string]interface{}, roll EngineRoll) ([]CombatantPatch, []BattleLogEntry) {
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	combatants, _ := state["combatants"].([]interface{})
+	for _, item := range combatants {
+		combatant, ok := item.(map[string]interface{})
+		if !ok || combatant["actorId"] != actorID {
+			continue
+		}
+		saveID := stringField(save, "id")
+		existing, _ := combatant["pendingSaves"].([]interface{})
+		kept := make([]interface{}, 0, len(existing))
+		for _, raw := range existing {
+			if row, ok := raw.(map[string]interface{}); ok && stringField(row, "id") == saveID {
+				continue
+			}
+			kept = append(kept, raw)
+		}
+
+		succeeded := roll.Outcome == "success"
+		branch, verdict := "onFail", "провал"
+		if succeeded {
+			branch, verdict = "onSuccess", "успех"
+		}
+		outcome, _ := save[branch].(map[string]interface{})
+		name := stringFieldOr(combatant, "name", actorID)
+		source := stringField(save, "actionName")
+		characterID, _ := combatant["characterId"].(string)
+
+		label := fmt.Sprintf("Спасбросок %s против «%s» — %s", abilityLabel(stringField(save, "ability")), source, verdict)
+		entry := BattleLogEntry{Message: fmt.Sprintf("%s: %s, %s", name, label, roll.Text), TargetCharacterID: characterID}
+		if characterID != "" {
+			entry.Type = "roll"
+			entry.Payload = JSONMap{"type": "roll", "label": label, "roll": map[string]interface{}(roll.toJSONMap())}
+		}
+		log = append(log, entry)
+
+		hp, temp, maxHP := 0, 0, 0
+		if value, ok := mechanicsNumber(combatant["hp"]); ok {
+			hp = int(value)
+		}
+		if value, ok := mechanicsNumber(combatant["temp"]); ok {
+			temp = int(value)
+		}
+		if value, ok := mechanicsNumber(combatant["maxHp"]); ok {
+			maxHP = int(value)
+		}
+		hpDelta, _ := mechanicsNumber(outcome["hpDelta"])
+		tempDelta, _ := mechanicsNumber(outcome["tempDelta"])
+		damage, healing, tempGain := 0, 0, 0
+		if hpDelta < 0 {
+			damage -= int(hpDelta)
+		} else {
+			healing = int(hpDelta)
+		}
+		if tempDelta < 0 {
+			damage -= int(tempDelta)
+		} else {
+			tempGain = int(tempDelta)
+		}
+		absorbed := damage
+		if absorbed > temp {
+			absorbed = temp
+		}
+		temp -= absorbed
+		hp -= damage - absorbed
+		if hp < 0 {
+			hp = 0
+		}
+		hp += healing
+		if maxHP > 0 && hp > maxHP {
+			hp = maxHP
+		}
+		if tempGain > temp {
+			temp = tempGain
+		}
+		set := JSONMap{"pendingSaves": kept, "hp": hp, "temp": temp}
+
+		if damage > 0 {
+			damageType := stringFieldOr(outcome, "damageType", "untyped")
+			entry := BattleLogEntry{
+				Message:           fmt.Sprintf("%s получает %d урона (%s): %s", name, damage, damageType, source),
+				TargetCharacterID: characterID,
+			}
+			if characterID != "" {
+				entry.Type = "damage"
+				entry.Payload = JSONMap{"type": "damage", "amount": damage, "damageType": damageType, "source": stringFieldOr(save, "sourceName", source)}
+			}
+			log = append(log, entry)
+		}
+		if healing > 0 {
+			entry := BattleLogEntry{Message: fmt.Sprintf("%s восстанавливает %d хитов: %s", name, healing, source), TargetCharacterID: characterID}
+			if characterID != "" {
+				entry.Type = "healing"
+				entry.Payload = JSONMap{"type": "healing", "amount": healing, "source": source}
+			}
+			log = append(log, entry)
+		}
+		if added, ok := outcome["addEffects"].([]interface{}); ok && len(added) > 0 {
+			effects, _ := combatant["activeEffects"].([]interface{})
+			effects = append(append([]interface{}{}, effects...), added...)
+			set["activeEffects"] = effects
+			for _, raw := range added {
+				effect, _ := raw.(map[string]interface{})
+				condition := stringField(effect, "name")
+				if mechanics, ok := effect["mechanics"].(map[string]interface{}); ok && stringField(mechanics, "kind") == "condition" {
+					condition = stringFieldOr(mechanics, "value", condition)
+				}
+				entry := BattleLogEntry{Message: fmt.Sprintf("%s: состояние «%s» (%s)", name, condition, source), TargetCharacterID: characterID}
+				if characterID != "" {
+					entry.Type = "condition_applied"
+					entry.Payload = JSONMap{"type": "condition_applied", "condition": condition, "source": source}
+				}
+				log = append(log, entry)
+			}
+		}
+		patches = append(patches, CombatantPatch{ActorID: actorID, Set: set})
+	}
+	return patches, log
+}
+
+// OpenEncounterSaves — POST /api/encounters/:id/saves. Исполнитель — участник,
+// которым управляет вызывающий (мастер — любым). Действие должно принадлежать
+// исполнителю, заклинание — быть в списке заклинаний персонажа.
+func (ec *EncounterController) OpenEncounterSaves(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req OpenEncounterSavesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if req.ExpectedSeq == nil || *req.ExpectedSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	if (req.ActionID == nil) == (req.SpellID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "укажите ровно одно из action_id или spell_id"})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	var newState JSONMap
+	var newSeq int64
+	var opened []mechanicsPendingSave
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, true)
+		if err != nil {
+			return err
+		}
+		actors, accessErr := actorAccessFromCombatants(combatants, characters)
+		if accessErr != nil {
+			return accessErr
+		}
+		access, exists := actors[req.CasterID]
+		if !exists {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "участник боя не найден"}
+		}
+		if caller != enc.OwnerUserID && (!access.IsCharacter || access.ControllerUserID != caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "исполнить механику может мастер боя или контроллер персонажа"}
+		}
+		byID := make(map[string]map[string]interface{}, len(combatants))
+		for _, combatant := range combatants {
+			byID[stringField(combatant, "actorId")] = combatant
+		}
+		caster, monster, err := encounterCombatantActor(tx, byID[req.CasterID], characters)
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		targets := make([]mechanicsActor, 0, len(req.TargetIDs))
+		for _, targetID := range req.TargetIDs {
+			if seen[targetID] {
+				continue
+			}
+			seen[targetID] = true
+			combatant, exists := byID[targetID]
+			if !exists {
+				return &encounterAccessError{Status: http.StatusNotFound, Message: "цель не найдена в бою"}
+			}
+			target, _, err := encounterCombatantActor(tx, combatant, characters)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target)
+		}
+
+		invocation := mechanicsInvocation{Actor: caster, Targets: targets, RNG: newDiceRNG(0)}
+		var mechanics *JSONMap
+		if req.ActionID != nil {
+			var action Action
+			if err := tx.First(&action, "id = ?", *req.ActionID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &encounterAccessError{Status: http.StatusNotFound, Message: "действие не найдено"}
+				}
+				return err
+			}
+			owned, err := encounterActorHasAction(tx, access, characters, monster, action)
+			if err != nil {
+				return err
+			}
+			if !owned {
+				return &encounterAccessError{Status: http.StatusForbidden, Message: "у исполнителя нет этого действия"}
+			}
+			invocation.Source, mechanics = action.Name, action.Mechanics
+		} else {
+			var spell Spell
+			if err := tx.First(&spell, "id = ?", *req.SpellID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return &encounterAccessError{Status: http.StatusNotFound, Message: "заклинание не найдено"}
+				}
+				return err
+			}
+			if access.IsCharacter {
+				known := false
+				if spellIDs := characters[access.CharacterID].SpellIDs; spellIDs != nil {
+					for _, spellID := range *spellIDs {
+						known = known || spellID == spell.ID.String()
+					}
+				}
+				if !known {
+					return &encounterAccessError{Status: http.StatusForbidden, Message: "персонаж не знает этого заклинания"}
+				}
+			}
+			invocation.SlotLevel, invocation.BaseLevel = spell.Level, spell.Level
+			if req.SlotLevel > 0 {
+				if req.SlotLevel < spell.Level {
+					return &encounterAccessError{Status: http.StatusBadRequest, Message: "ячейка ниже круга заклинания"}
+				}
+				invocation.SlotLevel = req.SlotLevel
+			}
+			invocation.Source, mechanics = spell.Name, spell.Mechanics
+		}
+		if mechanics == nil {
+			return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "у источника нет механики"}
+		}
+		invocation.Mechanics = *mechanics
+
+		opened, err = interpretMechanicsSaves(invocation)
+		if err != nil {
+			var mechanicsErr *mechanicsInterpretError
+			if errors.As(err, &mechanicsErr) {
+				return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "механика спасброска неисполнима: " + mechanicsErr.Error()}
+			}
+			return err
+		}
+		patches, log := openEncounterSaves(state, caster, invocation.Source, opened)
+		committed, err := commitEncounterOp(tx, &enc, state, ApplyRequest{Patches: patches, Log: log}, characters)
+		if err != nil {
+			return err
+		}
+		newState, newSeq = committed, enc.Seq
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось открыть спасброски")
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), newSeq)
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": newSeq, "state": &newState, "opened": len(opened)})
+}
+
+// ResolveEncounterSave — POST /api/encounters/:id/saves/resolve. Разрешает мастер
+// боя или контроллер персонажа-цели; бросок идёт с модификатором, владением и
+// состояниями цели, исход ветки применяется той же операцией.
+func (ec *EncounterController) ResolveEncounterSave(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var req ResolveEncounterSaveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	if req.ExpectedSeq == nil || *req.ExpectedSeq < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected_seq обязателен и не может быть отрицательным"})
+		return
+	}
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+
+	var newState JSONMap
+	var newSeq int64
+	var roll EngineRoll
+	txErr := ec.db.Transaction(func(tx *gorm.DB) error {
+		var enc Encounter
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&enc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if !isEncounterParticipant(&enc, caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "нет доступа к этому бою"}
+		}
+		if enc.Seq != *req.ExpectedSeq {
+			return &encounterAccessError{
+				Status:  http.StatusConflict,
+				Message: fmt.Sprintf("состояние боя устарело: ожидалась версия %d, текущая версия %d", *req.ExpectedSeq, enc.Seq),
+			}
+		}
+
+		state := stateOfEncounter(&enc)
+		combatants, accessErr := combatantMaps(state)
+		if accessErr != nil {
+			return accessErr
+		}
+		characterIDs, accessErr := characterUUIDsInCombatants(combatants)
+		if accessErr != nil {
+			return accessErr
+		}
+		characters, err := loadEncounterCharacters(tx, characterIDs, true)
+		if err != nil {
+			return err
+		}
+		actors, accessErr := actorAccessFromCombatants(combatants, characters)
+		if accessErr != nil {
+			return accessErr
+		}
+		access, exists := actors[req.ActorID]
+		if !exists {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "участник боя не найден"}
+		}
+		if caller != enc.OwnerUserID && (!access.IsCharacter || access.ControllerUserID != caller) {
+			return &encounterAccessError{Status: http.StatusForbidden, Message: "спасбросок разрешает мастер боя или контроллер персонажа"}
+		}
+
+		var combatant, save map[string]interface{}
+		for _, candidate := range combatants {
+			if candidate["actorId"] != req.ActorID {
+				continue
+			}
+			combatant = candidate
+			saves, _ := candidate["pendingSaves"].([]interface{})
+			for _, raw := range saves {
+				row, ok := raw.(map[string]interface{})
+				if ok && row["serverRolled"] == true && stringField(row, "id") == req.SaveID {
+					save = row
+				}
+			}
+		}
+		if save == nil {
+			return &encounterAccessError{Status: http.StatusNotFound, Message: "спасбросок не найден"}
+		}
+		dc, ok := mechanicsNumber(save["dc"])
+		ability := stringField(save, "ability")
+		if !ok || !oneOf(ability, abilityKeys...) {
+			return &encounterAccessError{Status: http.StatusUnprocessableEntity, Message: "у спасброска нет характеристики или СЛ"}
+		}
+
+		roller, _, err := encounterCombatantActor(tx, combatant, characters)
+		if err != nil {
+			return err
+		}
+		roll = rollActorSave(newDiceRNG(0), roller, ability, int(dc))
+		patches, log := resolveEncounterPendingSave(state, req.ActorID, save, roll)
+		committed, err := commitEncounterOp(tx, &enc, state, ApplyRequest{Patches: patches, Log: log}, characters)
+		if err != nil {
+			return err
+		}
+		newState, newSeq = committed, enc.Seq
+		return nil
+	})
+	if txErr != nil {
+		writeEncounterError(c, txErr, "не удалось разрешить спасбросок")
+		return
+	}
+	if ec.hub != nil {
+		ec.hub.notify(ec.db, id.String(), newSeq)
+	}
+	c.JSON(http.StatusOK, gin.H{"seq": newSeq, "state": &newState, "roll": roll, "success": roll.Outcome == "success"})
+}
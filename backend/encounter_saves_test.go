@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestInterpretMechanicsSaves(t *testing.T) {
+	mechanics := JSONMap(mustMechanicsJSON(t, `{"effects":[{"resolution":"save","ability":"dex","dc":"8 + prof + int","on_fail":[{"kind":"damage","dice":"8d6","type":"fire","on_success":"half"}]},{"resolution":"auto","who":"self","result":[{"kind":"temp_hp","amount":5}]}]}`))
+	caster := newMechanicsActor("wizard", "Маг")
+	caster.Abilities["int"] = 16
+	goblin := newMechanicsActor("goblin", "Гоблин")
+	salamander := newMechanicsActor("salamander", "Саламандра")
+	salamander.Resistances["fire"] = true
+
+	saves, err := interpretMechanicsSaves(mechanicsInvocation{Actor: caster, Targets: []mechanicsActor{goblin, salamander}, Mechanics: mechanics, RNG: newDiceRNG(11)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(saves) != 2 || saves[0].DC != 13 || saves[0].Ability != "dex" {
+		t.Fatalf("one save per target with caster DC expected: %+v", saves)
+	}
+	fail, half := saves[0].OnFail[0], saves[0].OnSuccess[0]
+	if fail.Amount != half.RawAmount*2 && fail.Amount != half.RawAmount*2+1 {
+		t.Fatalf("success must halve the same roll: fail=%d success=%d", fail.Amount, half.Amount)
+	}
+	if resisted := saves[1].OnFail[0]; resisted.RawAmount != fail.RawAmount || resisted.Amount != fail.Amount/2 {
+		t.Fatalf("area damage is rolled once and adjusted per target: %+v vs %+v", resisted, fail)
+	}
+
+	if _, err := interpretMechanicsSaves(mechanicsInvocation{Actor: caster, Targets: []mechanicsActor{goblin}, Mechanics: JSONMap(mustMechanicsJSON(t, `{"effects":[{"resolution":"auto","who":"self","result":[]}]}`))}); err == nil {
+		t.Fatal("mechanics without saves must be rejected")
+	}
+}
+
+func TestEncounterPendingSaveLifecycle(t *testing.T) {
+	fighter := combatant("fighter", 30)
+	fighter["characterId"] = "5b0b9a3e-4c8e-4f7e-9b35-1f3a4c5d6e7f"
+	fighter["temp"] = float64(4)
+	state := map[string]interface{}{"combatants": []interface{}{fighter, combatant("goblin", 7)}}
+	rounds := 10
+	saves := []mechanicsPendingSave{{
+		TargetID: "fighter", Ability: "con", DC: 14,
+		OnFail: []MechanicsOutcome{
+			{Kind: "damage", Amount: 10, DamageType: "poison"},
+			{Kind: "condition", Op: "apply", Value: "poisoned", RoundsLeft: &rounds},
+		},
+		OnSuccess: []MechanicsOutcome{{Kind: "damage", Amount: 5, DamageType: "poison"}},
+	}}
+
+	caster := newMechanicsActor("goblin", "Гоблин")
+	patches, log := openEncounterSaves(state, caster, "Ядовитое облако", saves)
+	if len(patches) != 1 || len(log) != 1 {
+		t.Fatalf("one patch and one board entry expected: %+v %+v", patches, log)
+	}
+	rows := patches[0].Set["pendingSaves"].([]interface{})
+	row := rows[0].(map[string]interface{})
+	if !validPendingSaveValue(jsonCompatible(row)) || row["serverRolled"] != true {
+		t.Fatalf("server pending save must pass the board validator: %+v", row)
+	}
+	if onFail := row["onFail"].(map[string]interface{}); onFail["tempDelta"] != float64(-4) || onFail["hpDelta"] != float64(-6) {
+		t.Fatalf("temp hp must absorb first: %+v", onFail)
+	}
+
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	failed := EngineRoll{Kind: "save", Dice: []EngineRollDie{{Sides: 20, Result: 2}}, Advantage: "none", Modifiers: []EngineRollModifier{}, Total: 2, Outcome: "fail"}
+	resolved, entries := resolveEncounterPendingSave(state, "fighter", row, failed)
+	set := resolved[0].Set
+	if set["hp"] != 24 || set["temp"] != 0 || len(set["pendingSaves"].([]interface{})) != 0 {
+		t.Fatalf("fail branch must apply and close the save: %+v", set)
+	}
+	if effects := set["activeEffects"].([]interface{}); len(effects) != 1 {
+		t.Fatalf("condition from the fail branch must be added: %+v", effects)
+	}
+	if upd, temp, hasTemp := encounterPatchSheetUpdates(applyOps(cloneEncounterTurnState(state), ApplyRequest{Patches: resolved}), resolved[0]); upd["current_hp"] != 24 || !hasTemp || temp != 0 {
+		t.Fatalf("failed save damage must reach the character sheet: %+v temp=%d/%v", upd, temp, hasTemp)
+	}
+	if len(entries) != 3 || entries[0].Type != "roll" || entries[1].Type != "damage" || entries[2].Type != "condition_applied" {
+		t.Fatalf("unexpected journal: %+v", entries)
+	}
+	for _, entry := range entries {
+		if err := validateCharacterEvent(entry.Type, entry.Payload); err != nil {
+			t.Fatalf("journal entry %+v rejected: %v", entry, err)
+		}
+	}
+
+	passed := failed
+	passed.Outcome = "success"
+	resolved, _ = resolveEncounterPendingSave(state, "fighter", row, passed)
+	if set := resolved[0].Set; set["hp"] != 29 || set["temp"] != 0 || set["activeEffects"] != nil {
+		t.Fatalf("success branch deals half damage only: %+v", set)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Заготовки столкновений: мастер заранее собирает группы существ со
+// статблоков и заметки, а в игре одной командой превращает заготовку в живой
+// бой. Распоряжается заготовкой только владелец; мастера группы, с которой
+// ею поделились, видят её и создают по ней бои.
+
+const (
+	maxEncounterTemplateBodyBytes    = 64 << 10
+	maxEncounterTemplateSpawnBytes   = 4 << 10
+	maxEncounterTemplateCombatants   = 100
+	encounterTemplateNotFoundMessage = "заготовка не найдена"
+)
+
+// encounterTemplateConditions — состояния, с которыми существо может войти
+// в бой (зеркало BUILTIN_CONDITION_RULES в frontend/src/engine/conditions.ts).
+var encounterTemplateConditions = map[string]bool{
+	"blinded": true, "charmed": true, "deafened": true, "exhaustion": true, "frightened": true,
+	"grappled": true, "incapacitated": true, "invisible": true, "paralyzed": true, "petrified": true,
+	"poisoned": true, "prone": true, "restrained": true, "stunned": true, "unconscious": true,
+}
+
+type EncounterTemplateController struct {
+	db *gorm.DB
+}
+
+func NewEncounterTemplateController(db *gorm.DB) *EncounterTemplateController {
+	return &EncounterTemplateController{db: db}
+}
+
+// normalizeEncounterTemplateRequest приводит имена и состояния к каноническому
+// виду: обрезает пробелы, состояния — в нижнем регистре без повторов.
+func normalizeEncounterTemplateRequest(req *EncounterTemplateRequest) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Notes = strings.TrimSpace(req.Notes)
+	for i := range req.MonsterGroups {
+		group := &req.MonsterGroups[i]
+		group.Name = strings.TrimSpace(group.Name)
+		for j := range group.Monsters {
+			monster := &group.Monsters[j]
+			if monster.HPMode == "" {
+				monster.HPMode = "average"
+			}
+			seen := map[string]bool{}
+			conditions := []string{}
+			for _, condition := range monster.Conditions {
+				condition = strings.ToLower(strings.TrimSpace(condition))
+				if condition != "" && !seen[condition] {
+					seen[condition] = true
+					conditions = append(conditions, condition)
+				}
+			}
+			monster.Conditions = conditions
+		}
+	}
+}
+
+// encounterTemplateIssue — проверки заготовки, не требующие базы.
+func encounterTemplateIssue(req EncounterTemplateRequest) string {
+	if req.Name == "" {
+		return "название заготовки обязательно"
+	}
+	total := 0
+	for _, group := range req.MonsterGroups {
+		for _, monster := range group.Monsters {
+			total += monster.Count
+			for _, condition := range monster.Conditions {
+				if !encounterTemplateConditions[condition] {
+					return fmt.Sprintf("неизвестное состояние %q", condition)
+				}
+			}
+		}
+	}
+	if total > maxEncounterTemplateCombatants {
+		return fmt.Sprintf("в заготовке не больше %d существ", maxEncounterTemplateCombatants)
+	}
+	return ""
+}
+
+// encounterTemplateMonsterIDs — различные статблоки заготовки.
+func encounterTemplateMonsterIDs(groups []EncounterTemplateGroup) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	for _, group := range groups {
+		for _, monster := range group.Monsters {
+			if !seen[monster.MonsterID] {
+				seen[monster.MonsterID] = true
+				ids = append(ids, monster.MonsterID)
+			}
+		}
+	}
+	return ids
+}
+
+// dmGroupIDs — группы, где вызывающий — мастер.
+func (tc *EncounterTemplateController) dmGroupIDs(caller uuid.UUID) ([]uuid.UUID, error) {
+	var memberships []GroupMember
+	if err := tc.db.Where("user_id = ? AND role = ?", caller, RoleDM).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, 0, len(memberships))
+	for _, membership := range memberships {
+		ids = append(ids, membership.GroupID)
+	}
+	return ids, nil
+}
+
+// canUse — владелец или мастер группы, с которой поделились заготовкой.
+func (tc *EncounterTemplateController) canUse(template EncounterTemplate, caller uuid.UUID) (bool, error) {
+	if template.OwnerUserID == caller {
+		return true, nil
+	}
+	if template.GroupID == nil {
+		return false, nil
+	}
+	var count int64
+	err := tc.db.Model(&GroupMember{}).Where("group_id = ? AND user_id = ? AND role = ?", *template.GroupID, caller, RoleDM).Count(&count).Error
+	return count > 0, err
+}
+
+// load находит заготовку, доступную вызывающему. Чужая заготовка неотличима
+// от отсутствующей, чтобы не раскрывать подготовку другого мастера.
+func (tc *EncounterTemplateController) load(c *gin.Context, caller uuid.UUID) (EncounterTemplate, bool) {
+	var template EncounterTemplate
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return template, false
+	}
+	if err := tc.db.First(&template, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": encounterTemplateNotFoundMessage})
+			return template, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось загрузить заготовку"})
+		return template, false
+	}
+	allowed, err := tc.canUse(template, caller)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось загрузить заготовку"})
+		return template, false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": encounterTemplateNotFoundMessage})
+		return template, false
+	}
+	return template, true
+}
+
+// bindRequest читает и проверяет заготовку: группа — только своя мастерская,
+// существа — из каталога.
+func (tc *EncounterTemplateController) bindRequest(c *gin.Context, caller uuid.UUID) (EncounterTemplateRequest, bool) {
+	var req EncounterTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return req, false
+	}
+	normalizeEncounterTemplateRequest(&req)
+	if issue := encounterTemplateIssue(req); issue != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": issue})
+		return req, false
+	}
+	if req.GroupID != nil {
+		var count int64
+		if err := tc.db.Model(&GroupMember{}).Where("group_id = ? AND user_id = ? AND role = ?", *req.GroupID, caller, RoleDM).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить заготовку"})
+			return req, false
+		}
+		if count == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "поделиться заготовкой можно только с группой, где вы мастер"})
+			return req, false
+		}
+	}
+	ids := encounterTemplateMonsterIDs(req.MonsterGroups)
+	var found int64
+	if err := tc.db.Model(&Monster{}).Where("id IN ?", ids).Count(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить заготовку"})
+		return req, false
+	}
+	if int(found) != len(ids) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "заготовка ссылается на несуществующего монстра"})
+		return req, false
+	}
+	return req, true
+}
+
+func (tc *EncounterTemplateController) List(c *gin.Context) {
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	groups, err := tc.dmGroupIDs(caller)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось загрузить заготовки"})
+		return
+	}
+	query := tc.db.Where("owner_user_id = ?", caller)
+	if len(groups) > 0 {
+		query = tc.db.Where("owner_user_id = ? OR group_id IN ?", caller, groups)
+	}
+	var templates []EncounterTemplate
+	if err := query.Order("updated_at DESC").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось загрузить заготовки"})
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+func (tc *EncounterTemplateController) Get(c *gin.Context) {
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	if template, ok := tc.load(c, caller); ok {
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+func (tc *EncounterTemplateController) Create(c *gin.Context) {
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	req, ok := tc.bindRequest(c, caller)
+	if !ok {
+		return
+	}
+	template := EncounterTemplate{Name: req.Name, OwnerUserID: caller, GroupID: req.GroupID, Notes: req.Notes, MonsterGroups: req.MonsterGroups}
+	if err := tc.db.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить заготовку"})
+		return
+	}
+	c.JSON(http.StatusCreated, template)
+}
+
+// Update заменяет заготовку целиком (только владелец).
+func (tc *EncounterTemplateController) Update(c *gin.Context) {
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	template, ok := tc.load(c, caller)
+	if !ok {
+		return
+	}
+	if template.OwnerUserID != caller {
+		c.JSON(http.StatusForbidden, gin.H{"error": "изменить заготовку может только её владелец"})
+		return
+	}
+	req, ok := tc.bindRequest(c, caller)
+	if !ok {
+		return
+	}
+	template.Name, template.GroupID, template.Notes, template.MonsterGroups = req.Name, req.GroupID, req.Notes, req.MonsterGroups
+	if err := tc.db.Save(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось сохранить заготовку"})
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+func (tc *EncounterTemplateController) Delete(c *gin.Context) {
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	template, ok := tc.load(c, caller)
+	if !ok {
+		return
+	}
+	if template.OwnerUserID != caller {
+		c.JSON(http.StatusForbidden, gin.H{"error": "удалить заготовку может только её владелец"})
+		return
+	}
+	if err := tc.db.Delete(&EncounterTemplate{}, "id = ?", template.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось удалить заготовку"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// encounterTemplateSpawns — позиции всех групп заготовки для
+// encounterMonsterCombatants; источник начальных состояний — имя заготовки.
+func encounterTemplateSpawns(template EncounterTemplate) []encounterMonsterSpawn {
+	var spawns []encounterMonsterSpawn
+	for _, group := range template.MonsterGroups {
+		for _, entry := range group.Monsters {
+			spawns = append(spawns, encounterMonsterSpawn{
+				MonsterID:  entry.MonsterID,
+				Count:      entry.Count,
+				RolledHP:   entry.HPMode == "rolled",
+				Hidden:     entry.Hidden,
+				Conditions: entry.Conditions,
+				Source:     template.Name,
+			})
+		}
+	}
+	return spawns
+}
+
+// Spawn — POST /api/encounter-templates/:id/spawn. Создаёт новый бой
+// вызывающего; первое событие журнала добавляет существ и называет заготовку.
+func (tc *EncounterTemplateController) Spawn(c *gin.Context) {
+	caller, err := GetCurrentUserID(c)
+	if err != nil || caller == uuid.Nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "требуется авторизация"})
+		return
+	}
+	var req SpawnEncounterTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные", "details": err.Error()})
+		return
+	}
+	template, ok := tc.load(c, caller)
+	if !ok {
+		return
+	}
+
+	ids := encounterTemplateMonsterIDs(template.MonsterGroups)
+	var rows []Monster
+	if err := tc.db.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось создать бой"})
+		return
+	}
+	monsters := make(map[uuid.UUID]Monster, len(rows))
+	for _, monster := range rows {
+		monsters[monster.ID] = monster
+	}
+	for _, id := range ids {
+		if _, exists := monsters[id]; !exists {
+			c.JSON(http.StatusConflict, gin.H{"error": "монстр заготовки удалён из каталога", "details": id.String()})
+			return
+		}
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = template.Name
+	}
+	combatants := encounterMonsterCombatants(encounterTemplateSpawns(template), monsters, nil, newDiceRNG(0))
+	var enc Encounter
+	err = tc.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		enc, err = spawnEncounter(tx, caller, name, combatants, fmt.Sprintf("Бой по заготовке «%s»: существ — %d", template.Name, len(combatants)))
+		return err
+	})
+	if err != nil {
+		writeEncounterError(c, err, "не удалось создать бой")
+		return
+	}
+	c.JSON(http.StatusCreated, enc)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEncounterTemplateRequestValidation(t *testing.T) {
+	goblin := uuid.New()
+	req := EncounterTemplateRequest{Name: "  Засада у моста ", MonsterGroups: []EncounterTemplateGroup{
+		{Name: " Стрелки ", Monsters: []EncounterTemplateMonster{{MonsterID: goblin, Count: 3, Conditions: []string{" Prone", "prone", ""}}}},
+		{Monsters: []EncounterTemplateMonster{{MonsterID: goblin, Count: 2, HPMode: "rolled"}}},
+	}}
+	normalizeEncounterTemplateRequest(&req)
+	first := req.MonsterGroups[0].Monsters[0]
+	if req.Name != "Засада у моста" || req.MonsterGroups[0].Name != "Стрелки" || first.HPMode != "average" || len(first.Conditions) != 1 || first.Conditions[0] != "prone" {
+		t.Fatalf("имена обрезаны, состояния без повторов, хиты по умолчанию средние: %+v", req)
+	}
+	if issue := encounterTemplateIssue(req); issue != "" {
+		t.Fatalf("valid template rejected: %s", issue)
+	}
+	if ids := encounterTemplateMonsterIDs(req.MonsterGroups); len(ids) != 1 {
+		t.Fatalf("один статблок в двух группах: %v", ids)
+	}
+
+	req.MonsterGroups[1].Monsters[0].Conditions = []string{"sleepy"}
+	if issue := encounterTemplateIssue(req); issue == "" {
+		t.Fatal("unknown condition accepted")
+	}
+	req.MonsterGroups[1].Monsters[0].Conditions = nil
+	req.MonsterGroups[1].Monsters[0].Count = 98
+	if issue := encounterTemplateIssue(req); issue == "" {
+		t.Fatal("more than 100 creatures accepted")
+	}
+}
+
+func TestEncounterTemplateCombatants(t *testing.T) {
+	actions := Properties{uuid.NewString()}
+	wolf := Monster{ID: uuid.New(), Name: "Волк", ArmorClass: 13, MaxHP: 11, HitDice: "2d8+2", Speed: 40, ActionIDs: &actions}
+	template := EncounterTemplate{Name: "Стая", MonsterGroups: EncounterTemplateGroups{
+		{Name: "Вожак", Monsters: []EncounterTemplateMonster{{MonsterID: wolf.ID, Count: 1, HPMode: "rolled", Hidden: true}}},
+		{Name: "Стая", Monsters: []EncounterTemplateMonster{{MonsterID: wolf.ID, Count: 2, HPMode: "average", Conditions: []string{"prone"}}}},
+	}}
+	combatants := encounterMonsterCombatants(encounterTemplateSpawns(template), map[uuid.UUID]Monster{wolf.ID: wolf}, nil, scripted(t, 8, 8))
+	if len(combatants) != 3 {
+		t.Fatalf("один вожак и два волка: %+v", combatants)
+	}
+	leader, pack := combatants[0], combatants[2]
+	if leader["name"] != "Волк 1" || leader["hp"] != 18 || leader["hidden"] != true || leader["speed"] != 40 || len(leader["actionIds"].([]interface{})) != 1 {
+		t.Fatalf("вожак с брошенными хитами, скрыт, со скоростью и действиями статблока: %+v", leader)
+	}
+	effects := pack["activeEffects"].([]interface{})
+	if pack["name"] != "Волк 3" || pack["hp"] != 11 || pack["ac"] != 13 || len(effects) != 1 || pack["hidden"] != nil {
+		t.Fatalf("копии нумеруются через все группы, средние хиты, начальное состояние: %+v", pack)
+	}
+	if mechanics := effects[0].(map[string]interface{})["mechanics"].(map[string]interface{}); mechanics["value"] != "prone" {
+		t.Fatalf("состояние — эффект-условие: %+v", effects[0])
+	}
+	if source := effects[0].(map[string]interface{})["source"]; source != "Стая" {
+		t.Fatalf("источник состояния — заготовка: %v", source)
+	}
+}
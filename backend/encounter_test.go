@@ -180,3 +180,123 @@ func TestOpPayload_Roundtrip(t *testing.T) {
 		t.Fatalf("command precondition leaked into replay payload: %+v", m)
 	}
 }
+
+func TestExpireEncounterTurnEffects(t *testing.T) {
+	hero := combatant("hero", 20)
+	hero["characterId"] = "c1"
+	hero["activeEffects"] = []interface{}{
+		map[string]interface{}{"id": "1", "name": "Рывок", "expiry": "end_of_turn"},
+		map[string]interface{}{"id": "2", "name": "Благословение", "roundsLeft": float64(10)},
+		map[string]interface{}{"id": "3", "name": "Опутан", "sourceId": "ogre", "ownerId": "hero",
+			"sourceTurnExpiry": map[string]interface{}{"sourceActorId": "ogre", "ownerActorId": "hero", "boundary": "end"}},
+	}
+	ogre := combatant("ogre", 30)
+	ogre["activeEffects"] = []interface{}{
+		map[string]interface{}{"id": "4", "name": "Уклонение", "expiry": "start_of_next_turn"},
+		map[string]interface{}{"id": "5", "name": "Ускорение", "roundsLeft": float64(1)},
+		map[string]interface{}{"id": "6", "name": "Ярость", "roundsLeft": float64(5)},
+	}
+	state := map[string]interface{}{"combatants": []interface{}{hero, ogre}, "round": 1, "activeIndex": 1}
+
+	patches, log := expireEncounterTurnEffects(state, "hero", "ogre")
+	if len(patches) != 2 || len(log) != 3 {
+		t.Fatalf("ожидались патчи обоих участников и 3 истечения: %+v %+v", patches, log)
+	}
+	heroEffects := patches[0].Set["activeEffects"].([]interface{})
+	if len(heroEffects) != 2 {
+		t.Fatalf("у героя должен истечь только эффект до конца хода: %+v", heroEffects)
+	}
+	if heroEffects[0].(map[string]interface{})["roundsLeft"] != float64(10) {
+		t.Fatal("раунды тикают только на начале хода владельца")
+	}
+	lifecycle := heroEffects[1].(map[string]interface{})["sourceTurnExpiry"].(map[string]interface{})
+	if lifecycle["armed"] != true {
+		t.Fatalf("начало хода источника должно взвести boundary end: %+v", lifecycle)
+	}
+	if log[0].TargetCharacterID != "c1" || log[0].Payload["name"] != "Рывок" || log[1].TargetCharacterID != "" {
+		t.Fatalf("журнал адресуется только персонажам: %+v", log)
+	}
+	ogreEffects := patches[1].Set["activeEffects"].([]interface{})
+	if len(ogreEffects) != 1 || ogreEffects[0].(map[string]interface{})["roundsLeft"] != float64(4) {
+		t.Fatalf("у огра остаётся только тикнувшая ярость: %+v", ogreEffects)
+	}
+	if len(ogre["activeEffects"].([]interface{})) != 3 {
+		t.Fatal("исходное состояние не должно мутироваться")
+	}
+
+	state = applyOps(state, ApplyRequest{Patches: patches})
+	patches, log = expireEncounterTurnEffects(state, "ogre", "hero")
+	if len(log) != 1 || log[0].Payload["name"] != "Опутан" {
+		t.Fatalf("конец хода источника снимает взведённый эффект: %+v", log)
+	}
+	if remaining := patches[0].Set["activeEffects"].([]interface{}); len(remaining) != 1 || remaining[0].(map[string]interface{})["roundsLeft"] != float64(9) {
+		t.Fatalf("unexpected hero effects: %+v", remaining)
+	}
+}
+
+func TestEncounterTurnAdvanced(t *testing.T) {
+	state := map[string]interface{}{"combatants": []interface{}{combatant("a", 5), combatant("b", 5)}, "round": float64(2), "activeIndex": float64(1)}
+	previous := encounterTurnOf(state)
+	if previous.ActorID != "b" || previous.Round != 2 {
+		t.Fatalf("unexpected turn: %+v", previous)
+	}
+	r, ai := 3, 0
+	next := encounterTurnOf(applyOps(state, ApplyRequest{Round: &r, ActiveIndex: &ai}))
+	if !next.advancedFrom(previous) || next.ActorID != "a" {
+		t.Fatalf("смена хода не распознана: %+v", next)
+	}
+	if previous.advancedFrom(previous) {
+		t.Fatal("повтор того же хода не тикает эффекты")
+	}
+}
+
+func TestExpireEncounterTurnChangeTicksSkippedCombatants(t *testing.T) {
+	a, b, c := combatant("a", 20), combatant("b", 15), combatant("c", 10)
+	b["activeEffects"] = []interface{}{
+		map[string]interface{}{"id": "1", "name": "Рывок", "expiry": "end_of_turn"},
+		map[string]interface{}{"id": "2", "name": "Уклонение", "expiry": "start_of_next_turn"},
+	}
+	state := map[string]interface{}{"combatants": []interface{}{a, b, c}, "round": float64(1), "activeIndex": float64(0)}
+	previous := encounterTurnOf(state)
+	next := 2
+	op := ApplyRequest{ActiveIndex: &next}
+	patches, log := expireEncounterTurnChange(applyOps(state, op), previous, op)
+	if len(patches) != 1 || patches[0].ActorID != "b" || len(patches[0].Set["activeEffects"].([]interface{})) != 0 || len(log) != 2 {
+		t.Fatalf("пропущенный участник проходит начало и конец своего хода: %+v %+v", patches, log)
+	}
+}
+
+func TestExpireEncounterTurnChangeAcrossRoundsAndRemoval(t *testing.T) {
+	a, b := combatant("a", 20), combatant("b", 10)
+	a["activeEffects"] = []interface{}{map[string]interface{}{"id": "1", "name": "Ярость", "roundsLeft": float64(5)}}
+	state := map[string]interface{}{"combatants": []interface{}{a, b}, "round": float64(1), "activeIndex": float64(0)}
+	previous := encounterTurnOf(state)
+	round, active := 3, 0
+	op := ApplyRequest{Round: &round, ActiveIndex: &active}
+	patches, _ := expireEncounterTurnChange(applyOps(state, op), previous, op)
+	if len(patches) != 1 || patches[0].Set["activeEffects"].([]interface{})[0].(map[string]interface{})["roundsLeft"] != float64(3) {
+		t.Fatalf("прыжок на два раунда тикает два начала хода: %+v", patches)
+	}
+	if len(a["activeEffects"].([]interface{})) != 1 || a["activeEffects"].([]interface{})[0].(map[string]interface{})["roundsLeft"] != float64(5) {
+		t.Fatal("исходное состояние не должно мутироваться")
+	}
+
+	c := combatant("c", 5)
+	state = map[string]interface{}{"combatants": []interface{}{combatant("x", 30), a, b, c}, "round": float64(1), "activeIndex": float64(1)}
+	previous = encounterTurnOf(state)
+	if actors := encounterPassedActors(applyOps(state, ApplyRequest{Remove: []string{"a"}}), previous, encounterTurn{Round: 1, ActiveIndex: 1, ActorID: "b"}); len(actors) != 2 || actors[1] != "b" {
+		t.Fatalf("выбывший активный: ход переходит к следующему без пропусков: %v", actors)
+	}
+}
+
+func TestExpireEncounterTurnChangeSkipsInitiativeRestart(t *testing.T) {
+	a, b := combatant("a", 20), combatant("b", 10)
+	a["activeEffects"] = []interface{}{map[string]interface{}{"id": "1", "name": "Рывок", "expiry": "end_of_turn"}}
+	state := map[string]interface{}{"combatants": []interface{}{a, b}, "round": float64(4), "activeIndex": float64(1)}
+	previous := encounterTurnOf(state)
+	round, active := 1, 0
+	op := ApplyRequest{Round: &round, ActiveIndex: &active, Order: []string{"a", "b"}, restartsTurnOrder: true}
+	if patches, log := expireEncounterTurnChange(applyOps(state, op), previous, op); len(patches) != 0 || len(log) != 0 {
+		t.Fatalf("переброс инициативы — не смена хода: %+v %+v", patches, log)
+	}
+}
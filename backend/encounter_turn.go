@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// encounterTurn — позиция хода в состоянии боя: раунд, индекс и actorId активного участника.
+type encounterTurn struct {
+	Round       int
+	ActiveIndex int
+	ActorID     string
+}
+
+func encounterStateInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		return int(v), true
+	}
+	return 0, false
+}
+
+// encounterTurnOf читает текущий ход из состояния боя. ActorID пуст, если activeIndex
+// указывает за пределы списка участников.
+func encounterTurnOf(state map[string]interface{}) encounterTurn {
+	turn := encounterTurn{}
+	if state == nil {
+		return turn
+	}
+	turn.Round, _ = encounterStateInt(state["round"])
+	turn.ActiveIndex, _ = encounterStateInt(state["activeIndex"])
+	if raw, ok := state["combatants"].([]interface{}); ok && turn.ActiveIndex >= 0 && turn.ActiveIndex < len(raw) {
+		if combatant, ok := raw[turn.ActiveIndex].(map[string]interface{}); ok {
+			turn.ActorID, _ = combatant["actorId"].(string)
+		}
+	}
+	return turn
+}
+
+// advancedFrom — сменился ли ход. Сдвиг индекса при том же активном участнике
+// (перестановка порядка, вставка опоздавшего) ходом не считается.
+func (t encounterTurn) advancedFrom(previous encounterTurn) bool {
+	return t.Round != previous.Round || (t.ActiveIndex != previous.ActiveIndex && t.ActorID != previous.ActorID)
+}
+
+// expireEncounterTurnChange — тик длительностей после op, если тот сменил ход: на каждой
+// пройденной границе хода, включая пропущенных участников. Полный переброс инициативы
+// (restartsTurnOrder) начинает порядок заново и ничего не тикает.
+func expireEncounterTurnChange(state map[string]interface{}, previous encounterTurn, req ApplyRequest) ([]CombatantPatch, []BattleLogEntry) {
+	if (req.Round == nil && req.ActiveIndex == nil) || req.restartsTurnOrder {
+		return nil, nil
+	}
+	turn := encounterTurnOf(state)
+	if !turn.advancedFrom(previous) {
+		return nil, nil
+	}
+	return expireEncounterPassedTurns(state, encounterPassedActors(state, previous, turn))
+}
+
+// maxEncounterPassedTurns ограничивает число границ хода, пройденных одной операцией:
+// прыжок мастера на сотни раундов вперёд не превращается в неограниченный тик.
+const maxEncounterPassedTurns = 1000
+
+// encounterPassedActors — участники, чьи ходы пройдены при смене хода previous → t, в
+// порядке хода нового состояния: прежний активный, все пропущенные между ними (убитые,
+// выбывшие, прыжок через несколько шагов или раундов) и новый активный. Если прежний
+// активный выбыл, отсчёт идёт от его места в порядке. Откат назад и начало боя — одна
+// граница хода.
+func encounterPassedActors(state map[string]interface{}, previous, t encounterTurn) []string {
+	actors := []string{previous.ActorID}
+	raw, _ := state["combatants"].([]interface{})
+	if n := len(raw); n > 0 && previous.Round >= 1 && t.Round >= previous.Round {
+		actorAt := func(i int) string {
+			combatant, _ := raw[i].(map[string]interface{})
+			actorID, _ := combatant["actorId"].(string)
+			return actorID
+		}
+		start := previous.ActiveIndex - 1
+		for i := 0; i < n && previous.ActorID != ""; i++ {
+			if actorAt(i) == previous.ActorID {
+				start = i
+				break
+			}
+		}
+		rounds := t.Round - previous.Round
+		if rounds > maxEncounterPassedTurns {
+			rounds = maxEncounterPassedTurns
+		}
+		steps := rounds*n + t.ActiveIndex - start
+		if steps > maxEncounterPassedTurns {
+			steps = maxEncounterPassedTurns
+		}
+		for step := 1; step < steps; step++ {
+			actors = append(actors, actorAt(((start+step)%n+n)%n))
+		}
+	}
+	return append(actors, t.ActorID)
+}
+
+// expireEncounterPassedTurns тикает длительности на каждой границе хода между соседями
+// actors (encounterPassedActors), чтобы эффекты пропущенных участников тоже истекали.
+// Патчи сводятся к последнему списку activeEffects каждого участника; состояние не
+// мутируется.
+func expireEncounterPassedTurns(state map[string]interface{}, actors []string) ([]CombatantPatch, []BattleLogEntry) {
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	position := map[string]int{}
+	working := cloneEncounterTurnState(state)
+	for i := 0; i+1 < len(actors); i++ {
+		step, expired := expireEncounterTurnEffects(working, actors[i], actors[i+1])
+		if len(step) == 0 && len(expired) == 0 {
+			continue
+		}
+		working = applyOps(working, ApplyRequest{Patches: step})
+		for _, patch := range step {
+			if at, seen := position[patch.ActorID]; seen {
+				patches[at] = patch
+				continue
+			}
+			position[patch.ActorID] = len(patches)
+			patches = append(patches, patch)
+		}
+		log = append(log, expired...)
+	}
+	return patches, log
+}
+
+// cloneEncounterTurnState копирует список участников настолько, чтобы applyOps с патчами
+// не трогал карты исходного состояния.
+func cloneEncounterTurnState(state map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(state))
+	for key, value := range state {
+		out[key] = value
+	}
+	if raw, ok := state["combatants"].([]interface{}); ok {
+		combatants := make([]interface{}, len(raw))
+		for i, item := range raw {
+			if combatant, ok := item.(map[string]interface{}); ok {
+				combatants[i] = cloneEncounterEffect(combatant)
+				continue
+			}
+			combatants[i] = item
+		}
+		out["combatants"] = combatants
+	}
+	return out
+}
+
+// expireEncounterTurnEffects — ЧИСТЫЙ серверный тик длительностей на смене хода (зеркало
+// клиентских endTurn/startTurn и rules-core sourceTurnBoundary). ending — участник, чей ход
+// закончился, starting — чей начался:
+//   - у ending снимаются expiry:"end_of_turn", у starting — expiry:"start_of_next_turn";
+//   - roundsLeft списывается на начале хода владельца эффекта, ≤ 0 — эффект истёк;
+//   - sourceTurnExpiry: начало хода источника снимает boundary "start" и взводит "end",
+//     конец хода источника снимает взведённый "end".
+//
+// Возвращает патчи activeEffects (их тоже получают подписчики SSE в составе op) и записи
+// журнала effect_expired, адресованные персонажам. Состояние не мутируется.
+func expireEncounterTurnEffects(state map[string]interface{}, ending, starting string) ([]CombatantPatch, []BattleLogEntry) {
+	raw, ok := state["combatants"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	var patches []CombatantPatch
+	var log []BattleLogEntry
+	for _, item := range raw {
+		combatant, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		owner, _ := combatant["actorId"].(string)
+		effects, ok := combatant["activeEffects"].([]interface{})
+		if owner == "" || !ok || len(effects) == 0 {
+			continue
+		}
+		kept := make([]interface{}, 0, len(effects))
+		changed := false
+		for _, rawEffect := range effects {
+			effect, ok := rawEffect.(map[string]interface{})
+			if !ok {
+				kept = append(kept, rawEffect)
+				continue
+			}
+			next, expired := tickEncounterEffect(effect, owner, ending, starting)
+			if expired {
+				changed = true
+				name := stringField(effect, "name")
+				entry := BattleLogEntry{
+					Message: fmt.Sprintf("Эффект «%s» закончился: %s", name, stringFieldOr(combatant, "name", owner)),
+					Type:    "effect_expired",
+					Payload: JSONMap{"type": "effect_expired", "name": name},
+				}
+				if characterID, ok := combatant["characterId"].(string); ok {
+					entry.TargetCharacterID = characterID
+				}
+				log = append(log, entry)
+				continue
+			}
+			if next != nil {
+				changed = true
+				kept = append(kept, next)
+				continue
+			}
+			kept = append(kept, effect)
+		}
+		if changed {
+			patches = append(patches, CombatantPatch{ActorID: owner, Set: JSONMap{"activeEffects": kept}})
+		}
+	}
+	return patches, log
+}
+
+// tickEncounterEffect применяет границы хода к одному эффекту владельца owner. Возвращает
+// изменённую копию (nil — без изменений) или expired=true.
+func tickEncounterEffect(effect map[string]interface{}, owner, ending, starting string) (map[string]interface{}, bool) {
+	expiry := stringField(effect, "expiry")
+	if owner == ending && expiry == "end_of_turn" {
+		return nil, true
+	}
+
+	var next map[string]interface{}
+	if lifecycle, ok := effect["sourceTurnExpiry"].(map[string]interface{}); ok {
+		source := stringField(lifecycle, "sourceActorId")
+		matches := source != "" &&
+			stringField(lifecycle, "ownerActorId") == owner &&
+			stringField(effect, "sourceId") == source &&
+			stringField(effect, "ownerId") == owner
+		if matches {
+			boundary := stringField(lifecycle, "boundary")
+			armed, _ := lifecycle["armed"].(bool)
+			if source == ending && boundary == "end" && armed {
+				return nil, true
+			}
+			if source == starting {
+				if boundary == "start" {
+					return nil, true
+				}
+				if boundary == "end" && !armed {
+					next = cloneEncounterEffect(effect)
+					armedLifecycle := make(map[string]interface{}, len(lifecycle)+1)
+					for key, value := range lifecycle {
+						armedLifecycle[key] = value
+					}
+					armedLifecycle["armed"] = true
+					next["sourceTurnExpiry"] = armedLifecycle
+				}
+			}
+		}
+	}
+
+	if owner != starting {
+		return next, false
+	}
+	if expiry == "start_of_next_turn" {
+		return nil, true
+	}
+	if rounds, ok := encounterStateInt(effect["roundsLeft"]); ok && effect["roundsLeft"] != nil {
+		if rounds-1 <= 0 {
+			return nil, true
+		}
+		if next == nil {
+			next = cloneEncounterEffect(effect)
+		}
+		next["roundsLeft"] = float64(rounds - 1)
+	}
+	return next, false
+}
+
+func cloneEncounterEffect(effect map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(effect))
+	for key, value := range effect {
+		out[key] = value
+	}
+	return out
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Общая логика экипировки: совместимость предмета со слотом (EquipmentSlot),
+// хват одноручного, универсального и двуручного оружия, конфликт щита с
+// двуручным хватом и ограничение ЛВК по типу доспеха. Используется
+// CharacterV3 (POST /api/characters-v3/:id/equip), выводом КЗ и
+// инвентарём CharacterV2 (POST /api/characters-v2/:id/equip, расчёт защиты).
+
+// characterEquipmentSlots — слоты экипировки CharacterV3 (EQUIPMENT_SLOTS
+// клиента).
+var characterEquipmentSlots = []string{
+	"head", "body", "main_hand", "off_hand", "gloves", "boots", "cloak", "necklace", "ring_1", "ring_2",
+}
+
+// characterEquipmentSlotTargets — слоты CharacterV3, куда можно надеть
+// предмет со слотом EquipmentSlot.
+var characterEquipmentSlotTargets = map[EquipmentSlot][]string{
+	SlotHead:      {"head"},
+	SlotBody:      {"body"},
+	SlotArms:      {"gloves"},
+	SlotFeet:      {"boots"},
+	SlotCloak:     {"cloak"},
+	SlotNecklace:  {"necklace"},
+	SlotRing:      {"ring_1", "ring_2"},
+	SlotOneHand:   {"main_hand", "off_hand"},
+	SlotVersatile: {"main_hand", "off_hand"},
+	SlotTwoHands:  {"main_hand", "off_hand"},
+}
+
+// cardEquipmentTypeSlots — слот носимых предметов по типу карточки
+// (wearableSlot клиента).
+var cardEquipmentTypeSlots = map[string]EquipmentSlot{
+	"helmet":   SlotHead,
+	"chest":    SlotBody,
+	"gloves":   SlotArms,
+	"boots":    SlotFeet,
+	"cloak":    SlotCloak,
+	"necklace": SlotNecklace,
+	"ring":     SlotRing,
+	"weapon":   SlotOneHand,
+	"shield":   SlotOneHand,
+}
+
+// characterEquipmentError — предмет нельзя надеть или снять; Code уходит
+// клиенту кодом ошибки команды.
+type characterEquipmentError struct {
+	Code    string
+	Message string
+}
+
+func (e *characterEquipmentError) Error() string {
+	return e.Message
+}
+
+func cardIsShield(card Card) bool {
+	return (card.Type != nil && *card.Type == "shield") || (card.DefenseType != nil && *card.DefenseType == "shield")
+}
+
+func cardHasProperty(card Card, names ...string) bool {
+	if card.Properties == nil {
+		return false
+	}
+	for _, property := range *card.Properties {
+		for _, name := range names {
+			if strings.EqualFold(property, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cardEquipmentSlot определяет EquipmentSlot предмета. Щит — одноручный
+// предмет, доспех (defense_type) — тело. Хват оружия берётся из
+// weapon_profile (two_handed, versatile), иначе из slot и свойств карточки;
+// носимые предметы без slot распознаются по типу.
+func cardEquipmentSlot(card Card) (EquipmentSlot, error) {
+	if cardIsShield(card) {
+		return SlotOneHand, nil
+	}
+	if card.DefenseType != nil && *card.DefenseType != "" && *card.DefenseType != "none" {
+		return SlotBody, nil
+	}
+	if card.Type != nil && *card.Type == "weapon" && card.Mechanics != nil {
+		if profile, ok := (*card.Mechanics)["weapon_profile"].(map[string]interface{}); ok {
+			properties := stringList(profile["properties"])
+			switch {
+			case containsString(properties, "two_handed"):
+				return SlotTwoHands, nil
+			case containsString(properties, PropertyVersatile):
+				return SlotVersatile, nil
+			}
+			return SlotOneHand, nil
+		}
+	}
+	slot := EquipmentSlot("")
+	if card.Slot != nil {
+		slot = *card.Slot
+	}
+	if slot == "" && card.Type != nil {
+		slot = cardEquipmentTypeSlots[*card.Type]
+	}
+	if slot == SlotOneHand || slot == SlotVersatile || slot == SlotTwoHands {
+		switch {
+		case cardHasProperty(card, PropertyTwoHanded, "two_handed"):
+			slot = SlotTwoHands
+		case cardHasProperty(card, PropertyVersatile):
+			slot = SlotVersatile
+		}
+	}
+	if slot == "" || !IsValidEquipmentSlot(slot) {
+		return "", &characterEquipmentError{Code: "slot_unknown", Message: fmt.Sprintf("предмет «%s» нельзя надеть", card.Name)}
+	}
+	return slot, nil
+}
+
+// characterEquipPlan — экипировка после надевания предмета: занятые им
+// слоты и снятые предметы (их возвращают в сумку).
+type characterEquipPlan struct {
+	Equipment JSONMap
+	Slots     []string
+	Displaced []string
+}
+
+func equipmentSlotID(equipment JSONMap, slot string) string {
+	id, _ := equipment[slot].(string)
+	return id
+}
+
+// planCharacterEquip надевает предмет в слот slot (пусто — подходящий
+// свободный, как pickOneHandSlot клиента: щит в свободную вторую руку) и
+// снимает всё, что мешает: двуручный хват освобождает обе руки, предмет в
+// руке при двуручном хвате снимает оружие целиком, второй щит снимается.
+// twoHanded — хват универсального оружия двумя руками; cards — карточки
+// надетых предметов по id.
+func planCharacterEquip(equipment JSONMap, cards map[string]Card, card Card, slot string, twoHanded bool) (characterEquipPlan, error) {
+	kind, err := cardEquipmentSlot(card)
+	if err != nil {
+		return characterEquipPlan{}, err
+	}
+	if twoHanded && kind != SlotVersatile && kind != SlotTwoHands {
+		return characterEquipPlan{}, &characterEquipmentError{Code: "grip_invalid", Message: "двумя руками держат только универсальное оружие"}
+	}
+	allowed := characterEquipmentSlotTargets[kind]
+	if slot != "" && !containsString(allowed, slot) {
+		return characterEquipPlan{}, &characterEquipmentError{
+			Code:    "slot_incompatible",
+			Message: fmt.Sprintf("предмет «%s» нельзя надеть в слот %s", card.Name, slot),
+		}
+	}
+
+	plan := characterEquipPlan{Equipment: JSONMap{}}
+	for _, key := range characterEquipmentSlots {
+		if id := equipmentSlotID(equipment, key); id != "" {
+			plan.Equipment[key] = id
+		}
+	}
+	free := func(key string) bool { return equipmentSlotID(plan.Equipment, key) == "" }
+	switch {
+	case kind == SlotTwoHands || twoHanded:
+		plan.Slots = []string{"main_hand", "off_hand"}
+	case slot != "":
+		plan.Slots = []string{slot}
+	case kind == SlotRing:
+		plan.Slots = []string{"ring_1"}
+		if !free("ring_1") && free("ring_2") {
+			plan.Slots = []string{"ring_2"}
+		}
+	case len(allowed) == 2:
+		target := "main_hand"
+		switch {
+		case cardIsShield(card) && !free("main_hand"):
+			target = "off_hand"
+		case !free("main_hand") && free("off_hand"):
+			target = "off_hand"
+		}
+		plan.Slots = []string{target}
+	default:
+		plan.Slots = allowed
+	}
+
+	displace := func(key string) {
+		id := equipmentSlotID(plan.Equipment, key)
+		if id == "" {
+			return
+		}
+		if (key == "main_hand" || key == "off_hand") && equipmentSlotID(plan.Equipment, "main_hand") == equipmentSlotID(plan.Equipment, "off_hand") {
+			delete(plan.Equipment, "main_hand")
+			delete(plan.Equipment, "off_hand")
+		} else {
+			delete(plan.Equipment, key)
+		}
+		plan.Displaced = append(plan.Displaced, id)
+	}
+	for _, key := range plan.Slots {
+		displace(key)
+	}
+	if cardIsShield(card) && len(plan.Slots) == 1 {
+		other := "main_hand"
+		if plan.Slots[0] == "main_hand" {
+			other = "off_hand"
+		}
+		if occupant, known := cards[equipmentSlotID(plan.Equipment, other)]; known && cardIsShield(occupant) {
+			displace(other)
+		}
+	}
+	for _, key := range plan.Slots {
+		plan.Equipment[key] = card.ID.String()
+	}
+	return plan, nil
+}
+
+// characterUnequipSlot освобождает слот; двуручный хват освобождает обе
+// руки. Возвращает снятый предмет (пусто — слот был свободен).
+func characterUnequipSlot(equipment JSONMap, slot string) (JSONMap, string) {
+	result := JSONMap{}
+	for _, key := range characterEquipmentSlots {
+		if id := equipmentSlotID(equipment, key); id != "" {
+			result[key] = id
+		}
+	}
+	id := equipmentSlotID(result, slot)
+	if id == "" {
+		return result, ""
+	}
+	delete(result, slot)
+	if (slot == "main_hand" || slot == "off_hand") && equipmentSlotID(result, "main_hand") == id {
+		delete(result, "main_hand")
+	}
+	if (slot == "main_hand" || slot == "off_hand") && equipmentSlotID(result, "off_hand") == id {
+		delete(result, "off_hand")
+	}
+	return result, id
+}
+
+// inventorySlotKinds — слоты экипировки инвентаря CharacterV2
+// (InventoryItem.EquippedSlot) и виды предметов, которые в них надеваются.
+// Оружейные слоты разделены на ряды ближнего и дальнего боя; one_hand,
+// versatile и two_hands без ряда — старый формат.
+var inventorySlotKinds = map[string][]EquipmentSlot{
+	"head":             {SlotHead},
+	"body":             {SlotBody},
+	"arms":             {SlotArms},
+	"feet":             {SlotFeet},
+	"cloak":            {SlotCloak},
+	"necklace":         {SlotNecklace},
+	"ring":             {SlotRing},
+	"one_hand":         {SlotOneHand, SlotVersatile},
+	"melee_one_hand":   {SlotOneHand, SlotVersatile},
+	"ranged_one_hand":  {SlotOneHand, SlotVersatile},
+	"versatile":        {SlotVersatile},
+	"two_hands":        {SlotTwoHands, SlotVersatile},
+	"melee_two_hands":  {SlotTwoHands, SlotVersatile},
+	"ranged_two_hands": {SlotTwoHands, SlotVersatile},
+}
+
+// cardWeaponRange — ряд оружия: дальнобойное по тегу «Дальнобойное» или
+// свойствам ammunition/loading, иначе ближний бой. Не оружие — пусто.
+func cardWeaponRange(card Card) string {
+	if card.Type == nil || *card.Type != "weapon" {
+		return ""
+	}
+	if card.Tags != nil {
+		for _, tag := range *card.Tags {
+			switch tag {
+			case "Дальнобойное":
+				return "ranged"
+			case "Ближнее":
+				return "melee"
+			}
+		}
+	}
+	if cardHasProperty(card, "ammunition", "loading") {
+		return "ranged"
+	}
+	return "melee"
+}
+
+// inventorySlotRow — ряд оружия, к которому относится предмет в слоте: ряд
+// из имени слота, для старого формата — по оружию (щит держат в ряду
+// ближнего боя). Слоты вне рук — пусто.
+func inventorySlotRow(slot string, card Card) string {
+	switch {
+	case strings.HasPrefix(slot, "melee_"):
+		return "melee"
+	case strings.HasPrefix(slot, "ranged_"):
+		return "ranged"
+	case slot == "one_hand" || slot == "versatile" || slot == "two_hands":
+		if cardIsShield(card) {
+			return "melee"
+		}
+		return cardWeaponRange(card)
+	}
+	return ""
+}
+
+// inventorySlotTwoHanded — предмет держат двумя руками: двуручный слот или
+// двуручное оружие.
+func inventorySlotTwoHanded(slot string, card Card) bool {
+	if strings.HasSuffix(slot, "two_hands") {
+		return true
+	}
+	kind, err := cardEquipmentSlot(card)
+	return err == nil && kind == SlotTwoHands
+}
+
+// planInventoryEquip — надетые предметы инвентаря CharacterV2, которые
+// снимаются при надевании card в слот slot: предмет того же слота, оружие
+// того же ряда (в ряду одно оружие) и щит при двуручном хвате в ряду.
+// Предмет должен подходить слоту по cardEquipmentSlot.
+func planInventoryEquip(equipped []InventoryItem, card Card, slot string) ([]InventoryItem, error) {
+	kind, err := cardEquipmentSlot(card)
+	if err != nil {
+		return nil, err
+	}
+	accepted := false
+	for _, candidate := range inventorySlotKinds[slot] {
+		accepted = accepted || candidate == kind
+	}
+	if !accepted {
+		return nil, &characterEquipmentError{
+			Code:    "slot_incompatible",
+			Message: fmt.Sprintf("предмет «%s» нельзя надеть в слот %s", card.Name, slot),
+		}
+	}
+	row := inventorySlotRow(slot, card)
+	var displaced []InventoryItem
+	for _, item := range equipped {
+		if item.EquippedSlot == nil || item.ID == uuid.Nil {
+			continue
+		}
+		occupied := *item.EquippedSlot
+		conflict := occupied == slot
+		if !conflict && row != "" && inventorySlotRow(occupied, item.Card) == row {
+			weapons := cardWeaponRange(card) != "" && cardWeaponRange(item.Card) != ""
+			shieldGrip := (cardIsShield(card) && inventorySlotTwoHanded(occupied, item.Card)) ||
+				(cardIsShield(item.Card) && inventorySlotTwoHanded(slot, card))
+			conflict = weapons || shieldGrip
+		}
+		if conflict {
+			displaced = append(displaced, item)
+		}
+	}
+	return displaced, nil
+}
+
+// cardArmorDefenseType — тип доспеха: defense_type карточки, иначе свойства
+// cloth/light_armor/medium_armor/heavy_armor (старый формат карточек).
+func cardArmorDefenseType(card Card) string {
+	if card.DefenseType != nil && *card.DefenseType != "" {
+		return *card.DefenseType
+	}
+	switch {
+	case cardHasProperty(card, PropertyHeavyArmor):
+		return "heavy"
+	case cardHasProperty(card, PropertyMediumArmor):
+		return "medium"
+	case cardHasProperty(card, PropertyLightArmor):
+		return "light"
+	case cardHasProperty(card, PropertyCloth):
+		return "cloth"
+	}
+	return ""
+}
+
+// armorDexterityBonus — вклад ЛВК в КЗ доспеха: ткань и лёгкий доспех —
+// модификатор полностью, средний — не больше +2, тяжёлый — ничего.
+// ok=false — тип доспеха неизвестен.
+func armorDexterityBonus(defenseType string, dex int) (int, bool) {
+	switch defenseType {
+	case "cloth", "light":
+		return dex, true
+	case "medium":
+		return min(dex, 2), true
+	case "heavy":
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func equipmentTestCard(name, cardType string, slot EquipmentSlot, properties ...string) Card {
+	card := Card{ID: uuid.New(), Name: name, Type: &cardType}
+	if slot != "" {
+		card.Slot = &slot
+	}
+	if len(properties) > 0 {
+		list := Properties(properties)
+		card.Properties = &list
+	}
+	return card
+}
+
+func TestCardEquipmentSlot(t *testing.T) {
+	shieldType := "shield"
+	medium := "medium"
+	profile := JSONMap(mustMechanicsJSON(t, `{"weapon_profile":{"properties":["heavy","two_handed"]}}`))
+	greatsword := equipmentTestCard("Двуручный меч", "weapon", SlotOneHand)
+	greatsword.Mechanics = &profile
+	cases := []struct {
+		card Card
+		want EquipmentSlot
+	}{
+		{equipmentTestCard("Щит", "armor", "", "shield"), ""},
+		{Card{Name: "Щит", Type: &shieldType}, SlotOneHand},
+		{Card{Name: "Кольчужная рубаха", DefenseType: &medium}, SlotBody},
+		{greatsword, SlotTwoHands},
+		{equipmentTestCard("Длинный меч", "weapon", SlotOneHand, PropertyVersatile), SlotVersatile},
+		{equipmentTestCard("Кольцо защиты", "ring", ""), SlotRing},
+		{equipmentTestCard("Сапоги", "boots", ""), SlotFeet},
+	}
+	for _, tc := range cases {
+		got, err := cardEquipmentSlot(tc.card)
+		if tc.want == "" {
+			if err == nil {
+				t.Fatalf("%s: want error, got %s", tc.card.Name, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%s: want %s, got %s (%v)", tc.card.Name, tc.want, got, err)
+		}
+	}
+}
+
+func TestPlanCharacterEquipHands(t *testing.T) {
+	shieldType := "shield"
+	shield := Card{ID: uuid.New(), Name: "Щит", Type: &shieldType}
+	dagger := equipmentTestCard("Кинжал", "weapon", SlotOneHand)
+	longsword := equipmentTestCard("Длинный меч", "weapon", SlotVersatile)
+	greataxe := equipmentTestCard("Секира", "weapon", SlotTwoHands)
+	cards := map[string]Card{}
+	for _, card := range []Card{shield, dagger, longsword, greataxe} {
+		cards[card.ID.String()] = card
+	}
+
+	plan, err := planCharacterEquip(JSONMap{"main_hand": dagger.ID.String(), "off_hand": shield.ID.String()}, cards, greataxe, "", false)
+	if err != nil || len(plan.Displaced) != 2 || plan.Equipment["main_hand"] != greataxe.ID.String() || plan.Equipment["off_hand"] != greataxe.ID.String() {
+		t.Fatalf("two-handed weapon frees both hands: %+v %v", plan, err)
+	}
+
+	plan, err = planCharacterEquip(plan.Equipment, cards, shield, "", false)
+	if err != nil || len(plan.Displaced) != 1 || plan.Displaced[0] != greataxe.ID.String() ||
+		plan.Equipment["off_hand"] != shield.ID.String() || plan.Equipment["main_hand"] != nil {
+		t.Fatalf("shield removes a two-handed grip entirely: %+v %v", plan, err)
+	}
+
+	plan, err = planCharacterEquip(JSONMap{"main_hand": dagger.ID.String()}, cards, longsword, "", true)
+	if err != nil || plan.Equipment["off_hand"] != longsword.ID.String() || len(plan.Displaced) != 1 {
+		t.Fatalf("versatile weapon held in two hands: %+v %v", plan, err)
+	}
+	plan, err = planCharacterEquip(JSONMap{"main_hand": dagger.ID.String()}, cards, longsword, "", false)
+	if err != nil || plan.Slots[0] != "off_hand" || len(plan.Displaced) != 0 {
+		t.Fatalf("one-handed grip takes the free hand: %+v %v", plan, err)
+	}
+
+	plan, err = planCharacterEquip(JSONMap{"main_hand": shield.ID.String()}, cards, shield, "off_hand", false)
+	if err != nil || len(plan.Displaced) != 1 || plan.Equipment["main_hand"] != nil {
+		t.Fatalf("only one shield at a time: %+v %v", plan, err)
+	}
+
+	var equipErr *characterEquipmentError
+	if _, err := planCharacterEquip(JSONMap{}, cards, dagger, "", true); !errors.As(err, &equipErr) || equipErr.Code != "grip_invalid" {
+		t.Fatalf("two-handed grip needs a versatile weapon, got %v", err)
+	}
+	if _, err := planCharacterEquip(JSONMap{}, cards, dagger, "head", false); !errors.As(err, &equipErr) || equipErr.Code != "slot_incompatible" {
+		t.Fatalf("weapon cannot go to head, got %v", err)
+	}
+}
+
+func TestPlanCharacterEquipRingsAndUnequip(t *testing.T) {
+	first := equipmentTestCard("Кольцо I", "ring", SlotRing)
+	second := equipmentTestCard("Кольцо II", "ring", SlotRing)
+	third := equipmentTestCard("Кольцо III", "ring", SlotRing)
+
+	plan, _ := planCharacterEquip(JSONMap{"ring_1": first.ID.String()}, nil, second, "", false)
+	if plan.Slots[0] != "ring_2" || len(plan.Displaced) != 0 {
+		t.Fatalf("second ring takes the free finger: %+v", plan)
+	}
+	plan, _ = planCharacterEquip(plan.Equipment, nil, third, "", false)
+	if plan.Slots[0] != "ring_1" || len(plan.Displaced) != 1 || plan.Displaced[0] != first.ID.String() {
+		t.Fatalf("third ring replaces ring_1: %+v", plan)
+	}
+
+	sword := uuid.NewString()
+	equipment, removed := characterUnequipSlot(JSONMap{"main_hand": sword, "off_hand": sword, "head": "x"}, "off_hand")
+	if removed != sword || equipment["main_hand"] != nil || equipment["head"] != "x" {
+		t.Fatalf("unequipping a two-handed grip frees both hands: %v %s", equipment, removed)
+	}
+}
+
+func TestCharacterInventoryTakeAndPut(t *testing.T) {
+	potion, bag := uuid.NewString(), uuid.NewString()
+	rows := InventoryItemRows{{CardID: potion, Qty: 1, ContainerID: bag}, {CardID: potion, Qty: 1}}
+	rows, ok := takeCharacterInventoryItem(rows, potion)
+	if !ok || len(rows) != 1 || rows[0].ContainerID != bag {
+		t.Fatalf("take prefers the top level: %+v", rows)
+	}
+	rows = putCharacterInventoryItem(rows, potion)
+	rows = putCharacterInventoryItem(rows, potion)
+	if len(rows) != 2 || rows[1].Qty != 2 || rows[1].ContainerID != "" {
+		t.Fatalf("put stacks on the top level: %+v", rows)
+	}
+	if _, ok := takeCharacterInventoryItem(InventoryItemRows{{CardID: potion, Qty: 0}}, potion); ok {
+		t.Fatal("bond rows hold no item")
+	}
+}
+
+func TestCharacterArmorClassDexterityCap(t *testing.T) {
+	character := derivationTestCharacter(t, 1, `{"str":10,"dex":18,"con":10,"int":10,"wis":10,"cha":10}`, `{}`)
+	cases := []struct {
+		defense, value string
+		want           int
+	}{
+		{"light", "11", 15},
+		{"medium", "14", 16},
+		{"heavy", "18", 18},
+		{"medium", "14+min(dex,2)", 16},
+	}
+	for _, tc := range cases {
+		defense, value := tc.defense, tc.value
+		input := derivationTestInput(character)
+		input.Armor = &Card{Name: "Доспех", BonusValue: &value, DefenseType: &defense}
+		if got := deriveCharacterStats(input).Stats.ArmorClass; got != tc.want {
+			t.Fatalf("%s %s: want AC %d, got %d", tc.defense, tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestPlanInventoryEquipRows(t *testing.T) {
+	shieldType := "shield"
+	equippedItem := func(card Card, slot string) InventoryItem {
+		return InventoryItem{ID: uuid.New(), Card: card, IsEquipped: true, EquippedSlot: &slot}
+	}
+	bowCard := equipmentTestCard("Длинный лук", "weapon", SlotTwoHands, "ammunition")
+	dagger := equippedItem(equipmentTestCard("Кинжал", "weapon", SlotOneHand), "melee_one_hand")
+	bow := equippedItem(bowCard, "ranged_two_hands")
+	shield := equippedItem(Card{ID: uuid.New(), Name: "Щит", Type: &shieldType}, "one_hand")
+	helmet := equippedItem(equipmentTestCard("Шлем", "helmet", ""), "head")
+	equipped := []InventoryItem{dagger, bow, shield, helmet}
+
+	greataxe := equipmentTestCard("Секира", "weapon", SlotTwoHands)
+	if _, err := planInventoryEquip(equipped, greataxe, "melee_one_hand"); err == nil {
+		t.Fatal("two-handed weapon accepted into a one-hand slot")
+	}
+	var equipErr *characterEquipmentError
+	if _, err := planInventoryEquip(equipped, helmet.Card, "body"); !errors.As(err, &equipErr) || equipErr.Code != "slot_incompatible" {
+		t.Fatalf("helmet on the body: %v", err)
+	}
+
+	displaced, err := planInventoryEquip(equipped, greataxe, "melee_two_hands")
+	if err != nil || len(displaced) != 2 || displaced[0].ID != dagger.ID || displaced[1].ID != shield.ID {
+		t.Fatalf("two-handed grip clears the melee row and the shield, keeps the bow: %+v %v", displaced, err)
+	}
+	longsword := equipmentTestCard("Длинный меч", "weapon", SlotVersatile)
+	displaced, err = planInventoryEquip(equipped, longsword, "melee_one_hand")
+	if err != nil || len(displaced) != 1 || displaced[0].ID != dagger.ID {
+		t.Fatalf("one weapon per row, the shield stays: %+v %v", displaced, err)
+	}
+	crossbow := equipmentTestCard("Лёгкий арбалет", "weapon", SlotTwoHands, "ammunition", "loading")
+	displaced, err = planInventoryEquip(equipped, crossbow, "two_hands")
+	if err != nil || len(displaced) != 1 || displaced[0].ID != bow.ID {
+		t.Fatalf("legacy slot finds the ranged row by the weapon: %+v %v", displaced, err)
+	}
+}
+
+func TestCharacterV2ArmorClassUsesDefenseType(t *testing.T) {
+	medium, defense, value := "medium", BonusDefense, "14"
+	slot := "body"
+	armor := InventoryItem{IsEquipped: true, EquippedSlot: &slot, Card: Card{Name: "Кольчужная рубаха", DefenseType: &medium, BonusType: &defense, BonusValue: &value}}
+	controller := &CharacterV2Controller{}
+	result := controller.CalculateArmorClass(&CharacterV2{Dexterity: 18}, []Inventory{{Items: []InventoryItem{armor}}})
+	if result.FinalAC != 16 || result.ArmorType != "Средняя броня" || result.Details.MaxDexBonus == nil || *result.Details.MaxDexBonus != 2 {
+		t.Fatalf("medium armor by defense_type caps Dexterity at +2: %+v", result)
+	}
+}
@@ -34,9 +34,10 @@ func (gc *GroupController) CreateGroup(c *gin.Context) {
 
 	// Создаем группу
 	group := Group{
-		Name:        req.Name,
-		Description: req.Description,
-		DMID:        userID, // Создатель группы становится ДМом
+		Name:               req.Name,
+		Description:        req.Description,
+		DMID:               userID, // Создатель группы становится ДМом
+		VariantEncumbrance: req.VariantEncumbrance,
 	}
 
 	if err := gc.db.Create(&group).Error; err != nil {
@@ -122,6 +123,56 @@ func (gc *GroupController) GetGroup(c *gin.Context) {
 	c.JSON(http.StatusOK, group)
 }
 
+// UpdateGroupRules - изменение правил группы (только ДМ)
+func (gc *GroupController) UpdateGroupRules(c *gin.Context) {
+	userID, err := GetCurrentUserID(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не авторизован"})
+		return
+	}
+
+	groupIDStr := c.Param("id")
+	groupID, err := uuid.Parse(groupIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID группы"})
+		return
+	}
+
+	var req UpdateGroupRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверные данные запроса: " + err.Error()})
+		return
+	}
+
+	var group Group
+	if err := gc.db.First(&group, groupID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "группа не найдена"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка получения группы"})
+		return
+	}
+
+	// Правила меняет только ДМ группы
+	if group.DMID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "правила группы может менять только ДМ"})
+		return
+	}
+
+	if err := gc.db.Model(&group).Update("variant_encumbrance", *req.VariantEncumbrance).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка обновления правил группы"})
+		return
+	}
+
+	if err := gc.db.Preload("DM").Preload("Members.User").First(&group, group.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка загрузки данных группы"})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
 // JoinGroup - присоединение к группе
 func (gc *GroupController) JoinGroup(c *gin.Context) {
 	userID, err := GetCurrentUserID(c)
@@ -60,6 +60,12 @@ func main() {
 	}
 	log.Println("Миграции выполнены успешно")
 
+	// Импорт статблоков из файлов без запуска сервера:
+	// go run . import-monsters [-dry-run] [-source S] [-json] файлы...
+	if len(os.Args) > 1 && os.Args[1] == "import-monsters" {
+		os.Exit(runMonsterImportCLI(db, os.Args[2:], os.Stdout))
+	}
+
 	// Настройка Gin
 	r := gin.Default()
 	if err := configureTrustedClientIPs(r); err != nil {
@@ -122,12 +128,14 @@ func main() {
 	contentMigrationController := NewContentMigrationController(db)
 	canonicalSessionController := NewCanonicalSessionController(db)
 	monsterController := NewMonsterController(db)
+	diceController := NewDiceController()
 
 	// Онлайн-бои: серверная истина + realtime-рассылка (SSE + Postgres LISTEN/NOTIFY).
 	encounterHub := NewEncounterHub(dbConfig.GetDSN())
 	encounterHub.StartListener(db)
 	encounterInviteService := NewEncounterInviteService()
 	encounterController := NewEncounterController(db, encounterHub, encounterInviteService)
+	encounterTemplateController := NewEncounterTemplateController(db)
 
 	// Health check endpoint
 	r.GET("/api/health", func(c *gin.Context) {
@@ -171,6 +179,12 @@ func main() {
 		// Магазины (публичные ссылки на просмотр, создание за авторизацией)
 		api.GET("/shops/:slug", shopController.GetShop)
 
+		// Броски кубов: без состояния, поэтому без авторизации (общий лимит мутаций api).
+		api.POST("/dice/roll", RequestBodyLimitMiddleware(maxDiceRollBodyBytes), diceController.Roll)
+
+		// Версия схемы механик: фронтенд сверяет её со своей копией.
+		api.GET("/mechanics/schema", GetMechanicsSchemaVersion)
+
 		// Карточки (публичные, но с опциональной авторизацией)
 		api.GET("/cards", OptionalAuthMiddleware(authService), cardController.GetCards)
 		api.GET("/cards/:id", OptionalAuthMiddleware(authService), cardController.GetCard)
@@ -192,7 +206,9 @@ func main() {
 		// Монстры — data-driven stat blocks, ссылающиеся на общие действия и эффекты.
 		api.GET("/monsters", OptionalAuthMiddleware(authService), monsterController.List)
 		api.GET("/monsters/:id", OptionalAuthMiddleware(authService), monsterController.Get)
+		api.GET("/monsters/:id/statblock", OptionalAuthMiddleware(authService), monsterController.StatBlock)
 		api.POST("/monsters", contentAdminAuth, monsterController.Create)
+		api.POST("/monsters/import", contentAdminAuth, monsterController.Import)
 		api.PUT("/monsters/:id", contentAdminAuth, monsterController.Update)
 		api.DELETE("/monsters/:id", contentAdminAuth, monsterController.Delete)
 
@@ -282,13 +298,32 @@ func main() {
 		encounterAuth := StrictAuthMiddleware(authService)
 		api.POST("/encounters", encounterAuth, encounterController.Create)
 		api.GET("/encounters", encounterAuth, encounterController.List)
+		api.POST("/encounters/difficulty", encounterAuth, JSONBodyLimitMiddleware(maxEncounterDifficultyBodyBytes), RequestBodyLimitMiddleware(maxEncounterDifficultyBodyBytes), encounterController.Difficulty)
+		api.POST("/encounters/generate", encounterAuth, JSONBodyLimitMiddleware(maxEncounterGenerateBodyBytes), RequestBodyLimitMiddleware(maxEncounterGenerateBodyBytes), encounterController.Generate)
 		api.GET("/encounters/:id", encounterAuth, encounterController.Get)
 		api.DELETE("/encounters/:id", encounterAuth, encounterController.Delete)
 		api.GET("/encounters/:id/events", encounterAuth, encounterController.Events)
+		api.GET("/encounters/:id/statblocks", encounterAuth, encounterController.StatBlocks)
 		api.POST("/encounters/:id/invite", encounterAuth, encounterController.IssueInvite)
 		api.POST("/encounters/:id/join", encounterAuth, RequestBodyLimitMiddleware(8<<10), encounterController.Join)
 		api.POST("/encounters/:id/apply", encounterAuth, JSONBodyLimitMiddleware(maxEncounterApplyBodyBytes), RequestBodyLimitMiddleware(maxEncounterApplyBodyBytes), encounterController.Apply)
+		api.POST("/encounters/:id/concentration-save", encounterAuth, JSONBodyLimitMiddleware(maxEncounterConcentrationSaveBodyBytes), RequestBodyLimitMiddleware(maxEncounterConcentrationSaveBodyBytes), encounterController.ResolveConcentrationSave)
+		api.POST("/encounters/:id/saves", encounterAuth, JSONBodyLimitMiddleware(maxEncounterSaveBodyBytes), RequestBodyLimitMiddleware(maxEncounterSaveBodyBytes), encounterController.OpenEncounterSaves)
+		api.POST("/encounters/:id/saves/resolve", encounterAuth, JSONBodyLimitMiddleware(maxEncounterSaveBodyBytes), RequestBodyLimitMiddleware(maxEncounterSaveBodyBytes), encounterController.ResolveEncounterSave)
+		api.POST("/encounters/:id/attack", encounterAuth, JSONBodyLimitMiddleware(maxEncounterAttackBodyBytes), RequestBodyLimitMiddleware(maxEncounterAttackBodyBytes), encounterController.Attack)
+		api.POST("/encounters/:id/initiative", encounterAuth, JSONBodyLimitMiddleware(maxEncounterInitiativeBodyBytes), RequestBodyLimitMiddleware(maxEncounterInitiativeBodyBytes), encounterController.Initiative)
+		api.POST("/encounters/:id/monster-turn", encounterAuth, JSONBodyLimitMiddleware(maxEncounterMonsterTurnBodyBytes), RequestBodyLimitMiddleware(maxEncounterMonsterTurnBodyBytes), encounterController.MonsterTurn)
 		api.GET("/encounters/:id/stream", encounterAuth, encounterController.Stream)
+		api.POST("/encounters/:id/conclude", encounterAuth, JSONBodyLimitMiddleware(maxEncounterConcludeBodyBytes), RequestBodyLimitMiddleware(maxEncounterConcludeBodyBytes), encounterController.Conclude)
+
+		// Заготовки столкновений мастера: владелец и мастера группы, с которой
+		// поделились заготовкой (проверяет контроллер).
+		api.GET("/encounter-templates", encounterAuth, encounterTemplateController.List)
+		api.POST("/encounter-templates", encounterAuth, JSONBodyLimitMiddleware(maxEncounterTemplateBodyBytes), RequestBodyLimitMiddleware(maxEncounterTemplateBodyBytes), encounterTemplateController.Create)
+		api.GET("/encounter-templates/:id", encounterAuth, encounterTemplateController.Get)
+		api.PUT("/encounter-templates/:id", encounterAuth, JSONBodyLimitMiddleware(maxEncounterTemplateBodyBytes), RequestBodyLimitMiddleware(maxEncounterTemplateBodyBytes), encounterTemplateController.Update)
+		api.DELETE("/encounter-templates/:id", encounterAuth, encounterTemplateController.Delete)
+		api.POST("/encounter-templates/:id/spawn", encounterAuth, RequestBodyLimitMiddleware(maxEncounterTemplateSpawnBytes), encounterTemplateController.Spawn)
 
 		// CharacterV3 содержит пользовательские листы и журналы. Весь контур
 		// требует строгий JWT; контроллер разрешает authenticated read старых
@@ -329,6 +364,7 @@ func main() {
 			protected.POST("/groups", groupController.CreateGroup)
 			protected.GET("/groups", groupController.GetGroups)
 			protected.GET("/groups/:id", groupController.GetGroup)
+			protected.PUT("/groups/:id/rules", groupController.UpdateGroupRules)
 			protected.POST("/groups/join", groupController.JoinGroup)
 			protected.DELETE("/groups/:id/leave", groupController.LeaveGroup)
 			protected.GET("/groups/:id/members", groupController.GetGroupMembers)
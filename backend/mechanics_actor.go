@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+var abilityKeys = []string{"str", "dex", "con", "int", "wis", "cha"}
+
+// mechanicsActor — участник, против которого сервер исполняет механику. Это
+// плоская проекция CharacterV3 или Monster: только факты, нужные формулам,
+// броскам и поправкам урона. Проекция не хранится — её собирают на каждый
+// прогон из строк БД и активных эффектов.
+type mechanicsActor struct {
+	ID                  string
+	Name                string
+	IsMonster           bool
+	Level               int
+	ProficiencyBonus    int
+	ArmorClass          int
+	Speed               int
+	HP                  int
+	MaxHP               int
+	TempHP              int
+	Abilities           map[string]int
+	SpellcastingAbility string
+	SaveProficiencies   map[string]bool
+	Resistances         map[string]bool
+	Immunities          map[string]bool
+	Vulnerabilities     map[string]bool
+	ConditionImmunities map[string]bool
+	Conditions          map[string]bool
+	// ClassLevels — уровни по классам для class_level:<id> (ключ — classLevelKey).
+	ClassLevels map[string]int
+	// Variables — значения переменных персонажа: снимок rule_state.variables,
+	// поверх которого вызывающий код может свернуть эффекты (collectFormulaVariables).
+	Variables map[string]formulaVariable
+}
+
+func newMechanicsActor(id, name string) mechanicsActor {
+	return mechanicsActor{
+		ID: id, Name: name, Level: 1, ProficiencyBonus: 2, ArmorClass: 10,
+		Abilities:           map[string]int{},
+		SaveProficiencies:   map[string]bool{},
+		Resistances:         map[string]bool{},
+		Immunities:          map[string]bool{},
+		Vulnerabilities:     map[string]bool{},
+		ConditionImmunities: map[string]bool{},
+		Conditions:          map[string]bool{},
+		ClassLevels:         map[string]int{},
+		Variables:           map[string]formulaVariable{},
+	}
+}
+
+// mechanicsActorFromCharacter собирает проекцию листа v3. Активные эффекты
+// дают состояния и поправки урона; rule_state — заклинательную характеристику
+// и переменные, посчитанные при сборке персонажа.
+func mechanicsActorFromCharacter(character CharacterV3) mechanicsActor {
+	actor := newMechanicsActor(character.ID.String(), character.Name)
+	if character.Level > 0 {
+		actor.Level = character.Level
+	}
+	if character.ProficiencyBonus > 0 {
+		actor.ProficiencyBonus = character.ProficiencyBonus
+	}
+	actor.ArmorClass = character.ArmorClass
+	actor.Speed = character.Speed
+	actor.HP = character.CurrentHP
+	actor.MaxHP = character.MaxHP
+	actor.TempHP = int(characterTempHP(character))
+	actor.readAbilityScores(character.Abilities)
+	if character.SavingThrowProficiencies != nil {
+		for _, ability := range *character.SavingThrowProficiencies {
+			actor.SaveProficiencies[strings.ToLower(ability)] = true
+		}
+	}
+	if character.RuleState != nil {
+		state := *character.RuleState
+		// rule_state.abilities — итоговые значения с бонусами вида и черт;
+		// колонка abilities хранит только введённые базовые.
+		if final, ok := state["abilities"].(map[string]interface{}); ok {
+			for _, key := range abilityKeys {
+				if value, ok := mechanicsNumber(final[key]); ok && value > 0 {
+					actor.Abilities[key] = int(value)
+				}
+			}
+		}
+		if spellcasting, ok := state["spellcasting"].(map[string]interface{}); ok {
+			if ability, ok := spellcasting["ability"].(string); ok {
+				actor.SpellcastingAbility = ability
+			}
+		}
+		if proficiencies, ok := state["proficiencies"].(map[string]interface{}); ok {
+			if saves, ok := proficiencies["savingThrows"].([]interface{}); ok {
+				for _, raw := range saves {
+					if ability, ok := raw.(string); ok {
+						actor.SaveProficiencies[ability] = true
+					}
+				}
+			}
+		}
+		if variables, ok := state["variables"].(map[string]interface{}); ok {
+			for key, raw := range variables {
+				if value, ok := parseFormulaVariable(raw, ""); ok {
+					actor.Variables[key] = value
+				}
+			}
+		}
+	}
+	if character.ActiveEffects != nil {
+		for _, row := range *character.ActiveEffects {
+			actor.absorbActiveEffect(row.Mechanics)
+		}
+	}
+	return actor
+}
+
+// mechanicsActorFromMonster собирает проекцию монстра. Пассивные механики его
+// эффектов (EffectIDs) вызывающий код передаёт уже загруженными.
+func mechanicsActorFromMonster(monster Monster, passives ...JSONMap) mechanicsActor {
+	actor := newMechanicsActor(monster.ID.String(), monster.Name)
+	actor.IsMonster = true
+	actor.ProficiencyBonus = monster.ProficiencyBonus
+	actor.ArmorClass = monster.ArmorClass
+	actor.Speed = monster.Speed
+	actor.HP = monster.MaxHP
+	actor.MaxHP = monster.MaxHP
+	actor.readAbilityScores(monster.Abilities)
+	for _, mechanics := range passives {
+		actor.absorbPassiveMechanics(mechanics)
+	}
+	return actor
+}
+
+// formulaContext — окружение формулы, которое даёт сам участник.
+func (a mechanicsActor) formulaContext() formulaContext {
+	mods := make(map[string]int, len(abilityKeys))
+	for _, key := range abilityKeys {
+		mods[key] = a.abilityModifier(key)
+	}
+	return formulaContext{
+		AbilityMods:     mods,
+		ProfBonus:       a.ProficiencyBonus,
+		SelfLevel:       a.Level,
+		ClassLevels:     a.ClassLevels,
+		SpellcastingMod: a.abilityModifier("spellcasting"),
+		CharacterSpeed:  a.Speed,
+		Variables:       a.Variables,
+	}
+}
+
+func (a *mechanicsActor) readAbilityScores(abilities *JSONMap) {
+	for _, key := range abilityKeys {
+		a.Abilities[key] = 10
+		if abilities == nil {
+			continue
+		}
+		if value, ok := mechanicsNumber((*abilities)[key]); ok {
+			a.Abilities[key] = int(value)
+		}
+	}
+}
+
+// abilityModifier — модификатор характеристики; "spellcasting" раскрывается в
+// заклинательную характеристику, "dex_or_str"/"auto" — в лучшую из СИЛ/ЛВК.
+func (a mechanicsActor) abilityModifier(ability string) int {
+	switch ability {
+	case "spellcasting":
+		if a.SpellcastingAbility == "" {
+			return 0
+		}
+		ability = a.SpellcastingAbility
+	case "dex_or_str", "auto", "finesse":
+		if a.abilityModifier("dex") > a.abilityModifier("str") {
+			return a.abilityModifier("dex")
+		}
+		return a.abilityModifier("str")
+	}
+	score, ok := a.Abilities[ability]
+	if !ok {
+		score = 10
+	}
+	return abilityScoreModifier(score)
+}
+
+func abilityScoreModifier(score int) int {
+	// Целочисленное деление в Go округляет к нулю, а модификатор — вниз.
+	difference := score - 10
+	if difference < 0 {
+		return (difference - 1) / 2
+	}
+	return difference / 2
+}
+
+func (a mechanicsActor) saveBonus(ability string) int {
+	bonus := a.abilityModifier(ability)
+	if a.SaveProficiencies[ability] {
+		bonus += a.ProficiencyBonus
+	}
+	return bonus
+}
+
+// absorbActiveEffect учитывает одну строку active_effects: сама строка может
+// быть payload-ом (состояние, сопротивление) или полной механикой эффекта.
+func (a *mechanicsActor) absorbActiveEffect(mechanics JSONMap) {
+	if mechanics == nil {
+		return
+	}
+	if kind, ok := mechanics["kind"].(string); ok {
+		if kind == "condition" {
+			if value, ok := mechanics["value"].(string); ok && value != "" && mechanics["op"] != "remove" {
+				a.Conditions[value] = true
+			}
+			return
+		}
+		a.absorbPassivePayload(mechanics)
+		return
+	}
+	a.absorbPassiveMechanics(mechanics)
+}
+
+// absorbDamageResistances переносит поправки урона формата DamageResistances
+// ({"fire":"resistance","cold":"immune","poison":"vulnerability"}).
+func (a *mechanicsActor) absorbDamageResistances(resistances DamageResistances) {
+	for damageType, value := range resistances {
+		switch value {
+		case "immune", "immunity":
+			a.Immunities[damageType] = true
+		case "vulnerability":
+			a.Vulnerabilities[damageType] = true
+		case "resistance":
+			a.Resistances[damageType] = true
+		}
+	}
+}
+
+// absorbPassiveMechanics проходит auto-интеракции механики и забирает
+// постоянные факты: сопротивления и иммунитеты к состояниям.
+func (a *mechanicsActor) absorbPassiveMechanics(mechanics JSONMap) {
+	for _, interaction := range mechanicsInteractions(mechanics) {
+		if interaction["resolution"] != "auto" {
+			continue
+		}
+		for _, payload := range mechanicsPayloadList(interaction["result"]) {
+			a.absorbPassivePayload(payload)
+		}
+	}
+}
+
+func (a *mechanicsActor) absorbPassivePayload(payload map[string]interface{}) {
+	switch payload["kind"] {
+	case "resistance":
+		damageType, _ := payload["damage_type"].(string)
+		if damageType == "" {
+			return
+		}
+		switch payload["value"] {
+		case "immunity":
+			a.Immunities[damageType] = true
+		case "vulnerability":
+			a.Vulnerabilities[damageType] = true
+		default:
+			a.Resistances[damageType] = true
+		}
+	case "condition_immunity":
+		if condition, ok := payload["condition"].(string); ok && condition != "" {
+			a.ConditionImmunities[condition] = true
+		}
+	}
+}
+
+// mechanicsInteractions возвращает список интеракций механики: хранимые
+// механики используют ключ effects, новые карточки схемы — interactions.
+func mechanicsInteractions(mechanics JSONMap) []map[string]interface{} {
+	if mechanics == nil {
+		return nil
+	}
+	raw, exists := mechanics["effects"]
+	if !exists {
+		raw = mechanics["interactions"]
+	}
+	return mechanicsPayloadList(raw)
+}
+
+func mechanicsPayloadList(raw interface{}) []map[string]interface{} {
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			result = append(result, object)
+		}
+	}
+	return result
+}
+
+// mechanicsNumber читает число из JSON-значения (float64 после json.Unmarshal,
+// int из Go-литералов, json.Number из декодеров с UseNumber).
+func mechanicsNumber(raw interface{}) (float64, bool) {
+	switch value := raw.(type) {
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case json.Number:
+		parsed, err := value.Float64()
+		return parsed, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,862 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Серверный вычислитель формул механик (docs/unified-mechanics-schema.md §8).
+// Грамматика и семантика повторяют frontend/src/engine/formula.ts, чтобы
+// бросок на сервере и превью в конструкторе считали одно и то же:
+//
+//	expr   = term (("+" | "-") term)*
+//	term   = factor (("*" | "/") factor | скаляр кость | скаляр dice-переменная)*
+//	factor = число | NdM | dM | идентификатор | min(...) | max(...) | (expr) | -factor
+//
+// Кости откладываются до свёртки в число: «скаляр * кость» умножает количество
+// костей, «кость * скаляр» бросает и умножает сумму, «кость * кость» — ошибка.
+
+// maxFormulaDice ограничивает число костей одного вычисления: формулы приходят
+// и из каталога, и из запроса пользователя.
+const maxFormulaDice = 1000
+
+// formulaError — любая проблема формулы (разбор, неизвестная функция, маркер в
+// арифметике). Вызывающие переводят её в ошибку своего уровня с путём.
+type formulaError struct {
+	Problem string
+}
+
+func (e *formulaError) Error() string { return e.Problem }
+
+func newFormulaError(format string, args ...interface{}) error {
+	return &formulaError{Problem: fmt.Sprintf(format, args...)}
+}
+
+// formulaMissingVariableError — формула сослалась на переменную, которой у
+// персонажа нет.
+type formulaMissingVariableError struct {
+	Variable string
+}
+
+func (e *formulaMissingVariableError) Error() string {
+	return "Переменная формулы недоступна: " + e.Variable
+}
+
+// formulaVariable — значение переменной персонажа: число или кость(и)
+// (см. docs/variables.md).
+type formulaVariable struct {
+	Number float64
+	Dice   bool
+	Count  int
+	Sides  int
+}
+
+func (v formulaVariable) MarshalJSON() ([]byte, error) {
+	if v.Dice {
+		return json.Marshal(map[string]int{"count": v.Count, "sides": v.Sides})
+	}
+	return json.Marshal(v.Number)
+}
+
+var formulaDiceValue = regexp.MustCompile(`(?i)^(\d*)\s*[dк]\s*(\d+)$`)
+
+// parseFormulaDice разбирает "1d8" | "d8" | "2к6".
+func parseFormulaDice(raw string) (formulaVariable, bool) {
+	match := formulaDiceValue.FindStringSubmatch(strings.TrimSpace(raw))
+	if match == nil {
+		return formulaVariable{}, false
+	}
+	count := 1
+	if match[1] != "" {
+		count, _ = strconv.Atoi(match[1])
+	}
+	sides, _ := strconv.Atoi(match[2])
+	if sides <= 0 {
+		return formulaVariable{}, false
+	}
+	return formulaVariable{Dice: true, Count: count, Sides: sides}, true
+}
+
+// parseFormulaVariable переводит значение переменной из payload-а,
+// default_value справочника или rule_state.variables. varType "" означает
+// «угадать по строке».
+func parseFormulaVariable(raw interface{}, varType string) (formulaVariable, bool) {
+	switch value := raw.(type) {
+	case nil:
+		return formulaVariable{}, false
+	case map[string]interface{}:
+		count, countOK := mechanicsNumber(value["count"])
+		sides, sidesOK := mechanicsNumber(value["sides"])
+		if !countOK || !sidesOK || sides <= 0 {
+			return formulaVariable{}, false
+		}
+		return formulaVariable{Dice: true, Count: int(count), Sides: int(sides)}, true
+	case string:
+		if strings.TrimSpace(value) == "" {
+			return formulaVariable{}, false
+		}
+		dice, isDice := parseFormulaDice(value)
+		if varType == "dice" || (varType == "" && isDice) {
+			return dice, isDice
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+			return formulaVariable{}, false
+		}
+		return formulaVariable{Number: number}, true
+	}
+	if number, ok := mechanicsNumber(raw); ok {
+		if varType == "dice" {
+			return formulaVariable{}, false
+		}
+		return formulaVariable{Number: number}, true
+	}
+	return formulaVariable{}, false
+}
+
+// formulaContext — всё, что формула может прочитать у персонажа.
+type formulaContext struct {
+	AbilityMods     map[string]int
+	ProfBonus       int
+	SelfLevel       int
+	ClassLevels     map[string]int
+	SpellcastingMod int
+	SpellSlotAbove  int
+	RageBonus       int
+	CharacterSpeed  int
+	WeaponMod       int
+	Variables       map[string]formulaVariable
+	// CritDice удваивает количество каждой брошенной кости (критическое попадание).
+	CritDice bool
+	RNG      diceRNG
+}
+
+// FormulaTerm — слагаемое верхнего уровня формулы и его значение со знаком.
+type FormulaTerm struct {
+	Text  string  `json:"text"`
+	Value float64 `json:"value"`
+}
+
+// FormulaEvaluation — результат вычисления: точное значение, значение,
+// округлённое вниз (так округляют правила), и разбивка по слагаемым, костям и
+// именованным модификаторам. Text совпадает с логом бросков клиента.
+type FormulaEvaluation struct {
+	Formula   string               `json:"formula"`
+	Value     float64              `json:"value"`
+	Total     int                  `json:"total"`
+	Marker    string               `json:"marker,omitempty"`
+	Terms     []FormulaTerm        `json:"terms"`
+	Dice      []EngineRollDie      `json:"dice"`
+	Modifiers []EngineRollModifier `json:"modifiers"`
+	Text      string               `json:"text"`
+}
+
+// engineRoll превращает вычисление в payload.roll журнала.
+func (e FormulaEvaluation) engineRoll(kind string) EngineRoll {
+	return EngineRoll{
+		Kind: kind, Dice: e.Dice, Advantage: "none", Modifiers: e.Modifiers,
+		Total: e.Total, Text: e.Text,
+	}
+}
+
+var formulaMarkers = map[string]bool{"weapon": true, "auto": true}
+
+func isFormulaMarker(value string) bool {
+	return formulaMarkers[strings.ToLower(strings.TrimSpace(value))]
+}
+
+// evaluateFormula вычисляет формулу (строку или число) с полной разбивкой.
+// Формула-маркер weapon/auto возвращается в Marker без вычисления.
+func evaluateFormula(raw interface{}, ctx formulaContext) (FormulaEvaluation, error) {
+	evaluation := FormulaEvaluation{
+		Terms: []FormulaTerm{}, Dice: []EngineRollDie{}, Modifiers: []EngineRollModifier{},
+	}
+	if number, ok := mechanicsNumber(raw); ok {
+		evaluation.Formula = strconv.FormatFloat(number, 'f', -1, 64)
+		evaluation.Value = number
+		evaluation.Total = int(math.Floor(number))
+		evaluation.Terms = append(evaluation.Terms, FormulaTerm{Text: evaluation.Formula, Value: number})
+		evaluation.Text = formulaRollText(nil, nil, evaluation.Total)
+		return evaluation, nil
+	}
+	formula, ok := raw.(string)
+	if !ok {
+		return evaluation, newFormulaError("Формула должна быть строкой или числом")
+	}
+	evaluation.Formula = formula
+	trimmed := strings.TrimSpace(formula)
+	if trimmed == "" {
+		return evaluation, newFormulaError("Пустая формула")
+	}
+	if isFormulaMarker(trimmed) {
+		evaluation.Marker = strings.ToLower(trimmed)
+		return evaluation, nil
+	}
+	source, tokens, err := tokenizeFormula(trimmed)
+	if err != nil {
+		return evaluation, err
+	}
+	if ctx.RNG == nil {
+		ctx.RNG = newDiceRNG(0)
+	}
+	parser := &formulaParser{source: source, tokens: tokens, ctx: ctx, detailed: true}
+	value, err := parser.parseTopLevel()
+	if err != nil {
+		return evaluation, err
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return evaluation, newFormulaError("Формула «%s» не даёт конечного числа", formula)
+	}
+	evaluation.Value = value
+	evaluation.Total = int(math.Floor(value))
+	evaluation.Terms = parser.terms
+	evaluation.Dice = append(evaluation.Dice, parser.dice...)
+	evaluation.Modifiers = append(evaluation.Modifiers, parser.modifiers...)
+	evaluation.Text = formulaRollText(evaluation.Dice, evaluation.Modifiers, evaluation.Total)
+	return evaluation, nil
+}
+
+// formulaRollText — запись броска в формате клиента: «к6: 3+4 +2 БМ = 9».
+func formulaRollText(dice []EngineRollDie, modifiers []EngineRollModifier, total int) string {
+	var parts []string
+	order := []int{}
+	bySides := map[int][]string{}
+	for _, die := range dice {
+		if die.Discarded {
+			continue
+		}
+		if _, seen := bySides[die.Sides]; !seen {
+			order = append(order, die.Sides)
+		}
+		result := strconv.Itoa(die.Result)
+		if die.Sign < 0 {
+			result = "-" + result
+		}
+		bySides[die.Sides] = append(bySides[die.Sides], result)
+	}
+	for _, sides := range order {
+		parts = append(parts, fmt.Sprintf("к%d: %s", sides, strings.Join(bySides[sides], "+")))
+	}
+	for _, modifier := range modifiers {
+		sign := ""
+		if modifier.Value >= 0 {
+			sign = "+"
+		}
+		parts = append(parts, fmt.Sprintf("%s%d %s", sign, modifier.Value, modifier.Source))
+	}
+	if len(parts) == 0 {
+		return strconv.Itoa(total)
+	}
+	return fmt.Sprintf("%s = %d", strings.Join(parts, " "), total)
+}
+
+type formulaTokenKind int
+
+const (
+	formulaTokenNumber formulaTokenKind = iota
+	formulaTokenIdent
+	formulaTokenDice
+	formulaTokenClassScaling
+	formulaTokenVarScaling
+	formulaTokenOp
+	formulaTokenLParen
+	formulaTokenRParen
+)
+
+type formulaToken struct {
+	Kind    formulaTokenKind
+	Number  float64
+	Ident   string
+	Op      byte
+	Count   int
+	Sides   int
+	Divisor int
+	// Start/End — границы токена в нормализованной строке (для Terms).
+	Start int
+	End   int
+}
+
+var (
+	formulaDiceToken         = regexp.MustCompile(`^(\d+)[dD](\d+)`)
+	formulaBareDiceToken     = regexp.MustCompile(`^[dD](\d+)`)
+	formulaClassScalingToken = regexp.MustCompile(`(?i)^class_level:([a-z0-9_-]+)\s*/\s*(\d+)\s+d(\d+)`)
+	formulaVarScalingToken   = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_:]*)(?:\s*/\s*(\d+))?\s+[dD](\d+)`)
+	formulaIdentToken        = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_:]*`)
+	formulaNumberToken       = regexp.MustCompile(`^\d+(?:\.\d+)?`)
+	formulaWhitespaceRun     = regexp.MustCompile(`\s+`)
+	formulaExoticWhitespace  = strings.NewReplacer("\u00a0", " ", "\u202f", " ", "\u2007", " ", "\u2009", " ", "\u200b", " ")
+)
+
+// tokenizeFormula возвращает нормализованную строку и её токены.
+func tokenizeFormula(input string) (string, []formulaToken, error) {
+	// Пробелы нормализуются (в т.ч. NBSP из конструктора), иначе «prof d4» не склеится.
+	s := formulaWhitespaceRun.ReplaceAllString(formulaExoticWhitespace.Replace(strings.TrimSpace(input)), " ")
+	s = strings.TrimSpace(s)
+	var tokens []formulaToken
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch ch := s[i]; {
+		case ch == ' ':
+			i++
+			continue
+		case ch == '(':
+			tokens = append(tokens, formulaToken{Kind: formulaTokenLParen, Start: i, End: i + 1})
+			i++
+			continue
+		case ch == ')':
+			tokens = append(tokens, formulaToken{Kind: formulaTokenRParen, Start: i, End: i + 1})
+			i++
+			continue
+		case strings.IndexByte("+-*/,", ch) >= 0:
+			tokens = append(tokens, formulaToken{Kind: formulaTokenOp, Op: ch, Start: i, End: i + 1})
+			i++
+			continue
+		}
+		if match := formulaDiceToken.FindStringSubmatch(rest); match != nil {
+			count, _ := strconv.Atoi(match[1])
+			sides, _ := strconv.Atoi(match[2])
+			tokens = append(tokens, formulaToken{Kind: formulaTokenDice, Count: count, Sides: sides, Start: i, End: i + len(match[0])})
+			i += len(match[0])
+			continue
+		}
+		// Голая кость «d4» = 1d4 (чтобы писать `2 * d4` и `d4 * 2`).
+		if match := formulaBareDiceToken.FindStringSubmatch(rest); match != nil {
+			sides, _ := strconv.Atoi(match[1])
+			tokens = append(tokens, formulaToken{Kind: formulaTokenDice, Count: 1, Sides: sides, Start: i, End: i + len(match[0])})
+			i += len(match[0])
+			continue
+		}
+		// class_level:<id> / N dM — исторический синтаксис (делитель обязателен).
+		if match := formulaClassScalingToken.FindStringSubmatch(rest); match != nil {
+			divisor, _ := strconv.Atoi(match[2])
+			sides, _ := strconv.Atoi(match[3])
+			tokens = append(tokens, formulaToken{
+				Kind: formulaTokenClassScaling, Ident: strings.ToLower(match[1]),
+				Divisor: divisor, Sides: sides, Start: i, End: i + len(match[0]),
+			})
+			i += len(match[0])
+			continue
+		}
+		// <числовая переменная> [/ делитель] dN → ceil(value/div) костей dN.
+		// Требует пробел перед dN; маркеры weapon/auto так не масштабируются.
+		if match := formulaVarScalingToken.FindStringSubmatch(rest); match != nil && !formulaMarkers[strings.ToLower(match[1])] {
+			divisor := 1
+			if match[2] != "" {
+				divisor, _ = strconv.Atoi(match[2])
+			}
+			sides, _ := strconv.Atoi(match[3])
+			tokens = append(tokens, formulaToken{
+				Kind: formulaTokenVarScaling, Ident: match[1],
+				Divisor: divisor, Sides: sides, Start: i, End: i + len(match[0]),
+			})
+			i += len(match[0])
+			continue
+		}
+		if match := formulaIdentToken.FindString(rest); match != "" {
+			tokens = append(tokens, formulaToken{Kind: formulaTokenIdent, Ident: match, Start: i, End: i + len(match)})
+			i += len(match)
+			continue
+		}
+		if match := formulaNumberToken.FindString(rest); match != "" {
+			number, _ := strconv.ParseFloat(match, 64)
+			tokens = append(tokens, formulaToken{Kind: formulaTokenNumber, Number: number, Start: i, End: i + len(match)})
+			i += len(match)
+			continue
+		}
+		near := rest
+		if len(near) > 8 {
+			near = near[:8]
+		}
+		return s, nil, newFormulaError("Неизвестный символ в формуле «%s» около «%s»", input, near)
+	}
+	return s, tokens, nil
+}
+
+type formulaValueKind int
+
+const (
+	formulaValueNumber formulaValueKind = iota
+	formulaValueDice
+	formulaValueMarker
+)
+
+// formulaValue — промежуточное значение: число, отложенные кости или маркер.
+type formulaValue struct {
+	Kind   formulaValueKind
+	Number float64
+	Count  int
+	Sides  int
+	Marker string
+}
+
+func formulaNumber(value float64) formulaValue {
+	return formulaValue{Kind: formulaValueNumber, Number: value}
+}
+
+func pendingFormulaDice(count float64, sides int) formulaValue {
+	return formulaValue{Kind: formulaValueDice, Count: int(math.Max(0, math.Floor(count))), Sides: sides}
+}
+
+type formulaParser struct {
+	source    string
+	tokens    []formulaToken
+	pos       int
+	ctx       formulaContext
+	detailed  bool
+	rolled    int
+	terms     []FormulaTerm
+	dice      []EngineRollDie
+	modifiers []EngineRollModifier
+}
+
+func (p *formulaParser) peek(offset int) *formulaToken {
+	if p.pos+offset < len(p.tokens) {
+		return &p.tokens[p.pos+offset]
+	}
+	return nil
+}
+
+func (p *formulaParser) isOp(token *formulaToken, ops string) bool {
+	return token != nil && token.Kind == formulaTokenOp && strings.IndexByte(ops, token.Op) >= 0
+}
+
+// parseTopLevel разбирает expr и запоминает слагаемые верхнего уровня.
+func (p *formulaParser) parseTopLevel() (float64, error) {
+	p.terms = []FormulaTerm{}
+	total := 0.0
+	sign := 1.0
+	for {
+		start := p.peek(0)
+		if start == nil {
+			return 0, newFormulaError("Незавершённая формула")
+		}
+		diceBefore := len(p.dice)
+		value, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		number, err := p.force(value)
+		if err != nil {
+			return 0, err
+		}
+		if sign < 0 {
+			p.negateDiceFrom(diceBefore)
+		}
+		end := p.tokens[p.pos-1].End
+		text := strings.TrimSpace(p.source[start.Start:end])
+		p.terms = append(p.terms, FormulaTerm{Text: text, Value: sign * number})
+		total += sign * number
+
+		next := p.peek(0)
+		if !p.isOp(next, "+-") {
+			break
+		}
+		sign = 1
+		if next.Op == '-' {
+			sign = -1
+		}
+		p.pos++
+	}
+	if p.pos < len(p.tokens) {
+		return 0, newFormulaError("Лишние символы в формуле")
+	}
+	return total, nil
+}
+
+func (p *formulaParser) parseExpr() (formulaValue, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return left, err
+	}
+	for {
+		token := p.peek(0)
+		if !p.isOp(token, "+-") {
+			return left, nil
+		}
+		p.pos++
+		a, err := p.force(left)
+		if err != nil {
+			return left, err
+		}
+		diceBefore := len(p.dice)
+		right, err := p.parseTerm()
+		if err != nil {
+			return left, err
+		}
+		b, err := p.force(right)
+		if err != nil {
+			return left, err
+		}
+		if token.Op == '+' {
+			left = formulaNumber(a + b)
+		} else {
+			p.negateDiceFrom(diceBefore)
+			left = formulaNumber(a - b)
+		}
+	}
+}
+
+func (p *formulaParser) parseTerm() (formulaValue, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return left, err
+	}
+	for {
+		token := p.peek(0)
+		if token == nil {
+			return left, nil
+		}
+		if p.isOp(token, "*/") {
+			p.pos++
+			right, err := p.parseFactor()
+			if err != nil {
+				return left, err
+			}
+			if token.Op == '*' {
+				left, err = p.multiply(left, right)
+			} else {
+				left, err = p.divide(left, right)
+			}
+			if err != nil {
+				return left, err
+			}
+			continue
+		}
+		if left.Kind != formulaValueNumber {
+			return left, nil
+		}
+		// Неявное «скаляр кость» (prof d4, 2 d6) = скаляр * кость.
+		if token.Kind == formulaTokenDice {
+			p.pos++
+			left, err = p.multiply(left, pendingFormulaDice(float64(token.Count), token.Sides))
+			if err != nil {
+				return left, err
+			}
+			continue
+		}
+		// Неявное «скаляр dice-переменная» (prof martial_arts_die).
+		if p.isIdentLike(token) {
+			if next := p.peek(1); next == nil || next.Kind != formulaTokenLParen {
+				detailed := p.detailed
+				p.detailed = false
+				peeked, peekErr := p.resolveToken(*token)
+				p.detailed = detailed
+				if peekErr == nil && peeked.Kind == formulaValueDice {
+					p.pos++
+					left, err = p.multiply(left, peeked)
+					if err != nil {
+						return left, err
+					}
+					continue
+				}
+			}
+		}
+		return left, nil
+	}
+}
+
+func (p *formulaParser) isIdentLike(token *formulaToken) bool {
+	switch token.Kind {
+	case formulaTokenIdent, formulaTokenClassScaling, formulaTokenVarScaling:
+		return true
+	}
+	return false
+}
+
+func (p *formulaParser) parseFactor() (formulaValue, error) {
+	token := p.peek(0)
+	if token == nil {
+		return formulaValue{}, newFormulaError("Незавершённая формула")
+	}
+	switch token.Kind {
+	case formulaTokenNumber:
+		p.pos++
+		return formulaNumber(token.Number), nil
+	case formulaTokenDice:
+		p.pos++
+		return pendingFormulaDice(float64(token.Count), token.Sides), nil
+	case formulaTokenIdent:
+		p.pos++
+		if next := p.peek(0); next != nil && next.Kind == formulaTokenLParen {
+			return p.parseCall(token.Ident)
+		}
+		return p.resolveToken(*token)
+	case formulaTokenClassScaling, formulaTokenVarScaling:
+		p.pos++
+		return p.resolveToken(*token)
+	case formulaTokenLParen:
+		p.pos++
+		value, err := p.parseExpr()
+		if err != nil {
+			return value, err
+		}
+		if next := p.peek(0); next == nil || next.Kind != formulaTokenRParen {
+			return value, newFormulaError("Ожидалась закрывающая скобка")
+		}
+		p.pos++
+		return value, nil
+	case formulaTokenOp:
+		// Унарный плюс: значения модификаторов в каталоге пишут как "+2".
+		if token.Op == '+' {
+			p.pos++
+			return p.parseFactor()
+		}
+		if token.Op == '-' {
+			p.pos++
+			diceBefore := len(p.dice)
+			value, err := p.parseFactor()
+			if err != nil {
+				return value, err
+			}
+			number, err := p.force(value)
+			if err != nil {
+				return value, err
+			}
+			p.negateDiceFrom(diceBefore)
+			return formulaNumber(-number), nil
+		}
+	}
+	return formulaValue{}, newFormulaError("Неожиданный токен «%s»", p.source[token.Start:token.End])
+}
+
+func (p *formulaParser) parseCall(name string) (formulaValue, error) {
+	p.pos++ // (
+	var args []float64
+	for {
+		token := p.peek(0)
+		if token == nil || token.Kind == formulaTokenRParen {
+			break
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return value, err
+		}
+		number, err := p.force(value)
+		if err != nil {
+			return value, err
+		}
+		args = append(args, number)
+		if separator := p.peek(0); p.isOp(separator, ",") {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if token := p.peek(0); token == nil || token.Kind != formulaTokenRParen {
+		return formulaValue{}, newFormulaError("Ожидалась закрывающая скобка")
+	}
+	p.pos++
+	function := strings.ToLower(name)
+	if function != "min" && function != "max" {
+		return formulaValue{}, newFormulaError("Неизвестная функция формулы: %s", name)
+	}
+	if len(args) == 0 {
+		return formulaValue{}, newFormulaError("Функции %s нужен хотя бы один аргумент", function)
+	}
+	sort.Float64s(args)
+	if function == "min" {
+		return formulaNumber(args[0]), nil
+	}
+	return formulaNumber(args[len(args)-1]), nil
+}
+
+// multiply реализует асимметрию костей: скаляр * кость откладывает бросок
+// (count × скаляр), кость * скаляр бросает и умножает сумму.
+func (p *formulaParser) multiply(left, right formulaValue) (formulaValue, error) {
+	if left.Kind == formulaValueMarker || right.Kind == formulaValueMarker {
+		return formulaValue{}, newFormulaError("Маркеры weapon/auto нельзя умножать")
+	}
+	switch {
+	case left.Kind == formulaValueNumber && right.Kind == formulaValueDice:
+		return pendingFormulaDice(left.Number*float64(right.Count), right.Sides), nil
+	case left.Kind == formulaValueDice && right.Kind == formulaValueNumber:
+		sum, err := p.roll(left.Count, left.Sides)
+		return formulaNumber(sum * right.Number), err
+	case left.Kind == formulaValueDice && right.Kind == formulaValueDice:
+		return formulaValue{}, newFormulaError("Нельзя умножать кость на кость")
+	}
+	return formulaNumber(left.Number * right.Number), nil
+}
+
+func (p *formulaParser) divide(left, right formulaValue) (formulaValue, error) {
+	a, err := p.force(left)
+	if err != nil {
+		return left, err
+	}
+	b, err := p.force(right)
+	if err != nil {
+		return right, err
+	}
+	if b == 0 {
+		return formulaValue{}, newFormulaError("Деление на ноль в формуле")
+	}
+	return formulaNumber(a / b), nil
+}
+
+// force сворачивает значение в число: отложенные кости бросаются, маркер — ошибка.
+func (p *formulaParser) force(value formulaValue) (float64, error) {
+	switch value.Kind {
+	case formulaValueMarker:
+		return 0, newFormulaError("Маркер «%s» нельзя использовать в арифметике", value.Marker)
+	case formulaValueDice:
+		return p.roll(value.Count, value.Sides)
+	}
+	return value.Number, nil
+}
+
+func (p *formulaParser) roll(count, sides int) (float64, error) {
+	if p.ctx.CritDice {
+		count *= 2
+	}
+	if sides <= 0 {
+		return 0, newFormulaError("У кости должна быть хотя бы одна грань")
+	}
+	if p.rolled+count > maxFormulaDice {
+		return 0, newFormulaError("Слишком много костей в формуле (больше %d)", maxFormulaDice)
+	}
+	p.rolled += count
+	sum := 0
+	for i := 0; i < count; i++ {
+		result := rollDie(p.ctx.RNG, sides)
+		if p.detailed {
+			p.dice = append(p.dice, EngineRollDie{Sides: sides, Result: result})
+		}
+		sum += result
+	}
+	return float64(sum), nil
+}
+
+func (p *formulaParser) negateDiceFrom(start int) {
+	for i := start; i < len(p.dice); i++ {
+		if p.dice[i].Sign < 0 {
+			p.dice[i].Sign = 0
+		} else {
+			p.dice[i].Sign = -1
+		}
+	}
+}
+
+func (p *formulaParser) modifier(value int, source, reason string) formulaValue {
+	if p.detailed && value != 0 {
+		p.modifiers = append(p.modifiers, EngineRollModifier{Value: value, Source: source, Reason: reason})
+	}
+	return formulaNumber(float64(value))
+}
+
+func (p *formulaParser) variable(id string) (formulaVariable, bool) {
+	if value, ok := p.ctx.Variables[strings.ToLower(id)]; ok {
+		return value, true
+	}
+	value, ok := p.ctx.Variables[id]
+	return value, ok
+}
+
+func (p *formulaParser) resolveToken(token formulaToken) (formulaValue, error) {
+	switch token.Kind {
+	case formulaTokenClassScaling:
+		level := p.ctx.ClassLevels[token.Ident]
+		return pendingFormulaDice(math.Ceil(float64(level)/float64(token.Divisor)), token.Sides), nil
+	case formulaTokenVarScaling:
+		scalar, err := p.numericScalar(token.Ident)
+		if err != nil {
+			return formulaValue{}, err
+		}
+		divisor := token.Divisor
+		if divisor == 0 {
+			divisor = 1
+		}
+		return pendingFormulaDice(math.Ceil(scalar/float64(divisor)), token.Sides), nil
+	}
+	return p.resolveIdent(token.Ident)
+}
+
+// numericScalar — число для «X dN»: dice-переменные и маркеры не подходят,
+// количество костей должно быть известно до броска.
+func (p *formulaParser) numericScalar(id string) (float64, error) {
+	lower := strings.ToLower(id)
+	if formulaMarkers[lower] {
+		return 0, newFormulaError("Маркер «%s» нельзя использовать как число костей", id)
+	}
+	if value, ok := p.builtinScalar(lower); ok {
+		return float64(value), nil
+	}
+	if variable, ok := p.variable(id); ok {
+		if variable.Dice {
+			return 0, newFormulaError("«%s» — кость, а не число; нельзя писать «%s d…»", id, id)
+		}
+		return variable.Number, nil
+	}
+	return 0, &formulaMissingVariableError{Variable: id}
+}
+
+func (p *formulaParser) builtinScalar(lower string) (int, bool) {
+	switch lower {
+	case "prof", "prof_bonus":
+		return p.ctx.ProfBonus, true
+	case "self_level":
+		return p.ctx.SelfLevel, true
+	case "spellcasting":
+		return p.ctx.SpellcastingMod, true
+	case "spell_slot_above":
+		return p.ctx.SpellSlotAbove, true
+	case "rage_bonus":
+		return p.ctx.RageBonus, true
+	case "character_speed":
+		return p.ctx.CharacterSpeed, true
+	case "weapon_mod":
+		return p.ctx.WeaponMod, true
+	}
+	if strings.HasPrefix(lower, "class_level:") {
+		return p.ctx.ClassLevels[strings.TrimPrefix(lower, "class_level:")], true
+	}
+	if oneOf(lower, abilityKeys...) {
+		return p.ctx.AbilityMods[lower], true
+	}
+	return 0, false
+}
+
+func (p *formulaParser) resolveIdent(id string) (formulaValue, error) {
+	lower := strings.ToLower(id)
+	if formulaMarkers[lower] {
+		return formulaValue{Kind: formulaValueMarker, Marker: lower}, nil
+	}
+	switch lower {
+	case "prof", "prof_bonus":
+		return p.modifier(p.ctx.ProfBonus, "БМ", "бонус мастерства"), nil
+	case "self_level":
+		return p.modifier(p.ctx.SelfLevel, "уровень", "уровень персонажа"), nil
+	case "spellcasting":
+		return p.modifier(p.ctx.SpellcastingMod, "заклин.", "модификатор заклинаний"), nil
+	case "spell_slot_above":
+		return p.modifier(p.ctx.SpellSlotAbove, "ячейка+", "уровень ячейки выше"), nil
+	case "rage_bonus":
+		return p.modifier(p.ctx.RageBonus, "ярость", "бонус ярости"), nil
+	case "character_speed":
+		return p.modifier(p.ctx.CharacterSpeed, "скорость", "скорость персонажа"), nil
+	case "weapon_mod":
+		return p.modifier(p.ctx.WeaponMod, "оружие", "модификатор характеристики атаки"), nil
+	}
+	if strings.HasPrefix(lower, "class_level:") {
+		classID := strings.TrimPrefix(lower, "class_level:")
+		return p.modifier(p.ctx.ClassLevels[classID], "ур."+classID, "уровень класса"), nil
+	}
+	if oneOf(lower, abilityKeys...) {
+		return p.modifier(p.ctx.AbilityMods[lower], abilityLabel(lower), "модификатор характеристики"), nil
+	}
+	// Переменные: number → модификатор; dice → отложенная кость (для асимметрии *).
+	if variable, ok := p.variable(id); ok {
+		if variable.Dice {
+			return pendingFormulaDice(float64(variable.Count), variable.Sides), nil
+		}
+		if p.detailed && variable.Number != 0 {
+			p.modifiers = append(p.modifiers, EngineRollModifier{Value: int(math.Round(variable.Number)), Source: id, Reason: "переменная"})
+		}
+		return formulaNumber(variable.Number), nil
+	}
+	return formulaValue{}, &formulaMissingVariableError{Variable: id}
+}
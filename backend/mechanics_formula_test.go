@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func testFormulaContext(t *testing.T, dice ...int) formulaContext {
+	return formulaContext{
+		AbilityMods: map[string]int{"str": 3, "dex": 2, "con": 1, "int": 0, "wis": -1, "cha": 4},
+		ProfBonus:   3, SelfLevel: 5, SpellcastingMod: 4,
+		ClassLevels: map[string]int{"monk": 5},
+		Variables: map[string]formulaVariable{
+			"martial_arts_die":     {Dice: true, Count: 1, Sides: 8},
+			"rage_damage_modifier": {Number: 2},
+		},
+		RNG: scripted(t, dice...),
+	}
+}
+
+func TestEvaluateFormulaScalars(t *testing.T) {
+	for formula, want := range map[string]float64{
+		"8 + prof + spellcasting":     15,
+		"13 + dex":                    15,
+		"min(str, dex) + 1":           3,
+		"max(1, wis)":                 1,
+		"self_level / 2":              2.5,
+		"-wis + 2 * (prof - 1)":       5,
+		"class_level:monk + cha":      9,
+		"rage_damage_modifier * prof": 6,
+	} {
+		evaluation, err := evaluateFormula(formula, testFormulaContext(t))
+		if err != nil {
+			t.Fatalf("%s: %v", formula, err)
+		}
+		if evaluation.Value != want || len(evaluation.Dice) != 0 {
+			t.Fatalf("%s: want %v without dice, got %+v", formula, want, evaluation)
+		}
+	}
+	half, _ := evaluateFormula("self_level / 2", testFormulaContext(t))
+	if half.Total != 2 {
+		t.Fatalf("total must round down, got %d", half.Total)
+	}
+}
+
+func TestEvaluateFormulaBreakdown(t *testing.T) {
+	evaluation, err := evaluateFormula("2d6 + prof + 1", testFormulaContext(t, 3, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evaluation.Total != 11 || evaluation.Text != "к6: 3+4 +3 БМ = 11" {
+		t.Fatalf("unexpected roll: %+v", evaluation)
+	}
+	if len(evaluation.Terms) != 3 || evaluation.Terms[0].Text != "2d6" || evaluation.Terms[0].Value != 7 ||
+		evaluation.Terms[1].Text != "prof" || evaluation.Terms[2].Value != 1 {
+		t.Fatalf("unexpected terms: %+v", evaluation.Terms)
+	}
+	if len(evaluation.Modifiers) != 1 || evaluation.Modifiers[0].Reason != "бонус мастерства" {
+		t.Fatalf("unexpected modifiers: %+v", evaluation.Modifiers)
+	}
+
+	negative, err := evaluateFormula("10 - d4", testFormulaContext(t, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if negative.Total != 7 || negative.Dice[0].Sign != -1 {
+		t.Fatalf("subtracted die must be signed: %+v", negative)
+	}
+}
+
+func TestEvaluateFormulaDiceMultiplication(t *testing.T) {
+	// скаляр * кость умножает количество костей.
+	scaled, err := evaluateFormula("prof * d4", testFormulaContext(t, 1, 2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scaled.Total != 6 || len(scaled.Dice) != 3 {
+		t.Fatalf("prof * d4 must roll 3d4: %+v", scaled)
+	}
+	// кость * скаляр бросает одну кость и умножает сумму.
+	doubled, err := evaluateFormula("d4 * 3", testFormulaContext(t, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doubled.Total != 6 || len(doubled.Dice) != 1 {
+		t.Fatalf("d4 * 3 must roll one die: %+v", doubled)
+	}
+	if _, err := evaluateFormula("d4 * d6", testFormulaContext(t, 1, 1)); err == nil {
+		t.Fatal("dice * dice must be rejected")
+	}
+	// «X dN» и неявное «скаляр dice-переменная».
+	for formula, dice := range map[string]int{
+		"prof d4":                3,
+		"class_level:monk/2 d6":  3,
+		"self_level/2 d8":        3,
+		"2 martial_arts_die":     2,
+		"martial_arts_die + dex": 1,
+	} {
+		results := make([]int, dice)
+		for i := range results {
+			results[i] = 1
+		}
+		evaluation, err := evaluateFormula(formula, testFormulaContext(t, results...))
+		if err != nil {
+			t.Fatalf("%s: %v", formula, err)
+		}
+		if len(evaluation.Dice) != dice {
+			t.Fatalf("%s: want %d dice, got %+v", formula, dice, evaluation.Dice)
+		}
+	}
+}
+
+func TestEvaluateFormulaCritDoublesDice(t *testing.T) {
+	ctx := testFormulaContext(t, 1, 2, 3, 4)
+	ctx.CritDice = true
+	evaluation, err := evaluateFormula("2d6 + str", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evaluation.Dice) != 4 || evaluation.Total != 13 {
+		t.Fatalf("crit must double dice, not modifiers: %+v", evaluation)
+	}
+}
+
+func TestEvaluateFormulaErrors(t *testing.T) {
+	_, err := evaluateFormula("ki_points + 1", testFormulaContext(t))
+	var missing *formulaMissingVariableError
+	if !errors.As(err, &missing) || missing.Variable != "ki_points" {
+		t.Fatalf("want missing variable error, got %v", err)
+	}
+	for _, formula := range []string{"", "2 +", "(1 + 2", "sqrt(4)", "weapon + 1", "1 $ 2", "1 / 0", "martial_arts_die d6", "1001d6"} {
+		_, err := evaluateFormula(formula, testFormulaContext(t))
+		var problem *formulaError
+		if !errors.As(err, &problem) {
+			t.Fatalf("%q: want formula error, got %v", formula, err)
+		}
+	}
+	marker, err := evaluateFormula(" Weapon ", testFormulaContext(t))
+	if err != nil || marker.Marker != "weapon" {
+		t.Fatalf("marker must pass through: %+v, %v", marker, err)
+	}
+}
+
+func TestParseFormulaVariable(t *testing.T) {
+	if value, ok := parseFormulaVariable("1d8", ""); !ok || !value.Dice || value.Sides != 8 || value.Count != 1 {
+		t.Fatalf("1d8: %+v", value)
+	}
+	if value, ok := parseFormulaVariable("d6", "dice"); !ok || value.Sides != 6 {
+		t.Fatalf("d6: %+v", value)
+	}
+	if value, ok := parseFormulaVariable("2", ""); !ok || value.Dice || value.Number != 2 {
+		t.Fatalf("2: %+v", value)
+	}
+	if _, ok := parseFormulaVariable("2", "dice"); ok {
+		t.Fatal("number is not a dice variable")
+	}
+	if value, ok := parseFormulaVariable(map[string]interface{}{"count": 2.0, "sides": 10.0}, ""); !ok || value.Count != 2 {
+		t.Fatalf("rule_state dice: %+v", value)
+	}
+}
+
+func TestFoldFormulaVariables(t *testing.T) {
+	defs := map[string]Variable{
+		"martial_arts_die":     {VariableID: "martial_arts_die", VarType: "dice", DefaultValue: "1d6"},
+		"rage_damage_modifier": {VariableID: "rage_damage_modifier", VarType: "number", DefaultValue: "2"},
+	}
+	set := func(id string, value interface{}, op string) JSONMap {
+		payload := map[string]interface{}{"kind": "variable", "op": op, "id": id}
+		if value != nil {
+			payload["value"] = value
+		}
+		return JSONMap{"effects": []interface{}{map[string]interface{}{"resolution": "auto", "result": []interface{}{payload}}}}
+	}
+	values, touched := foldFormulaVariables([]JSONMap{
+		set("martial_arts_die", nil, "set"),
+		set("martial_arts_die", "1d8", "set"),
+		set("rage_damage_modifier", nil, "set"),
+		set("rage_damage_modifier", 1.0, "add"),
+		set("superiority_die", "1d8", "set"),
+		set("superiority_die", nil, "remove"),
+	}, defs)
+	if values["martial_arts_die"].Sides != 8 {
+		t.Fatalf("higher level must override: %+v", values)
+	}
+	if values["rage_damage_modifier"].Number != 3 {
+		t.Fatalf("add must accumulate onto default: %+v", values)
+	}
+	if _, exists := values["superiority_die"]; exists || !touched["superiority_die"] {
+		t.Fatalf("remove must delete and be reported: %+v %+v", values, touched)
+	}
+}
+
+func TestClassLevelKey(t *testing.T) {
+	if key := classLevelKey(Class{CardNumber: "CLASS-MONK"}); key != "monk" {
+		t.Fatalf("want monk, got %q", key)
+	}
+	if key := classLevelKey(Class{CardNumber: "class_eldritch-knight"}); key != "eldritch_knight" {
+		t.Fatalf("want eldritch_knight, got %q", key)
+	}
+}
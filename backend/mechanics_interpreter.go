@@ -0,0 +1,921 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Серверный интерпретатор унифицированной механики (Mechanics JSON у Effect,
+// Action, Spell и Card). Это ядро frontend/src/engine/execute.ts: активация и
+// её стоимость, выбор целей, резолюции attack_roll/save/ability_check/auto и
+// payload-ы из mechanicsSystemPrompt. Интерпретатор ничего не пишет в БД — он
+// возвращает типизированный список исходов, а вызывающий код применяет их в
+// своей транзакции. Так сервер перестаёт доверять цифрам, посчитанным клиентом.
+
+// mechanicsInterpretError — ошибка контента или вызова. Путь указывает на
+// элемент механики (mechanics.effects[0].on_hit[1].dice), как и у
+// characterEventValidationError.
+type mechanicsInterpretError struct {
+	Path    string
+	Problem string
+}
+
+func (e *mechanicsInterpretError) Error() string {
+	if e.Path == "" {
+		return e.Problem
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Problem)
+}
+
+func invalidMechanics(path, problem string) error {
+	return &mechanicsInterpretError{Path: path, Problem: problem}
+}
+
+// mechanicsInvocation — одно исполнение механики.
+type mechanicsInvocation struct {
+	// Source — имя сущности для журнала («Огненный снаряд»).
+	Source    string
+	Mechanics JSONMap
+	Actor     mechanicsActor
+	Targets   []mechanicsActor
+	// SlotLevel — ячейка, которой сотворено заклинание; BaseLevel — круг
+	// заклинания. Разница питает spell_slot_above и scaling.
+	SlotLevel int
+	BaseLevel int
+	// Advantage — внешнее преимущество/помеха на бросок атаки (особенности,
+	// выбор ведущего); состояния участников учитываются автоматически.
+	Advantage string
+	// AttackModifiers — дополнительные слагаемые атаки (магический бонус оружия).
+	AttackModifiers []EngineRollModifier
+	// WithoutProficiency — атака оружием без владения: БМ не прибавляется.
+	WithoutProficiency bool
+	RNG                diceRNG
+
+	// WeaponMod — модификатор характеристики атаки оружием для weapon_mod в
+	// формулах исполнителя (СЛ и урон свойств искусности).
+	WeaponMod int
+}
+
+// MechanicsCost — списание ресурса за активацию (action, spell_slot, ki…).
+type MechanicsCost struct {
+	Resource string `json:"resource"`
+	Amount   int    `json:"amount"`
+	Level    int    `json:"level,omitempty"`
+}
+
+// MechanicsUses — ограничение активаций (uses) с уже вычисленным count.
+type MechanicsUses struct {
+	Count int    `json:"count"`
+	Per   string `json:"per,omitempty"`
+}
+
+// MechanicsCheck — d20-тест интеракции: атака, спасбросок или проверка.
+type MechanicsCheck struct {
+	Interaction int        `json:"interaction"`
+	Resolution  string     `json:"resolution"`
+	RollerID    string     `json:"roller_id"`
+	TargetID    string     `json:"target_id,omitempty"`
+	Branch      string     `json:"branch"`
+	Roll        EngineRoll `json:"roll"`
+}
+
+// MechanicsOutcome — один исход payload-а для конкретного получателя.
+// Amount заполнен у числовых payload-ов (урон уже с учётом сопротивлений).
+type MechanicsOutcome struct {
+	Interaction int         `json:"interaction"`
+	Resolution  string      `json:"resolution"`
+	Branch      string      `json:"branch"`
+	Kind        string      `json:"kind"`
+	ActorID     string      `json:"actor_id"`
+	TargetID    string      `json:"target_id"`
+	Amount      int         `json:"amount,omitempty"`
+	RawAmount   int         `json:"raw_amount,omitempty"`
+	DamageType  string      `json:"damage_type,omitempty"`
+	Adjustment  string      `json:"adjustment,omitempty"`
+	Value       string      `json:"value,omitempty"`
+	Op          string      `json:"op,omitempty"`
+	ResourceID  string      `json:"resource_id,omitempty"`
+	RoundsLeft  *int        `json:"rounds_left,omitempty"`
+	Roll        *EngineRoll `json:"roll,omitempty"`
+	Payload     JSONMap     `json:"payload"`
+}
+
+// MechanicsResult — полный результат исполнения.
+type MechanicsResult struct {
+	Source        string             `json:"source"`
+	Mode          string             `json:"mode"`
+	Costs         []MechanicsCost    `json:"costs"`
+	Uses          *MechanicsUses     `json:"uses,omitempty"`
+	Concentration bool               `json:"concentration"`
+	TargetIDs     []string           `json:"target_ids"`
+	Checks        []MechanicsCheck   `json:"checks"`
+	Outcomes      []MechanicsOutcome `json:"outcomes"`
+}
+
+// interpretMechanics исполняет механику и возвращает исходы. Ошибка означает
+// неисполнимый контент или неверный вызов; частичных результатов нет.
+func interpretMechanics(invocation mechanicsInvocation) (MechanicsResult, error) {
+	if invocation.RNG == nil {
+		invocation.RNG = newDiceRNG(0)
+	}
+	mechanics := invocation.Mechanics
+	result := MechanicsResult{
+		Source: invocation.Source, Mode: "passive",
+		Costs: []MechanicsCost{}, TargetIDs: []string{},
+		Checks: []MechanicsCheck{}, Outcomes: []MechanicsOutcome{},
+	}
+	if mechanics == nil {
+		return result, nil
+	}
+
+	if err := readMechanicsActivation(mechanics, invocation, &result); err != nil {
+		return result, err
+	}
+	if duration, ok := mechanics["duration"].(map[string]interface{}); ok && duration["concentration"] == true {
+		result.Concentration = true
+	}
+
+	targets, err := resolveMechanicsTargets(mechanics, invocation)
+	if err != nil {
+		return result, err
+	}
+	for _, target := range targets {
+		result.TargetIDs = append(result.TargetIDs, target.ID)
+	}
+
+	run := &mechanicsRun{invocation: invocation, result: &result, rolled: map[string]EngineRoll{}}
+	interactionKey := "effects"
+	if _, exists := mechanics["effects"]; !exists {
+		interactionKey = "interactions"
+	}
+	for index, interaction := range mechanicsInteractions(mechanics) {
+		path := fmt.Sprintf("mechanics.%s[%d]", interactionKey, index)
+		if err := run.interaction(index, interaction, targets, path); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// mechanicsPendingSave — спасбросок одной цели, подготовленный без броска:
+// обе ветки исходов уже посчитаны с поправками урона этой цели.
+type mechanicsPendingSave struct {
+	Interaction int
+	TargetID    string
+	Ability     string
+	DC          int
+	OnFail      []MechanicsOutcome
+	OnSuccess   []MechanicsOutcome
+}
+
+// interpretMechanicsSaves готовит save-интеракции к отложенному разрешению
+// целями. Урон бросается один раз на всех (rollCached), успех делит тот же
+// бросок пополам; остальные интеракции механики не исполняются.
+func interpretMechanicsSaves(invocation mechanicsInvocation) ([]mechanicsPendingSave, error) {
+	if invocation.RNG == nil {
+		invocation.RNG = newDiceRNG(0)
+	}
+	mechanics := invocation.Mechanics
+	targets, err := resolveMechanicsTargets(mechanics, invocation)
+	if err != nil {
+		return nil, err
+	}
+	result := MechanicsResult{Outcomes: []MechanicsOutcome{}}
+	run := &mechanicsRun{invocation: invocation, result: &result, rolled: map[string]EngineRoll{}}
+	interactionKey := "effects"
+	if _, exists := mechanics["effects"]; !exists {
+		interactionKey = "interactions"
+	}
+	var saves []mechanicsPendingSave
+	for index, interaction := range mechanicsInteractions(mechanics) {
+		if interaction["resolution"] != "save" {
+			continue
+		}
+		path := fmt.Sprintf("mechanics.%s[%d]", interactionKey, index)
+		ability, dc, err := run.saveDifficulty(interaction, path)
+		if err != nil {
+			return nil, err
+		}
+		recipients := targets
+		if mechanicsWho(interaction, "target") == "self" {
+			recipients = []mechanicsActor{invocation.Actor}
+		}
+		if len(recipients) == 0 {
+			return nil, invalidMechanics(path, "requires a target")
+		}
+		for _, recipient := range recipients {
+			pending := mechanicsPendingSave{Interaction: index, TargetID: recipient.ID, Ability: ability, DC: dc}
+			start := len(result.Outcomes)
+			if err := run.saveOutcome(index, interaction, recipient, false, path); err != nil {
+				return nil, err
+			}
+			middle := len(result.Outcomes)
+			if err := run.saveOutcome(index, interaction, recipient, true, path); err != nil {
+				return nil, err
+			}
+			pending.OnFail = append([]MechanicsOutcome{}, result.Outcomes[start:middle]...)
+			pending.OnSuccess = append([]MechanicsOutcome{}, result.Outcomes[middle:]...)
+			saves = append(saves, pending)
+		}
+	}
+	if len(saves) == 0 {
+		return nil, invalidMechanics("mechanics", "has no save interactions")
+	}
+	return saves, nil
+}
+
+func readMechanicsActivation(mechanics JSONMap, invocation mechanicsInvocation, result *MechanicsResult) error {
+	activation, _ := mechanics["activation"].(map[string]interface{})
+	if activation == nil {
+		return nil
+	}
+	if mode, ok := activation["mode"].(string); ok && mode != "" {
+		if !oneOf(mode, "active", "passive", "triggered") {
+			return invalidMechanics("mechanics.activation.mode", "is unsupported")
+		}
+		result.Mode = mode
+	}
+	for i, cost := range mechanicsPayloadList(activation["cost"]) {
+		path := fmt.Sprintf("mechanics.activation.cost[%d]", i)
+		resource, _ := cost["resource"].(string)
+		if resource == "" {
+			return invalidMechanics(path+".resource", "is required")
+		}
+		entry := MechanicsCost{Resource: resource, Amount: 1}
+		if raw, exists := cost["amount"]; exists {
+			amount, err := evalMechanicsNumber(raw, invocation.Actor.formulaContext(), path+".amount")
+			if err != nil {
+				return err
+			}
+			entry.Amount = amount
+		}
+		if level, ok := mechanicsNumber(cost["level"]); ok {
+			entry.Level = int(level)
+			// Повышенная ячейка: заклинание оплачивается ячейкой, которой сотворено.
+			if resource == "spell_slot" && invocation.SlotLevel > entry.Level {
+				entry.Level = invocation.SlotLevel
+			}
+		}
+		result.Costs = append(result.Costs, entry)
+	}
+	if uses, ok := mechanics["uses"].(map[string]interface{}); ok {
+		count, err := evalMechanicsNumber(uses["count"], invocation.Actor.formulaContext(), "mechanics.uses.count")
+		if err != nil {
+			return err
+		}
+		per, _ := uses["per"].(string)
+		result.Uses = &MechanicsUses{Count: count, Per: per}
+	}
+	return nil
+}
+
+// resolveMechanicsTargets применяет targeting: self-механики всегда целятся в
+// исполнителя, иначе число переданных целей проверяется по min/max_targets.
+func resolveMechanicsTargets(mechanics JSONMap, invocation mechanicsInvocation) ([]mechanicsActor, error) {
+	targeting, _ := mechanics["targeting"].(map[string]interface{})
+	if targeting != nil && targeting["shape"] == "self" {
+		return []mechanicsActor{invocation.Actor}, nil
+	}
+	targets := invocation.Targets
+	if targeting != nil {
+		if minimum, ok := mechanicsNumber(targeting["min_targets"]); ok && len(targets) < int(minimum) {
+			return nil, invalidMechanics("targets", fmt.Sprintf("requires at least %d targets", int(minimum)))
+		}
+		if raw, exists := targeting["max_targets"]; exists {
+			maximum, err := evalMechanicsNumber(raw, invocation.Actor.formulaContext(), "mechanics.targeting.max_targets")
+			if err != nil {
+				return nil, err
+			}
+			if len(targets) > maximum {
+				return nil, invalidMechanics("targets", fmt.Sprintf("allows at most %d targets", maximum))
+			}
+		}
+		if targeting["shape"] == "single" && len(targets) > 1 {
+			return nil, invalidMechanics("targets", "single-target mechanics accept one target")
+		}
+	}
+	return targets, nil
+}
+
+type mechanicsRun struct {
+	invocation mechanicsInvocation
+	result     *MechanicsResult
+	// rolled хранит уже брошенные суммы: урон площадного заклинания бросается
+	// один раз на всех целей, а не отдельно для каждой.
+	rolled map[string]EngineRoll
+}
+
+func (r *mechanicsRun) interaction(index int, interaction map[string]interface{}, targets []mechanicsActor, path string) error {
+	if interaction["kind"] == "choice" {
+		r.result.Outcomes = append(r.result.Outcomes, MechanicsOutcome{
+			Interaction: index, Resolution: "choice", Branch: "auto", Kind: "choice",
+			ActorID: r.invocation.Actor.ID, TargetID: r.invocation.Actor.ID, Payload: JSONMap(interaction),
+		})
+		return nil
+	}
+	resolution, _ := interaction["resolution"].(string)
+	switch resolution {
+	case "auto":
+		who := mechanicsWho(interaction, "self")
+		results := interaction["result"]
+		if results == nil {
+			results = interaction["results"]
+		}
+		if who == "self" {
+			return r.payloads(index, resolution, "auto", results, r.invocation.Actor, false, false, path+".result")
+		}
+		if len(targets) == 0 {
+			return invalidMechanics(path, "requires a target")
+		}
+		for _, target := range targets {
+			if err := r.payloads(index, resolution, "auto", results, target, false, false, path+".result"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "attack_roll":
+		if len(targets) == 0 {
+			return invalidMechanics(path, "requires a target")
+		}
+		for _, target := range targets {
+			if err := r.attack(index, interaction, target, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "save":
+		if mechanicsWho(interaction, "target") == "self" {
+			return r.save(index, interaction, r.invocation.Actor, path)
+		}
+		if len(targets) == 0 {
+			return invalidMechanics(path, "requires a target")
+		}
+		for _, target := range targets {
+			if err := r.save(index, interaction, target, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "ability_check":
+		return r.abilityCheck(index, interaction, targets, path)
+	case "on_acquire", "immediate", "on_rest":
+		// Выборы и grant-ы уровня сборки персонажа исполняются при создании/повышении уровня.
+		return nil
+	default:
+		return invalidMechanics(path+".resolution", "is unsupported")
+	}
+}
+
+func mechanicsWho(interaction map[string]interface{}, fallback string) string {
+	if who, ok := interaction["who"].(string); ok && who != "" {
+		return who
+	}
+	return fallback
+}
+
+// attackAbility выбирает характеристику атаки по виду атаки, если механика её не задала.
+func attackAbility(interaction map[string]interface{}) string {
+	if ability, ok := interaction["ability"].(string); ok && ability != "" {
+		return ability
+	}
+	switch interaction["attack_kind"] {
+	case "spell_melee", "spell_ranged":
+		return "spellcasting"
+	case "weapon_ranged":
+		return "dex"
+	default:
+		return "str"
+	}
+}
+
+func isMeleeAttackKind(kind interface{}) bool {
+	return kind != "weapon_ranged" && kind != "spell_ranged"
+}
+
+// conditionAttackAdvantage — преимущество/помеха атаки от состояний
+// атакующего и цели (SRD 5.2: Ослеплён, Невидим, Опрокинут, Схвачен и т.д.).
+func conditionAttackAdvantage(attacker, target mechanicsActor, melee bool) string {
+	var sources []string
+	for _, condition := range []string{"blinded", "frightened", "poisoned", "prone", "restrained"} {
+		if attacker.Conditions[condition] {
+			sources = append(sources, "disadvantage")
+		}
+	}
+	if attacker.Conditions["invisible"] {
+		sources = append(sources, "advantage")
+	}
+	for _, condition := range []string{"blinded", "paralyzed", "petrified", "restrained", "stunned", "unconscious"} {
+		if target.Conditions[condition] {
+			sources = append(sources, "advantage")
+		}
+	}
+	if target.Conditions["invisible"] {
+		sources = append(sources, "disadvantage")
+	}
+	if target.Conditions["prone"] {
+		if melee {
+			sources = append(sources, "advantage")
+		} else {
+			sources = append(sources, "disadvantage")
+		}
+	}
+	return combineAdvantage(sources...)
+}
+
+func (r *mechanicsRun) attack(index int, interaction map[string]interface{}, target mechanicsActor, path string) error {
+	actor := r.invocation.Actor
+	ability := attackAbility(interaction)
+	modifiers := []EngineRollModifier{{Value: actor.abilityModifier(ability), Source: abilityLabel(ability)}}
+	if !r.invocation.WithoutProficiency {
+		modifiers = append(modifiers, EngineRollModifier{Value: actor.ProficiencyBonus, Source: "БМ"})
+	}
+	modifiers = append(modifiers, r.invocation.AttackModifiers...)
+	advantage := combineAdvantage(
+		r.invocation.Advantage,
+		stringField(interaction, "advantage"),
+		conditionAttackAdvantage(actor, target, isMeleeAttackKind(interaction["attack_kind"])),
+	)
+	roll, _ := rollD20Test(r.invocation.RNG, "d20", advantage, modifiers, &EngineRollTarget{Type: "ac", Value: target.ArmorClass})
+	r.result.Checks = append(r.result.Checks, MechanicsCheck{
+		Interaction: index, Resolution: "attack_roll", RollerID: actor.ID, TargetID: target.ID,
+		Branch: roll.Outcome, Roll: roll,
+	})
+	who := mechanicsWho(interaction, "target")
+	recipient := target
+	if who == "self" {
+		recipient = actor
+	}
+	switch roll.Outcome {
+	case "crit":
+		if err := r.payloads(index, "attack_roll", "crit", interaction["on_hit"], recipient, false, true, path+".on_hit"); err != nil {
+			return err
+		}
+		return r.payloads(index, "attack_roll", "crit", interaction["on_crit"], recipient, false, true, path+".on_crit")
+	case "hit":
+		return r.payloads(index, "attack_roll", "hit", interaction["on_hit"], recipient, false, false, path+".on_hit")
+	default:
+		return r.payloads(index, "attack_roll", "miss", interaction["on_miss"], recipient, false, false, path+".on_miss")
+	}
+}
+
+// saveAutoFails — Парализован/Ошеломлён/Без сознания/Окаменел проваливают
+// спасброски СИЛ и ЛВК без броска.
+func saveAutoFails(roller mechanicsActor, ability string) bool {
+	if ability != "str" && ability != "dex" {
+		return false
+	}
+	return roller.Conditions["paralyzed"] || roller.Conditions["stunned"] ||
+		roller.Conditions["unconscious"] || roller.Conditions["petrified"]
+}
+
+// rollActorSave бросает спасбросок участника против СЛ: автопровал СИЛ/ЛВК от
+// состояний, помеха ЛВК у опутанного, модификатор характеристики и владение.
+func rollActorSave(rng diceRNG, roller mechanicsActor, ability string, dc int) EngineRoll {
+	if saveAutoFails(roller, ability) {
+		return EngineRoll{
+			Kind: "save", Dice: []EngineRollDie{}, Advantage: "none", Modifiers: []EngineRollModifier{},
+			Target: &EngineRollTarget{Type: "dc", Value: dc}, Outcome: "fail",
+			Text: fmt.Sprintf("Спасбросок %s — автопровал", abilityLabel(ability)),
+		}
+	}
+	advantage := "none"
+	if ability == "dex" && roller.Conditions["restrained"] {
+		advantage = "disadvantage"
+	}
+	modifiers := []EngineRollModifier{{Value: roller.abilityModifier(ability), Source: abilityLabel(ability)}}
+	if roller.SaveProficiencies[ability] {
+		modifiers = append(modifiers, EngineRollModifier{Value: roller.ProficiencyBonus, Source: "БМ"})
+	}
+	roll, _ := rollD20Test(rng, "save", advantage, modifiers, &EngineRollTarget{Type: "dc", Value: dc})
+	return roll
+}
+
+// saveDifficulty читает характеристику и СЛ save-интеракции; СЛ считается от исполнителя.
+func (r *mechanicsRun) saveDifficulty(interaction map[string]interface{}, path string) (string, int, error) {
+	ability, _ := interaction["ability"].(string)
+	if !oneOf(ability, abilityKeys...) {
+		return "", 0, invalidMechanics(path+".ability", "must be str|dex|con|int|wis|cha")
+	}
+	dc, err := evalMechanicsNumber(interaction["dc"], r.formulaContext(r.invocation.Actor, false), path+".dc")
+	if err != nil {
+		return "", 0, err
+	}
+	if dc <= 0 {
+		return "", 0, invalidMechanics(path+".dc", "must be positive")
+	}
+	return ability, dc, nil
+}
+
+func (r *mechanicsRun) save(index int, interaction map[string]interface{}, roller mechanicsActor, path string) error {
+	ability, dc, err := r.saveDifficulty(interaction, path)
+	if err != nil {
+		return err
+	}
+	roll := rollActorSave(r.invocation.RNG, roller, ability, dc)
+	r.result.Checks = append(r.result.Checks, MechanicsCheck{
+		Interaction: index, Resolution: "save", RollerID: roller.ID, TargetID: roller.ID,
+		Branch: roll.Outcome, Roll: roll,
+	})
+	return r.saveOutcome(index, interaction, roller, roll.Outcome == "success", path)
+}
+
+// saveOutcome применяет ветку спасброска. При успехе действует on_success;
+// если в нём есть payload с on_success:"half", урон ветки делится пополам.
+// Если on_success пуст, урон из on_fail с on_success:"half"|"full" всё равно
+// проходит (половина/полностью) — так записана большая часть площадных заклинаний.
+func (r *mechanicsRun) saveOutcome(index int, interaction map[string]interface{}, recipient mechanicsActor, success bool, path string) error {
+	if !success {
+		return r.payloads(index, "save", "fail", interaction["on_fail"], recipient, false, false, path+".on_fail")
+	}
+	onSuccess := mechanicsPayloadList(interaction["on_success"])
+	if len(onSuccess) > 0 {
+		half := false
+		for _, payload := range onSuccess {
+			if payload["on_success"] == "half" {
+				half = true
+			}
+		}
+		return r.payloads(index, "save", "success", interaction["on_success"], recipient, half, false, path+".on_success")
+	}
+	for i, payload := range mechanicsPayloadList(interaction["on_fail"]) {
+		if payload["kind"] != "damage" {
+			continue
+		}
+		mode, _ := payload["on_success"].(string)
+		if mode != "half" && mode != "full" {
+			continue
+		}
+		payloadPath := fmt.Sprintf("%s.on_fail[%d]", path, i)
+		if err := r.payload(index, "save", "success", payload, recipient, mode == "half", false, payloadPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *mechanicsRun) abilityCheck(index int, interaction map[string]interface{}, targets []mechanicsActor, path string) error {
+	if mode, _ := interaction["mode"].(string); mode == "contest" {
+		return invalidMechanics(path+".mode", "contests are resolved by the table")
+	}
+	actor := r.invocation.Actor
+	ability, _ := interaction["ability"].(string)
+	if !oneOf(ability, abilityKeys...) && ability != "spellcasting" {
+		return invalidMechanics(path+".ability", "must be an ability")
+	}
+	dc, err := evalMechanicsNumber(interaction["dc"], r.formulaContext(actor, false), path+".dc")
+	if err != nil {
+		return err
+	}
+	modifiers := []EngineRollModifier{{Value: actor.abilityModifier(ability), Source: abilityLabel(ability)}}
+	roll, _ := rollD20Test(r.invocation.RNG, "check", "none", modifiers, &EngineRollTarget{Type: "dc", Value: dc})
+	r.result.Checks = append(r.result.Checks, MechanicsCheck{
+		Interaction: index, Resolution: "ability_check", RollerID: actor.ID, Branch: roll.Outcome, Roll: roll,
+	})
+	key, branch := "on_fail", "fail"
+	if roll.Outcome == "success" {
+		key, branch = "on_success", "success"
+	}
+	if mechanicsWho(interaction, "self") == "self" {
+		return r.payloads(index, "ability_check", branch, interaction[key], actor, false, false, path+"."+key)
+	}
+	for _, target := range targets {
+		if err := r.payloads(index, "ability_check", branch, interaction[key], target, false, false, path+"."+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *mechanicsRun) payloads(index int, resolution, branch string, raw interface{}, recipient mechanicsActor, half, crit bool, path string) error {
+	if raw == nil {
+		return nil
+	}
+	if _, ok := raw.([]interface{}); !ok {
+		return invalidMechanics(path, "must be an array of payloads")
+	}
+	for i, payload := range mechanicsPayloadList(raw) {
+		if err := r.payload(index, resolution, branch, payload, recipient, half, crit, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *mechanicsRun) payload(index int, resolution, branch string, payload map[string]interface{}, recipient mechanicsActor, half, crit bool, path string) error {
+	kind, _ := payload["kind"].(string)
+	if kind == "" {
+		return invalidMechanics(path+".kind", "is required")
+	}
+	outcome := MechanicsOutcome{
+		Interaction: index, Resolution: resolution, Branch: branch, Kind: kind,
+		ActorID: r.invocation.Actor.ID, TargetID: recipient.ID, Payload: JSONMap(payload),
+	}
+	caster := r.formulaContext(r.invocation.Actor, crit)
+	switch kind {
+	case "damage":
+		damageType, _ := payload["type"].(string)
+		if damageType == "" {
+			return invalidMechanics(path+".type", "is required")
+		}
+		formula, formulaPath := payload["dice"], path+".dice"
+		if formula == nil {
+			formula, formulaPath = payload["amount"], path+".amount"
+		}
+		roll, err := r.rollCached(formulaPath, crit, formula, caster, "damage")
+		if err != nil {
+			return err
+		}
+		if err := r.addScaling(&roll, payload, path, crit); err != nil {
+			return err
+		}
+		amount := roll.Total
+		if amount < 0 {
+			amount = 0
+		}
+		if half {
+			amount /= 2
+		}
+		outcome.RawAmount = amount
+		outcome.Amount, outcome.Adjustment = adjustDamage(recipient, damageType, amount)
+		outcome.DamageType = damageType
+		outcome.Roll = &roll
+	case "healing", "temp_hp":
+		roll, err := r.rollCached(path+".amount", false, payload["amount"], caster, "healing")
+		if err != nil {
+			return err
+		}
+		if err := r.addScaling(&roll, payload, path, false); err != nil {
+			return err
+		}
+		if kind == "temp_hp" {
+			roll.Kind = "other"
+		}
+		outcome.Amount = roll.Total
+		if outcome.Amount < 0 {
+			outcome.Amount = 0
+		}
+		outcome.Roll = &roll
+	case "condition":
+		value, _ := payload["value"].(string)
+		if value == "" {
+			return invalidMechanics(path+".value", "condition id must be non-empty")
+		}
+		op := stringFieldOr(payload, "op", "apply")
+		if !oneOf(op, "apply", "remove") {
+			return invalidMechanics(path+".op", "is unsupported")
+		}
+		outcome.Value, outcome.Op = value, op
+		if op == "apply" && recipient.ConditionImmunities[value] {
+			outcome.Kind = "condition_immune"
+		}
+		if rounds, ok := durationRounds(payload["duration"]); ok {
+			outcome.RoundsLeft = &rounds
+		}
+	case "resource":
+		id, _ := payload["id"].(string)
+		if id == "" {
+			id, _ = payload["resource"].(string)
+		}
+		if id == "" {
+			return invalidMechanics(path+".id", "resource id must be non-empty")
+		}
+		op := stringFieldOr(payload, "op", "grant")
+		if !oneOf(op, "grant", "restore", "spend") {
+			return invalidMechanics(path+".op", "is unsupported")
+		}
+		amount := 1
+		if raw, exists := payload["amount"]; exists {
+			roll, err := rollMechanicsFormula(raw, caster, "other", path+".amount")
+			if err != nil {
+				return err
+			}
+			amount = roll.Total
+		}
+		outcome.ResourceID, outcome.Op, outcome.Amount = id, op, amount
+	case "modifier":
+		appliesTo, _ := payload["applies_to"].(map[string]interface{})
+		outcome.Value, _ = appliesTo["roll"].(string)
+		outcome.Op = stringFieldOr(payload, "op", "add")
+		if raw, exists := payload["value"]; exists && oneOf(outcome.Op, "add", "set", "multiply") {
+			value, err := evalMechanicsNumber(raw, caster, path+".value")
+			if err != nil {
+				return err
+			}
+			outcome.Amount = value
+		}
+	case "set_value":
+		outcome.Value, _ = payload["target"].(string)
+		value, err := evalMechanicsNumber(payload["formula"], r.formulaContext(recipient, false), path+".formula")
+		if err != nil {
+			return err
+		}
+		outcome.Amount = value
+	case "resistance":
+		outcome.DamageType, _ = payload["damage_type"].(string)
+		outcome.Value = stringFieldOr(payload, "value", "resistance")
+	case "movement":
+		outcome.Value, _ = payload["value"].(string)
+		if raw, exists := payload["distance"]; exists {
+			distance, err := evalMechanicsNumber(raw, caster, path+".distance")
+			if err != nil {
+				return err
+			}
+			outcome.Amount = distance
+		}
+	case "grant_speed", "grant_sense":
+		if raw, exists := payload["value"]; exists {
+			if value, ok := mechanicsNumber(raw); ok {
+				outcome.Amount = int(value)
+			}
+		}
+		if raw, exists := payload["range"]; exists {
+			if value, ok := mechanicsNumber(raw); ok {
+				outcome.Amount = int(value)
+			}
+		}
+		outcome.Value = stringField(payload, "mode")
+		if kind == "grant_sense" {
+			outcome.Value = stringField(payload, "sense")
+		}
+	default:
+		// grant_*, narrative и прочие декларативные payload-ы передаются как есть:
+		// их применяет сборка персонажа или стол, а не серверный расчёт.
+		outcome.Value = stringField(payload, "value")
+	}
+	r.result.Outcomes = append(r.result.Outcomes, outcome)
+	return nil
+}
+
+// rollCached бросает формулу один раз на путь payload-а: цели площадного
+// эффекта получают одинаковую сумму, а крит удваивает кости только своей цели.
+func (r *mechanicsRun) rollCached(path string, crit bool, formula interface{}, ctx formulaContext, kind string) (EngineRoll, error) {
+	key := path
+	if crit {
+		key += "#crit"
+	}
+	if roll, ok := r.rolled[key]; ok {
+		return roll, nil
+	}
+	roll, err := rollMechanicsFormula(formula, ctx, kind, path)
+	if err != nil {
+		return EngineRoll{}, err
+	}
+	r.rolled[key] = roll
+	return roll, nil
+}
+
+// addScaling добавляет кости масштабирования: за каждый круг ячейки выше
+// базового (spell_slot_above) или по порогам 5/11/17 уровня для заговоров.
+func (r *mechanicsRun) addScaling(roll *EngineRoll, payload map[string]interface{}, path string, crit bool) error {
+	scaling, _ := payload["scaling"].(map[string]interface{})
+	if scaling == nil {
+		return nil
+	}
+	steps := 0
+	switch scaling["per"] {
+	case "spell_slot_above", "slot_level":
+		if r.invocation.SlotLevel > r.invocation.BaseLevel {
+			steps = r.invocation.SlotLevel - r.invocation.BaseLevel
+		}
+	case "character_level", "cantrip":
+		for _, threshold := range []int{5, 11, 17} {
+			if r.invocation.Actor.Level >= threshold {
+				steps++
+			}
+		}
+	default:
+		return nil
+	}
+	dice, _ := scaling["dice"].(string)
+	if steps == 0 || dice == "" {
+		return nil
+	}
+	key := path + ".scaling"
+	if crit {
+		key += "#crit"
+	}
+	extra, ok := r.rolled[key]
+	if !ok {
+		var err error
+		extra, err = rollMechanicsFormula(strings.TrimSuffix(strings.Repeat(dice+" + ", steps), " + "), r.formulaContext(r.invocation.Actor, crit), roll.Kind, path+".scaling.dice")
+		if err != nil {
+			return err
+		}
+		r.rolled[key] = extra
+	}
+	roll.Dice = append(roll.Dice, extra.Dice...)
+	roll.Modifiers = append(roll.Modifiers, extra.Modifiers...)
+	roll.Total += extra.Total
+	roll.Text = formulaRollText(roll.Dice, roll.Modifiers, roll.Total)
+	return nil
+}
+
+// adjustDamage применяет иммунитет, сопротивление и уязвимость получателя.
+func adjustDamage(recipient mechanicsActor, damageType string, amount int) (int, string) {
+	if recipient.Immunities[damageType] {
+		return 0, "immunity"
+	}
+	adjustment := ""
+	if recipient.Resistances[damageType] {
+		amount /= 2
+		adjustment = "resistance"
+	}
+	if recipient.Vulnerabilities[damageType] {
+		amount *= 2
+		if adjustment == "" {
+			adjustment = "vulnerability"
+		} else {
+			adjustment = "resistance+vulnerability"
+		}
+	}
+	return amount, adjustment
+}
+
+// durationRounds переводит duration payload-а в раунды (1 минута = 10 раундов).
+func durationRounds(raw interface{}) (int, bool) {
+	duration, _ := raw.(map[string]interface{})
+	if duration == nil {
+		return 0, false
+	}
+	amount, ok := mechanicsNumber(duration["amount"])
+	if !ok {
+		amount = 1
+	}
+	switch duration["type"] {
+	case "rounds":
+		return int(amount), true
+	case "minutes":
+		return int(amount) * 10, true
+	case "hours":
+		return int(amount) * 600, true
+	}
+	return 0, false
+}
+
+func stringField(object map[string]interface{}, key string) string {
+	value, _ := object[key].(string)
+	return value
+}
+
+func stringFieldOr(object map[string]interface{}, key, fallback string) string {
+	if value, ok := object[key].(string); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+var abilityLabels = map[string]string{
+	"str": "СИЛ", "dex": "ЛВК", "con": "ТЕЛ", "int": "ИНТ", "wis": "МДР", "cha": "ХАР",
+	"spellcasting": "заклин.",
+}
+
+func abilityLabel(ability string) string {
+	if label, ok := abilityLabels[ability]; ok {
+		return label
+	}
+	return ability
+}
+
+// formulaContext — окружение формулы для actor-а внутри прогона: сколько
+// кругов над базовым, удваивать ли кости (крит), общий генератор.
+func (r *mechanicsRun) formulaContext(actor mechanicsActor, crit bool) formulaContext {
+	ctx := actor.formulaContext()
+	if actor.ID == r.invocation.Actor.ID {
+		ctx.WeaponMod = r.invocation.WeaponMod
+	}
+	if r.invocation.SlotLevel > r.invocation.BaseLevel {
+		ctx.SpellSlotAbove = r.invocation.SlotLevel - r.invocation.BaseLevel
+	}
+	ctx.CritDice = crit
+	ctx.RNG = r.invocation.RNG
+	return ctx
+}
+
+// rollMechanicsFormula бросает формулу механики и переводит ошибки формулы в
+// ошибку механики с путём.
+func rollMechanicsFormula(raw interface{}, ctx formulaContext, kind, path string) (EngineRoll, error) {
+	if raw == nil {
+		return EngineRoll{}, invalidMechanics(path, "must be a number or formula")
+	}
+	evaluation, err := evaluateFormula(raw, ctx)
+	if err != nil {
+		return EngineRoll{}, invalidMechanics(path, err.Error())
+	}
+	if evaluation.Marker != "" {
+		return EngineRoll{}, invalidMechanics(path, fmt.Sprintf("formula marker %q cannot be rolled here", evaluation.Marker))
+	}
+	return evaluation.engineRoll(kind), nil
+}
+
+// evalMechanicsNumber вычисляет формулу, в которой не должно быть костей
+// (СЛ, count, бонусы модификаторов).
+func evalMechanicsNumber(raw interface{}, ctx formulaContext, path string) (int, error) {
+	roll, err := rollMechanicsFormula(raw, ctx, "other", path)
+	if err != nil {
+		return 0, err
+	}
+	if len(roll.Dice) > 0 {
+		return 0, invalidMechanics(path, "must not contain dice")
+	}
+	return roll.Total, nil
+}
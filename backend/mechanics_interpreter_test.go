@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// scriptedDice отдаёт заранее заданные результаты бросков по порядку.
+type scriptedDice struct {
+	t       *testing.T
+	results []int
+}
+
+func (s *scriptedDice) Intn(n int) int {
+	if len(s.results) == 0 {
+		s.t.Fatalf("unexpected extra die d%d", n)
+	}
+	next := s.results[0]
+	s.results = s.results[1:]
+	if next < 1 || next > n {
+		s.t.Fatalf("scripted result %d does not fit d%d", next, n)
+	}
+	return next - 1
+}
+
+func scripted(t *testing.T, results ...int) *scriptedDice {
+	return &scriptedDice{t: t, results: results}
+}
+
+func mustMechanics(t *testing.T, raw string) JSONMap {
+	t.Helper()
+	var mechanics JSONMap
+	if err := json.Unmarshal([]byte(raw), &mechanics); err != nil {
+		t.Fatalf("invalid test mechanics: %v", err)
+	}
+	return mechanics
+}
+
+func testWizard() mechanicsActor {
+	abilities := JSONMap{"str": 8, "dex": 14, "con": 12, "int": 16, "wis": 10, "cha": 10}
+	saves := Properties{"int", "wis"}
+	state := JSONMap{"spellcasting": map[string]interface{}{"ability": "int"}}
+	return mechanicsActorFromCharacter(CharacterV3{
+		ID: uuid.New(), Name: "Волшебник", Level: 5, ProficiencyBonus: 3, ArmorClass: 12,
+		Abilities: &abilities, SavingThrowProficiencies: &saves, RuleState: &state,
+	})
+}
+
+func testGoblin() mechanicsActor {
+	abilities := JSONMap{"str": 8.0, "dex": 14.0, "con": 10.0, "int": 10.0, "wis": 8.0, "cha": 8.0}
+	fireResistance := JSONMap{
+		"activation": map[string]interface{}{"mode": "passive"},
+		"effects": []interface{}{map[string]interface{}{
+			"resolution": "auto",
+			"result":     []interface{}{map[string]interface{}{"kind": "resistance", "damage_type": "fire"}},
+		}},
+	}
+	return mechanicsActorFromMonster(Monster{
+		ID: uuid.New(), Name: "Гоблин", ArmorClass: 15, MaxHP: 7, ProficiencyBonus: 2, Abilities: &abilities,
+	}, fireResistance)
+}
+
+func TestInterpretAttackRollHitsAndAppliesResistance(t *testing.T) {
+	mechanics := mustMechanics(t, `{
+		"activation": {"mode": "active", "cost": [{"resource": "action"}]},
+		"effects": [{"resolution": "attack_roll", "attack_kind": "spell_ranged", "ability": "spellcasting", "vs": "ac",
+			"on_hit": [{"kind": "damage", "dice": "2d10", "type": "fire"}]}]
+	}`)
+	goblin := testGoblin()
+	result, err := interpretMechanics(mechanicsInvocation{
+		Source: "Огненный снаряд", Mechanics: mechanics, Actor: testWizard(), Targets: []mechanicsActor{goblin},
+		RNG: scripted(t, 10, 7, 4),
+	})
+	if err != nil {
+		t.Fatalf("interpret: %v", err)
+	}
+	if len(result.Costs) != 1 || result.Costs[0].Resource != "action" || result.Costs[0].Amount != 1 {
+		t.Fatalf("unexpected costs: %#v", result.Costs)
+	}
+	check := result.Checks[0]
+	// d20(10) + ИНТ 3 + БМ 3 = 16 против КД 15.
+	if check.Roll.Total != 16 || check.Branch != "hit" {
+		t.Fatalf("unexpected attack roll: %#v", check.Roll)
+	}
+	outcome := result.Outcomes[0]
+	if outcome.Kind != "damage" || outcome.TargetID != goblin.ID || outcome.RawAmount != 11 || outcome.Amount != 5 || outcome.Adjustment != "resistance" {
+		t.Fatalf("resistance was not applied: %#v", outcome)
+	}
+}
+
+func TestInterpretAttackRollCritDoublesDiceAndAddsOnCrit(t *testing.T) {
+	mechanics := mustMechanics(t, `{
+		"effects": [{"resolution": "attack_roll", "attack_kind": "weapon_melee", "ability": "str",
+			"on_hit": [{"kind": "damage", "dice": "1d8 + str", "type": "slashing"}],
+			"on_crit": [{"kind": "condition", "value": "prone", "duration": {"type": "rounds", "amount": 1}}]}]
+	}`)
+	result, err := interpretMechanics(mechanicsInvocation{
+		Mechanics: mechanics, Actor: testWizard(), Targets: []mechanicsActor{testGoblin()},
+		RNG: scripted(t, 20, 3, 5),
+	})
+	if err != nil {
+		t.Fatalf("interpret: %v", err)
+	}
+	if result.Checks[0].Branch != "crit" {
+		t.Fatalf("natural 20 must crit: %#v", result.Checks[0])
+	}
+	damage := result.Outcomes[0]
+	// Две кости вместо одной: 3 + 5, модификатор СИЛ −1 не удваивается.
+	if len(damage.Roll.Dice) != 2 || damage.Amount != 7 {
+		t.Fatalf("crit damage mismatch: %#v", damage)
+	}
+	prone := result.Outcomes[1]
+	if prone.Kind != "condition" || prone.Value != "prone" || prone.RoundsLeft == nil || *prone.RoundsLeft != 1 {
+		t.Fatalf("on_crit payload missing: %#v", prone)
+	}
+}
+
+func TestInterpretSaveHalvesDamageOnSuccessForEveryTarget(t *testing.T) {
+	mechanics := mustMechanics(t, `{
+		"activation": {"mode": "active", "cost": [{"resource": "action"}, {"resource": "spell_slot", "level": 3}]},
+		"targeting": {"shape": "area", "max_targets": 4},
+		"effects": [{"resolution": "save", "who": "target", "ability": "dex", "dc": "8 + prof + spellcasting",
+			"on_fail": [{"kind": "damage", "dice": "8d6", "type": "fire", "on_success": "half",
+				"scaling": {"per": "spell_slot_above", "dice": "1d6"}}]}]
+	}`)
+	first, second := testGoblin(), testGoblin()
+	// Урон: 8d6 (все шестёрки... кроме первой) + 1d6 за ячейку 4-го круга; спасброски 2 и 20.
+	rng := scripted(t, 2, 1, 6, 6, 6, 6, 6, 6, 6, 6, 20)
+	result, err := interpretMechanics(mechanicsInvocation{
+		Mechanics: mechanics, Actor: testWizard(), Targets: []mechanicsActor{first, second},
+		SlotLevel: 4, BaseLevel: 3, RNG: rng,
+	})
+	if err != nil {
+		t.Fatalf("interpret: %v", err)
+	}
+	if result.Costs[1].Level != 4 {
+		t.Fatalf("upcast must spend the higher slot: %#v", result.Costs)
+	}
+	if result.Checks[0].Roll.Target.Value != 14 || result.Checks[0].Branch != "fail" || result.Checks[1].Branch != "success" {
+		t.Fatalf("unexpected saves: %#v", result.Checks)
+	}
+	failed, saved := result.Outcomes[0], result.Outcomes[1]
+	if failed.RawAmount != 49 || failed.Amount != 24 {
+		t.Fatalf("failed save damage mismatch: %#v", failed)
+	}
+	if saved.RawAmount != 24 || saved.Amount != 12 {
+		t.Fatalf("successful save must halve the same roll: %#v", saved)
+	}
+}
+
+func TestInterpretSaveAutoFailsForParalyzedTarget(t *testing.T) {
+	mechanics := mustMechanics(t, `{
+		"effects": [{"resolution": "save", "ability": "dex", "dc": 15,
+			"on_fail": [{"kind": "condition", "value": "restrained"}]}]
+	}`)
+	target := testGoblin()
+	target.Conditions["paralyzed"] = true
+	target.ConditionImmunities["restrained"] = true
+	result, err := interpretMechanics(mechanicsInvocation{
+		Mechanics: mechanics, Actor: testWizard(), Targets: []mechanicsActor{target}, RNG: scripted(t),
+	})
+	if err != nil {
+		t.Fatalf("interpret: %v", err)
+	}
+	if result.Checks[0].Roll.Outcome != "fail" || len(result.Checks[0].Roll.Dice) != 0 {
+		t.Fatalf("paralyzed dex save must auto-fail without a roll: %#v", result.Checks[0])
+	}
+	if result.Outcomes[0].Kind != "condition_immune" {
+		t.Fatalf("condition immunity ignored: %#v", result.Outcomes[0])
+	}
+}
+
+func TestInterpretAutoHealingUsesAndResource(t *testing.T) {
+	mechanics := mustMechanics(t, `{
+		"activation": {"mode": "active", "cost": [{"resource": "bonus_action"}]},
+		"uses": {"count": "prof_bonus", "per": "short_rest"},
+		"effects": [{"resolution": "auto", "result": [
+			{"kind": "healing", "amount": "1d10 + self_level"},
+			{"kind": "resource", "op": "spend", "id": "second_wind"},
+			{"kind": "modifier", "applies_to": {"roll": "ac"}, "op": "add", "value": "+2"},
+			{"kind": "narrative", "description": "Передышка"}
+		]}]
+	}`)
+	actor := testWizard()
+	result, err := interpretMechanics(mechanicsInvocation{Mechanics: mechanics, Actor: actor, RNG: scripted(t, 4)})
+	if err != nil {
+		t.Fatalf("interpret: %v", err)
+	}
+	if result.Uses == nil || result.Uses.Count != 3 || result.Uses.Per != "short_rest" {
+		t.Fatalf("uses not resolved: %#v", result.Uses)
+	}
+	kinds := []string{}
+	for _, outcome := range result.Outcomes {
+		if outcome.TargetID != actor.ID {
+			t.Fatalf("auto payloads must route to self: %#v", outcome)
+		}
+		kinds = append(kinds, outcome.Kind)
+	}
+	if len(kinds) != 4 || result.Outcomes[0].Amount != 9 || result.Outcomes[1].Amount != 1 || result.Outcomes[2].Amount != 2 {
+		t.Fatalf("unexpected auto outcomes %v: %#v", kinds, result.Outcomes)
+	}
+}
+
+func TestInterpretRejectsUnexecutableContent(t *testing.T) {
+	cases := map[string]string{
+		"mechanics.effects[0].result[0].dice": `{"effects": [{"resolution": "auto", "who": "target",
+			"result": [{"kind": "damage", "dice": "2d6 + mystery", "type": "fire"}]}]}`,
+		"mechanics.effects[0].resolution": `{"effects": [{"resolution": "telepathy"}]}`,
+		"mechanics.effects[0].dc":         `{"effects": [{"resolution": "save", "ability": "wis", "dc": "1d20"}]}`,
+	}
+	for wantPath, raw := range cases {
+		_, err := interpretMechanics(mechanicsInvocation{
+			Mechanics: mustMechanics(t, raw), Actor: testWizard(), Targets: []mechanicsActor{testGoblin()},
+			RNG: newDiceRNG(1),
+		})
+		interpretErr, ok := err.(*mechanicsInterpretError)
+		if !ok || interpretErr.Path != wantPath {
+			t.Fatalf("expected error at %s, got %v", wantPath, err)
+		}
+	}
+}
+
+func TestInterpretTargetingLimits(t *testing.T) {
+	mechanics := mustMechanics(t, `{"targeting": {"shape": "single"},
+		"effects": [{"resolution": "attack_roll", "on_hit": []}]}`)
+	_, err := interpretMechanics(mechanicsInvocation{
+		Mechanics: mechanics, Actor: testWizard(), Targets: []mechanicsActor{testGoblin(), testGoblin()}, RNG: newDiceRNG(1),
+	})
+	if err == nil {
+		t.Fatal("single-target mechanics accepted two targets")
+	}
+	_, err = interpretMechanics(mechanicsInvocation{Mechanics: mechanics, Actor: testWizard(), RNG: newDiceRNG(1)})
+	if err == nil {
+		t.Fatal("attack without a target accepted")
+	}
+}
+
+func TestConditionAttackAdvantage(t *testing.T) {
+	attacker, target := testWizard(), testGoblin()
+	target.Conditions["prone"] = true
+	if got := conditionAttackAdvantage(attacker, target, true); got != "advantage" {
+		t.Fatalf("melee vs prone = %s", got)
+	}
+	if got := conditionAttackAdvantage(attacker, target, false); got != "disadvantage" {
+		t.Fatalf("ranged vs prone = %s", got)
+	}
+	attacker.Conditions["poisoned"] = true
+	if got := conditionAttackAdvantage(attacker, target, true); got != "none" {
+		t.Fatalf("advantage and disadvantage must cancel, got %s", got)
+	}
+}
+
+func TestEngineRollMapPassesCharacterEventValidation(t *testing.T) {
+	roll, _ := rollD20Test(scripted(t, 12, 17), "d20", "advantage",
+		[]EngineRollModifier{{Value: 5, Source: "СИЛ"}}, &EngineRollTarget{Type: "ac", Value: 15})
+	if roll.Total != 22 || roll.Outcome != "hit" || !roll.Dice[0].Discarded {
+		t.Fatalf("advantage roll mismatch: %#v", roll)
+	}
+	payload := JSONMap{"type": "roll", "label": "Атака", "roll": roll.toJSONMap()}
+	if err := validateCharacterEvent("roll", payload); err != nil {
+		t.Fatalf("server roll rejected by journal validator: %v", err)
+	}
+}
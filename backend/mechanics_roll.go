@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// diceRNG — источник случайности серверных бросков. Интерпретатор механик и
+// все серверные броски принимают его явно, чтобы тесты и повторяемые прогоны
+// могли подставить генератор с фиксированным seed.
+type diceRNG interface {
+	Intn(n int) int
+}
+
+// newDiceRNG создаёт независимый генератор. seed == 0 означает «случайный».
+func newDiceRNG(seed int64) diceRNG {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+func rollDie(rng diceRNG, sides int) int {
+	if sides <= 1 {
+		return 1
+	}
+	return rng.Intn(sides) + 1
+}
+
+// EngineRollDie / EngineRollModifier / EngineRollTarget / EngineRoll повторяют
+// wire-форму payload.roll из character_event_validation.go, поэтому серверный
+// бросок можно без преобразований записать в журнал персонажа.
+type EngineRollDie struct {
+	Sides     int    `json:"sides"`
+	Result    int    `json:"result"`
+	Discarded bool   `json:"discarded,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Sign      int    `json:"sign,omitempty"`
+}
+
+type EngineRollModifier struct {
+	Value  int    `json:"value"`
+	Source string `json:"source"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type EngineRollTarget struct {
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+type EngineRoll struct {
+	Kind      string               `json:"kind"`
+	Dice      []EngineRollDie      `json:"dice"`
+	Advantage string               `json:"advantage"`
+	Modifiers []EngineRollModifier `json:"modifiers"`
+	Total     int                  `json:"total"`
+	Text      string               `json:"text"`
+	Target    *EngineRollTarget    `json:"target,omitempty"`
+	Outcome   string               `json:"outcome,omitempty"`
+}
+
+// toJSONMap превращает бросок в payload.roll для CharacterEvent.
+func (r EngineRoll) toJSONMap() JSONMap {
+	dice := make([]interface{}, 0, len(r.Dice))
+	for _, die := range r.Dice {
+		entry := map[string]interface{}{"sides": die.Sides, "result": die.Result}
+		if die.Discarded {
+			entry["discarded"] = true
+		}
+		if die.Source != "" {
+			entry["source"] = die.Source
+		}
+		if die.Sign != 0 {
+			entry["sign"] = die.Sign
+		}
+		dice = append(dice, entry)
+	}
+	modifiers := make([]interface{}, 0, len(r.Modifiers))
+	for _, modifier := range r.Modifiers {
+		entry := map[string]interface{}{"value": modifier.Value, "source": modifier.Source}
+		if modifier.Reason != "" {
+			entry["reason"] = modifier.Reason
+		}
+		modifiers = append(modifiers, entry)
+	}
+	result := JSONMap{
+		"kind": r.Kind, "dice": dice, "advantage": r.Advantage,
+		"modifiers": modifiers, "total": r.Total, "text": r.Text,
+	}
+	if r.Target != nil {
+		result["target"] = map[string]interface{}{"type": r.Target.Type, "value": r.Target.Value}
+	}
+	if r.Outcome != "" {
+		result["outcome"] = r.Outcome
+	}
+	return result
+}
+
+// combineAdvantage сводит источники преимущества/помехи по правилу 5e: любое
+// сочетание преимущества и помехи взаимно гасится.
+func combineAdvantage(values ...string) string {
+	hasAdvantage, hasDisadvantage := false, false
+	for _, value := range values {
+		switch value {
+		case "advantage":
+			hasAdvantage = true
+		case "disadvantage":
+			hasDisadvantage = true
+		}
+	}
+	switch {
+	case hasAdvantage && !hasDisadvantage:
+		return "advantage"
+	case hasDisadvantage && !hasAdvantage:
+		return "disadvantage"
+	default:
+		return "none"
+	}
+}
+
+// rollD20Test бросает d20 (с преимуществом/помехой) плюс модификаторы против
+// КД или СЛ. Натуральные 20/1 у атаки дают crit/crit_miss; у спасброска и
+// проверки натуральные значения ничего не решают.
+func rollD20Test(rng diceRNG, kind, advantage string, modifiers []EngineRollModifier, target *EngineRollTarget) (EngineRoll, int) {
+	advantage = combineAdvantage(advantage)
+	first := rollDie(rng, 20)
+	dice := []EngineRollDie{{Sides: 20, Result: first}}
+	natural := first
+	if advantage != "none" {
+		second := rollDie(rng, 20)
+		dice = append(dice, EngineRollDie{Sides: 20, Result: second})
+		keepSecond := (advantage == "advantage" && second > first) || (advantage == "disadvantage" && second < first)
+		if keepSecond {
+			natural = second
+			dice[0].Discarded = true
+		} else {
+			dice[1].Discarded = true
+		}
+	}
+	total := natural
+	for _, modifier := range modifiers {
+		total += modifier.Value
+	}
+	roll := EngineRoll{
+		Kind: kind, Dice: dice, Advantage: advantage, Modifiers: nonNilRollModifiers(modifiers),
+		Total: total, Target: target,
+	}
+	if target != nil {
+		switch {
+		case kind == "d20" && natural == 20:
+			roll.Outcome = "crit"
+		case kind == "d20" && natural == 1:
+			roll.Outcome = "crit_miss"
+		case kind == "d20" && total >= target.Value:
+			roll.Outcome = "hit"
+		case kind == "d20":
+			roll.Outcome = "miss"
+		case total >= target.Value:
+			roll.Outcome = "success"
+		default:
+			roll.Outcome = "fail"
+		}
+	}
+	roll.Text = describeEngineRoll(roll)
+	return roll, natural
+}
+
+func nonNilRollModifiers(modifiers []EngineRollModifier) []EngineRollModifier {
+	if modifiers == nil {
+		return []EngineRollModifier{}
+	}
+	return modifiers
+}
+
+// describeEngineRoll — короткая человекочитаемая запись броска: «d20(14) +5 = 19 vs КД 15».
+func describeEngineRoll(roll EngineRoll) string {
+	var parts []string
+	for _, die := range roll.Dice {
+		if die.Discarded {
+			continue
+		}
+		sign := ""
+		if die.Sign < 0 {
+			sign = "-"
+		}
+		parts = append(parts, fmt.Sprintf("%sd%d(%d)", sign, die.Sides, die.Result))
+	}
+	text := strings.Join(parts, " + ")
+	for _, modifier := range roll.Modifiers {
+		if modifier.Value >= 0 {
+			text += fmt.Sprintf(" +%d", modifier.Value)
+		} else {
+			text += fmt.Sprintf(" %d", modifier.Value)
+		}
+	}
+	text = strings.TrimSpace(text) + fmt.Sprintf(" = %d", roll.Total)
+	if roll.Target != nil {
+		label := "СЛ"
+		if roll.Target.Type == "ac" {
+			label = "КД"
+		}
+		text += fmt.Sprintf(" vs %s %d", label, roll.Target.Value)
+	}
+	return text
+}
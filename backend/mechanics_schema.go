@@ -0,0 +1,755 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Серверная валидация Mechanics JSON по docs/mechanics.schema.json. Канон
+// схемы — frontend/src/schemas/mechanics.schema.json; scripts/
+// sync-mechanics-schema.mjs раскладывает его копии в docs/ и backend/schemas/
+// (Docker собирает только backend/, поэтому копия встраивается в бинарник).
+// Валидатор покрывает подмножество draft-07, которое реально использует схема;
+// незнакомое ключевое слово — ошибка загрузки, а не молчаливый пропуск.
+
+//go:embed schemas/mechanics.schema.json
+var mechanicsSchemaSource []byte
+
+// mechanicsSchema загружается при старте процесса: битая встроенная схема
+// должна ронять сервер, а не пропускать любую механику.
+var mechanicsSchema = mustLoadMechanicsSchema(mechanicsSchemaSource)
+
+// Вид MechanicCard (kind схемы) для сущностей контента. У предметов своего
+// вида нет: механика карточки — пассивный эффект с гейтом while.
+const (
+	mechanicsKindPassiveEffect = "passive_effect"
+	mechanicsKindAction        = "action"
+	mechanicsKindSpell         = "spell"
+)
+
+// maxMechanicsSchemaErrors ограничивает ответ: одной опечатки в payload-ах
+// хватает на десятки ошибок, а редактору нужны первые несколько.
+const maxMechanicsSchemaErrors = 20
+
+// mechanicsSchemaError — ошибка схемы с путём внутри механики
+// (mechanics.effects[0].result[1].type), как у characterEventValidationError.
+type mechanicsSchemaError struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+}
+
+func (e *mechanicsSchemaError) Error() string {
+	if e.Path == "" {
+		return e.Problem
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Problem)
+}
+
+// MechanicsSchemaVersion — ответ GET /api/mechanics/schema. SHA256 считается
+// по байтам встроенной схемы: фронтенд сравнивает его со своей копией.
+type MechanicsSchemaVersion struct {
+	ID            string `json:"id"`
+	SchemaVersion string `json:"schema_version"`
+	SHA256        string `json:"sha256"`
+}
+
+type mechanicsSchemaDocument struct {
+	root     interface{}
+	version  MechanicsSchemaVersion
+	patterns map[string]*regexp.Regexp
+}
+
+var mechanicsSchemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true,
+	// Обрабатываются вместе с properties / if.
+	"$defs": true, "then": true, "else": true,
+}
+
+var mechanicsSchemaKeywords = map[string]bool{
+	"$ref": true, "type": true, "enum": true, "const": true,
+	"properties": true, "additionalProperties": true, "required": true,
+	"minProperties": true, "propertyNames": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true, "contains": true,
+	"minLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true, "if": true,
+}
+
+func mustLoadMechanicsSchema(source []byte) *mechanicsSchemaDocument {
+	document, err := loadMechanicsSchema(source)
+	if err != nil {
+		panic(fmt.Sprintf("mechanics schema: %v", err))
+	}
+	return document
+}
+
+func loadMechanicsSchema(source []byte) (*mechanicsSchemaDocument, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(source, &root); err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(source)
+	document := &mechanicsSchemaDocument{
+		root:     root,
+		patterns: map[string]*regexp.Regexp{},
+		version:  MechanicsSchemaVersion{SHA256: hex.EncodeToString(digest[:])},
+	}
+	document.version.ID, _ = root["$id"].(string)
+	if properties, ok := root["properties"].(map[string]interface{}); ok {
+		if field, ok := properties["schema_version"].(map[string]interface{}); ok {
+			document.version.SchemaVersion, _ = field["default"].(string)
+		}
+	}
+	if err := document.compile(root, "#"); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// compile проверяет, что схема не выходит за поддерживаемое подмножество,
+// заранее компилирует pattern-ы и разрешает все $ref.
+func (d *mechanicsSchemaDocument) compile(raw interface{}, at string) error {
+	if _, ok := raw.(bool); ok {
+		return nil
+	}
+	schema, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: schema must be an object or boolean", at)
+	}
+	for key, value := range schema {
+		if !mechanicsSchemaKeywords[key] && !mechanicsSchemaAnnotations[key] {
+			return fmt.Errorf("%s: unsupported keyword %q", at, key)
+		}
+		switch key {
+		case "$ref":
+			ref, _ := value.(string)
+			if _, err := d.resolve(ref); err != nil {
+				return fmt.Errorf("%s: %v", at, err)
+			}
+		case "pattern":
+			pattern, _ := value.(string)
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: pattern: %v", at, err)
+			}
+			d.patterns[pattern] = compiled
+		case "properties", "$defs":
+			children, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s/%s: must be an object", at, key)
+			}
+			for name, child := range children {
+				if err := d.compile(child, at+"/"+key+"/"+name); err != nil {
+					return err
+				}
+			}
+		case "allOf", "anyOf", "oneOf":
+			branches, ok := value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s/%s: must be an array", at, key)
+			}
+			for i, branch := range branches {
+				if err := d.compile(branch, fmt.Sprintf("%s/%s/%d", at, key, i)); err != nil {
+					return err
+				}
+			}
+		case "additionalProperties", "propertyNames", "items", "contains", "not", "if", "then", "else":
+			if err := d.compile(value, at+"/"+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *mechanicsSchemaDocument) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	current := d.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", ref)
+		}
+		if current, ok = object[token]; !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+type mechanicsSchemaIssue struct {
+	path    string
+	problem string
+}
+
+func (d *mechanicsSchemaDocument) validate(raw interface{}, value interface{}, path string) []mechanicsSchemaIssue {
+	if accept, ok := raw.(bool); ok {
+		if accept {
+			return nil
+		}
+		return []mechanicsSchemaIssue{{path: path, problem: "is not allowed"}}
+	}
+	schema := raw.(map[string]interface{})
+	if ref, ok := schema["$ref"].(string); ok {
+		// draft-07: соседние с $ref ключевые слова игнорируются.
+		target, _ := d.resolve(ref)
+		return d.validate(target, value, path)
+	}
+
+	var issues []mechanicsSchemaIssue
+	if types, ok := schema["type"]; ok && !schemaTypeMatches(types, value) {
+		// При неверном типе остальные проверки дают только шум.
+		return []mechanicsSchemaIssue{{path: path, problem: "must be " + schemaTypeList(types)}}
+	}
+	if expected, ok := schema["const"]; ok && !jsonValuesEqual(expected, value) {
+		issues = append(issues, mechanicsSchemaIssue{
+			path: path, problem: "must be equal to " + schemaLiteral(expected),
+		})
+	}
+	if allowed, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, candidate := range allowed {
+			if jsonValuesEqual(candidate, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			issues = append(issues, mechanicsSchemaIssue{
+				path: path, problem: "must be one of " + schemaLiteralList(allowed),
+			})
+		}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		issues = append(issues, d.validateObject(schema, typed, path)...)
+	case JSONMap:
+		issues = append(issues, d.validateObject(schema, typed, path)...)
+	case []interface{}:
+		issues = append(issues, d.validateArray(schema, typed, path)...)
+	case string:
+		if minimum, ok := mechanicsNumber(schema["minLength"]); ok && float64(utf8.RuneCountInString(typed)) < minimum {
+			issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must NOT have fewer than %v characters", minimum)})
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !d.patterns[pattern].MatchString(typed) {
+			issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must match pattern %q", pattern)})
+		}
+	default:
+		if number, ok := mechanicsNumber(value); ok {
+			issues = append(issues, validateSchemaNumber(schema, number, path)...)
+		}
+	}
+
+	if branches, ok := schema["allOf"].([]interface{}); ok {
+		for _, branch := range branches {
+			issues = append(issues, d.validate(branch, value, path)...)
+		}
+	}
+	if branches, ok := schema["anyOf"].([]interface{}); ok {
+		issues = append(issues, d.validateAlternatives(branches, value, path, false)...)
+	}
+	if branches, ok := schema["oneOf"].([]interface{}); ok {
+		issues = append(issues, d.validateAlternatives(branches, value, path, true)...)
+	}
+	if negated, ok := schema["not"]; ok && len(d.validate(negated, value, path)) == 0 {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: "must NOT be valid against the forbidden schema"})
+	}
+	if condition, ok := schema["if"]; ok {
+		if len(d.validate(condition, value, path)) == 0 {
+			if then, ok := schema["then"]; ok {
+				issues = append(issues, d.validate(then, value, path)...)
+			}
+		} else if otherwise, ok := schema["else"]; ok {
+			issues = append(issues, d.validate(otherwise, value, path)...)
+		}
+	}
+	return issues
+}
+
+func (d *mechanicsSchemaDocument) validateObject(schema map[string]interface{}, object map[string]interface{}, path string) []mechanicsSchemaIssue {
+	var issues []mechanicsSchemaIssue
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, raw := range required {
+			key, _ := raw.(string)
+			if _, exists := object[key]; !exists {
+				issues = append(issues, mechanicsSchemaIssue{path: schemaPropertyPath(path, key), problem: "is required"})
+			}
+		}
+	}
+	if minimum, ok := mechanicsNumber(schema["minProperties"]); ok && float64(len(object)) < minimum {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must NOT have fewer than %v properties", minimum)})
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+	names, hasNames := schema["propertyNames"]
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := schemaPropertyPath(path, key)
+		if hasNames {
+			for _, issue := range d.validate(names, key, childPath) {
+				issue.problem = "property name " + issue.problem
+				issues = append(issues, issue)
+			}
+		}
+		if property, ok := properties[key]; ok {
+			issues = append(issues, d.validate(property, object[key], childPath)...)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if accept, ok := additional.(bool); ok && !accept {
+			issues = append(issues, mechanicsSchemaIssue{path: childPath, problem: "is not a supported property"})
+			continue
+		}
+		issues = append(issues, d.validate(additional, object[key], childPath)...)
+	}
+	return issues
+}
+
+func (d *mechanicsSchemaDocument) validateArray(schema map[string]interface{}, items []interface{}, path string) []mechanicsSchemaIssue {
+	var issues []mechanicsSchemaIssue
+	if minimum, ok := mechanicsNumber(schema["minItems"]); ok && float64(len(items)) < minimum {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must NOT have fewer than %v items", minimum)})
+	}
+	if maximum, ok := mechanicsNumber(schema["maxItems"]); ok && float64(len(items)) > maximum {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must NOT have more than %v items", maximum)})
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+	duplicates:
+		for i := range items {
+			for j := 0; j < i; j++ {
+				if jsonValuesEqual(items[i], items[j]) {
+					issues = append(issues, mechanicsSchemaIssue{
+						path: path, problem: fmt.Sprintf("must NOT have duplicate items (items %d and %d are identical)", j, i),
+					})
+					break duplicates
+				}
+			}
+		}
+	}
+	if item, ok := schema["items"]; ok {
+		for i, value := range items {
+			issues = append(issues, d.validate(item, value, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	if contains, ok := schema["contains"]; ok {
+		found := false
+		for i, value := range items {
+			if len(d.validate(contains, value, fmt.Sprintf("%s[%d]", path, i))) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			issues = append(issues, mechanicsSchemaIssue{path: path, problem: "must contain at least 1 valid item"})
+		}
+	}
+	return issues
+}
+
+func validateSchemaNumber(schema map[string]interface{}, number float64, path string) []mechanicsSchemaIssue {
+	var issues []mechanicsSchemaIssue
+	if minimum, ok := mechanicsNumber(schema["minimum"]); ok && number < minimum {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must be >= %v", minimum)})
+	}
+	if maximum, ok := mechanicsNumber(schema["maximum"]); ok && number > maximum {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must be <= %v", maximum)})
+	}
+	if minimum, ok := mechanicsNumber(schema["exclusiveMinimum"]); ok && number <= minimum {
+		issues = append(issues, mechanicsSchemaIssue{path: path, problem: fmt.Sprintf("must be > %v", minimum)})
+	}
+	return issues
+}
+
+// validateAlternatives разбирает anyOf/oneOf. ajv в этом месте вываливает
+// ошибки всех веток; здесь ветка выбирается по const-дискриминатору (kind,
+// type, resolution…), чтобы ответ указывал на реальную ошибку в механике.
+func (d *mechanicsSchemaDocument) validateAlternatives(branches []interface{}, value interface{}, path string, exactlyOne bool) []mechanicsSchemaIssue {
+	results := make([][]mechanicsSchemaIssue, len(branches))
+	passed := 0
+	for i, branch := range branches {
+		results[i] = d.validate(branch, value, path)
+		if len(results[i]) == 0 {
+			passed++
+		}
+	}
+	if passed > 0 {
+		if exactlyOne && passed > 1 {
+			return []mechanicsSchemaIssue{{path: path, problem: "must match exactly one schema in oneOf"}}
+		}
+		return nil
+	}
+
+	object, isObject := value.(map[string]interface{})
+	if typed, ok := value.(JSONMap); ok {
+		object, isObject = typed, true
+	}
+	if isObject {
+		discriminators := make([]map[string]interface{}, len(branches))
+		for i, branch := range branches {
+			discriminators[i] = d.discriminators(branch)
+		}
+		if key := sharedDiscriminatorKey(discriminators); key != "" {
+			// Общий дискриминатор (kind / type) однозначно выбирает ветку.
+			var candidates []int
+			var allowed []interface{}
+			for i := range branches {
+				allowed = append(allowed, discriminators[i][key])
+				if jsonValuesEqual(discriminators[i][key], object[key]) {
+					candidates = append(candidates, i)
+				}
+			}
+			if len(candidates) > 0 {
+				return results[fewestSchemaIssues(results, candidates)]
+			}
+			keyPath := schemaPropertyPath(path, key)
+			if _, exists := object[key]; !exists {
+				return []mechanicsSchemaIssue{{path: keyPath, problem: "is required"}}
+			}
+			return []mechanicsSchemaIssue{{path: keyPath, problem: "must be one of " + schemaLiteralList(allowed)}}
+		}
+		// Иначе отбрасываются ветки с несовпавшим дискриминатором, а ветки
+		// без дискриминатора остаются кандидатами.
+		var candidates []int
+		for i := range branches {
+			matches := true
+			for key, expected := range discriminators[i] {
+				if !jsonValuesEqual(expected, object[key]) {
+					matches = false
+				}
+			}
+			if matches {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) > 0 && len(candidates) < len(branches) {
+			return results[fewestSchemaIssues(results, candidates)]
+		}
+	}
+
+	all := make([]int, len(branches))
+	for i := range all {
+		all[i] = i
+	}
+	best := results[fewestSchemaIssues(results, all)]
+	for _, issue := range best {
+		if issue.path != path {
+			return best
+		}
+	}
+	return []mechanicsSchemaIssue{{path: path, problem: "must match one of the allowed variants"}}
+}
+
+// discriminators — свойства ветки с единственным допустимым значением.
+func (d *mechanicsSchemaDocument) discriminators(raw interface{}) map[string]interface{} {
+	schema, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		target, _ := d.resolve(ref)
+		return d.discriminators(target)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	result := map[string]interface{}{}
+	for key, property := range properties {
+		field, ok := property.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if expected, ok := field["const"]; ok {
+			result[key] = expected
+		} else if values, ok := field["enum"].([]interface{}); ok && len(values) == 1 {
+			result[key] = values[0]
+		}
+	}
+	return result
+}
+
+// sharedDiscriminatorKey — первый по алфавиту ключ, который фиксирован во
+// всех ветках; пустая строка, если такого нет.
+func sharedDiscriminatorKey(discriminators []map[string]interface{}) string {
+	if len(discriminators) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(discriminators[0]))
+	for key := range discriminators[0] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		shared := true
+		for _, branch := range discriminators[1:] {
+			if _, ok := branch[key]; !ok {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			return key
+		}
+	}
+	return ""
+}
+
+func fewestSchemaIssues(results [][]mechanicsSchemaIssue, candidates []int) int {
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if len(results[candidate]) < len(results[best]) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func schemaPropertyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func schemaTypeMatches(raw interface{}, value interface{}) bool {
+	if types, ok := raw.([]interface{}); ok {
+		for _, candidate := range types {
+			if schemaTypeMatches(candidate, value) {
+				return true
+			}
+		}
+		return false
+	}
+	name, _ := raw.(string)
+	switch name {
+	case "object":
+		switch value.(type) {
+		case map[string]interface{}, JSONMap:
+			return true
+		}
+		return false
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := mechanicsNumber(value)
+		return ok
+	case "integer":
+		number, ok := mechanicsNumber(value)
+		return ok && math.Trunc(number) == number && !math.IsInf(number, 0)
+	}
+	return false
+}
+
+func schemaTypeList(raw interface{}) string {
+	if types, ok := raw.([]interface{}); ok {
+		names := make([]string, 0, len(types))
+		for _, name := range types {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(raw)
+}
+
+func schemaLiteral(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func schemaLiteralList(values []interface{}) string {
+	literals := make([]string, 0, len(values))
+	for _, value := range values {
+		literals = append(literals, schemaLiteral(value))
+	}
+	return strings.Join(literals, ", ")
+}
+
+// jsonValuesEqual сравнивает значения по JSON-семантике: 1 и 1.0 равны,
+// а JSONMap и map[string]interface{} с одинаковым содержимым — тоже.
+func jsonValuesEqual(a, b interface{}) bool {
+	if left, ok := mechanicsNumber(a); ok {
+		right, ok := mechanicsNumber(b)
+		return ok && left == right
+	}
+	if typed, ok := a.(JSONMap); ok {
+		a = map[string]interface{}(typed)
+	}
+	if typed, ok := b.(JSONMap); ok {
+		b = map[string]interface{}(typed)
+	}
+	switch left := a.(type) {
+	case map[string]interface{}:
+		right, ok := b.(map[string]interface{})
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for key, value := range left {
+			other, exists := right[key]
+			if !exists || !jsonValuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		right, ok := b.([]interface{})
+		if !ok || len(left) != len(right) {
+			return false
+		}
+		for i := range left {
+			if !jsonValuesEqual(left[i], right[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// mechanicsSchemaExtensionKeys — поля конструктора, которые переносятся в
+// MechanicCard как есть (normalizeMechanicsForSchema во фронтенде).
+var mechanicsSchemaExtensionKeys = []string{
+	"interaction", "primitive", "weapon_mastery", "attack_replacement", "rest_decision",
+	"condition", "fighting_style", "capabilities", "end_triggers", "includes", "leaves",
+	"stacking", "long_rest", "thresholds", "world_facts", "weapon_profile",
+}
+
+func jsonTruthy(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return typed
+	case string:
+		return typed != ""
+	}
+	if number, ok := mechanicsNumber(value); ok {
+		return number != 0 && !math.IsNaN(number)
+	}
+	return true
+}
+
+// mechanicsSchemaCard приводит сохранённый формат конструктора к MechanicCard
+// так же, как frontend/src/engine/validateMechanics.ts. Второе значение —
+// исходное имя списка взаимодействий (effects или interactions), чтобы пути
+// ошибок указывали на поле, которое прислал клиент.
+func mechanicsSchemaCard(mechanics JSONMap, kind string) (map[string]interface{}, string) {
+	activation := mechanics["activation"]
+	if !jsonTruthy(activation) {
+		activation = map[string]interface{}{"mode": "passive"}
+	}
+	interactionsKey := "interactions"
+	var interactions interface{} = []interface{}{}
+	if jsonTruthy(mechanics["effects"]) {
+		interactionsKey, interactions = "effects", mechanics["effects"]
+	} else if jsonTruthy(mechanics["interactions"]) {
+		interactions = mechanics["interactions"]
+	}
+	card := map[string]interface{}{
+		"schema_version": "1.0",
+		"id":             "draft",
+		"name":           "draft",
+		"kind":           kind,
+		"activation":     activation,
+		"interactions":   interactions,
+	}
+	for _, key := range []string{"uses", "targeting"} {
+		if jsonTruthy(mechanics[key]) {
+			card[key] = mechanics[key]
+		}
+	}
+	for _, key := range mechanicsSchemaExtensionKeys {
+		if value, exists := mechanics[key]; exists {
+			card[key] = value
+		}
+	}
+	return card, interactionsKey
+}
+
+// validateMechanicsSchema проверяет Mechanics JSON сущности. kind —
+// passive_effect | action | spell | trait; пустая механика валидна.
+func validateMechanicsSchema(mechanics JSONMap, kind string) []mechanicsSchemaError {
+	if len(mechanics) == 0 {
+		return nil
+	}
+	card, interactionsKey := mechanicsSchemaCard(mechanics, kind)
+	issues := mechanicsSchema.validate(mechanicsSchema.root, card, "mechanics")
+	if len(issues) == 0 {
+		return nil
+	}
+	if len(issues) > maxMechanicsSchemaErrors {
+		issues = issues[:maxMechanicsSchemaErrors]
+	}
+	problems := make([]mechanicsSchemaError, 0, len(issues))
+	for _, issue := range issues {
+		path := issue.path
+		if path == "mechanics.interactions" || strings.HasPrefix(path, "mechanics.interactions[") {
+			path = "mechanics." + interactionsKey + strings.TrimPrefix(path, "mechanics.interactions")
+		}
+		problems = append(problems, mechanicsSchemaError{Path: path, Problem: issue.problem})
+	}
+	return problems
+}
+
+func writeMechanicsSchemaErrors(c *gin.Context, status int, message string, problems []mechanicsSchemaError) {
+	c.JSON(status, gin.H{"error": message, "details": problems[0].Error(), "errors": problems})
+}
+
+// rejectInvalidMechanics — гвард Create-хендлеров контента.
+func rejectInvalidMechanics(c *gin.Context, mechanics *JSONMap, kind string) bool {
+	if mechanics == nil {
+		return false
+	}
+	problems := validateMechanicsSchema(*mechanics, kind)
+	if len(problems) == 0 {
+		return false
+	}
+	writeMechanicsSchemaErrors(c, http.StatusBadRequest, "Ошибка схемы механики", problems)
+	return true
+}
+
+// rejectInvalidMechanicsUpdate проверяет только реально изменённую механику:
+// как и rejectLockedMechanicsMutation, правка описания legacy-сущности не
+// должна упираться в механику, которую никто не трогал.
+func rejectInvalidMechanicsUpdate(c *gin.Context, current *JSONMap, requested *JSONMap, kind string) bool {
+	if requested == nil || reflect.DeepEqual(normalizedMechanics(current), normalizedMechanics(requested)) {
+		return false
+	}
+	return rejectInvalidMechanics(c, requested, kind)
+}
+
+// GetMechanicsSchemaVersion — GET /api/mechanics/schema
+func GetMechanicsSchemaVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, mechanicsSchema.version)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func mustMechanicsJSON(t *testing.T, source string) JSONMap {
+	t.Helper()
+	var mechanics JSONMap
+	if err := json.Unmarshal([]byte(source), &mechanics); err != nil {
+		t.Fatalf("%s: %v", source, err)
+	}
+	return mechanics
+}
+
+func TestMechanicsSchemaCopiesMatch(t *testing.T) {
+	for _, path := range []string{"../docs/mechanics.schema.json", "../frontend/src/schemas/mechanics.schema.json"} {
+		source, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(source, mechanicsSchemaSource) {
+			t.Fatalf("backend/schemas/mechanics.schema.json drifted from %s: run node scripts/sync-mechanics-schema.mjs", path)
+		}
+	}
+	if mechanicsSchema.version.SchemaVersion != "1.0" || len(mechanicsSchema.version.SHA256) != 64 {
+		t.Fatalf("unexpected schema version: %+v", mechanicsSchema.version)
+	}
+}
+
+func TestValidateMechanicsSchema(t *testing.T) {
+	valid := []string{
+		`{}`,
+		`{"activation":{"mode":"passive"},"effects":[{"resolution":"auto","result":[{"kind":"grant_proficiency","prof":"skill","value":"perception"}]}]}`,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"damage","dice":"1d6","type":"force"}]}]}`,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"damage","amount":"spellcasting+1","type":"force"}]}]}`,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"condition","value":"poisoned","save_ends":{"ability":"con","dc":"8+prof_bonus","timing":"end_of_turn"}}]}]}`,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"sap","consume":"next","expires":"start_of_source_next_turn"}}`,
+		`{"activation":{"mode":"passive"},"effects":[],"stacking":{"mode":"levels","max":6},"long_rest":{"remove_levels":1},"thresholds":[{"at_level":6,"outcome":"death"}]}`,
+		`{"activation":{"mode":"active"},"interaction":{"intent":"harmful"},"effects":[]}`,
+		`{"activation":{"mode":"active"},"effects":[],"uses":{"count":2,"per":"short_rest","recovery":{"short_rest":{"mode":"fixed","amount":1},"long_rest":{"mode":"full"}}}}`,
+		// Неизвестные поля верхнего уровня отбрасываются, как во фронтенде.
+		`{"activation":{"mode":"passive"},"effects":[],"editor_state":{"open":true}}`,
+	}
+	for _, source := range valid {
+		if problems := validateMechanicsSchema(mustMechanicsJSON(t, source), "action"); len(problems) != 0 {
+			t.Fatalf("%s must be valid, got %v", source, problems)
+		}
+	}
+	invalid := []string{
+		`{"activation":{"mode":"not_a_mode"},"effects":[]}`,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"damage","dice":"1d6"}]}]}`,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"damage","type":"force"}]}]}`,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"condition","value":"poisoned","save_ends":{"ability":"auto","dc":"10"}}]}]}`,
+		`{"activation":{"mode":"active"},"effects":[],"primitive":{"type":"unknown_rule"}}`,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"nick","saveAbility":"con"}}`,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"slow","penaltyFt":0,"requiresDamage":true,"expires":"start_of_source_next_turn","choiceId":"weapon_mastery.slow.use"}}`,
+		`{"activation":{"mode":"passive"},"effects":[],"stacking":{"mode":"levels","max":6,"entitySpecificRule":true}}`,
+		`{"activation":{"mode":"active"},"interaction":{"intent":"friendly"},"effects":[]}`,
+		`{"activation":{"mode":"active"},"effects":[],"uses":{"count":2,"recovery":{"short_rest":{"mode":"fixed","amount":0},"long_rest":{"mode":"full"}}}}`,
+		`{"activation":{"mode":"passive"},"effects":[],"condition":{"id":"Blinded"}}`,
+	}
+	for _, source := range invalid {
+		if problems := validateMechanicsSchema(mustMechanicsJSON(t, source), "action"); len(problems) == 0 {
+			t.Fatalf("%s must be rejected", source)
+		}
+	}
+}
+
+func TestMechanicsSchemaErrorPaths(t *testing.T) {
+	problems := validateMechanicsSchema(mustMechanicsJSON(t,
+		`{"activation":{"mode":"active"},"effects":[{"resolution":"auto","result":[{"kind":"damage","dice":"1d6","type":"fire","on_success":"quarter"}]}]}`,
+	), "action")
+	if len(problems) != 1 || problems[0].Path != "mechanics.effects[0].result[0].on_success" {
+		t.Fatalf("error must point into the client field, got %v", problems)
+	}
+	discriminated := validateMechanicsSchema(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"wobble"}}`,
+	), "passive_effect")
+	if len(discriminated) != 1 || discriminated[0].Path != "mechanics.weapon_mastery.type" {
+		t.Fatalf("unknown discriminator must be reported once, got %v", discriminated)
+	}
+	branch := validateMechanicsSchema(mustMechanicsJSON(t,
+		`{"activation":{"mode":"passive"},"effects":[],"weapon_mastery":{"type":"sap","consume":"next"}}`,
+	), "passive_effect")
+	if len(branch) != 1 || branch[0].Error() != "mechanics.weapon_mastery.expires: is required" {
+		t.Fatalf("matching oneOf branch must be reported, got %v", branch)
+	}
+}
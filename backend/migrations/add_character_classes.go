@@ -0,0 +1,111 @@
+package migrations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// classMulticlassSeed — требования и ограниченные владения мультикласса
+// канонического класса (PHB 2024). Any — достаточно одной из характеристик.
+type classMulticlassSeed struct {
+	Abilities []string
+	Any       bool
+	Armor     []string
+	Weapons   []string
+	Tools     []string
+	Skills    int
+}
+
+// classMulticlassSeeds — канонические классы по card_number.
+var classMulticlassSeeds = map[string]classMulticlassSeed{
+	"CLASS-barbarian": {Abilities: []string{"str"}, Armor: []string{"shields"}, Weapons: []string{"martial"}},
+	"CLASS-bard":      {Abilities: []string{"cha"}, Armor: []string{"light"}, Tools: []string{"musical_instrument"}, Skills: 1},
+	"CLASS-cleric":    {Abilities: []string{"wis"}, Armor: []string{"light", "medium", "shields"}},
+	"CLASS-druid":     {Abilities: []string{"wis"}, Armor: []string{"light", "shields"}},
+	"CLASS-monk":      {Abilities: []string{"dex", "wis"}},
+	"CLASS-paladin":   {Abilities: []string{"str", "cha"}, Armor: []string{"light", "medium", "shields"}, Weapons: []string{"martial"}},
+	"CLASS-ranger":    {Abilities: []string{"dex", "wis"}, Armor: []string{"light", "medium", "shields"}, Weapons: []string{"martial"}, Skills: 1},
+	"CLASS-rogue":     {Abilities: []string{"dex"}, Armor: []string{"light"}, Tools: []string{"thieves_tools"}, Skills: 1},
+	"CLASS-sorcerer":  {Abilities: []string{"cha"}},
+	"CLASS-warlock":   {Abilities: []string{"cha"}, Armor: []string{"light"}},
+	"CLASS-warrior":   {Abilities: []string{"str", "dex"}, Any: true, Armor: []string{"light", "medium", "shields"}, Weapons: []string{"martial"}},
+	"CLASS-wizard":    {Abilities: []string{"int"}},
+}
+
+func (s classMulticlassSeed) document() ([]byte, error) {
+	mode := "all"
+	if s.Any {
+		mode = "any"
+	}
+	proficiencies := map[string]interface{}{}
+	for key, values := range map[string][]string{"armor": s.Armor, "weapons": s.Weapons, "tools": s.Tools} {
+		if len(values) > 0 {
+			proficiencies[key] = values
+		}
+	}
+	if s.Skills > 0 {
+		proficiencies["skills"] = s.Skills
+	}
+	return json.Marshal(map[string]interface{}{
+		"prerequisites": map[string]interface{}{mode: s.Abilities, "min_score": 13},
+		"proficiencies": proficiencies,
+	})
+}
+
+// addCharacterClasses переводит персонажей v3 на список классов:
+// characters_v3.classes = [{class_id, subclass_id, level}], куда переносится
+// прежний единственный класс с подклассом из выбора builder:subclass, и
+// добавляет классам правила мультикласса classes.multiclass с каноническими
+// значениями. Уже заданные списки и декларации не перезаписываются.
+func addCharacterClasses(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE characters_v3 ADD COLUMN IF NOT EXISTS classes JSONB"); err != nil {
+		return fmt.Errorf("add characters_v3.classes: %w", err)
+	}
+	if _, err := db.Exec(`
+		UPDATE characters_v3
+		SET classes = jsonb_build_array(jsonb_strip_nulls(jsonb_build_object(
+			'class_id', class_id,
+			'subclass_id', CASE
+				WHEN resolved_choices->'builder:subclass'->>0 ~* '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$'
+				THEN resolved_choices->'builder:subclass'->>0
+			END,
+			'level', GREATEST(level, 1)
+		)))
+		WHERE class_id IS NOT NULL
+		  AND classes IS NULL
+	`); err != nil {
+		return fmt.Errorf("convert characters_v3 classes: %w", err)
+	}
+
+	if _, err := db.Exec("ALTER TABLE classes ADD COLUMN IF NOT EXISTS multiclass JSONB"); err != nil {
+		return fmt.Errorf("add classes.multiclass: %w", err)
+	}
+	for cardNumber, seed := range classMulticlassSeeds {
+		document, err := seed.document()
+		if err != nil {
+			return fmt.Errorf("encode multiclass for %s: %w", cardNumber, err)
+		}
+		if _, err := db.Exec(`
+			UPDATE classes
+			SET multiclass = $1::jsonb,
+				updated_at = NOW()
+			WHERE card_number = $2
+			  AND multiclass IS NULL
+			  AND deleted_at IS NULL
+		`, string(document), cardNumber); err != nil {
+			return fmt.Errorf("seed multiclass for %s: %w", cardNumber, err)
+		}
+	}
+	return nil
+}
+
+func removeCharacterClasses(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE classes DROP COLUMN IF EXISTS multiclass"); err != nil {
+		return fmt.Errorf("drop classes.multiclass: %w", err)
+	}
+	if _, err := db.Exec("ALTER TABLE characters_v3 DROP COLUMN IF EXISTS classes"); err != nil {
+		return fmt.Errorf("drop characters_v3.classes: %w", err)
+	}
+	return nil
+}
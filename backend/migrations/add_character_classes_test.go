@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddCharacterClassesFollowsClassSpellcasting(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "114_add_character_classes" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("114 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("114_add_character_classes is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "113_add_class_spellcasting" {
+		t.Fatalf("migration before 114 = %q, want 113", previous)
+	}
+}
+
+func TestClassMulticlassSeedDocuments(t *testing.T) {
+	raw, err := classMulticlassSeeds["CLASS-warrior"].document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fighter map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &fighter); err != nil {
+		t.Fatal(err)
+	}
+	if either := fighter["prerequisites"]["any"].([]interface{}); len(either) != 2 || fighter["prerequisites"]["min_score"] != float64(13) {
+		t.Fatalf("fighter needs STR or DEX 13: %v", fighter)
+	}
+	if _, hasSkills := fighter["proficiencies"]["skills"]; hasSkills || len(fighter["proficiencies"]["weapons"].([]interface{})) != 1 {
+		t.Fatalf("unexpected fighter proficiencies: %v", fighter)
+	}
+
+	raw, err = classMulticlassSeeds["CLASS-monk"].document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var monk map[string]map[string]interface{}
+	if err := json.Unmarshal(raw, &monk); err != nil {
+		t.Fatal(err)
+	}
+	if all := monk["prerequisites"]["all"].([]interface{}); len(all) != 2 || len(monk["proficiencies"]) != 0 {
+		t.Fatalf("monk needs DEX and WIS 13 and grants nothing: %v", monk)
+	}
+}
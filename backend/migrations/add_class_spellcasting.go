@@ -0,0 +1,121 @@
+package migrations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// classSpellcastingSeed — декларация заклинательства канонического класса.
+// Prepared/Cantrips — пределы по уровням класса 1–20 (0 — ещё нет).
+type classSpellcastingSeed struct {
+	Progression string
+	Ability     string
+	FromLevel   int
+	Prepared    [20]int
+	Cantrips    [20]int
+}
+
+var (
+	fullCasterPrepared = [20]int{4, 5, 6, 7, 9, 10, 11, 12, 14, 15, 16, 16, 17, 17, 18, 18, 19, 20, 21, 22}
+	halfCasterPrepared = [20]int{2, 3, 4, 5, 6, 6, 7, 7, 9, 9, 10, 10, 11, 11, 12, 12, 14, 14, 15, 15}
+	// Мистический рыцарь и Мистический ловкач: уровни 1–2 класса ещё не колдуют.
+	thirdCasterPrepared = [20]int{0, 0, 3, 4, 4, 4, 5, 6, 6, 7, 8, 8, 9, 10, 10, 11, 11, 11, 12, 13}
+)
+
+// cantripProgression — заговоры: base с уровня from, +1 на каждом из increases.
+func cantripProgression(base, from int, increases ...int) [20]int {
+	var result [20]int
+	for level := from; level <= 20; level++ {
+		value := base
+		for _, at := range increases {
+			if level >= at {
+				value++
+			}
+		}
+		result[level-1] = value
+	}
+	return result
+}
+
+// classSpellcastingSeeds — канонические классы и подклассы PHB 2024 по card_number.
+var classSpellcastingSeeds = map[string]classSpellcastingSeed{
+	"CLASS-bard":   {Progression: "full", Ability: "cha", Prepared: fullCasterPrepared, Cantrips: cantripProgression(2, 1, 4, 10)},
+	"CLASS-cleric": {Progression: "full", Ability: "wis", Prepared: fullCasterPrepared, Cantrips: cantripProgression(3, 1, 4, 10)},
+	"CLASS-druid":  {Progression: "full", Ability: "wis", Prepared: fullCasterPrepared, Cantrips: cantripProgression(2, 1, 4, 10)},
+	"CLASS-sorcerer": {Progression: "full", Ability: "cha", Cantrips: cantripProgression(4, 1, 4, 10),
+		Prepared: [20]int{2, 4, 6, 7, 9, 10, 11, 12, 14, 15, 16, 16, 17, 17, 18, 18, 19, 20, 21, 22}},
+	"CLASS-wizard": {Progression: "full", Ability: "int", Cantrips: cantripProgression(3, 1, 4, 10),
+		Prepared: [20]int{4, 5, 6, 7, 9, 10, 11, 12, 14, 15, 16, 16, 17, 18, 19, 21, 22, 23, 24, 25}},
+	"CLASS-paladin": {Progression: "half", Ability: "cha", Prepared: halfCasterPrepared},
+	"CLASS-ranger":  {Progression: "half", Ability: "wis", Prepared: halfCasterPrepared},
+	"CLASS-warlock": {Progression: "pact", Ability: "cha", Cantrips: cantripProgression(2, 1, 4, 10),
+		Prepared: [20]int{2, 3, 4, 5, 6, 7, 8, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14, 15, 15}},
+	"fighter_eldritch_knight": {Progression: "third", Ability: "int", FromLevel: 3, Prepared: thirdCasterPrepared, Cantrips: cantripProgression(2, 3, 10)},
+	"rogue_arcane_trickster":  {Progression: "third", Ability: "int", FromLevel: 3, Prepared: thirdCasterPrepared, Cantrips: cantripProgression(3, 3, 10)},
+}
+
+// spellcastingByLevel сворачивает пределы по уровням в ступени
+// {"<уровень>": n}: только уровни, на которых значение меняется.
+func spellcastingByLevel(values [20]int) map[string]int {
+	steps := map[string]int{}
+	previous := 0
+	for index, value := range values {
+		if value != previous {
+			steps[strconv.Itoa(index+1)] = value
+			previous = value
+		}
+	}
+	return steps
+}
+
+func (s classSpellcastingSeed) document() ([]byte, error) {
+	document := map[string]interface{}{
+		"progression": s.Progression,
+		"ability":     s.Ability,
+		"preparation": "prepared",
+		"prepared":    spellcastingByLevel(s.Prepared),
+	}
+	if s.FromLevel > 1 {
+		document["from_level"] = s.FromLevel
+	}
+	if cantrips := spellcastingByLevel(s.Cantrips); len(cantrips) > 0 {
+		document["cantrips"] = cantrips
+	}
+	return json.Marshal(document)
+}
+
+// addClassSpellcasting добавляет classes.spellcasting — прогрессию ячеек
+// класса (full/half/third/pact), заклинательную характеристику и пределы
+// подготовки — и заполняет её каноническим классам. Уже заданные
+// декларации не перезаписываются.
+func addClassSpellcasting(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE classes ADD COLUMN IF NOT EXISTS spellcasting JSONB"); err != nil {
+		return fmt.Errorf("add classes.spellcasting: %w", err)
+	}
+	for cardNumber, seed := range classSpellcastingSeeds {
+		document, err := seed.document()
+		if err != nil {
+			return fmt.Errorf("encode spellcasting for %s: %w", cardNumber, err)
+		}
+		if _, err := db.Exec(`
+			UPDATE classes
+			SET spellcasting = $1::jsonb,
+				updated_at = NOW()
+			WHERE card_number = $2
+			  AND spellcasting IS NULL
+			  AND deleted_at IS NULL
+		`, string(document), cardNumber); err != nil {
+			return fmt.Errorf("seed spellcasting for %s: %w", cardNumber, err)
+		}
+	}
+	return nil
+}
+
+func removeClassSpellcasting(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE classes DROP COLUMN IF EXISTS spellcasting"); err != nil {
+		return fmt.Errorf("drop classes.spellcasting: %w", err)
+	}
+	return nil
+}
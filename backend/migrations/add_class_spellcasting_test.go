@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddClassSpellcastingFollowsLineageSource(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "113_add_class_spellcasting" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("113 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("113_add_class_spellcasting is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "112_inherit_lineage_source" {
+		t.Fatalf("migration before 113 = %q, want 112", previous)
+	}
+}
+
+func TestClassSpellcastingSeedDocuments(t *testing.T) {
+	raw, err := classSpellcastingSeeds["fighter_eldritch_knight"].document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var knight map[string]interface{}
+	if err := json.Unmarshal(raw, &knight); err != nil {
+		t.Fatal(err)
+	}
+	prepared := knight["prepared"].(map[string]interface{})
+	cantrips := knight["cantrips"].(map[string]interface{})
+	if knight["progression"] != "third" || knight["from_level"] != float64(3) || prepared["3"] != float64(3) || prepared["1"] != nil {
+		t.Fatalf("third caster must start at class level 3: %v", knight)
+	}
+	if len(cantrips) != 2 || cantrips["3"] != float64(2) || cantrips["10"] != float64(3) {
+		t.Fatalf("unexpected cantrip steps: %v", cantrips)
+	}
+
+	raw, err = classSpellcastingSeeds["CLASS-wizard"].document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wizard map[string]interface{}
+	if err := json.Unmarshal(raw, &wizard); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := wizard["from_level"]; exists {
+		t.Fatal("full casters start at level 1 without from_level")
+	}
+	if steps := wizard["cantrips"].(map[string]interface{}); steps["1"] != float64(3) || steps["4"] != float64(4) || steps["10"] != float64(5) {
+		t.Fatalf("unexpected wizard cantrips: %v", steps)
+	}
+	for cardNumber, seed := range classSpellcastingSeeds {
+		for level := 1; level < 20; level++ {
+			if seed.Prepared[level] < seed.Prepared[level-1] {
+				t.Fatalf("%s: prepared spells must not shrink at level %d", cardNumber, level+1)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// encounterConclusionDDL — завершение боя (время и итог: опыт и добыча) и
+// накопленный опыт персонажей v3.
+const encounterConclusionDDL = `
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS concluded_at TIMESTAMPTZ;
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS conclusion JSONB;
+ALTER TABLE characters_v3 ADD COLUMN IF NOT EXISTS experience_points INTEGER NOT NULL DEFAULT 0;
+`
+
+const encounterConclusionDownDDL = `
+ALTER TABLE characters_v3 DROP COLUMN IF EXISTS experience_points;
+ALTER TABLE encounters DROP COLUMN IF EXISTS conclusion;
+ALTER TABLE encounters DROP COLUMN IF EXISTS concluded_at;
+`
+
+func addEncounterConclusion(db *sql.DB) error {
+	if _, err := db.Exec(encounterConclusionDDL); err != nil {
+		return fmt.Errorf("add encounter conclusion and character experience: %w", err)
+	}
+	return nil
+}
+
+func removeEncounterConclusion(db *sql.DB) error {
+	if _, err := db.Exec(encounterConclusionDownDDL); err != nil {
+		return fmt.Errorf("drop encounter conclusion and character experience: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddEncounterConclusionFollowsEncounterTemplates(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "119_add_encounter_conclusion" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("119 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("119_add_encounter_conclusion is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "118_create_encounter_templates" {
+		t.Fatalf("migration before 119 = %q, want 118", previous)
+	}
+}
+
+func TestEncounterConclusionDDLAddsColumns(t *testing.T) {
+	ddl := normalizeDDL(encounterConclusionDDL)
+	for label, fragment := range map[string]string{
+		"concluded at":      "alter table encounters add column if not exists concluded_at timestamptz;",
+		"conclusion":        "alter table encounters add column if not exists conclusion jsonb;",
+		"experience points": "alter table characters_v3 add column if not exists experience_points integer not null default 0;",
+	} {
+		if !strings.Contains(ddl, fragment) {
+			t.Errorf("missing %s: %s", label, fragment)
+		}
+	}
+	for _, forbidden := range []string{"drop table", "drop column", "truncate table", "delete from", "update characters_v3", "update encounters"} {
+		if strings.Contains(ddl, forbidden) {
+			t.Errorf("encounter conclusion migration contains destructive DDL %q", forbidden)
+		}
+	}
+
+	down := normalizeDDL(encounterConclusionDownDDL)
+	for _, fragment := range []string{
+		"alter table characters_v3 drop column if exists experience_points",
+		"alter table encounters drop column if exists conclusion",
+		"alter table encounters drop column if exists concluded_at",
+	} {
+		if !strings.Contains(down, fragment) {
+			t.Errorf("down migration missing %s", fragment)
+		}
+	}
+	if strings.Contains(down, "drop table") {
+		t.Error("down migration must not drop tables")
+	}
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// addGroupVariantEncumbrance — правило группы: считать нагрузку по
+// вариантным правилам (5×Сила — нагружен, 10×Сила — сильно нагружен).
+// По умолчанию выключено, как и в PHB.
+func addGroupVariantEncumbrance(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE groups ADD COLUMN IF NOT EXISTS variant_encumbrance BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		return fmt.Errorf("add groups.variant_encumbrance: %w", err)
+	}
+	return nil
+}
+
+func removeGroupVariantEncumbrance(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE groups DROP COLUMN IF EXISTS variant_encumbrance"); err != nil {
+		return fmt.Errorf("drop groups.variant_encumbrance: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package migrations
+
+import "testing"
+
+func TestAddGroupVariantEncumbranceFollowsCharacterClasses(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "115_add_group_variant_encumbrance" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("115 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("115_add_group_variant_encumbrance is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "114_add_character_classes" {
+		t.Fatalf("migration before 115 = %q, want 114", previous)
+	}
+}
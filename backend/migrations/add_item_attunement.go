@@ -0,0 +1,155 @@
+package migrations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// itemAttunementLimit — прежний клиент не давал настроиться больше чем на 3.
+const itemAttunementLimit = 3
+
+type itemAttunementRow struct {
+	CardID      string `json:"card_id"`
+	Qty         int    `json:"qty"`
+	ContainerID string `json:"container_id,omitempty"`
+	Attuned     bool   `json:"attuned,omitempty"`
+}
+
+// attunedInventory переносит список turn_state.attuned_ids в строки
+// инвентаря: флаг attuned на первой строке предмета (верхний уровень важнее
+// контейнера), надетый предмет без строки получает строку-привязку с qty 0,
+// пропавшие предметы и всё сверх лимита отбрасываются.
+func attunedInventory(equipment map[string]interface{}, rows []itemAttunementRow, attuned []string) []itemAttunementRow {
+	equipped := map[string]bool{}
+	slots := make([]string, 0, len(equipment))
+	for slot := range equipment {
+		slots = append(slots, slot)
+	}
+	sort.Strings(slots)
+	for _, slot := range slots {
+		if id, ok := equipment[slot].(string); ok && id != "" {
+			equipped[id] = true
+		}
+	}
+	seen := map[string]bool{}
+	count := 0
+	for _, id := range attuned {
+		if seen[id] || count >= itemAttunementLimit {
+			continue
+		}
+		seen[id] = true
+		index := -1
+		for candidate, row := range rows {
+			if row.CardID == id && row.Qty > 0 && (index < 0 || (row.ContainerID == "" && rows[index].ContainerID != "")) {
+				index = candidate
+			}
+		}
+		switch {
+		case index >= 0:
+			rows[index].Attuned = true
+		case equipped[id]:
+			rows = append(rows, itemAttunementRow{CardID: id, Qty: 0, Attuned: true})
+		default:
+			continue
+		}
+		count++
+	}
+	return rows
+}
+
+// addItemAttunement — настройка на предметы переезжает из
+// turn_state.attuned_ids в флаг attuned строк inventory_items (им управляет
+// только сервер), карточки получают структурированные требования настройки
+// cards.attunement_requirements.
+func addItemAttunement(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE cards ADD COLUMN IF NOT EXISTS attunement_requirements JSONB"); err != nil {
+		return fmt.Errorf("add cards.attunement_requirements: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT id, COALESCE(equipment, '{}'::jsonb), COALESCE(inventory_items, '[]'::jsonb), turn_state->'attuned_ids'
+		FROM characters_v3
+		WHERE turn_state ? 'attuned_ids'
+	`)
+	if err != nil {
+		return fmt.Errorf("select attuned characters: %w", err)
+	}
+	type pending struct {
+		id        string
+		inventory []byte
+	}
+	var updates []pending
+	for rows.Next() {
+		var id string
+		var rawEquipment, rawInventory, rawAttuned []byte
+		if err := rows.Scan(&id, &rawEquipment, &rawInventory, &rawAttuned); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan attuned character: %w", err)
+		}
+		var equipment map[string]interface{}
+		var inventory []itemAttunementRow
+		var attuned []interface{}
+		if json.Unmarshal(rawEquipment, &equipment) != nil || json.Unmarshal(rawInventory, &inventory) != nil {
+			continue
+		}
+		_ = json.Unmarshal(rawAttuned, &attuned)
+		var ids []string
+		for _, item := range attuned {
+			if value, ok := item.(string); ok && value != "" {
+				ids = append(ids, value)
+			}
+		}
+		encoded, err := json.Marshal(attunedInventory(equipment, inventory, ids))
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("encode inventory for %s: %w", id, err)
+		}
+		updates = append(updates, pending{id: id, inventory: encoded})
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("read attuned characters: %w", err)
+	}
+	rows.Close()
+
+	for _, update := range updates {
+		if _, err := db.Exec(`
+			UPDATE characters_v3
+			SET inventory_items = $1::jsonb,
+				turn_state = turn_state - 'attuned_ids'
+			WHERE id = $2
+		`, string(update.inventory), update.id); err != nil {
+			return fmt.Errorf("move attunement for %s: %w", update.id, err)
+		}
+	}
+	return nil
+}
+
+// removeItemAttunement возвращает настройку в turn_state.attuned_ids.
+func removeItemAttunement(db *sql.DB) error {
+	if _, err := db.Exec(`
+		UPDATE characters_v3
+		SET turn_state = COALESCE(turn_state, '{}'::jsonb) || jsonb_build_object('attuned_ids', (
+				SELECT COALESCE(jsonb_agg(DISTINCT item->>'card_id'), '[]'::jsonb)
+				FROM jsonb_array_elements(inventory_items) AS item
+				WHERE (item->>'attuned')::boolean
+			)),
+			inventory_items = (
+				SELECT COALESCE(jsonb_agg(item - 'attuned'), '[]'::jsonb)
+				FROM jsonb_array_elements(inventory_items) AS item
+				WHERE (item->>'qty')::int > 0
+			)
+		WHERE jsonb_typeof(inventory_items) = 'array'
+		  AND EXISTS (
+			SELECT 1 FROM jsonb_array_elements(inventory_items) AS item WHERE item ? 'attuned'
+		  )
+	`); err != nil {
+		return fmt.Errorf("restore turn_state.attuned_ids: %w", err)
+	}
+	if _, err := db.Exec("ALTER TABLE cards DROP COLUMN IF EXISTS attunement_requirements"); err != nil {
+		return fmt.Errorf("drop cards.attunement_requirements: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import "testing"
+
+func TestAddItemAttunementFollowsGroupVariantEncumbrance(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "116_add_item_attunement" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("116 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("116_add_item_attunement is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "115_add_group_variant_encumbrance" {
+		t.Fatalf("migration before 116 = %q, want 115", previous)
+	}
+}
+
+func TestAttunedInventory(t *testing.T) {
+	equipment := map[string]interface{}{"ring_1": "ring", "main_hand": "staff"}
+	rows := []itemAttunementRow{
+		{CardID: "cloak", Qty: 1, ContainerID: "bag"},
+		{CardID: "cloak", Qty: 1},
+		{CardID: "bag", Qty: 1},
+		{CardID: "amulet", Qty: 1},
+	}
+	result := attunedInventory(equipment, rows, []string{"cloak", "ring", "lost", "cloak", "staff", "amulet"})
+	if result[0].Attuned || !result[1].Attuned {
+		t.Fatalf("attunement goes to the top-level row: %+v", result)
+	}
+	if len(result) != 6 || result[4] != (itemAttunementRow{CardID: "ring", Attuned: true}) || result[5].CardID != "staff" {
+		t.Fatalf("equipped items get bond rows: %+v", result)
+	}
+	if result[3].Attuned {
+		t.Fatalf("items beyond the limit stay unattuned: %+v", result)
+	}
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// monsterTagsAndHitDiceDDL — метки каталога монстров для подбора столкновений
+// и кость хитов статблока («7d6+7») для бросаемых хитов экземпляров.
+const monsterTagsAndHitDiceDDL = `
+ALTER TABLE monsters ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE monsters ADD COLUMN IF NOT EXISTS hit_dice VARCHAR(50) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_monsters_tags ON monsters USING gin(tags);
+`
+
+const monsterTagsAndHitDiceDownDDL = `
+DROP INDEX IF EXISTS idx_monsters_tags;
+ALTER TABLE monsters DROP COLUMN IF EXISTS hit_dice;
+ALTER TABLE monsters DROP COLUMN IF EXISTS tags;
+`
+
+func addMonsterTagsAndHitDice(db *sql.DB) error {
+	if _, err := db.Exec(monsterTagsAndHitDiceDDL); err != nil {
+		return fmt.Errorf("add monsters.tags and monsters.hit_dice: %w", err)
+	}
+	return nil
+}
+
+func removeMonsterTagsAndHitDice(db *sql.DB) error {
+	if _, err := db.Exec(monsterTagsAndHitDiceDownDDL); err != nil {
+		return fmt.Errorf("drop monsters.tags and monsters.hit_dice: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddMonsterTagsAndHitDiceFollowsItemAttunement(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "117_add_monster_tags_and_hit_dice" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("117 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("117_add_monster_tags_and_hit_dice is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "116_add_item_attunement" {
+		t.Fatalf("migration before 117 = %q, want 116", previous)
+	}
+}
+
+func TestMonsterTagsAndHitDiceDDLIsAdditive(t *testing.T) {
+	ddl := normalizeDDL(monsterTagsAndHitDiceDDL)
+	for label, fragment := range map[string]string{
+		"tags column":     "alter table monsters add column if not exists tags jsonb not null default '[]'::jsonb",
+		"hit dice column": "alter table monsters add column if not exists hit_dice varchar(50) not null default ''",
+		"tags gin index":  "create index if not exists idx_monsters_tags on monsters using gin(tags)",
+	} {
+		if !strings.Contains(ddl, fragment) {
+			t.Errorf("missing %s: %s", label, fragment)
+		}
+	}
+	for _, forbidden := range []string{"drop table", "drop column", "truncate table", "delete from", "update monsters"} {
+		if strings.Contains(ddl, forbidden) {
+			t.Errorf("monster tags migration contains destructive DDL %q", forbidden)
+		}
+	}
+
+	down := normalizeDDL(monsterTagsAndHitDiceDownDDL)
+	for _, fragment := range []string{
+		"drop index if exists idx_monsters_tags",
+		"alter table monsters drop column if exists hit_dice",
+		"alter table monsters drop column if exists tags",
+	} {
+		if !strings.Contains(down, fragment) {
+			t.Errorf("down migration missing %s", fragment)
+		}
+	}
+	if strings.Contains(down, "drop table") {
+		t.Error("down migration must not drop the monsters table")
+	}
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// encounterTemplatesDDL — заготовки столкновений мастера: именованные группы
+// существ и заметки, из которых создаётся живой бой (см. models_encounter.go).
+const encounterTemplatesDDL = `
+CREATE TABLE IF NOT EXISTS encounter_templates (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name VARCHAR(255) NOT NULL,
+	owner_user_id UUID NOT NULL,
+	group_id UUID REFERENCES groups(id) ON DELETE SET NULL,
+	notes TEXT NOT NULL DEFAULT '',
+	monster_groups JSONB NOT NULL DEFAULT '[]'::jsonb,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_encounter_templates_owner ON encounter_templates(owner_user_id);
+CREATE INDEX IF NOT EXISTS idx_encounter_templates_group ON encounter_templates(group_id);
+`
+
+func createEncounterTemplates(db *sql.DB) error {
+	if _, err := db.Exec(encounterTemplatesDDL); err != nil {
+		return fmt.Errorf("create encounter_templates: %w", err)
+	}
+	return nil
+}
+
+func dropEncounterTemplates(db *sql.DB) error {
+	if _, err := db.Exec(`DROP TABLE IF EXISTS encounter_templates`); err != nil {
+		return fmt.Errorf("drop encounter_templates: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateEncounterTemplatesFollowsMonsterTags(t *testing.T) {
+	migrations := GetAllMigrations()
+	index := -1
+	for candidate, migration := range migrations {
+		if migration.Version == "118_create_encounter_templates" {
+			index = candidate
+			if migration.Up == nil || migration.Down == nil {
+				t.Fatal("118 must register Up and Down")
+			}
+		}
+	}
+	if index < 1 {
+		t.Fatal("118_create_encounter_templates is not registered")
+	}
+	if previous := migrations[index-1].Version; previous != "117_add_monster_tags_and_hit_dice" {
+		t.Fatalf("migration before 118 = %q, want 117", previous)
+	}
+}
+
+func TestEncounterTemplatesDDLCreatesOwnedTemplateTable(t *testing.T) {
+	ddl := normalizeDDL(encounterTemplatesDDL)
+	for label, fragment := range map[string]string{
+		"table":          "create table if not exists encounter_templates (",
+		"primary key":    "id uuid primary key default gen_random_uuid()",
+		"name":           "name varchar(255) not null",
+		"owner":          "owner_user_id uuid not null",
+		"group link":     "group_id uuid references groups(id) on delete set null",
+		"notes":          "notes text not null default ''",
+		"monster groups": "monster_groups jsonb not null default '[]'::jsonb",
+		"created at":     "created_at timestamp with time zone default current_timestamp",
+		"updated at":     "updated_at timestamp with time zone default current_timestamp",
+		"owner index":    "create index if not exists idx_encounter_templates_owner on encounter_templates(owner_user_id)",
+		"group index":    "create index if not exists idx_encounter_templates_group on encounter_templates(group_id)",
+	} {
+		if !strings.Contains(ddl, fragment) {
+			t.Errorf("missing %s: %s", label, fragment)
+		}
+	}
+	for _, forbidden := range []string{"drop table", "drop column", "truncate table", "delete from", "on delete cascade", "alter table encounters"} {
+		if strings.Contains(ddl, forbidden) {
+			t.Errorf("encounter templates migration contains %q", forbidden)
+		}
+	}
+}
@@ -714,6 +714,48 @@ func GetAllMigrations() []Migration {
 			// Явный источник устраняет неоднозначность каталога и не откатывается в NULL.
 			Down: func(db *sql.DB) error { return nil },
 		},
+		{
+			Version:     "113_add_class_spellcasting",
+			Description: "Добавить прогрессию ячеек заклинаний классам (full/half/third/pact)",
+			Up:          addClassSpellcasting,
+			Down:        removeClassSpellcasting,
+		},
+		{
+			Version:     "114_add_character_classes",
+			Description: "Перевести персонажей на список классов и добавить классам правила мультикласса",
+			Up:          addCharacterClasses,
+			Down:        removeCharacterClasses,
+		},
+		{
+			Version:     "115_add_group_variant_encumbrance",
+			Description: "Добавить группам переключатель вариантной нагрузки",
+			Up:          addGroupVariantEncumbrance,
+			Down:        removeGroupVariantEncumbrance,
+		},
+		{
+			Version:     "116_add_item_attunement",
+			Description: "Хранить настройку на предметы в строках инвентаря и добавить карточкам требования настройки",
+			Up:          addItemAttunement,
+			Down:        removeItemAttunement,
+		},
+		{
+			Version:     "117_add_monster_tags_and_hit_dice",
+			Description: "Добавить монстрам метки каталога и кость хитов статблока",
+			Up:          addMonsterTagsAndHitDice,
+			Down:        removeMonsterTagsAndHitDice,
+		},
+		{
+			Version:     "118_create_encounter_templates",
+			Description: "Создать заготовки столкновений мастера",
+			Up:          createEncounterTemplates,
+			Down:        dropEncounterTemplates,
+		},
+		{
+			Version:     "119_add_encounter_conclusion",
+			Description: "Завершение боя с итогом и накопленный опыт персонажей",
+			Up:          addEncounterConclusion,
+			Down:        removeEncounterConclusion,
+		},
 		// Здесь можно добавлять новые миграции
 	}
 }
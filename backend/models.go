@@ -388,6 +388,7 @@ type Card struct {
 	RelatedEffects               *Properties    `json:"related_effects" gorm:"type:text"`
 	Attunement                   *string        `json:"attunement" gorm:"type:text"`
 	RequiresAttunement           *bool          `json:"requires_attunement" gorm:"type:boolean;default:false"` // Требуется ли настройка
+	AttunementRequirements       *JSONMap       `json:"attunement_requirements" gorm:"type:jsonb"`             // Требования настройки: classes, races, spellcaster
 	Range                        *string        `json:"range" gorm:"column:range;type:varchar(50)"`            // Дальность (например, "30/120")
 	Tags                         *Properties    `json:"tags" gorm:"type:text"`
 	IsTemplate                   TemplateType   `json:"is_template" gorm:"type:varchar(20);default:'false'"` // Тип шаблона
@@ -441,6 +442,7 @@ type CreateCardRequest struct {
 	RelatedEffects               *Properties    `json:"related_effects"`
 	Attunement                   *string        `json:"attunement"`
 	RequiresAttunement           *bool          `json:"requires_attunement"`
+	AttunementRequirements       *JSONMap       `json:"attunement_requirements"`
 	Range                        *string        `json:"range"`
 	Tags                         *Properties    `json:"tags"`
 	IsTemplate                   TemplateType   `json:"is_template"`
@@ -492,6 +494,7 @@ type UpdateCardRequest struct {
 	RelatedEffects               *Properties    `json:"related_effects"`
 	Attunement                   *string        `json:"attunement"`
 	RequiresAttunement           *bool          `json:"requires_attunement"`
+	AttunementRequirements       *JSONMap       `json:"attunement_requirements"`
 	Range                        *string        `json:"range"`
 	Tags                         *Properties    `json:"tags"`
 	IsTemplate                   TemplateType   `json:"is_template"`
@@ -554,6 +557,7 @@ type CardResponse struct {
 	RelatedEffects               *Properties    `json:"related_effects"`
 	Attunement                   *string        `json:"attunement"`
 	RequiresAttunement           *bool          `json:"requires_attunement"`
+	AttunementRequirements       *JSONMap       `json:"attunement_requirements"`
 	Range                        *string        `json:"range"`
 	Tags                         *Properties    `json:"tags"`
 	IsTemplate                   TemplateType   `json:"is_template"`
@@ -848,6 +852,7 @@ func (card Card) ToCardResponse() CardResponse {
 		RelatedEffects:               card.RelatedEffects,
 		Attunement:                   card.Attunement,
 		RequiresAttunement:           card.RequiresAttunement,
+		AttunementRequirements:       card.AttunementRequirements,
 		Range:                        card.Range,
 		Tags:                         card.Tags,
 		IsTemplate:                   card.IsTemplate,
@@ -1000,6 +1005,9 @@ type Group struct {
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 
+	// Правила группы: вариантная нагрузка (5×Сила — нагружен, 10×Сила — сильно нагружен)
+	VariantEncumbrance bool `json:"variant_encumbrance" gorm:"not null;default:false"`
+
 	// Связи
 	DM      User          `json:"dm" gorm:"foreignKey:DMID"`
 	Members []GroupMember `json:"members" gorm:"foreignKey:GroupID"`
@@ -1089,8 +1097,14 @@ type AuthResponse struct {
 
 // CreateGroupRequest - запрос на создание группы
 type CreateGroupRequest struct {
-	Name        string `json:"name" binding:"required,min=1,max=100"`
-	Description string `json:"description"`
+	Name               string `json:"name" binding:"required,min=1,max=100"`
+	Description        string `json:"description"`
+	VariantEncumbrance bool   `json:"variant_encumbrance"`
+}
+
+// UpdateGroupRulesRequest - запрос на изменение правил группы
+type UpdateGroupRulesRequest struct {
+	VariantEncumbrance *bool `json:"variant_encumbrance" binding:"required"`
 }
 
 // JoinGroupRequest - запрос на присоединение к группе
@@ -47,6 +47,10 @@ type CharacterV3 struct {
 	ClassID      *uuid.UUID `json:"class_id" gorm:"type:uuid"`
 	BackgroundID *uuid.UUID `json:"background_id" gorm:"type:uuid"`
 	Level        int        `json:"level" gorm:"not null;default:1"`
+	// Накопленный опыт; начисляется сервером при завершении боя.
+	ExperiencePoints int `json:"experience_points" gorm:"not null;default:0"`
+	// Классы по порядку взятия; class_id — первый из них, level — сумма уровней.
+	Classes *CharacterClassEntries `json:"classes" gorm:"type:jsonb"`
 
 	// Списки ссылок (jsonb-массивы строковых uuid)
 	FeatIDs     *Properties `json:"feat_ids" gorm:"type:jsonb"`
@@ -133,6 +137,8 @@ type CreateCharacterV3Request struct {
 	BackgroundID           *uuid.UUID `json:"background_id"`
 	Level                  int        `json:"level"`
 
+	Classes *CharacterClassEntries `json:"classes"`
+
 	FeatIDs     *Properties `json:"feat_ids"`
 	SpellIDs    *Properties `json:"spell_ids"`
 	ActionIDs   *Properties `json:"action_ids"`
@@ -188,6 +194,8 @@ type UpdateCharacterV3Request struct {
 	BackgroundID           *uuid.UUID `json:"background_id"`
 	Level                  int        `json:"level"`
 
+	Classes *CharacterClassEntries `json:"classes"`
+
 	FeatIDs     *Properties `json:"feat_ids"`
 	SpellIDs    *Properties `json:"spell_ids"`
 	ActionIDs   *Properties `json:"action_ids"`
@@ -292,6 +300,61 @@ type PatchCharacterRuntimeRequest struct {
 	Currency                *JSONMap           `json:"currency"`
 }
 
+// EvaluateCharacterFormulaRequest — формула механики для вычисления против
+// персонажа. Formula — строка или число; Seed != 0 делает бросок повторяемым.
+type EvaluateCharacterFormulaRequest struct {
+	Formula        interface{} `json:"formula" binding:"required"`
+	SpellSlotAbove int         `json:"spell_slot_above"`
+	WeaponMod      *int        `json:"weapon_mod"`
+	Crit           bool        `json:"crit"`
+	Seed           int64       `json:"seed"`
+}
+
+// CharacterFormulaEvaluation — ответ evaluate: результат формулы и переменные
+// персонажа, против которых она вычислена.
+type CharacterFormulaEvaluation struct {
+	FormulaEvaluation
+	Variables map[string]formulaVariable `json:"variables"`
+}
+
+// CharacterClassEntry — класс персонажа: подкласс и уровень в этом классе.
+type CharacterClassEntry struct {
+	ClassID    uuid.UUID  `json:"class_id"`
+	SubclassID *uuid.UUID `json:"subclass_id,omitempty"`
+	Level      int        `json:"level"`
+}
+
+// CharacterClassEntries — jsonb-массив классов в порядке взятия.
+type CharacterClassEntries []CharacterClassEntry
+
+func (r *CharacterClassEntries) Scan(value interface{}) error {
+	if value == nil {
+		*r = nil
+		return nil
+	}
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("неподдерживаемый тип для CharacterClassEntries: %T", value)
+	}
+	if len(data) == 0 || string(data) == "null" {
+		*r = nil
+		return nil
+	}
+	return json.Unmarshal(data, r)
+}
+
+func (r CharacterClassEntries) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return json.Marshal(r)
+}
+
 // InventoryItemRow — строка инвентаря персонажа v3.
 // S4 контейнеры: ContainerID — card_id контейнера, в котором лежит предмет (пусто = верхний уровень).
 // Поле jsonb, миграция не требуется (колонка inventory_items уже JSONB).
@@ -299,6 +362,10 @@ type InventoryItemRow struct {
 	CardID      string `json:"card_id"`
 	Qty         int    `json:"qty"`
 	ContainerID string `json:"container_id,omitempty"`
+
+	// Настройка на предмет — ставит только сервер (attune/unattune). Строка
+	// с qty 0 лишь хранит настройку надетого предмета.
+	Attuned bool `json:"attuned,omitempty"`
 }
 
 // InventoryItemRows — jsonb-массив инвентаря.
@@ -343,6 +410,15 @@ type ActiveEffectSourceTurnExpiry struct {
 	Armed         bool   `json:"armed,omitempty"`
 }
 
+// ActiveEffectConcentration связывает эффект с концентрацией заклинателя: по
+// этой связи сервер снимает все эффекты заклинания со всех участников боя,
+// когда концентрация прерывается.
+type ActiveEffectConcentration struct {
+	CasterActorID string `json:"casterActorId"`
+	Spell         string `json:"spell"`
+	SpellID       string `json:"spellId,omitempty"`
+}
+
 // ActiveEffectRow — активный эффект на листе v3 (runtime).
 type ActiveEffectRow struct {
 	ID               string                        `json:"id"`
@@ -354,6 +430,7 @@ type ActiveEffectRow struct {
 	OwnerID          string                        `json:"ownerId,omitempty"`
 	SourceID         string                        `json:"sourceId,omitempty"`
 	SourceTurnExpiry *ActiveEffectSourceTurnExpiry `json:"sourceTurnExpiry,omitempty"`
+	Concentration    *ActiveEffectConcentration    `json:"concentration,omitempty"`
 }
 
 // ActiveEffectRows — jsonb-массив активных эффектов.
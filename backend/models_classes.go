@@ -64,6 +64,8 @@ type Class struct {
 	EquipmentOptions      *ClassEquipmentOptions `json:"equipment_options" gorm:"type:jsonb"` // Варианты А/Б/В (предметы + золото)
 	LevelProgression      *JSONMap               `json:"level_progression" gorm:"type:jsonb"`
 	Resources             *JSONMap               `json:"resources" gorm:"type:jsonb"`
+	Spellcasting          *JSONMap               `json:"spellcasting" gorm:"type:jsonb"` // Прогрессия ячеек: {progression, ability, ...}
+	Multiclass            *JSONMap               `json:"multiclass" gorm:"type:jsonb"`   // Мультикласс: {prerequisites, proficiencies}
 	Support               *JSONMap               `json:"support" gorm:"type:jsonb"`
 	IsSubclass            *bool                  `json:"is_subclass" gorm:"type:boolean;default:false"`
 	ParentClassID         *uuid.UUID             `json:"parent_class_id" gorm:"type:uuid;index:idx_classes_parent"`
@@ -102,6 +104,8 @@ type CreateClassRequest struct {
 	EquipmentOptions     *ClassEquipmentOptions `json:"equipment_options"`
 	LevelProgression     *JSONMap               `json:"level_progression"`
 	Resources            *JSONMap               `json:"resources"`
+	Spellcasting         *JSONMap               `json:"spellcasting"`
+	Multiclass           *JSONMap               `json:"multiclass"`
 	IsSubclass           *bool                  `json:"is_subclass"`
 	ParentClassID        *uuid.UUID             `json:"parent_class_id"`
 	SubclassLevel        *int                   `json:"subclass_level"`
@@ -133,6 +137,8 @@ type UpdateClassRequest struct {
 	EquipmentOptions     *ClassEquipmentOptions `json:"equipment_options"`
 	LevelProgression     *JSONMap               `json:"level_progression"`
 	Resources            *JSONMap               `json:"resources"`
+	Spellcasting         *JSONMap               `json:"spellcasting"`
+	Multiclass           *JSONMap               `json:"multiclass"`
 	IsSubclass           *bool                  `json:"is_subclass"`
 	ParentClassID        *uuid.UUID             `json:"parent_class_id"`
 	SubclassLevel        *int                   `json:"subclass_level"`
@@ -166,6 +172,8 @@ type ClassResponse struct {
 	EquipmentOptions      *ClassEquipmentOptions `json:"equipment_options"`
 	LevelProgression      *JSONMap               `json:"level_progression"`
 	Resources             *JSONMap               `json:"resources"`
+	Spellcasting          *JSONMap               `json:"spellcasting"`
+	Multiclass            *JSONMap               `json:"multiclass"`
 	Support               *JSONMap               `json:"support"`
 	ChoiceRecommendations ChoiceRecommendations  `json:"choice_recommendations,omitempty"`
 	IsSubclass            *bool                  `json:"is_subclass"`
@@ -191,7 +199,7 @@ func (cl Class) ToClassResponse() ClassResponse {
 		WeaponProficiencies: cl.WeaponProficiencies, ToolProficiencies: cl.ToolProficiencies,
 		SkillChoices: cl.SkillChoices, StartingEquipment: cl.StartingEquipment,
 		EquipmentOptions: cl.EquipmentOptions,
-		LevelProgression: cl.LevelProgression, Resources: cl.Resources, Support: cl.Support,
+		LevelProgression: cl.LevelProgression, Resources: cl.Resources, Spellcasting: cl.Spellcasting, Multiclass: cl.Multiclass, Support: cl.Support,
 		IsSubclass: cl.IsSubclass, ParentClassID: cl.ParentClassID, SubclassLevel: cl.SubclassLevel,
 		RelatedEffects: cl.RelatedEffects, RelatedActions: cl.RelatedActions,
 		Type: cl.Type, Author: cl.Author, Source: cl.Source, Tags: cl.Tags, IsExtended: cl.IsExtended,
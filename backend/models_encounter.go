@@ -1,6 +1,9 @@
 package main
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +23,11 @@ type Encounter struct {
 	Seq           int64      `json:"seq" gorm:"not null;default:0"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// ConcludedAt — бой завершён мастером, операции над ним больше не
+	// принимаются; Conclusion — итог: опыт и добыча (EncounterConclusion).
+	ConcludedAt *time.Time `json:"concluded_at"`
+	Conclusion  *JSONMap   `json:"conclusion" gorm:"type:jsonb"`
 }
 
 func (Encounter) TableName() string { return "encounters" }
@@ -86,4 +94,89 @@ type ApplyRequest struct {
 	ActiveIndex *int                     `json:"active_index"`
 	Events      []interface{}            `json:"events"` // legacy: свободные строки журнала боя
 	Log         []BattleLogEntry         `json:"log"`    // структурированный журнал (боя + персонажей)
+
+	// Order — новый порядок хода (actorId); не названные участники остаются
+	// после названных в прежнем порядке.
+	Order []string `json:"order,omitempty"`
+
+	// restartsTurnOrder — серверный op полного переброса инициативы: сброс на раунд 1
+	// начинает порядок заново и сменой хода не считается. Клиент его выставить не может.
+	restartsTurnOrder bool
+}
+
+// EncounterTemplate — заготовка столкновения мастера: именованные группы существ
+// статблоков и заметки. Владелец может поделиться заготовкой с группой — её
+// мастера видят заготовку и создают по ней бой (POST /encounter-templates/:id/spawn).
+type EncounterTemplate struct {
+	ID            uuid.UUID               `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name          string                  `json:"name" gorm:"type:varchar(255);not null"`
+	OwnerUserID   uuid.UUID               `json:"owner_user_id" gorm:"type:uuid;not null"`
+	GroupID       *uuid.UUID              `json:"group_id" gorm:"type:uuid"`
+	Notes         string                  `json:"notes" gorm:"type:text;not null;default:''"`
+	MonsterGroups EncounterTemplateGroups `json:"monster_groups" gorm:"type:jsonb;not null;default:'[]'::jsonb"`
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
+}
+
+func (EncounterTemplate) TableName() string { return "encounter_templates" }
+
+// EncounterTemplateMonster — строка группы: статблок и число копий. HPMode —
+// средние (average) или брошенные по кости хитов (rolled) хиты; Conditions —
+// состояния, с которыми существа входят в бой; Hidden — скрыты до раскрытия.
+type EncounterTemplateMonster struct {
+	MonsterID  uuid.UUID `json:"monster_id" binding:"required"`
+	Count      int       `json:"count" binding:"required,min=1,max=50"`
+	HPMode     string    `json:"hp_mode" binding:"omitempty,oneof=average rolled"`
+	Conditions []string  `json:"conditions" binding:"max=15"`
+	Hidden     bool      `json:"hidden"`
+}
+
+// EncounterTemplateGroup — именованная группа существ («засада у моста»).
+type EncounterTemplateGroup struct {
+	Name     string                     `json:"name" binding:"max=100"`
+	Monsters []EncounterTemplateMonster `json:"monsters" binding:"required,min=1,max=20,dive"`
+}
+
+// EncounterTemplateGroups — jsonb-массив групп заготовки.
+type EncounterTemplateGroups []EncounterTemplateGroup
+
+func (g *EncounterTemplateGroups) Scan(value interface{}) error {
+	if value == nil {
+		*g = nil
+		return nil
+	}
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("неподдерживаемый тип для EncounterTemplateGroups: %T", value)
+	}
+	if len(data) == 0 || string(data) == "null" {
+		*g = nil
+		return nil
+	}
+	return json.Unmarshal(data, g)
+}
+
+func (g EncounterTemplateGroups) Value() (driver.Value, error) {
+	if g == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(g)
+}
+
+// EncounterTemplateRequest — создание и замена заготовки.
+type EncounterTemplateRequest struct {
+	Name          string                   `json:"name" binding:"required,max=255"`
+	GroupID       *uuid.UUID               `json:"group_id"`
+	Notes         string                   `json:"notes" binding:"max=20000"`
+	MonsterGroups []EncounterTemplateGroup `json:"monster_groups" binding:"required,min=1,max=20,dive"`
+}
+
+// SpawnEncounterTemplateRequest — имя создаваемого боя (по умолчанию — имя заготовки).
+type SpawnEncounterTemplateRequest struct {
+	Name string `json:"name" binding:"max=255"`
 }
@@ -36,6 +36,11 @@ type Monster struct {
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Tags — метки каталога для подбора столкновений («нежить», «болото»);
+	// HitDice — кость хитов статблока («7d6+7») для бросаемых хитов.
+	Tags    *Properties `json:"tags" gorm:"type:jsonb;not null;default:'[]'::jsonb"`
+	HitDice string      `json:"hit_dice" gorm:"type:varchar(50);not null;default:''"`
 }
 
 func (Monster) TableName() string { return "monsters" }
@@ -60,4 +65,7 @@ type MonsterUpsertRequest struct {
 	AI               *JSONMap    `json:"ai"`
 	TokenURL         string      `json:"token_url"`
 	Source           string      `json:"source"`
+
+	Tags    *Properties `json:"tags"`
+	HitDice string      `json:"hit_dice"`
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strings"
 
@@ -57,6 +58,19 @@ func normalizeMonsterRequest(req *MonsterUpsertRequest) {
 		value := JSONMap{"strategy": "melee_chase"}
 		req.AI = &value
 	}
+	tags := Properties{}
+	if req.Tags != nil {
+		seen := map[string]bool{}
+		for _, tag := range *req.Tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	req.Tags = &tags
+	req.HitDice = strings.TrimSpace(req.HitDice)
 }
 
 func monsterRequestIssue(req MonsterUpsertRequest) string {
@@ -98,9 +112,32 @@ func monsterRequestIssue(req MonsterUpsertRequest) string {
 			seen[id] = true
 		}
 	}
+	if len(*req.Tags) > 20 {
+		return "Не больше 20 меток монстра"
+	}
+	for _, tag := range *req.Tags {
+		if len([]rune(tag)) > 50 {
+			return "Метка монстра не длиннее 50 символов"
+		}
+	}
+	if req.HitDice != "" {
+		if _, err := parseDiceExpression(req.HitDice); err != nil {
+			return "Кость хитов должна быть выражением вида 7d6+7"
+		}
+	}
 	return ""
 }
 
+// monsterAIUpdateIssue проверяет профиль ИИ при правке статблока, только если
+// запрос прислал его изменённым (как rejectInvalidMechanicsUpdate у механики):
+// статблок, сохранённый до проверки профилей, остаётся редактируемым.
+func monsterAIUpdateIssue(current, requested *JSONMap, actionIDs Properties) string {
+	if requested == nil || reflect.DeepEqual(normalizedMechanics(current), normalizedMechanics(requested)) {
+		return ""
+	}
+	return monsterAIProfileIssue(*requested, actionIDs)
+}
+
 func (mc *MonsterController) referenceIssue(req MonsterUpsertRequest) (string, error) {
 	checks := []struct {
 		label string
@@ -132,7 +169,7 @@ func monsterFromRequest(req MonsterUpsertRequest) Monster {
 		ChallengeRating: req.ChallengeRating, ArmorClass: req.ArmorClass, MaxHP: req.MaxHP,
 		Speed: req.Speed, InitiativeBonus: req.InitiativeBonus, ProficiencyBonus: req.ProficiencyBonus,
 		Abilities: req.Abilities, ActionIDs: req.ActionIDs, EffectIDs: req.EffectIDs, AI: req.AI,
-		TokenURL: req.TokenURL, Source: req.Source,
+		TokenURL: req.TokenURL, Source: req.Source, Tags: req.Tags, HitDice: req.HitDice,
 	}
 }
 
@@ -180,7 +217,11 @@ func (mc *MonsterController) Create(c *gin.Context) {
 		return
 	}
 	normalizeMonsterRequest(&req)
-	if issue := monsterRequestIssue(req); issue != "" {
+	issue := monsterRequestIssue(req)
+	if issue == "" {
+		issue = monsterAIProfileIssue(*req.AI, *req.ActionIDs)
+	}
+	if issue != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": issue})
 		return
 	}
@@ -215,8 +256,17 @@ func (mc *MonsterController) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса", "details": err.Error()})
 		return
 	}
+	// Не присланный профиль ИИ остаётся прежним, а не сбрасывается на умолчание.
+	keepAI := req.AI == nil && current.AI != nil
 	normalizeMonsterRequest(&req)
-	if issue := monsterRequestIssue(req); issue != "" {
+	if keepAI {
+		req.AI = current.AI
+	}
+	issue := monsterRequestIssue(req)
+	if issue == "" {
+		issue = monsterAIUpdateIssue(current.AI, req.AI, *req.ActionIDs)
+	}
+	if issue != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": issue})
 		return
 	}
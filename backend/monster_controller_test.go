@@ -58,3 +58,21 @@ func TestMonsterRequestRejectsIncompleteStatsAndOpaqueReferences(t *testing.T) {
 		t.Fatalf("duplicate reference accepted, got %q", issue)
 	}
 }
+
+func TestMonsterAIUpdateIssueOnlyChecksChangedProfile(t *testing.T) {
+	actions := Properties{"b1000000-0000-4000-8000-000000000001"}
+	stale := JSONMap{"strategy": "melee_chase", "target_priority": []interface{}{"nearest"}}
+	if issue := monsterAIUpdateIssue(&stale, &JSONMap{"strategy": "melee_chase", "target_priority": []interface{}{"nearest"}}, actions); issue != "" {
+		t.Fatalf("unchanged legacy profile must not block the edit: %q", issue)
+	}
+	if issue := monsterAIUpdateIssue(&stale, nil, actions); issue != "" {
+		t.Fatalf("omitted profile must not be validated: %q", issue)
+	}
+	if issue := monsterAIUpdateIssue(nil, &JSONMap{}, actions); issue != "" {
+		t.Fatalf("empty profile is accepted: %q", issue)
+	}
+	changed := JSONMap{"strategy": "melee_chase", "target_priority": []interface{}{"farthest_first"}}
+	if issue := monsterAIUpdateIssue(&stale, &changed, actions); issue == "" {
+		t.Fatal("a changed profile is still validated")
+	}
+}
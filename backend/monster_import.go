@@ -0,0 +1,589 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Импорт статблоков в раскладке 5e SRD API (dnd5eapi) и Open5e. Статблок
+// превращается в MonsterUpsertRequest, действия — в Action с механикой
+// броска атаки или спасброска, черты — в Effect. Всё, что разобрать в
+// механику не удалось, импортируется описанием и попадает в отчёт.
+
+var (
+	importAttackPattern2014 = regexp.MustCompile(`(?i)(melee or ranged|melee|ranged)\s+(weapon|spell)\s+attack:\s*([+\-−]\s*\d+)\s+to hit`)
+	importAttackPattern2024 = regexp.MustCompile(`(?i)(melee or ranged|melee|ranged)\s+attack roll:\s*([+\-−]\s*\d+)`)
+	importReachPattern      = regexp.MustCompile(`(?i)reach\s+(\d+)\s*ft`)
+	importRangePattern      = regexp.MustCompile(`(?i)range\s+(\d+)(?:/\d+)?\s*ft`)
+	importDamagePattern     = regexp.MustCompile(`(?i)\d+\s*\((\d+d\d+(?:\s*[+\-−]\s*\d+)?)\)\s+([a-z]+)\s+damage`)
+	importSavePattern2014   = regexp.MustCompile(`(?i)DC\s*(\d+)\s+(strength|dexterity|constitution|intelligence|wisdom|charisma)\s+saving throw`)
+	importSavePattern2024   = regexp.MustCompile(`(?i)(strength|dexterity|constitution|intelligence|wisdom|charisma)\s+saving throw:\s*DC\s*(\d+)`)
+	importHalfPattern       = regexp.MustCompile(`(?i)half as much damage|success:\s*half damage`)
+	importAreaPattern       = regexp.MustCompile(`(?i)(\d+)-foot[- ](cone|line|cube|sphere|radius|emanation)`)
+	importWithinPattern     = regexp.MustCompile(`(?i)within\s+(\d+)\s*(?:feet|ft)`)
+	importConditionPattern  = regexp.MustCompile(`(?i)\b(blinded|charmed|deafened|frightened|grappled|incapacitated|paralyzed|petrified|poisoned|prone|restrained|stunned|unconscious)\b`)
+	importUsagePattern      = regexp.MustCompile(`(?i)\s*\((recharge\s+[2-6](?:\s*[-–—]\s*6)?|\d+/day|recharges after a (?:short or )?long rest)\)\s*$`)
+	importDicePattern       = regexp.MustCompile(`^(\d+)d(\d+)$`)
+	importSlugCleanup       = regexp.MustCompile(`[^a-z0-9]+`)
+	importNumberPattern     = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+	importFlatDicePattern   = regexp.MustCompile(`^\s*(\d+d\d+)\s*(?:([+-])\s*(\d+))?\s*$`)
+)
+
+var importAbilityNames = map[string]string{
+	"strength": "str", "dexterity": "dex", "constitution": "con",
+	"intelligence": "int", "wisdom": "wis", "charisma": "cha",
+	"str": "str", "dex": "dex", "con": "con", "int": "int", "wis": "wis", "cha": "cha",
+}
+
+// monsterImportPlan — разобранный статблок: монстр без ссылок, его действия
+// и черты (с card_number, но без ID) и заметки о том, что ушло в описание.
+type monsterImportPlan struct {
+	Monster   MonsterUpsertRequest
+	Actions   []Action
+	Effects   []Effect
+	Narrative []string
+}
+
+// importSlug — slug из имени: латиница, цифры и дефисы.
+func importSlug(name string) string {
+	return strings.Trim(importSlugCleanup.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func importString(raw map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch value := raw[key].(type) {
+		case string:
+			if strings.TrimSpace(value) != "" {
+				return strings.TrimSpace(value)
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// importNumber читает число, число-строку («12») или первое число строки
+// («30 ft.»); у массивов берётся value первого элемента (armor_class SRD API).
+func importNumber(raw interface{}) (float64, bool) {
+	switch value := raw.(type) {
+	case float64:
+		return value, true
+	case string:
+		digits := importNumberPattern.FindString(value)
+		number, err := strconv.ParseFloat(digits, 64)
+		return number, err == nil
+	case []interface{}:
+		if len(value) > 0 {
+			if first, ok := value[0].(map[string]interface{}); ok {
+				return importNumber(first["value"])
+			}
+			return importNumber(value[0])
+		}
+	case map[string]interface{}:
+		return importNumber(value["value"])
+	}
+	return 0, false
+}
+
+func importInt(raw map[string]interface{}, keys ...string) (int, bool) {
+	for _, key := range keys {
+		if number, ok := importNumber(raw[key]); ok {
+			return int(number), true
+		}
+	}
+	return 0, false
+}
+
+func importSignedNumber(text string) int {
+	text = strings.NewReplacer("−", "-", " ", "").Replace(text)
+	number, _ := strconv.Atoi(strings.TrimPrefix(text, "+"))
+	return number
+}
+
+func importList(raw map[string]interface{}, key string) []map[string]interface{} {
+	items, _ := raw[key].([]interface{})
+	out := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if entry, ok := item.(map[string]interface{}); ok {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// importJSONMap — механика в тех же типах, что придут из jsonb: схема и
+// сравнение с сохранённой строкой видят float64 и []interface{}.
+func importJSONMap(value map[string]interface{}) JSONMap {
+	raw, _ := json.Marshal(value)
+	var out JSONMap
+	_ = json.Unmarshal(raw, &out)
+	return out
+}
+
+func importAbilityModifier(score int) int {
+	return int(math.Floor(float64(score-10) / 2))
+}
+
+// importSpeedModes — порядок видов движения в отчёте, как в статблоке;
+// незнакомые виды идут за ними по алфавиту.
+var importSpeedModes = []string{"burrow", "climb", "fly", "swim"}
+
+// importSpeed — скорость ходьбы; остальные виды движения уходят в отчёт.
+func importSpeed(raw interface{}) (int, []string) {
+	switch value := raw.(type) {
+	case map[string]interface{}:
+		walk, _ := importNumber(value["walk"])
+		var extra []string
+		for mode := range value {
+			known := mode == "walk" || mode == "hover"
+			for _, listed := range importSpeedModes {
+				known = known || mode == listed
+			}
+			if !known {
+				extra = append(extra, mode)
+			}
+		}
+		sort.Strings(extra)
+		var other []string
+		for _, mode := range append(append([]string{}, importSpeedModes...), extra...) {
+			if number, ok := importNumber(value[mode]); ok && number > 0 {
+				other = append(other, fmt.Sprintf("%s %d ft.", mode, int(number)))
+			}
+		}
+		return int(walk), other
+	default:
+		number, _ := importNumber(raw)
+		return int(number), nil
+	}
+}
+
+// importHitDice дописывает к кости хитов бонус Телосложения, если источник
+// дал только кости («7d6» при Телосложении 12 — «7d6+7»).
+func importHitDice(raw string, constitution int) string {
+	raw = strings.ReplaceAll(strings.TrimSpace(raw), " ", "")
+	match := importDicePattern.FindStringSubmatch(raw)
+	if match == nil {
+		return raw
+	}
+	count, _ := strconv.Atoi(match[1])
+	bonus := count * importAbilityModifier(constitution)
+	switch {
+	case bonus > 0:
+		return fmt.Sprintf("%s+%d", raw, bonus)
+	case bonus < 0:
+		return fmt.Sprintf("%s%d", raw, bonus)
+	}
+	return raw
+}
+
+// importUsage снимает с имени пометку использования («Огненное дыхание
+// (Recharge 5–6)») и переводит её в перезарядку действия.
+func importUsage(name string, usage map[string]interface{}) (string, *ActionRecharge, *string) {
+	recharge := func(kind ActionRecharge, custom string) (*ActionRecharge, *string) {
+		if custom == "" {
+			return &kind, nil
+		}
+		return &kind, &custom
+	}
+	if match := importUsagePattern.FindStringSubmatch(name); match != nil {
+		name = strings.TrimSpace(importUsagePattern.ReplaceAllString(name, ""))
+		label := strings.ToLower(match[1])
+		switch {
+		case strings.HasPrefix(label, "recharge "):
+			kind, custom := recharge(RechargeCustom, strings.TrimSpace(strings.TrimPrefix(label, "recharge ")))
+			return name, kind, custom
+		case strings.HasSuffix(label, "/day"):
+			kind, custom := recharge(RechargeLongRest, "")
+			return name, kind, custom
+		default:
+			kind, custom := recharge(RechargeShortRest, "")
+			return name, kind, custom
+		}
+	}
+	if usage != nil {
+		switch strings.ToLower(importString(usage, "type")) {
+		case "recharge on roll":
+			if min, ok := importInt(usage, "min_value"); ok && min >= 2 && min <= 6 {
+				text := "6"
+				if min < 6 {
+					text = fmt.Sprintf("%d–6", min)
+				}
+				kind, custom := recharge(RechargeCustom, text)
+				return name, kind, custom
+			}
+		case "per day":
+			kind, custom := recharge(RechargeLongRest, "")
+			return name, kind, custom
+		case "recharge after rest":
+			kind, custom := recharge(RechargeShortRest, "")
+			return name, kind, custom
+		}
+	}
+	return name, nil, nil
+}
+
+// importDamage — строки урона действия: из структурированного damage SRD API
+// или из текста «5 (1d6 + 2) slashing damage».
+func importDamage(entry map[string]interface{}, text string) [][2]string {
+	var lines [][2]string
+	for _, damage := range importList(entry, "damage") {
+		dice := importString(damage, "damage_dice")
+		damageType := ""
+		if typed, ok := damage["damage_type"].(map[string]interface{}); ok {
+			damageType = strings.ToLower(importString(typed, "index", "name"))
+		}
+		if dice != "" && damageType != "" {
+			lines = append(lines, [2]string{dice, damageType})
+		}
+	}
+	if len(lines) > 0 {
+		return lines
+	}
+	for _, match := range importDamagePattern.FindAllStringSubmatch(text, -1) {
+		lines = append(lines, [2]string{match[1], strings.ToLower(match[2])})
+	}
+	return lines
+}
+
+// importDiceWithAbility записывает плоский бонус урона как модификатор
+// характеристики, если они совпадают («1d6 + 2» при Ловкости 14 — «1d6 + dex»).
+func importDiceWithAbility(dice, ability string, modifier int) string {
+	dice = strings.ReplaceAll(dice, "−", "-")
+	parts := importFlatDicePattern.FindStringSubmatch(dice)
+	if parts == nil {
+		return dice
+	}
+	bonus := 0
+	if parts[3] != "" {
+		bonus, _ = strconv.Atoi(parts[3])
+		if parts[2] == "-" {
+			bonus = -bonus
+		}
+	}
+	switch {
+	case bonus != 0 && bonus == modifier && ability != "":
+		return parts[1] + " + " + ability
+	case bonus > 0:
+		return fmt.Sprintf("%s + %d", parts[1], bonus)
+	case bonus < 0:
+		return fmt.Sprintf("%s - %d", parts[1], -bonus)
+	}
+	return parts[1]
+}
+
+// importAttackAbility подбирает характеристику, дающую указанный бонус атаки
+// вместе с бонусом мастерства. Без точного совпадения берётся ближайшая.
+func importAttackAbility(candidates []string, abilities map[string]int, proficiency, bonus int) (string, bool) {
+	best, bestGap := candidates[0], math.MaxInt
+	for _, ability := range candidates {
+		gap := importAbilityModifier(abilities[ability]) + proficiency - bonus
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap < bestGap {
+			best, bestGap = ability, gap
+		}
+	}
+	return best, bestGap == 0
+}
+
+// importActionMechanics строит механику броска атаки или спасброска по
+// описанию действия. Пустой результат — действие остаётся описанием.
+func importActionMechanics(entry map[string]interface{}, resource string, abilities map[string]int, proficiency int) (map[string]interface{}, []string) {
+	text := importString(entry, "desc")
+	name := importString(entry, "name")
+	var notes []string
+	activation := map[string]interface{}{
+		"mode": "active",
+		"cost": []interface{}{map[string]interface{}{"resource": resource, "amount": 1}},
+	}
+
+	rangeKind, attackType, bonusText := "", "weapon", ""
+	if match := importAttackPattern2014.FindStringSubmatch(text); match != nil {
+		rangeKind, attackType, bonusText = strings.ToLower(match[1]), strings.ToLower(match[2]), match[3]
+	} else if match := importAttackPattern2024.FindStringSubmatch(text); match != nil {
+		rangeKind, bonusText = strings.ToLower(match[1]), match[2]
+	}
+	if rangeKind != "" {
+		bonus := importSignedNumber(bonusText)
+		if value, ok := importInt(entry, "attack_bonus"); ok {
+			bonus = value
+		}
+		attackKind := attackType + "_melee"
+		if rangeKind == "ranged" {
+			attackKind = attackType + "_ranged"
+		}
+		if rangeKind == "melee or ranged" {
+			notes = append(notes, fmt.Sprintf("«%s»: дальний вариант атаки — только описание", name))
+		}
+		candidates := []string{"str", "dex"}
+		if attackKind == "weapon_ranged" {
+			candidates = []string{"dex", "str"}
+		} else if attackType == "spell" {
+			candidates = []string{"cha", "wis", "int"}
+		}
+		ability, exact := importAttackAbility(candidates, abilities, proficiency, bonus)
+		if !exact {
+			notes = append(notes, fmt.Sprintf("«%s»: бонус атаки %+d не совпадает с расчётным %+d", name, bonus, importAbilityModifier(abilities[ability])+proficiency))
+		}
+		rangeFt := 5
+		if match := importReachPattern.FindStringSubmatch(text); match != nil && attackKind != "weapon_ranged" && attackKind != "spell_ranged" {
+			rangeFt, _ = strconv.Atoi(match[1])
+		} else if match := importRangePattern.FindStringSubmatch(text); match != nil {
+			rangeFt, _ = strconv.Atoi(match[1])
+		}
+		damage := importDamage(entry, text)
+		if len(damage) == 0 {
+			return nil, append(notes, fmt.Sprintf("«%s»: урон атаки не распознан — только описание", name))
+		}
+		onHit := []interface{}{}
+		for i, line := range damage {
+			dice := importDiceWithAbility(line[0], "", 0)
+			if i == 0 {
+				dice = importDiceWithAbility(line[0], ability, importAbilityModifier(abilities[ability]))
+			}
+			onHit = append(onHit, map[string]interface{}{"kind": "damage", "dice": dice, "type": line[1]})
+		}
+		if importConditionPattern.MatchString(text) || importSavePattern2014.MatchString(text) || importSavePattern2024.MatchString(text) {
+			notes = append(notes, fmt.Sprintf("«%s»: побочный эффект попадания — только описание", name))
+		}
+		return map[string]interface{}{
+			"interaction": map[string]interface{}{"intent": "harmful"},
+			"activation":  activation,
+			"targeting": map[string]interface{}{
+				"domain": "actor", "actor_targets": true, "shape": "single",
+				"min_targets": 1, "max_targets": 1, "range_ft": rangeFt,
+				"requires_line_of_sight": true, "allowed_relations": []interface{}{"enemy"},
+			},
+			"effects": []interface{}{map[string]interface{}{
+				"resolution": "attack_roll", "ability": ability, "attack_kind": attackKind, "vs": "ac", "on_hit": onHit,
+			}},
+		}, notes
+	}
+
+	ability, dc := "", 0
+	if dcInfo, ok := entry["dc"].(map[string]interface{}); ok {
+		if typed, ok := dcInfo["dc_type"].(map[string]interface{}); ok {
+			ability = importAbilityNames[strings.ToLower(importString(typed, "index", "name"))]
+		}
+		dc, _ = importInt(dcInfo, "dc_value")
+	}
+	if ability == "" || dc == 0 {
+		if match := importSavePattern2014.FindStringSubmatch(text); match != nil {
+			dc, _ = strconv.Atoi(match[1])
+			ability = importAbilityNames[strings.ToLower(match[2])]
+		} else if match := importSavePattern2024.FindStringSubmatch(text); match != nil {
+			ability = importAbilityNames[strings.ToLower(match[1])]
+			dc, _ = strconv.Atoi(match[2])
+		}
+	}
+	if ability == "" || dc == 0 {
+		return nil, append(notes, fmt.Sprintf("«%s»: ни атака, ни спасбросок не распознаны — только описание", name))
+	}
+	onFail := []interface{}{}
+	half := importHalfPattern.MatchString(text)
+	if dcInfo, ok := entry["dc"].(map[string]interface{}); ok && importString(dcInfo, "success_type") == "half" {
+		half = true
+	}
+	for _, line := range importDamage(entry, text) {
+		damage := map[string]interface{}{"kind": "damage", "dice": importDiceWithAbility(line[0], "", 0), "type": line[1]}
+		if half {
+			damage["on_success"] = "half"
+		}
+		onFail = append(onFail, damage)
+	}
+	seen := map[string]bool{}
+	for _, match := range importConditionPattern.FindAllStringSubmatch(text, -1) {
+		condition := strings.ToLower(match[1])
+		if !seen[condition] {
+			seen[condition] = true
+			onFail = append(onFail, map[string]interface{}{"kind": "condition", "value": condition})
+		}
+	}
+	if len(seen) > 0 {
+		notes = append(notes, fmt.Sprintf("«%s»: длительность состояний — только в описании", name))
+	}
+	if len(onFail) == 0 {
+		return nil, append(notes, fmt.Sprintf("«%s»: исход спасброска не распознан — только описание", name))
+	}
+	targeting := map[string]interface{}{
+		"domain": "actor", "actor_targets": true, "shape": "single",
+		"min_targets": 1, "max_targets": 1, "requires_line_of_sight": true, "allowed_relations": []interface{}{"enemy"},
+	}
+	if match := importWithinPattern.FindStringSubmatch(text); match != nil {
+		targeting["range_ft"], _ = strconv.Atoi(match[1])
+	}
+	if match := importAreaPattern.FindStringSubmatch(text); match != nil {
+		size, _ := strconv.Atoi(match[1])
+		kind := strings.ToLower(match[2])
+		area := map[string]interface{}{"kind": kind, "size_ft": size}
+		if kind == "radius" {
+			area = map[string]interface{}{"kind": "sphere", "radius_ft": size}
+		}
+		targeting = map[string]interface{}{
+			"domain": "actor", "actor_targets": true, "shape": "area", "area": area,
+			"allowed_relations": []interface{}{"enemy", "ally"},
+		}
+	}
+	return map[string]interface{}{
+		"interaction": map[string]interface{}{"intent": "harmful"},
+		"activation":  activation,
+		"targeting":   targeting,
+		"effects": []interface{}{map[string]interface{}{
+			"resolution": "save", "ability": ability, "dc": dc, "on_fail": onFail,
+		}},
+	}, notes
+}
+
+// importCardNumber — устойчивый card_number строки статблока: повторный
+// импорт того же монстра находит те же действия и черты.
+func importCardNumber(kind, slug, name string, taken map[string]bool) string {
+	base := strings.ToUpper(fmt.Sprintf("MONSTER-%s-%s-%s", kind, slug, importSlug(name)))
+	number := base
+	for i := 2; taken[number]; i++ {
+		number = fmt.Sprintf("%s-%d", base, i)
+	}
+	taken[number] = true
+	return number
+}
+
+// planMonsterImport разбирает статблок. source — подпись источника, если
+// статблок её не несёт.
+func planMonsterImport(raw map[string]interface{}, source string) (monsterImportPlan, error) {
+	var plan monsterImportPlan
+	name := importString(raw, "name")
+	if name == "" {
+		return plan, fmt.Errorf("у статблока нет имени")
+	}
+	slug := strings.ToLower(importString(raw, "slug", "index"))
+	if slug == "" {
+		slug = importSlug(name)
+	}
+	if source = strings.TrimSpace(source); source == "" {
+		source = importString(raw, "document__title", "source")
+	}
+	if source == "" {
+		source = "SRD"
+	}
+
+	abilities := map[string]int{}
+	abilityMap := JSONMap{}
+	for full, short := range map[string]string{"strength": "str", "dexterity": "dex", "constitution": "con", "intelligence": "int", "wisdom": "wis", "charisma": "cha"} {
+		score, ok := importInt(raw, full, short)
+		if !ok {
+			score = 10
+		}
+		abilities[short] = score
+		abilityMap[short] = float64(score)
+	}
+	challengeRating := importString(raw, "challenge_rating", "cr")
+	if key, ok := challengeRatingKey(challengeRating); ok {
+		challengeRating = key
+	}
+	proficiency, ok := importInt(raw, "proficiency_bonus")
+	if !ok || proficiency <= 0 {
+		proficiency = challengeRatingProficiencyBonus(challengeRating)
+	}
+	armorClass, _ := importInt(raw, "armor_class")
+	hitPoints, _ := importInt(raw, "hit_points")
+	speed, otherSpeeds := importSpeed(raw["speed"])
+	if len(otherSpeeds) > 0 {
+		plan.Narrative = append(plan.Narrative, "другие скорости — только в описании: "+strings.Join(otherSpeeds, ", "))
+	}
+	initiative := importAbilityModifier(abilities["dex"])
+	if value, ok := raw["initiative"].(map[string]interface{}); ok {
+		if modifier, exists := importInt(value, "modifier"); exists {
+			initiative = modifier
+		}
+	} else if value, exists := importInt(raw, "initiative"); exists {
+		initiative = value
+	}
+	tags := Properties{}
+	if subtype := importString(raw, "subtype"); subtype != "" {
+		tags = append(tags, subtype)
+	}
+	nameEn := name
+	plan.Monster = MonsterUpsertRequest{
+		Slug: slug, Name: name, NameEn: &nameEn, Description: importString(raw, "desc"),
+		Size: strings.ToLower(importString(raw, "size")), CreatureType: strings.ToLower(importString(raw, "type")),
+		Alignment: importString(raw, "alignment"), ChallengeRating: challengeRating,
+		ArmorClass: armorClass, MaxHP: hitPoints, Speed: speed, InitiativeBonus: initiative,
+		ProficiencyBonus: proficiency, Abilities: &abilityMap, Source: source, Tags: &tags,
+		HitDice: importHitDice(importString(raw, "hit_points_roll", "hit_dice"), abilities["con"]),
+	}
+
+	taken := map[string]bool{}
+	for _, group := range []struct {
+		key, resource string
+		narrative     bool
+	}{
+		{"actions", string(ResourceAction), false},
+		{"bonus_actions", string(ResourceBonusAction), false},
+		{"reactions", string(ResourceReaction), false},
+		{"legendary_actions", string(ResourceFreeAction), true},
+	} {
+		for _, entry := range importList(raw, group.key) {
+			usage, _ := entry["usage"].(map[string]interface{})
+			actionName, recharge, rechargeCustom := importUsage(importString(entry, "name"), usage)
+			if actionName == "" {
+				continue
+			}
+			entry["name"] = actionName
+			description := importString(entry, "desc")
+			if description == "" {
+				description = actionName
+			}
+			actionNameEn := actionName
+			monsterType := "monster"
+			action := Action{
+				Name: actionName, NameEn: &actionNameEn, Description: description, Rarity: "common",
+				CardNumber: importCardNumber("ACTION", slug, actionName, taken),
+				Resource:   ActionResources{ActionResource(group.resource)}, Recharge: recharge, RechargeCustom: rechargeCustom,
+				ActionType: ActionTypeBaseAction, Type: &monsterType, Author: "System", Source: &source,
+			}
+			switch {
+			case group.narrative:
+				plan.Narrative = append(plan.Narrative, fmt.Sprintf("«%s»: легендарное действие — только описание", actionName))
+			case strings.EqualFold(actionName, "multiattack"):
+				plan.Narrative = append(plan.Narrative, "«Multiattack»: мультиатака — только описание")
+			default:
+				mechanics, notes := importActionMechanics(entry, group.resource, abilities, proficiency)
+				plan.Narrative = append(plan.Narrative, notes...)
+				if mechanics != nil {
+					compiled := importJSONMap(mechanics)
+					if problems := validateMechanicsSchema(compiled, mechanicsKindAction); len(problems) > 0 {
+						plan.Narrative = append(plan.Narrative, fmt.Sprintf("«%s»: механика не прошла схему (%s) — только описание", actionName, problems[0].Error()))
+					} else {
+						action.Mechanics = &compiled
+					}
+				}
+			}
+			plan.Actions = append(plan.Actions, action)
+		}
+	}
+	for _, entry := range importList(raw, "special_abilities") {
+		traitName := importString(entry, "name")
+		if traitName == "" {
+			continue
+		}
+		description := importString(entry, "desc")
+		if description == "" {
+			description = traitName
+		}
+		traitNameEn := traitName
+		monsterType := "monster"
+		plan.Effects = append(plan.Effects, Effect{
+			Name: traitName, NameEn: &traitNameEn, Description: description, Rarity: "common",
+			CardNumber: importCardNumber("EFFECT", slug, traitName, taken),
+			EffectType: EffectTypePassive, Type: &monsterType, Author: "System", Source: &source,
+		})
+		plan.Narrative = append(plan.Narrative, fmt.Sprintf("черта «%s» — только описание", traitName))
+	}
+	return plan, nil
+}
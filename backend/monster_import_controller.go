@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Применение разобранных статблоков к каталогу. Монстр сопоставляется по
+// slug, его действия и черты — по имени среди уже связанных строк, затем по
+// card_number, поэтому повторный импорт того же файла ничего не меняет.
+// Строки с mechanics_locked не перезаписываются. В режиме dry-run ничего не
+// пишется, а отчёт показывает, что изменилось бы. Запрос API укладывается в
+// общий лимит JSON; полные выгрузки SRD импортируются через CLI.
+
+// MonsterImportRequest — статблоки в раскладке SRD API или Open5e.
+type MonsterImportRequest struct {
+	StatBlocks []JSONMap `json:"stat_blocks" binding:"required,min=1,max=500"`
+	DryRun     bool      `json:"dry_run"`
+	Source     string    `json:"source" binding:"max=255"`
+}
+
+// MonsterImportChange — одно изменённое поле.
+type MonsterImportChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// MonsterImportEntry — действие или черта статблока и что с ними сделано:
+// create, update, unchanged или locked.
+type MonsterImportEntry struct {
+	Kind       string                `json:"kind"`
+	CardNumber string                `json:"card_number"`
+	Name       string                `json:"name"`
+	Status     string                `json:"status"`
+	Changes    []MonsterImportChange `json:"changes,omitempty"`
+}
+
+// MonsterImportResult — итог по одному статблоку. Narrative перечисляет
+// всё, что импортировано только описанием, без исполняемой механики.
+type MonsterImportResult struct {
+	Slug      string                `json:"slug"`
+	Name      string                `json:"name"`
+	Status    string                `json:"status"`
+	Error     string                `json:"error,omitempty"`
+	Changes   []MonsterImportChange `json:"changes,omitempty"`
+	Actions   []MonsterImportEntry  `json:"actions"`
+	Effects   []MonsterImportEntry  `json:"effects"`
+	Narrative []string              `json:"narrative"`
+}
+
+// MonsterImportReport — отчёт импорта целиком.
+type MonsterImportReport struct {
+	DryRun    bool                  `json:"dry_run"`
+	Results   []MonsterImportResult `json:"results"`
+	Created   int                   `json:"created"`
+	Updated   int                   `json:"updated"`
+	Unchanged int                   `json:"unchanged"`
+	Failed    int                   `json:"failed"`
+}
+
+// importDiff добавляет изменение поля, если значения различаются в JSON.
+func importDiff(changes *[]MonsterImportChange, field string, from, to interface{}) {
+	before, _ := json.Marshal(from)
+	after, _ := json.Marshal(to)
+	if string(before) != string(after) {
+		*changes = append(*changes, MonsterImportChange{Field: field, From: from, To: to})
+	}
+}
+
+func importNameKey(name string, nameEn *string) string {
+	if nameEn != nil && strings.TrimSpace(*nameEn) != "" {
+		return strings.ToLower(strings.TrimSpace(*nameEn))
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// importKeepsLocalizedName — имя строки уже переведено: английское имя
+// совпадает с импортируемым, а русское оставляем.
+func importKeepsLocalizedName(currentName string, currentEn, importedEn *string) bool {
+	return currentName != "" && currentEn != nil && importedEn != nil && strings.EqualFold(strings.TrimSpace(*currentEn), strings.TrimSpace(*importedEn))
+}
+
+func importEntryStatus(changes []MonsterImportChange) string {
+	if len(changes) > 0 {
+		return "update"
+	}
+	return "unchanged"
+}
+
+// importMonsterActions сопоставляет и записывает действия статблока.
+// Возвращает ID в порядке статблока.
+func importMonsterActions(tx *gorm.DB, planned []Action, linked Properties, dryRun bool) ([]string, []MonsterImportEntry, error) {
+	var current []Action
+	if len(linked) > 0 {
+		if err := tx.Where("id IN ?", []string(linked)).Find(&current).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	byName := map[string]Action{}
+	for _, action := range current {
+		byName[importNameKey(action.Name, action.NameEn)] = action
+	}
+	ids := make([]string, 0, len(planned))
+	entries := make([]MonsterImportEntry, 0, len(planned))
+	for _, next := range planned {
+		existing, found := byName[importNameKey(next.Name, next.NameEn)]
+		if !found {
+			err := tx.Unscoped().Where("card_number = ?", next.CardNumber).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, err
+			}
+			found = err == nil
+		}
+		entry := MonsterImportEntry{Kind: "action", CardNumber: next.CardNumber, Name: next.Name}
+		if !found {
+			next.ID = uuid.New()
+			if !dryRun {
+				if err := tx.Create(&next).Error; err != nil {
+					return nil, nil, fmt.Errorf("действие «%s»: %w", next.Name, err)
+				}
+			}
+			entry.Status = "create"
+		} else if isContentMechanicsLocked(existing.Support) {
+			next.ID = existing.ID
+			entry.CardNumber, entry.Status = existing.CardNumber, "locked"
+		} else {
+			if importKeepsLocalizedName(existing.Name, existing.NameEn, next.NameEn) {
+				next.Name = existing.Name
+			}
+			importDiff(&entry.Changes, "name", existing.Name, next.Name)
+			importDiff(&entry.Changes, "name_en", existing.NameEn, next.NameEn)
+			importDiff(&entry.Changes, "description", existing.Description, next.Description)
+			importDiff(&entry.Changes, "resources", existing.Resource, next.Resource)
+			importDiff(&entry.Changes, "recharge", existing.Recharge, next.Recharge)
+			importDiff(&entry.Changes, "recharge_custom", existing.RechargeCustom, next.RechargeCustom)
+			importDiff(&entry.Changes, "mechanics", existing.Mechanics, next.Mechanics)
+			importDiff(&entry.Changes, "source", existing.Source, next.Source)
+			if existing.DeletedAt.Valid {
+				importDiff(&entry.Changes, "deleted", true, false)
+			}
+			existing.Name, existing.NameEn, existing.Description = next.Name, next.NameEn, next.Description
+			existing.Resource, existing.Recharge, existing.RechargeCustom = next.Resource, next.Recharge, next.RechargeCustom
+			existing.Mechanics, existing.Source, existing.DeletedAt = next.Mechanics, next.Source, gorm.DeletedAt{}
+			if len(entry.Changes) > 0 && !dryRun {
+				if err := tx.Unscoped().Save(&existing).Error; err != nil {
+					return nil, nil, fmt.Errorf("действие «%s»: %w", next.Name, err)
+				}
+			}
+			next.ID = existing.ID
+			entry.CardNumber, entry.Status = existing.CardNumber, importEntryStatus(entry.Changes)
+		}
+		ids = append(ids, next.ID.String())
+		entries = append(entries, entry)
+	}
+	return ids, entries, nil
+}
+
+// importMonsterEffects — то же для черт статблока.
+func importMonsterEffects(tx *gorm.DB, planned []Effect, linked Properties, dryRun bool) ([]string, []MonsterImportEntry, error) {
+	var current []Effect
+	if len(linked) > 0 {
+		if err := tx.Where("id IN ?", []string(linked)).Find(&current).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	byName := map[string]Effect{}
+	for _, effect := range current {
+		byName[importNameKey(effect.Name, effect.NameEn)] = effect
+	}
+	ids := make([]string, 0, len(planned))
+	entries := make([]MonsterImportEntry, 0, len(planned))
+	for _, next := range planned {
+		existing, found := byName[importNameKey(next.Name, next.NameEn)]
+		if !found {
+			err := tx.Unscoped().Where("card_number = ?", next.CardNumber).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, err
+			}
+			found = err == nil
+		}
+		entry := MonsterImportEntry{Kind: "effect", CardNumber: next.CardNumber, Name: next.Name}
+		if !found {
+			next.ID = uuid.New()
+			if !dryRun {
+				if err := tx.Create(&next).Error; err != nil {
+					return nil, nil, fmt.Errorf("черта «%s»: %w", next.Name, err)
+				}
+			}
+			entry.Status = "create"
+		} else if isContentMechanicsLocked(existing.Support) {
+			next.ID = existing.ID
+			entry.CardNumber, entry.Status = existing.CardNumber, "locked"
+		} else {
+			if importKeepsLocalizedName(existing.Name, existing.NameEn, next.NameEn) {
+				next.Name = existing.Name
+			}
+			importDiff(&entry.Changes, "name", existing.Name, next.Name)
+			importDiff(&entry.Changes, "name_en", existing.NameEn, next.NameEn)
+			importDiff(&entry.Changes, "description", existing.Description, next.Description)
+			importDiff(&entry.Changes, "source", existing.Source, next.Source)
+			if existing.DeletedAt.Valid {
+				importDiff(&entry.Changes, "deleted", true, false)
+			}
+			existing.Name, existing.NameEn, existing.Description = next.Name, next.NameEn, next.Description
+			existing.Source, existing.DeletedAt = next.Source, gorm.DeletedAt{}
+			if len(entry.Changes) > 0 && !dryRun {
+				if err := tx.Unscoped().Save(&existing).Error; err != nil {
+					return nil, nil, fmt.Errorf("черта «%s»: %w", next.Name, err)
+				}
+			}
+			next.ID = existing.ID
+			entry.CardNumber, entry.Status = existing.CardNumber, importEntryStatus(entry.Changes)
+		}
+		ids = append(ids, next.ID.String())
+		entries = append(entries, entry)
+	}
+	return ids, entries, nil
+}
+
+// importMergeIDs — ID статблока в его порядке, затем ранее связанные строки,
+// которых в статблоке нет (их добавили вручную — не теряем).
+func importMergeIDs(imported []string, linked Properties) Properties {
+	merged := Properties{}
+	seen := map[string]bool{}
+	for _, id := range append(append([]string{}, imported...), linked...) {
+		if !seen[id] {
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+	return merged
+}
+
+// importMonsterPlan применяет один статблок в своей транзакции.
+func importMonsterPlan(db *gorm.DB, plan monsterImportPlan, dryRun bool) (MonsterImportResult, error) {
+	req := plan.Monster
+	result := MonsterImportResult{Slug: req.Slug, Name: req.Name, Narrative: plan.Narrative}
+	if result.Narrative == nil {
+		result.Narrative = []string{}
+	}
+	normalizeMonsterRequest(&req)
+	if issue := monsterRequestIssue(req); issue != "" {
+		return result, errors.New(issue)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current Monster
+		err := tx.Unscoped().Where("slug = ?", req.Slug).First(&current).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		exists := err == nil
+		linkedActions, linkedEffects := Properties{}, Properties{}
+		if exists && current.ActionIDs != nil {
+			linkedActions = *current.ActionIDs
+		}
+		if exists && current.EffectIDs != nil {
+			linkedEffects = *current.EffectIDs
+		}
+
+		actionIDs, actions, err := importMonsterActions(tx, plan.Actions, linkedActions, dryRun)
+		if err != nil {
+			return err
+		}
+		effectIDs, effects, err := importMonsterEffects(tx, plan.Effects, linkedEffects, dryRun)
+		if err != nil {
+			return err
+		}
+		result.Actions, result.Effects = actions, effects
+		mergedActions, mergedEffects := importMergeIDs(actionIDs, linkedActions), importMergeIDs(effectIDs, linkedEffects)
+		req.ActionIDs, req.EffectIDs = &mergedActions, &mergedEffects
+		next := monsterFromRequest(req)
+
+		if !exists {
+			next.ID = uuid.New()
+			result.Status = "create"
+			if dryRun {
+				return nil
+			}
+			return tx.Create(&next).Error
+		}
+
+		if importKeepsLocalizedName(current.Name, current.NameEn, next.NameEn) {
+			next.Name = current.Name
+		}
+		if current.Tags != nil {
+			tags := importMergeIDs([]string(*next.Tags), *current.Tags)
+			next.Tags = &tags
+		}
+		next.ID, next.CreatedAt, next.AI, next.Support = current.ID, current.CreatedAt, current.AI, current.Support
+		next.TokenURL, next.TokenStorageID = current.TokenURL, current.TokenStorageID
+		result.Name = next.Name
+		for _, field := range []struct {
+			name     string
+			from, to interface{}
+		}{
+			{"name", current.Name, next.Name}, {"name_en", current.NameEn, next.NameEn},
+			{"description", current.Description, next.Description}, {"size", current.Size, next.Size},
+			{"creature_type", current.CreatureType, next.CreatureType}, {"alignment", current.Alignment, next.Alignment},
+			{"challenge_rating", current.ChallengeRating, next.ChallengeRating}, {"armor_class", current.ArmorClass, next.ArmorClass},
+			{"max_hp", current.MaxHP, next.MaxHP}, {"hit_dice", current.HitDice, next.HitDice}, {"speed", current.Speed, next.Speed},
+			{"initiative_bonus", current.InitiativeBonus, next.InitiativeBonus}, {"proficiency_bonus", current.ProficiencyBonus, next.ProficiencyBonus},
+			{"abilities", current.Abilities, next.Abilities}, {"tags", current.Tags, next.Tags}, {"source", current.Source, next.Source},
+			{"action_ids", current.ActionIDs, next.ActionIDs}, {"effect_ids", current.EffectIDs, next.EffectIDs},
+		} {
+			importDiff(&result.Changes, field.name, field.from, field.to)
+		}
+		if current.DeletedAt.Valid {
+			importDiff(&result.Changes, "deleted", true, false)
+		}
+		result.Status = importEntryStatus(result.Changes)
+		for _, entry := range append(append([]MonsterImportEntry{}, actions...), effects...) {
+			if entry.Status == "create" || entry.Status == "update" {
+				result.Status = "update"
+			}
+		}
+		if dryRun || len(result.Changes) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Save(&next).Error
+	})
+	return result, err
+}
+
+// importMonsterStatBlocks разбирает и применяет статблоки. Ошибка одного
+// статблока не останавливает остальные.
+func importMonsterStatBlocks(db *gorm.DB, blocks []map[string]interface{}, source string, dryRun bool) MonsterImportReport {
+	report := MonsterImportReport{DryRun: dryRun, Results: []MonsterImportResult{}}
+	for i, block := range blocks {
+		plan, err := planMonsterImport(block, source)
+		var result MonsterImportResult
+		if err == nil {
+			result, err = importMonsterPlan(db, plan, dryRun)
+		}
+		if err != nil {
+			if result.Slug == "" {
+				result.Name = fmt.Sprintf("статблок #%d", i+1)
+			}
+			result.Status, result.Error = "failed", err.Error()
+		}
+		switch result.Status {
+		case "create":
+			report.Created++
+		case "update":
+			report.Updated++
+		case "unchanged":
+			report.Unchanged++
+		default:
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// Import — POST /api/monsters/import.
+func (mc *MonsterController) Import(c *gin.Context) {
+	var req MonsterImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса", "details": err.Error()})
+		return
+	}
+	blocks := make([]map[string]interface{}, 0, len(req.StatBlocks))
+	for _, block := range req.StatBlocks {
+		blocks = append(blocks, block)
+	}
+	c.JSON(http.StatusOK, importMonsterStatBlocks(mc.db, blocks, req.Source, req.DryRun))
+}
+
+// readMonsterStatBlocks читает файл статблоков: один объект, массив или
+// страницу Open5e ({"results": [...]}).
+func readMonsterStatBlocks(raw []byte) ([]map[string]interface{}, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	if object, ok := decoded.(map[string]interface{}); ok {
+		if results, ok := object["results"].([]interface{}); ok {
+			decoded = results
+		} else {
+			return []map[string]interface{}{object}, nil
+		}
+	}
+	items, ok := decoded.([]interface{})
+	if !ok {
+		return nil, errors.New("ожидается объект или массив статблоков")
+	}
+	blocks := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("элемент массива — не статблок")
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// runMonsterImportCLI — `import-monsters [-dry-run] [-source S] [-json] файлы...`.
+// Возвращает код выхода: 1 — если хоть один статблок не импортирован.
+func runMonsterImportCLI(db *gorm.DB, args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("import-monsters", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dryRun := flags.Bool("dry-run", false, "показать изменения, ничего не записывая")
+	source := flags.String("source", "", "источник статблоков (по умолчанию — из файла или SRD)")
+	asJSON := flags.Bool("json", false, "вывести отчёт в JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(out, "укажите файлы статблоков")
+		return 2
+	}
+	var blocks []map[string]interface{}
+	for _, path := range flags.Args() {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(out, "%s: %v\n", path, err)
+			return 1
+		}
+		fileBlocks, err := readMonsterStatBlocks(raw)
+		if err != nil {
+			fmt.Fprintf(out, "%s: %v\n", path, err)
+			return 1
+		}
+		blocks = append(blocks, fileBlocks...)
+	}
+
+	report := importMonsterStatBlocks(db, blocks, *source, *dryRun)
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+	} else {
+		for _, result := range report.Results {
+			fmt.Fprintf(out, "%-9s %s (%s)\n", result.Status, result.Name, result.Slug)
+			if result.Error != "" {
+				fmt.Fprintf(out, "          ошибка: %s\n", result.Error)
+			}
+			for _, change := range result.Changes {
+				fmt.Fprintf(out, "          %s: %v → %v\n", change.Field, change.From, change.To)
+			}
+			for _, entry := range append(append([]MonsterImportEntry{}, result.Actions...), result.Effects...) {
+				if entry.Status != "unchanged" {
+					fmt.Fprintf(out, "          %s %s «%s»\n", entry.Status, entry.Kind, entry.Name)
+				}
+			}
+			for _, note := range result.Narrative {
+				fmt.Fprintf(out, "          описание: %s\n", note)
+			}
+		}
+		mode := ""
+		if report.DryRun {
+			mode = " (dry-run)"
+		}
+		fmt.Fprintf(out, "создано %d, обновлено %d, без изменений %d, ошибок %d%s\n", report.Created, report.Updated, report.Unchanged, report.Failed, mode)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
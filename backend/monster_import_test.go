@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decodeStatBlock(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var block map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &block); err != nil {
+		t.Fatalf("bad fixture: %v", err)
+	}
+	return block
+}
+
+func TestPlanMonsterImportOpen5eGoblin(t *testing.T) {
+	block := decodeStatBlock(t, `{
+		"slug": "goblin", "name": "Goblin", "size": "Small", "type": "Humanoid", "subtype": "goblinoid",
+		"alignment": "neutral evil", "armor_class": 15, "hit_points": 7, "hit_dice": "2d6",
+		"speed": {"walk": 30, "climb": 20}, "strength": 8, "dexterity": 14, "constitution": 10,
+		"intelligence": 10, "wisdom": 8, "charisma": 8, "challenge_rating": "1/4",
+		"special_abilities": [{"name": "Nimble Escape", "desc": "The goblin can take the Disengage or Hide action as a bonus action."}],
+		"actions": [
+			{"name": "Scimitar", "desc": "Melee Weapon Attack: +4 to hit, reach 5 ft., one target. Hit: 5 (1d6 + 2) slashing damage."},
+			{"name": "Shortbow", "desc": "Ranged Weapon Attack: +4 to hit, range 80/320 ft., one target. Hit: 5 (1d6 + 2) piercing damage."}
+		]
+	}`)
+	plan, err := planMonsterImport(block, "")
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	monster := plan.Monster
+	if monster.Slug != "goblin" || monster.ChallengeRating != "1/4" || monster.ProficiencyBonus != 2 || monster.Size != "small" || monster.InitiativeBonus != 2 || monster.Speed != 30 {
+		t.Fatalf("факты статблока: %+v", monster)
+	}
+	if monster.Tags == nil || len(*monster.Tags) != 1 || (*monster.Tags)[0] != "goblinoid" {
+		t.Fatalf("подтип становится меткой: %+v", monster.Tags)
+	}
+	if len(plan.Actions) != 2 || len(plan.Effects) != 1 || plan.Actions[0].CardNumber != "MONSTER-ACTION-GOBLIN-SCIMITAR" || plan.Effects[0].CardNumber != "MONSTER-EFFECT-GOBLIN-NIMBLE-ESCAPE" {
+		t.Fatalf("действия и черты: %+v / %+v", plan.Actions, plan.Effects)
+	}
+	for _, action := range plan.Actions {
+		if action.Mechanics == nil {
+			t.Fatalf("атака «%s» получила механику; отчёт: %v", action.Name, plan.Narrative)
+		}
+		if problems := validateMechanicsSchema(*action.Mechanics, mechanicsKindAction); len(problems) > 0 {
+			t.Fatalf("механика «%s» проходит схему: %v", action.Name, problems)
+		}
+	}
+	effect := (*plan.Actions[1].Mechanics)["effects"].([]interface{})[0].(map[string]interface{})
+	hit := effect["on_hit"].([]interface{})[0].(map[string]interface{})
+	if effect["ability"] != "dex" || effect["attack_kind"] != "weapon_ranged" || hit["dice"] != "1d6 + dex" || hit["type"] != "piercing" {
+		t.Fatalf("лук: ловкость, дальняя атака, урон через модификатор: %+v", effect)
+	}
+	if targeting := (*plan.Actions[1].Mechanics)["targeting"].(map[string]interface{}); targeting["range_ft"] != float64(80) {
+		t.Fatalf("дистанция лука: %+v", targeting)
+	}
+	if len(plan.Narrative) != 2 {
+		t.Fatalf("в отчёт — скорость лазания и черта: %v", plan.Narrative)
+	}
+}
+
+func TestPlanMonsterImportSRDBreathWeapon(t *testing.T) {
+	block := decodeStatBlock(t, `{
+		"index": "young-red-dragon", "name": "Young Red Dragon", "size": "Large", "type": "dragon",
+		"armor_class": [{"type": "natural", "value": 18}], "hit_points": 178, "hit_points_roll": "17d10+85",
+		"speed": {"walk": "40 ft.", "fly": "80 ft."}, "strength": 23, "dexterity": 10, "constitution": 21,
+		"intelligence": 14, "wisdom": 11, "charisma": 19, "challenge_rating": 10, "proficiency_bonus": 4,
+		"actions": [
+			{"name": "Multiattack", "desc": "The dragon makes three attacks: one with its bite and two with its claws."},
+			{"name": "Fire Breath", "desc": "The dragon exhales fire in a 30-foot cone. Each creature in that area must make a DC 17 Dexterity saving throw, taking 56 (16d6) fire damage on a failed save, or half as much damage on a successful one.",
+			 "usage": {"type": "recharge on roll", "dice": "1d6", "min_value": 5},
+			 "dc": {"dc_type": {"index": "dex"}, "dc_value": 17, "success_type": "half"},
+			 "damage": [{"damage_type": {"index": "fire"}, "damage_dice": "16d6"}]}
+		],
+		"legendary_actions": [{"name": "Tail Attack", "desc": "The dragon makes a tail attack."}]
+	}`)
+	plan, err := planMonsterImport(block, "SRD 5.1")
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if plan.Monster.ArmorClass != 18 || plan.Monster.ChallengeRating != "10" || plan.Monster.HitDice != "17d10+85" || plan.Monster.Source != "SRD 5.1" {
+		t.Fatalf("факты статблока SRD API: %+v", plan.Monster)
+	}
+	if len(plan.Actions) != 3 || plan.Actions[0].Mechanics != nil || plan.Actions[2].Mechanics != nil {
+		t.Fatalf("мультиатака и легендарное действие — только описание: %+v", plan.Actions)
+	}
+	breath := plan.Actions[1]
+	if breath.Recharge == nil || *breath.Recharge != RechargeCustom || breath.RechargeCustom == nil || *breath.RechargeCustom != "5–6" {
+		t.Fatalf("перезарядка дыхания: %+v", breath)
+	}
+	if breath.Mechanics == nil {
+		t.Fatalf("дыхание получило механику; отчёт: %v", plan.Narrative)
+	}
+	if problems := validateMechanicsSchema(*breath.Mechanics, mechanicsKindAction); len(problems) > 0 {
+		t.Fatalf("механика дыхания проходит схему: %v", problems)
+	}
+	effect := (*breath.Mechanics)["effects"].([]interface{})[0].(map[string]interface{})
+	damage := effect["on_fail"].([]interface{})[0].(map[string]interface{})
+	area := (*breath.Mechanics)["targeting"].(map[string]interface{})["area"].(map[string]interface{})
+	if effect["resolution"] != "save" || effect["ability"] != "dex" || effect["dc"] != float64(17) || damage["on_success"] != "half" || area["kind"] != "cone" {
+		t.Fatalf("спасбросок Ловкости Сл 17, половина урона, конус: %+v / %+v", effect, area)
+	}
+}
+
+func TestImportHitDiceAddsConstitution(t *testing.T) {
+	if got := importHitDice("7d6", 12); got != "7d6+7" {
+		t.Fatalf("7d6 при Телосложении 12: %s", got)
+	}
+	if got := importHitDice("2d6", 10); got != "2d6" {
+		t.Fatalf("без бонуса: %s", got)
+	}
+}
+
+func TestImportSpeedReportsModesInFixedOrder(t *testing.T) {
+	raw := map[string]interface{}{"swim": float64(40), "walk": float64(30), "teleport": "15 ft.", "fly": "60 ft.", "hover": true, "climb": float64(20), "burrow": float64(0), "dig": float64(10)}
+	for run := 0; run < 20; run++ {
+		walk, other := importSpeed(raw)
+		if walk != 30 || strings.Join(other, ", ") != "climb 20 ft., fly 60 ft., swim 40 ft., dig 10 ft., teleport 15 ft." {
+			t.Fatalf("ходьба отдельно, прочие виды в порядке статблока, затем по алфавиту: %d %v", walk, other)
+		}
+	}
+}
+
+func TestReadMonsterStatBlocksLayouts(t *testing.T) {
+	for raw, want := range map[string]int{
+		`{"name": "Goblin"}`:                            1,
+		`[{"name": "Goblin"}, {"name": "Wolf"}]`:        2,
+		`{"count": 2, "results": [{"name": "Goblin"}]}`: 1,
+	} {
+		blocks, err := readMonsterStatBlocks([]byte(raw))
+		if err != nil || len(blocks) != want {
+			t.Fatalf("%s: %d статблоков, %v", raw, len(blocks), err)
+		}
+	}
+	if _, err := readMonsterStatBlocks([]byte(`[1, 2]`)); err == nil {
+		t.Fatal("массив чисел — не статблоки")
+	}
+	if merged := importMergeIDs([]string{"a", "b"}, Properties{"b", "manual"}); len(merged) != 3 || merged[2] != "manual" {
+		t.Fatalf("ручные связи сохраняются после импортированных: %v", merged)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Готовый к печати статблок: ссылки ActionIDs/EffectIDs заменены именами и
+// описаниями, модификаторы и бонус мастерства посчитаны. Один и тот же
+// MonsterStatBlock рендерится в Markdown, в разметку Homebrewery V3 или
+// отдаётся как JSON.
+
+var statBlockFormats = map[string]bool{"markdown": true, "homebrewery": true, "json": true}
+
+var statBlockAbilities = []struct{ key, label string }{
+	{"str", "СИЛ"}, {"dex", "ЛВК"}, {"con", "ТЕЛ"}, {"int", "ИНТ"}, {"wis", "МДР"}, {"cha", "ХАР"},
+}
+
+// MonsterStatBlockAbility — значение характеристики и её модификатор.
+type MonsterStatBlockAbility struct {
+	Ability  string `json:"ability"`
+	Label    string `json:"label"`
+	Score    int    `json:"score"`
+	Modifier int    `json:"modifier"`
+}
+
+// MonsterStatBlockEntry — черта или действие с описанием. Usage — пометка
+// перезарядки («Перезарядка 5–6», «1/день»).
+type MonsterStatBlockEntry struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Usage       string    `json:"usage,omitempty"`
+	Description string    `json:"description"`
+}
+
+// MonsterStatBlock — статблок монстра. Count заполняется только при выгрузке
+// боя: сколько таких существ в нём участвует.
+type MonsterStatBlock struct {
+	ID               uuid.UUID                 `json:"id"`
+	Slug             string                    `json:"slug"`
+	Name             string                    `json:"name"`
+	Count            int                       `json:"count,omitempty"`
+	Size             string                    `json:"size"`
+	CreatureType     string                    `json:"creature_type"`
+	Alignment        string                    `json:"alignment"`
+	ArmorClass       int                       `json:"armor_class"`
+	HitPoints        int                       `json:"hit_points"`
+	HitDice          string                    `json:"hit_dice,omitempty"`
+	Speed            int                       `json:"speed"`
+	InitiativeBonus  int                       `json:"initiative_bonus"`
+	Abilities        []MonsterStatBlockAbility `json:"abilities"`
+	ChallengeRating  string                    `json:"challenge_rating"`
+	XP               int                       `json:"xp"`
+	ProficiencyBonus int                       `json:"proficiency_bonus"`
+	Description      string                    `json:"description,omitempty"`
+	Traits           []MonsterStatBlockEntry   `json:"traits"`
+	Actions          []MonsterStatBlockEntry   `json:"actions"`
+	BonusActions     []MonsterStatBlockEntry   `json:"bonus_actions"`
+	Reactions        []MonsterStatBlockEntry   `json:"reactions"`
+	FreeActions      []MonsterStatBlockEntry   `json:"free_actions"`
+	Source           string                    `json:"source,omitempty"`
+}
+
+// challengeRatingProficiencyBonus — бонус мастерства по показателю
+// опасности: +2 до ПО 4, затем +1 за каждые четыре ступени.
+func challengeRatingProficiencyBonus(challengeRating string) int {
+	key, ok := challengeRatingKey(challengeRating)
+	cr, err := strconv.Atoi(key)
+	if !ok || err != nil || cr < 5 {
+		return 2
+	}
+	return 2 + (cr-1)/4
+}
+
+func statBlockUsage(action Action) string {
+	if action.Recharge == nil {
+		return ""
+	}
+	switch *action.Recharge {
+	case RechargeCustom:
+		if action.RechargeCustom != nil && strings.TrimSpace(*action.RechargeCustom) != "" {
+			return "Перезарядка " + strings.TrimSpace(*action.RechargeCustom)
+		}
+	case RechargePerTurn:
+		return "1/ход"
+	case RechargePerBattle:
+		return "1/бой"
+	case RechargeShortRest:
+		return "1/короткий отдых"
+	case RechargeLongRest:
+		return "1/день"
+	}
+	return ""
+}
+
+// loadMonsterStatBlocks собирает статблоки одним запросом на действия и
+// одним на эффекты. Удалённые связанные строки пропускаются.
+func loadMonsterStatBlocks(db *gorm.DB, monsters []Monster) ([]MonsterStatBlock, error) {
+	var actionIDs, effectIDs []string
+	for _, monster := range monsters {
+		if monster.ActionIDs != nil {
+			actionIDs = append(actionIDs, *monster.ActionIDs...)
+		}
+		if monster.EffectIDs != nil {
+			effectIDs = append(effectIDs, *monster.EffectIDs...)
+		}
+	}
+	actions := map[string]Action{}
+	if len(actionIDs) > 0 {
+		var rows []Action
+		if err := db.Where("id IN ?", actionIDs).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("load statblock actions: %w", err)
+		}
+		for _, row := range rows {
+			actions[row.ID.String()] = row
+		}
+	}
+	effects := map[string]Effect{}
+	if len(effectIDs) > 0 {
+		var rows []Effect
+		if err := db.Where("id IN ?", effectIDs).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("load statblock effects: %w", err)
+		}
+		for _, row := range rows {
+			effects[row.ID.String()] = row
+		}
+	}
+
+	blocks := make([]MonsterStatBlock, 0, len(monsters))
+	for _, monster := range monsters {
+		blocks = append(blocks, buildMonsterStatBlock(monster, actions, effects))
+	}
+	return blocks, nil
+}
+
+// buildMonsterStatBlock — статблок по монстру и уже загруженным строкам.
+func buildMonsterStatBlock(monster Monster, actions map[string]Action, effects map[string]Effect) MonsterStatBlock {
+	key, _ := challengeRatingKey(monster.ChallengeRating)
+	block := MonsterStatBlock{
+		ID: monster.ID, Slug: monster.Slug, Name: monster.Name, Size: monster.Size,
+		CreatureType: monster.CreatureType, Alignment: monster.Alignment, ArmorClass: monster.ArmorClass,
+		HitPoints: monster.MaxHP, HitDice: monster.HitDice, Speed: monster.Speed,
+		InitiativeBonus: monster.InitiativeBonus, ChallengeRating: monster.ChallengeRating,
+		XP: challengeRatingXP[key], ProficiencyBonus: challengeRatingProficiencyBonus(monster.ChallengeRating),
+		Description: monster.Description, Source: monster.Source,
+		Traits: []MonsterStatBlockEntry{}, Actions: []MonsterStatBlockEntry{}, BonusActions: []MonsterStatBlockEntry{},
+		Reactions: []MonsterStatBlockEntry{}, FreeActions: []MonsterStatBlockEntry{},
+	}
+	for _, ability := range statBlockAbilities {
+		score := 10
+		if monster.Abilities != nil {
+			if value, ok := importNumber((*monster.Abilities)[ability.key]); ok {
+				score = int(value)
+			}
+		}
+		block.Abilities = append(block.Abilities, MonsterStatBlockAbility{
+			Ability: ability.key, Label: ability.label, Score: score,
+			Modifier: int(math.Floor(float64(score-10) / 2)),
+		})
+	}
+	if monster.EffectIDs != nil {
+		for _, id := range *monster.EffectIDs {
+			if effect, ok := effects[id]; ok {
+				block.Traits = append(block.Traits, MonsterStatBlockEntry{ID: effect.ID, Name: effect.Name, Description: effect.Description})
+			}
+		}
+	}
+	if monster.ActionIDs != nil {
+		for _, id := range *monster.ActionIDs {
+			action, ok := actions[id]
+			if !ok {
+				continue
+			}
+			entry := MonsterStatBlockEntry{ID: action.ID, Name: action.Name, Usage: statBlockUsage(action), Description: action.Description}
+			resource := ResourceAction
+			if len(action.Resource) > 0 {
+				resource = action.Resource[0]
+			}
+			switch resource {
+			case ResourceBonusAction:
+				block.BonusActions = append(block.BonusActions, entry)
+			case ResourceReaction:
+				block.Reactions = append(block.Reactions, entry)
+			case ResourceFreeAction:
+				block.FreeActions = append(block.FreeActions, entry)
+			default:
+				block.Actions = append(block.Actions, entry)
+			}
+		}
+	}
+	return block
+}
+
+func statBlockSigned(value int) string { return fmt.Sprintf("%+d", value) }
+
+func statBlockSubtitle(block MonsterStatBlock) string {
+	subtitle := strings.TrimSpace(block.Size + " " + block.CreatureType)
+	if block.Alignment != "" {
+		subtitle += ", " + block.Alignment
+	}
+	return subtitle
+}
+
+func statBlockHitPoints(block MonsterStatBlock) string {
+	if block.HitDice != "" {
+		return fmt.Sprintf("%d (%s)", block.HitPoints, block.HitDice)
+	}
+	return strconv.Itoa(block.HitPoints)
+}
+
+func statBlockTitle(block MonsterStatBlock) string {
+	if block.Count > 1 {
+		return fmt.Sprintf("%s ×%d", block.Name, block.Count)
+	}
+	return block.Name
+}
+
+// statBlockSections — разделы действий в порядке статблока.
+func statBlockSections(block MonsterStatBlock) []struct {
+	title   string
+	entries []MonsterStatBlockEntry
+} {
+	return []struct {
+		title   string
+		entries []MonsterStatBlockEntry
+	}{
+		{"Действия", block.Actions},
+		{"Бонусные действия", block.BonusActions},
+		{"Реакции", block.Reactions},
+		{"Свободные действия", block.FreeActions},
+	}
+}
+
+func writeStatBlockEntries(b *strings.Builder, entries []MonsterStatBlockEntry) {
+	for _, entry := range entries {
+		name := entry.Name
+		if entry.Usage != "" {
+			name += " (" + entry.Usage + ")"
+		}
+		fmt.Fprintf(b, "***%s.*** %s\n\n", name, strings.TrimSpace(entry.Description))
+	}
+}
+
+func writeStatBlockAbilityTable(b *strings.Builder, block MonsterStatBlock) {
+	var header, align, values []string
+	for _, ability := range block.Abilities {
+		header = append(header, ability.Label)
+		align = append(align, ":---:")
+		values = append(values, fmt.Sprintf("%d (%s)", ability.Score, statBlockSigned(ability.Modifier)))
+	}
+	fmt.Fprintf(b, "| %s |\n|%s|\n| %s |\n", strings.Join(header, " | "), strings.Join(align, "|"), strings.Join(values, " | "))
+}
+
+// renderStatBlockMarkdown — статблок в обычном Markdown.
+func renderStatBlockMarkdown(block MonsterStatBlock) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n*%s*\n\n", statBlockTitle(block), statBlockSubtitle(block))
+	fmt.Fprintf(&b, "**Класс защиты** %d  \n**Хиты** %s  \n**Скорость** %d фт.  \n**Инициатива** %s\n\n",
+		block.ArmorClass, statBlockHitPoints(block), block.Speed, statBlockSigned(block.InitiativeBonus))
+	writeStatBlockAbilityTable(&b, block)
+	fmt.Fprintf(&b, "\n**Показатель опасности** %s (%d опыта)  \n**Бонус мастерства** %s\n\n",
+		block.ChallengeRating, block.XP, statBlockSigned(block.ProficiencyBonus))
+	if len(block.Traits) > 0 {
+		b.WriteString("### Черты\n\n")
+		writeStatBlockEntries(&b, block.Traits)
+	}
+	for _, section := range statBlockSections(block) {
+		if len(section.entries) > 0 {
+			fmt.Fprintf(&b, "### %s\n\n", section.title)
+			writeStatBlockEntries(&b, section.entries)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// renderStatBlockHomebrewery — блок {{monster,frame ...}} разметки
+// Homebrewery V3.
+func renderStatBlockHomebrewery(block MonsterStatBlock) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "{{monster,frame\n## %s\n*%s*\n___\n", statBlockTitle(block), statBlockSubtitle(block))
+	fmt.Fprintf(&b, "**Класс защиты** :: %d\n**Хиты** :: %s\n**Скорость** :: %d фт.\n**Инициатива** :: %s\n___\n",
+		block.ArmorClass, statBlockHitPoints(block), block.Speed, statBlockSigned(block.InitiativeBonus))
+	writeStatBlockAbilityTable(&b, block)
+	fmt.Fprintf(&b, "___\n**Показатель опасности** :: %s (%d опыта)\n**Бонус мастерства** :: %s\n___\n",
+		block.ChallengeRating, block.XP, statBlockSigned(block.ProficiencyBonus))
+	writeStatBlockEntries(&b, block.Traits)
+	for _, section := range statBlockSections(block) {
+		if len(section.entries) > 0 {
+			fmt.Fprintf(&b, "### %s\n", section.title)
+			writeStatBlockEntries(&b, section.entries)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n}}\n"
+}
+
+// writeStatBlocks отвечает статблоками в запрошенном формате. Текстовые
+// форматы склеивают блоки через пустую строку.
+func writeStatBlocks(c *gin.Context, format string, blocks []MonsterStatBlock, single bool) {
+	switch format {
+	case "json":
+		if single {
+			c.JSON(http.StatusOK, blocks[0])
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"statblocks": blocks})
+	default:
+		render := renderStatBlockMarkdown
+		if format == "homebrewery" {
+			render = renderStatBlockHomebrewery
+		}
+		parts := make([]string, 0, len(blocks))
+		for _, block := range blocks {
+			parts = append(parts, render(block))
+		}
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(strings.Join(parts, "\n")))
+	}
+}
+
+// statBlockFormat — формат из ?format=, по умолчанию markdown.
+func statBlockFormat(c *gin.Context) (string, bool) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "markdown")))
+	if !statBlockFormats[format] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неизвестный формат статблока", "details": "markdown, homebrewery или json"})
+		return "", false
+	}
+	return format, true
+}
+
+// StatBlock — GET /api/monsters/:id/statblock?format=markdown|homebrewery|json.
+func (mc *MonsterController) StatBlock(c *gin.Context) {
+	format, ok := statBlockFormat(c)
+	if !ok {
+		return
+	}
+	var monster Monster
+	id := c.Param("id")
+	query := mc.db.Where("slug = ?", id)
+	if parsed, err := uuid.Parse(id); err == nil {
+		query = mc.db.Where("id = ?", parsed)
+	}
+	if err := query.First(&monster).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Монстр не найден"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения монстра"})
+		return
+	}
+	blocks, err := loadMonsterStatBlocks(mc.db, []Monster{monster})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сборки статблока"})
+		return
+	}
+	writeStatBlocks(c, format, blocks, true)
+}
+
+// encounterStatBlockCounts — статблоки участников боя в порядке инициативы и
+// число копий каждого. Скрытых существ видит только владелец боя; участники
+// без monsterId (персонажи, ручные существа) пропускаются.
+func encounterStatBlockCounts(state map[string]interface{}, includeHidden bool) ([]uuid.UUID, map[uuid.UUID]int) {
+	var order []uuid.UUID
+	counts := map[uuid.UUID]int{}
+	combatants, _ := combatantMaps(state)
+	for _, combatant := range combatants {
+		if hidden, _ := combatant["hidden"].(bool); hidden && !includeHidden {
+			continue
+		}
+		raw, _ := combatant["monsterId"].(string)
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			continue
+		}
+		if counts[id] == 0 {
+			order = append(order, id)
+		}
+		counts[id]++
+	}
+	return order, counts
+}
+
+// StatBlocks — GET /api/encounters/:id/statblocks?format=...: статблоки
+// всех существ боя одной выгрузкой.
+func (ec *EncounterController) StatBlocks(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный id"})
+		return
+	}
+	var enc Encounter
+	if err := ec.db.First(&enc, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "бой не найден"})
+		return
+	}
+	caller, ok := requireEncounterParticipant(c, &enc)
+	if !ok {
+		return
+	}
+	format, ok := statBlockFormat(c)
+	if !ok {
+		return
+	}
+	order, counts := encounterStatBlockCounts(stateOfEncounter(&enc), caller == enc.OwnerUserID)
+	var monsters []Monster
+	if len(order) > 0 {
+		if err := ec.db.Where("id IN ?", order).Find(&monsters).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось собрать статблоки"})
+			return
+		}
+	}
+	byID := make(map[uuid.UUID]Monster, len(monsters))
+	for _, monster := range monsters {
+		byID[monster.ID] = monster
+	}
+	ordered := make([]Monster, 0, len(monsters))
+	for _, monsterID := range order {
+		if monster, ok := byID[monsterID]; ok {
+			ordered = append(ordered, monster)
+		}
+	}
+	blocks, err := loadMonsterStatBlocks(ec.db, ordered)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "не удалось собрать статблоки"})
+		return
+	}
+	for i := range blocks {
+		blocks[i].Count = counts[blocks[i].ID]
+	}
+	writeStatBlocks(c, format, blocks, false)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildMonsterStatBlockResolvesReferences(t *testing.T) {
+	recharge, custom := RechargeCustom, "5–6"
+	scimitar := Action{ID: uuid.New(), Name: "Скимитар", Description: "Рукопашная атака: +4 к попаданию.", Resource: ActionResources{ResourceAction}}
+	breath := Action{ID: uuid.New(), Name: "Огненное дыхание", Description: "Конус 30 фт.", Resource: ActionResources{ResourceAction}, Recharge: &recharge, RechargeCustom: &custom}
+	escape := Action{ID: uuid.New(), Name: "Ловкий побег", Description: "Отход или Засада.", Resource: ActionResources{ResourceBonusAction}}
+	trait := Effect{ID: uuid.New(), Name: "Тёмное зрение", Description: "60 фт."}
+	abilities := JSONMap{"str": float64(8), "dex": float64(14), "con": float64(10), "int": float64(10), "wis": float64(8), "cha": float64(8)}
+	actionIDs := Properties{scimitar.ID.String(), breath.ID.String(), escape.ID.String(), uuid.NewString()}
+	effectIDs := Properties{trait.ID.String()}
+	monster := Monster{ID: uuid.New(), Name: "Гоблин", Size: "small", CreatureType: "humanoid", Alignment: "нейтрально-злой",
+		ChallengeRating: "1/4", ArmorClass: 15, MaxHP: 7, HitDice: "2d6", Speed: 30, Abilities: &abilities,
+		ActionIDs: &actionIDs, EffectIDs: &effectIDs}
+
+	block := buildMonsterStatBlock(monster,
+		map[string]Action{scimitar.ID.String(): scimitar, breath.ID.String(): breath, escape.ID.String(): escape},
+		map[string]Effect{trait.ID.String(): trait})
+	if block.XP != 50 || block.ProficiencyBonus != 2 || block.Abilities[1].Modifier != 2 || block.Abilities[0].Modifier != -1 {
+		t.Fatalf("опыт, бонус мастерства и модификаторы: %+v", block)
+	}
+	if len(block.Actions) != 2 || len(block.BonusActions) != 1 || len(block.Traits) != 1 || block.Actions[1].Usage != "Перезарядка 5–6" {
+		t.Fatalf("удалённое действие пропущено, разделы по ресурсу: %+v", block)
+	}
+
+	markdown := renderStatBlockMarkdown(block)
+	for _, want := range []string{"## Гоблин", "**Хиты** 7 (2d6)", "| 8 (-1) | 14 (+2) |", "(50 опыта)", "### Бонусные действия", "***Огненное дыхание (Перезарядка 5–6).*** Конус 30 фт."} {
+		if !strings.Contains(markdown, want) {
+			t.Fatalf("в Markdown нет %q:\n%s", want, markdown)
+		}
+	}
+	homebrewery := renderStatBlockHomebrewery(block)
+	if !strings.HasPrefix(homebrewery, "{{monster,frame\n## Гоблин") || !strings.HasSuffix(homebrewery, "}}\n") || !strings.Contains(homebrewery, "**Класс защиты** :: 15") {
+		t.Fatalf("блок Homebrewery:\n%s", homebrewery)
+	}
+}
+
+func TestChallengeRatingProficiencyBonus(t *testing.T) {
+	for cr, want := range map[string]int{"1/8": 2, "4": 2, "5": 3, "10": 4, "17": 6, "30": 9} {
+		if got := challengeRatingProficiencyBonus(cr); got != want {
+			t.Fatalf("ПО %s: %d, ожидалось %d", cr, got, want)
+		}
+	}
+}
+
+func TestEncounterStatBlockCountsHidesHidden(t *testing.T) {
+	wolf, boss := uuid.New(), uuid.New()
+	state := map[string]interface{}{"combatants": []interface{}{
+		map[string]interface{}{"actorId": "a", "monsterId": wolf.String()},
+		map[string]interface{}{"actorId": "b", "monsterId": boss.String(), "hidden": true},
+		map[string]interface{}{"actorId": "c", "monsterId": wolf.String()},
+		map[string]interface{}{"actorId": "d", "characterId": uuid.NewString()},
+	}}
+	order, counts := encounterStatBlockCounts(state, false)
+	if len(order) != 1 || counts[wolf] != 2 {
+		t.Fatalf("игрок видит только открытых волков: %v %v", order, counts)
+	}
+	if order, _ := encounterStatBlockCounts(state, true); len(order) != 2 {
+		t.Fatalf("владелец видит и скрытого: %v", order)
+	}
+}
@@ -2,10 +2,7 @@ package main
 
 import (
 	"encoding/json"
-	"math/rand"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -27,52 +24,13 @@ type ShopData struct {
 	Vendors map[string][]CardResponse `json:"vendors"`
 }
 
-// rollDice parses expressions like "1d10+6", "1d4-1", "1d2-1"
-func rollDice(expr string) int {
-	expr = strings.TrimSpace(expr)
-	// Default fallback
-	total := 0
-	// Very small parser: aBdC where B sides, A dice count (assume 1), optional +/- C
-	parts := strings.Split(expr, "d")
-	if len(parts) != 2 {
+// rollShopCount бросает количество товаров редкости. Выражения правил
+// проверены до сборки магазина, поэтому ошибка здесь невозможна.
+func rollShopCount(rng diceRNG, expr string) int {
+	total, err := rollDiceTotal(rng, expr)
+	if err != nil || total < 0 {
 		return 0
 	}
-	// dice count (often 1)
-	diceCount := 1
-	if parts[0] != "" {
-		if v, err := strconv.Atoi(parts[0]); err == nil {
-			diceCount = v
-		}
-	}
-	rest := parts[1]
-	sides := 0
-	modifier := 0
-	if strings.Contains(rest, "+") {
-		sub := strings.Split(rest, "+")
-		if len(sub) == 2 {
-			sides, _ = strconv.Atoi(strings.TrimSpace(sub[0]))
-			modifier, _ = strconv.Atoi(strings.TrimSpace(sub[1]))
-		}
-	} else if strings.Contains(rest, "-") {
-		sub := strings.Split(rest, "-")
-		if len(sub) == 2 {
-			sides, _ = strconv.Atoi(strings.TrimSpace(sub[0]))
-			m, _ := strconv.Atoi(strings.TrimSpace(sub[1]))
-			modifier = -m
-		}
-	} else {
-		sides, _ = strconv.Atoi(strings.TrimSpace(rest))
-	}
-	if sides <= 0 {
-		return 0
-	}
-	for i := 0; i < diceCount; i++ {
-		total += rand.Intn(sides) + 1
-	}
-	total += modifier
-	if total < 0 {
-		total = 0
-	}
 	return total
 }
 
@@ -112,7 +70,7 @@ func rarityGEUncommon(r Rarity) bool {
 
 // CreateShop generates a shop assortment and persists it with a slug
 func (sc *ShopController) CreateShop(c *gin.Context) {
-	rand.Seed(time.Now().UnixNano())
+	rng := newDiceRNG(0)
 	if err := sc.db.Exec(
 		"DELETE FROM shops WHERE created_at < CURRENT_TIMESTAMP - INTERVAL '30 days'",
 	).Error; err != nil {
@@ -195,6 +153,15 @@ func (sc *ShopController) CreateShop(c *gin.Context) {
 		"artifact":  "1d2-1",
 	}
 
+	for _, rules := range []map[string]string{baseRules, magicRules, ravvaRules} {
+		for rarity, expr := range rules {
+			if _, err := parseDiceExpression(expr); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка правил магазина", "details": rarity + ": " + err.Error()})
+				return
+			}
+		}
+	}
+
 	// Helper to select by rarity from a pool
 	pickByRarity := func(pool []*Card, r Rarity, count int) []CardResponse {
 		res := make([]CardResponse, 0)
@@ -209,7 +176,7 @@ func (sc *ShopController) CreateShop(c *gin.Context) {
 			}
 		}
 		// random sample w/o replacement
-		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		shuffleWithDice(rng, len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
 		if count > len(candidates) {
 			count = len(candidates)
 		}
@@ -225,23 +192,23 @@ func (sc *ShopController) CreateShop(c *gin.Context) {
 			return out
 		}
 		if expr, ok := rules["common"]; ok {
-			count := rollDice(expr) * multiplier
+			count := rollShopCount(rng, expr) * multiplier
 			out = append(out, pickByRarity(pool, RarityCommon, count)...)
 		}
 		if expr, ok := rules["uncommon"]; ok {
-			count := rollDice(expr) * multiplier
+			count := rollShopCount(rng, expr) * multiplier
 			out = append(out, pickByRarity(pool, RarityUncommon, count)...)
 		}
 		if expr, ok := rules["rare"]; ok {
-			count := rollDice(expr) * multiplier
+			count := rollShopCount(rng, expr) * multiplier
 			out = append(out, pickByRarity(pool, RarityRare, count)...)
 		}
 		if expr, ok := rules["very_rare"]; ok {
-			count := rollDice(expr) * multiplier
+			count := rollShopCount(rng, expr) * multiplier
 			out = append(out, pickByRarity(pool, RarityVeryRare, count)...)
 		}
 		if expr, ok := rules["artifact"]; ok {
-			count := rollDice(expr) * multiplier
+			count := rollShopCount(rng, expr) * multiplier
 			out = append(out, pickByRarity(pool, RarityArtifact, count)...)
 		}
 		return out
@@ -161,6 +161,10 @@ func (sc *SpellController) CreateSpell(c *gin.Context) {
 		return
 	}
 
+	if rejectInvalidMechanics(c, req.Mechanics, mechanicsKindSpell) {
+		return
+	}
+
 	// Проверка уникальности card_number (ID заклинания)
 	cardNumber := req.CardNumber
 	if cardNumber == "" {
@@ -257,6 +261,9 @@ func (sc *SpellController) UpdateSpell(c *gin.Context) {
 	if rejectLockedMechanicsMutation(c, spell.Support, spell.Mechanics, req.Mechanics) {
 		return
 	}
+	if rejectInvalidMechanicsUpdate(c, spell.Mechanics, req.Mechanics, mechanicsKindSpell) {
+		return
+	}
 
 	// Обновление полей
 	if req.Name != "" {
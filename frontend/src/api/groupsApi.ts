@@ -1,5 +1,5 @@
 import { apiClient } from './client';
-import type { Group, GroupMember, CreateGroupRequest, JoinGroupRequest } from '../types';
+import type { Group, GroupMember, CreateGroupRequest, JoinGroupRequest, UpdateGroupRulesRequest } from '../types';
 
 export const groupsApi = {
   // Создание группы
@@ -32,6 +32,12 @@ export const groupsApi = {
     return response.data;
   },
 
+  // Правила группы (только ДМ)
+  updateGroupRules: async (id: string, data: UpdateGroupRulesRequest): Promise<Group> => {
+    const response = await apiClient.put<Group>(`/api/groups/${id}/rules`, data);
+    return response.data;
+  },
+
   // Получение участников группы
   getGroupMembers: async (id: string): Promise<GroupMember[]> => {
     const response = await apiClient.get<GroupMember[]>(`/api/groups/${id}/members`);
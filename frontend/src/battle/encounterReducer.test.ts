@@ -27,6 +27,14 @@ describe('applyEncounterEvent (зеркало серверного applyOps)', (
     expect(r.combatants.map((x) => x.actorId)).toEqual(['b']);
   });
 
+  it('несколько патчей одного участника применяются по порядку', () => {
+    const r = applyEncounterEvent(st([c('a', 20)]), {
+      seq: 1, patches: [{ actor_id: 'a', set: { hp: 12, temp: 3 } }, { actor_id: 'a', set: { hp: 9 } }],
+    });
+    expect(r.combatants[0].hp).toBe(9);
+    expect(r.combatants[0].temp).toBe(3);
+  });
+
   it('round/active_index обновляются', () => {
     const r = applyEncounterEvent(st([]), { seq: 1, round: 3, active_index: 2 });
     expect(r.round).toBe(3);
@@ -42,6 +50,13 @@ describe('applyEncounterEvent (зеркало серверного applyOps)', (
     expect(r.round).toBe(2);
   });
 
+  it('order — переставляет участников, не названные остаются в конце', () => {
+    const r = applyEncounterEvent(st([c('a', 5), c('b', 5), c('cc', 5)]), {
+      seq: 1, add: [c('d', 5)], order: ['d', 'b', 'a'],
+    });
+    expect(r.combatants.map((x) => x.actorId)).toEqual(['d', 'b', 'a', 'cc']);
+  });
+
   it('normalizeState — дефолты при кривом jsonb', () => {
     expect(normalizeState(null)).toEqual({ combatants: [], round: 1, activeIndex: 0 });
     expect(normalizeState({ combatants: [c('a', 5)] }).round).toBe(1);
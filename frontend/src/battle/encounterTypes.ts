@@ -26,6 +26,12 @@ export interface PendingSave {
   onFail: SaveOutcome;
   onSuccess: SaveOutcome;
   avoidsConditions?: string[]; // состояния, налагаемые при провале — цель применит condition-scoped модификаторы спаса
+  /** Спасбросок концентрации, открытый сервером на урон: разрешается только на сервере
+   *  (POST /encounters/:id/concentration-save), провал снимает эффекты заклинания со всех. */
+  concentration?: { casterActorId: string; spell: string; spellId?: string };
+  /** Спасбросок, открытый сервером (POST /encounters/:id/saves): бросок и применение
+   *  ветки исхода — только на сервере (POST /encounters/:id/saves/resolve). */
+  serverRolled?: boolean;
 }
 
 /** Входящая атака, ПОПАВШАЯ по цели (онлайн-бой) — доставляется цели, чтобы предложить реакцию
@@ -61,6 +67,15 @@ export interface Combatant {
   pendingAttacks?: PendingAttack[];
   avatarUrl?: string;
   initiative?: number;
+  /** id потраченных перезаряжаемых действий существа (ведёт сервер). */
+  spentActions?: string[];
+  /** Статблок существа (каталог монстров). */
+  monsterId?: string;
+  /** Скорость и действия статблока — у существ из заготовки. */
+  speed?: number;
+  actionIds?: string[];
+  /** Существо заготовки скрыто до раскрытия мастером (патч hidden: false). */
+  hidden?: boolean;
   /** Explicit marker for legacy/manual enrollment paths; never grants rules authority. */
   provenance?: string;
 }
@@ -78,6 +93,43 @@ export interface Encounter {
   member_user_ids?: string[];
   state: EncounterState;
   seq: number;
+  /** Сложность по текущим участникам (приходит с GET /api/encounters/:id). */
+  difficulty?: EncounterDifficulty;
+  /** Бой завершён мастером; операции больше не принимаются. */
+  concluded_at?: string | null;
+  conclusion?: EncounterConclusion | null;
+}
+
+/** Итог боя: опыт за побеждённых, добыча и выданные предметы. */
+export interface EncounterConclusion {
+  defeated: { actor_id: string; name: string; challenge_rating: string; xp: number }[];
+  total_xp: number;
+  xp_awards: { character_id: string; name: string; xp: number; total: number }[];
+  seed?: number;
+  treasure: { card_id: string; name: string; rarity: string }[];
+  item_awards: EncounterItemAward[];
+}
+
+export interface EncounterItemAward {
+  character_id: string;
+  card_id: string;
+  qty?: number;
+  name?: string;
+}
+
+/** Оценка сложности: 2024 — бюджет low/moderate/high, 2014 — скорректированный опыт
+ *  против порогов easy/medium/hard/deadly. */
+export interface EncounterDifficulty {
+  method: '2024' | '2014';
+  rating: 'low' | 'moderate' | 'high' | 'trivial' | 'easy' | 'medium' | 'hard' | 'deadly';
+  total_xp: number;
+  party_size: number;
+  monster_count: number;
+  budget: Record<string, number>;
+  over_budget?: boolean;
+  adjusted_xp?: number;
+  multiplier?: number;
+  unrated?: string[];
 }
 
 /** Запись журнала боя: message — строка для общего журнала; targetCharacterId+payload —
@@ -97,6 +149,8 @@ export interface EncounterEvent {
   remove?: string[];
   round?: number;
   active_index?: number;
+  /** Новый порядок хода (actorId); не названные остаются после названных. */
+  order?: string[];
   events?: unknown[];
   log?: BattleLogEntry[];
 }
@@ -127,17 +181,45 @@ export function applyEncounterEvent(state: EncounterState, ev: EncounterEvent):
     combatants = combatants.filter((c) => !rm.has(c.actorId));
   }
   if (ev.patches?.length) {
-    combatants = combatants.map((c) => {
-      const p = ev.patches!.find((x) => x.actor_id === c.actorId);
-      return p ? ({ ...c, ...(p.set ?? {}) } as Combatant) : c;
-    });
+    // Несколько патчей одного участника применяются по порядку, как на сервере.
+    combatants = combatants.map((c) => ev.patches!
+      .filter((x) => x.actor_id === c.actorId)
+      .reduce((acc, p) => ({ ...acc, ...(p.set ?? {}) } as Combatant), c));
   }
   if (ev.add?.length) {
     combatants = [...combatants, ...ev.add];
   }
+  if (ev.order?.length) {
+    const position = new Map<string, number>();
+    ev.order.forEach((actorId, i) => { if (!position.has(actorId)) position.set(actorId, i); });
+    const listed = combatants.filter((c) => position.has(c.actorId));
+    listed.sort((a, b) => position.get(a.actorId)! - position.get(b.actorId)!);
+    combatants = [...listed, ...combatants.filter((c) => !position.has(c.actorId))];
+  }
   return {
     combatants,
     round: typeof ev.round === 'number' ? ev.round : state.round,
     activeIndex: typeof ev.active_index === 'number' ? ev.active_index : state.activeIndex,
   };
 }
+
+/** Строка группы заготовки: статблок, число копий, режим хитов, начальные состояния. */
+export interface EncounterTemplateMonster {
+  monster_id: string;
+  count: number;
+  hp_mode?: 'average' | 'rolled';
+  conditions?: string[];
+  hidden?: boolean;
+}
+
+/** Заготовка столкновения мастера; group_id — группа, мастерам которой она видна. */
+export interface EncounterTemplate {
+  id: string;
+  name: string;
+  owner_user_id: string;
+  group_id?: string | null;
+  notes: string;
+  monster_groups: { name: string; monsters: EncounterTemplateMonster[] }[];
+  created_at: string;
+  updated_at: string;
+}
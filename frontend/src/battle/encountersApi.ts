@@ -1,7 +1,8 @@
 /** REST-клиент онлайн-боёв + аутентифицированный SSE поверх fetch streaming. */
 import { API_BASE_URL, apiClient } from '../api/client';
 import { readPersistedAuthToken, signalUnauthorized } from '../api/authSession';
-import type { Encounter, EncounterState, Combatant, EncounterEvent, BattleLogEntry } from './encounterTypes';
+import type { Encounter, EncounterState, Combatant, EncounterEvent, BattleLogEntry, EncounterDifficulty, EncounterTemplate, EncounterConclusion, EncounterItemAward } from './encounterTypes';
+import type { MonsterStatBlock } from '../monsters/types';
 
 export interface ApplyOp {
   patches?: { actor_id: string; set?: Record<string, unknown> }[];
@@ -9,6 +10,7 @@ export interface ApplyOp {
   remove?: string[];
   round?: number;
   active_index?: number;
+  order?: string[];
   events?: unknown[];
   /** Структурированный журнал: строки боя + адресные записи в журналы персонажей. */
   log?: BattleLogEntry[];
@@ -19,6 +21,99 @@ export interface EncounterApplyResult {
   state: EncounterState;
 }
 
+/** Серверная атака: источник — ровно одно из cardId (экипированное оружие) или actionId. */
+export interface EncounterAttackInput {
+  attackerId: string;
+  targetId: string;
+  cardId?: string;
+  actionId?: string;
+  advantage?: 'none' | 'advantage' | 'disadvantage';
+  /** false — не применять свойство искусности оружия в этой атаке. */
+  useMastery?: boolean;
+}
+
+/** Бросок инициативы: без actorIds — за всех с началом первого раунда,
+ * иначе только названные опоздавшие встают в идущий порядок. */
+export interface EncounterInitiativeInput {
+  actorIds?: string[];
+  advantage?: Record<string, 'none' | 'advantage' | 'disadvantage'>;
+}
+
+/** Ход существа по профилю ИИ. Без execute — только предложение; seed из
+ * предложения с тем же expectedSeq исполняет ровно показанный ход. */
+export interface EncounterMonsterTurnInput {
+  actorId: string;
+  execute?: boolean;
+  seed?: number;
+  actionId?: string;
+  targetId?: string;
+}
+
+export interface EncounterMonsterTurnPlan {
+  actor_id: string;
+  action_id?: string;
+  action_name?: string;
+  target_id?: string;
+  retreat: boolean;
+  recharged?: string[];
+  rationale: string[];
+  seed: number;
+}
+
+export interface EncounterMonsterTurnResult {
+  seq: number;
+  state?: EncounterState;
+  plan: EncounterMonsterTurnPlan;
+  op: ApplyOp;
+}
+
+/** Оценка планируемого столкновения: отряд — ровно одно из characterIds или groupId. */
+export interface EncounterDifficultyInput {
+  monsters: { monsterId: string; count?: number }[];
+  characterIds?: string[];
+  groupId?: string;
+  method?: '2024' | '2014';
+}
+
+/** Подбор столкновения из каталога: отряд — ровно одно из characterIds или groupId. */
+export interface EncounterGenerateInput {
+  characterIds?: string[];
+  groupId?: string;
+  difficulty: 'low' | 'moderate' | 'high';
+  creatureTypes?: string[];
+  /** Существо должно нести все перечисленные метки. */
+  tags?: string[];
+  seed?: number;
+  count?: number;
+  maxMonsters?: number;
+  /** Номер состава, который сразу превращается в новый бой. */
+  spawn?: number;
+  name?: string;
+  hp?: 'average' | 'rolled';
+}
+
+export interface EncounterLineup {
+  monsters: { monster_id: string; name: string; challenge_rating: string; xp: number; count: number }[];
+  total_xp: number;
+  difficulty: EncounterDifficulty;
+}
+
+export interface EncounterGenerateResult {
+  seed: number;
+  lineups: EncounterLineup[];
+  /** Есть только при spawn. */
+  encounter?: Encounter;
+}
+
+/** Save-механика против целей: источник — ровно одно из actionId или spellId. */
+export interface EncounterOpenSavesInput {
+  casterId: string;
+  targetIds: string[];
+  actionId?: string;
+  spellId?: string;
+  slotLevel?: number;
+}
+
 /** Bound command writer supplied by useEncounterStream. expectedSeq must be
  * the version of the state snapshot from which the caller built the command. */
 export type EncounterApply = (op: ApplyOp, expectedSeq: number) => Promise<EncounterApplyResult>;
@@ -137,6 +232,28 @@ async function streamEncounter(id: string, since: number, options: EncounterStre
   }
 }
 
+export interface EncounterConcludeInput {
+  /** Побеждённые участники; по умолчанию — существа с нулём хитов. */
+  defeatedActorIds?: string[];
+  /** Получатели опыта; по умолчанию — все персонажи боя. */
+  characterIds?: string[];
+  /** Подобрать добычу из каталога по ступени опасности. */
+  treasure?: boolean;
+  /** Зерно добычи из предпросмотра — та же добыча при завершении. */
+  seed?: number;
+  awards?: EncounterItemAward[];
+}
+
+function encounterConcludeBody(input: EncounterConcludeInput) {
+  return {
+    defeated_actor_ids: input.defeatedActorIds,
+    character_ids: input.characterIds,
+    treasure: input.treasure ?? false,
+    seed: input.seed,
+    awards: input.awards,
+  };
+}
+
 export const encountersApi = {
   async list(): Promise<Encounter[]> {
     const r = await apiClient.get<{ encounters: Encounter[] }>('/api/encounters');
@@ -150,10 +267,49 @@ export const encountersApi = {
     const r = await apiClient.get<Encounter>(`/api/encounters/${id}`);
     return r.data;
   },
+  /** Статблоки всех существ боя одним текстом; скрытых видит только владелец. */
+  async statBlocksText(id: string, format: 'markdown' | 'homebrewery' = 'markdown'): Promise<string> {
+    const r = await apiClient.get<string>(`/api/encounters/${id}/statblocks`, {
+      params: { format },
+      responseType: 'text',
+    });
+    return r.data;
+  },
+  async statBlocks(id: string): Promise<MonsterStatBlock[]> {
+    const r = await apiClient.get<{ statblocks: MonsterStatBlock[] }>(`/api/encounters/${id}/statblocks`, { params: { format: 'json' } });
+    return r.data.statblocks ?? [];
+  },
   /** Owner-only teardown; the server atomically clears CharacterV3 links. */
   async delete(id: string): Promise<void> {
     await apiClient.delete(`/api/encounters/${id}`);
   },
+  /** Оценка сложности планируемого столкновения по опыту существ и уровням отряда. */
+  async difficulty(input: EncounterDifficultyInput): Promise<EncounterDifficulty> {
+    const r = await apiClient.post<EncounterDifficulty>('/api/encounters/difficulty', {
+      monsters: input.monsters.map((m) => ({ monster_id: m.monsterId, count: m.count })),
+      character_ids: input.characterIds,
+      group_id: input.groupId,
+      method: input.method,
+    });
+    return r.data;
+  },
+  /** Случайные составы под бюджет отряда; при spawn сервер создаёт бой с выбранным составом. */
+  async generate(input: EncounterGenerateInput): Promise<EncounterGenerateResult> {
+    const r = await apiClient.post<EncounterGenerateResult>('/api/encounters/generate', {
+      character_ids: input.characterIds,
+      group_id: input.groupId,
+      difficulty: input.difficulty,
+      creature_types: input.creatureTypes,
+      tags: input.tags,
+      seed: input.seed,
+      count: input.count,
+      max_monsters: input.maxMonsters,
+      spawn: input.spawn,
+      name: input.name,
+      hp: input.hp,
+    });
+    return r.data;
+  },
   /** Последние события боя (общий журнал) для бэкскролла на доске — хронологический порядок. */
   async getEvents(id: string, limit = 100): Promise<EncounterEvent[]> {
     const r = await apiClient.get<{ events: { seq: number; payload?: EncounterEvent }[] }>(`/api/encounters/${id}/events?limit=${limit}`);
@@ -179,8 +335,139 @@ export const encountersApi = {
     });
     return r.data;
   },
+  /** Спасбросок концентрации бросает сервер; исход приходит подписчикам обычным событием боя. */
+  async resolveConcentrationSave(id: string, expectedSeq: number, actorId: string, saveId: string): Promise<EncounterApplyResult> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<EncounterApplyResult>(`/api/encounters/${id}/concentration-save`, {
+      actor_id: actorId,
+      save_id: saveId,
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
+  /** Открыть спасброски save-механики действия или заклинания на целях; СЛ и исходы считает сервер. */
+  async openSaves(id: string, expectedSeq: number, input: EncounterOpenSavesInput): Promise<EncounterApplyResult> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<EncounterApplyResult>(`/api/encounters/${id}/saves`, {
+      caster_id: input.casterId,
+      target_ids: input.targetIds,
+      action_id: input.actionId,
+      spell_id: input.spellId,
+      slot_level: input.slotLevel,
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
+  /** Серверный спасбросок цели: бросок и применение исхода — одна операция боя. */
+  async resolveSave(id: string, expectedSeq: number, actorId: string, saveId: string): Promise<EncounterApplyResult> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<EncounterApplyResult>(`/api/encounters/${id}/saves/resolve`, {
+      actor_id: actorId,
+      save_id: saveId,
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
+  /** Атаку (бросок, урон, состояния) разрешает сервер одной операцией боя. */
+  async attack(id: string, expectedSeq: number, attack: EncounterAttackInput): Promise<EncounterApplyResult> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<EncounterApplyResult>(`/api/encounters/${id}/attack`, {
+      attacker_id: attack.attackerId,
+      target_id: attack.targetId,
+      card_id: attack.cardId,
+      action_id: attack.actionId,
+      advantage: attack.advantage,
+      use_mastery: attack.useMastery,
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
+  /** Инициативу бросает сервер; порядок хода и раунд приходят одной операцией. */
+  async initiative(id: string, expectedSeq: number, input: EncounterInitiativeInput = {}): Promise<EncounterApplyResult> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<EncounterApplyResult>(`/api/encounters/${id}/initiative`, {
+      actor_ids: input.actorIds,
+      advantage: input.advantage,
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
+  /** Предложить или исполнить ход существа (только мастер боя). */
+  async monsterTurn(id: string, expectedSeq: number, input: EncounterMonsterTurnInput): Promise<EncounterMonsterTurnResult> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<EncounterMonsterTurnResult>(`/api/encounters/${id}/monster-turn`, {
+      actor_id: input.actorId,
+      execute: input.execute ?? false,
+      seed: input.seed,
+      action_id: input.actionId,
+      target_id: input.targetId,
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
+  /** Предпросмотр итога боя: опыт и добыча без записи (только мастер боя). */
+  async previewConclusion(id: string, input: EncounterConcludeInput = {}): Promise<EncounterConclusion> {
+    const r = await apiClient.post<{ conclusion: EncounterConclusion }>(`/api/encounters/${id}/conclude`, {
+      ...encounterConcludeBody(input),
+      preview: true,
+    });
+    return r.data.conclusion;
+  },
+  /** Завершить бой: опыт и выданные предметы пишутся персонажам, бой закрывается. */
+  async conclude(id: string, expectedSeq: number, input: EncounterConcludeInput = {}): Promise<{ encounter: Encounter; conclusion: EncounterConclusion }> {
+    if (!Number.isSafeInteger(expectedSeq) || expectedSeq < 0) {
+      throw new RangeError('expectedSeq must be a non-negative safe integer');
+    }
+    const r = await apiClient.post<{ encounter: Encounter; conclusion: EncounterConclusion }>(`/api/encounters/${id}/conclude`, {
+      ...encounterConcludeBody(input),
+      expected_seq: expectedSeq,
+    });
+    return r.data;
+  },
   /** Один authenticated SSE-сеанс; reconnect с актуальным since делает hook. */
   stream(id: string, since: number, options: EncounterStreamOptions): Promise<void> {
     return streamEncounter(id, since, options);
   },
 };
+
+export type EncounterTemplateInput = Pick<EncounterTemplate, 'name' | 'group_id' | 'notes' | 'monster_groups'>;
+
+/** Заготовки столкновений: CRUD владельца и создание боя по заготовке. */
+export const encounterTemplatesApi = {
+  async list(): Promise<EncounterTemplate[]> {
+    const r = await apiClient.get<EncounterTemplate[]>('/api/encounter-templates');
+    return r.data;
+  },
+  async get(id: string): Promise<EncounterTemplate> {
+    const r = await apiClient.get<EncounterTemplate>(`/api/encounter-templates/${id}`);
+    return r.data;
+  },
+  async create(input: EncounterTemplateInput): Promise<EncounterTemplate> {
+    const r = await apiClient.post<EncounterTemplate>('/api/encounter-templates', input);
+    return r.data;
+  },
+  async update(id: string, input: EncounterTemplateInput): Promise<EncounterTemplate> {
+    const r = await apiClient.put<EncounterTemplate>(`/api/encounter-templates/${id}`, input);
+    return r.data;
+  },
+  async delete(id: string): Promise<void> {
+    await apiClient.delete(`/api/encounter-templates/${id}`);
+  },
+  /** Новый бой вызывающего с существами заготовки; имя по умолчанию — имя заготовки. */
+  async spawn(id: string, name?: string): Promise<Encounter> {
+    const r = await apiClient.post<Encounter>(`/api/encounter-templates/${id}/spawn`, name ? { name } : {});
+    return r.data;
+  },
+};
@@ -69,10 +69,10 @@ export function useEncounterStream(id: string | undefined) {
   // Serialize local commands and advance seq immediately from Apply responses.
   // SSE remains the cross-client delivery path, while its echo is deduplicated
   // because seqRef already contains the committed response version.
-  const apply: EncounterApply = useCallback((op: ApplyOp, expectedSeq: number): Promise<EncounterApplyResult> => {
+  const runCommand = useCallback((send: (encounterId: string) => Promise<EncounterApplyResult>): Promise<EncounterApplyResult> => {
     if (!id) return Promise.reject(new Error('Бой не выбран'));
     const run = async (): Promise<EncounterApplyResult> => {
-      const result = await encountersApi.apply(id, expectedSeq, op);
+      const result = await send(id);
       seqRef.current = result.seq;
       setSeq(result.seq);
       setState(normalizeState(result.state));
@@ -86,6 +86,27 @@ export function useEncounterStream(id: string | undefined) {
     return command;
   }, [id]);
 
+  const apply: EncounterApply = useCallback(
+    (op: ApplyOp, expectedSeq: number) => runCommand((encounterId) => encountersApi.apply(encounterId, expectedSeq, op)),
+    [runCommand],
+  );
+
+  // Спасбросок концентрации бросает сервер; команда идёт через ту же очередь, что и apply.
+  const resolveConcentrationSave = useCallback(
+    (actorId: string, saveId: string, expectedSeq: number) => runCommand(
+      (encounterId) => encountersApi.resolveConcentrationSave(encounterId, expectedSeq, actorId, saveId),
+    ),
+    [runCommand],
+  );
+
+  // Серверные спасброски (serverRolled) разрешает сервер той же очередью команд.
+  const resolveSave = useCallback(
+    (actorId: string, saveId: string, expectedSeq: number) => runCommand(
+      (encounterId) => encountersApi.resolveSave(encounterId, expectedSeq, actorId, saveId),
+    ),
+    [runCommand],
+  );
+
   useEffect(() => {
     if (!id) return;
     let cancelled = false;
@@ -158,5 +179,5 @@ export function useEncounterStream(id: string | undefined) {
     };
   }, [id]);
 
-  return { meta, state, connected, error, log, seq, reload, apply };
+  return { meta, state, connected, error, log, seq, reload, apply, resolveConcentrationSave, resolveSave };
 }
@@ -164,6 +164,25 @@ export const charactersV3Api = {
     const { data } = await apiClient.patch<ForgeCharacter>(`/api/characters-v3/${characterId}/runtime`, payload);
     return data;
   }),
+  /** Настройка на предмет: лимит и требования проверяет сервер. */
+  attune: (characterId: string, cardId: string, expectedRuntimeRevision: number): Promise<CharacterAttunementResponse> => characterV3Request('runtime', async () => {
+    const { data } = await apiClient.post<CharacterAttunementResponse>(`/api/characters-v3/${characterId}/attune`, {
+      card_id: cardId,
+      expected_runtime_revision: expectedRuntimeRevision,
+    });
+    return data;
+  }),
+  unattune: (characterId: string, cardId: string, expectedRuntimeRevision: number): Promise<CharacterAttunementResponse> => characterV3Request('runtime', async () => {
+    const { data } = await apiClient.post<CharacterAttunementResponse>(`/api/characters-v3/${characterId}/unattune`, {
+      card_id: cardId,
+      expected_runtime_revision: expectedRuntimeRevision,
+    });
+    return data;
+  }),
+  equip: (characterId: string, request: CharacterEquipRequest): Promise<CharacterEquipResponse> => characterV3Request('runtime', async () => {
+    const { data } = await apiClient.post<CharacterEquipResponse>(`/api/characters-v3/${characterId}/equip`, request);
+    return data;
+  }),
   postRuntimeCommand: (
     payload: CharacterRuntimeCommandRequest,
   ): Promise<CharacterRuntimeCommandResponse> => characterV3Request('runtime_command', async () => {
@@ -190,7 +209,7 @@ export interface PatchCharacterRuntimeRequest {
   current_hp?: number;
   max_hp?: number;
   equipment?: Record<string, string | null>;
-  inventory_items?: Array<{ card_id: string; qty: number; container_id?: string }>;
+  inventory_items?: Array<{ card_id: string; qty: number; container_id?: string; attuned?: boolean }>;
   resources?: Record<string, number>;
   max_resources?: Record<string, number>;
   active_effects?: unknown[];
@@ -198,6 +217,28 @@ export interface PatchCharacterRuntimeRequest {
   currency?: Record<string, number>;
 }
 
+export interface CharacterAttunementResponse {
+  attuned: string[];
+  slots: number;
+  character: ForgeCharacter;
+}
+
+/** Надеть предмет из сумки (card_id, slot, two_handed) или снять из слота (unequip_slot). */
+export interface CharacterEquipRequest {
+  card_id?: string;
+  slot?: string;
+  two_handed?: boolean;
+  unequip_slot?: string;
+  expected_runtime_revision: number;
+}
+
+export interface CharacterEquipResponse {
+  equipment: Record<string, string>;
+  displaced: string[];
+  armor_class: number;
+  character: ForgeCharacter;
+}
+
 export interface CharacterRuntimeCommandRulesetRef {
   system_id: string;
   release_id: string;
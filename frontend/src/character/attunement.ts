@@ -3,29 +3,30 @@
  * настроиться или прервать настройку можно только на коротком отдыхе
  * (реализация: изменения разрешены сразу после короткого/долгого отдыха,
  * начало нового хода закрывает окно до следующего отдыха).
- * Состояние — в turn_state (attuned_ids, attunement_unlocked).
+ * Настройка — флаг attuned строк inventory_items; ставит и снимает его только
+ * сервер (POST /characters-v3/:id/attune и /unattune), он же проверяет лимит и
+ * требования предмета. Строка с qty 0 лишь хранит настройку надетого предмета.
+ * Окно отдыха — в turn_state.attunement_unlocked.
  */
 import type { Card } from '../types';
 
 export const MAX_ATTUNED = 3;
 
-export function readAttunedIds(turnState: Record<string, unknown> | null | undefined): string[] {
-  const raw = turnState?.attuned_ids;
-  return Array.isArray(raw) ? raw.filter((x): x is string => typeof x === 'string') : [];
+export interface AttunementSource {
+  inventory_items?: ReadonlyArray<{ card_id: string; attuned?: boolean }> | null;
 }
 
-export function attunementUnlocked(turnState: Record<string, unknown> | null | undefined): boolean {
-  return turnState?.attunement_unlocked === true;
+export function readAttunedIds(character: AttunementSource | null | undefined): string[] {
+  const ids = (character?.inventory_items ?? []).filter((row) => row.attuned).map((row) => row.card_id);
+  return [...new Set(ids)];
 }
 
-export function isAttuned(turnState: Record<string, unknown> | null | undefined, cardId: string): boolean {
-  return readAttunedIds(turnState).includes(cardId);
+export function attunementUnlocked(turnState: Record<string, unknown> | null | undefined): boolean {
+  return turnState?.attunement_unlocked === true;
 }
 
-export function toggleAttuned(attuned: string[], cardId: string): string[] {
-  return attuned.includes(cardId)
-    ? attuned.filter((id) => id !== cardId)
-    : [...attuned, cardId];
+export function isAttuned(character: AttunementSource | null | undefined, cardId: string): boolean {
+  return readAttunedIds(character).includes(cardId);
 }
 
 export type ItemGateMode = 'equipped' | 'carried' | 'attuned';
@@ -86,10 +87,10 @@ export interface ItemMechanic {
 export function collectItemMechanics(
   equipment: Record<string, string | null | undefined>,
   cardMap: Map<string, Card>,
-  turnState: Record<string, unknown> | null | undefined,
+  attuned: readonly string[],
   inventory: ReadonlyArray<{ cardId: string; qty: number }> = [],
 ): ItemMechanic[] {
-  const ctx: ItemGateContext = { equipment, inventory, attuned: readAttunedIds(turnState) };
+  const ctx: ItemGateContext = { equipment, inventory, attuned: [...attuned] };
   const seen = new Set<string>();
   const out: ItemMechanic[] = [];
   for (const id of [...Object.values(equipment), ...inventory.map((r) => r.cardId)]) {
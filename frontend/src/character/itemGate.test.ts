@@ -77,23 +77,23 @@ describe('S2 — collectItemMechanics сканирует сумку', () => {
   ]);
 
   it('предмет while:carried из СУМКИ попадает в набор', () => {
-    const out = collectItemMechanics({}, map, null, [{ cardId: 'carried', qty: 1 }]);
+    const out = collectItemMechanics({}, map, [], [{ cardId: 'carried', qty: 1 }]);
     expect(out.map((im) => im.card.id)).toEqual(['carried']);
     expect(out[0].mechanics).toMatchObject({ id: 'carried', name: 'carried' });
   });
 
   it('обычный предмет в сумке (без while) НЕ попадает', () => {
-    const out = collectItemMechanics({}, map, null, [{ cardId: 'plain', qty: 1 }]);
+    const out = collectItemMechanics({}, map, [], [{ cardId: 'plain', qty: 1 }]);
     expect(out).toEqual([]);
   });
 
   it('надетый предмет попадает; дедуп по id (нет дублей)', () => {
-    const out = collectItemMechanics({ main_hand: 'worn' }, map, null, [{ cardId: 'worn', qty: 0 }]);
+    const out = collectItemMechanics({ main_hand: 'worn' }, map, [], [{ cardId: 'worn', qty: 0 }]);
     expect(out.map((im) => im.card.id)).toEqual(['worn']);
   });
 
   it('обратная совместимость: без аргумента inventory — только надетые', () => {
-    const out = collectItemMechanics({ body: 'worn' }, map, null);
+    const out = collectItemMechanics({ body: 'worn' }, map, []);
     expect(out.map((im) => im.card.id)).toEqual(['worn']);
   });
 });
@@ -80,7 +80,8 @@ export function alignRuntimeHp(state: RuntimeState, computedMax: number): Runtim
 }
 
 export function forgeToRuntimeState(c: ForgeCharacter): RuntimeState {
-  const inv = (c.inventory_items ?? []).map((row) => ({
+  // Строки с qty 0 лишь хранят настройку надетого предмета — в сумке их нет.
+  const inv = (c.inventory_items ?? []).filter((row) => row.qty > 0).map((row) => ({
     cardId: row.card_id,
     qty: row.qty,
     ...(row.container_id ? { containerId: row.container_id } : {}),
@@ -10,7 +10,7 @@ import {
 } from './actionSheet';
 import { loadAssembly } from './assemble';
 import type { AssembledCharacter } from './assemble';
-import { collectItemMechanics } from './attunement';
+import { collectItemMechanics, readAttunedIds } from './attunement';
 import { characterToDraft } from './forgeHelpers';
 import { buildCharacterContext, forgeToRuntimeState } from './runtime';
 import { resolveCharacterRules } from './rules/resolveCharacterRules';
@@ -36,7 +36,7 @@ export interface SheetCombatActionInventory {
  */
 export async function collectSheetCombatActionInventory(input: {
   assembled: AssembledCharacter;
-  character: Pick<ForgeCharacter, 'level' | 'turn_state'>;
+  character: Pick<ForgeCharacter, 'level' | 'turn_state' | 'inventory_items'>;
   runtime: RuntimeState;
   basicActions?: readonly Action[];
   cards: ReadonlyMap<string, Card>;
@@ -60,7 +60,7 @@ export async function collectSheetCombatActionInventory(input: {
   const itemMechanics = collectItemMechanics(
     input.runtime.equipment,
     cards,
-    input.character.turn_state,
+    readAttunedIds(input.character),
     input.runtime.inventory,
   );
 
@@ -20,6 +20,13 @@ export const CHARACTER_TYPE_LABELS: Record<CharacterType, string> = {
   dungeon_crawl: 'Dungeon Crawl',
 };
 
+/** Класс персонажа: подкласс и уровень в этом классе. */
+export interface CharacterClassEntry {
+  class_id: string;
+  subclass_id?: string | null;
+  level: number;
+}
+
 // Персонаж, как он хранится в characters_v3 (ответ бэкенда).
 export interface ForgeCharacter {
   id: string;
@@ -39,6 +46,10 @@ export interface ForgeCharacter {
   class_id?: string | null;
   background_id?: string | null;
   level: number;
+  /** Накопленный опыт; начисляет сервер при завершении боя. */
+  experience_points?: number;
+  /** Классы по порядку взятия; class_id — первый из них, level — сумма уровней. */
+  classes?: CharacterClassEntry[] | null;
 
   feat_ids?: string[] | null;
   spell_ids?: string[] | null;
@@ -67,7 +78,7 @@ export interface ForgeCharacter {
   passive_perception?: number;
 
   equipment?: Record<string, string | null> | null;
-  inventory_items?: Array<{ card_id: string; qty: number; container_id?: string }> | null;
+  inventory_items?: Array<{ card_id: string; qty: number; container_id?: string; attuned?: boolean }> | null;
   resources?: Record<string, number> | null;
   max_resources?: Record<string, number> | null;
   active_effects?: unknown[] | null;
@@ -124,6 +135,7 @@ export interface SaveForgeCharacterRequest {
   class_id?: string | null;
   background_id?: string | null;
   level?: number;
+  classes?: CharacterClassEntry[] | null;
   feat_ids?: string[] | null;
   spell_ids?: string[] | null;
   action_ids?: string[] | null;
@@ -148,7 +160,7 @@ export interface SaveForgeCharacterRequest {
   // Creation-time runtime snapshot. The create endpoint persists these fields
   // in the same INSERT so a failed second request cannot leave an orphan draft.
   equipment?: Record<string, string | null> | null;
-  inventory_items?: Array<{ card_id: string; qty: number; container_id?: string }> | null;
+  inventory_items?: Array<{ card_id: string; qty: number; container_id?: string; attuned?: boolean }> | null;
   resources?: Record<string, number> | null;
   max_resources?: Record<string, number> | null;
   active_effects?: unknown[] | null;
@@ -651,7 +651,7 @@ export default function SheetActionsPanel({
   ]);
   // Пассивки персонажа + механики надетых предметов (с учётом настройки).
   const passives = useMemo(() => {
-    const items = collectItemMechanics(character.equipment ?? {}, equipCards, character.turn_state, runtime.inventory)
+    const items = collectItemMechanics(character.equipment ?? {}, equipCards, readAttunedIds(character), runtime.inventory)
       .map((im) => im.mechanics);
     // S3: выданные предметами эффекты (grant_effect) — тот же числовой канал, что и механики предметов.
     return [...collectPassiveMechanics(assembled, character.resolved_choices ?? {}), ...items, ...(itemGrantedPassives ?? [])];
@@ -718,13 +718,13 @@ export default function SheetActionsPanel({
         : undefined,
       passives,
       // Настройка на предметы: ненастроенный магический предмет даёт только чистые статы.
-      attunedIds: readAttunedIds(character.turn_state),
+      attunedIds: readAttunedIds(character),
     }),
     [ruleState, character, equippedCards, assembled.klass, passives],
   );
 
   const itemMechs = useMemo(
-    () => collectItemMechanics(character.equipment ?? {}, equipCards, character.turn_state, runtime.inventory),
+    () => collectItemMechanics(character.equipment ?? {}, equipCards, readAttunedIds(character), runtime.inventory),
     [character.equipment, character.turn_state, equipCards, runtime.inventory],
   );
   const basicActions = useBasicActions();
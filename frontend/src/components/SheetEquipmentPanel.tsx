@@ -1,7 +1,7 @@
 import { useCallback, useEffect, useMemo, useRef, useState } from 'react';
 import { usePinMode } from '../hooks/usePinMode';
 import { Sparkles } from 'lucide-react';
-import { MAX_ATTUNED, attunementUnlocked, readAttunedIds, toggleAttuned } from '../character/attunement';
+import { MAX_ATTUNED, attunementUnlocked, readAttunedIds } from '../character/attunement';
 import { cardsApi } from '../api/client';
 import { charactersV3Api } from '../character/api';
 import type { EncounterApply } from '../battle/encountersApi';
@@ -167,7 +167,7 @@ export default function SheetEquipmentPanel({
   const putInContainer = (cardId: string, containerCardId: string) => persist(moveToContainer(runtime, cardId, containerCardId, 1));
   const takeFromContainer = (cardId: string, containerCardId: string) => persist(moveOutOfContainer(runtime, cardId, containerCardId, 1));
 
-  const attuned = readAttunedIds(character.turn_state);
+  const attuned = readAttunedIds(character);
   const canChangeAttunement = attunementUnlocked(character.turn_state);
   // Списки для окна настройки: настроенные предметы и те, на что можно настроиться.
   const presentCards = cardIds.map((id) => cardMap.get(id)).filter((c): c is Card => !!c);
@@ -192,18 +192,13 @@ export default function SheetEquipmentPanel({
     setBusy(true);
     setError(null);
     try {
-      const next = toggleAttuned(attuned, cardId);
-      if (next.length > MAX_ATTUNED) {
-        setError(`Настроиться можно максимум на ${MAX_ATTUNED} предмета`);
-        return;
-      }
-      const updated = await charactersV3Api.patchRuntime(character.id, {
-        turn_state: { ...(character.turn_state ?? {}), attuned_ids: next },
-      });
+      // Лимит и требования предмета проверяет сервер — его отказ показываем как есть.
+      const change = attuned.includes(cardId) ? charactersV3Api.unattune : charactersV3Api.attune;
+      const { character: updated } = await change(character.id, cardId, character.runtime_revision ?? 0);
       onUpdated(updated);
     } catch (e) {
       console.error(e);
-      setError('Не удалось изменить настройку');
+      setError(e instanceof Error && e.message ? e.message : 'Не удалось изменить настройку');
     } finally {
       setBusy(false);
     }
@@ -135,7 +135,15 @@ function armorAc(armor: Card, character: CharacterContext, parts: RollModifier[]
   const fixed = tryEvalNum(raw, character);
   if (fixed === null) return null;
   parts.push({ value: fixed, source: armor.name, reason: 'доспех' });
-  return fixed;
+  // Значение защиты без ЛВК: ЛВК по типу доспеха (средний — не больше +2, тяжёлый — без ЛВК).
+  const dex = character.abilityMods.dex ?? 0;
+  const dexPart = armor.defense_type === 'light' || armor.defense_type === 'cloth'
+    ? dex
+    : armor.defense_type === 'medium' ? Math.min(dex, 2) : 0;
+  if (dexPart) {
+    parts.push({ value: dexPart, source: 'ЛВК', reason: 'модификатор характеристики' });
+  }
+  return fixed + dexPart;
 }
 
 /** Вычислить КЗ с разбивкой по источникам. */
@@ -166,6 +166,10 @@ export function describeEngineEvent(event: EngineEvent): string {
       return 'Короткий отдых';
     case 'long_rest':
       return 'Длинный отдых';
+    case 'level_up':
+      return `Новый уровень ${event.level}: +${event.hpGained} HP${event.roll ? ` · ${event.roll.text}` : ''}`;
+    case 'xp_gained':
+      return `${src}Опыт +${event.amount} (всего ${event.total})`;
     case 'narrative':
       return event.text;
     default:
@@ -24,7 +24,7 @@ import {
 import { certifiedConditionEffectEntity } from '../api/conditionsApi';
 import { charactersV3Api } from '../character/api';
 import { expandItemGrantedEffects, loadAssembly } from '../character/assemble';
-import { collectItemMechanics } from '../character/attunement';
+import { collectItemMechanics, readAttunedIds } from '../character/attunement';
 import { buildSavePayload, characterToDraft } from '../character/forgeHelpers';
 import { persistDetachedManualEffects } from '../character/manualEffectPersistence';
 import {
@@ -234,7 +234,7 @@ export async function saveMobileCatalogSelection(
     const itemMechanics = collectItemMechanics(
       character.equipment ?? {},
       new Map(itemCards.map((card) => [card.id, card])),
-      character.turn_state,
+      readAttunedIds(character),
       runtime.inventory,
     );
     const itemGrantedEffects = await expandItemGrantedEffects(
@@ -6,7 +6,7 @@ import {
   type CharacterEventRow,
 } from '../character/api';
 import { loadAssembly, type AssembledCharacter } from '../character/assemble';
-import { collectItemMechanics } from '../character/attunement';
+import { collectItemMechanics, readAttunedIds } from '../character/attunement';
 import { characterToDraft } from '../character/forgeHelpers';
 import { collectEquippedCards } from '../character/inventory';
 import { collectPassiveMechanics } from '../character/resourceInit';
@@ -141,7 +141,7 @@ export function useMobileCharacter(id: string | undefined): MobileCharacterData
         ? collectItemMechanics(
           character.equipment ?? {},
           equipCards,
-          character.turn_state,
+          readAttunedIds(character),
           runtimeState?.inventory ?? [],
         )
         : []
@@ -1,5 +1,5 @@
 import { apiClient } from '../api/client';
-import type { Monster, MonsterInput, MonstersResponse } from './types';
+import type { Monster, MonsterImportReport, MonsterInput, MonstersResponse, MonsterStatBlock } from './types';
 
 export const monstersApi = {
   list: async (params?: { search?: string; page?: number; limit?: number }): Promise<MonstersResponse> => {
@@ -21,4 +21,27 @@ export const monstersApi = {
   remove: async (id: string): Promise<void> => {
     await apiClient.delete(`/api/monsters/${id}`);
   },
+  /** Статблок для печати: Markdown или Homebrewery текстом. */
+  statBlockText: async (id: string, format: 'markdown' | 'homebrewery' = 'markdown'): Promise<string> => {
+    const { data } = await apiClient.get<string>(`/api/monsters/${id}/statblock`, {
+      params: { format },
+      responseType: 'text',
+    });
+    return data;
+  },
+  statBlock: async (id: string): Promise<MonsterStatBlock> => {
+    const { data } = await apiClient.get<MonsterStatBlock>(`/api/monsters/${id}/statblock`, { params: { format: 'json' } });
+    return data;
+  },
+  /** Импорт статблоков SRD API / Open5e; dry_run только показывает изменения. */
+  importStatBlocks: async (
+    statBlocks: Record<string, unknown>[],
+    options?: { dry_run?: boolean; source?: string },
+  ): Promise<MonsterImportReport> => {
+    const { data } = await apiClient.post<MonsterImportReport>('/api/monsters/import', {
+      stat_blocks: statBlocks,
+      ...options,
+    });
+    return data;
+  },
 };
@@ -20,8 +20,24 @@ export interface Monster {
   abilities: Record<MonsterAbility, number>;
   action_ids: string[];
   effect_ids: string[];
-  ai: { strategy?: 'melee_chase'; preferred_range_ft?: number; [key: string]: unknown };
+  ai: {
+    strategy?: 'melee_chase';
+    preferred_range_ft?: number;
+    /** Приоритеты цели для серверного хода существа, по убыванию важности. */
+    target_priority?: ('lowest_hp' | 'highest_hp' | 'lowest_ac' | 'highest_ac' | 'bloodied' | 'concentrating')[];
+    /** id действий из action_ids, которые существо выбирает первыми. */
+    preferred_actions?: string[];
+    /** Доля максимума хитов, ниже которой существо отступает. */
+    retreat_below?: number;
+    /** Минимальный d6 перезарядки по id действия. */
+    recharge?: Record<string, number>;
+    [key: string]: unknown;
+  };
   token_url: string;
+  /** Метки каталога для подбора столкновений, в нижнем регистре. */
+  tags?: string[];
+  /** Кость хитов статблока («7d6+7») для бросаемых хитов; пусто — только средние. */
+  hit_dice?: string;
   source: string;
   support?: EntitySupportCertification | null;
   created_at: string;
@@ -38,3 +54,78 @@ export interface MonstersResponse {
   page: number;
   limit: number;
 }
+
+export type MonsterImportStatus = 'create' | 'update' | 'unchanged' | 'locked' | 'failed';
+
+export interface MonsterImportChange {
+  field: string;
+  from: unknown;
+  to: unknown;
+}
+
+export interface MonsterImportEntry {
+  kind: 'action' | 'effect';
+  card_number: string;
+  name: string;
+  status: MonsterImportStatus;
+  changes?: MonsterImportChange[];
+}
+
+export interface MonsterImportResult {
+  slug: string;
+  name: string;
+  status: MonsterImportStatus;
+  error?: string;
+  changes?: MonsterImportChange[];
+  actions: MonsterImportEntry[];
+  effects: MonsterImportEntry[];
+  /** Что импортировано только описанием, без исполняемой механики. */
+  narrative: string[];
+}
+
+export interface MonsterImportReport {
+  dry_run: boolean;
+  results: MonsterImportResult[];
+  created: number;
+  updated: number;
+  unchanged: number;
+  failed: number;
+}
+
+export type MonsterStatBlockFormat = 'markdown' | 'homebrewery' | 'json';
+
+export interface MonsterStatBlockEntry {
+  id: string;
+  name: string;
+  /** Пометка перезарядки: «Перезарядка 5–6», «1/день». */
+  usage?: string;
+  description: string;
+}
+
+/** Статблок для печати: ссылки на действия и эффекты раскрыты. */
+export interface MonsterStatBlock {
+  id: string;
+  slug: string;
+  name: string;
+  /** Только в выгрузке боя: число таких существ. */
+  count?: number;
+  size: string;
+  creature_type: string;
+  alignment: string;
+  armor_class: number;
+  hit_points: number;
+  hit_dice?: string;
+  speed: number;
+  initiative_bonus: number;
+  abilities: { ability: MonsterAbility; label: string; score: number; modifier: number }[];
+  challenge_rating: string;
+  xp: number;
+  proficiency_bonus: number;
+  description?: string;
+  traits: MonsterStatBlockEntry[];
+  actions: MonsterStatBlockEntry[];
+  bonus_actions: MonsterStatBlockEntry[];
+  reactions: MonsterStatBlockEntry[];
+  free_actions: MonsterStatBlockEntry[];
+  source?: string;
+}
@@ -98,6 +98,10 @@ export type EngineEvent =
   | { type: 'turn_ended' }
   | { type: 'short_rest' }
   | { type: 'long_rest' }
+  /** Повышение уровня на сервере (POST /characters-v3/:id/level-up). */
+  | { type: 'level_up'; level: number; hpGained: number; method: 'average' | 'roll'; roll?: RollLog; classId?: string; classLevel?: number }
+  /** Опыт за завершённый бой (POST /encounters/:id/conclude); total — накопленный опыт. */
+  | { type: 'xp_gained'; amount: number; total: number; source?: string }
   | {
     type: 'narrative';
     text: string;
@@ -158,6 +162,15 @@ export interface ActiveEffectEntry {
     boundary: 'start' | 'end';
     armed?: true;
   };
+  /**
+   * Связь с концентрацией заклинателя (онлайн-бой): сервер снимает эффект со всех
+   * участников, когда концентрация прерывается или вытесняется новым заклинанием.
+   */
+  concentration?: {
+    casterActorId: string;
+    spell: string;
+    spellId?: string;
+  };
 }
 
 /** Persisted creature lifecycle facts used by death saves and stabilization. */
@@ -244,7 +257,7 @@ export interface CharacterContext {
    * означает legacy-контекст без проекции; [] означает явно отсутствие владений.
    */
   weaponProficiencies?: string[];
-  /** Id предметов, на которые персонаж настроен (turn_state.attuned_ids). Для гейтинга
+  /** Id предметов, на которые персонаж настроен (строки inventory_items с attuned). Для гейтинга
    * бонусов из mechanics.weapon_profile.attunement: требующий настройки предмет без неё
    * даёт только базовые свойства. undefined — неизвестный факт и отключает бонусы fail-closed. */
   attunedIds?: string[];
@@ -26,7 +26,7 @@ import { effectAbilityPresentation } from '../character/abilityDisplay';
 import { characterToDraft, resolveLineageName } from '../character/forgeHelpers';
 import { collectEquippedCards } from '../character/inventory';
 import { collectPassiveMechanics } from '../character/resourceInit';
-import { collectItemMechanics } from '../character/attunement';
+import { collectItemMechanics, readAttunedIds } from '../character/attunement';
 import {
   buildCharacterContext,
   forgeToRuntimeState,
@@ -171,6 +171,8 @@ const CharacterSheetMVP = () => {
     state: encState,
     seq: encSeq,
     apply: applyEncounter,
+    resolveConcentrationSave,
+    resolveSave: resolveServerSave,
   } = useEncounterStream(encId ?? undefined);
   const activeEncounter = encId ? { id: encId, name: encMeta?.name ?? 'Бой' } : null;
   const soloCombatEnvelope = character?.turn_state?.solo_combat_v1;
@@ -349,7 +351,7 @@ const CharacterSheetMVP = () => {
   //  • passives → breakdown листа (числовые роли: КЗ/хиты/скорость/инициатива/спасброски/навыки);
   //  • runtimeSources → resolveCharacterRules (характеристики/владения/чувства/заклинания предметов).
   const itemMechanics = useMemo(
-    () => (character ? collectItemMechanics(character.equipment ?? {}, equipCards, character.turn_state, runtimeState?.inventory ?? []) : []),
+    () => (character ? collectItemMechanics(character.equipment ?? {}, equipCards, readAttunedIds(character), runtimeState?.inventory ?? []) : []),
     [character, equipCards, runtimeState],
   );
 
@@ -439,6 +441,20 @@ const CharacterSheetMVP = () => {
   // своим модификатором спаса vs СЛ, применяю исход (провал/половина/негейт) к себе и снимаю pending.
   const resolveIncomingSave = async (p: PendingSave) => {
     if (readOnly || !ruleState || !encId || !id || !runtimeState) return;
+    // Спасбросок концентрации и спасброски, открытые сервером, бросает сервер: он же
+    // применяет исход (и снимает эффекты заклинания при провале концентрации).
+    if (p.concentration || p.serverRolled) {
+      const own = encStateRef.current.combatants.find((c) => c.characterId === id);
+      if (!own) return;
+      try {
+        if (p.concentration) await resolveConcentrationSave(own.actorId, p.id, encSeqRef.current);
+        else await resolveServerSave(own.actorId, p.id, encSeqRef.current);
+      } catch {
+        resolvingSaveRef.current = false;
+        resolvingSaveIdRef.current = null;
+      }
+      return;
+    }
     const abilLabel = (ABILITY_LABEL_RU as Record<string, string>)[p.ability] ?? p.ability.toUpperCase();
     const mod = (ruleState.savingThrowBonuses as Record<string, number>)[p.ability] ?? 0;
     const halfLabel = (p.onSuccess.hpDelta ?? 0) < 0 ? ' · успех — половина урона' : '';
@@ -164,6 +164,7 @@ export function combatLogDetails(
     'resource_restored',
     'item_consumed',
     'item_added',
+    'xp_gained',
   ].includes(event.type);
   const targetSuffix = !actorScoped && targets.length ? ` → ${actorNames(targets, state)}` : '';
   if (event.type === 'roll') return [rollDetail(event, event.roll)];
@@ -58,6 +58,14 @@ export interface ActiveEffect {
   script?: Record<string, any> | null;
 }
 
+/** Требования настройки на предмет (проверяет сервер): classes и races —
+ * card_number или id, достаточно одного совпадения; spellcaster — нужен заклинатель. */
+export interface AttunementRequirements {
+  classes?: string[];
+  races?: string[];
+  spellcaster?: boolean;
+}
+
 export interface Card {
   support?: EntitySupportCertification | null;
   id: string;
@@ -100,6 +108,7 @@ export interface Card {
   related_effects?: Properties | null;
   attunement?: string | null;
   requires_attunement?: boolean | null;
+  attunement_requirements?: AttunementRequirements | null;
   range?: string | null;
   tags?: Properties | null;
   is_template: TemplateType;
@@ -152,6 +161,7 @@ export interface CreateCardRequest {
   related_effects?: Properties | null;
   attunement?: string | null;
   requires_attunement?: boolean | null;
+  attunement_requirements?: AttunementRequirements | null;
   range?: string | null;
   tags?: Properties | null;
   is_template?: TemplateType;
@@ -203,6 +213,7 @@ export interface UpdateCardRequest {
   related_effects?: Properties | null;
   attunement?: string | null;
   requires_attunement?: boolean | null;
+  attunement_requirements?: AttunementRequirements | null;
   range?: string | null;
   tags?: Properties | null;
   is_template?: TemplateType;
@@ -373,6 +384,8 @@ export interface Group {
   name: string;
   description: string;
   dm_id: string;
+  /** Вариантные правила нагрузки (5/10 × Сила) для персонажей группы. */
+  variant_encumbrance: boolean;
   created_at: string;
   updated_at: string;
   dm: User;
@@ -393,6 +406,11 @@ export interface GroupMember {
 export interface CreateGroupRequest {
   name: string;
   description?: string;
+  variant_encumbrance?: boolean;
+}
+
+export interface UpdateGroupRulesRequest {
+  variant_encumbrance: boolean;
 }
 
 export interface JoinGroupRequest {
@@ -1507,6 +1525,9 @@ export interface CharacterClass {
   equipment_options?: ClassEquipmentOptions | null;
   level_progression?: LevelProgression | null;
   resources?: Record<string, unknown> | null;
+  /** Прогрессия ячеек: {progression: full|half|third|pact, ability, from_level?, preparation?, prepared?, cantrips?}. */
+  spellcasting?: Record<string, unknown> | null;
+  multiclass?: Record<string, unknown> | null;
   is_subclass?: boolean | null;
   parent_class_id?: string | null;
   subclass_level?: number | null;
@@ -1541,6 +1562,9 @@ export interface CreateClassRequest {
   equipment_options?: ClassEquipmentOptions | null;
   level_progression?: LevelProgression | null;
   resources?: Record<string, unknown> | null;
+  /** Прогрессия ячеек: {progression: full|half|third|pact, ability, from_level?, preparation?, prepared?, cantrips?}. */
+  spellcasting?: Record<string, unknown> | null;
+  multiclass?: Record<string, unknown> | null;
   is_subclass?: boolean | null;
   parent_class_id?: string | null;
   subclass_level?: number | null;
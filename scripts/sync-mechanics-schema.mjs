@@ -3,6 +3,8 @@
  * Синхронизирует схему механик. КАНОН — frontend/src/schemas/mechanics.schema.json
  * (её импортируют движок, валидатор и линт; вся работа конструктора идёт туда).
  * docs/mechanics.schema.json — человекочитаемое ЗЕРКАЛО, генерируемое из канона.
+ * backend/schemas/mechanics.schema.json — копия, встраиваемая в Go-бинарник
+ * (серверная валидация механик при записи контента).
  *
  * ВАЖНО: направление frontend → docs. Раньше было docs → frontend, и это откатывало
  * более новую боевую схему (мина). Редактируй frontend-копию, затем прогони этот скрипт.
@@ -15,10 +17,12 @@ import { fileURLToPath } from 'node:url';
 
 const root = join(dirname(fileURLToPath(import.meta.url)), '..');
 const src = join(root, 'frontend/src/schemas/mechanics.schema.json');
-const dst = join(root, 'docs/mechanics.schema.json');
+const targets = ['docs/mechanics.schema.json', 'backend/schemas/mechanics.schema.json'];
 
 // Санитарная проверка: канон — валидный JSON, иначе не затираем зеркало.
 JSON.parse(readFileSync(src, 'utf8'));
 
-copyFileSync(src, dst);
-console.log('mechanics.schema.json: frontend/src/schemas/ → docs/ (зеркало обновлено)');
+for (const target of targets) {
+  copyFileSync(src, join(root, target));
+}
+console.log('mechanics.schema.json: frontend/src/schemas/ → docs/, backend/schemas/ (зеркала обновлены)');